@@ -95,3 +95,33 @@ func Parse(line string) (lineArgs []string) { // 在函数中定义的返回值
 	// 相当于 return lineArgs
 	return
 }
+
+// SplitPipe 按照不在引号内的管道符 | 拆分line，返回每一段去掉首尾空白后的内容
+func SplitPipe(line string) (segments []string) {
+	var (
+		buf       = strings.Builder{}
+		quoteChar rune
+		escaped   bool
+	)
+	for _, r := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case r == CharEscape:
+			escaped = true
+		case IsQuote(r):
+			if quoteChar == 0 {
+				quoteChar = r
+			} else if quoteChar == r {
+				quoteChar = 0
+			}
+		case r == '|' && quoteChar == 0:
+			segments = append(segments, strings.TrimSpace(buf.String()))
+			buf.Reset()
+			continue
+		}
+		buf.WriteRune(r)
+	}
+	segments = append(segments, strings.TrimSpace(buf.String()))
+	return
+}
@@ -18,6 +18,9 @@ require (
 	github.com/tickstep/bolt v1.3.4
 	github.com/tickstep/library-go v0.1.3
 	github.com/urfave/cli v1.21.1-0.20190817182405-23c83030263f
+	golang.org/x/crypto v0.0.0-20210513164829-c07d793c2f9a
+	golang.org/x/net v0.0.0-20210525063256-abc453219eb5
+	golang.org/x/text v0.3.7
 )
 
 require (
@@ -31,9 +34,7 @@ require (
 	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
 	github.com/modern-go/reflect2 v1.0.2 // indirect
 	github.com/russross/blackfriday v1.5.2 // indirect
-	golang.org/x/crypto v0.0.0-20210513164829-c07d793c2f9a // indirect
 	golang.org/x/sys v0.0.0-20211025201205-69cdffdb9359 // indirect
-	golang.org/x/text v0.3.7 // indirect
 )
 
 //replace github.com/boltdb/bolt => github.com/tickstep/bolt v1.3.4
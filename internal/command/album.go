@@ -64,8 +64,8 @@ func CmdAlbum() cli.Command {
     aliyunpan album ls
 `,
 				Action: func(c *cli.Context) error {
-					if config.Config.ActiveUser() == nil {
-						fmt.Println("未登录账号")
+					if GetActiveUser() == nil {
+						printNotLogin()
 						return nil
 					}
 					RunShareAlbumList()
@@ -86,8 +86,8 @@ func CmdAlbum() cli.Command {
     aliyunpan album list-file "我的相簿2022"
 `,
 				Action: func(c *cli.Context) error {
-					if config.Config.ActiveUser() == nil {
-						fmt.Println("未登录账号")
+					if GetActiveUser() == nil {
+						printNotLogin()
 						return nil
 					}
 					RunShareAlbumListFile(c.Args().Get(0))
@@ -108,8 +108,8 @@ func CmdAlbum() cli.Command {
     aliyunpan album download-file 我的相簿2022
 `,
 				Action: func(c *cli.Context) error {
-					if config.Config.ActiveUser() == nil {
-						fmt.Println("未登录账号")
+					if GetActiveUser() == nil {
+						printNotLogin()
 						return nil
 					}
 					subArgs := c.Args()
@@ -391,6 +391,7 @@ func RunShareAlbumDownloadFile(albumNames []string, options *DownloadOptions) {
 			unit := pandownload.DownloadTaskUnit{
 				Cfg:                  &newCfg, // 复制一份新的cfg
 				PanClient:            panClient,
+				User:                 activeUser,
 				VerbosePrinter:       panCommandVerbose,
 				PrintFormat:          downloadPrintFormat(options.Load),
 				ParentTaskExecutor:   &executor,
@@ -74,11 +74,11 @@ func CmdAlbumWeb() cli.Command {
     aliyunpan albumw ls
 `,
 				Action: func(c *cli.Context) error {
-					if config.Config.ActiveUser() == nil {
-						fmt.Println("未登录账号")
+					if GetActiveUser() == nil {
+						printNotLogin()
 						return nil
 					}
-					if config.Config.ActiveUser().PanClient().WebapiPanClient() == nil {
+					if GetActiveUser().PanClient().WebapiPanClient() == nil {
 						fmt.Println("WEB客户端未登录，请登录后再使用该命令")
 						return nil
 					}
@@ -102,11 +102,11 @@ func CmdAlbumWeb() cli.Command {
     aliyunpan albumw new "我的相簿2022" "存放2022所有文件"
 `,
 				Action: func(c *cli.Context) error {
-					if config.Config.ActiveUser() == nil {
-						fmt.Println("未登录账号")
+					if GetActiveUser() == nil {
+						printNotLogin()
 						return nil
 					}
-					if config.Config.ActiveUser().PanClient().WebapiPanClient() == nil {
+					if GetActiveUser().PanClient().WebapiPanClient() == nil {
 						fmt.Println("WEB客户端未登录，请登录后再使用该命令")
 						return nil
 					}
@@ -131,11 +131,11 @@ func CmdAlbumWeb() cli.Command {
     aliyunpan albumw rm "我的相簿2022-1" "我的相簿2022-2"
 `,
 				Action: func(c *cli.Context) error {
-					if config.Config.ActiveUser() == nil {
-						fmt.Println("未登录账号")
+					if GetActiveUser() == nil {
+						printNotLogin()
 						return nil
 					}
-					if config.Config.ActiveUser().PanClient().WebapiPanClient() == nil {
+					if GetActiveUser().PanClient().WebapiPanClient() == nil {
 						fmt.Println("WEB客户端未登录，请登录后再使用该命令")
 						return nil
 					}
@@ -157,11 +157,11 @@ func CmdAlbumWeb() cli.Command {
     aliyunpan albumw rename "我的相簿2022" "我的相簿2022-new"
 `,
 				Action: func(c *cli.Context) error {
-					if config.Config.ActiveUser() == nil {
-						fmt.Println("未登录账号")
+					if GetActiveUser() == nil {
+						printNotLogin()
 						return nil
 					}
-					if config.Config.ActiveUser().PanClient().WebapiPanClient() == nil {
+					if GetActiveUser().PanClient().WebapiPanClient() == nil {
 						fmt.Println("WEB客户端未登录，请登录后再使用该命令")
 						return nil
 					}
@@ -183,11 +183,11 @@ func CmdAlbumWeb() cli.Command {
     aliyunpan albumw list-file "我的相簿2022"
 `,
 				Action: func(c *cli.Context) error {
-					if config.Config.ActiveUser() == nil {
-						fmt.Println("未登录账号")
+					if GetActiveUser() == nil {
+						printNotLogin()
 						return nil
 					}
-					if config.Config.ActiveUser().PanClient().WebapiPanClient() == nil {
+					if GetActiveUser().PanClient().WebapiPanClient() == nil {
 						fmt.Println("WEB客户端未登录，请登录后再使用该命令")
 						return nil
 					}
@@ -209,11 +209,11 @@ func CmdAlbumWeb() cli.Command {
     aliyunpan albumw rm-file 我的相簿2022 1.png 2.png
 `,
 				Action: func(c *cli.Context) error {
-					if config.Config.ActiveUser() == nil {
-						fmt.Println("未登录账号")
+					if GetActiveUser() == nil {
+						printNotLogin()
 						return nil
 					}
-					if config.Config.ActiveUser().PanClient().WebapiPanClient() == nil {
+					if GetActiveUser().PanClient().WebapiPanClient() == nil {
 						fmt.Println("WEB客户端未登录，请登录后再使用该命令")
 						return nil
 					}
@@ -243,11 +243,11 @@ func CmdAlbumWeb() cli.Command {
     aliyunpan albumw add-file 我的相簿2022 myFolder
 `,
 				Action: func(c *cli.Context) error {
-					if config.Config.ActiveUser() == nil {
-						fmt.Println("未登录账号")
+					if GetActiveUser() == nil {
+						printNotLogin()
 						return nil
 					}
-					if config.Config.ActiveUser().PanClient().WebapiPanClient() == nil {
+					if GetActiveUser().PanClient().WebapiPanClient() == nil {
 						fmt.Println("WEB客户端未登录，请登录后再使用该命令")
 						return nil
 					}
@@ -275,11 +275,11 @@ func CmdAlbumWeb() cli.Command {
 
 `,
 				Action: func(c *cli.Context) error {
-					if config.Config.ActiveUser() == nil {
-						fmt.Println("未登录账号")
+					if GetActiveUser() == nil {
+						printNotLogin()
 						return nil
 					}
-					if config.Config.ActiveUser().PanClient().WebapiPanClient() == nil {
+					if GetActiveUser().PanClient().WebapiPanClient() == nil {
 						fmt.Println("WEB客户端未登录，请登录后再使用该命令")
 						return nil
 					}
@@ -732,6 +732,7 @@ func RunAlbumDownloadFile(albumNames []string, options *DownloadOptions) {
 			unit := pandownload.DownloadTaskUnit{
 				Cfg:                  &newCfg, // 复制一份新的cfg
 				PanClient:            panClient,
+				User:                 activeUser,
 				VerbosePrinter:       panCommandVerbose,
 				PrintFormat:          downloadPrintFormat(options.Load),
 				ParentTaskExecutor:   &executor,
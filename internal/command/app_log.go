@@ -0,0 +1,80 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/functions"
+	"github.com/tickstep/aliyunpan/internal/global"
+	"github.com/tickstep/aliyunpan/internal/log"
+	"github.com/tickstep/library-go/logger"
+	"github.com/urfave/cli"
+)
+
+var (
+	appLogOnce sync.Once
+	// appLogVerbose 把调试输出写入程序日志
+	appLogVerbose io.Writer
+)
+
+// InitAppLog 按照配置打开程序日志，作为app的Before函数在每次执行命令前调用。
+// 程序日志级别为debug时调试输出同时写入程序日志，终端是否输出调试信息仍然由 --verbose 决定
+func InitAppLog(c *cli.Context) error {
+	appLogOnce.Do(func() {
+		l := config.Config.OpenAppLogger()
+		if l == nil {
+			return
+		}
+		log.SetDefault(l)
+		if l.Enabled(log.LevelDebug) {
+			appLogVerbose = l.VerboseWriter()
+		}
+		log.Info("程序启动", "version", global.AppVersion, "args", strings.Join(os.Args[1:], " "))
+	})
+	if appLogVerbose == nil {
+		return nil
+	}
+	// 交互命令行模式下每次执行命令都会重新解析 --verbose
+	outputs := []io.Writer{appLogVerbose}
+	if logger.IsVerbose {
+		outputs = append(outputs, os.Stderr)
+	}
+	logger.Outputs = outputs
+	logger.IsVerbose = true
+	return nil
+}
+
+// logTransferResult 把上传、下载批次的结果以及失败的文件写入程序日志
+func logTransferResult(taskType string, data *transferJsonData) {
+	if data == nil {
+		return
+	}
+	for _, f := range data.Files {
+		if f.Status == functions.FileResultFailed {
+			log.Error(taskType+"文件失败", "path", f.Path, "target", f.Target, "size", f.Size, "error", f.Error)
+		}
+	}
+	keyValues := []interface{}{"target", data.Target, "total", data.TotalFiles, "succeed", data.SucceedFiles,
+		"failed", data.FailedFiles, "size", data.TotalSize, "elapsed", data.Elapsed, "canceled", data.Canceled}
+	if data.FailedFiles > 0 {
+		log.Warn(taskType+"结束", keyValues...)
+		return
+	}
+	log.Info(taskType+"结束", keyValues...)
+}
@@ -0,0 +1,284 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tickstep/aliyunpan/cmder"
+	"github.com/tickstep/aliyunpan/cmder/cmdtable"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/log"
+	"github.com/tickstep/library-go/logger"
+	"github.com/urfave/cli"
+)
+
+var (
+	// auditCommands 需要记录审计日志的写操作命令，包括子命令的完整名称
+	auditCommands = map[string]bool{
+		"upload":          true,
+		"rm":              true,
+		"mv":              true,
+		"rename":          true,
+		"mkdir":           true,
+		"cp":              true,
+		"xcp":             true,
+		"save":            true,
+		"prune-empty":     true,
+		"recycle restore": true,
+		"recycle delete":  true,
+		"dedup clean":     true,
+		"prune-backup":    true, // 每个清理的日期目录另外记录一条审计日志
+		"share set":       true,
+		"share create":    true,
+		"share cancel":    true,
+		"share save":      true,
+		"sync start":      true,
+	}
+
+	// auditResult 当前执行的命令的结果，命令通过 setAuditError、setAuditDetail 设置
+	auditResult      *log.AuditRecord
+	auditResultMutex sync.Mutex
+)
+
+// WrapAuditLog 包装写操作命令，命令执行结束后追加一条审计日志
+func WrapAuditLog(commands []cli.Command) {
+	wrapAuditLog("", commands)
+}
+
+func wrapAuditLog(parent string, commands []cli.Command) {
+	for k := range commands {
+		cmd := &commands[k]
+		name := strings.TrimSpace(parent + " " + cmd.Name)
+		if cmd.Action != nil && auditCommands[name] {
+			cmd.Action = auditAction(name, cmd.Action)
+		}
+		wrapAuditLog(name, cmd.Subcommands)
+	}
+}
+
+func auditAction(name string, action interface{}) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		rec := &log.AuditRecord{
+			Command: name,
+			Args:    auditArgs(c),
+			Result:  log.AuditResultSuccess,
+		}
+		auditResultMutex.Lock()
+		auditResult = rec
+		auditResultMutex.Unlock()
+
+		err := cli.HandleAction(action, c)
+
+		auditResultMutex.Lock()
+		auditResult = nil
+		auditResultMutex.Unlock()
+		if GetActiveUser() == nil {
+			// 未登录账号，没有执行任何写操作
+			return err
+		}
+		if err != nil && err.Error() != "" {
+			rec.Result = log.AuditResultFail
+			rec.Message = err.Error()
+		} else if err != nil {
+			// --json 模式下命令失败返回空的 ExitError，错误信息已经通过 setJsonError 记录
+			rec.Result = log.AuditResultFail
+		}
+		appendAuditRecord(rec)
+		return err
+	}
+}
+
+// auditArgs 命令的参数，指定了的选项在前，密码类选项隐藏参数值
+func auditArgs(c *cli.Context) []string {
+	args := []string{}
+	names := c.FlagNames()
+	sort.Strings(names)
+	for _, name := range names {
+		if !c.IsSet(name) {
+			continue
+		}
+		value := fmt.Sprint(c.Generic(name))
+		if strings.Contains(strings.ToLower(name), "password") {
+			value = "******"
+		}
+		args = append(args, "--"+name+"="+value)
+	}
+	return append(args, c.Args()...)
+}
+
+// appendAuditRecord 补充操作者信息后追加到审计日志，失败时只输出调试日志，不影响命令执行
+func appendAuditRecord(rec *log.AuditRecord) {
+	rec.Time = time.Now()
+	rec.Host, _ = os.Hostname()
+	if u, err := user.Current(); err == nil {
+		rec.User = u.Username
+	}
+	if activeUser := GetActiveUser(); activeUser != nil {
+		rec.Account = activeUser.Nickname
+		rec.AccountId = activeUser.UserId
+	}
+	if err := log.NewAuditLog(config.GetAuditLogFilePath()).Append(rec); err != nil {
+		logger.Verboseln("write audit log error: ", err)
+	}
+}
+
+// setAuditError 设置当前命令的审计结果为失败，不是写操作命令时忽略
+func setAuditError(message string) {
+	auditResultMutex.Lock()
+	defer auditResultMutex.Unlock()
+	if auditResult != nil {
+		auditResult.Result = log.AuditResultFail
+		if auditResult.Message != "" {
+			// 保留已经设置的操作详情
+			message = auditResult.Message + "; " + message
+		}
+		auditResult.Message = message
+	}
+}
+
+// setAuditDetail 设置当前命令的操作详情，例如上传、删除的文件数量。需要在 setAuditError 之前调用
+func setAuditDetail(format string, a ...interface{}) {
+	auditResultMutex.Lock()
+	defer auditResultMutex.Unlock()
+	if auditResult != nil {
+		auditResult.Message = fmt.Sprintf(format, a...)
+	}
+}
+
+func CmdAudit() cli.Command {
+	return cli.Command{
+		Name:      "audit",
+		Usage:     "查询文件变更审计日志",
+		UsageText: cmder.App().Name + " audit [arguments...]",
+		Description: `
+	上传、删除、移动、重命名、复制、创建目录、回收站恢复和删除、分享、转存、同步、清理重复文件和过期备份等写操作，执行结束后会追加一条审计日志，
+	记录操作时间、主机名、系统用户、网盘账号、命令参数以及操作结果。审计日志保存在配置目录下的 logs/audit.log，每行一条JSON记录。
+
+	示例:
+
+	查看最近50条审计日志
+	aliyunpan audit
+
+	查看最近24小时 alice 执行的删除操作
+	aliyunpan audit --since 24h --user alice --command rm
+
+	查看指定时间段内失败的操作
+	aliyunpan audit --since "2024-01-01 00:00:00" --until "2024-01-02 00:00:00" --fail
+`,
+		Category: "其他",
+		Action: func(c *cli.Context) error {
+			filter := &log.AuditFilter{
+				Command: c.String("command"),
+				User:    c.String("user"),
+				Host:    c.String("host"),
+				Account: c.String("account"),
+				Keyword: c.String("keyword"),
+			}
+			if c.Bool("fail") {
+				filter.Result = log.AuditResultFail
+			}
+			var ok bool
+			if filter.Since, ok = parseAuditTime("since", c.String("since")); !ok {
+				return nil
+			}
+			if filter.Until, ok = parseAuditTime("until", c.String("until")); !ok {
+				return nil
+			}
+			records, err := log.NewAuditLog(config.GetAuditLogFilePath()).Query(filter, c.Int("limit"))
+			if err != nil {
+				fmt.Printf("读取审计日志失败: %s\n", err)
+				setJsonErr(err)
+				return nil
+			}
+			setJsonData(records)
+			if len(records) == 0 {
+				fmt.Println("没有满足条件的审计日志")
+				return nil
+			}
+			tb := cmdtable.NewTable(os.Stdout)
+			tb.SetHeader([]string{"时间", "主机", "用户", "账号", "命令", "参数", "结果", "详情"})
+			for _, rec := range records {
+				tb.Append([]string{rec.Time.Format("2006-01-02 15:04:05"), rec.Host, rec.User, rec.Account, rec.Command,
+					strings.Join(rec.Args, " "), rec.Result, rec.Message})
+			}
+			tb.Render()
+			return nil
+		},
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "since",
+				Usage: "开始时间，格式: 2006-01-02 15:04:05，或者距现在的时长，例如: 24h、30m",
+			},
+			cli.StringFlag{
+				Name:  "until",
+				Usage: "结束时间，格式同 --since",
+			},
+			cli.StringFlag{
+				Name:  "command",
+				Usage: "命令，例如: upload、rm、recycle。指定命令时同时匹配它的子命令",
+			},
+			cli.StringFlag{
+				Name:  "user",
+				Usage: "执行操作的系统用户",
+			},
+			cli.StringFlag{
+				Name:  "host",
+				Usage: "执行操作的主机名",
+			},
+			cli.StringFlag{
+				Name:  "account",
+				Usage: "网盘账号昵称或者账号ID",
+			},
+			cli.StringFlag{
+				Name:  "keyword",
+				Usage: "匹配命令参数和操作详情，例如文件路径",
+			},
+			cli.BoolFlag{
+				Name:  "fail",
+				Usage: "只显示失败的操作",
+			},
+			cli.IntFlag{
+				Name:  "limit",
+				Usage: "最多显示最近的多少条记录，0代表全部",
+				Value: 50,
+			},
+		},
+	}
+}
+
+// parseAuditTime 解析查询的时间，支持时间字符串和距现在的时长
+func parseAuditTime(name, value string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, true
+	}
+	if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return time.Now().Add(-d), true
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04:05", value, time.Local); err == nil {
+		return t, true
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, true
+	}
+	fmt.Printf("--%s 时间格式错误: %s, 示例: 2006-01-02 15:04:05、24h\n", name, value)
+	setJsonError(JsonCodeBadArgs, "时间格式错误: "+value)
+	return time.Time{}, false
+}
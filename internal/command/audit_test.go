@@ -0,0 +1,34 @@
+package command
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tickstep/aliyunpan/cmder"
+	"github.com/urfave/cli"
+)
+
+func TestAuditCommandsExist(t *testing.T) {
+	cmder.SetApp(cli.NewApp())
+	commands := []cli.Command{
+		CmdUpload(), CmdRm(), CmdMv(), CmdRename(), CmdMkdir(), CmdCp(), CmdXcp(), CmdSave(),
+		CmdPruneEmpty(), CmdPruneBackup(), CmdDedup(), CmdRecycle(), CmdShare(), CmdSync(),
+	}
+	actions := map[string]bool{}
+	var walk func(parent string, commands []cli.Command)
+	walk = func(parent string, commands []cli.Command) {
+		for _, cmd := range commands {
+			name := strings.TrimSpace(parent + " " + cmd.Name)
+			if cmd.Action != nil {
+				actions[name] = true
+			}
+			walk(name, cmd.Subcommands)
+		}
+	}
+	walk("", commands)
+	for name := range auditCommands {
+		if !actions[name] {
+			t.Errorf("audit command %q not found", name)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan/cmder"
+	"github.com/tickstep/aliyunpan/cmder/cmdtable"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/functions/panwalk"
+	"github.com/tickstep/aliyunpan/internal/log"
+	"github.com/urfave/cli"
+)
+
+const (
+	// DefaultBackupRetention 默认保留策略：最近7天、4周、12个月
+	DefaultBackupRetention = "7d,4w,12m"
+)
+
+type (
+	// backupRetention 按日期目录轮转的备份保留策略。
+	// 从新到旧检查每个日期目录，每天、每周、每月各保留最新的一个备份，分别保留最近的 Days、Weeks、Months 个
+	backupRetention struct {
+		Days   int
+		Weeks  int
+		Months int
+	}
+
+	// backupDir 以日期命名的备份目录
+	backupDir struct {
+		File   *aliyunpan.FileEntity
+		Date   time.Time
+		Reason string // 保留的原因，为空代表超出保留策略，需要清理
+	}
+)
+
+var (
+	// backupDateLayouts 支持的日期目录名称格式
+	backupDateLayouts = []string{
+		"2006-01-02",
+		"20060102",
+		"2006-01-02_150405",
+		"2006-01-02-150405",
+		"20060102_150405",
+		"20060102-150405",
+		"2006-01-02_15-04-05",
+	}
+)
+
+// parseBackupRetention 解析保留策略，格式: 7d,4w,12m，分别代表保留最近7天、4周、12个月的备份
+func parseBackupRetention(s string) (*backupRetention, error) {
+	r := &backupRetention{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == "" {
+			continue
+		}
+		n, err := strconv.Atoi(item[:len(item)-1])
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("保留策略格式错误: %s, 示例: 7d,4w,12m", item)
+		}
+		switch item[len(item)-1] {
+		case 'd':
+			r.Days = n
+		case 'w':
+			r.Weeks = n
+		case 'm':
+			r.Months = n
+		default:
+			return nil, fmt.Errorf("保留策略格式错误: %s, 示例: 7d,4w,12m", item)
+		}
+	}
+	if r.Days+r.Weeks+r.Months == 0 {
+		return nil, fmt.Errorf("保留策略不能为空, 示例: 7d,4w,12m")
+	}
+	return r, nil
+}
+
+func (r *backupRetention) String() string {
+	return fmt.Sprintf("最近%d天, %d周, %d个月", r.Days, r.Weeks, r.Months)
+}
+
+// parseBackupDate 解析日期目录名称，不是日期格式返回false
+func parseBackupDate(name string) (time.Time, bool) {
+	for _, layout := range backupDateLayouts {
+		if t, err := time.ParseInLocation(layout, name, time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// apply 按保留策略标记需要保留的目录，返回按日期从新到旧排列的所有目录
+func (r *backupRetention) apply(dirs []*backupDir) []*backupDir {
+	sort.SliceStable(dirs, func(i, j int) bool {
+		return dirs[i].Date.After(dirs[j].Date)
+	})
+	rules := []struct {
+		name  string
+		count int
+		key   func(t time.Time) string
+	}{
+		{"日", r.Days, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{"周", r.Weeks, func(t time.Time) string {
+			y, w := t.ISOWeek()
+			return fmt.Sprintf("%d-%d", y, w)
+		}},
+		{"月", r.Months, func(t time.Time) string { return t.Format("2006-01") }},
+	}
+	for _, rule := range rules {
+		seen := map[string]bool{}
+		for _, d := range dirs {
+			if len(seen) >= rule.count {
+				break
+			}
+			key := rule.key(d.Date)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			if d.Reason != "" {
+				d.Reason += ","
+			}
+			d.Reason += rule.name
+		}
+	}
+	return dirs
+}
+
+func CmdPruneBackup() cli.Command {
+	return cli.Command{
+		Name:      "prune-backup",
+		Usage:     "按保留策略清理旧的日期备份目录",
+		UsageText: cmder.App().Name + " prune-backup [--keep 7d,4w,12m] <备份目录路径>",
+		Description: `
+	按日期目录做全量备份时，按保留策略清理备份目录下超出策略的旧日期目录，清理的目录移入网盘回收站。
+	日期目录的名称格式为 2006-01-02、20060102、2006-01-02_150405、20060102-150405 等，不是日期格式的目录不会被清理。
+	保留策略默认为 7d,4w,12m，即保留最近7天每天最新的备份、最近4周每周最新的备份、最近12个月每月最新的备份。
+
+	上传时也可以使用 upload --retention，上传目标目录是日期目录时，上传成功后自动清理同级的旧日期目录。
+
+	示例:
+
+	预览 /备份 目录下将要清理的日期目录，不会实际删除
+	aliyunpan prune-backup --dry-run /备份
+
+	保留最近14天、8周、24个月的备份，清理其余的日期目录
+	aliyunpan prune-backup --keep 14d,8w,24m /备份
+`,
+		Category: "阿里云盘",
+		Before:   ReloadConfigFunc,
+		Action: func(c *cli.Context) error {
+			if c.NArg() != 1 {
+				cli.ShowCommandHelp(c, c.Command.Name)
+				return nil
+			}
+			if GetActiveUser() == nil {
+				printNotLogin()
+				return nil
+			}
+			policy, err := parseBackupRetention(c.String("keep"))
+			if err != nil {
+				fmt.Println(err)
+				setJsonError(JsonCodeBadArgs, err.Error())
+				return nil
+			}
+			if err = RunPruneBackup(parseDriveId(c), c.Args().Get(0), policy, c.Bool("dry-run")); err != nil {
+				fmt.Println(err)
+				setJsonErr(err)
+			}
+			return nil
+		},
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "driveId",
+				Usage: "网盘ID",
+				Value: "",
+			},
+			cli.StringFlag{
+				Name:  "keep",
+				Usage: "保留策略，d代表天、w代表周、m代表月，例如: 7d,4w,12m",
+				Value: DefaultBackupRetention,
+			},
+			cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "只输出清理报告，不实际删除",
+			},
+		},
+	}
+}
+
+// RunPruneBackup 按保留策略清理备份目录下的旧日期目录，并输出清理报告
+func RunPruneBackup(driveId, pathStr string, policy *backupRetention, dryRun bool) error {
+	return runPruneBackup(GetActiveUser(), "prune-backup", driveId, pathStr, policy, dryRun)
+}
+
+func runPruneBackup(activeUser *config.PanUser, trigger, driveId, pathStr string, policy *backupRetention, dryRun bool) error {
+	panClient := activeUser.PanClient()
+	targetPath := path.Clean(activeUser.PathJoin(driveId, pathStr))
+	targetInfo, apierr := panClient.OpenapiPanClient().FileInfoByPath(driveId, targetPath)
+	if apierr != nil || targetInfo == nil {
+		return fmt.Errorf("目录不存在: %s", targetPath)
+	}
+	if !targetInfo.IsFolder() {
+		return fmt.Errorf("指定的路径不是目录: %s", targetPath)
+	}
+
+	ctx := newRemoveBatchContext(driveId, DefaultRemoveBatchSize, DefaultRemoveBatchRetry, panClient)
+	fileList, err := panwalk.NewWalker(panClient, driveId).ListFolder(targetInfo.FileId)
+	if err != nil {
+		return fmt.Errorf("获取备份目录列表失败: %s", err)
+	}
+	dirs := []*backupDir{}
+	for _, f := range fileList {
+		if !f.IsFolder() {
+			continue
+		}
+		if t, ok := parseBackupDate(f.FileName); ok {
+			f.Path = path.Join(targetPath, f.FileName)
+			dirs = append(dirs, &backupDir{File: f, Date: t})
+		}
+	}
+	if len(dirs) == 0 {
+		fmt.Printf("备份目录 %s 下没有日期目录\n", targetPath)
+		return nil
+	}
+
+	dirs = policy.apply(dirs)
+	expired := []*aliyunpan.FileEntity{}
+	for _, d := range dirs {
+		if d.Reason == "" {
+			expired = append(expired, d.File)
+		}
+	}
+	failed := map[string]bool{}
+	if !dryRun && len(expired) > 0 {
+		for _, f := range ctx.removeBatchWithRetry(expired) {
+			failed[f.FileId] = true
+		}
+		for _, f := range expired {
+			config.GetFolderIdCache().Invalidate(driveId, f.Path)
+			auditPruneBackup(trigger, f.Path, failed[f.FileId])
+		}
+		activeUser.DeleteCache(GetAllPathFolderByPath(targetPath))
+	}
+
+	fmt.Printf("备份保留策略: %s, 日期目录 %d 个, 保留 %d 个, 清理 %d 个\n", policy, len(dirs), len(dirs)-len(expired), len(expired))
+	tb := cmdtable.NewTable(os.Stdout)
+	tb.SetHeader([]string{"#", "日期目录", "结果"})
+	for k, d := range dirs {
+		result := "保留(" + d.Reason + ")"
+		switch {
+		case d.Reason != "":
+		case dryRun:
+			result = "将清理"
+		case failed[d.File.FileId]:
+			result = "清理失败"
+		default:
+			result = "已移入回收站"
+		}
+		tb.Append([]string{strconv.Itoa(k + 1), d.File.Path, result})
+	}
+	tb.Render()
+	if dryRun && len(expired) > 0 {
+		fmt.Println("dry-run模式，未实际删除")
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("有 %d 个日期目录清理失败", len(failed))
+	}
+	return nil
+}
+
+// auditPruneBackup 每个清理的日期目录追加一条审计日志，trigger为触发清理的命令
+func auditPruneBackup(trigger, dirPath string, failed bool) {
+	rec := &log.AuditRecord{
+		Command: "prune-backup",
+		Args:    []string{dirPath},
+		Result:  log.AuditResultSuccess,
+		Message: trigger + " 按保留策略清理过期的日期目录，移入回收站",
+	}
+	if failed {
+		rec.Result = log.AuditResultFail
+		rec.Message = trigger + " 按保留策略清理过期的日期目录失败"
+	}
+	appendAuditRecord(rec)
+}
@@ -0,0 +1,84 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/log"
+)
+
+func TestBackupRetention(t *testing.T) {
+	if _, err := parseBackupRetention("7x"); err == nil {
+		t.Fatal("invalid retention should fail")
+	}
+	if _, err := parseBackupRetention("0d"); err == nil {
+		t.Fatal("empty retention should fail")
+	}
+	policy, err := parseBackupRetention("3d, 2w, 2m")
+	if err != nil || policy.Days != 3 || policy.Weeks != 2 || policy.Months != 2 {
+		t.Fatalf("unexpected retention: %+v, %v", policy, err)
+	}
+
+	if _, ok := parseBackupDate("photos"); ok {
+		t.Fatal("photos is not a date folder")
+	}
+	// 2026-03-01 ~ 2026-03-12 每天一个备份，再加上 2026-01-31
+	dirs := []*backupDir{}
+	for _, name := range []string{"2026-01-31", "20260301", "2026-03-02", "2026-03-03", "2026-03-04", "2026-03-05",
+		"2026-03-06", "2026-03-07", "2026-03-08", "2026-03-09", "2026-03-10", "2026-03-11", "2026-03-12_230000"} {
+		d, ok := parseBackupDate(name)
+		if !ok {
+			t.Fatalf("parse date folder failed: %s", name)
+		}
+		dirs = append(dirs, &backupDir{File: &aliyunpan.FileEntity{FileName: name}, Date: d})
+	}
+	kept := map[string]string{}
+	for _, d := range policy.apply(dirs) {
+		if d.Reason != "" {
+			kept[d.File.FileName] = d.Reason
+		}
+	}
+	// 最近3天 + 2026-03-08(上一周的最后一天) + 2026-01-31(上一个月的最后一天)
+	want := map[string]string{
+		"2026-03-12_230000": "日,周,月",
+		"2026-03-11":        "日",
+		"2026-03-10":        "日",
+		"2026-03-08":        "周",
+		"2026-01-31":        "月",
+	}
+	if len(kept) != len(want) {
+		t.Fatalf("unexpected kept folders: %v", kept)
+	}
+	for name, reason := range want {
+		if kept[name] != reason {
+			t.Errorf("%s: reason = %q, want %q", name, kept[name], reason)
+		}
+	}
+	if !dirs[0].Date.After(dirs[1].Date) || dirs[0].Date.Hour() != 23 {
+		t.Errorf("folders should be sorted from newest to oldest")
+	}
+}
+
+func TestAuditPruneBackup(t *testing.T) {
+	logDir := config.Config.LogDir
+	config.Config.LogDir = t.TempDir()
+	defer func() { config.Config.LogDir = logDir }()
+
+	auditPruneBackup("upload --retention", "/备份/2026-01-01", false)
+	auditPruneBackup("prune-backup", "/备份/2026-01-02", true)
+	records, err := log.NewAuditLog(config.GetAuditLogFilePath()).Query(&log.AuditFilter{Command: "prune-backup"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("audit records = %d, want 2", len(records))
+	}
+	results := map[string]string{}
+	for _, rec := range records {
+		results[rec.Args[0]] = rec.Result
+	}
+	if results["/备份/2026-01-01"] != log.AuditResultSuccess || results["/备份/2026-01-02"] != log.AuditResultFail {
+		t.Fatalf("unexpected audit records: %v", results)
+	}
+}
@@ -16,7 +16,6 @@ package command
 import (
 	"fmt"
 	"github.com/tickstep/aliyunpan/cmder"
-	"github.com/tickstep/aliyunpan/internal/config"
 	"github.com/urfave/cli"
 )
 
@@ -49,8 +48,8 @@ func CmdCd() cli.Command {
 				cli.ShowCommandHelp(c, c.Command.Name)
 				return nil
 			}
-			if config.Config.ActiveUser() == nil {
-				fmt.Println("未登录账号")
+			if GetActiveUser() == nil {
+				printNotLogin()
 				return nil
 			}
 			RunChangeDirectory(parseDriveId(c), c.Args().Get(0))
@@ -74,11 +73,11 @@ func CmdPwd() cli.Command {
 		Category:  "阿里云盘",
 		Before:    ReloadConfigFunc,
 		Action: func(c *cli.Context) error {
-			if config.Config.ActiveUser() == nil {
-				fmt.Println("未登录账号")
+			if GetActiveUser() == nil {
+				printNotLogin()
 				return nil
 			}
-			activeUser := config.Config.ActiveUser()
+			activeUser := GetActiveUser()
 			if activeUser.IsFileDriveActive() {
 				fmt.Println(activeUser.Workdir)
 			} else if activeUser.IsResourceDriveActive() {
@@ -92,7 +91,7 @@ func CmdPwd() cli.Command {
 }
 
 func RunChangeDirectory(driveId, targetPath string) {
-	user := config.Config.ActiveUser()
+	user := GetActiveUser()
 	targetPath = user.PathJoin(driveId, targetPath)
 
 	// 获取目标路径文件信息
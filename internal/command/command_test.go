@@ -2,6 +2,7 @@ package command
 
 import (
 	"testing"
+	"time"
 )
 
 func TestRapidUploadItem_createRapidUploadLink(t *testing.T) {
@@ -11,3 +12,74 @@ func TestRapidUploadItem_createRapidUploadLink(t *testing.T) {
 func TestRapidUploadItem_newRapidUploadItem(t *testing.T) {
 
 }
+
+func TestParseSelection(t *testing.T) {
+	idx, err := parseSelection("1, 3-4，3,6", 6)
+	if err != nil || len(idx) != 4 || idx[0] != 0 || idx[1] != 2 || idx[2] != 3 || idx[3] != 5 {
+		t.Errorf("unexpected selection: %v %v", idx, err)
+	}
+	if idx, _ = parseSelection(" ", 3); idx != nil {
+		t.Error("empty input should select all")
+	}
+	for _, in := range []string{"0", "4", "3-2", "a"} {
+		if _, err = parseSelection(in, 3); err == nil {
+			t.Errorf("input %s should be invalid", in)
+		}
+	}
+}
+
+func TestParseShareId(t *testing.T) {
+	for _, link := range []string{
+		"ABCD1234wxyz",
+		"https://www.alipan.com/s/ABCD1234wxyz",
+		"https://www.aliyundrive.com/s/ABCD1234wxyz/folder/61f0a1b2c3",
+		"https://www.alipan.com/s/ABCD1234wxyz?pwd=akd1",
+	} {
+		if id := parseShareId(link); id != "ABCD1234wxyz" {
+			t.Errorf("unexpected share id: %s -> %s", link, id)
+		}
+	}
+}
+
+func TestParseFanoutTarget(t *testing.T) {
+	for spec, want := range map[string][2]string{
+		"/backup":           {"", "/backup"},
+		"/a:b":              {"", "/a:b"},
+		"alice:/backup":     {"alice", "/backup"},
+		" alice : /backup ": {"alice", "/backup"},
+		"backup/2024":       {"", "backup/2024"},
+	} {
+		if user, p := parseFanoutTarget(spec); user != want[0] || p != want[1] {
+			t.Errorf("unexpected fanout target: %q -> %q %q", spec, user, p)
+		}
+	}
+}
+
+func TestIsDirContentsPath(t *testing.T) {
+	for p, want := range map[string]bool{"photos/": true, "/": true, "./": true, "photos": false, "/home/photos": false} {
+		if isDirContentsPath(p) != want {
+			t.Errorf("%s should be %v", p, want)
+		}
+	}
+}
+
+func TestParseShareExpire(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.Local)
+	cases := map[string]string{
+		"0":                   "",
+		"12h":                 "2024-05-01 22:00:00",
+		"7d":                  "2024-05-08 10:00:00",
+		"2024-06-01":          "2024-06-01 23:59:59",
+		"2024-06-01 08:30:00": "2024-06-01 08:30:00",
+	}
+	for expire, want := range cases {
+		if got, err := parseShareExpire(expire, now); err != nil || got != want {
+			t.Errorf("%s: got %q, %v, want %q", expire, got, err, want)
+		}
+	}
+	for _, expire := range []string{"abc", "-1d", "2024-04-01"} {
+		if _, err := parseShareExpire(expire, now); err == nil {
+			t.Errorf("%s should be invalid", expire)
+		}
+	}
+}
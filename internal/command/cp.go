@@ -17,10 +17,10 @@ import (
 	"fmt"
 	"github.com/tickstep/aliyunpan-api/aliyunpan"
 	"github.com/tickstep/aliyunpan/cmder/cmdtable"
-	"github.com/tickstep/aliyunpan/internal/config"
 	"github.com/urfave/cli"
 	"os"
 	"strconv"
+	"strings"
 )
 
 func CmdCp() cli.Command {
@@ -47,8 +47,8 @@ func CmdCp() cli.Command {
 				cli.ShowCommandHelp(c, c.Command.Name)
 				return nil
 			}
-			if config.Config.ActiveUser() == nil {
-				fmt.Println("未登录账号")
+			if GetActiveUser() == nil {
+				printNotLogin()
 				return nil
 			}
 			RunCopy(parseDriveId(c), c.Args()...)
@@ -71,14 +71,17 @@ func RunCopy(driveId string, paths ...string) {
 	opFileList, targetFile, _, err := getFileInfo(driveId, paths...)
 	if err != nil {
 		fmt.Println(err)
+		setJsonError(JsonCodeBadArgs, err.Error())
 		return
 	}
 	if targetFile == nil {
 		fmt.Println("目标文件不存在")
+		setJsonError(JsonCodeBadArgs, "目标文件不存在")
 		return
 	}
 	if opFileList == nil || len(opFileList) == 0 {
 		fmt.Println("没有有效的文件可复制")
+		setJsonError(JsonCodeBadArgs, "没有有效的文件可复制")
 		return
 	}
 	cacheCleanPaths = append(cacheCleanPaths, targetFile.Path)
@@ -100,10 +103,13 @@ func RunCopy(driveId string, paths ...string) {
 
 	if len(failedCopyFiles) > 0 {
 		fmt.Println("以下文件复制失败：")
+		failedPaths := []string{}
 		for _, f := range failedCopyFiles {
 			fmt.Println(f.Path)
+			failedPaths = append(failedPaths, f.Path)
 		}
 		fmt.Println("")
+		setJsonError(JsonCodePartialFailed, "复制失败: "+strings.Join(failedPaths, ", "))
 	}
 	if len(successCopyFiles) > 0 {
 		pnt := func() {
@@ -116,6 +122,7 @@ func RunCopy(driveId string, paths ...string) {
 		}
 		fmt.Println("操作成功, 以下文件已复制到目标目录: ", targetFile.Path)
 		pnt()
+		setJsonSuccess()
 		activeUser.DeleteCache(cacheCleanPaths)
 	} else {
 		fmt.Println("无法复制文件，请稍后重试")
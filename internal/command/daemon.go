@@ -0,0 +1,363 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan/cmder"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/daemon"
+	"github.com/tickstep/aliyunpan/internal/file/downloader"
+	"github.com/tickstep/aliyunpan/internal/functions"
+	"github.com/tickstep/aliyunpan/internal/functions/pandownload"
+	"github.com/tickstep/aliyunpan/internal/global"
+	"github.com/tickstep/aliyunpan/internal/log"
+	"github.com/tickstep/aliyunpan/internal/metrics"
+	"github.com/tickstep/aliyunpan/internal/syncdrive"
+	"github.com/tickstep/aliyunpan/internal/systemd"
+	"github.com/tickstep/aliyunpan/internal/taskframework"
+	"github.com/tickstep/aliyunpan/internal/utils"
+	"github.com/tickstep/library-go/logger"
+	"github.com/urfave/cli"
+)
+
+type (
+	// DaemonOptions daemon启动参数
+	DaemonOptions struct {
+		ListenAddr string // 监听地址
+		Token      string // 访问令牌，为空时启动时自动生成
+		MaxJobs    int    // 同时执行的任务数量
+	}
+)
+
+func CmdDaemon() cli.Command {
+	return cli.Command{
+		Name:      "daemon",
+		Usage:     "以后台服务方式运行，通过本地HTTP API提交和管理上传、下载、同步任务",
+		UsageText: cmder.App().Name + " daemon [arguments...]",
+		Description: `
+	启动常驻进程，GUI或者脚本通过HTTP API提交上传、下载、同步任务，查询进度以及暂停、恢复、取消任务，不需要每次启动新的命令行进程。
+	任务按提交顺序执行，暂停或者取消任务后正在传输的文件会继续传输完成，之后不再开始新的文件。
+	上传、下载都支持断点续传，取消后重新提交相同的任务即可继续。同步任务只执行一次同步，只支持取消。
+	默认只监听本机地址。请求需要携带访问令牌，没有设置令牌时启动时自动生成，并保存到配置目录的 daemon.token 文件中。
+	为避免其他网站通过浏览器访问API，监听本机地址时只接受Host为本机地址的请求，并且总是拒绝Origin不是本机地址的请求。
+
+	示例:
+
+	启动daemon，默认监听 127.0.0.1:5299
+	aliyunpan daemon
+
+	指定监听地址和访问令牌，同时执行2个任务
+	aliyunpan daemon -listen 0.0.0.0:5299 -token mytoken -jobs 2
+
+	API:
+	GET    /api/v1/status               daemon状态
+	GET    /api/v1/jobs                 任务列表
+	POST   /api/v1/jobs                 提交任务
+	GET    /api/v1/jobs/{id}            任务详情以及进度
+	POST   /api/v1/jobs/{id}/pause      暂停任务
+	POST   /api/v1/jobs/{id}/resume     恢复任务
+	POST   /api/v1/jobs/{id}/cancel     取消任务
+	DELETE /api/v1/jobs/{id}            移除已结束的任务
+	POST   /api/v1/jobs/batch/{action}  按标签批量暂停(pause)、恢复(resume)、取消(cancel)任务
+
+	提交上传任务，TOKEN为访问令牌
+	curl -X POST http://127.0.0.1:5299/api/v1/jobs -H "Authorization: Bearer $TOKEN" -d '{"type":"upload","localPaths":["/home/tickstep/Documents"],"panPath":"/文档"}'
+
+	提交下载任务
+	curl -X POST http://127.0.0.1:5299/api/v1/jobs -H "Authorization: Bearer $TOKEN" -d '{"type":"download","panPaths":["/文档"],"saveTo":"/home/tickstep/Downloads"}'
+
+	提交同步任务
+	curl -X POST http://127.0.0.1:5299/api/v1/jobs -H "Authorization: Bearer $TOKEN" -d '{"type":"sync","localPath":"/home/tickstep/Documents","panPath":"/sync_drive/我的文档","mode":"upload"}'
+
+	提交带标签的任务，查询并批量暂停同标签的任务
+	curl -X POST http://127.0.0.1:5299/api/v1/jobs -H "Authorization: Bearer $TOKEN" -d '{"type":"upload","localPaths":["/home/tickstep/Photos"],"panPath":"/照片","tags":{"job":"photos"}}'
+	curl -H "Authorization: Bearer $TOKEN" "http://127.0.0.1:5299/api/v1/jobs?tag=job=photos"
+	curl -X POST -H "Authorization: Bearer $TOKEN" "http://127.0.0.1:5299/api/v1/jobs/batch/pause?tag=job=photos"
+`,
+		Category: "阿里云盘",
+		Before:   ReloadConfigFunc,
+		Action: func(c *cli.Context) error {
+			if GetActiveUser() == nil {
+				printNotLogin()
+				return nil
+			}
+			RunDaemon(&DaemonOptions{
+				ListenAddr: c.String("listen"),
+				Token:      c.String("token"),
+				MaxJobs:    c.Int("jobs"),
+			})
+			return nil
+		},
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "listen",
+				Usage: "API监听地址",
+				Value: daemon.DefaultListenAddr,
+			},
+			cli.StringFlag{
+				Name:   "token",
+				Usage:  "访问令牌，请求需要携带 Authorization: Bearer <token>，不设置时自动生成",
+				EnvVar: "ALIYUNPAN_DAEMON_TOKEN",
+			},
+			cli.IntFlag{
+				Name:  "jobs",
+				Usage: "同时执行的任务数量",
+				Value: 1,
+			},
+		},
+	}
+}
+
+// RunDaemon 启动daemon，收到退出信号后取消所有任务并等待正在传输的文件完成
+func RunDaemon(opt *DaemonOptions) {
+	activeUser := GetActiveUser()
+	if opt.Token == "" {
+		token, err := daemon.GenerateToken()
+		if err != nil {
+			fmt.Printf("生成访问令牌失败: %s\n", err)
+			return
+		}
+		opt.Token = token
+		tokenFile := path.Join(config.GetConfigDir(), "daemon.token")
+		if err := os.WriteFile(tokenFile, []byte(token), 0600); err != nil {
+			fmt.Printf("保存访问令牌失败: %s\n", err)
+		} else {
+			fmt.Printf("访问令牌已保存到: %s\n", tokenFile)
+		}
+		fmt.Printf("访问令牌: %s\n", token)
+	}
+
+	manager := daemon.NewManager(runDaemonJob, opt.MaxJobs)
+	metrics.Default.Register("daemon", manager.CollectMetrics)
+	defer metrics.Default.Unregister("daemon")
+	server := &http.Server{
+		Addr:    opt.ListenAddr,
+		Handler: daemon.NewHandler(manager, opt.Token, daemon.IsLoopbackAddr(opt.ListenAddr), global.AppVersion, activeUser.Nickname),
+	}
+	// 先监听端口再通知systemd启动完成
+	listener, err := net.Listen("tcp", opt.ListenAddr)
+	if err != nil {
+		fmt.Printf("daemon启动失败: %s\n", err)
+		return
+	}
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- server.Serve(listener)
+	}()
+	fmt.Printf("daemon已启动: http://%s%s\n", opt.ListenAddr, daemon.ApiPrefix)
+	fmt.Println("按 Ctrl+C 停止服务")
+	stopDigest := runNotifyDigest(newNotifyDigest())
+	defer stopDigest()
+	stopMetrics := startMetricsServer()
+	defer stopMetrics()
+
+	// 以systemd服务运行时通知启动完成，并按照看门狗时间发送心跳。任务传输卡死时停止心跳，由systemd重启服务
+	if ok, _ := systemd.Notify(systemd.StateReady); ok {
+		logger.Verboseln("notify systemd: daemon is ready")
+	}
+	watchdogStop := make(chan struct{})
+	go systemd.RunWatchdog(func() bool {
+		return manager.IsActive(systemd.WatchdogInterval())
+	}, watchdogStop)
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+	select {
+	case err := <-errChan:
+		fmt.Printf("daemon异常退出: %s\n", err)
+	case <-sigChan:
+		fmt.Println("正在停止daemon，等待正在传输的文件完成...")
+	}
+	close(watchdogStop)
+	systemd.Notify(systemd.StateStopping)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	server.Shutdown(ctx)
+	manager.Close()
+	fmt.Println("daemon已停止")
+}
+
+// runDaemonJob 执行daemon提交的任务
+func runDaemonJob(job *daemon.Job, control *taskframework.TaskControl) error {
+	activeUser := GetActiveUser()
+	req := job.Request()
+	driveId := req.DriveId
+	if driveId == "" {
+		driveId = activeUser.ActiveDriveId
+	}
+	if len(req.Tags) > 0 {
+		fmt.Printf("[daemon] 开始执行任务 %s: %s, 标签: %s\n", job.Id(), req.Type, daemon.TagSelector(req.Tags))
+	} else {
+		fmt.Printf("[daemon] 开始执行任务 %s: %s\n", job.Id(), req.Type)
+	}
+
+	switch req.Type {
+	case daemon.JobUpload:
+		for _, p := range req.LocalPaths {
+			if !filepath.IsAbs(p) {
+				return fmt.Errorf("本地路径请指定绝对路径: %s", p)
+			}
+		}
+		result := runUpload(activeUser, req.LocalPaths, req.PanPath, &UploadOptions{
+			AllParallel:  req.Parallel,
+			Parallel:     1,
+			MaxRetry:     DefaultUploadMaxRetry,
+			IsOverwrite:  req.Overwrite,
+			DriveId:      driveId,
+			ShowProgress: false,
+			RateClass:    req.RateClass,
+			Order:        req.Order,
+			Priority:     req.Priority,
+			Control:      control,
+		})
+		// 后台上传任务不经过命令行，单独记录审计日志
+		rec := &log.AuditRecord{
+			Command: "daemon upload",
+			Args:    append(append([]string{}, req.LocalPaths...), req.PanPath),
+			Result:  log.AuditResultFail,
+			Message: "任务 " + job.Id(),
+		}
+		if result != nil {
+			rec.Message += ", " + uploadAuditDetail(result)
+			if !result.Canceled && result.FailedFiles == 0 {
+				rec.Result = log.AuditResultSuccess
+			}
+		}
+		appendAuditRecord(rec)
+	case daemon.JobDownload:
+		if req.SaveTo != "" && !filepath.IsAbs(req.SaveTo) {
+			return fmt.Errorf("保存目录请指定绝对路径: %s", req.SaveTo)
+		}
+		onExist := pandownload.OnExistSkip
+		if req.Overwrite {
+			onExist = pandownload.OnExistOverwrite
+		}
+		RunDownload(req.PanPaths, &DownloadOptions{
+			DownloadActionId: utils.UuidStr(),
+			IsOverwrite:      req.Overwrite,
+			OnExist:          onExist,
+			SaveTo:           req.SaveTo,
+			Parallel:         req.Parallel,
+			SliceParallel:    downloader.MaxParallelWorkerCount,
+			MaxRetry:         pandownload.DefaultDownloadMaxRetry,
+			ShowProgress:     false,
+			DriveId:          driveId,
+			RateClass:        req.RateClass,
+			Order:            req.Order,
+			Priority:         req.Priority,
+			Control:          control,
+		})
+	case daemon.JobSync:
+		return runDaemonSyncJob(req, control)
+	}
+	return nil
+}
+
+// runDaemonSyncJob 执行一次同步，取消时停止同步任务
+func runDaemonSyncJob(req *daemon.JobRequest, control *taskframework.TaskControl) error {
+	activeUser := GetActiveUser()
+	panClient := activeUser.PanClient()
+	if !filepath.IsAbs(req.LocalPath) {
+		return fmt.Errorf("本地目录请指定绝对路径: %s", req.LocalPath)
+	}
+
+	task := &syncdrive.SyncTask{
+		LocalFolderPath: path.Clean(strings.ReplaceAll(req.LocalPath, "\\", "/")),
+		Mode:            syncdrive.Upload,
+		Policy:          syncdrive.SyncPolicyIncrement,
+		ConflictPolicy:  syncdrive.SyncConflictNewest,
+		Priority:        syncdrive.SyncPriorityTimestampFirst,
+		UserId:          activeUser.UserId,
+		DriveId:         req.DriveId,
+		DriveName:       "backup",
+	}
+	switch req.Mode {
+	case string(syncdrive.Download):
+		task.Mode = syncdrive.Download
+	case "sync":
+		task.Mode = syncdrive.SyncTwoWay
+	}
+	if task.DriveId == "" {
+		task.DriveId = activeUser.DriveList.GetFileDriveId()
+	} else if task.DriveId == activeUser.DriveList.GetResourceDriveId() {
+		task.DriveName = "resource"
+	}
+	task.PanFolderPath = activeUser.PathJoin(task.DriveId, req.PanPath)
+	task.Name = path.Base(task.LocalFolderPath)
+	task.Id = utils.Md5Str(task.LocalFolderPath)
+
+	dp := config.Config.MaxDownloadParallel
+	if dp == 0 {
+		dp = 2
+	}
+	up := config.Config.MaxUploadParallel
+	if up == 0 {
+		up = 2
+	}
+	if req.Parallel > 0 {
+		dp, up = req.Parallel, req.Parallel
+	}
+	downloadBlockSize := int64(config.Config.CacheSize)
+	if downloadBlockSize == 0 {
+		downloadBlockSize = int64(256 * 1024)
+	}
+
+	syncFolderRootPath := config.GetSyncDriveDir()
+	os.MkdirAll(syncFolderRootPath, 0755)
+	fileRecorder := log.NewFileRecorder(config.GetLogDir() + "/sync_file_records.csv")
+	fileRecorder.SetTargets("sync", config.Config.OpenLogTargets())
+	fileRecorder.SetHistory(log.NewTransferHistory(config.GetTransferHistoryFilePath()))
+	defer fileRecorder.Close()
+
+	functions.CalibrateServerTime()
+	syncMgr := syncdrive.NewSyncTaskManager(activeUser, panClient, syncFolderRootPath, syncdrive.SyncOption{
+		FileDownloadParallel:  dp,
+		FileUploadParallel:    up,
+		FileDownloadBlockSize: downloadBlockSize,
+		FileUploadBlockSize:   aliyunpan.DefaultChunkSize,
+		MaxDownloadRate:       config.Config.MaxDownloadRate,
+		MaxUploadRate:         config.Config.MaxUploadRate,
+		UploadRateFunc:        uploadRateFunc(),
+		SyncPriority:          syncdrive.SyncPriorityTimestampFirst,
+		FileRecorder:          fileRecorder,
+		NotifyDigest:          newNotifyDigest(),
+		Webhook:               newNotifyWebhook(),
+		ModTimeTolerance:      int64(config.Config.ModTimeTolerance),
+	})
+	if _, err := syncMgr.Start([]*syncdrive.SyncTask{task}, syncdrive.CycleOneTime, 60); err != nil {
+		return fmt.Errorf("启动同步任务失败: %s", err)
+	}
+	for !syncMgr.IsAllTaskCompletely() && !control.IsStopped() {
+		time.Sleep(time.Second)
+	}
+	if !control.IsStopped() {
+		syncMgr.DoTaskSyncCompletelyPluginCallback()
+	}
+	syncMgr.Stop()
+	return nil
+}
@@ -0,0 +1,448 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan/cmder"
+	"github.com/tickstep/aliyunpan/cmder/cmdliner"
+	"github.com/tickstep/aliyunpan/cmder/cmdtable"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/functions/panwalk"
+	"github.com/tickstep/library-go/converter"
+	"github.com/urfave/cli"
+)
+
+const (
+	// DedupKeepNewest 保留最新修改的文件
+	DedupKeepNewest = "newest"
+	// DedupKeepOldest 保留最早修改的文件
+	DedupKeepOldest = "oldest"
+	// DedupKeepShortest 保留路径最短的文件
+	DedupKeepShortest = "shortest"
+)
+
+type (
+	// dedupGroup 内容Hash和大小都相同的一组重复文件
+	dedupGroup struct {
+		ContentHash string                  `json:"contentHash"`
+		Size        int64                   `json:"size"`
+		Files       []*aliyunpan.FileEntity `json:"files"`
+		Keep        string                  `json:"keep,omitempty"` // 清理时保留的文件路径
+
+		keep int // 清理时保留的文件序号
+	}
+
+	// dedupScanResult 重复文件扫描结果
+	dedupScanResult struct {
+		Path       string        `json:"path"`
+		TotalFiles int           `json:"totalFiles"`
+		Groups     []*dedupGroup `json:"groups"`
+		Wasted     int64         `json:"wasted"`            // 重复文件占用的空间，每组只计算保留一个文件以外的文件
+		Removed    int           `json:"removed,omitempty"` // 已移入回收站的文件数量
+		Failed     []string      `json:"failed,omitempty"`  // 移入回收站失败的文件
+	}
+)
+
+// Wasted 重复文件占用的空间
+func (g *dedupGroup) Wasted() int64 {
+	return int64(len(g.Files)-1) * g.Size
+}
+
+// groupDuplicates 按内容Hash和文件大小分组，只返回有重复的组，按重复占用的空间从大到小排列。
+// 空文件、小于minSize以及没有内容Hash的文件不参与比较，空文件的Hash都相同但并不占用空间
+func groupDuplicates(files []*aliyunpan.FileEntity, minSize int64) []*dedupGroup {
+	groupMap := map[string]*dedupGroup{}
+	for _, f := range files {
+		if f.IsFolder() || f.ContentHash == "" || f.FileSize == 0 || f.FileSize < minSize {
+			continue
+		}
+		hash := strings.ToUpper(f.ContentHash)
+		key := hash + "_" + strconv.FormatInt(f.FileSize, 10)
+		g, ok := groupMap[key]
+		if !ok {
+			g = &dedupGroup{ContentHash: hash, Size: f.FileSize}
+			groupMap[key] = g
+		}
+		g.Files = append(g.Files, f)
+	}
+	groups := []*dedupGroup{}
+	for _, g := range groupMap {
+		if len(g.Files) < 2 {
+			continue
+		}
+		sort.Slice(g.Files, func(i, j int) bool {
+			return g.Files[i].Path < g.Files[j].Path
+		})
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Wasted() != groups[j].Wasted() {
+			return groups[i].Wasted() > groups[j].Wasted()
+		}
+		return groups[i].Files[0].Path < groups[j].Files[0].Path
+	})
+	return groups
+}
+
+// selectDedupKeep 按规则选择一组重复文件中需要保留的文件，返回文件的序号
+func selectDedupKeep(g *dedupGroup, rule string) int {
+	keep := 0
+	for i, f := range g.Files[1:] {
+		k := g.Files[keep]
+		// 修改时间的格式都是 2006-01-02 15:04:05，可以直接比较
+		newer := f.UpdatedAt > k.UpdatedAt
+		sameTime := f.UpdatedAt == k.UpdatedAt
+		shorter := len(f.Path) < len(k.Path)
+		switch rule {
+		case DedupKeepOldest:
+			if f.UpdatedAt < k.UpdatedAt || (sameTime && shorter) {
+				keep = i + 1
+			}
+		case DedupKeepShortest:
+			if shorter || (len(f.Path) == len(k.Path) && newer) {
+				keep = i + 1
+			}
+		default:
+			if newer || (sameTime && shorter) {
+				keep = i + 1
+			}
+		}
+	}
+	return keep
+}
+
+func CmdDedup() cli.Command {
+	return cli.Command{
+		Name:  "dedup",
+		Usage: "查找和清理重复文件",
+		Description: `
+	按文件内容Hash和文件大小查找网盘目录中的重复文件，并按规则或者交互式选择保留的文件，其余的重复文件分批移入回收站。
+
+	示例:
+
+	1. 列出 /我的资源 目录下的重复文件
+	aliyunpan dedup scan /我的资源
+
+	2. 列出整个网盘中大于10MB的重复文件
+	aliyunpan dedup scan --min-size 10MB /
+
+	3. 清理 /我的资源 目录下的重复文件，每组保留路径最短的文件，先使用 --dry-run 预览
+	aliyunpan dedup clean --keep shortest --dry-run /我的资源
+
+	4. 交互式选择每组重复文件中需要保留的文件
+	aliyunpan dedup clean -i /我的资源
+`,
+		Category: "阿里云盘",
+		Before:   ReloadConfigFunc,
+		Action: func(c *cli.Context) error {
+			cli.ShowCommandHelp(c, c.Command.Name)
+			return nil
+		},
+		Subcommands: []cli.Command{
+			{
+				Name:      "scan",
+				Usage:     "列出重复文件",
+				UsageText: cmder.App().Name + " dedup scan [--min-size <大小>] <目录路径>",
+				Action: func(c *cli.Context) error {
+					minSize, ok := parseDedupArgs(c)
+					if !ok {
+						return nil
+					}
+					RunDedupScan(parseDriveId(c), c.Args().Get(0), minSize)
+					return nil
+				},
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "driveId",
+						Usage: "网盘ID",
+						Value: "",
+					},
+					cli.StringFlag{
+						Name:  "min-size",
+						Usage: "只查找不小于该大小的文件，例如：1MB",
+					},
+				},
+			},
+			{
+				Name:      "clean",
+				Usage:     "清理重复文件，移入回收站",
+				UsageText: cmder.App().Name + " dedup clean [--keep newest|oldest|shortest] [-i] [--dry-run] [-y] <目录路径>",
+				Description: `每组重复文件按 --keep 规则保留一个文件，其余的文件分批移入回收站。
+	使用 -i 时逐组显示重复文件，输入序号选择需要保留的文件。清理前需要确认, 指定 -y 跳过确认.`,
+				Action: func(c *cli.Context) error {
+					minSize, ok := parseDedupArgs(c)
+					if !ok {
+						return nil
+					}
+					keep := c.String("keep")
+					if keep != DedupKeepNewest && keep != DedupKeepOldest && keep != DedupKeepShortest {
+						fmt.Printf("不支持的保留规则: %s, 支持: newest, oldest, shortest\n", keep)
+						setJsonError(JsonCodeBadArgs, "不支持的保留规则: "+keep)
+						return nil
+					}
+					RunDedupClean(parseDriveId(c), c.Args().Get(0), minSize, keep, c.Bool("i"), c.Bool("dry-run"), c.Bool("y"))
+					return nil
+				},
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "driveId",
+						Usage: "网盘ID",
+						Value: "",
+					},
+					cli.StringFlag{
+						Name:  "min-size",
+						Usage: "只清理不小于该大小的文件，例如：1MB",
+					},
+					cli.StringFlag{
+						Name:  "keep",
+						Usage: "每组保留的文件：newest-最新修改的文件，oldest-最早修改的文件，shortest-路径最短的文件",
+						Value: DedupKeepNewest,
+					},
+					cli.BoolFlag{
+						Name:  "i",
+						Usage: "交互式选择每组需要保留的文件",
+					},
+					cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "只列出将要清理的文件，不实际删除",
+					},
+					cli.BoolFlag{
+						Name:  "y",
+						Usage: "跳过确认",
+					},
+				},
+			},
+		},
+	}
+}
+
+// parseDedupArgs 检查参数，返回最小文件大小
+func parseDedupArgs(c *cli.Context) (int64, bool) {
+	if c.NArg() != 1 {
+		cli.ShowCommandHelp(c, c.Command.Name)
+		return 0, false
+	}
+	if GetActiveUser() == nil {
+		printNotLogin()
+		return 0, false
+	}
+	if c.String("min-size") == "" {
+		return 0, true
+	}
+	minSize, err := converter.ParseFileSizeStr(c.String("min-size"))
+	if err != nil || minSize < 0 {
+		fmt.Printf("文件大小格式错误: %s, 示例: 1MB\n", c.String("min-size"))
+		setJsonError(JsonCodeBadArgs, "文件大小格式错误: "+c.String("min-size"))
+		return 0, false
+	}
+	return minSize, true
+}
+
+// scanDuplicates 遍历目录查找重复文件
+func scanDuplicates(activeUser *config.PanUser, driveId, pathStr string, minSize int64) (*dedupScanResult, error) {
+	targetPath := path.Clean(activeUser.PathJoin(driveId, pathStr))
+	targetInfo, apierr := activeUser.PanClient().OpenapiPanClient().FileInfoByPath(driveId, targetPath)
+	if apierr != nil || targetInfo == nil {
+		return nil, fmt.Errorf("目录不存在: %s", targetPath)
+	}
+	if !targetInfo.IsFolder() {
+		return nil, fmt.Errorf("指定的路径不是目录: %s", targetPath)
+	}
+	targetInfo.Path = targetPath
+
+	fmt.Printf("正在扫描重复文件: %s\n", targetPath)
+	files := []*aliyunpan.FileEntity{}
+	lastPrint := time.Time{}
+	err := panwalk.NewWalker(activeUser.PanClient(), driveId).Walk(targetInfo, func(file *aliyunpan.FileEntity) error {
+		if !file.IsFolder() {
+			files = append(files, file)
+		}
+		if time.Since(lastPrint) >= 500*time.Millisecond {
+			lastPrint = time.Now()
+			fmt.Printf("\r已扫描: 文件 %d 个", len(files))
+		}
+		return nil
+	})
+	fmt.Printf("\r已扫描: 文件 %d 个\n", len(files))
+	if err != nil {
+		return nil, fmt.Errorf("扫描目录失败: %s", err)
+	}
+	result := &dedupScanResult{
+		Path:       targetPath,
+		TotalFiles: len(files),
+		Groups:     groupDuplicates(files, minSize),
+	}
+	for _, g := range result.Groups {
+		result.Wasted += g.Wasted()
+	}
+	return result, nil
+}
+
+// printDedupGroup 输出一组重复文件，keep 为保留的文件序号，小于0代表不标记
+func printDedupGroup(index int, g *dedupGroup, keep int) {
+	fmt.Printf("\n[%d] 大小: %s, 文件数: %d, SHA1: %s\n", index, converter.ConvertFileSize(g.Size, 2), len(g.Files), g.ContentHash)
+	tb := cmdtable.NewTable(os.Stdout)
+	tb.SetHeader([]string{"#", "文件路径", "修改时间", "操作"})
+	for k, f := range g.Files {
+		action := ""
+		if keep >= 0 {
+			action = "移入回收站"
+			if k == keep {
+				action = "保留"
+			}
+		}
+		tb.Append([]string{strconv.Itoa(k + 1), f.Path, f.UpdatedAt, action})
+	}
+	tb.Render()
+}
+
+// RunDedupScan 列出重复文件
+func RunDedupScan(driveId, pathStr string, minSize int64) {
+	result, err := scanDuplicates(GetActiveUser(), driveId, pathStr, minSize)
+	if err != nil {
+		fmt.Println(err)
+		setJsonErr(err)
+		return
+	}
+	setJsonData(result)
+	if len(result.Groups) == 0 {
+		fmt.Println("没有找到重复文件")
+		return
+	}
+	for k, g := range result.Groups {
+		printDedupGroup(k+1, g, -1)
+	}
+	fmt.Printf("\n共 %d 组重复文件, 重复文件占用空间: %s\n", len(result.Groups), converter.ConvertFileSize(result.Wasted, 2))
+}
+
+// RunDedupClean 清理重复文件，每组保留一个文件，其余的分批移入回收站
+func RunDedupClean(driveId, pathStr string, minSize int64, keepRule string, interactive, dryRun, skipConfirm bool) {
+	activeUser := GetActiveUser()
+	result, err := scanDuplicates(activeUser, driveId, pathStr, minSize)
+	if err != nil {
+		fmt.Println(err)
+		setJsonErr(err)
+		return
+	}
+	if len(result.Groups) == 0 {
+		setJsonData(result)
+		fmt.Println("没有找到重复文件")
+		return
+	}
+
+	if interactive && jsonDeclineInput() {
+		return
+	}
+	removeFiles := []*aliyunpan.FileEntity{}
+	var removeSize int64
+	groups := []*dedupGroup{}
+	for k, g := range result.Groups {
+		keep := selectDedupKeep(g, keepRule)
+		if interactive {
+			printDedupGroup(k+1, g, keep)
+			var ok, quit bool
+			if keep, ok, quit = promptDedupKeep(keep, len(g.Files)); quit {
+				break
+			} else if !ok {
+				continue
+			}
+		}
+		g.keep = keep
+		g.Keep = g.Files[keep].Path
+		groups = append(groups, g)
+		for i, f := range g.Files {
+			if i != g.keep {
+				removeFiles = append(removeFiles, f)
+				removeSize += g.Size
+			}
+		}
+	}
+	result.Groups = groups
+	result.Wasted = removeSize
+	setJsonData(result)
+	if len(removeFiles) == 0 {
+		fmt.Println("没有需要清理的重复文件")
+		return
+	}
+
+	if !interactive {
+		for k, g := range groups {
+			printDedupGroup(k+1, g, g.keep)
+		}
+	}
+	fmt.Printf("\n共 %d 组重复文件, 将有 %d 个文件移入回收站, 释放空间: %s\n", len(groups), len(removeFiles), converter.ConvertFileSize(removeSize, 2))
+	if dryRun {
+		fmt.Println("dry-run模式，未实际删除")
+		return
+	}
+	if !skipConfirm && !confirmTrashAction("确认把以上重复文件移入回收站? (y/n): ") {
+		return
+	}
+
+	ctx := newRemoveBatchContext(driveId, DefaultRemoveBatchSize, DefaultRemoveBatchRetry, activeUser.PanClient())
+	for start := 0; start < len(removeFiles); start += ctx.batchSize {
+		end := start + ctx.batchSize
+		if end > len(removeFiles) {
+			end = len(removeFiles)
+		}
+		for _, f := range ctx.removeBatchWithRetry(removeFiles[start:end]) {
+			result.Failed = append(result.Failed, f.Path)
+		}
+		fmt.Printf("\r删除进度: %d/%d, 失败 %d", end, len(removeFiles), len(result.Failed))
+	}
+	fmt.Println()
+	result.Removed = len(removeFiles) - len(result.Failed)
+	activeUser.DeleteCache(GetAllPathFolderByPath(result.Path))
+	fmt.Printf("已把 %d 个重复文件移入回收站, 可在云盘文件回收站找回\n", result.Removed)
+	if len(result.Failed) > 0 {
+		fmt.Println("以下文件移入回收站失败：")
+		for _, p := range result.Failed {
+			fmt.Println(p)
+		}
+		setJsonError(JsonCodeFailed, fmt.Sprintf("有 %d 个文件移入回收站失败", len(result.Failed)))
+	}
+}
+
+// promptDedupKeep 交互式选择需要保留的文件，返回保留的文件序号、是否清理该组以及是否结束选择
+func promptDedupKeep(keep, count int) (int, bool, bool) {
+	line := cmdliner.NewLiner()
+	defer line.Close()
+	for {
+		input, err := line.State.Prompt(fmt.Sprintf("请输入需要保留的文件序号，直接回车保留第 %d 个，输入 s 跳过该组，输入 q 结束选择: ", keep+1))
+		if err != nil {
+			return keep, false, true
+		}
+		switch input = strings.TrimSpace(input); input {
+		case "":
+			return keep, true, false
+		case "s", "S":
+			return keep, false, false
+		case "q", "Q":
+			return keep, false, true
+		}
+		if n, e := strconv.Atoi(input); e == nil && n >= 1 && n <= count {
+			return n - 1, true, false
+		}
+		fmt.Printf("序号错误，请输入 1 ~ %d\n", count)
+	}
+}
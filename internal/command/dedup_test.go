@@ -0,0 +1,45 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+)
+
+func TestDedupGroups(t *testing.T) {
+	files := []*aliyunpan.FileEntity{
+		{FileId: "1", FileType: "file", Path: "/a/photo.jpg", FileSize: 100, ContentHash: "abc", UpdatedAt: "2026-01-01 10:00:00"},
+		{FileId: "2", FileType: "file", Path: "/backup/2026/photo.jpg", FileSize: 100, ContentHash: "ABC", UpdatedAt: "2026-02-01 10:00:00"},
+		{FileId: "3", FileType: "file", Path: "/b/photo.jpg", FileSize: 100, ContentHash: "abc", UpdatedAt: "2026-01-01 10:00:00"},
+		{FileId: "4", FileType: "file", Path: "/a/video.mp4", FileSize: 1000, ContentHash: "def", UpdatedAt: "2026-01-01 10:00:00"},
+		{FileId: "5", FileType: "file", Path: "/b/video.mp4", FileSize: 1000, ContentHash: "def", UpdatedAt: "2026-01-01 10:00:00"},
+		{FileId: "6", FileType: "file", Path: "/a/other.jpg", FileSize: 200, ContentHash: "abc", UpdatedAt: "2026-01-01 10:00:00"},
+		{FileId: "7", FileType: "file", Path: "/a/empty.txt", FileSize: 0, ContentHash: "", UpdatedAt: "2026-01-01 10:00:00"},
+		{FileId: "8", FileType: "file", Path: "/b/empty.txt", FileSize: 0, ContentHash: "", UpdatedAt: "2026-01-01 10:00:00"},
+		// 云盘返回的空文件带有空内容的SHA1，不能当成重复文件
+		{FileId: "9", FileType: "file", Path: "/a/.keep", FileSize: 0, ContentHash: "DA39A3EE5E6B4B0D3255BFEF95601890AFD80709", UpdatedAt: "2026-01-01 10:00:00"},
+		{FileId: "10", FileType: "file", Path: "/b/.keep", FileSize: 0, ContentHash: "DA39A3EE5E6B4B0D3255BFEF95601890AFD80709", UpdatedAt: "2026-01-01 10:00:00"},
+	}
+	groups := groupDuplicates(files, 0)
+	if len(groups) != 2 {
+		t.Fatalf("groups = %d, want 2", len(groups))
+	}
+	// 重复占用空间大的组排在前面
+	if groups[0].ContentHash != "DEF" || groups[0].Wasted() != 1000 || len(groups[1].Files) != 3 {
+		t.Fatalf("unexpected groups: %+v, %+v", groups[0], groups[1])
+	}
+	if groups := groupDuplicates(files, 500); len(groups) != 1 {
+		t.Fatalf("groups with min size = %d, want 1", len(groups))
+	}
+
+	photos := groups[1]
+	for rule, want := range map[string]string{
+		DedupKeepNewest:   "/backup/2026/photo.jpg",
+		DedupKeepOldest:   "/a/photo.jpg",
+		DedupKeepShortest: "/a/photo.jpg",
+	} {
+		if p := photos.Files[selectDedupKeep(photos, rule)].Path; p != want {
+			t.Errorf("%s: keep %s, want %s", rule, p, want)
+		}
+	}
+}
@@ -15,13 +15,21 @@ package command
 
 import (
 	"fmt"
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
 	"github.com/tickstep/aliyunpan/cmder"
 	"github.com/tickstep/aliyunpan/cmder/cmdtable"
 	"github.com/tickstep/aliyunpan/internal/config"
 	"github.com/tickstep/aliyunpan/internal/file/downloader"
+	"github.com/tickstep/aliyunpan/internal/file/faultinject"
+	"github.com/tickstep/aliyunpan/internal/file/ratelimit"
+	"github.com/tickstep/aliyunpan/internal/functions"
 	"github.com/tickstep/aliyunpan/internal/functions/pandownload"
+	"github.com/tickstep/aliyunpan/internal/functions/panwalk"
 	"github.com/tickstep/aliyunpan/internal/global"
 	"github.com/tickstep/aliyunpan/internal/log"
+	"github.com/tickstep/aliyunpan/internal/metrics"
+	"github.com/tickstep/aliyunpan/internal/notify"
+	"github.com/tickstep/aliyunpan/internal/plugins"
 	"github.com/tickstep/aliyunpan/internal/taskframework"
 	"github.com/tickstep/aliyunpan/internal/utils"
 	"github.com/tickstep/aliyunpan/library/requester/transfer"
@@ -34,6 +42,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"sort"
+	"strings"
 )
 
 type (
@@ -44,16 +53,28 @@ type (
 		IsPrintStatus        bool
 		IsExecutedPermission bool
 		IsOverwrite          bool
+		OnExist              string // 本地已存在同名文件的处理策略
 		SaveTo               string
-		Parallel             int // 文件下载最大线程数
-		SliceParallel        int // 单个文件分片下载最大线程数
+		Parallel             int   // 同时下载的文件数量
+		SliceParallel        int   // 单个文件的分段连接数
+		SegmentSize          int64 // 单个文件的分段大小，每个分段单独记录断点，0代表使用默认值
 		Load                 int
 		MaxRetry             int
 		NoCheck              bool
+		Verify               bool // 下载完成后校验本地文件SHA1与网盘记录是否一致
 		ShowProgress         bool
 		DriveId              string
 		ExcludeNames         []string // 排除的文件名，包括文件夹和文件。即这些文件/文件夹不进行下载，支持正则表达式
 		IsMultiUserDownload  bool     // 是否启用多用户联合下载
+		IgnoreCase           bool     // 路径忽略大小写匹配
+		MaxRate              int64    // 本次下载所有文件共享的总限速，单位 B/s，0代表不限制
+		RateClass            string   // 限速类别，同一类别的上传、下载共用配置的类别限速，为空使用download
+		Order                string   // 文件下载顺序：size-asc、size-desc、name、mtime，为空按照文件名顺序
+		Priority             []string // 优先下载匹配的文件，排在前面的规则优先级更高
+		// Control 外部控制，daemon通过它暂停、取消下载并查询进度，可以为nil
+		Control *taskframework.TaskControl
+		// Reporter 下载状态上报，为nil使用命令行输出
+		Reporter pandownload.DownloadReporter
 	}
 
 	// LocateDownloadOption 获取下载链接可选参数
@@ -66,6 +87,9 @@ var (
 	// MaxDownloadRangeSize 文件片段最大值
 	MaxDownloadRangeSize = 55 * converter.MB
 
+	// MinDownloadRangeSize 文件片段最小值
+	MinDownloadRangeSize = 1 * converter.MB
+
 	// DownloadCacheSize 默认每个线程下载缓存大小
 	DownloadCacheSize = 64 * converter.KB
 )
@@ -99,8 +123,17 @@ func CmdDownload() cli.Command {
 	下载 /我的资源 整个目录，但是排除所有的jpg文件
 	aliyunpan download -exn "\.jpg$" /我的资源
 
+	同时下载2个文件，每个文件使用1个连接下载 /我的资源 整个目录
+	aliyunpan download --parallel 2 --connections 1 /我的资源
+
+	下载 /我的资源/Video 整个目录，路径忽略大小写，例如输入的路径为 /我的资源/video
+	aliyunpan download --ignore-case /我的资源/video
+
 	下载 /我的资源/1.mp4 并保存下载的文件到本地的 d:/panfile
 	aliyunpan download --saveto d:/panfile /我的资源/1.mp4
+
+	下载 /我的资源 整个目录，本地已存在同名但内容不同的文件自动重命名保存，例如 1.mp4 保存为 1 (1).mp4
+	aliyunpan download --on-exist rename /我的资源
 	
 	使用多用户联合下载 /我的资源/1.mp4 文件。必须保证所有登录的用户在相同的网盘（备份盘/资源盘）下，相同的路径下，有相同的文件
 	aliyunpan download /我的资源/1.mp4 -md
@@ -133,21 +166,36 @@ func CmdDownload() cli.Command {
 				saveTo = filepath.Clean(c.String("saveto"))
 			}
 
+			// 同名文件处理策略，-ow 等同于 --on-exist overwrite
+			onExist := c.String("on-exist")
+			if c.Bool("ow") {
+				onExist = pandownload.OnExistOverwrite
+			}
+			if !pandownload.IsValidOnExistPolicy(onExist) {
+				fmt.Printf("on-exist 参数错误，只支持：overwrite, skip, rename, ask\n")
+				return nil
+			}
+
 			do := &DownloadOptions{
 				DownloadActionId:     utils.UuidStr(),
 				IsPrintStatus:        c.Bool("status"),
 				IsExecutedPermission: c.Bool("x"),
-				IsOverwrite:          c.Bool("ow"),
+				IsOverwrite:          onExist == pandownload.OnExistOverwrite,
+				OnExist:              onExist,
 				SaveTo:               saveTo,
 				Parallel:             c.Int("p"),
-				SliceParallel:        3,
+				SliceParallel:        c.Int("connections"),
 				Load:                 0,
 				MaxRetry:             c.Int("retry"),
 				NoCheck:              c.Bool("nocheck"),
+				Verify:               c.Bool("verify"),
 				ShowProgress:         !c.Bool("np"),
 				DriveId:              parseDriveId(c),
 				ExcludeNames:         c.StringSlice("exn"),
 				IsMultiUserDownload:  c.Bool("md"),
+				IgnoreCase:           c.Bool("ignore-case"),
+				Order:                c.String("order"),
+				Priority:             c.StringSlice("priority"),
 			}
 
 			// 获取下载文件锁，保证下载操作单实例
@@ -158,7 +206,33 @@ func CmdDownload() cli.Command {
 			//	return nil
 			//}
 
+			maxRate, ok := parseMaxRate(c.String("max-rate"))
+			if !ok {
+				return nil
+			}
+			do.MaxRate = maxRate
+			do.RateClass = c.String("rate-class")
+			if c.IsSet("segment-size") {
+				segmentSize, err := converter.ParseFileSizeStr(c.String("segment-size"))
+				if err != nil || segmentSize < MinDownloadRangeSize {
+					fmt.Printf("segment-size 参数错误，最小值为 %s\n", converter.ConvertFileSize(MinDownloadRangeSize, 2))
+					return nil
+				}
+				do.SegmentSize = segmentSize
+			}
+			if do.Reporter, ok = newDownloadReporter(c.String("reporter")); !ok {
+				return nil
+			}
+			stopFaultInject, ok := startFaultInject(c.String("fault-inject"))
+			if !ok {
+				return nil
+			}
+			// Ctrl+C 停止下载并保存断点
+			control, stopInterrupt := newInterruptControl("下载")
+			defer stopInterrupt()
+			do.Control = control
 			RunDownload(c.Args(), do)
+			stopFaultInject()
 
 			// 释放文件锁
 			//if locker != nil {
@@ -171,6 +245,11 @@ func CmdDownload() cli.Command {
 				Name:  "ow",
 				Usage: "overwrite, 覆盖已存在的文件",
 			},
+			cli.StringFlag{
+				Name:  "on-exist",
+				Usage: "本地已存在同名且内容不同的文件时的处理策略：overwrite-覆盖，skip-跳过，rename-自动重命名追加(1)后缀，ask-询问",
+				Value: pandownload.OnExistSkip,
+			},
 			cli.BoolFlag{
 				Name:  "status",
 				Usage: "输出所有线程的工作状态",
@@ -188,15 +267,19 @@ func CmdDownload() cli.Command {
 				Usage: "为文件加上执行权限, (windows系统无效)",
 			},
 			cli.IntFlag{
-				Name:  "p",
-				Usage: "parallel,指定同时进行下载文件的数量（取值范围:1 ~ 3）",
-				Value: 1,
+				Name:  "p, parallel",
+				Usage: fmt.Sprintf("parallel,指定同时下载的文件数量（取值范围:1 ~ %d），不指定则使用配置 max_download_parallel", config.MaxFileDownloadParallelNum),
+			},
+			cli.IntFlag{
+				Name:  "connections",
+				Usage: fmt.Sprintf("指定单个文件下载的分段连接数（取值范围:1 ~ %d）", downloader.MaxParallelWorkerCount),
+				Value: downloader.MaxParallelWorkerCount,
+			},
+			cli.StringFlag{
+				Name:  "segment-size",
+				Usage: "单个文件的分段大小，例如：20MB。文件按分段并发下载，每个分段单独记录断点，中断后只重新下载未完成的分段",
+				Value: "55MB",
 			},
-			//cli.IntFlag{
-			//	Name:  "sp",
-			//	Usage: "slice parallel,指定单个文件下载的最大线程(分片)数（取值范围:1 ~ 3）",
-			//	Value: 1,
-			//},
 			cli.IntFlag{
 				Name:  "retry",
 				Usage: "下载失败最大重试次数",
@@ -206,6 +289,10 @@ func CmdDownload() cli.Command {
 				Name:  "nocheck",
 				Usage: "下载文件完成后不校验文件",
 			},
+			cli.BoolFlag{
+				Name:  "verify",
+				Usage: "下载写盘的同时流式计算SHA1，下载完成后与网盘记录比较，不一致时删除文件并重新下载，校验结果记录在下载记录文件中",
+			},
 			cli.BoolFlag{
 				Name:  "np",
 				Usage: "no progress 不展示下载进度条",
@@ -220,6 +307,38 @@ func CmdDownload() cli.Command {
 				Usage: "exclude name，指定排除的文件夹或者文件的名称，被排除的文件不会进行下载，只支持正则表达式。支持同时排除多个名称，每一个名称就是一个exn参数",
 				Value: nil,
 			},
+			cli.BoolFlag{
+				Name:  "ignore-case",
+				Usage: "路径忽略大小写匹配，不支持通配符路径",
+			},
+			cli.StringFlag{
+				Name:  "order",
+				Usage: "文件下载顺序。可选值: size-asc(小文件优先)、size-desc(大文件优先)、name(按路径名)、mtime(先修改的文件优先)，默认按照文件名顺序",
+			},
+			cli.StringSliceFlag{
+				Name:  "priority",
+				Usage: "优先下载匹配的文件，支持glob通配符(例如: *.mp4、电影/)和re:开头的正则表达式，匹配网盘路径。支持同时指定多个规则，排在前面的规则优先级更高",
+			},
+			cli.StringFlag{
+				Name:  "max-rate",
+				Usage: "本次下载的总限速，例如：2MB、500KB，平均分配给同时下载的文件。和配置的单文件限速 max_download_rate 同时生效",
+			},
+			cli.StringFlag{
+				Name:  "rate-class",
+				Usage: "限速类别，同一类别的上传、下载共用配置 rate_limit_classes 中该类别的限速，并且受总限速 rate_limit_total 约束。例如下载转存的分享文件时指定 share，和备份上传互不抢带宽",
+				Value: "download",
+			},
+			cli.StringFlag{
+				Name:  "reporter",
+				Usage: "下载状态输出格式。可选值: cli(命令行输出)、json(每个事件输出一行JSON到标准错误，用于GUI等前端集成)",
+				Value: "cli",
+			},
+			cli.StringFlag{
+				Name:   "fault-inject",
+				Usage:  "错误注入测试模式，随机让分片传输失败、返回429、中断连接，用于验证断点续传，例如: fail=0.1,429=0.05,interrupt=0.05,seed=1",
+				EnvVar: faultinject.EnvFaultInject,
+				Hidden: true,
+			},
 			cli.BoolFlag{
 				Name:  "md",
 				Usage: "(BETA) Multi-User Download，使用多用户联合下载，可以对单一文件叠加所有登录用户的下载速度",
@@ -228,6 +347,20 @@ func CmdDownload() cli.Command {
 	}
 }
 
+// newDownloadReporter 根据 --reporter 创建任务单元状态上报，cli 返回nil使用默认的命令行输出
+func newDownloadReporter(name string) (pandownload.DownloadReporter, bool) {
+	switch name {
+	case "", "cli":
+		return nil, true
+	case "json":
+		// 事件流输出到标准错误，和标准输出的汇总信息分开
+		return pandownload.NewJsonDownloadReporter(os.Stderr), true
+	}
+	fmt.Printf("下载状态输出格式错误: %s, 可选值: cli、json\n", name)
+	setJsonError(JsonCodeBadArgs, "下载状态输出格式错误: "+name)
+	return nil, false
+}
+
 func downloadPrintFormat(load int) string {
 	if load <= 1 {
 		return pandownload.DefaultPrintFormat
@@ -235,6 +368,31 @@ func downloadPrintFormat(load int) string {
 	return "\r[%s] ↓ %s/%s %s/s in %s, left %s ..."
 }
 
+// adjustDownloadParallel 调整同时下载的文件数量和单个文件的分段连接数，未指定同时下载的文件数量时使用配置 configParallel
+func adjustDownloadParallel(options *DownloadOptions, configParallel int) {
+	// 设置下载最大并发量
+	if options.Parallel < 1 {
+		options.Parallel = configParallel
+		if options.Parallel == 0 {
+			options.Parallel = config.DefaultFileDownloadParallelNum
+		}
+	}
+	if options.Parallel > config.MaxFileDownloadParallelNum {
+		fmt.Printf("同时下载文件数最大为 %d, 已自动调整\n", config.MaxFileDownloadParallelNum)
+		options.Parallel = config.MaxFileDownloadParallelNum
+	}
+
+	// 设置单个文件的分段连接数
+	if options.SliceParallel < 1 {
+		options.SliceParallel = 1
+	}
+	if options.SliceParallel > downloader.MaxParallelWorkerCount {
+		// 阿里云盘规定单文件并发下载连接数不要超过该值，否则会有风控检测处罚的风险
+		fmt.Printf("单文件分段连接数最大为 %d, 已自动调整\n", downloader.MaxParallelWorkerCount)
+		options.SliceParallel = downloader.MaxParallelWorkerCount
+	}
+}
+
 // RunDownload 执行下载网盘内文件
 func RunDownload(paths []string, options *DownloadOptions) {
 	activeUser := GetActiveUser()
@@ -260,6 +418,14 @@ func RunDownload(paths []string, options *DownloadOptions) {
 	if options == nil {
 		options = &DownloadOptions{}
 	}
+	if IsJsonOutput() {
+		// JSON输出不显示进度
+		options.ShowProgress = false
+	}
+	if options.Reporter == nil {
+		// 所有任务单元共用，进度行之后的输出先换行
+		options.Reporter = pandownload.NewCliDownloadReporter(os.Stdout, options.ShowProgress)
+	}
 
 	if options.MaxRetry < 0 {
 		options.MaxRetry = pandownload.DefaultDownloadMaxRetry
@@ -276,6 +442,7 @@ func RunDownload(paths []string, options *DownloadOptions) {
 		CacheSize:                  config.Config.CacheSize,
 		BlockSize:                  MaxDownloadRangeSize,
 		MaxRate:                    config.Config.MaxDownloadRate,
+		SharedRateLimit:            ratelimit.NewChildRateLimit(options.MaxRate, config.Config.ClassRateLimit(rateClassOrDefault(options.RateClass, "download"))),
 		InstanceStateStorageFormat: downloader.InstanceStateStorageFormatJSON,
 		ShowProgress:               options.ShowProgress,
 		ExcludeNames:               options.ExcludeNames,
@@ -283,22 +450,11 @@ func RunDownload(paths []string, options *DownloadOptions) {
 	if cfg.CacheSize == 0 {
 		cfg.CacheSize = int(DownloadCacheSize)
 	}
-
-	// 设置下载最大并发量
-	if options.Parallel < 1 {
-		options.Parallel = config.Config.MaxDownloadParallel
-		if options.Parallel == 0 {
-			options.Parallel = config.DefaultFileDownloadParallelNum
-		}
-	}
-	if options.Parallel > config.MaxFileDownloadParallelNum {
-		options.Parallel = config.MaxFileDownloadParallelNum
+	if options.SegmentSize > 0 {
+		cfg.BlockSize = options.SegmentSize
 	}
 
-	// 设置单个文件下载分片线程数
-	if options.SliceParallel < 1 {
-		options.SliceParallel = 1
-	}
+	adjustDownloadParallel(options, config.Config.MaxDownloadParallel)
 
 	// 保存文件的本地根文件夹
 	originSaveRootPath := ""
@@ -314,6 +470,7 @@ func RunDownload(paths []string, options *DownloadOptions) {
 	} else {
 		if !fi.IsDir() {
 			fmt.Println("本地保存路径不是文件夹，请删除或者创建对应的文件夹：", originSaveRootPath)
+			setJsonError(JsonCodeBadArgs, "本地保存路径不是文件夹: "+originSaveRootPath)
 			return
 		}
 	}
@@ -321,6 +478,7 @@ func RunDownload(paths []string, options *DownloadOptions) {
 	paths, err := makePathAbsolute(options.DriveId, paths...)
 	if err != nil {
 		fmt.Println(err)
+		setJsonErr(err)
 		return
 	}
 
@@ -362,12 +520,14 @@ func RunDownload(paths []string, options *DownloadOptions) {
 		// 阿里OpenAPI规定：文件分片下载的并发数为3，即某用户使用 App 时，可以同时下载 1 个文件的 3 个分片，或者同时下载 3 个文件的各 1 个分片。
 		options.SliceParallel = userCount * 3
 	}
-	fmt.Printf("\n[0] 当前文件下载最大并发量为: %d, 单文件下载分片线程数为: %d, 下载缓存为: %s\n", options.Parallel, options.SliceParallel, converter.ConvertFileSize(int64(cfg.CacheSize), 2))
+	fmt.Printf("\n[0] 同时下载文件数为: %d, 单文件分段连接数为: %d, 下载缓存为: %s\n", options.Parallel, options.SliceParallel, converter.ConvertFileSize(int64(cfg.CacheSize), 2))
 
 	var (
 		panClient = activeUser.PanClient()
 	)
 	cfg.MaxParallel = options.Parallel
+	// 校准服务器时间，避免本地时钟偏差导致下载链接签名校验失败
+	functions.CalibrateServerTime()
 	cfg.SliceParallel = options.SliceParallel
 
 	var (
@@ -378,25 +538,86 @@ func RunDownload(paths []string, options *DownloadOptions) {
 	)
 	// 配置执行器任务并发数，即同时下载文件并发数
 	executor.SetParallel(cfg.MaxParallel)
+	// 下载顺序和优先级
+	taskOrder, err := taskframework.ParseTaskOrder(options.Order)
+	if err != nil {
+		fmt.Printf("%s\n", err)
+		setJsonError(JsonCodeBadArgs, err.Error())
+		return
+	}
+	pathPriority, err := utils.NewPathPriority(options.Priority)
+	if err != nil {
+		fmt.Printf("下载优先级规则错误: %s\n", err)
+		setJsonError(JsonCodeBadArgs, "下载优先级规则错误: "+err.Error())
+		return
+	}
+	if taskOrder != taskframework.TaskOrderDefault || pathPriority != nil {
+		executor.SetOrder(taskOrder)
+	}
+	options.Control.Bind(&executor)
+	// 连续出现限流、登录失效等风控错误时暂停或者停止任务
+	riskGuard := functions.NewRiskGuard(&executor)
 
 	// 全局速度统计
 	globalSpeedsStat := &speeds.Speeds{}
 
+	// 所有目录任务共用的目录遍历器，限制获取文件列表的请求频率
+	folderWalker := panwalk.NewWalker(panClient, options.DriveId)
+
+	// 获取当前插件，所有下载任务以及下载结束的回调共用
+	plugin, _ := plugins.NewPluginManager(config.GetPluginDir()).GetReloadablePlugin()
+
 	// 下载记录器
 	fileRecorder := log.NewFileRecorder(config.GetLogDir() + "/download_file_records.csv")
+	fileRecorder.SetTargets("download", config.Config.OpenLogTargets())
+	fileRecorder.SetHistory(log.NewTransferHistory(config.GetTransferHistoryFilePath()))
+	defer fileRecorder.Close()
+
+	// 配置了加密密码时自动解密加密上传的文件
+	cipher, cipherErr := config.Config.EncryptCipher()
+	if cipherErr != nil {
+		fmt.Printf("创建解密器失败, 加密文件将不会被解密: %s\n", cipherErr)
+	}
 
 	// 处理队列
+	pathResolver := newPanPathResolver(activeUser.PanClient(), options.DriveId)
 	for k := range paths {
 		// 使用通配符匹配
 		fileList, err2 := matchPathByShellPattern(options.DriveId, paths[k])
-		if err2 != nil {
-			fmt.Printf("获取文件出错，请稍后重试: %s\n", paths[k])
-			continue
-		}
-		if fileList == nil || len(fileList) == 0 {
-			// 文件不存在
-			fmt.Printf("文件不存在: %s\n", paths[k])
-			continue
+		if err2 != nil || len(fileList) == 0 {
+			if strings.ContainsAny(paths[k], "*?[") {
+				if err2 != nil {
+					if functions.CheckAccountRisk(err2) {
+						setJsonErr(err2)
+						return
+					}
+					fmt.Printf("获取文件出错，请稍后重试: %s\n", paths[k])
+				} else {
+					fmt.Printf("文件不存在: %s\n", paths[k])
+				}
+				continue
+			}
+			// 逐级解析路径，忽略大小写匹配或者给出最接近的候选路径
+			file, closest, err3 := pathResolver.Resolve(activeUser.PathJoin(options.DriveId, paths[k]), options.IgnoreCase)
+			if err3 != nil {
+				if functions.CheckAccountRisk(err3) {
+					setJsonErr(err3)
+					return
+				}
+				fmt.Printf("获取文件出错，请稍后重试: %s\n", paths[k])
+				continue
+			}
+			if file == nil {
+				fmt.Printf("文件不存在: %s\n", paths[k])
+				if closest != "" {
+					fmt.Printf("最接近的候选路径: %s\n", closest)
+				}
+				continue
+			}
+			if file.Path != activeUser.PathJoin(options.DriveId, paths[k]) {
+				fmt.Printf("忽略大小写匹配到路径: %s\n", file.Path)
+			}
+			fileList = []*aliyunpan.FileEntity{file}
 		}
 		// 排序，按名称排序，从小到大
 		sort.Slice(fileList, func(i, j int) bool {
@@ -417,6 +638,7 @@ func RunDownload(paths []string, options *DownloadOptions) {
 				DownloadActionId:     options.DownloadActionId,
 				Cfg:                  &newCfg, // 复制一份新的cfg
 				PanClient:            panClient,
+				User:                 activeUser,
 				SubPanClientList:     subPanClientList,
 				VerbosePrinter:       panCommandVerbose,
 				PrintFormat:          downloadPrintFormat(options.Load),
@@ -425,12 +647,20 @@ func RunDownload(paths []string, options *DownloadOptions) {
 				IsPrintStatus:        options.IsPrintStatus,
 				IsExecutedPermission: options.IsExecutedPermission,
 				IsOverwrite:          options.IsOverwrite,
+				OnExist:              options.OnExist,
 				NoCheck:              options.NoCheck,
+				Verify:               options.Verify,
+				Cipher:               cipher,
 				FilePanSource:        global.FileSource,
 				FilePanPath:          f.Path,
 				DriveId:              options.DriveId,
 				GlobalSpeedsStat:     globalSpeedsStat,
 				FileRecorder:         fileRecorder,
+				Plugin:               plugin,
+				Control:              options.Control,
+				PathPriority:         pathPriority,
+				FolderWalker:         folderWalker,
+				Reporter:             options.Reporter,
 			}
 
 			// 设置储存的路径
@@ -442,7 +672,7 @@ func RunDownload(paths []string, options *DownloadOptions) {
 				unit.OriginSaveRootPath = GetActiveUser().GetSavePath("")
 				unit.SavePath = GetActiveUser().GetSavePath(f.Path)
 			}
-			info := executor.Append(&unit, options.MaxRetry)
+			info := executor.AppendWithOrder(&unit, options.MaxRetry, pandownload.DownloadOrderKey(f, pathPriority))
 			fmt.Printf("[%s] 加入下载队列: %s\n", info.Id(), f.Path)
 		}
 	}
@@ -450,10 +680,67 @@ func RunDownload(paths []string, options *DownloadOptions) {
 	// 开始计时
 	statistic.StartTimer()
 
+	// 推送下载指标
+	totalCount := executor.Count()
+	collectMetrics := func() []*metrics.Point {
+		failedCount := 0
+		if fd := executor.FailedDeque(); fd != nil {
+			failedCount = fd.Size()
+		}
+		return []*metrics.Point{{
+			Measurement: "download",
+			Tags:        map[string]string{"user": activeUser.Nickname, "target": originSaveRootPath},
+			Fields: map[string]float64{
+				"speed":        float64(globalSpeedsStat.GetSpeeds()),
+				"total_size":   float64(statistic.TotalSize()),
+				"total_files":  float64(totalCount),
+				"failed_files": float64(failedCount),
+				"queue":        float64(executor.Count()),
+				"elapsed":      statistic.Elapsed().Seconds(),
+			},
+		}}
+	}
+	metricsPusher, metricsErr := metrics.NewPusher(config.Config.MetricsUrl, config.Config.MetricsInterval, collectMetrics)
+	if metricsErr != nil {
+		fmt.Printf("指标推送地址配置错误: %s\n", metricsErr)
+	}
+	metricsPusher.Start()
+	metricsKey := fmt.Sprintf("download-%p", statistic)
+	metrics.Default.Register(metricsKey, collectMetrics)
+	options.Control.SetProgressFunc(func() *taskframework.TaskProgress {
+		failedCount := 0
+		if fd := executor.FailedDeque(); fd != nil {
+			failedCount = fd.Size()
+		}
+		return &taskframework.TaskProgress{
+			TotalFiles:  int64(totalCount),
+			FailedFiles: int64(failedCount),
+			TotalSize:   statistic.TotalSize(),
+			Speed:       globalSpeedsStat.GetSpeeds(),
+			Elapsed:     statistic.Elapsed().Seconds(),
+		}
+	})
+
 	// 开始执行
 	executor.Execute()
+	metricsPusher.Stop()
+	metrics.Default.Unregister(metricsKey)
+	if executor.IsStopped() {
+		fmt.Printf("\n下载已取消, %d 个文件/目录没有下载\n", executor.Count())
+		fmt.Printf("正在下载的文件已保存断点, 重新执行相同的下载命令即可继续下载\n")
+	}
+	if summary := riskGuard.Summary(); summary != "" {
+		fmt.Printf("%s\n", summary)
+	}
 
 	fmt.Printf("\n下载结束, 时间: %s, 数据总量: %s\n", utils.ConvertTime(statistic.Elapsed()), converter.ConvertFileSize(statistic.TotalSize(), 2))
+	result := newDownloadJsonData(originSaveRootPath, totalCount, statistic, executor.IsStopped())
+	setDownloadJsonResult(result)
+	notify.TaskFinished(config.Config.DesktopNotify, "下载", statistic.Elapsed(), executor.FailedDeque().Size(),
+		fmt.Sprintf("下载到 %s, 数据总量: %s", originSaveRootPath, converter.ConvertFileSize(statistic.TotalSize(), 2)))
+	taskBatchFinishPluginCallback(plugin, activeUser, "download", options.DriveId, result)
+	addNotifyDigestBatch("下载", result)
+	logTransferResult("下载", result)
 
 	// 输出失败的文件列表
 	failedList := executor.FailedDeque()
@@ -467,3 +754,37 @@ func RunDownload(paths []string, options *DownloadOptions) {
 		tb.Render()
 	}
 }
+
+// newDownloadJsonData 下载结果，包括每个文件的下载结果
+func newDownloadJsonData(saveTo string, totalCount int, statistic *pandownload.DownloadStatistic, canceled bool) *transferJsonData {
+	data := &transferJsonData{
+		Target:     saveTo,
+		TotalFiles: totalCount,
+		TotalSize:  statistic.TotalSize(),
+		Elapsed:    statistic.Elapsed().Seconds(),
+		Canceled:   canceled,
+		Files:      statistic.FileResults(),
+	}
+	for _, f := range data.Files {
+		if f.Status == functions.FileResultSucceed {
+			data.SucceedFiles++
+		} else {
+			data.FailedFiles++
+		}
+	}
+	return data
+}
+
+// setDownloadJsonResult 设置下载的JSON输出
+func setDownloadJsonResult(data *transferJsonData) {
+	if !IsJsonOutput() {
+		return
+	}
+	setJsonData(data)
+	switch {
+	case data.Canceled:
+		setJsonError(JsonCodeCanceled, "下载已取消")
+	case data.FailedFiles > 0:
+		setJsonError(JsonCodePartialFailed, fmt.Sprintf("%d 个文件下载失败", data.FailedFiles))
+	}
+}
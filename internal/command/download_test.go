@@ -0,0 +1,33 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/file/downloader"
+)
+
+func TestAdjustDownloadParallel(t *testing.T) {
+	cases := []struct {
+		name                      string
+		parallel, connections     int
+		configParallel            int
+		wantParallel, wantConnect int
+	}{
+		{"explicit", 2, 1, 8, 2, 1},
+		// 未指定同时下载的文件数量时使用配置，配置也为空时使用默认值
+		{"config", 0, 2, 8, 8, 2},
+		{"default", 0, 2, 0, config.DefaultFileDownloadParallelNum, 2},
+		{"max parallel", config.MaxFileDownloadParallelNum + 1, 1, 0, config.MaxFileDownloadParallelNum, 1},
+		// 单文件分段连接数不能超过网盘限制
+		{"max connections", 1, downloader.MaxParallelWorkerCount + 5, 0, 1, downloader.MaxParallelWorkerCount},
+		{"min connections", 1, 0, 0, 1, 1},
+	}
+	for _, c := range cases {
+		options := &DownloadOptions{Parallel: c.parallel, SliceParallel: c.connections}
+		adjustDownloadParallel(options, c.configParallel)
+		if options.Parallel != c.wantParallel || options.SliceParallel != c.wantConnect {
+			t.Errorf("%s: parallel %d, connections %d, want %d, %d", c.name, options.Parallel, options.SliceParallel, c.wantParallel, c.wantConnect)
+		}
+	}
+}
@@ -49,7 +49,7 @@ func CmdDrive() cli.Command {
 }
 
 func RunSwitchDriveList(targetDriveId string) {
-	currentDriveId := config.Config.ActiveUser().ActiveDriveId
+	currentDriveId := GetActiveUser().ActiveDriveId
 	var activeDriveInfo *config.DriveInfo = nil
 	driveList, renderStr := getDriveOptionList()
 
@@ -59,6 +59,9 @@ func RunSwitchDriveList(targetDriveId string) {
 	}
 
 	if targetDriveId == "" {
+		if jsonDeclineInput() {
+			return
+		}
 		// show option list
 		fmt.Println(renderStr)
 
@@ -91,24 +94,24 @@ func RunSwitchDriveList(targetDriveId string) {
 		return
 	}
 
-	config.Config.ActiveUser().ActiveDriveId = activeDriveInfo.DriveId
-	activeUser := config.Config.ActiveUser()
-	if currentDriveId != config.Config.ActiveUser().ActiveDriveId {
+	GetActiveUser().ActiveDriveId = activeDriveInfo.DriveId
+	activeUser := GetActiveUser()
+	if currentDriveId != GetActiveUser().ActiveDriveId {
 		// clear the drive work path
 		if activeUser.IsFileDriveActive() {
 			if activeUser.Workdir == "" {
-				config.Config.ActiveUser().Workdir = "/"
-				config.Config.ActiveUser().WorkdirFileEntity = *aliyunpan.NewFileEntityForRootDir()
+				GetActiveUser().Workdir = "/"
+				GetActiveUser().WorkdirFileEntity = *aliyunpan.NewFileEntityForRootDir()
 			}
 		} else if activeUser.IsResourceDriveActive() {
 			if activeUser.ResourceWorkdir == "" {
-				config.Config.ActiveUser().ResourceWorkdir = "/"
-				config.Config.ActiveUser().ResourceWorkdirFileEntity = *aliyunpan.NewFileEntityForRootDir()
+				GetActiveUser().ResourceWorkdir = "/"
+				GetActiveUser().ResourceWorkdirFileEntity = *aliyunpan.NewFileEntityForRootDir()
 			}
 		} else if activeUser.IsAlbumDriveActive() {
 			if activeUser.AlbumWorkdir == "" {
-				config.Config.ActiveUser().AlbumWorkdir = "/"
-				config.Config.ActiveUser().AlbumWorkdirFileEntity = *aliyunpan.NewFileEntityForRootDir()
+				GetActiveUser().AlbumWorkdir = "/"
+				GetActiveUser().AlbumWorkdirFileEntity = *aliyunpan.NewFileEntityForRootDir()
 			}
 		}
 	}
@@ -116,7 +119,7 @@ func RunSwitchDriveList(targetDriveId string) {
 }
 
 func getDriveOptionList() (config.DriveInfoList, string) {
-	activeUser := config.Config.ActiveUser()
+	activeUser := GetActiveUser()
 
 	driveList := activeUser.DriveList
 	builder := &strings.Builder{}
@@ -0,0 +1,56 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/tickstep/aliyunpan/internal/taskframework"
+)
+
+// newInterruptControl 处理命令行上传、下载时的 Ctrl+C、SIGTERM 信号。第一次收到信号时停止任务，
+// 正在传输的文件中止并保存断点，数据库、缓存写入完成后正常结束；再次收到信号时立即退出。
+// 返回的stop在任务结束后调用，恢复默认的信号处理。beforeExit 在立即退出前调用，用于删除临时文件等
+func newInterruptControl(name string, beforeExit ...func()) (control *taskframework.TaskControl, stop func()) {
+	control = taskframework.NewTaskControl()
+	sigChan := make(chan os.Signal, 2)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-sigChan:
+		case <-done:
+			return
+		}
+		fmt.Printf("\n收到中断信号, 正在停止%s并保存断点, 再次按 Ctrl+C 立即退出...\n", name)
+		control.Stop()
+		select {
+		case <-sigChan:
+			fmt.Printf("\n强制退出, 未保存的断点可能丢失\n")
+			for _, f := range beforeExit {
+				f()
+			}
+			flushJsonOutput(JsonCodeCanceled, "强制退出")
+			os.Exit(1)
+		case <-done:
+		}
+	}()
+	return control, func() {
+		signal.Stop(sigChan)
+		close(done)
+	}
+}
@@ -0,0 +1,40 @@
+package command
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/tickstep/aliyunpan/internal/taskframework"
+)
+
+func TestInterruptControlStop(t *testing.T) {
+	control, stop := newInterruptControl("上传")
+	defer stop()
+	executor := &taskframework.TaskExecutor{}
+	control.Bind(executor)
+
+	changed := control.Changed()
+	// 第一次收到信号时停止任务，不退出进程
+	syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("control should be stopped by signal")
+	}
+	if !control.IsStopped() || !executor.IsStopped() {
+		t.Fatal("bound executor should be stopped")
+	}
+}
+
+func TestInterruptControlNoSignal(t *testing.T) {
+	// 任务正常结束，恢复默认的信号处理
+	control, stop := newInterruptControl("下载", func() {
+		t.Error("beforeExit should not be called")
+	})
+	stop()
+	if control.IsStopped() || control.IsPaused() {
+		t.Fatal("control should not be stopped")
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
+	"github.com/tickstep/aliyunpan/internal/functions"
+	"github.com/tickstep/aliyunpan/internal/functions/panupload"
+	"github.com/tickstep/aliyunpan/internal/global"
+	"github.com/urfave/cli"
+)
+
+const (
+	// JsonCodeFailed 通用错误
+	JsonCodeFailed = 1000
+	// JsonCodeNotLogin 未登录账号
+	JsonCodeNotLogin = 1001
+	// JsonCodeBadArgs 参数错误
+	JsonCodeBadArgs = 1002
+	// JsonCodePartialFailed 部分文件传输失败
+	JsonCodePartialFailed = 1003
+	// JsonCodeCanceled 任务已取消
+	JsonCodeCanceled = 1004
+	// JsonCodeVerifyMismatch 校验发现不一致的文件
+	JsonCodeVerifyMismatch = 1005
+	// JsonCodeNeedInput 需要交互输入，--json 模式下不等待输入
+	JsonCodeNeedInput = 1006
+
+	// JsonStatusSuccess 命令执行成功
+	JsonStatusSuccess = "success"
+	// JsonStatusFailed 命令执行失败
+	JsonStatusFailed = "failed"
+	// JsonStatusUnknown 命令没有报告执行结果，也没有检测到错误
+	JsonStatusUnknown = "unknown"
+)
+
+type (
+	// JsonResult --json 模式下命令的输出结果
+	JsonResult struct {
+		Command string      `json:"command"`
+		Status  string      `json:"status"`  // 执行结果：success、failed、unknown
+		Success bool        `json:"success"` // status为success时为true
+		Error   *JsonError  `json:"error,omitempty"`
+		Data    interface{} `json:"data,omitempty"`
+
+		reported bool // 命令是否报告了执行结果
+	}
+
+	// transferJsonData 上传、下载的JSON输出
+	transferJsonData struct {
+		Target         string                     `json:"target"`                   // 上传到的网盘目录或者下载保存的本地目录
+		TotalFiles     int                        `json:"totalFiles"`               // 任务数量
+		SucceedFiles   int                        `json:"succeedFiles"`             // 成功的文件数量
+		FailedFiles    int                        `json:"failedFiles"`              // 失败的文件数量
+		TotalSize      int64                      `json:"totalSize"`                // 传输的数据量，单位：字节
+		Elapsed        float64                    `json:"elapsed"`                  // 耗时，单位：秒
+		Canceled       bool                       `json:"canceled,omitempty"`       // 是否已取消
+		Files          []*functions.FileResult    `json:"files"`                    // 每个文件的传输结果
+		OverLimitFiles []*panupload.OverLimitFile `json:"overLimitFiles,omitempty"` // 超出套餐限制的文件
+		Unfinished     []string                   `json:"unfinished,omitempty"`     // 到达时间预算没有完成的文件
+	}
+
+	// JsonError 错误信息。code小于1000为网盘接口错误码，1000及以上为程序定义的错误码
+	JsonError struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+)
+
+var (
+	jsonResult      *JsonResult
+	jsonStdout      io.Writer // 输出JSON结果的标准输出
+	jsonResultMutex sync.Mutex
+)
+
+// WrapJsonOutput 包装命令，--json 模式下命令的文本输出改到标准错误，结束后在标准输出统一输出JSON结果
+func WrapJsonOutput(commands []cli.Command) {
+	wrapJsonOutput("", commands)
+}
+
+func wrapJsonOutput(parent string, commands []cli.Command) {
+	for k := range commands {
+		cmd := &commands[k]
+		name := strings.TrimSpace(parent + " " + cmd.Name)
+		if cmd.Action != nil {
+			cmd.Action = jsonOutputAction(name, cmd.Action)
+		}
+		wrapJsonOutput(name, cmd.Subcommands)
+	}
+}
+
+// IsJsonOutput 是否以JSON格式输出，交互命令行模式下不生效
+func IsJsonOutput() bool {
+	return global.IsJsonOutput && !global.IsAppInCliMode
+}
+
+func jsonOutputAction(name string, action interface{}) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		if !IsJsonOutput() {
+			return cli.HandleAction(action, c)
+		}
+
+		// 结果只由命令通过 setJsonData、setJsonError 等报告，文本输出（包括进度、提示）改到标准错误，
+		// 不会混入JSON结果，也不会被吞掉
+		stdout := os.Stdout
+		result := &JsonResult{Command: name}
+		jsonResultMutex.Lock()
+		jsonResult = result
+		jsonStdout = stdout
+		jsonResultMutex.Unlock()
+
+		os.Stdout = os.Stderr
+		actionErr := cli.HandleAction(action, c)
+		os.Stdout = stdout
+
+		jsonResultMutex.Lock()
+		defer jsonResultMutex.Unlock()
+		if jsonResult != result {
+			// 已经由 flushJsonOutput 输出
+			return actionErr
+		}
+		jsonResult = nil
+		if result.Error == nil && actionErr != nil {
+			result.Error = &JsonError{Code: JsonCodeFailed, Message: actionErr.Error()}
+		}
+		writeJsonResult(stdout, result)
+		if result.Status == JsonStatusFailed {
+			return cli.NewExitError("", 1)
+		}
+		return nil
+	}
+}
+
+// writeJsonResult 确定执行结果并输出JSON
+func writeJsonResult(w io.Writer, result *JsonResult) {
+	switch {
+	case result.Error != nil:
+		result.Status = JsonStatusFailed
+	case result.reported:
+		result.Status = JsonStatusSuccess
+	default:
+		// 命令没有报告执行结果，不能确定是否成功
+		result.Status = JsonStatusUnknown
+	}
+	result.Success = result.Status == JsonStatusSuccess
+
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(result)
+}
+
+// flushJsonOutput 程序直接退出（os.Exit）前输出JSON结果，没有设置错误时使用 code、message 作为错误。非 --json 模式下忽略
+func flushJsonOutput(code int, message string) {
+	jsonResultMutex.Lock()
+	defer jsonResultMutex.Unlock()
+	if jsonResult == nil {
+		return
+	}
+	if jsonResult.Error == nil {
+		jsonResult.Error = &JsonError{Code: code, Message: message}
+	}
+	writeJsonResult(jsonStdout, jsonResult)
+	jsonResult = nil
+}
+
+// jsonDeclineInput --json 模式下不等待交互输入，直接拒绝并报告错误，返回true表示调用方需要放弃该操作。
+// 需要确认的命令可以使用 -y 等参数跳过确认
+func jsonDeclineInput() bool {
+	if !IsJsonOutput() {
+		return false
+	}
+	fmt.Println("--json 模式下不支持交互输入，已取消操作")
+	setJsonError(JsonCodeNeedInput, "--json 模式下不支持交互输入，请通过命令参数指定或者跳过确认")
+	return true
+}
+
+// setJsonData 设置JSON输出的数据，同时报告命令执行成功，非 --json 模式下忽略
+func setJsonData(data interface{}) {
+	jsonResultMutex.Lock()
+	defer jsonResultMutex.Unlock()
+	if jsonResult != nil {
+		jsonResult.Data = data
+		jsonResult.reported = true
+	}
+}
+
+// setJsonSuccess 报告命令执行成功，没有结果数据的命令使用。设置了错误的命令仍然输出失败
+func setJsonSuccess() {
+	jsonResultMutex.Lock()
+	defer jsonResultMutex.Unlock()
+	if jsonResult != nil {
+		jsonResult.reported = true
+	}
+}
+
+// setJsonError 设置JSON输出的错误，非 --json 模式下忽略。写操作命令同时记录到审计日志
+func setJsonError(code int, message string) {
+	setAuditError(message)
+	jsonResultMutex.Lock()
+	defer jsonResultMutex.Unlock()
+	if jsonResult != nil {
+		jsonResult.Error = &JsonError{Code: code, Message: message}
+	}
+}
+
+// setJsonErr 设置JSON输出的错误，网盘接口错误使用接口的错误码
+func setJsonErr(err error) {
+	if err == nil {
+		return
+	}
+	var apiErr *apierror.ApiError
+	if errors.As(err, &apiErr) && apiErr != nil && apiErr.Code != apierror.ApiCodeOk {
+		setJsonError(int(apiErr.Code), apiErr.Error())
+		return
+	}
+	setJsonError(JsonCodeFailed, err.Error())
+}
@@ -0,0 +1,125 @@
+package command
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/tickstep/aliyunpan/internal/global"
+	"github.com/urfave/cli"
+)
+
+// runJsonAction 以 --json 模式执行命令，返回解析后的JSON输出
+func runJsonAction(t *testing.T, action func(c *cli.Context) error) (*JsonResult, error) {
+	global.IsJsonOutput = true
+	defer func() {
+		global.IsJsonOutput = false
+	}()
+
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = w
+	ctx := cli.NewContext(cli.NewApp(), flag.NewFlagSet("test", flag.ContinueOnError), nil)
+	actionErr := jsonOutputAction("test", action)(ctx)
+	os.Stdout = stdout
+	w.Close()
+	data, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := &JsonResult{}
+	if err = json.Unmarshal(data, result); err != nil {
+		t.Fatalf("invalid json output %q: %s", data, err)
+	}
+	return result, actionErr
+}
+
+func TestJsonOutputStatus(t *testing.T) {
+	cases := []struct {
+		name    string
+		action  func(c *cli.Context) error
+		status  string
+		success bool
+		exitErr bool
+	}{
+		{"not reported", func(c *cli.Context) error {
+			return nil
+		}, JsonStatusUnknown, false, false},
+		{"success", func(c *cli.Context) error {
+			setJsonSuccess()
+			return nil
+		}, JsonStatusSuccess, true, false},
+		{"data", func(c *cli.Context) error {
+			setJsonData([]string{"a"})
+			return nil
+		}, JsonStatusSuccess, true, false},
+		{"error after success", func(c *cli.Context) error {
+			setJsonSuccess()
+			setJsonError(JsonCodePartialFailed, "部分失败")
+			return nil
+		}, JsonStatusFailed, false, true},
+		{"action error", func(c *cli.Context) error {
+			return cli.NewExitError("参数错误", 1)
+		}, JsonStatusFailed, false, true},
+		{"not login", func(c *cli.Context) error {
+			printNotLogin()
+			return nil
+		}, JsonStatusFailed, false, true},
+		{"text output", func(c *cli.Context) error {
+			// 文本输出不会混入JSON结果
+			os.Stdout.WriteString("上传中 10%\r上传中 100%\n")
+			setJsonData([]string{"a"})
+			return nil
+		}, JsonStatusSuccess, true, false},
+	}
+	for _, c := range cases {
+		result, err := runJsonAction(t, c.action)
+		if result.Status != c.status || result.Success != c.success {
+			t.Errorf("%s: status %s, success %v", c.name, result.Status, result.Success)
+		}
+		if (err != nil) != c.exitErr {
+			t.Errorf("%s: exit error %v", c.name, err)
+		}
+	}
+}
+
+func TestJsonOutputDeclineInput(t *testing.T) {
+	// 有输入也不读取
+	withStdin(t, "y\n", func() {
+		result, err := runJsonAction(t, func(c *cli.Context) error {
+			if confirmTrashAction("确认? (y/n): ") {
+				setJsonSuccess()
+			}
+			return nil
+		})
+		if err == nil || result.Status != JsonStatusFailed || result.Error == nil || result.Error.Code != JsonCodeNeedInput {
+			t.Fatalf("unexpected result: %+v", result)
+		}
+	})
+	if jsonDeclineInput() {
+		t.Fatal("should not decline without --json")
+	}
+}
+
+func TestFlushJsonOutput(t *testing.T) {
+	// 直接退出前输出JSON结果，之后命令包装不再重复输出
+	result, err := runJsonAction(t, func(c *cli.Context) error {
+		setJsonData([]string{"a"})
+		flushJsonOutput(JsonCodeCanceled, "强制退出")
+		setJsonSuccess()
+		return nil
+	})
+	if err != nil || result.Status != JsonStatusFailed || result.Error.Code != JsonCodeCanceled {
+		t.Fatalf("unexpected result: %+v, %v", result, err)
+	}
+
+	// 非 --json 模式下忽略
+	flushJsonOutput(JsonCodeCanceled, "强制退出")
+}
@@ -42,6 +42,10 @@ func CmdLogin() cli.Command {
 			openToken := &config.PanClientToken{}
 			webToken := &config.PanClientToken{}
 			var err error
+			// 需要在浏览器扫码后按Enter键继续
+			if jsonDeclineInput() {
+				return nil
+			}
 			ticketId, openToken, webToken, err = RunLogin()
 			if err != nil {
 				fmt.Println(err)
@@ -82,13 +86,16 @@ func CmdLogout() cli.Command {
 
 			var (
 				confirm    string
-				activeUser = config.Config.ActiveUser()
+				activeUser = GetActiveUser()
 			)
 			if activeUser == nil {
 				return nil
 			}
 
 			if !c.Bool("y") {
+				if jsonDeclineInput() {
+					return nil
+				}
 				fmt.Printf("确认退出当前帐号: %s ? (y/n) > ", activeUser.Nickname)
 				_, err := fmt.Scanln(&confirm)
 				if err != nil || (confirm != "y" && confirm != "Y") {
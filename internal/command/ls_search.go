@@ -20,17 +20,18 @@ import (
 	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
 	"github.com/tickstep/aliyunpan/cmder"
 	"github.com/tickstep/aliyunpan/cmder/cmdtable"
-	"github.com/tickstep/aliyunpan/internal/config"
 	"github.com/tickstep/library-go/converter"
 	"github.com/urfave/cli"
 	"os"
+	"path"
 	"strconv"
 )
 
 type (
 	// LsOptions 列目录可选项
 	LsOptions struct {
-		Total bool
+		Total      bool
+		IgnoreCase bool // 路径忽略大小写匹配
 	}
 
 	// SearchOptions 搜索可选项
@@ -38,6 +39,12 @@ type (
 		Total   bool
 		Recurse bool
 	}
+
+	// lsJsonData ls命令的JSON输出
+	lsJsonData struct {
+		Path  string             `json:"path"`
+		Files aliyunpan.FileList `json:"files"`
+	}
 )
 
 const (
@@ -67,12 +74,15 @@ func CmdLs() cli.Command {
 
 	详细列出 我的资源 内的文件和目录
 	aliyunpan ll /我的资源
+
+	列出 /我的资源/视频 内的文件和目录，路径忽略大小写，例如实际路径为 /我的资源/Video
+	aliyunpan ls --ignore-case /我的资源/video
 `,
 		Category: "阿里云盘",
 		Before:   ReloadConfigFunc,
 		Action: func(c *cli.Context) error {
-			if config.Config.ActiveUser() == nil {
-				fmt.Println("未登录账号")
+			if GetActiveUser() == nil {
+				printNotLogin()
 				return nil
 			}
 
@@ -102,7 +112,8 @@ func CmdLs() cli.Command {
 			}
 
 			RunLs(parseDriveId(c), c.Args().Get(0), &LsOptions{
-				Total: c.Bool("l") || c.Parent().Args().Get(0) == "ll",
+				Total:      c.Bool("l") || c.Parent().Args().Get(0) == "ll",
+				IgnoreCase: c.Bool("ignore-case"),
 			}, orderBy, orderSort)
 
 			return nil
@@ -133,24 +144,46 @@ func CmdLs() cli.Command {
 				Name:  "size",
 				Usage: "根据大小排序",
 			},
+			cli.BoolFlag{
+				Name:  "ignore-case",
+				Usage: "路径忽略大小写匹配",
+			},
 		},
 	}
 }
 
 func RunLs(driveId, targetPath string, lsOptions *LsOptions,
 	orderBy aliyunpan.FileOrderBy, orderDirection aliyunpan.FileOrderDirection) {
-	activeUser := config.Config.ActiveUser()
+	activeUser := GetActiveUser()
 	targetPath = activeUser.PathJoin(driveId, targetPath)
 
 	// 获取目标路径文件信息
 	targetPathInfo, err := activeUser.PanClient().OpenapiPanClient().FileInfoByPath(driveId, targetPath)
 	if err != nil {
-		if err.Code == apierror.ApiCodeFileNotFoundCode {
-			fmt.Println("指定目录不存在: " + targetPath)
-		} else {
+		if err.Code != apierror.ApiCodeFileNotFoundCode {
 			fmt.Println(err)
+			setJsonErr(err)
+			return
 		}
-		return
+		// 逐级解析路径，忽略大小写匹配或者给出最接近的候选路径
+		file, closest, er := newPanPathResolver(activeUser.PanClient(), driveId).Resolve(targetPath, lsOptions.IgnoreCase)
+		if er != nil {
+			fmt.Println(er)
+			setJsonErr(er)
+			return
+		}
+		if file == nil {
+			fmt.Println("指定目录不存在: " + targetPath)
+			setJsonError(int(apierror.ApiCodeFileNotFoundCode), "指定目录不存在: "+targetPath)
+			if closest != "" {
+				fmt.Println("最接近的候选路径: " + closest)
+			}
+			return
+		}
+		if file.Path != path.Clean(targetPath) {
+			fmt.Println("忽略大小写匹配到路径: " + file.Path)
+		}
+		targetPathInfo = file
 	}
 
 	// 适配通配符路径获取目标文件信息（弃用，容易触发风控）
@@ -173,6 +206,7 @@ func RunLs(driveId, targetPath string, lsOptions *LsOptions,
 
 	if targetPathInfo == nil {
 		fmt.Println("目录路径不存在")
+		setJsonError(int(apierror.ApiCodeFileNotFoundCode), "目录路径不存在")
 		return
 	}
 
@@ -186,12 +220,14 @@ func RunLs(driveId, targetPath string, lsOptions *LsOptions,
 		fileResult, err1 := activeUser.PanClient().OpenapiPanClient().FileListGetAll(fileListParam, 200)
 		if err1 != nil {
 			fmt.Println(err1)
+			setJsonErr(err1)
 			return
 		}
 		fileList = fileResult
 	} else {
 		fileList = append(fileList, targetPathInfo)
 	}
+	setJsonData(&lsJsonData{Path: targetPathInfo.Path, Files: fileList})
 	renderTable(opLs, lsOptions.Total, targetPathInfo.Path, fileList)
 }
 
@@ -18,7 +18,6 @@ import (
 	"github.com/tickstep/aliyunpan-api/aliyunpan"
 	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
 	"github.com/tickstep/aliyunpan/cmder"
-	"github.com/tickstep/aliyunpan/internal/config"
 	"github.com/urfave/cli"
 )
 
@@ -34,8 +33,8 @@ func CmdMkdir() cli.Command {
 				cli.ShowCommandHelp(c, c.Command.Name)
 				return nil
 			}
-			if config.Config.ActiveUser() == nil {
-				fmt.Println("未登录账号")
+			if GetActiveUser() == nil {
+				printNotLogin()
 				return nil
 			}
 			RunMkdir(parseDriveId(c), c.Args().Get(0))
@@ -60,15 +59,18 @@ func RunMkdir(driveId, name string) {
 
 	if err != nil {
 		fmt.Println("创建文件夹失败：" + err.Error())
+		setJsonErr(err)
 		return
 	}
 
 	if rs.FileId != "" {
 		fmt.Println("创建文件夹成功: ", fullpath)
+		setJsonSuccess()
 
 		// cache
 		activeUser.DeleteCache(GetAllPathFolderByPath(fullpath))
 	} else {
 		fmt.Println("创建文件夹失败: ", fullpath)
+		setJsonError(JsonCodeFailed, "创建文件夹失败: "+fullpath)
 	}
 }
@@ -0,0 +1,182 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/tickstep/aliyunpan/cmder"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/mount"
+	"github.com/tickstep/aliyunpan/internal/webdav"
+	"github.com/tickstep/library-go/converter"
+	"github.com/urfave/cli"
+)
+
+type (
+	// MountOptions 挂载参数
+	MountOptions struct {
+		CacheDir  string // 读缓存目录
+		CacheSize int64  // 读缓存目录大小限制
+		BlockSize int64  // 预读分片大小
+	}
+)
+
+func CmdMount() cli.Command {
+	return cli.Command{
+		Name:      "mount",
+		Usage:     "挂载网盘到本地目录(Linux, 只读)",
+		UsageText: cmder.App().Name + " mount [arguments...] <本地目录>",
+		Description: `
+	使用FUSE把网盘只读挂载到本地目录，根目录下每个网盘（备份盘、资源库、相册）对应一个文件夹，只支持Linux。
+	读取文件时按分片从网盘下载并缓存到本地，同时预读下一个分片，缓存超过大小限制时淘汰最久未使用的分片。
+	挂载目录不支持创建、修改、删除、移动文件，上传文件请使用 upload 命令或者 webdav 服务。服务退出时自动卸载。
+	普通用户需要安装 fuse 并且可以使用 fusermount 命令。macOS、Windows 请使用 webdav 命令。
+
+	示例:
+
+	挂载网盘到 /mnt/pan
+	aliyunpan mount /mnt/pan
+
+	读缓存限制为10GB，预读分片大小为16MB
+	aliyunpan mount -cache-size 10GB -block-size 16MB /mnt/pan
+
+	指定读缓存目录
+	aliyunpan mount -cache-dir /data/pan_cache /mnt/pan
+`,
+		Category: "阿里云盘",
+		Before:   ReloadConfigFunc,
+		Action: func(c *cli.Context) error {
+			if !mount.Supported() {
+				fmt.Println(mount.ErrMountNotSupported)
+				return nil
+			}
+			if c.NArg() != 1 {
+				cli.ShowCommandHelp(c, c.Command.Name)
+				return nil
+			}
+			if GetActiveUser() == nil {
+				printNotLogin()
+				return nil
+			}
+			opt := &MountOptions{
+				CacheDir:  c.String("cache-dir"),
+				CacheSize: webdav.DefaultBlockCacheSize,
+				BlockSize: webdav.DefaultBlockSize,
+			}
+			if c.IsSet("cache-size") {
+				size, err := converter.ParseFileSizeStr(c.String("cache-size"))
+				if err != nil {
+					fmt.Printf("缓存大小格式错误: %s\n", c.String("cache-size"))
+					return nil
+				}
+				opt.CacheSize = size
+			}
+			if c.IsSet("block-size") {
+				size, err := converter.ParseFileSizeStr(c.String("block-size"))
+				if err != nil || size <= 0 {
+					fmt.Printf("分片大小格式错误: %s\n", c.String("block-size"))
+					return nil
+				}
+				opt.BlockSize = size
+			}
+			RunMount(c.Args().Get(0), opt)
+			return nil
+		},
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "cache-dir",
+				Usage: "读缓存目录，默认为账号数据目录下的 mount_cache",
+			},
+			cli.StringFlag{
+				Name:  "cache-size",
+				Usage: "读缓存目录大小限制，0代表不限制，默认: 1GB",
+			},
+			cli.StringFlag{
+				Name:  "block-size",
+				Usage: "读取以及预读的分片大小，默认: 4MB",
+			},
+		},
+	}
+}
+
+// RunMount 挂载网盘到本地目录，收到退出信号后卸载
+func RunMount(mountpoint string, opt *MountOptions) {
+	activeUser := GetActiveUser()
+	panClient := activeUser.PanClient()
+	drives := config.DriveInfoList{}
+	for _, d := range activeUser.DriveList {
+		if d.DriveId != "" {
+			drives = append(drives, d)
+		}
+	}
+	dataDir := activeUserDataDir()
+	if opt.CacheDir == "" {
+		opt.CacheDir = filepath.Join(dataDir, "mount_cache")
+	}
+
+	blocks, err := webdav.NewBlockCache(panClient, opt.CacheDir, opt.BlockSize, opt.CacheSize)
+	if err != nil {
+		fmt.Printf("创建读缓存目录失败: %s\n", err)
+		return
+	}
+	// 挂载是只读的，不需要上传器
+	fs, err := webdav.NewPanFileSystem(panClient, drives, filepath.Join(dataDir, "mount"), config.Config.Webdav.MetaCacheExpiration(), blocks, nil)
+	if err != nil {
+		fmt.Printf("打开目录元数据缓存失败: %s\n", err)
+		return
+	}
+	defer fs.Close()
+
+	srv, err := mount.Mount(mountpoint, fs, &mount.Options{
+		FsName: "aliyunpan",
+		StatFs: func() (total, used uint64, err error) {
+			q, err := RunGetQuotaInfo()
+			if err != nil {
+				return 0, 0, err
+			}
+			return uint64(q.Quota), uint64(q.UsedSize), nil
+		},
+	})
+	if err != nil {
+		fmt.Printf("挂载失败: %s\n", err)
+		return
+	}
+	fmt.Printf("网盘已只读挂载到: %s\n", mountpoint)
+	fmt.Printf("读缓存目录: %s, 大小限制: %s, 分片大小: %s\n", opt.CacheDir, converter.ConvertFileSize(opt.CacheSize, 2), converter.ConvertFileSize(opt.BlockSize, 2))
+	fmt.Println("按 Ctrl+C 卸载并退出")
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+	go func() {
+		for range sigChan {
+			if err := srv.Unmount(); err != nil {
+				fmt.Printf("卸载失败: %s\n", err)
+				continue
+			}
+			return
+		}
+	}()
+	if err := srv.Serve(); err != nil {
+		fmt.Printf("挂载服务异常退出: %s\n", err)
+		srv.Unmount()
+		return
+	}
+	fmt.Println("已卸载")
+}
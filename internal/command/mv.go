@@ -22,6 +22,7 @@ import (
 	"os"
 	"path"
 	"strconv"
+	"strings"
 )
 
 func CmdMv() cli.Command {
@@ -48,8 +49,8 @@ func CmdMv() cli.Command {
 				cli.ShowCommandHelp(c, c.Command.Name)
 				return nil
 			}
-			if config.Config.ActiveUser() == nil {
-				fmt.Println("未登录账号")
+			if GetActiveUser() == nil {
+				printNotLogin()
 				return nil
 			}
 			RunMove(parseDriveId(c), c.Args()...)
@@ -72,14 +73,17 @@ func RunMove(driveId string, paths ...string) {
 	opFileList, targetFile, _, err := getFileInfo(driveId, paths...)
 	if err != nil {
 		fmt.Println(err)
+		setJsonError(JsonCodeBadArgs, err.Error())
 		return
 	}
 	if targetFile == nil {
 		fmt.Println("目标文件不存在")
+		setJsonError(JsonCodeBadArgs, "目标文件不存在")
 		return
 	}
 	if opFileList == nil || len(opFileList) == 0 {
 		fmt.Println("没有有效的文件可移动")
+		setJsonError(JsonCodeBadArgs, "没有有效的文件可移动")
 		return
 	}
 	cacheCleanPaths = append(cacheCleanPaths, targetFile.Path)
@@ -97,16 +101,20 @@ func RunMove(driveId string, paths ...string) {
 			failedMoveFiles = append(failedMoveFiles, mfi)
 		} else {
 			successMoveFiles = append(successMoveFiles, mfi)
+			config.GetFolderIdCache().Invalidate(driveId, mfi.Path)
 		}
 		cacheCleanPaths = append(cacheCleanPaths, path.Dir(mfi.Path))
 	}
 
 	if len(failedMoveFiles) > 0 {
 		fmt.Println("以下文件移动失败：")
+		failedPaths := []string{}
 		for _, f := range failedMoveFiles {
 			fmt.Println(f.Path)
+			failedPaths = append(failedPaths, f.Path)
 		}
 		fmt.Println("")
+		setJsonError(JsonCodePartialFailed, "移动失败: "+strings.Join(failedPaths, ", "))
 	}
 	if len(successMoveFiles) > 0 {
 		pnt := func() {
@@ -119,6 +127,7 @@ func RunMove(driveId string, paths ...string) {
 		}
 		fmt.Println("操作成功, 以下文件已移动到目标目录: ", targetFile.Path)
 		pnt()
+		setJsonSuccess()
 	} else {
 		fmt.Println("无法移动文件，请稍后重试")
 	}
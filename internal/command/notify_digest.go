@@ -0,0 +1,106 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/functions"
+	"github.com/tickstep/aliyunpan/internal/notify"
+	"github.com/tickstep/library-go/logger"
+)
+
+// newNotifyDigest 根据配置创建每日汇总，没有开启时返回nil
+func newNotifyDigest() *notify.Digest {
+	mailer, err := notify.ParseMailer(config.Config.NotifyEmailUrl())
+	if err != nil {
+		logger.Verboseln("parse notify email error: ", err)
+		return nil
+	}
+	digest, err := notify.NewDigest(config.Config.NotifyDigestFile(), config.Config.NotifyDigest, mailer)
+	if err != nil {
+		logger.Verboseln("create notify digest error: ", err)
+		return nil
+	}
+	return digest
+}
+
+// addNotifyDigestBatch 把上传、下载批次的结果记录到每日汇总，到达发送时间时顺便发送汇总
+func addNotifyDigestBatch(taskType string, data *transferJsonData) {
+	digest := newNotifyDigest()
+	if digest == nil || data == nil {
+		return
+	}
+	batch := &notify.DigestBatch{
+		Type:         taskType,
+		Target:       data.Target,
+		TotalFiles:   data.TotalFiles,
+		SucceedFiles: data.SucceedFiles,
+		FailedFiles:  data.FailedFiles,
+		TotalSize:    data.TotalSize,
+		Elapsed:      int64(data.Elapsed),
+		Canceled:     data.Canceled,
+	}
+	for _, f := range data.Files {
+		if f.Status == functions.FileResultFailed {
+			batch.FailedList = append(batch.FailedList, f.Path+": "+f.Error)
+		}
+	}
+	digest.Add(batch)
+	if _, err := digest.SendIfDue(time.Now()); err != nil {
+		fmt.Printf("发送每日汇总邮件失败: %s\n", err)
+	}
+}
+
+// sendNotifyDigestNow 立即发送每日汇总邮件
+func sendNotifyDigestNow() {
+	mailer, err := notify.ParseMailer(config.Config.NotifyEmailUrl())
+	if err != nil {
+		fmt.Printf("汇总邮件地址错误: %s\n", err)
+		return
+	}
+	digest, err := notify.NewDigest(config.Config.NotifyDigestFile(), config.Config.NotifyDigest, mailer)
+	if err != nil {
+		fmt.Printf("%s\n", err)
+		return
+	}
+	if digest == nil {
+		fmt.Printf("没有开启每日汇总邮件, 请先设置: config set -notify_digest 08:00 -notify_email <smtp地址>\n")
+		return
+	}
+	sent, err := digest.SendNow()
+	if err != nil {
+		fmt.Printf("发送每日汇总邮件失败: %s\n", err)
+		return
+	}
+	if !sent {
+		fmt.Printf("没有需要汇总的任务\n")
+		return
+	}
+	fmt.Printf("已发送每日汇总邮件\n")
+}
+
+// runNotifyDigest 在常驻进程中定时发送每日汇总，返回的函数用于停止
+func runNotifyDigest(digest *notify.Digest) func() {
+	if digest == nil {
+		return func() {}
+	}
+	stop := make(chan struct{})
+	go digest.Run(stop)
+	return func() {
+		close(stop)
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/notify"
+	"github.com/tickstep/aliyunpan/internal/utils"
+	"github.com/tickstep/library-go/converter"
+	"github.com/tickstep/library-go/logger"
+)
+
+const (
+	// quotaWarnPercent 网盘已用容量超过该百分比时推送容量不足事件
+	quotaWarnPercent = 90
+	// quotaWebhookInterval 容量不足事件的最短推送间隔，定时执行的上传任务不会每次都推送
+	quotaWebhookInterval = time.Hour
+	// quotaWebhookStampFileName 记录上一次推送容量不足事件的时间，保存在账号数据目录下
+	quotaWebhookStampFileName = "quota_webhook.stamp"
+	// webhookWaitTimeout 命令退出前等待Webhook推送完成的最长时间
+	webhookWaitTimeout = 30 * time.Second
+)
+
+var (
+	notifyWebhook      *notify.Webhook
+	notifyWebhookKey   string
+	notifyWebhookMutex sync.Mutex
+	quotaWebhookMutex  sync.Mutex
+)
+
+// newNotifyWebhook 根据配置获取Webhook通知，配置不变时复用同一个推送队列，没有设置地址时返回nil
+func newNotifyWebhook() *notify.Webhook {
+	c := config.Config
+	key := strings.Join([]string{c.WebhookUrl, c.WebhookHeaders, c.WebhookTemplate, c.WebhookEvents}, "\n")
+	notifyWebhookMutex.Lock()
+	defer notifyWebhookMutex.Unlock()
+	if notifyWebhook != nil && notifyWebhookKey == key {
+		return notifyWebhook
+	}
+	webhook, err := notify.NewWebhook(c.WebhookUrl, c.WebhookHeaders, c.WebhookTemplate, c.WebhookEvents)
+	if err != nil {
+		logger.Verboseln("create webhook error: ", err)
+		return nil
+	}
+	// 配置修改前的队列继续在后台推送
+	notifyWebhook, notifyWebhookKey = webhook, key
+	return webhook
+}
+
+// sendWebhookEvent 异步推送任务事件，推送失败或者队列已满时只提示不影响任务
+func sendWebhookEvent(event *notify.WebhookEvent) {
+	if !newNotifyWebhook().Post(event) {
+		fmt.Printf("Webhook通知队列已满, 丢弃事件: %s\n", event.Event)
+	}
+}
+
+// WaitWebhookEvents 等待后台的Webhook通知推送完成，程序退出前调用
+func WaitWebhookEvents() {
+	notifyWebhookMutex.Lock()
+	webhook := notifyWebhook
+	notifyWebhookMutex.Unlock()
+	if !webhook.Wait(webhookWaitTimeout) {
+		fmt.Printf("等待Webhook通知推送超时\n")
+	}
+}
+
+// sendUploadWebhookEvent 推送上传批次的结果，全部成功为upload.success，否则为upload.fail
+func sendUploadWebhookEvent(data *transferJsonData) {
+	if data == nil || config.Config.WebhookUrl == "" {
+		return
+	}
+	event := &notify.WebhookEvent{
+		Event: notify.EventUploadSuccess,
+		Title: "上传完成",
+		Message: fmt.Sprintf("上传到 %s, 成功 %d 个, 失败 %d 个, 数据总量: %s, 耗时: %s", data.Target, data.SucceedFiles,
+			data.FailedFiles, converter.ConvertFileSize(data.TotalSize, 2), utils.ConvertTimeSecond(int64(data.Elapsed))),
+		Data: data,
+	}
+	if data.FailedFiles > 0 || data.Canceled {
+		event.Event = notify.EventUploadFail
+		event.Title = "上传失败"
+		if data.Canceled {
+			event.Title = "上传已取消"
+		}
+	}
+	sendWebhookEvent(event)
+}
+
+// sendQuotaWebhookEvent 推送容量不足事件，同一个账号 quotaWebhookInterval 内只推送一次
+func sendQuotaWebhookEvent(message string) {
+	if config.Config.WebhookUrl == "" {
+		return
+	}
+	quotaWebhookMutex.Lock()
+	defer quotaWebhookMutex.Unlock()
+	stampFile := filepath.Join(activeUserDataDir(), quotaWebhookStampFileName)
+	if info, err := os.Stat(stampFile); err == nil && time.Since(info.ModTime()) < quotaWebhookInterval {
+		logger.Verboseln("skip quota webhook event: ", message)
+		return
+	}
+	now := time.Now()
+	if err := ioutil.WriteFile(stampFile, nil, 0600); err == nil {
+		os.Chtimes(stampFile, now, now)
+	}
+	sendWebhookEvent(&notify.WebhookEvent{
+		Event:   notify.EventQuotaWarning,
+		Title:   "容量不足",
+		Message: message,
+	})
+}
+
+// sendTestWebhook 发送测试Webhook通知
+func sendTestWebhook() {
+	// 测试通知不受 webhook_events 限制
+	webhook, err := notify.NewWebhook(config.Config.WebhookUrl, config.Config.WebhookHeaders, config.Config.WebhookTemplate, "")
+	if err != nil {
+		fmt.Printf("Webhook配置错误: %s\n", err)
+		return
+	}
+	if webhook == nil {
+		fmt.Printf("没有设置Webhook地址, 请先设置: config set -webhook_url <url>\n")
+		return
+	}
+	if err = webhook.Send(&notify.WebhookEvent{
+		Event:   "test",
+		Title:   notify.AppName,
+		Message: "这是一条测试通知",
+	}); err != nil {
+		fmt.Printf("发送Webhook通知失败: %s\n", err)
+		return
+	}
+	fmt.Printf("已发送Webhook通知\n")
+}
+
+// sendTokenRefreshFailWebhookEvent 推送刷新登录Token失败事件
+func sendTokenRefreshFailWebhookEvent(user *config.PanUser, tokenType, reason string) {
+	sendWebhookEvent(&notify.WebhookEvent{
+		Event:   notify.EventTokenRefreshFail,
+		Title:   "刷新登录Token失败",
+		Message: fmt.Sprintf("账号 %s 的 %s Token已过期并且刷新失败, 请重新登录: %s", user.Nickname, tokenType, reason),
+	})
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"path"
+	"strings"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan/internal/config"
+)
+
+type (
+	// panPathResolver 逐级解析网盘路径，支持忽略大小写匹配。
+	// 解析过程中获取的目录文件列表保存在本地索引中，同一次命令解析多个路径时不会重复请求网盘
+	panPathResolver struct {
+		panClient *config.PanClient
+		driveId   string
+		dirIndex  map[string]aliyunpan.FileList // 目录fileId => 目录下的文件列表
+	}
+)
+
+func newPanPathResolver(panClient *config.PanClient, driveId string) *panPathResolver {
+	return &panPathResolver{
+		panClient: panClient,
+		driveId:   driveId,
+		dirIndex:  map[string]aliyunpan.FileList{},
+	}
+}
+
+func (r *panPathResolver) listDir(dirFileId string) (aliyunpan.FileList, error) {
+	if files, ok := r.dirIndex[dirFileId]; ok {
+		return files, nil
+	}
+	files, err := r.panClient.OpenapiPanClient().FileListGetAll(&aliyunpan.FileListParam{
+		DriveId:      r.driveId,
+		ParentFileId: dirFileId,
+	}, 200)
+	if err != nil {
+		return nil, err
+	}
+	r.dirIndex[dirFileId] = files
+	return files, nil
+}
+
+// Resolve 解析网盘绝对路径。
+// ignoreCase为true时每一级路径都忽略大小写匹配，优先使用大小写完全一致的文件。
+// 文件不存在时返回nil，closest为按编辑距离最接近的候选路径，没有候选路径返回空字符串
+func (r *panPathResolver) Resolve(panPath string, ignoreCase bool) (file *aliyunpan.FileEntity, closest string, err error) {
+	dir := &aliyunpan.FileEntity{
+		FileId:   aliyunpan.DefaultRootParentFileId,
+		FileType: "folder",
+		Path:     "/",
+	}
+	for _, name := range strings.Split(path.Clean("/"+panPath), "/") {
+		if name == "" {
+			continue
+		}
+		if !dir.IsFolder() {
+			return nil, "", nil
+		}
+		files, er := r.listDir(dir.FileId)
+		if er != nil {
+			return nil, "", er
+		}
+		var matched *aliyunpan.FileEntity
+		for _, f := range files {
+			if f.FileName == name {
+				matched = f
+				break
+			}
+			if ignoreCase && matched == nil && strings.EqualFold(f.FileName, name) {
+				matched = f
+			}
+		}
+		if matched == nil {
+			names := make([]string, 0, len(files))
+			for _, f := range files {
+				names = append(names, f.FileName)
+			}
+			if c := closestName(name, names); c != "" {
+				closest = path.Join(dir.Path, c)
+			}
+			return nil, closest, nil
+		}
+		matched.Path = path.Join(dir.Path, matched.FileName)
+		dir = matched
+	}
+	return dir, "", nil
+}
+
+// closestName 获取和name编辑距离最小的候选名称，距离超过name长度一半的不作为候选
+func closestName(name string, candidates []string) string {
+	target := []rune(strings.ToLower(name))
+	best, bestDistance := "", len(target)/2+1
+	for _, c := range candidates {
+		if d := editDistance(target, []rune(strings.ToLower(c))); d < bestDistance {
+			best, bestDistance = c, d
+		}
+	}
+	return best
+}
+
+// editDistance 计算两个字符串的编辑距离
+func editDistance(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
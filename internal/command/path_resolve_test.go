@@ -0,0 +1,25 @@
+package command
+
+import "testing"
+
+func TestEditDistance(t *testing.T) {
+	if d := editDistance([]rune("kitten"), []rune("sitting")); d != 3 {
+		t.Fatalf("distance: %d", d)
+	}
+	if d := editDistance([]rune(""), []rune("视频")); d != 2 {
+		t.Fatalf("distance: %d", d)
+	}
+}
+
+func TestClosestName(t *testing.T) {
+	candidates := []string{"Documents", "Video", "照片"}
+	if c := closestName("video", candidates); c != "Video" {
+		t.Fatalf("closest: %s", c)
+	}
+	if c := closestName("Documnets", candidates); c != "Documents" {
+		t.Fatalf("closest: %s", c)
+	}
+	if c := closestName("music", candidates); c != "" {
+		t.Fatalf("closest: %s", c)
+	}
+}
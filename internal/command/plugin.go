@@ -0,0 +1,152 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/tickstep/aliyunpan/cmder"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/plugins"
+	"github.com/tickstep/aliyunpan/internal/utils"
+	"github.com/tickstep/library-go/logger"
+	"github.com/urfave/cli"
+)
+
+func CmdPlugin() cli.Command {
+	return cli.Command{
+		Name:  "plugin",
+		Usage: "JS插件管理",
+		Description: `
+	JS插件管理. 同步备份、上传等长时间运行的任务会自动检测插件脚本的变更并重新加载, 无需重启任务.
+
+	示例:
+
+	1. 检查插件目录下所有JS脚本的语法以及回调函数签名
+	aliyunpan plugin check
+
+	2. 检查指定的脚本文件
+	aliyunpan plugin check ./upload_handler.js
+
+	3. 检查插件清单
+	aliyunpan plugin check ./upload_handler.manifest.json
+`,
+		Category: "其他",
+		Action: func(c *cli.Context) error {
+			cli.ShowCommandHelp(c, c.Command.Name)
+			return nil
+		},
+		Subcommands: []cli.Command{
+			{
+				Name:      "check",
+				Usage:     "检查插件脚本的语法以及回调函数签名",
+				UsageText: cmder.App().Name + " plugin check [脚本文件或目录...]",
+				Description: `检查JS插件脚本的语法错误、顶层代码的运行错误, 以及回调函数的类型和参数个数, 错误信息定位到行号.
+	插件清单(*.manifest.json)检查清单格式以及声明的回调函数是否在脚本中实现.
+	不指定脚本时检查插件目录下的所有JS脚本以及插件清单.`,
+				Action: func(c *cli.Context) error {
+					RunPluginCheck(c.Args())
+					return nil
+				},
+			},
+		},
+	}
+}
+
+// RunPluginCheck 检查插件脚本
+func RunPluginCheck(paths []string) {
+	files := []string{}
+	if len(paths) == 0 {
+		manager := plugins.NewPluginManager(config.GetPluginDir())
+		files = append(manager.JsScriptFiles(), manager.ManifestFiles()...)
+		if len(files) == 0 {
+			fmt.Printf("插件目录下没有JS脚本: %s\n", config.GetPluginDir()+string(os.PathSeparator)+"js")
+			setJsonData([]*plugins.ScriptIssue{})
+			return
+		}
+	}
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		if err != nil {
+			fmt.Printf("读取脚本失败: %s\n", err)
+			setJsonError(JsonCodeBadArgs, err.Error())
+			return
+		}
+		if fi.IsDir() {
+			// 指定插件配置目录时检查其中js子目录下的脚本
+			scripts := append(plugins.ScriptFilesIn(p), plugins.ManifestFilesIn(p)...)
+			if len(scripts) == 0 {
+				scripts = append(plugins.ScriptFilesIn(path.Join(p, "js")), plugins.ManifestFilesIn(path.Join(p, "js"))...)
+			}
+			files = append(files, scripts...)
+			continue
+		}
+		files = append(files, p)
+	}
+
+	issues := []*plugins.ScriptIssue{}
+	errorCount := 0
+	for _, file := range files {
+		var fileIssues []*plugins.ScriptIssue
+		if data, err := ioutil.ReadFile(file); err != nil {
+			fileIssues = []*plugins.ScriptIssue{{File: file, Level: plugins.ScriptIssueError, Message: err.Error()}}
+		} else if strings.HasSuffix(strings.ToLower(file), plugins.ManifestFileSuffix) {
+			fileIssues = plugins.CheckManifest(file, data)
+		} else {
+			fileIssues = plugins.CheckScript(file, string(data))
+		}
+		if len(fileIssues) == 0 {
+			fmt.Printf("%s: 检查通过\n", file)
+			continue
+		}
+		for _, issue := range fileIssues {
+			fmt.Printf("%s\n", issue)
+			if issue.Level == plugins.ScriptIssueError {
+				errorCount++
+			}
+		}
+		issues = append(issues, fileIssues...)
+	}
+	fmt.Printf("\n共检查 %d 个脚本, 错误 %d 个, 警告 %d 个\n", len(files), errorCount, len(issues)-errorCount)
+	setJsonData(issues)
+	if errorCount > 0 {
+		setJsonError(JsonCodeFailed, fmt.Sprintf("插件脚本有 %d 个错误", errorCount))
+	}
+}
+
+// taskBatchFinishPluginCallback 一批上传、下载任务全部结束后回调插件，taskType为upload-上传，download-下载
+func taskBatchFinishPluginCallback(plugin plugins.Plugin, user *config.PanUser, taskType, driveId string, data *transferJsonData) {
+	if plugin == nil || data == nil {
+		return
+	}
+	params := &plugins.TaskBatchFinishParams{
+		TaskType:     taskType,
+		DriveId:      driveId,
+		Target:       data.Target,
+		TotalCount:   data.TotalFiles,
+		SucceedCount: data.SucceedFiles,
+		FailedCount:  data.FailedFiles,
+		TotalSize:    data.TotalSize,
+		Elapsed:      int64(data.Elapsed),
+		Canceled:     data.Canceled,
+		FinishedAt:   utils.NowTimeStr(),
+	}
+	if er := plugin.TaskBatchFinishCallback(plugins.GetContext(user), params); er != nil {
+		logger.Verboseln("插件TaskBatchFinishCallback调用失败： ", er)
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan/cmder"
+	"github.com/tickstep/aliyunpan/cmder/cmdtable"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/functions/panwalk"
+	"github.com/tickstep/library-go/logger"
+	"github.com/urfave/cli"
+)
+
+type (
+	// pruneEmptyContext 清理空目录的上下文
+	pruneEmptyContext struct {
+		driveId      string
+		minDepth     int
+		dryRun       bool
+		panClient    *config.PanClient
+		walker       *panwalk.Walker                         // 获取目录下的文件列表
+		deleteFolder func(folder *aliyunpan.FileEntity) bool // 删除目录，默认调用网盘接口
+		emptyDirs    []*aliyunpan.FileEntity                 // 需要删除的空目录，只记录最顶层的空目录
+		failedDirs   []string
+		scanFolders  int
+	}
+)
+
+func CmdPruneEmpty() cli.Command {
+	return cli.Command{
+		Name:      "prune-empty",
+		Usage:     "清理空目录",
+		UsageText: cmder.App().Name + " prune-empty <目录路径>",
+		Description: `
+	递归找出并删除指定目录下的所有空目录。只包含空目录的目录也会被当作空目录删除。
+	被删除的目录可在网盘文件回收站找回。
+
+	示例:
+
+	预览 /我的资源 目录下的所有空目录，不会实际删除
+	aliyunpan prune-empty --dry-run /我的资源
+
+	删除 /我的资源 目录下的所有空目录
+	aliyunpan prune-empty /我的资源
+
+	删除 /我的资源 目录下的空目录，但是保留 /我的资源 下的第一层目录，即使是空目录也不删除
+	aliyunpan prune-empty --min-depth 2 /我的资源
+`,
+		Category: "阿里云盘",
+		Before:   ReloadConfigFunc,
+		Action: func(c *cli.Context) error {
+			if c.NArg() != 1 {
+				cli.ShowCommandHelp(c, c.Command.Name)
+				return nil
+			}
+			if GetActiveUser() == nil {
+				printNotLogin()
+				return nil
+			}
+			minDepth := c.Int("min-depth")
+			if minDepth < 1 {
+				fmt.Println("min-depth 最小值为1，指定的目录本身不会被删除")
+				return nil
+			}
+			RunPruneEmpty(parseDriveId(c), c.Args().Get(0), minDepth, c.Bool("dry-run"))
+			return nil
+		},
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "driveId",
+				Usage: "网盘ID",
+				Value: "",
+			},
+			cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "只列出找到的空目录，不实际删除",
+			},
+			cli.IntFlag{
+				Name:  "min-depth",
+				Usage: "最小深度保护，深度小于该值的目录不会被删除。指定目录下的第一层目录深度为1",
+				Value: 1,
+			},
+		},
+	}
+}
+
+// RunPruneEmpty 执行清理空目录
+func RunPruneEmpty(driveId, pathStr string, minDepth int, dryRun bool) {
+	activeUser := GetActiveUser()
+	targetPath := path.Clean(activeUser.PathJoin(driveId, pathStr))
+	targetPathInfo, err := activeUser.PanClient().OpenapiPanClient().FileInfoByPath(driveId, targetPath)
+	if err != nil || targetPathInfo == nil {
+		fmt.Printf("目录不存在: %s\n", targetPath)
+		return
+	}
+	if !targetPathInfo.IsFolder() {
+		fmt.Printf("指定的路径不是目录: %s\n", targetPath)
+		return
+	}
+	targetPathInfo.Path = targetPath
+
+	ctx := &pruneEmptyContext{
+		driveId:   driveId,
+		minDepth:  minDepth,
+		dryRun:    dryRun,
+		panClient: activeUser.PanClient(),
+		walker:    panwalk.NewWalker(activeUser.PanClient(), driveId),
+	}
+	ctx.deleteFolder = ctx.deleteFolderByApi
+	fmt.Printf("正在扫描空目录: %s\n", targetPath)
+	ctx.pruneFolder(targetPathInfo, 0)
+
+	if len(ctx.failedDirs) > 0 {
+		fmt.Println("以下目录扫描或删除失败：")
+		for _, p := range ctx.failedDirs {
+			fmt.Println(p)
+		}
+		fmt.Println("")
+	}
+	if len(ctx.emptyDirs) == 0 {
+		fmt.Printf("扫描目录 %d 个，没有找到空目录\n", ctx.scanFolders)
+		return
+	}
+	if dryRun {
+		fmt.Printf("扫描目录 %d 个，以下空目录将会被删除（dry-run模式，未实际删除）: \n", ctx.scanFolders)
+	} else {
+		fmt.Printf("扫描目录 %d 个，以下空目录已删除, 可在云盘文件回收站找回: \n", ctx.scanFolders)
+	}
+	tb := cmdtable.NewTable(os.Stdout)
+	tb.SetHeader([]string{"#", "目录"})
+	for k, f := range ctx.emptyDirs {
+		tb.Append([]string{strconv.Itoa(k + 1), f.Path})
+	}
+	tb.Render()
+	if !dryRun {
+		for _, f := range ctx.emptyDirs {
+			config.GetFolderIdCache().Invalidate(driveId, f.Path)
+		}
+		activeUser.DeleteCache(GetAllPathFolderByPath(targetPath))
+	}
+}
+
+// pruneFolder 后序遍历目录，返回该目录是否是空目录。
+// 空目录不会马上删除，而是交给上一层目录处理，这样一整棵空目录树只需要删除最顶层的目录
+func (ctx *pruneEmptyContext) pruneFolder(folder *aliyunpan.FileEntity, depth int) bool {
+	ctx.scanFolders += 1
+	fileList, err := ctx.walker.ListFolder(folder.FileId)
+	if err != nil {
+		logger.Verbosef("list folder error: %s, %s\n", folder.Path, err)
+		ctx.failedDirs = append(ctx.failedDirs, folder.Path)
+		return false
+	}
+
+	isEmpty := true
+	emptySubFolders := []*aliyunpan.FileEntity{}
+	for _, f := range fileList {
+		if !f.IsFolder() {
+			isEmpty = false
+			continue
+		}
+		f.Path = path.Join(folder.Path, f.FileName)
+		if ctx.pruneFolder(f, depth+1) {
+			emptySubFolders = append(emptySubFolders, f)
+		} else {
+			isEmpty = false
+		}
+	}
+	if isEmpty && depth >= ctx.minDepth {
+		// 整个目录都是空的，交给上一层目录删除。深度小于最小深度的目录受保护，不会返回给上一层删除
+		return true
+	}
+
+	// 本目录需要保留，删除下面的空目录
+	for _, f := range emptySubFolders {
+		ctx.removeFolder(f)
+	}
+	return false
+}
+
+func (ctx *pruneEmptyContext) removeFolder(folder *aliyunpan.FileEntity) {
+	if ctx.dryRun {
+		ctx.emptyDirs = append(ctx.emptyDirs, folder)
+		return
+	}
+	if !ctx.deleteFolder(folder) {
+		ctx.failedDirs = append(ctx.failedDirs, folder.Path)
+		return
+	}
+	ctx.emptyDirs = append(ctx.emptyDirs, folder)
+}
+
+// deleteFolderByApi 调用网盘接口把目录移入回收站
+func (ctx *pruneEmptyContext) deleteFolderByApi(folder *aliyunpan.FileEntity) bool {
+	fdr, err := ctx.panClient.OpenapiPanClient().FileDelete(&aliyunpan.FileBatchActionParam{
+		DriveId: ctx.driveId,
+		FileId:  folder.FileId,
+	})
+	if err != nil || fdr == nil || !fdr.Success {
+		logger.Verbosef("delete folder error: %s, %s\n", folder.Path, err)
+		return false
+	}
+	return true
+}
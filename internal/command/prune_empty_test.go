@@ -0,0 +1,103 @@
+package command
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
+	"github.com/tickstep/aliyunpan-api/aliyunpan_open"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/functions/panwalk"
+)
+
+// newPruneTestContext 内存中的网盘目录树：
+//
+//	/root
+//	├── a/            空目录
+//	├── b/b1/, b/b2/  只包含空目录
+//	├── c/c.txt, c/c1/
+//	└── d/            获取文件列表失败
+func newPruneTestContext(minDepth int, dryRun bool) (*pruneEmptyContext, *[]string) {
+	folder := func(name string) *aliyunpan.FileEntity {
+		return &aliyunpan.FileEntity{FileId: name, FileName: name, FileType: "folder"}
+	}
+	tree := map[string]aliyunpan.FileList{
+		"root": {folder("a"), folder("b"), folder("c"), folder("d")},
+		"b":    {folder("b1"), folder("b2")},
+		"c":    {{FileId: "c.txt", FileName: "c.txt", FileType: "file"}, folder("c1")},
+	}
+	walker := panwalk.NewWalker(config.NewPanClient(nil, &aliyunpan_open.OpenPanClient{}), "drive")
+	walker.SetMaxRetry(0)
+	walker.SetListPageFunc(func(param *aliyunpan.FileListParam) (*aliyunpan.FileListResult, *apierror.ApiError) {
+		if param.ParentFileId == "d" {
+			return nil, apierror.NewFailedApiError("list failed")
+		}
+		files := aliyunpan.FileList{}
+		for _, f := range tree[param.ParentFileId] {
+			// 每次返回新的对象，和真实的接口一样
+			item := *f
+			files = append(files, &item)
+		}
+		return &aliyunpan.FileListResult{FileList: files}, nil
+	})
+
+	deleted := &[]string{}
+	ctx := &pruneEmptyContext{
+		driveId:  "drive",
+		minDepth: minDepth,
+		dryRun:   dryRun,
+		walker:   walker,
+	}
+	ctx.deleteFolder = func(f *aliyunpan.FileEntity) bool {
+		*deleted = append(*deleted, f.Path)
+		return f.FileId != "b2"
+	}
+	return ctx, deleted
+}
+
+func prunePaths(files []*aliyunpan.FileEntity) string {
+	paths := []string{}
+	for _, f := range files {
+		paths = append(paths, f.Path)
+	}
+	sort.Strings(paths)
+	return strings.Join(paths, ",")
+}
+
+func TestPruneEmpty(t *testing.T) {
+	root := &aliyunpan.FileEntity{FileId: "root", FileName: "root", FileType: "folder", Path: "/root"}
+	cases := []struct {
+		name     string
+		minDepth int
+		dryRun   bool
+		deleted  string // 调用删除接口的目录
+		empty    string // 报告中的空目录
+		failed   string
+	}{
+		// 只删除最顶层的空目录，b 下面的空目录随 b 一起删除
+		{"default", 1, false, "/root/a,/root/b,/root/c/c1", "/root/a,/root/b,/root/c/c1", "/root/d"},
+		// 第一层目录受保护，删除其下的空目录，b2 删除失败
+		{"min-depth", 2, false, "/root/b/b1,/root/b/b2,/root/c/c1", "/root/b/b1,/root/c/c1", "/root/b/b2,/root/d"},
+		// dry-run 不删除任何目录
+		{"dry-run", 1, true, "", "/root/a,/root/b,/root/c/c1", "/root/d"},
+	}
+	for _, c := range cases {
+		ctx, deleted := newPruneTestContext(c.minDepth, c.dryRun)
+		if ctx.pruneFolder(root, 0) {
+			t.Errorf("%s: root folder should never be deleted", c.name)
+		}
+		sort.Strings(*deleted)
+		if got := strings.Join(*deleted, ","); got != c.deleted {
+			t.Errorf("%s: deleted %s, want %s", c.name, got, c.deleted)
+		}
+		if got := prunePaths(ctx.emptyDirs); got != c.empty {
+			t.Errorf("%s: empty dirs %s, want %s", c.name, got, c.empty)
+		}
+		sort.Strings(ctx.failedDirs)
+		if got := strings.Join(ctx.failedDirs, ","); got != c.failed {
+			t.Errorf("%s: failed dirs %s, want %s", c.name, got, c.failed)
+		}
+	}
+}
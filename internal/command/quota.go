@@ -15,39 +15,104 @@ package command
 
 import (
 	"fmt"
-	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/cmder"
+	"github.com/tickstep/aliyunpan/internal/functions/panwalk"
 	"github.com/tickstep/library-go/converter"
 	"github.com/urfave/cli"
 )
 
 type QuotaInfo struct {
 	// 已使用个人空间大小
-	UsedSize int64
+	UsedSize int64 `json:"usedSize"`
 	// 个人空间总大小
-	Quota int64
+	Quota int64 `json:"quota"`
+	// 目录空间占用，使用 --tree 时才统计
+	Tree *QuotaTreeNode `json:"tree,omitempty"`
 }
 
 func CmdQuota() cli.Command {
 	return cli.Command{
-		Name:        "quota",
-		Usage:       "获取当前帐号空间配额",
-		Description: "获取网盘的总储存空间, 和已使用的储存空间",
-		Category:    "阿里云盘账号",
-		Before:      ReloadConfigFunc,
+		Name:      "quota",
+		Usage:     "获取当前帐号空间配额",
+		UsageText: cmder.App().Name + " quota [--tree] [目录路径]",
+		Description: `
+	获取网盘的总储存空间, 和已使用的储存空间。
+	使用 --tree 时遍历指定的目录(默认为根目录)，统计每个目录的空间占用，按目录树状输出占用空间最大的文件夹和文件，用于查找占用空间的内容。
+
+	示例:
+
+	查看空间配额
+	aliyunpan quota
+
+	统计整个网盘的空间占用，展开2层目录，每个目录显示占用最大的10项
+	aliyunpan quota --tree
+
+	统计 /我的资源 目录的空间占用，展开3层目录，每个目录显示占用最大的20项
+	aliyunpan quota --tree --depth 3 --top 20 /我的资源
+`,
+		Category: "阿里云盘账号",
+		Before:   ReloadConfigFunc,
 		Action: func(c *cli.Context) error {
-			if config.Config.ActiveUser() == nil {
-				fmt.Println("未登录账号")
+			if GetActiveUser() == nil {
+				printNotLogin()
 				return nil
 			}
 			q, err := RunGetQuotaInfo()
-			if err == nil {
-				fmt.Printf("账号: %s, uid: %s, 个人空间总额: %s, 个人空间已使用: %s, 比率: %.2f%%\n",
-					config.Config.ActiveUser().Nickname, config.Config.ActiveUser().UserId,
-					converter.ConvertFileSize(q.Quota, 2), converter.ConvertFileSize(q.UsedSize, 2),
-					100*float64(q.UsedSize)/float64(q.Quota))
+			if err != nil {
+				fmt.Printf("获取空间配额失败: %s\n", err)
+				setJsonErr(err)
+				return nil
+			}
+			fmt.Printf("账号: %s, uid: %s, 个人空间总额: %s, 个人空间已使用: %s, 比率: %.2f%%\n",
+				GetActiveUser().Nickname, GetActiveUser().UserId,
+				converter.ConvertFileSize(q.Quota, 2), converter.ConvertFileSize(q.UsedSize, 2),
+				100*float64(q.UsedSize)/float64(q.Quota))
+			if c.Bool("tree") {
+				if c.Int("depth") < 1 {
+					fmt.Println("depth 最小值为1")
+					setJsonError(JsonCodeBadArgs, "depth 最小值为1")
+					return nil
+				}
+				pathStr := "/"
+				if c.NArg() > 0 {
+					pathStr = c.Args().Get(0)
+				}
+				q.Tree, err = RunQuotaTree(parseDriveId(c), pathStr, c.Int("top"), c.Int("depth"), c.Int("parallel"))
+				if err != nil {
+					fmt.Printf("统计空间占用失败: %s\n", err)
+					setJsonErr(err)
+					return nil
+				}
 			}
+			setJsonData(q)
 			return nil
 		},
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "driveId",
+				Usage: "网盘ID",
+				Value: "",
+			},
+			cli.BoolFlag{
+				Name:  "tree",
+				Usage: "遍历目录统计空间占用，按目录树状输出占用空间最大的文件夹和文件",
+			},
+			cli.IntFlag{
+				Name:  "top",
+				Usage: "每个目录显示占用空间最大的项数量，其余的合并显示为其他，0代表全部显示",
+				Value: DefaultQuotaTreeTop,
+			},
+			cli.IntFlag{
+				Name:  "depth",
+				Usage: "展开的目录层数，指定目录下的第一层为1",
+				Value: DefaultQuotaTreeDepth,
+			},
+			cli.IntFlag{
+				Name:  "parallel",
+				Usage: "同时遍历的目录数量",
+				Value: panwalk.DefaultParallel,
+			},
+		},
 	}
 }
 
@@ -0,0 +1,236 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan/internal/functions/panwalk"
+	"github.com/tickstep/library-go/converter"
+)
+
+const (
+	// DefaultQuotaTreeTop 每个目录默认显示的最大项数量
+	DefaultQuotaTreeTop = 10
+	// DefaultQuotaTreeDepth 默认展开的目录层数
+	DefaultQuotaTreeDepth = 2
+)
+
+type (
+	// QuotaTreeNode 目录空间占用，Size 和 FileCount 包含所有子目录中的文件
+	QuotaTreeNode struct {
+		Name       string           `json:"name"`
+		Path       string           `json:"path"`
+		IsFolder   bool             `json:"isFolder"`
+		Size       int64            `json:"size"`
+		FileCount  int              `json:"fileCount,omitempty"`
+		Children   []*QuotaTreeNode `json:"children,omitempty"`
+		Others     int              `json:"others,omitempty"`     // 没有显示的项数量
+		OthersSize int64            `json:"othersSize,omitempty"` // 没有显示的项占用的空间
+
+		folders    map[string]*QuotaTreeNode // 子目录
+		files      []*QuotaTreeNode          // 占用空间最大的top个文件
+		childFiles int                       // 直接包含的文件数量
+	}
+
+	// quotaTreeBuilder 根据遍历到的文件统计每个目录的空间占用。
+	// 所有目录都会保留，每个目录只保留占用空间最大的top个文件，避免文件数量很多时占用大量内存
+	quotaTreeBuilder struct {
+		root *QuotaTreeNode
+		top  int
+	}
+)
+
+func newQuotaTreeBuilder(rootPath string, top int) *quotaTreeBuilder {
+	return &quotaTreeBuilder{
+		root: &QuotaTreeNode{Name: rootPath, Path: rootPath, IsFolder: true},
+		top:  top,
+	}
+}
+
+// folder 获取目录对应的节点，不存在的上级目录会一起创建
+func (b *quotaTreeBuilder) folder(folderPath string) *QuotaTreeNode {
+	rel := strings.Trim(strings.TrimPrefix(folderPath, b.root.Path), "/")
+	node := b.root
+	if rel == "" {
+		return node
+	}
+	for _, name := range strings.Split(rel, "/") {
+		if node.folders == nil {
+			node.folders = map[string]*QuotaTreeNode{}
+		}
+		child, ok := node.folders[name]
+		if !ok {
+			child = &QuotaTreeNode{Name: name, Path: path.Join(node.Path, name), IsFolder: true}
+			node.folders[name] = child
+		}
+		node = child
+	}
+	return node
+}
+
+// add 统计一个遍历到的文件或者目录
+func (b *quotaTreeBuilder) add(file *aliyunpan.FileEntity) {
+	if file.IsFolder() {
+		b.folder(file.Path)
+		return
+	}
+	parent := b.folder(path.Dir(file.Path))
+	parent.childFiles++
+	for node := b.root; ; {
+		node.Size += file.FileSize
+		node.FileCount++
+		if node == parent {
+			break
+		}
+		rel := strings.Trim(strings.TrimPrefix(parent.Path, node.Path), "/")
+		node = node.folders[strings.SplitN(rel, "/", 2)[0]]
+	}
+
+	// 只保留占用空间最大的top个文件
+	if b.top > 0 && len(parent.files) >= b.top && parent.files[len(parent.files)-1].Size >= file.FileSize {
+		return
+	}
+	fileNode := &QuotaTreeNode{Name: file.FileName, Path: file.Path, Size: file.FileSize}
+	i := sort.Search(len(parent.files), func(i int) bool { return parent.files[i].Size < file.FileSize })
+	parent.files = append(parent.files, nil)
+	copy(parent.files[i+1:], parent.files[i:])
+	parent.files[i] = fileNode
+	if b.top > 0 && len(parent.files) > b.top {
+		parent.files = parent.files[:b.top]
+	}
+}
+
+// build 生成展示用的目录树，每个目录按占用空间从大到小保留top项，只展开depth层目录
+func (b *quotaTreeBuilder) build(depth int) *QuotaTreeNode {
+	b.root.expand(b.top, depth)
+	return b.root
+}
+
+func (n *QuotaTreeNode) expand(top, depth int) {
+	if depth <= 0 {
+		return
+	}
+	children := make([]*QuotaTreeNode, 0, len(n.folders)+len(n.files))
+	for _, f := range n.folders {
+		children = append(children, f)
+	}
+	children = append(children, n.files...)
+	sort.SliceStable(children, func(i, j int) bool {
+		if children[i].Size != children[j].Size {
+			return children[i].Size > children[j].Size
+		}
+		return children[i].Name < children[j].Name
+	})
+	if top > 0 && len(children) > top {
+		children = children[:top]
+	}
+	n.Children = children
+	n.Others = len(n.folders) + n.childFiles - len(children)
+	n.OthersSize = n.Size
+	for _, c := range children {
+		n.OthersSize -= c.Size
+		if c.IsFolder {
+			c.expand(top, depth-1)
+		}
+	}
+}
+
+// Print 以树状输出空间占用，显示占上一级目录的比例
+func (n *QuotaTreeNode) Print(w io.Writer) {
+	fmt.Fprintf(w, "%s  %s, 文件 %d 个\n", n.Name, converter.ConvertFileSize(n.Size, 2), n.FileCount)
+	n.printChildren(w, "")
+}
+
+func (n *QuotaTreeNode) printChildren(w io.Writer, prefix string) {
+	count := len(n.Children)
+	if n.Others > 0 {
+		count++
+	}
+	for i, c := range n.Children {
+		branch, next := "├── ", "│   "
+		if i == count-1 {
+			branch, next = "└── ", "    "
+		}
+		if c.IsFolder {
+			fmt.Fprintf(w, "%s%s%s/  %s  %s, 文件 %d 个\n", prefix, branch, c.Name,
+				converter.ConvertFileSize(c.Size, 2), quotaPercent(c.Size, n.Size), c.FileCount)
+			c.printChildren(w, prefix+next)
+		} else {
+			fmt.Fprintf(w, "%s%s%s  %s  %s\n", prefix, branch, c.Name,
+				converter.ConvertFileSize(c.Size, 2), quotaPercent(c.Size, n.Size))
+		}
+	}
+	if n.Others > 0 {
+		fmt.Fprintf(w, "%s└── (其他 %d 项)  %s  %s\n", prefix, n.Others,
+			converter.ConvertFileSize(n.OthersSize, 2), quotaPercent(n.OthersSize, n.Size))
+	}
+}
+
+func quotaPercent(size, total int64) string {
+	if total <= 0 {
+		return "0.00%"
+	}
+	return fmt.Sprintf("%.2f%%", 100*float64(size)/float64(total))
+}
+
+// RunQuotaTree 遍历目录统计空间占用，按目录树状输出占用空间最大的文件夹和文件
+func RunQuotaTree(driveId, pathStr string, top, depth, parallel int) (*QuotaTreeNode, error) {
+	activeUser := GetActiveUser()
+	targetPath := path.Clean(activeUser.PathJoin(driveId, pathStr))
+	targetInfo, apierr := activeUser.PanClient().OpenapiPanClient().FileInfoByPath(driveId, targetPath)
+	if apierr != nil || targetInfo == nil {
+		return nil, fmt.Errorf("目录不存在: %s", targetPath)
+	}
+	if !targetInfo.IsFolder() {
+		return nil, fmt.Errorf("指定的路径不是目录: %s", targetPath)
+	}
+	targetInfo.Path = targetPath
+
+	builder := newQuotaTreeBuilder(targetPath, top)
+	walker := panwalk.NewWalker(activeUser.PanClient(), driveId)
+	if parallel > 0 {
+		walker.SetParallel(parallel)
+	}
+	fmt.Printf("正在统计目录空间占用: %s\n", targetPath)
+	folders, files := 0, 0
+	lastPrint := time.Time{}
+	err := walker.Walk(targetInfo, func(file *aliyunpan.FileEntity) error {
+		builder.add(file)
+		if file.IsFolder() {
+			folders++
+		} else {
+			files++
+		}
+		if time.Since(lastPrint) >= 500*time.Millisecond {
+			lastPrint = time.Now()
+			fmt.Printf("\r已扫描: 文件 %d 个, 目录 %d 个, 大小 %s", files, folders, converter.ConvertFileSize(builder.root.Size, 2))
+		}
+		return nil
+	})
+	fmt.Printf("\r已扫描: 文件 %d 个, 目录 %d 个, 大小 %s\n\n", files, folders, converter.ConvertFileSize(builder.root.Size, 2))
+	if err != nil {
+		return nil, err
+	}
+	root := builder.build(depth)
+	root.Print(os.Stdout)
+	return root, nil
+}
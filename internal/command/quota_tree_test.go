@@ -0,0 +1,42 @@
+package command
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+)
+
+func TestQuotaTreeBuilder(t *testing.T) {
+	b := newQuotaTreeBuilder("/", 2)
+	for _, f := range []*aliyunpan.FileEntity{
+		{FileName: "video", FileType: "folder", Path: "/video"},
+		{FileName: "a.mp4", FileType: "file", Path: "/video/a.mp4", FileSize: 500},
+		{FileName: "b.mp4", FileType: "file", Path: "/video/2024/b.mp4", FileSize: 300},
+		{FileName: "c.jpg", FileType: "file", Path: "/photo/c.jpg", FileSize: 100},
+		{FileName: "d.txt", FileType: "file", Path: "/d.txt", FileSize: 10},
+		{FileName: "e.txt", FileType: "file", Path: "/e.txt", FileSize: 1},
+	} {
+		b.add(f)
+	}
+	root := b.build(1)
+	if root.Size != 911 || root.FileCount != 5 {
+		t.Fatalf("unexpected root usage: %d, %d", root.Size, root.FileCount)
+	}
+	if len(root.Children) != 2 || root.Children[0].Name != "video" || root.Children[1].Name != "photo" {
+		t.Fatalf("unexpected children: %v", root.Children)
+	}
+	if root.Children[0].Size != 800 || root.Children[0].FileCount != 2 || root.Children[0].Children != nil {
+		t.Fatalf("unexpected video usage: %+v", root.Children[0])
+	}
+	if root.Others != 2 || root.OthersSize != 11 {
+		t.Fatalf("unexpected others: %d, %d", root.Others, root.OthersSize)
+	}
+
+	buf := &bytes.Buffer{}
+	root.Print(buf)
+	if !strings.Contains(buf.String(), "└── (其他 2 项)") {
+		t.Fatalf("unexpected output: %s", buf.String())
+	}
+}
@@ -15,7 +15,12 @@ package command
 
 import (
 	"fmt"
-	"github.com/olekukonko/tablewriter"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/tickstep/aliyunpan-api/aliyunpan"
 	"github.com/tickstep/aliyunpan-api/aliyunpan_web"
 	"github.com/tickstep/aliyunpan/cmder"
@@ -24,9 +29,27 @@ import (
 	"github.com/tickstep/library-go/converter"
 	"github.com/tickstep/library-go/logger"
 	"github.com/urfave/cli"
-	"os"
-	"strconv"
-	"time"
+)
+
+const (
+	// recycleRestoreBatchSize 每批还原的文件数量，网盘批量接口每次最多100个请求
+	recycleRestoreBatchSize = 100
+)
+
+type (
+	// recycleIndex 回收站文件索引，用于查找文件还原后所在的原路径，以及父目录是否也在回收站中
+	recycleIndex struct {
+		driveId   string
+		panClient *config.PanClient
+		files     map[string]*aliyunpan.FileEntity // 回收站中的文件，fileId -> 文件
+		dirPath   map[string]string                // 目录路径缓存，fileId -> 路径，空字符串代表目录已经不存在
+	}
+
+	// recycleListItem 回收站文件的JSON输出
+	recycleListItem struct {
+		*aliyunpan.FileEntity
+		OriginPath string `json:"originPath"` // 还原后所在的原路径，原目录已经被彻底删除时为空
+	}
 )
 
 func CmdRecycle() cli.Command {
@@ -38,13 +61,19 @@ func CmdRecycle() cli.Command {
 
 	示例:
 
-	1. 从回收站还原两个文件, 其中的两个文件的 file_id 分别为 1013792297798440 和 643596340463870
+	1. 列出回收站中所有的 mp4 文件, 包括文件还原后所在的原路径
+	aliyunpan recycle list -pattern "*.mp4"
+
+	2. 从回收站还原两个文件到原路径, 其中的两个文件的 file_id 分别为 1013792297798440 和 643596340463870
 	aliyunpan recycle restore 1013792297798440 643596340463870
 
-	2. 从回收站删除两个文件, 其中的两个文件的 file_id 分别为 1013792297798440 和 643596340463870
+	3. 批量还原回收站中所有原来在 /我的文档 目录下的文件, 还原前需要确认
+	aliyunpan recycle restore -pattern "/我的文档/*"
+
+	4. 从回收站删除两个文件, 其中的两个文件的 file_id 分别为 1013792297798440 和 643596340463870
 	aliyunpan recycle delete 1013792297798440 643596340463870
 
-	3. 清空回收站, 程序不会进行二次确认, 谨慎操作!!!
+	5. 清空回收站, 清空前需要确认
 	aliyunpan recycle delete -all
 `,
 		Category: "阿里云盘",
@@ -60,20 +89,24 @@ func CmdRecycle() cli.Command {
 				Name:      "list",
 				Aliases:   []string{"ls", "l"},
 				Usage:     "列出回收站文件列表",
-				UsageText: cmder.App().Name + " recycle list",
+				UsageText: cmder.App().Name + " recycle list [-pattern <匹配模式>]",
 				Action: func(c *cli.Context) error {
-					if config.Config.ActiveUser() == nil {
-						fmt.Println("未登录账号")
+					if GetActiveUser() == nil {
+						printNotLogin()
 						return nil
 					}
-					if config.Config.ActiveUser().PanClient().WebapiPanClient() == nil {
+					if GetActiveUser().PanClient().WebapiPanClient() == nil {
 						fmt.Println("WEB客户端未登录，请登录后再使用该命令")
 						return nil
 					}
-					RunRecycleList(parseDriveId(c))
+					RunRecycleList(parseDriveId(c), c.String("pattern"))
 					return nil
 				},
 				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "pattern",
+						Usage: "只列出匹配的文件, 支持通配符. 包含 / 时匹配文件的原路径, 否则匹配文件名",
+					},
 					cli.StringFlag{
 						Name:  "driveId",
 						Usage: "网盘ID",
@@ -82,28 +115,38 @@ func CmdRecycle() cli.Command {
 				},
 			},
 			{
-				Name:        "restore",
-				Aliases:     []string{"r"},
-				Usage:       "还原回收站文件或目录",
-				UsageText:   cmder.App().Name + " recycle restore <file_id 1> <file_id 2> <file_id 3> ...",
-				Description: `根据文件/目录的 fs_id, 还原回收站指定的文件或目录`,
+				Name:      "restore",
+				Aliases:   []string{"r"},
+				Usage:     "还原回收站文件或目录到原路径",
+				UsageText: cmder.App().Name + " recycle restore [-pattern <匹配模式>] [-y] <file_id 1> <file_id 2> <file_id 3> ...",
+				Description: `根据 file_id 或者匹配模式, 把回收站中的文件或目录还原到原路径.
+	原来所在的目录也在回收站中时, 会先还原该目录. 原来所在的目录已经被彻底删除的文件无法还原.
+	使用匹配模式批量还原前需要确认, 指定 -y 跳过确认.`,
 				Action: func(c *cli.Context) error {
-					if config.Config.ActiveUser() == nil {
-						fmt.Println("未登录账号")
+					if GetActiveUser() == nil {
+						printNotLogin()
 						return nil
 					}
-					if config.Config.ActiveUser().PanClient().WebapiPanClient() == nil {
+					if GetActiveUser().PanClient().WebapiPanClient() == nil {
 						fmt.Println("WEB客户端未登录，请登录后再使用该命令")
 						return nil
 					}
-					if c.NArg() <= 0 {
+					if c.NArg() <= 0 && c.String("pattern") == "" {
 						cli.ShowCommandHelp(c, c.Command.Name)
 						return nil
 					}
-					RunRecycleRestore(parseDriveId(c), c.Args()...)
+					RunRecycleRestore(parseDriveId(c), c.String("pattern"), c.Bool("y"), c.Args()...)
 					return nil
 				},
 				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "pattern",
+						Usage: "还原匹配的文件, 支持通配符. 包含 / 时匹配文件的原路径, 否则匹配文件名",
+					},
+					cli.BoolFlag{
+						Name:  "y",
+						Usage: "跳过确认",
+					},
 					cli.StringFlag{
 						Name:  "driveId",
 						Usage: "网盘ID",
@@ -112,23 +155,24 @@ func CmdRecycle() cli.Command {
 				},
 			},
 			{
-				Name:        "delete",
-				Aliases:     []string{"d"},
-				Usage:       "删除回收站文件或目录 / 清空回收站",
-				UsageText:   cmder.App().Name + " recycle delete [-all] <file_id 1> <file_id 2> <file_id 3> ...",
-				Description: `根据文件/目录的 file_id 或 -all 参数, 删除回收站指定的文件或目录或清空回收站`,
+				Name:      "delete",
+				Aliases:   []string{"d"},
+				Usage:     "删除回收站文件或目录 / 清空回收站",
+				UsageText: cmder.App().Name + " recycle delete [-all] [-y] <file_id 1> <file_id 2> <file_id 3> ...",
+				Description: `根据文件/目录的 file_id 或 -all 参数, 删除回收站指定的文件或目录或清空回收站.
+	清空回收站前需要确认, 指定 -y 跳过确认.`,
 				Action: func(c *cli.Context) error {
-					if config.Config.ActiveUser() == nil {
-						fmt.Println("未登录账号")
+					if GetActiveUser() == nil {
+						printNotLogin()
 						return nil
 					}
-					if config.Config.ActiveUser().PanClient().WebapiPanClient() == nil {
+					if GetActiveUser().PanClient().WebapiPanClient() == nil {
 						fmt.Println("WEB客户端未登录，请登录后再使用该命令")
 						return nil
 					}
 					if c.Bool("all") {
 						// 清空回收站
-						RunRecycleClear(parseDriveId(c))
+						RunRecycleClear(parseDriveId(c), c.Bool("y"))
 						return nil
 					}
 
@@ -142,7 +186,11 @@ func CmdRecycle() cli.Command {
 				Flags: []cli.Flag{
 					cli.BoolFlag{
 						Name:  "all",
-						Usage: "清空回收站, 程序不会进行二次确认, 谨慎操作!!!",
+						Usage: "清空回收站, 清空后文件无法恢复, 谨慎操作!!!",
+					},
+					cli.BoolFlag{
+						Name:  "y",
+						Usage: "跳过确认",
 					},
 					cli.StringFlag{
 						Name:  "driveId",
@@ -155,60 +203,252 @@ func CmdRecycle() cli.Command {
 	}
 }
 
-// RunRecycleList 执行列出回收站文件列表
-func RunRecycleList(driveId string) {
-	panClient := GetActivePanClient()
-	fdl, err := panClient.WebapiPanClient().RecycleBinFileListGetAll(&aliyunpan_web.RecycleBinFileListParam{
+// newRecycleIndex 创建回收站文件索引
+func newRecycleIndex(panClient *config.PanClient, driveId string, files aliyunpan.FileList) *recycleIndex {
+	t := &recycleIndex{
+		driveId:   driveId,
+		panClient: panClient,
+		files:     map[string]*aliyunpan.FileEntity{},
+		dirPath:   map[string]string{},
+	}
+	for _, f := range files {
+		t.files[f.FileId] = f
+	}
+	return t
+}
+
+// folderPath 目录的路径，目录也在回收站中时使用回收站中的目录名拼接。目录已经不存在时返回空字符串
+func (t *recycleIndex) folderPath(fileId string) string {
+	if fileId == "" || fileId == aliyunpan.DefaultRootParentFileId {
+		return "/"
+	}
+	if p, ok := t.dirPath[fileId]; ok {
+		return p
+	}
+	var name, parentId string
+	if f, ok := t.files[fileId]; ok {
+		name, parentId = f.FileName, f.ParentFileId
+	} else {
+		fe, err := t.panClient.OpenapiPanClient().FileInfoById(t.driveId, fileId)
+		if err != nil {
+			logger.Verbosef("查询目录信息失败: %s, %s\n", fileId, err)
+			t.dirPath[fileId] = ""
+			return ""
+		}
+		name, parentId = fe.FileName, fe.ParentFileId
+	}
+	p := ""
+	if parent := t.folderPath(parentId); parent != "" {
+		p = path.Join(parent, name)
+	}
+	t.dirPath[fileId] = p
+	return p
+}
+
+// originPath 文件还原后所在的原路径，原目录已经被彻底删除时返回空字符串
+func (t *recycleIndex) originPath(f *aliyunpan.FileEntity) string {
+	parent := t.folderPath(f.ParentFileId)
+	if parent == "" {
+		return ""
+	}
+	return path.Join(parent, f.FileName)
+}
+
+// trashedAncestors 同样在回收站中的上级目录，按从上到下的顺序排列
+func (t *recycleIndex) trashedAncestors(f *aliyunpan.FileEntity) aliyunpan.FileList {
+	ancestors := aliyunpan.FileList{}
+	for parent, ok := t.files[f.ParentFileId]; ok; parent, ok = t.files[parent.ParentFileId] {
+		ancestors = append(aliyunpan.FileList{parent}, ancestors...)
+	}
+	return ancestors
+}
+
+// match 文件是否匹配模式，模式包含 / 时匹配原路径，否则匹配文件名
+func (t *recycleIndex) match(f *aliyunpan.FileEntity, pattern string) bool {
+	if pattern == "" {
+		return true
+	}
+	name := f.FileName
+	if strings.Contains(pattern, "/") {
+		name = t.originPath(f)
+	}
+	matched, _ := path.Match(pattern, name)
+	return matched
+}
+
+// restoreBatches 需要还原的文件按层级分批，上级目录也在回收站中时先还原上级目录，保证文件还原到原路径
+func (t *recycleIndex) restoreBatches(selected aliyunpan.FileList) []aliyunpan.FileList {
+	levels := []aliyunpan.FileList{}
+	added := map[string]bool{}
+	for _, f := range selected {
+		for depth, item := range append(t.trashedAncestors(f), f) {
+			if added[item.FileId] {
+				continue
+			}
+			added[item.FileId] = true
+			for len(levels) <= depth {
+				levels = append(levels, aliyunpan.FileList{})
+			}
+			levels[depth] = append(levels[depth], item)
+		}
+	}
+	return levels
+}
+
+// listRecycleFiles 获取回收站中所有的文件
+func listRecycleFiles(driveId string) (aliyunpan.FileList, error) {
+	files, err := GetActivePanClient().WebapiPanClient().RecycleBinFileListGetAll(&aliyunpan_web.RecycleBinFileListParam{
 		DriveId: driveId,
 		Limit:   100,
 	})
 	if err != nil {
-		fmt.Println(err)
+		return nil, err
+	}
+	return files, nil
+}
+
+// RunRecycleList 列出回收站文件，包括还原后所在的原路径
+func RunRecycleList(driveId, pattern string) {
+	files, err := listRecycleFiles(driveId)
+	if err != nil {
+		fmt.Printf("获取回收站文件列表失败: %s\n", err)
+		setJsonErr(err)
 		return
 	}
+	index := newRecycleIndex(GetActivePanClient(), driveId, files)
+	items := []*recycleListItem{}
+	for _, f := range files {
+		if index.match(f, pattern) {
+			items = append(items, &recycleListItem{FileEntity: f, OriginPath: index.originPath(f)})
+		}
+	}
+	setJsonData(items)
 
 	tb := cmdtable.NewTable(os.Stdout)
-	tb.SetHeader([]string{"#", "file_id", "文件/目录名", "文件大小", "创建日期", "修改日期"})
-	tb.SetColumnAlignment([]int{tablewriter.ALIGN_DEFAULT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT})
-	for k, file := range fdl {
-		fn := file.FileName
-		fs := converter.ConvertFileSize(file.FileSize, 2)
-		if file.IsFolder() {
+	tb.SetHeader([]string{"#", "file_id", "文件/目录名", "文件大小", "原路径", "修改日期"})
+	var totalSize int64
+	for k, item := range items {
+		fn := item.FileName
+		fs := converter.ConvertFileSize(item.FileSize, 2)
+		if item.IsFolder() {
 			fn = fn + "/"
 			fs = "-"
+		} else {
+			totalSize += item.FileSize
+		}
+		originPath := item.OriginPath
+		if originPath == "" {
+			originPath = "(原目录已不存在)"
 		}
-		tb.Append([]string{strconv.Itoa(k + 1), file.FileId, fn, fs, file.CreatedAt, file.UpdatedAt})
+		tb.Append([]string{strconv.Itoa(k + 1), item.FileId, fn, fs, originPath, item.UpdatedAt})
 	}
-
 	tb.Render()
+	fmt.Printf("共 %d 个文件/目录, 文件总大小: %s\n", len(items), converter.ConvertFileSize(totalSize, 2))
 }
 
-// RunRecycleRestore 执行还原回收站文件或目录
-func RunRecycleRestore(driveId string, fidStrList ...string) {
-	panClient := GetActivePanClient()
-	restoreFileList := []*aliyunpan.FileBatchActionParam{}
+// RunRecycleRestore 还原回收站文件到原路径，fileIds 和 pattern 选中的文件都会还原
+func RunRecycleRestore(driveId, pattern string, skipConfirm bool, fileIds ...string) {
+	files, err := listRecycleFiles(driveId)
+	if err != nil {
+		fmt.Printf("获取回收站文件列表失败: %s\n", err)
+		setJsonErr(err)
+		return
+	}
+	index := newRecycleIndex(GetActivePanClient(), driveId, files)
 
-	for _, fid := range fidStrList {
-		restoreFileList = append(restoreFileList, &aliyunpan.FileBatchActionParam{
-			DriveId: driveId,
-			FileId:  fid,
-		})
+	selected := aliyunpan.FileList{}
+	for _, fid := range fileIds {
+		f, ok := index.files[fid]
+		if !ok {
+			fmt.Printf("回收站中没有该文件: %s\n", fid)
+			continue
+		}
+		selected = append(selected, f)
+	}
+	if pattern != "" {
+		for _, f := range files {
+			if index.match(f, pattern) {
+				selected = append(selected, f)
+			}
+		}
 	}
 
-	if len(restoreFileList) == 0 {
-		fmt.Printf("没有需要还原的文件")
+	// 原目录已经被彻底删除的文件无法还原
+	restorable := aliyunpan.FileList{}
+	for _, f := range selected {
+		if index.originPath(f) == "" {
+			fmt.Printf("原目录已不存在, 无法还原: %s\n", f.FileName)
+			continue
+		}
+		restorable = append(restorable, f)
+	}
+	batches := index.restoreBatches(restorable)
+	if len(batches) == 0 {
+		fmt.Println("没有需要还原的文件")
 		return
 	}
 
-	rbfr, err := panClient.WebapiPanClient().RecycleBinFileRestore(restoreFileList)
-	if rbfr != nil && len(rbfr) > 0 {
-		fmt.Printf("还原文件成功\n")
-		return
+	if pattern != "" && !skipConfirm {
+		fmt.Printf("以下文件将还原到原路径\n\n")
+		idx := 1
+		for _, level := range batches {
+			for _, f := range level {
+				fmt.Printf("%d) %s\n", idx, index.originPath(f))
+				idx++
+			}
+		}
+		if !confirmTrashAction("\n是否还原以上文件(y/n): ") {
+			return
+		}
 	}
 
-	if len(rbfr) == 0 && err != nil {
-		fmt.Printf("还原文件失败：%s\n", err)
-		return
+	activeUser := GetActiveUser()
+	succeed, failed := 0, []string{}
+	for _, level := range batches {
+		// 检查原路径是否已经有同名文件，只检查最上层的文件，下级文件会还原到刚刚还原的目录中
+		for _, f := range level {
+			if _, ok := index.files[f.ParentFileId]; ok {
+				continue
+			}
+			if fe, _ := activeUser.PanClient().OpenapiPanClient().FileInfoByPath(driveId, index.originPath(f)); fe != nil {
+				fmt.Printf("警告: 原路径已存在同名文件或目录: %s\n", index.originPath(f))
+			}
+		}
+		for start := 0; start < len(level); start += recycleRestoreBatchSize {
+			end := start + recycleRestoreBatchSize
+			if end > len(level) {
+				end = len(level)
+			}
+			params := []*aliyunpan.FileBatchActionParam{}
+			for _, f := range level[start:end] {
+				params = append(params, &aliyunpan.FileBatchActionParam{DriveId: driveId, FileId: f.FileId})
+			}
+			results, er := activeUser.PanClient().WebapiPanClient().RecycleBinFileRestore(params)
+			if er != nil {
+				logger.Verbosef("还原文件失败: %s\n", er)
+			}
+			ok := map[string]bool{}
+			for _, r := range results {
+				if r != nil && r.Success {
+					ok[r.FileId] = true
+				}
+			}
+			for _, f := range level[start:end] {
+				originPath := index.originPath(f)
+				if ok[f.FileId] {
+					succeed++
+					fmt.Printf("还原成功: %s\n", originPath)
+					activeUser.DeleteOneCache(path.Dir(originPath))
+				} else {
+					failed = append(failed, originPath)
+					fmt.Printf("还原失败: %s\n", originPath)
+				}
+			}
+		}
+	}
+	fmt.Printf("\n还原完成, 成功 %d 个, 失败 %d 个\n", succeed, len(failed))
+	if len(failed) > 0 {
+		setJsonError(JsonCodePartialFailed, fmt.Sprintf("%d 个文件还原失败", len(failed)))
 	}
 }
 
@@ -241,8 +481,11 @@ func RunRecycleDelete(driveId string, fidStrList ...string) {
 	}
 }
 
-// RunRecycleClear 清空回收站
-func RunRecycleClear(driveId string) {
+// RunRecycleClear 清空回收站，skipConfirm 为 false 时需要用户确认
+func RunRecycleClear(driveId string, skipConfirm bool) {
+	if !skipConfirm && !confirmTrashAction("确认清空回收站? 清空后文件无法恢复 (y/n): ") {
+		return
+	}
 	panClient := GetActivePanClient()
 
 	// 提交清空回收站异步任务
@@ -252,6 +495,7 @@ func RunRecycleClear(driveId string) {
 	if err != nil {
 		logger.Verboseln(err)
 		fmt.Printf("当前无法清空回收站，请稍后重试\n")
+		return
 	}
 
 	for i := 0; i < 10; i++ {
@@ -272,3 +516,18 @@ func RunRecycleClear(driveId string) {
 	}
 	fmt.Printf("清空回收站失败，请稍后重试\n")
 }
+
+// confirmTrashAction 等待用户确认，输入 y 以外的内容都视为取消
+func confirmTrashAction(prompt string) bool {
+	if jsonDeclineInput() {
+		return false
+	}
+	fmt.Print(prompt)
+	confirm := ""
+	if _, err := fmt.Scanln(&confirm); err != nil || (confirm != "y" && confirm != "Y") {
+		fmt.Println("用户取消了操作")
+		setJsonError(JsonCodeCanceled, "用户取消了操作")
+		return false
+	}
+	return true
+}
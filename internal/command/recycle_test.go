@@ -0,0 +1,77 @@
+package command
+
+import (
+	"os"
+	"testing"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+)
+
+func TestRecycleRestoreBatches(t *testing.T) {
+	// docs 目录和其中的 a.txt 先后被删除，b.txt 在根目录
+	docs := &aliyunpan.FileEntity{FileId: "1", FileName: "docs", FileType: "folder", ParentFileId: aliyunpan.DefaultRootParentFileId}
+	a := &aliyunpan.FileEntity{FileId: "2", FileName: "a.txt", FileType: "file", ParentFileId: "1"}
+	b := &aliyunpan.FileEntity{FileId: "3", FileName: "b.txt", FileType: "file", ParentFileId: aliyunpan.DefaultRootParentFileId}
+	index := newRecycleIndex(nil, "", aliyunpan.FileList{docs, a, b})
+
+	if p := index.originPath(a); p != "/docs/a.txt" {
+		t.Errorf("unexpected origin path: %s", p)
+	}
+	if !index.match(a, "/docs/*") || index.match(b, "/docs/*") || !index.match(b, "*.txt") {
+		t.Error("unexpected pattern match result")
+	}
+
+	batches := index.restoreBatches(aliyunpan.FileList{a, b, docs})
+	if len(batches) != 2 || len(batches[0]) != 2 || len(batches[1]) != 1 || batches[1][0] != a {
+		t.Fatalf("unexpected batches: %v", batches)
+	}
+	if batches[0][0] != docs || batches[0][1] != b {
+		t.Errorf("trashed parent folder should be restored first: %v", batches[0])
+	}
+}
+
+// withStdin 使用指定的输入内容执行函数
+func withStdin(t *testing.T, input string, f func()) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.WriteString(input)
+	w.Close()
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() {
+		os.Stdin = stdin
+		r.Close()
+	}()
+	f()
+}
+
+func TestConfirmTrashAction(t *testing.T) {
+	cases := []struct {
+		input string
+		want  bool
+	}{
+		{"y\n", true},
+		{"Y\n", true},
+		{"n\n", false},
+		{"yes\n", false},
+		{"", false},
+	}
+	for _, c := range cases {
+		withStdin(t, c.input, func() {
+			if got := confirmTrashAction(""); got != c.want {
+				t.Errorf("input %q: got %v, want %v", c.input, got, c.want)
+			}
+		})
+	}
+}
+
+func TestRecycleClearNeedConfirm(t *testing.T) {
+	// 没有确认时直接返回，不会访问网盘(测试中没有登录账号，访问网盘会出错)
+	for _, input := range []string{"n\n", ""} {
+		withStdin(t, input, func() {
+			RunRecycleClear("d1", false)
+		})
+	}
+}
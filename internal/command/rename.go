@@ -88,8 +88,8 @@ func CmdRename() cli.Command {
 				cli.ShowCommandHelp(c, c.Command.Name)
 				return nil
 			}
-			if config.Config.ActiveUser() == nil {
-				fmt.Println("未登录账号")
+			if GetActiveUser() == nil {
+				printNotLogin()
 				return nil
 			}
 			if c.NArg() == 2 {
@@ -117,10 +117,12 @@ func CmdRename() cli.Command {
 func RunRename(driveId string, oldName string, newName string) {
 	if oldName == "" {
 		fmt.Println("请指定命名文件")
+		setJsonError(JsonCodeBadArgs, "请指定命名文件")
 		return
 	}
 	if newName == "" {
 		fmt.Println("请指定文件新名称")
+		setJsonError(JsonCodeBadArgs, "请指定文件新名称")
 		return
 	}
 	activeUser := GetActiveUser()
@@ -128,10 +130,12 @@ func RunRename(driveId string, oldName string, newName string) {
 	newName = activeUser.PathJoin(driveId, strings.TrimSpace(newName))
 	if path.Dir(oldName) != path.Dir(newName) {
 		fmt.Println("只能命名同一个目录的文件")
+		setJsonError(JsonCodeBadArgs, "只能命名同一个目录的文件")
 		return
 	}
 	if !apiutil.CheckFileNameValid(path.Base(newName)) {
 		fmt.Println("文件名不能包含特殊字符：" + apiutil.FileNameSpecialChars)
+		setJsonError(JsonCodeBadArgs, "文件名不能包含特殊字符："+apiutil.FileNameSpecialChars)
 		return
 	}
 
@@ -139,6 +143,7 @@ func RunRename(driveId string, oldName string, newName string) {
 	r, err := GetActivePanClient().OpenapiPanClient().FileInfoByPath(driveId, activeUser.PathJoin(driveId, oldName))
 	if err != nil {
 		fmt.Printf("原文件不存在： %s, %s\n", oldName, err)
+		setJsonErr(err)
 		return
 	}
 	fileId = r.FileId
@@ -146,13 +151,16 @@ func RunRename(driveId string, oldName string, newName string) {
 	b, e := activeUser.PanClient().OpenapiPanClient().FileRename(driveId, fileId, path.Base(newName))
 	if e != nil {
 		fmt.Println(e.Err)
+		setJsonErr(e)
 		return
 	}
 	if !b {
 		fmt.Println("重命名文件失败")
+		setJsonError(JsonCodeFailed, "重命名文件失败")
 		return
 	}
 	fmt.Printf("重命名文件成功：%s -> %s\n", path.Base(oldName), path.Base(newName))
+	config.GetFolderIdCache().Invalidate(driveId, oldName)
 	activeUser.DeleteOneCache(path.Dir(newName))
 }
 
@@ -160,23 +168,28 @@ func RunRename(driveId string, oldName string, newName string) {
 func RunRenameBatch(skipConfirm bool, driveId string, expression, replacement, filePattern string) {
 	if len(expression) == 0 {
 		fmt.Println("旧文件名不能为空")
+		setJsonError(JsonCodeBadArgs, "旧文件名不能为空")
 		return
 	}
 	if !apiutil.CheckFileNameValid(replacement) {
 		fmt.Println("新文件名不能包含特殊字符：" + apiutil.FileNameSpecialChars)
+		setJsonError(JsonCodeBadArgs, "新文件名不能包含特殊字符："+apiutil.FileNameSpecialChars)
 		return
 	}
 
 	if len(filePattern) == 0 {
 		fmt.Println("文件匹配模式不能为空")
+		setJsonError(JsonCodeBadArgs, "文件匹配模式不能为空")
 		return
 	}
 	if strings.ContainsAny(filePattern, "/") {
 		fmt.Println("文件匹配模式不能包含路径分隔符")
+		setJsonError(JsonCodeBadArgs, "文件匹配模式不能包含路径分隔符")
 		return
 	}
 	if strings.ContainsAny(filePattern, "\\") {
 		fmt.Println("文件匹配模式不能包含路径分隔符")
+		setJsonError(JsonCodeBadArgs, "文件匹配模式不能包含路径分隔符")
 		return
 	}
 
@@ -185,10 +198,12 @@ func RunRenameBatch(skipConfirm bool, driveId string, expression, replacement, f
 	fileList, err1 := matchPathByShellPattern(driveId, absolutePath)
 	if err1 != nil {
 		fmt.Println("查询文件出错：" + err1.Error())
+		setJsonErr(err1)
 		return
 	}
 	if fileList == nil || len(fileList) == 0 {
 		fmt.Println("没有找到符合的文件")
+		setJsonError(JsonCodeBadArgs, "没有找到符合的文件")
 		return
 	}
 
@@ -217,6 +232,9 @@ func RunRenameBatch(skipConfirm bool, driveId string, expression, replacement, f
 
 	// 确认
 	if !skipConfirm {
+		if jsonDeclineInput() {
+			return
+		}
 		fmt.Printf("以下文件将进行对应的重命名\n\n")
 		idx := 1
 		for _, file := range files {
@@ -228,6 +246,7 @@ func RunRenameBatch(skipConfirm bool, driveId string, expression, replacement, f
 		_, err := fmt.Scanln(&confirm)
 		if err != nil || (confirm != "y" && confirm != "Y") {
 			fmt.Println("用户取消了操作")
+			setJsonError(JsonCodeCanceled, "用户取消了操作")
 			return
 		}
 	}
@@ -237,13 +256,16 @@ func RunRenameBatch(skipConfirm bool, driveId string, expression, replacement, f
 		b, e := activeUser.PanClient().OpenapiPanClient().FileRename(driveId, file.file.FileId, file.newFileName)
 		if e != nil {
 			fmt.Println(e.Err)
+			setJsonErr(e)
 			return
 		}
 		if !b {
 			fmt.Println("重命名文件失败")
+			setJsonError(JsonCodeFailed, "重命名文件失败: "+file.file.Path)
 			return
 		}
 		fmt.Printf("重命名文件成功：%s -> %s\n", file.file.FileName, file.newFileName)
+		config.GetFolderIdCache().Invalidate(driveId, file.file.Path)
 		activeUser.DeleteOneCache(path.Dir(file.file.Path))
 	}
 }
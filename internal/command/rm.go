@@ -49,6 +49,9 @@ func CmdRm() cli.Command {
 
 	删除 /我的资源 目录下面的所有.zip文件，使用通配符匹配
 	aliyunpan rm /我的资源/*.zip
+
+	删除包含大量文件的 /备份 目录，等待服务端删除完成并显示进度，中断后重新执行可以继续删除
+	aliyunpan rm --batch /备份
 `,
 		Category: "阿里云盘",
 		Before:   ReloadConfigFunc,
@@ -57,11 +60,15 @@ func CmdRm() cli.Command {
 				cli.ShowCommandHelp(c, c.Command.Name)
 				return nil
 			}
-			if config.Config.ActiveUser() == nil {
-				fmt.Println("未登录账号")
+			if GetActiveUser() == nil {
+				printNotLogin()
 				return nil
 			}
-			RunRemove(parseDriveId(c), c.Args()...)
+			RunRemove(parseDriveId(c), &RemoveOptions{
+				Batch:     c.Bool("batch"),
+				BatchSize: c.Int("batch-size"),
+				MaxRetry:  c.Int("retry"),
+			}, c.Args()...)
 			return nil
 		},
 		Flags: []cli.Flag{
@@ -70,19 +77,45 @@ func CmdRm() cli.Command {
 				Usage: "网盘ID",
 				Value: "",
 			},
+			cli.BoolFlag{
+				Name:  "batch",
+				Usage: "分批删除目录，通过异步任务查询接口等待服务端删除完成并显示进度，适合包含大量文件的目录。按 Ctrl+C 中断后重新执行可以继续删除",
+			},
+			cli.IntFlag{
+				Name:  "batch-size",
+				Usage: "配合 --batch 使用，每批删除的目录数量（取值范围:1 ~ 100）",
+				Value: DefaultRemoveBatchSize,
+			},
+			cli.IntFlag{
+				Name:  "retry",
+				Usage: "配合 --batch 使用，删除失败的目录最大重试次数",
+				Value: DefaultRemoveBatchRetry,
+			},
 		},
 	}
 }
 
+// RemoveOptions 删除可选项
+type RemoveOptions struct {
+	Batch     bool // 分批删除目录
+	BatchSize int  // 每批删除的文件数量
+	MaxRetry  int  // 删除失败的文件最大重试次数
+}
+
 // RunRemove 执行 批量删除文件/目录
-func RunRemove(driveId string, paths ...string) {
+func RunRemove(driveId string, opt *RemoveOptions, paths ...string) {
 	activeUser := GetActiveUser()
+	if opt == nil {
+		opt = &RemoveOptions{}
+	}
+	batchCtx := newRemoveBatchContext(driveId, opt.BatchSize, opt.MaxRetry, activeUser.PanClient())
 	pluginManger := plugins.NewPluginManager(config.GetPluginDir())
 	plugin, _ := pluginManger.GetPlugin()
 
 	cacheCleanDirs := []string{}
 	failedRmPaths := make([]string, 0, len(paths))
 	successDelFileEntity := []*aliyunpan.FileEntity{}
+	batchFolders := []*aliyunpan.FileEntity{}
 
 	for _, p := range paths {
 		absolutePath := path.Clean(activeUser.PathJoin(driveId, p))
@@ -114,7 +147,7 @@ func RunRemove(driveId string, paths ...string) {
 				DriveFileCreatedAt: f.CreatedAt,
 			})
 		}
-		if removeFilePrepareResult, er := plugin.RemoveFilePrepareCallback(plugins.GetContext(config.Config.ActiveUser()), pluginParam); er == nil && removeFilePrepareResult != nil {
+		if removeFilePrepareResult, er := plugin.RemoveFilePrepareCallback(plugins.GetContext(GetActiveUser()), pluginParam); er == nil && removeFilePrepareResult != nil {
 			for _, f := range fileList {
 				matchResult := false
 				for _, r := range removeFilePrepareResult.Result {
@@ -139,21 +172,56 @@ func RunRemove(driveId string, paths ...string) {
 			approvedToRemoveFiles = fileList
 		}
 
+		removeFiles := make([]*aliyunpan.FileEntity, 0, len(approvedToRemoveFiles))
 		for _, f := range approvedToRemoveFiles {
-			// 删除匹配的文件
-			fdr, err := activeUser.PanClient().OpenapiPanClient().FileDelete(&aliyunpan.FileBatchActionParam{
-				DriveId: driveId,
-				FileId:  f.FileId,
-			})
-			if err != nil || !fdr.Success {
-				failedRmPaths = append(failedRmPaths, absolutePath)
+			if opt.Batch && f.IsFolder() {
+				// 目录最后统一分批删除，等待服务端完成
+				batchFolders = append(batchFolders, f)
+				continue
+			}
+			removeFiles = append(removeFiles, f)
+		}
+		// 使用批量接口删除匹配的文件
+		failedFiles := map[string]bool{}
+		for _, f := range batchCtx.removeFiles(removeFiles) {
+			failedFiles[f.FileId] = true
+		}
+		for _, f := range removeFiles {
+			if failedFiles[f.FileId] {
+				failedRmPaths = append(failedRmPaths, f.Path)
 			} else {
 				successDelFileEntity = append(successDelFileEntity, f)
+				config.GetFolderIdCache().Invalidate(driveId, f.Path)
 			}
 			cacheCleanDirs = append(cacheCleanDirs, path.Dir(f.Path))
 		}
 	}
 
+	if len(batchFolders) > 0 {
+		failedFolders := map[string]bool{}
+		for _, f := range batchCtx.removeFolders(batchFolders) {
+			failedFolders[f.FileId] = true
+		}
+		for _, f := range batchFolders {
+			if failedFolders[f.FileId] {
+				failedRmPaths = append(failedRmPaths, f.Path)
+			} else {
+				successDelFileEntity = append(successDelFileEntity, f)
+				config.GetFolderIdCache().Invalidate(driveId, f.Path)
+			}
+			cacheCleanDirs = append(cacheCleanDirs, path.Dir(f.Path), f.Path)
+		}
+	}
+
+	deletedPaths := make([]string, 0, len(successDelFileEntity))
+	for _, f := range successDelFileEntity {
+		deletedPaths = append(deletedPaths, f.Path)
+	}
+	setAuditDetail("已删除: %s", strings.Join(deletedPaths, ", "))
+	if len(failedRmPaths) > 0 {
+		setJsonError(JsonCodePartialFailed, "删除失败: "+strings.Join(failedRmPaths, ", "))
+	}
+
 	// output
 	if len(failedRmPaths) > 0 {
 		fmt.Println("以下文件删除失败：")
@@ -174,6 +242,7 @@ func RunRemove(driveId string, paths ...string) {
 		fmt.Println("操作成功, 以下文件/目录已删除, 可在云盘文件回收站找回: ")
 		pnt()
 		activeUser.DeleteCache(cacheCleanDirs)
+		setJsonSuccess()
 	} else {
 		fmt.Println("本次操作没有删除任何文件")
 	}
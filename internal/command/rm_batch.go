@@ -0,0 +1,289 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan-api/aliyunpan_web"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/library-go/logger"
+)
+
+const (
+	// DefaultRemoveBatchSize 分批删除默认每批的文件数量，网盘批量接口每次最多100个请求
+	DefaultRemoveBatchSize = 100
+	// DefaultRemoveBatchRetry 分批删除失败的文件默认重试次数
+	DefaultRemoveBatchRetry = 3
+
+	// removeAsyncTaskPollInterval 查询服务端异步删除任务状态的间隔
+	removeAsyncTaskPollInterval = 2 * time.Second
+)
+
+type (
+	// removeTrashResult 移入回收站的结果
+	removeTrashResult struct {
+		file        *aliyunpan.FileEntity
+		asyncTaskId string // 不为空时服务端正在异步删除，需要查询任务状态等待完成
+		err         error
+	}
+
+	// removeBatchContext 分批删除的上下文。
+	// 目录整个移入回收站，包含大量文件的目录由服务端异步删除，通过异步任务查询接口等待服务端完成。
+	// 中断后重新执行相同的命令，已经删除的文件和目录在回收站中，不会再被匹配到，即可继续删除剩余的部分
+	removeBatchContext struct {
+		driveId   string
+		batchSize int
+		maxRetry  int
+		panClient *config.PanClient
+
+		// trash 把一批文件移入回收站，queryTask 查询异步任务状态，默认调用网盘接口
+		trash        func(items []*aliyunpan.FileEntity) []*removeTrashResult
+		queryTask    func(asyncTaskId string) (*aliyunpan_web.AsyncTaskQueryStatusResult, error)
+		pollInterval time.Duration
+		retryDelay   time.Duration
+
+		deleted     int
+		interrupted int32
+	}
+)
+
+// newRemoveBatchContext 创建分批删除上下文
+func newRemoveBatchContext(driveId string, batchSize, maxRetry int, panClient *config.PanClient) *removeBatchContext {
+	if batchSize <= 0 || batchSize > DefaultRemoveBatchSize {
+		batchSize = DefaultRemoveBatchSize
+	}
+	if maxRetry < 0 {
+		maxRetry = DefaultRemoveBatchRetry
+	}
+	ctx := &removeBatchContext{
+		driveId:      driveId,
+		batchSize:    batchSize,
+		maxRetry:     maxRetry,
+		panClient:    panClient,
+		pollInterval: removeAsyncTaskPollInterval,
+		retryDelay:   time.Second,
+	}
+	ctx.trash = ctx.trashByApi
+	ctx.queryTask = ctx.queryTaskByApi
+	return ctx
+}
+
+// removeFolders 分批把目录移入回收站，并等待服务端异步删除完成，返回删除失败的目录。
+// 按 Ctrl+C 会在当前批次提交后停止，已经提交的目录由服务端在后台继续删除
+func (ctx *removeBatchContext) removeFolders(folders []*aliyunpan.FileEntity) (failed []*aliyunpan.FileEntity) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt)
+	go func() {
+		if _, ok := <-sigChan; ok {
+			atomic.StoreInt32(&ctx.interrupted, 1)
+		}
+	}()
+	defer func() {
+		signal.Stop(sigChan)
+		close(sigChan)
+	}()
+
+	ctx.deleted = 0
+	fmt.Printf("开始分批删除目录 %d 个, 每批 %d 个, 按 Ctrl+C 中断\n", len(folders), ctx.batchSize)
+	for start := 0; start < len(folders); start += ctx.batchSize {
+		end := start + ctx.batchSize
+		if end > len(folders) {
+			end = len(folders)
+		}
+		if ctx.isInterrupted() {
+			fmt.Printf("\n已中断, 已删除 %d/%d, 重新执行相同的命令可以继续删除剩余的目录\n", ctx.deleted, len(folders))
+			return append(failed, folders[start:]...)
+		}
+		batchFailed := ctx.removeAndWait(folders[start:end])
+		ctx.deleted += end - start - len(batchFailed)
+		failed = append(failed, batchFailed...)
+		fmt.Printf("\r删除进度: %d/%d, 失败 %d\n", ctx.deleted, len(folders), len(failed))
+	}
+	return
+}
+
+func (ctx *removeBatchContext) isInterrupted() bool {
+	return atomic.LoadInt32(&ctx.interrupted) == 1
+}
+
+// removeAndWait 把一批文件移入回收站并等待服务端的异步任务完成，提交失败或者异步任务失败的文件重试，返回最终删除失败的文件
+func (ctx *removeBatchContext) removeAndWait(items []*aliyunpan.FileEntity) []*aliyunpan.FileEntity {
+	pending := items
+	for retry := 0; len(pending) > 0; retry++ {
+		if retry > 0 {
+			if retry > ctx.maxRetry || ctx.isInterrupted() {
+				break
+			}
+			logger.Verbosef("retry remove %d files, retry %d/%d\n", len(pending), retry, ctx.maxRetry)
+			time.Sleep(time.Duration(retry) * ctx.retryDelay)
+		}
+		tasks := []*removeTrashResult{}
+		failed := []*aliyunpan.FileEntity{}
+		for _, r := range ctx.trash(pending) {
+			switch {
+			case r.err != nil:
+				logger.Verbosef("remove file error: %s, %s\n", r.file.Path, r.err)
+				failed = append(failed, r.file)
+			case r.asyncTaskId != "":
+				tasks = append(tasks, r)
+			}
+		}
+		pending = append(failed, ctx.waitTasks(tasks)...)
+	}
+	return pending
+}
+
+// waitTasks 等待服务端异步删除任务完成并显示进度，返回异步任务失败的文件。
+// 中断时不再等待，服务端会在后台继续删除
+func (ctx *removeBatchContext) waitTasks(tasks []*removeTrashResult) (failed []*aliyunpan.FileEntity) {
+	for len(tasks) > 0 {
+		running := []*removeTrashResult{}
+		consumed, total := 0, 0
+		for _, task := range tasks {
+			status, err := ctx.queryTask(task.asyncTaskId)
+			if err != nil {
+				// 查询失败时继续等待，下次再查询
+				logger.Verbosef("query async task error: %s, %s\n", task.asyncTaskId, err)
+				running = append(running, task)
+				continue
+			}
+			switch status.State {
+			case "Succeed":
+			case "Failed":
+				logger.Verbosef("async task failed: %s, %s\n", task.asyncTaskId, task.file.Path)
+				failed = append(failed, task.file)
+			default:
+				running = append(running, task)
+				consumed += status.ConsumedProcess
+				total += status.TotalProcess
+			}
+		}
+		tasks = running
+		if len(tasks) == 0 {
+			break
+		}
+		if ctx.isInterrupted() {
+			fmt.Printf("\n已中断等待, 服务端会在后台继续删除 %d 个目录\n", len(tasks))
+			break
+		}
+		fmt.Printf("\r服务端正在删除 %d 个目录, 已处理 %d/%d", len(tasks), consumed, total)
+		time.Sleep(ctx.pollInterval)
+	}
+	return
+}
+
+// removeFiles 按批次删除文件到回收站，不重试，返回删除失败的文件
+func (ctx *removeBatchContext) removeFiles(items []*aliyunpan.FileEntity) (failed []*aliyunpan.FileEntity) {
+	for start := 0; start < len(items); start += ctx.batchSize {
+		end := start + ctx.batchSize
+		if end > len(items) {
+			end = len(items)
+		}
+		failed = append(failed, ctx.removeBatch(items[start:end])...)
+	}
+	return
+}
+
+// removeBatchWithRetry 删除一批文件，失败的文件重试，返回最终删除失败的文件
+func (ctx *removeBatchContext) removeBatchWithRetry(items []*aliyunpan.FileEntity) []*aliyunpan.FileEntity {
+	failed := ctx.removeBatch(items)
+	for retry := 1; retry <= ctx.maxRetry && len(failed) > 0 && !ctx.isInterrupted(); retry++ {
+		logger.Verbosef("retry remove %d files, retry %d/%d\n", len(failed), retry, ctx.maxRetry)
+		time.Sleep(time.Duration(retry) * ctx.retryDelay)
+		failed = ctx.removeBatch(failed)
+	}
+	return failed
+}
+
+// removeBatch 删除一批文件到回收站，不等待服务端的异步任务完成，返回提交失败的文件
+func (ctx *removeBatchContext) removeBatch(items []*aliyunpan.FileEntity) (failed []*aliyunpan.FileEntity) {
+	for _, r := range ctx.trash(items) {
+		if r.err != nil {
+			logger.Verbosef("delete file error: %s, %s\n", r.file.Path, r.err)
+			failed = append(failed, r.file)
+		}
+	}
+	return
+}
+
+// trashByApi 把一批文件移入回收站。登录了Web接口时使用批量回收接口，返回服务端的异步任务ID；否则逐个删除
+func (ctx *removeBatchContext) trashByApi(items []*aliyunpan.FileEntity) []*removeTrashResult {
+	results := make([]*removeTrashResult, 0, len(items))
+	webClient := ctx.panClient.WebapiPanClient()
+	if webClient == nil {
+		for _, f := range items {
+			r := &removeTrashResult{file: f}
+			fdr, err := ctx.panClient.OpenapiPanClient().FileDelete(&aliyunpan.FileBatchActionParam{
+				DriveId: ctx.driveId,
+				FileId:  f.FileId,
+			})
+			if err != nil {
+				r.err = err
+			} else if fdr == nil || !fdr.Success {
+				r.err = fmt.Errorf("删除失败")
+			}
+			results = append(results, r)
+		}
+		return results
+	}
+
+	requests := make(aliyunpan_web.BatchRequestList, 0, len(items))
+	for _, f := range items {
+		requests = append(requests, &aliyunpan_web.BatchRequest{
+			Id:      f.FileId,
+			Method:  "POST",
+			Url:     "/recyclebin/trash",
+			Headers: map[string]string{"Content-Type": "application/json"},
+			Body: map[string]interface{}{
+				"drive_id": ctx.driveId,
+				"file_id":  f.FileId,
+			},
+		})
+	}
+	batchResult, apierr := webClient.BatchTask(aliyunpan_web.API_URL+"/adrive/v4/batch", &aliyunpan_web.BatchRequestParam{
+		Requests: requests,
+		Resource: "file",
+	})
+	responses := map[string]*aliyunpan_web.BatchResponse{}
+	if apierr == nil {
+		for _, resp := range batchResult.Responses {
+			if resp != nil {
+				responses[resp.Id] = resp
+			}
+		}
+	}
+	for _, f := range items {
+		r := &removeTrashResult{file: f}
+		resp := responses[f.FileId]
+		switch {
+		case apierr != nil:
+			r.err = apierr
+		case resp == nil:
+			r.err = fmt.Errorf("没有返回删除结果")
+		case resp.Status == 202:
+			// 目录由服务端异步删除
+			r.asyncTaskId, _ = resp.Body["async_task_id"].(string)
+		case resp.Status != 200 && resp.Status != 204:
+			r.err = fmt.Errorf("删除失败, 状态码: %d", resp.Status)
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// queryTaskByApi 查询服务端异步任务的状态
+func (ctx *removeBatchContext) queryTaskByApi(asyncTaskId string) (*aliyunpan_web.AsyncTaskQueryStatusResult, error) {
+	webClient := ctx.panClient.WebapiPanClient()
+	if webClient == nil {
+		return nil, fmt.Errorf("WEB客户端未登录")
+	}
+	r, apierr := webClient.AsyncTaskQueryStatus(&aliyunpan_web.AsyncTaskQueryStatusParam{AsyncTaskId: asyncTaskId})
+	if apierr != nil {
+		return nil, apierr
+	}
+	return r, nil
+}
@@ -1,8 +1,14 @@
 package command
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
+	"sync/atomic"
 	"testing"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan-api/aliyunpan_web"
 )
 
 func TestWildcard(t *testing.T) {
@@ -23,3 +29,173 @@ func TestWildcard(t *testing.T) {
 	fmt.Println(isIncludeFile("a*b/ab[0-9].txt", "acb/ab0.txt"))
 	fmt.Println(isIncludeFile("aliyunpan*", "aliyunpan-v0.0.1-darwin-macos-amd64[TNT].zip"))
 }
+
+// fakeTrash 模拟网盘回收站接口，记录每批提交的文件
+type fakeTrash struct {
+	batches   [][]string
+	trashed   map[string]int
+	failTimes map[string]int    // 提交失败的次数
+	async     map[string]bool   // 服务端异步删除的目录
+	taskFail  map[string]int    // 异步任务失败的次数
+	polls     map[string]int    // 异步任务查询的次数
+	tasks     map[string]string // 异步任务ID对应的文件ID
+	onBatch   func(n int)
+}
+
+func newFakeTrash() *fakeTrash {
+	return &fakeTrash{
+		trashed:   map[string]int{},
+		failTimes: map[string]int{},
+		async:     map[string]bool{},
+		taskFail:  map[string]int{},
+		polls:     map[string]int{},
+		tasks:     map[string]string{},
+	}
+}
+
+func (f *fakeTrash) trash(items []*aliyunpan.FileEntity) []*removeTrashResult {
+	batch := []string{}
+	results := []*removeTrashResult{}
+	for _, item := range items {
+		batch = append(batch, item.FileId)
+		r := &removeTrashResult{file: item}
+		if f.failTimes[item.FileId] > 0 {
+			f.failTimes[item.FileId]--
+			r.err = errors.New("too many requests")
+		} else {
+			f.trashed[item.FileId]++
+			if f.async[item.FileId] {
+				r.asyncTaskId = "task-" + item.FileId + "-" + strconv.Itoa(f.trashed[item.FileId])
+				f.tasks[r.asyncTaskId] = item.FileId
+			}
+		}
+		results = append(results, r)
+	}
+	f.batches = append(f.batches, batch)
+	if f.onBatch != nil {
+		f.onBatch(len(f.batches))
+	}
+	return results
+}
+
+func (f *fakeTrash) queryTask(asyncTaskId string) (*aliyunpan_web.AsyncTaskQueryStatusResult, error) {
+	f.polls[asyncTaskId]++
+	if f.polls[asyncTaskId] < 3 {
+		return &aliyunpan_web.AsyncTaskQueryStatusResult{State: "Running", ConsumedProcess: f.polls[asyncTaskId], TotalProcess: 3}, nil
+	}
+	fileId := f.tasks[asyncTaskId]
+	if f.taskFail[fileId] > 0 {
+		f.taskFail[fileId]--
+		return &aliyunpan_web.AsyncTaskQueryStatusResult{State: "Failed"}, nil
+	}
+	return &aliyunpan_web.AsyncTaskQueryStatusResult{State: "Succeed"}, nil
+}
+
+func newTestRemoveBatchContext(f *fakeTrash, batchSize, maxRetry int) *removeBatchContext {
+	ctx := newRemoveBatchContext("d1", batchSize, maxRetry, nil)
+	ctx.trash = f.trash
+	ctx.queryTask = f.queryTask
+	ctx.pollInterval = 0
+	ctx.retryDelay = 0
+	return ctx
+}
+
+func testFolders(n int) []*aliyunpan.FileEntity {
+	folders := []*aliyunpan.FileEntity{}
+	for i := 0; i < n; i++ {
+		id := strconv.Itoa(i)
+		folders = append(folders, &aliyunpan.FileEntity{FileId: id, FileName: "dir" + id, Path: "/dir" + id, FileType: "folder"})
+	}
+	return folders
+}
+
+func TestRemoveFoldersBatch(t *testing.T) {
+	f := newFakeTrash()
+	ctx := newTestRemoveBatchContext(f, 100, 3)
+	if failed := ctx.removeFolders(testFolders(250)); len(failed) != 0 {
+		t.Fatalf("failed %d", len(failed))
+	}
+	if len(f.batches) != 3 || len(f.batches[0]) != 100 || len(f.batches[1]) != 100 || len(f.batches[2]) != 50 {
+		t.Fatalf("unexpected batches: %d", len(f.batches))
+	}
+	if len(f.trashed) != 250 || ctx.deleted != 250 {
+		t.Fatalf("trashed %d, deleted %d", len(f.trashed), ctx.deleted)
+	}
+}
+
+func TestRemoveFoldersRetry(t *testing.T) {
+	cases := []struct {
+		name       string
+		maxRetry   int
+		failTimes  int  // 提交失败的次数
+		taskFail   int  // 异步任务失败的次数
+		wantFailed bool // 最终是否删除失败
+		wantTrash  int  // 成功提交的次数
+	}{
+		{"异步删除成功", 3, 0, 0, false, 1},
+		{"提交失败后重试成功", 3, 2, 0, false, 1},
+		{"提交失败超过重试次数", 1, 2, 0, true, 0},
+		{"异步任务失败后重新提交", 3, 0, 1, false, 2},
+		{"异步任务失败不重试", 0, 0, 1, true, 1},
+	}
+	for _, c := range cases {
+		f := newFakeTrash()
+		f.async["0"] = true
+		f.failTimes["0"] = c.failTimes
+		f.taskFail["0"] = c.taskFail
+		ctx := newTestRemoveBatchContext(f, 100, c.maxRetry)
+		failed := ctx.removeFolders(testFolders(2))
+		if (len(failed) == 1 && failed[0].FileId == "0") != c.wantFailed || len(failed) > 1 {
+			t.Errorf("%s: failed %v", c.name, failed)
+		}
+		if f.trashed["0"] != c.wantTrash || f.trashed["1"] != 1 {
+			t.Errorf("%s: trashed %v", c.name, f.trashed)
+		}
+		// 提交成功的异步任务都等待到结束
+		for taskId, polls := range f.polls {
+			if polls != 3 {
+				t.Errorf("%s: task %s polled %d times", c.name, taskId, polls)
+			}
+		}
+	}
+}
+
+func TestRemoveFoldersResume(t *testing.T) {
+	f := newFakeTrash()
+	ctx := newTestRemoveBatchContext(f, 10, 3)
+	// 第一批提交后中断
+	f.onBatch = func(n int) {
+		atomic.StoreInt32(&ctx.interrupted, 1)
+	}
+	folders := testFolders(25)
+	remain := ctx.removeFolders(folders)
+	if len(remain) != 15 || len(f.trashed) != 10 || ctx.deleted != 10 {
+		t.Fatalf("remain %d, trashed %d, deleted %d", len(remain), len(f.trashed), ctx.deleted)
+	}
+
+	// 重新执行时只会匹配到剩余的目录，已经删除的目录不会重复提交
+	f.onBatch = nil
+	resume := newTestRemoveBatchContext(f, 10, 3)
+	if failed := resume.removeFolders(remain); len(failed) != 0 {
+		t.Fatalf("failed %d", len(failed))
+	}
+	for _, folder := range folders {
+		if f.trashed[folder.FileId] != 1 {
+			t.Errorf("%s trashed %d times", folder.Path, f.trashed[folder.FileId])
+		}
+	}
+}
+
+func TestRemoveBatchWithRetry(t *testing.T) {
+	f := newFakeTrash()
+	f.failTimes["1"] = 1
+	f.failTimes["2"] = 5
+	ctx := newTestRemoveBatchContext(f, 100, 2)
+	failed := ctx.removeBatchWithRetry(testFolders(3))
+	if len(failed) != 1 || failed[0].FileId != "2" {
+		t.Fatalf("failed %v", failed)
+	}
+	if f.trashed["0"] != 1 || f.trashed["1"] != 1 {
+		t.Fatalf("trashed %v", f.trashed)
+	}
+}
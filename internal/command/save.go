@@ -14,166 +14,590 @@
 package command
 
 import (
+	"encoding/json"
 	"fmt"
-	"github.com/tickstep/aliyunpan-api/aliyunpan_web"
 	"path"
+	"strconv"
 	"strings"
+	"time"
 
-	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
+	"github.com/tickstep/aliyunpan-api/aliyunpan_web"
+	"github.com/tickstep/aliyunpan/cmder/cmdliner"
+	"github.com/tickstep/aliyunpan/internal/functions"
+	"github.com/tickstep/aliyunpan/internal/utils"
+	"github.com/tickstep/library-go/logger"
 	"github.com/urfave/cli"
 )
 
+const (
+	// shareSaveBatchSize 每批保存的文件数量，网盘批量接口每次最多100个请求
+	shareSaveBatchSize = 100
+	// shareSaveBatchInterval 两批请求之间的间隔，避免请求太频繁被限流
+	shareSaveBatchInterval = 500 * time.Millisecond
+	// shareSaveRetryMax 被限流时最多重试的次数
+	shareSaveRetryMax = 5
+	// shareSaveRetryWait 被限流时首次等待的时间，之后每次翻倍
+	shareSaveRetryWait = 5 * time.Second
+)
+
+type (
+	// SaveOptions 保存分享的选项
+	SaveOptions struct {
+		PathFilter  *utils.PathFilter // 过滤规则，nil代表保存全部
+		Interactive bool              // 交互式选择需要保存的文件
+		Recursive   bool              // 过滤规则递归匹配子文件夹中的文件
+		ListOnly    bool              // 只列出分享的文件，不保存
+	}
+
+	// shareSaveEntry 需要保存的分享文件
+	shareSaveEntry struct {
+		item *aliyunpan_web.ListByShareItem
+		dir  string // 保存到目标目录下的相对目录，空字符串代表目标目录
+	}
+
+	// shareSaveContext 保存分享的上下文
+	shareSaveContext struct {
+		webClient  *aliyunpan_web.WebPanClient
+		shareID    string
+		shareToken string
+		filter     *utils.PathFilter
+	}
+)
+
+var saveDescription = `
+	注意: 保存大量文件时, 命令完成后可能还需要额外等待一段时间; 分享的根目录下如果包含大量文件或文件夹, 可能存在不稳定的情况
+
+	示例:
+
+	将 公开分享 保存到 根目录 /
+	aliyunpan share save ABCD1234wxyz /
+	aliyunpan share save https://www.alipan.com/s/ABCD1234wxyz /
+
+	将 私密分享 保存到 指定目录 /资源分享
+	aliyunpan share save ABCD1234wxyz akd1 /资源分享
+	aliyunpan share save https://www.alipan.com/s/ABCD1234wxyz akd1 /资源分享
+
+	只保存分享根目录下的mkv视频以及"字幕"文件夹，不保存名称包含"预告"的文件
+	aliyunpan share save --include "*.mkv" --include "字幕/" --exclude "*预告*" ABCD1234wxyz /资源分享
+
+	递归匹配分享中所有子文件夹的mkv视频，保存时保持原来的目录结构
+	aliyunpan share save -r --include "*.mkv" ABCD1234wxyz /资源分享
+
+	列出分享中的所有文件，不保存
+	aliyunpan share save -l -r ABCD1234wxyz /
+
+	列出分享的文件，交互式选择需要保存的文件
+	aliyunpan share save -i ABCD1234wxyz /资源分享
+
+	不指定 -r 时过滤规则只匹配分享根目录下的文件和文件夹，文件夹作为整体保存
+	`
+
+var saveFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "driveId",
+		Usage: "网盘ID",
+		Value: "",
+	},
+	cli.StringSliceFlag{
+		Name:  "include",
+		Usage: "包含规则，只保存匹配的文件或文件夹。支持glob通配符(例如: *.mkv、字幕/)和re:开头的正则表达式。支持同时指定多个规则",
+	},
+	cli.StringSliceFlag{
+		Name:  "exclude",
+		Usage: "排除规则，匹配的文件和文件夹不保存。支持glob通配符和re:开头的正则表达式。支持同时指定多个规则",
+	},
+	cli.BoolFlag{
+		Name:  "interactive, i",
+		Usage: "交互式选择需要保存的文件",
+	},
+	cli.BoolFlag{
+		Name:  "recursive, r",
+		Usage: "递归列出子文件夹，过滤规则匹配子文件夹中的文件，保存时保持原来的目录结构",
+	},
+	cli.BoolFlag{
+		Name:  "list, l",
+		Usage: "只列出分享的文件，不保存",
+	},
+}
+
 func CmdSave() cli.Command {
 	return cli.Command{
 		Name:  "save",
 		Usage: "保存分享文件/目录",
 		UsageText: `
 	aliyunpan save <分享链接> (<提取码>) <目标目录>`,
-		Description: `
-	注意: 保存大量文件时, 命令完成后可能还需要额外等待一段时间; 分享的根目录下如果包含大量文件或文件夹, 可能存在不稳定的情况
-
-	示例:
+		Description: strings.ReplaceAll(saveDescription, "aliyunpan share save", "aliyunpan save"),
+		Category:    "阿里云盘",
+		Before:      ReloadConfigFunc,
+		Action:      saveAction,
+		Flags:       saveFlags,
+	}
+}
 
-	将 公开分享 保存到 根目录 /
-	aliyunpan save ABCD1234wxyz /
-	aliyunpan save https://www.alipan.com/s/ABCD1234wxyz /
+// saveAction save 以及 share save 命令
+func saveAction(c *cli.Context) error {
+	if c.NArg() <= 1 || c.NArg() > 3 {
+		cli.ShowCommandHelp(c, c.Command.Name)
+		return nil
+	}
+	if !checkWebLogin() {
+		return nil
+	}
+	pathFilter, err := utils.NewPathFilter(c.StringSlice("include"), c.StringSlice("exclude"))
+	if err != nil {
+		fmt.Printf("过滤规则错误: %s\n", err)
+		return nil
+	}
+	RunSave(parseDriveId(c), &SaveOptions{
+		PathFilter:  pathFilter,
+		Interactive: c.Bool("interactive"),
+		Recursive:   c.Bool("recursive"),
+		ListOnly:    c.Bool("list"),
+	}, c.Args()...)
+	return nil
+}
 
-	将 私密分享 保存到 指定目录 /资源分享
-	aliyunpan save ABCD1234wxyz akd1 /资源分享
-	aliyunpan save https://www.alipan.com/s/ABCD1234wxyz akd1 /资源分享
-	`,
-		Category: "阿里云盘",
-		Before:   ReloadConfigFunc,
-		Action: func(c *cli.Context) error {
-			if c.NArg() <= 1 || c.NArg() > 3 {
-				cli.ShowCommandHelp(c, c.Command.Name)
-				return nil
-			}
-			if config.Config.ActiveUser() == nil {
-				fmt.Println("未登录账号")
-				return nil
-			}
-			if config.Config.ActiveUser().PanClient().WebapiPanClient() == nil {
-				fmt.Println("WEB客户端未登录，请登录后再使用该命令")
-				return nil
-			}
-			RunSave(parseDriveId(c), c.Args()...)
-			return nil
-		},
-		Flags: []cli.Flag{
-			cli.StringFlag{
-				Name:  "driveId",
-				Usage: "网盘ID",
-				Value: "",
-			},
-		},
+// parseShareId 从分享链接中解析分享ID，也支持直接输入分享ID
+func parseShareId(link string) string {
+	shareID := strings.TrimSpace(link)
+	for _, prefix := range []string{"alipan.com/s/", "aliyundrive.com/s/"} {
+		if i := strings.Index(shareID, prefix); i >= 0 {
+			shareID = shareID[i+len(prefix):]
+			break
+		}
 	}
+	// 去掉链接中子文件夹以及参数部分
+	if i := strings.IndexAny(shareID, "/?#"); i >= 0 {
+		shareID = shareID[:i]
+	}
+	return shareID
 }
 
 // RunSave 保存分享的文件
-func RunSave(driveId string, args ...string) {
+func RunSave(driveId string, opt *SaveOptions, args ...string) {
+	if opt == nil {
+		opt = &SaveOptions{}
+	}
 	activeUser := GetActiveUser()
+	webClient := activeUser.PanClient().WebapiPanClient()
 
 	targetFilePath := path.Clean(args[len(args)-1])
 	absolutePath := activeUser.PathJoin(driveId, targetFilePath)
-	targetFile, err := activeUser.PanClient().WebapiPanClient().FileInfoByPath(driveId, absolutePath)
-	if err != nil || !targetFile.IsFolder() {
-		fmt.Println("指定目标文件夹不存在")
-		return
+	var targetFile *aliyunpan.FileEntity
+	if !opt.ListOnly {
+		tf, err := webClient.FileInfoByPath(driveId, absolutePath)
+		if err != nil || !tf.IsFolder() {
+			fmt.Println("指定目标文件夹不存在")
+			setJsonError(JsonCodeBadArgs, "指定目标文件夹不存在")
+			return
+		}
+		targetFile = tf
+		fmt.Println("保存文件至：", targetFilePath)
 	}
-	fmt.Println("保存文件至：", targetFilePath)
 
-	shareID := args[0]
-	if i := strings.Index(shareID, "alipan.com/s/"); i > 0 {
-		shareID = shareID[i+13:]
-	}
+	shareID := parseShareId(args[0])
 	sharePwd := ""
 	if len(args) == 3 {
 		sharePwd = args[1]
 	}
 
-	token, err := activeUser.PanClient().WebapiPanClient().GetShareToken(shareID, sharePwd)
+	token, err := webClient.GetShareToken(shareID, sharePwd)
 	if err != nil {
 		fmt.Println("读取分享链接失败：", err)
+		setJsonErr(err)
 		return
 	}
+	ctx := &shareSaveContext{
+		webClient:  webClient,
+		shareID:    shareID,
+		shareToken: token.ShareToken,
+		filter:     opt.PathFilter,
+	}
 
-	list, err := activeUser.PanClient().WebapiPanClient().GetListByShare(token.ShareToken, shareID, "")
-	if err != nil {
-		fmt.Println("读取分享文件列表失败：", err)
+	rootItems, e := ctx.listFolder("root")
+	if e != nil {
+		fmt.Println("读取分享文件列表失败：", e)
+		setJsonErr(e)
 		return
 	}
-	for list.NextMarker != "" {
-		list2, err := activeUser.PanClient().WebapiPanClient().GetListByShare(token.ShareToken, shareID, "")
+
+	// 过滤规则，递归模式下在展开文件夹时过滤
+	items := make([]*aliyunpan_web.ListByShareItem, 0, len(rootItems))
+	for _, item := range rootItems {
+		if opt.Recursive {
+			if excluded, _ := opt.PathFilter.IsExcluded(item.Name, item.Type == "folder"); !excluded {
+				items = append(items, item)
+			}
+		} else if opt.PathFilter.AcceptItem(item.Name, item.Type == "folder") {
+			items = append(items, item)
+		}
+	}
+	if len(items) < len(rootItems) {
+		fmt.Printf("分享共 %d 个文件/文件夹，过滤后剩余 %d 个\n", len(rootItems), len(items))
+	}
+
+	// 交互式选择
+	if opt.Interactive && len(items) > 0 {
+		if jsonDeclineInput() {
+			return
+		}
+		for i, item := range items {
+			fmt.Printf("  %d. %s\n", i+1, shareItemName(item))
+		}
+		line := cmdliner.NewLiner()
+		input, err := line.State.Prompt("请输入需要保存的文件序号，多个序号用逗号分隔，支持范围例如 1-3，直接回车保存全部: ")
+		line.Close()
 		if err != nil {
-			fmt.Println("读取分享文件列表失败：", err)
+			fmt.Println("读取输入失败：", err)
 			return
 		}
-		list.Items = append(list.Items, list2.Items...)
-		list.NextMarker = list2.NextMarker
+		indexes, err := parseSelection(input, len(items))
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if indexes != nil {
+			selected := make([]*aliyunpan_web.ListByShareItem, 0, len(indexes))
+			for _, idx := range indexes {
+				selected = append(selected, items[idx])
+			}
+			items = selected
+		}
 	}
 
-	var params []*aliyunpan_web.FileSaveParam
-	files := make(map[string]*aliyunpan_web.ListByShareItem)
-	for _, item := range list.Items {
-		if item.FileExtension != "" {
-			fmt.Println(" ", item.Name)
-		} else {
-			fmt.Println(" ", item.Name+"/")
+	// 递归展开文件夹，文件夹下的文件全部需要保存时作为整体保存
+	entries := make([]*shareSaveEntry, 0, len(items))
+	if opt.Recursive {
+		if opt.ListOnly {
+			ctx.printTree(items, "", "")
+			return
+		}
+		entries, _ = ctx.expand(items, "")
+	} else {
+		if opt.ListOnly {
+			for _, item := range items {
+				fmt.Println(" ", shareItemName(item))
+			}
+			return
+		}
+		for _, item := range items {
+			entries = append(entries, &shareSaveEntry{item: item})
 		}
-		files[item.FileID] = item
+	}
+	if len(entries) == 0 {
+		fmt.Println("没有需要保存的文件")
+		return
+	}
+	for _, entry := range entries {
+		fmt.Println(" ", path.Join(entry.dir, shareItemName(entry.item)))
+	}
+	fmt.Println()
 
-		params = append(params, &aliyunpan_web.FileSaveParam{
-			ShareID:        shareID,
-			FileId:         item.FileID,
-			AutoRename:     true,
-			ToDriveId:      driveId,
-			ToParentFileId: targetFile.FileId,
+	failed := ctx.save(driveId, targetFile, entries)
+	if len(failed) > 0 {
+		fmt.Println("以下文件保存失败：")
+		for _, entry := range failed {
+			fmt.Println(path.Join(entry.dir, entry.item.Name))
+		}
+		fmt.Println("")
+		setJsonError(JsonCodePartialFailed, fmt.Sprintf("%d 个文件保存失败", len(failed)))
+	}
+	fmt.Println("操作成功, 分享文件已保存到目标目录: ", targetFile.Path)
+}
+
+// withRetry 执行请求，被限流时等待后重试
+func (ctx *shareSaveContext) withRetry(fn func() error) error {
+	wait := shareSaveRetryWait
+	for retry := 0; ; retry++ {
+		err := fn()
+		if err == nil || retry >= shareSaveRetryMax || functions.ClassifyRiskError(err) != functions.RiskRateLimited {
+			return err
+		}
+		fmt.Printf("请求太频繁被限流，等待 %s 后重试\n", wait)
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+// listFolder 列出分享中指定文件夹下的全部文件，根目录为 root
+func (ctx *shareSaveContext) listFolder(parentFileId string) ([]*aliyunpan_web.ListByShareItem, error) {
+	items := []*aliyunpan_web.ListByShareItem{}
+	marker := ""
+	for {
+		var result *aliyunpan_web.ListByShareResult
+		err := ctx.withRetry(func() error {
+			r, e := ctx.listFolderPage(parentFileId, marker)
+			if e != nil {
+				return e
+			}
+			result = r
+			return nil
 		})
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, result.Items...)
+		if result.NextMarker == "" {
+			return items, nil
+		}
+		marker = result.NextMarker
 	}
-	fmt.Println()
+}
 
-	result, err := activeUser.PanClient().WebapiPanClient().FileCopy(token.ShareToken, params)
+// listFolderPage 列出分享中文件夹的一页文件。接口库只支持列出分享的根目录，子文件夹通过批量接口列出
+func (ctx *shareSaveContext) listFolderPage(parentFileId, marker string) (*aliyunpan_web.ListByShareResult, error) {
+	if parentFileId == "root" {
+		r, err := ctx.webClient.GetListByShare(ctx.shareToken, ctx.shareID, marker)
+		if err != nil {
+			return nil, err
+		}
+		return r, nil
+	}
+	body := map[string]interface{}{
+		"share_id":        ctx.shareID,
+		"parent_file_id":  parentFileId,
+		"limit":           100,
+		"order_by":        "name",
+		"order_direction": "DESC",
+	}
+	if marker != "" {
+		body["marker"] = marker
+	}
+	result, err := ctx.webClient.BatchTask(aliyunpan_web.API_URL+"/adrive/v2/batch", &aliyunpan_web.BatchRequestParam{
+		Requests: aliyunpan_web.BatchRequestList{{
+			Id:      parentFileId,
+			Method:  "POST",
+			Url:     "/file/list_by_share",
+			Headers: map[string]string{"Content-Type": "application/json"},
+			Body:    body,
+		}},
+		Resource: "file",
+	}, [2]string{"x-share-token", ctx.shareToken})
 	if err != nil {
-		fmt.Println("保存分享文件失败：", err)
-		return
+		return nil, err
+	}
+	if len(result.Responses) == 0 {
+		return nil, apierror.NewFailedApiError("读取文件夹失败")
+	}
+	resp := result.Responses[0]
+	if resp.Status == 429 {
+		return nil, apierror.NewApiError(apierror.ApiCodeTooManyRequests, "请求太频繁")
 	}
-	var ids []string
-	var failedSaveFileIds []string
-	tasks := make(map[string]string)
-	for _, item := range result {
-		if item.AsyncTaskId == "" {
-			if item.Status != 201 {
-				failedSaveFileIds = append(failedSaveFileIds, item.FileId)
+	data, _ := json.Marshal(resp.Body)
+	if resp.Status != 200 {
+		return nil, apierror.NewFailedApiError(string(data))
+	}
+	r := &aliyunpan_web.ListByShareResult{}
+	if e := json.Unmarshal(data, r); e != nil {
+		return nil, apierror.NewFailedApiError(e.Error())
+	}
+	return r, nil
+}
+
+// expand 递归展开文件夹，按过滤规则选择需要保存的文件。
+// 文件夹下所有文件都需要保存时，文件夹作为整体保存，返回的 complete 为true
+func (ctx *shareSaveContext) expand(items []*aliyunpan_web.ListByShareItem, dir string) (entries []*shareSaveEntry, complete bool) {
+	complete = true
+	for _, item := range items {
+		relPath := path.Join(dir, item.Name)
+		if item.Type != "folder" {
+			if ctx.filter.Accept(relPath, false) {
+				entries = append(entries, &shareSaveEntry{item: item, dir: dir})
+			} else {
+				complete = false
 			}
-		} else {
-			tasks[item.AsyncTaskId] = item.FileId
-			ids = append(ids, item.AsyncTaskId)
+			continue
 		}
+		if excluded, _ := ctx.filter.IsExcluded(relPath, true); excluded {
+			complete = false
+			continue
+		}
+		children, err := ctx.listFolder(item.FileID)
+		if err != nil {
+			fmt.Printf("读取分享文件夹失败: %s, %s\n", relPath, err)
+			complete = false
+			continue
+		}
+		logger.Verbosef("share folder: %s, %d items\n", relPath, len(children))
+		time.Sleep(shareSaveBatchInterval)
+		childEntries, childComplete := ctx.expand(children, relPath)
+		if childComplete && (len(children) > 0 || ctx.filter.AcceptItem(relPath, true)) {
+			entries = append(entries, &shareSaveEntry{item: item, dir: dir})
+			continue
+		}
+		complete = false
+		entries = append(entries, childEntries...)
 	}
-	if ids != nil {
-		result2, err := activeUser.PanClient().WebapiPanClient().AsyncTaskGet(token.ShareToken, ids)
+	return
+}
+
+// printTree 以树形列出分享的文件
+func (ctx *shareSaveContext) printTree(items []*aliyunpan_web.ListByShareItem, dir, prefix string) {
+	for _, item := range items {
+		relPath := path.Join(dir, item.Name)
+		if item.Type != "folder" {
+			if ctx.filter.Accept(relPath, false) {
+				fmt.Printf("%s%s\n", prefix, item.Name)
+			}
+			continue
+		}
+		if excluded, _ := ctx.filter.IsExcluded(relPath, true); excluded {
+			continue
+		}
+		fmt.Printf("%s%s/\n", prefix, item.Name)
+		children, err := ctx.listFolder(item.FileID)
 		if err != nil {
-			fmt.Println("读取保存结果失败：", err)
+			fmt.Printf("%s  读取文件夹失败: %s\n", prefix, err)
+			continue
 		}
+		time.Sleep(shareSaveBatchInterval)
+		ctx.printTree(children, relPath, prefix+"  ")
+	}
+}
 
-		for _, item := range result2 {
-			if !item.Success {
-				failedSaveFileIds = append(failedSaveFileIds, tasks[item.AsyncTaskId])
+// save 分批保存文件到目标目录，返回保存失败的文件
+func (ctx *shareSaveContext) save(driveId string, targetFile *aliyunpan.FileEntity, entries []*shareSaveEntry) (failed []*shareSaveEntry) {
+	// 保持原来的目录结构，先创建子目录
+	dirIds := map[string]string{"": targetFile.FileId}
+	params := make([]*aliyunpan_web.FileSaveParam, 0, len(entries))
+	saveEntries := make([]*shareSaveEntry, 0, len(entries))
+	for _, entry := range entries {
+		dirId, ok := dirIds[entry.dir]
+		if !ok {
+			r, err := ctx.webClient.MkdirByFullPath(driveId, path.Join(targetFile.Path, entry.dir))
+			if err != nil || r == nil || r.FileId == "" {
+				fmt.Printf("创建目录失败: %s, %s\n", entry.dir, err)
+				failed = append(failed, entry)
+				continue
 			}
+			dirId = r.FileId
+			dirIds[entry.dir] = dirId
 		}
+		params = append(params, &aliyunpan_web.FileSaveParam{
+			ShareID:        ctx.shareID,
+			FileId:         entry.item.FileID,
+			AutoRename:     true,
+			ToDriveId:      driveId,
+			ToParentFileId: dirId,
+		})
+		saveEntries = append(saveEntries, entry)
 	}
 
-	if failedSaveFileIds != nil {
-		fmt.Println("以下文件保存失败：")
-		for _, id := range failedSaveFileIds {
-			if v, ok := files[id]; ok {
-				fmt.Println(v.Name)
-			} else {
-				fmt.Println(id)
+	for begin := 0; begin < len(params); begin += shareSaveBatchSize {
+		end := begin + shareSaveBatchSize
+		if end > len(params) {
+			end = len(params)
+		}
+		if begin > 0 {
+			time.Sleep(shareSaveBatchInterval)
+		}
+		if len(params) > shareSaveBatchSize {
+			fmt.Printf("保存第 %d-%d 个文件，共 %d 个\n", begin+1, end, len(params))
+		}
+		failed = append(failed, ctx.saveBatch(params[begin:end], saveEntries[begin:end])...)
+	}
+	return
+}
+
+// saveBatch 保存一批文件，被限流的文件等待后重试
+func (ctx *shareSaveContext) saveBatch(params []*aliyunpan_web.FileSaveParam, entries []*shareSaveEntry) (failed []*shareSaveEntry) {
+	wait := shareSaveRetryWait
+	for retry := 0; len(params) > 0; retry++ {
+		var result []*aliyunpan_web.FileSaveResult
+		err := ctx.withRetry(func() error {
+			r, e := ctx.webClient.FileCopy(ctx.shareToken, params)
+			if e != nil {
+				return e
 			}
+			result = r
+			return nil
+		})
+		if err != nil {
+			fmt.Println("保存分享文件失败：", err)
+			return append(failed, entries...)
 		}
-		fmt.Println("")
+
+		var limitedParams []*aliyunpan_web.FileSaveParam
+		var limitedEntries []*shareSaveEntry
+		var taskIds []string
+		tasks := map[string]*shareSaveEntry{}
+		for i, item := range result {
+			if i >= len(entries) {
+				break
+			}
+			switch {
+			case item.Status == 429:
+				limitedParams = append(limitedParams, params[i])
+				limitedEntries = append(limitedEntries, entries[i])
+			case item.AsyncTaskId != "":
+				tasks[item.AsyncTaskId] = entries[i]
+				taskIds = append(taskIds, item.AsyncTaskId)
+			case item.Status != 201:
+				failed = append(failed, entries[i])
+			}
+		}
+		if taskIds != nil {
+			result2, err := ctx.webClient.AsyncTaskGet(ctx.shareToken, taskIds)
+			if err != nil {
+				fmt.Println("读取保存结果失败：", err)
+			}
+			for _, item := range result2 {
+				if !item.Success {
+					failed = append(failed, tasks[item.AsyncTaskId])
+				}
+			}
+		}
+
+		params, entries = limitedParams, limitedEntries
+		if len(params) == 0 {
+			break
+		}
+		if retry >= shareSaveRetryMax {
+			return append(failed, entries...)
+		}
+		fmt.Printf("%d 个文件保存时被限流，等待 %s 后重试\n", len(params), wait)
+		time.Sleep(wait)
+		wait *= 2
 	}
-	fmt.Println("操作成功, 分享文件已保存到目标目录: ", targetFile.Path)
+	return
+}
+
+// shareItemName 分享文件显示的名称，文件夹以/结尾
+func shareItemName(item *aliyunpan_web.ListByShareItem) string {
+	if item.Type == "folder" {
+		return item.Name + "/"
+	}
+	return item.Name
+}
+
+// parseSelection 解析交互式输入的序号，例如 "1,3,5-7"，返回从0开始的下标，去重并保持输入顺序。输入为空返回nil代表全部
+func parseSelection(input string, count int) ([]int, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return nil, nil
+	}
+	result := []int{}
+	seen := map[int]bool{}
+	for _, part := range strings.FieldsFunc(input, func(r rune) bool {
+		return r == ',' || r == '，' || r == ' '
+	}) {
+		begin, end := part, part
+		if i := strings.Index(part, "-"); i > 0 {
+			begin, end = part[:i], part[i+1:]
+		}
+		b, err1 := strconv.Atoi(strings.TrimSpace(begin))
+		e, err2 := strconv.Atoi(strings.TrimSpace(end))
+		if err1 != nil || err2 != nil || b < 1 || e > count || b > e {
+			return nil, fmt.Errorf("序号输入错误: %s", part)
+		}
+		for n := b; n <= e; n++ {
+			if !seen[n-1] {
+				seen[n-1] = true
+				result = append(result, n-1)
+			}
+		}
+	}
+	return result, nil
 }
@@ -18,9 +18,11 @@ import (
 	"github.com/tickstep/aliyunpan-api/aliyunpan"
 	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
 	"github.com/tickstep/aliyunpan/cmder"
-	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/cmder/cmdtable"
 	"github.com/urfave/cli"
+	"os"
 	"path"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -65,85 +67,216 @@ func CmdShare() cli.Command {
 						cli.ShowCommandHelp(c, c.Command.Name)
 						return nil
 					}
-					if config.Config.ActiveUser() == nil {
-						fmt.Println("未登录账号")
+					if GetActiveUser() == nil {
+						printNotLogin()
 						return nil
 					}
 
-					// 有效期
-					et := ""
-					timeFlag := "0"
-					if c.IsSet("time") {
-						timeFlag = c.String("time")
-					}
-					now := time.Now()
-					if timeFlag == "1" {
-						et = now.Add(time.Duration(1) * time.Hour * 24).Format("2006-01-02 15:04:05")
-					} else if timeFlag == "2" {
-						et = now.Add(time.Duration(7) * time.Hour * 24).Format("2006-01-02 15:04:05")
-					} else {
-						et = ""
+					modeFlag, et, sharePwd, ok := parseShareFlags(c)
+					if !ok {
+						return nil
 					}
+					RunOpenShareSet(modeFlag, parseDriveId(c), c.Args(), et, sharePwd)
+					return nil
+				},
+				Flags: append([]cli.Flag{
+					cli.StringFlag{
+						Name:  "driveId",
+						Usage: "网盘ID",
+						Value: "",
+					},
+				}, shareFlags...),
+			},
+			{
+				Name:      "create",
+				Aliases:   []string{"c"},
+				Usage:     "创建分享链接，支持批量为每个文件/目录单独创建",
+				UsageText: cmder.App().Name + " share create [-batch] [-expire <有效期>] <文件/目录1> <文件/目录2> ...",
+				Description: `
+    默认所有文件/目录创建为一个分享链接，指定 -batch 后为每个文件/目录单独创建分享链接。
+    创建结果以表格输出，使用 --json 时输出JSON。
+
+示例:
+
+    创建文件 1.mp4 的私密分享链接，有效期3天
+	aliyunpan share create -mode 1 -expire 3d 1.mp4
 
-					// 密码
-					sharePwd := ""
-					if c.IsSet("sharePwd") {
-						sharePwd = c.String("sharePwd")
+    为 /我的视频/ 目录下的每个mp4文件单独创建私密分享链接，每个链接随机生成提取码
+	aliyunpan share create -mode 1 -batch /我的视频/*.mp4
+
+    创建私密分享链接，指定提取码和过期时间
+	aliyunpan share create -mode 1 -sharePwd 2333 -expire "2025-01-01 00:00:00" 1.mp4
+`,
+				Action: func(c *cli.Context) error {
+					if c.NArg() < 1 {
+						cli.ShowCommandHelp(c, c.Command.Name)
+						return nil
 					}
-					if sharePwd == "" {
-						sharePwd = RandomStr(4)
+					if GetActiveUser() == nil {
+						printNotLogin()
+						return nil
 					}
 
-					// 模式
-					modeFlag := "3"
-					if c.IsSet("mode") {
-						modeFlag = c.String("mode")
+					modeFlag, et, sharePwd, ok := parseShareFlags(c)
+					if !ok {
+						return nil
 					}
-					if modeFlag == "1" || modeFlag == "2" {
-						if config.Config.ActiveUser().ActiveDriveId != config.Config.ActiveUser().DriveList.GetResourceDriveId() {
-							// 只有资源库才支持私有、公开分享
-							fmt.Println("只有资源库才支持分享链接，其他请使用快传链接")
+					if c.String("expire") != "" {
+						expire, err := parseShareExpire(c.String("expire"), time.Now())
+						if err != nil {
+							fmt.Println(err)
+							setJsonError(JsonCodeBadArgs, err.Error())
 							return nil
 						}
+						et = expire
 					}
-					if modeFlag == "1" {
-						if sharePwd == "" {
-							sharePwd = RandomStr(4)
-						}
-					} else {
-						sharePwd = ""
-					}
-
-					RunOpenShareSet(modeFlag, parseDriveId(c), c.Args(), et, sharePwd)
+					// 批量创建私密分享时，没有指定提取码则每个链接随机生成
+					randomPwd := modeFlag == "1" && !c.IsSet("sharePwd")
+					RunShareCreate(modeFlag, parseDriveId(c), c.Args(), et, sharePwd, c.Bool("batch"), randomPwd)
 					return nil
 				},
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					cli.StringFlag{
 						Name:  "driveId",
 						Usage: "网盘ID",
 						Value: "",
 					},
-					cli.StringFlag{
-						Name:  "time",
-						Usage: "有效期，0-永久，1-1天，2-7天",
-						Value: "0",
-					},
-					cli.StringFlag{
-						Name:  "mode",
-						Usage: "模式，1-私密分享，2-公开分享，3-快传",
-						Value: "3",
+					cli.BoolFlag{
+						Name:  "batch",
+						Usage: "为每个文件/目录单独创建分享链接",
 					},
 					cli.StringFlag{
-						Name:  "sharePwd",
-						Usage: "自定义私密分享密码，4个字符，没有指定则随机生成",
-						Value: "",
+						Name:  "expire",
+						Usage: "有效期，例如：12h、7d，或者过期时间：2025-01-01、2025-01-01 12:00:00。指定后忽略 -time 参数",
 					},
+				}, shareFlags...),
+			},
+			{
+				Name:      "list",
+				Aliases:   []string{"l"},
+				Usage:     "列出已分享文件/目录",
+				UsageText: cmder.App().Name + " share list",
+				Action: func(c *cli.Context) error {
+					if !checkWebLogin() {
+						return nil
+					}
+					RunShareList()
+					return nil
+				},
+			},
+			{
+				Name:        "cancel",
+				Usage:       "取消分享文件/目录",
+				UsageText:   cmder.App().Name + " share cancel <shareid_1> <shareid_2> ...",
+				Description: `通过分享id (shareid) 取消分享, 分享id可以通过 share list 查看.`,
+				Action: func(c *cli.Context) error {
+					if !checkWebLogin() {
+						return nil
+					}
+					if c.NArg() < 1 {
+						cli.ShowCommandHelp(c, c.Command.Name)
+						return nil
+					}
+					RunShareCancel(c.Args())
+					return nil
 				},
 			},
+			{
+				Name:        "save",
+				Usage:       "保存别人分享的文件/目录到自己的网盘",
+				UsageText:   cmder.App().Name + " share save [-r] [--include <规则>] [--exclude <规则>] [-i] [-l] <分享链接> (<提取码>) <目标目录>",
+				Description: saveDescription,
+				Action:      saveAction,
+				Flags:       saveFlags,
+			},
 		},
 	}
 }
 
+// shareJsonData share set命令的JSON输出
+type shareJsonData struct {
+	Mode       string   `json:"mode"`                 // 1-私密分享，2-公开分享，3-快传
+	ShareUrl   string   `json:"shareUrl"`             // 分享链接
+	SharePwd   string   `json:"sharePwd,omitempty"`   // 提取码
+	Expiration string   `json:"expiration,omitempty"` // 有效期
+	Files      []string `json:"files"`                // 分享的文件
+}
+
+// shareCreateJsonItem share create命令每个分享链接的JSON输出
+type shareCreateJsonItem struct {
+	ShareUrl   string   `json:"shareUrl,omitempty"`   // 分享链接
+	SharePwd   string   `json:"sharePwd,omitempty"`   // 提取码
+	Expiration string   `json:"expiration,omitempty"` // 过期时间，为空代表永久有效
+	Files      []string `json:"files"`                // 分享的文件
+	Error      string   `json:"error,omitempty"`      // 创建失败的原因
+}
+
+// shareFlags 分享链接相关的命令参数
+var shareFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "time",
+		Usage: "有效期，0-永久，1-1天，2-7天",
+		Value: "0",
+	},
+	cli.StringFlag{
+		Name:  "mode",
+		Usage: "模式，1-私密分享，2-公开分享，3-快传",
+		Value: "3",
+	},
+	cli.StringFlag{
+		Name:  "sharePwd",
+		Usage: "自定义私密分享密码，4个字符，没有指定则随机生成",
+		Value: "",
+	},
+}
+
+// parseShareFlags 解析分享模式、有效期以及分享密码
+func parseShareFlags(c *cli.Context) (modeFlag, expiredTime, sharePwd string, ok bool) {
+	// 有效期
+	timeFlag := "0"
+	if c.IsSet("time") {
+		timeFlag = c.String("time")
+	}
+	now := time.Now()
+	if timeFlag == "1" {
+		expiredTime = now.Add(time.Duration(1) * time.Hour * 24).Format("2006-01-02 15:04:05")
+	} else if timeFlag == "2" {
+		expiredTime = now.Add(time.Duration(7) * time.Hour * 24).Format("2006-01-02 15:04:05")
+	} else {
+		expiredTime = ""
+	}
+
+	// 密码
+	if c.IsSet("sharePwd") {
+		sharePwd = c.String("sharePwd")
+	}
+	if sharePwd == "" {
+		sharePwd = RandomStr(4)
+	}
+
+	// 模式
+	modeFlag = "3"
+	if c.IsSet("mode") {
+		modeFlag = c.String("mode")
+	}
+	if modeFlag == "1" || modeFlag == "2" {
+		if GetActiveUser().ActiveDriveId != GetActiveUser().DriveList.GetResourceDriveId() {
+			// 只有资源库才支持私有、公开分享
+			fmt.Println("只有资源库才支持分享链接，其他请使用快传链接")
+			setJsonError(JsonCodeBadArgs, "只有资源库才支持分享链接，其他请使用快传链接")
+			return "", "", "", false
+		}
+	}
+	if modeFlag == "1" {
+		if sharePwd == "" {
+			sharePwd = RandomStr(4)
+		}
+	} else {
+		sharePwd = ""
+	}
+	return modeFlag, expiredTime, sharePwd, true
+}
+
 // RunOpenShareSet 执行分享
 func RunOpenShareSet(modeFlag, driveId string, paths []string, expiredTime string, sharePwd string) {
 	if len(paths) <= 0 {
@@ -151,7 +284,6 @@ func RunOpenShareSet(modeFlag, driveId string, paths []string, expiredTime strin
 		return
 	}
 	activeUser := GetActiveUser()
-	panClient := activeUser.PanClient()
 
 	allFileList := []*aliyunpan.FileEntity{}
 	for idx := 0; idx < len(paths); idx++ {
@@ -177,10 +309,52 @@ func RunOpenShareSet(modeFlag, driveId string, paths []string, expiredTime strin
 
 	if len(fidList) == 0 {
 		fmt.Printf("没有指定有效的文件\n")
+		setJsonError(JsonCodeBadArgs, "没有指定有效的文件")
+		return
+	}
+	jsonData := &shareJsonData{Mode: modeFlag}
+	for _, f := range allFileList {
+		jsonData.Files = append(jsonData.Files, f.Path)
+	}
+
+	shareUrl, pwd, err := createOpenShareLink(modeFlag, driveId, fidList, expiredTime, sharePwd)
+	if err != nil {
+		linkName := "分享链接"
+		if modeFlag == "3" {
+			linkName = "快传链接"
+		}
+		if err.Code == apierror.ApiCodeFileShareNotAllowed {
+			fmt.Printf("创建%s失败: 该文件类型不允许分享\n", linkName)
+		} else {
+			fmt.Printf("创建%s失败: %s\n", linkName, err)
+		}
+		setJsonErr(err)
 		return
 	}
+	switch modeFlag {
+	case "1":
+		fmt.Printf("创建私密分享链接成功\n")
+	case "2":
+		fmt.Printf("创建公开分享链接成功\n")
+	default:
+		fmt.Printf("创建快传链接成功\n")
+	}
+	if len(pwd) > 0 {
+		fmt.Printf("链接：%s 提取码：%s\n", shareUrl, pwd)
+	} else {
+		fmt.Printf("链接：%s\n", shareUrl)
+	}
+	jsonData.ShareUrl = shareUrl
+	jsonData.SharePwd = pwd
+	if modeFlag != "3" {
+		jsonData.Expiration = expiredTime
+	}
+	setJsonData(jsonData)
+}
 
-	// 创建分享类型
+// createOpenShareLink 创建分享链接，modeFlag为3时创建快传链接，返回分享链接和提取码
+func createOpenShareLink(modeFlag, driveId string, fidList []string, expiredTime, sharePwd string) (shareUrl, pwd string, err *apierror.ApiError) {
+	panClient := GetActivePanClient()
 	if modeFlag == "3" {
 		// 快传
 		r, err1 := panClient.OpenapiPanClient().FastShareLinkCreate(aliyunpan.FastShareCreateParam{
@@ -188,43 +362,145 @@ func RunOpenShareSet(modeFlag, driveId string, paths []string, expiredTime strin
 			FileIdList: fidList,
 		})
 		if err1 != nil || r == nil {
-			if err1.Code == apierror.ApiCodeFileShareNotAllowed {
-				fmt.Printf("创建快传链接失败: 该文件类型不允许分享\n")
-			} else {
-				fmt.Printf("创建快传链接失败: %s\n", err1)
+			if err1 == nil {
+				err1 = apierror.NewFailedApiError("创建快传链接失败")
 			}
-			return
+			return "", "", err1
+		}
+		return strings.ReplaceAll(r.ShareUrl, "https://www.aliyundrive.com", "https://www.alipan.com"), "", nil
+	}
+
+	// 分享
+	r, err1 := panClient.OpenapiPanClient().ShareLinkCreate(aliyunpan.ShareCreateParam{
+		DriveId:    driveId,
+		SharePwd:   sharePwd,
+		Expiration: expiredTime,
+		FileIdList: fidList,
+	})
+	if err1 != nil || r == nil {
+		if err1 == nil {
+			err1 = apierror.NewFailedApiError("创建分享链接失败")
 		}
+		return "", "", err1
+	}
+	return strings.ReplaceAll(r.ShareUrl, "https://www.aliyundrive.com", "https://www.alipan.com"), r.SharePwd, nil
+}
 
-		fmt.Printf("创建快传链接成功\n")
-		fmt.Printf("链接：%s\n", strings.ReplaceAll(r.ShareUrl, "https://www.aliyundrive.com", "https://www.alipan.com"))
+// parseShareExpire 解析分享有效期，支持 12h、7d 等时长以及 2006-01-02、2006-01-02 15:04:05 格式的过期时间，
+// 返回 2006-01-02 15:04:05 格式的过期时间，0代表永久有效返回空字符串
+func parseShareExpire(expire string, now time.Time) (string, error) {
+	expire = strings.TrimSpace(expire)
+	if expire == "" || expire == "0" {
+		return "", nil
+	}
+	var expiredTime time.Time
+	if strings.HasSuffix(expire, "d") {
+		if days, err := strconv.Atoi(strings.TrimSuffix(expire, "d")); err == nil && days > 0 {
+			expiredTime = now.AddDate(0, 0, days)
+		}
+	} else if d, err := time.ParseDuration(expire); err == nil && d > 0 {
+		expiredTime = now.Add(d)
 	} else {
-		// 分享
-		r, err1 := panClient.OpenapiPanClient().ShareLinkCreate(aliyunpan.ShareCreateParam{
-			DriveId:    driveId,
-			SharePwd:   sharePwd,
-			Expiration: expiredTime,
-			FileIdList: fidList,
-		})
-		if err1 != nil || r == nil {
-			if err1.Code == apierror.ApiCodeFileShareNotAllowed {
-				fmt.Printf("创建分享链接失败: 该文件类型不允许分享\n")
+		for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+			if t, e := time.ParseInLocation(layout, expire, now.Location()); e == nil {
+				if layout == "2006-01-02" {
+					// 只指定日期时，当天结束时过期
+					t = t.Add(24*time.Hour - time.Second)
+				}
+				expiredTime = t
+				break
+			}
+		}
+	}
+	if expiredTime.IsZero() {
+		return "", fmt.Errorf("有效期格式错误: %s, 示例: 12h、7d、2025-01-01", expire)
+	}
+	if !expiredTime.After(now) {
+		return "", fmt.Errorf("过期时间必须晚于当前时间: %s", expire)
+	}
+	return expiredTime.Format("2006-01-02 15:04:05"), nil
+}
+
+// RunShareCreate 创建分享链接，batch为true时为每个文件/目录单独创建分享链接，randomPwd为true时每个链接随机生成提取码
+func RunShareCreate(modeFlag, driveId string, paths []string, expiredTime, sharePwd string, batch, randomPwd bool) {
+	activeUser := GetActiveUser()
+	allFileList := []*aliyunpan.FileEntity{}
+	for _, p := range paths {
+		absolutePath := path.Clean(activeUser.PathJoin(driveId, p))
+		fileList, err := matchPathByShellPattern(driveId, absolutePath)
+		if err != nil || len(fileList) == 0 {
+			fmt.Println("文件不存在: " + absolutePath)
+			continue
+		}
+		allFileList = append(allFileList, fileList...)
+	}
+	if len(allFileList) == 0 {
+		fmt.Printf("没有指定有效的文件\n")
+		setJsonError(JsonCodeBadArgs, "没有指定有效的文件")
+		return
+	}
+
+	// 每组文件创建一个分享链接
+	groups := [][]*aliyunpan.FileEntity{allFileList}
+	if batch {
+		groups = groups[:0]
+		for _, f := range allFileList {
+			groups = append(groups, []*aliyunpan.FileEntity{f})
+		}
+	}
+
+	items := []*shareCreateJsonItem{}
+	failed := 0
+	for _, group := range groups {
+		item := &shareCreateJsonItem{}
+		fidList := []string{}
+		for _, f := range group {
+			fidList = append(fidList, f.FileId)
+			item.Files = append(item.Files, f.Path)
+		}
+		pwd := sharePwd
+		if randomPwd && batch {
+			pwd = RandomStr(4)
+		}
+		shareUrl, pwd, err := createOpenShareLink(modeFlag, driveId, fidList, expiredTime, pwd)
+		if err != nil {
+			failed++
+			if err.Code == apierror.ApiCodeFileShareNotAllowed {
+				item.Error = "该文件类型不允许分享"
 			} else {
-				fmt.Printf("创建分享链接失败: %s\n", err1)
+				item.Error = err.Error()
+			}
+		} else {
+			item.ShareUrl = shareUrl
+			item.SharePwd = pwd
+			if modeFlag != "3" {
+				item.Expiration = expiredTime
 			}
-			return
 		}
+		items = append(items, item)
+	}
+	setJsonData(items)
 
-		if modeFlag == "1" {
-			fmt.Printf("创建私密分享链接成功\n")
-		} else if modeFlag == "2" {
-			fmt.Printf("创建公开分享链接成功\n")
+	tb := cmdtable.NewTable(os.Stdout)
+	tb.SetHeader([]string{"#", "文件/目录", "分享链接", "提取码", "过期时间"})
+	for k, item := range items {
+		files := strings.Join(item.Files, "\n")
+		link, et := item.ShareUrl, item.Expiration
+		if item.Error != "" {
+			link = "创建失败: " + item.Error
+		}
+		if et == "" && item.Error == "" {
+			et = "永久有效"
 		}
-		shareUrl := strings.ReplaceAll(r.ShareUrl, "https://www.aliyundrive.com", "https://www.alipan.com")
-		if len(sharePwd) > 0 {
-			fmt.Printf("链接：%s 提取码：%s\n", shareUrl, r.SharePwd)
+		tb.Append([]string{strconv.Itoa(k + 1), files, link, item.SharePwd, et})
+	}
+	tb.Render()
+	if failed > 0 {
+		fmt.Printf("%d 个分享链接创建失败\n", failed)
+		if failed == len(items) {
+			setJsonError(JsonCodeFailed, "分享链接创建失败")
 		} else {
-			fmt.Printf("链接：%s\n", shareUrl)
+			setJsonError(JsonCodePartialFailed, fmt.Sprintf("%d 个分享链接创建失败", failed))
 		}
 	}
 }
@@ -20,7 +20,6 @@ import (
 	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
 	"github.com/tickstep/aliyunpan/cmder"
 	"github.com/tickstep/aliyunpan/cmder/cmdtable"
-	"github.com/tickstep/aliyunpan/internal/config"
 	"github.com/urfave/cli"
 	"os"
 	"path"
@@ -70,11 +69,11 @@ func CmdShareWeb() cli.Command {
 						cli.ShowCommandHelp(c, c.Command.Name)
 						return nil
 					}
-					if config.Config.ActiveUser() == nil {
-						fmt.Println("未登录账号")
+					if GetActiveUser() == nil {
+						printNotLogin()
 						return nil
 					}
-					if config.Config.ActiveUser().PanClient().WebapiPanClient() == nil {
+					if GetActiveUser().PanClient().WebapiPanClient() == nil {
 						fmt.Println("WEB客户端未登录，请登录后再使用该命令")
 						return nil
 					}
@@ -102,7 +101,7 @@ func CmdShareWeb() cli.Command {
 						modeFlag = c.String("mode")
 					}
 					if modeFlag == "1" || modeFlag == "2" {
-						if config.Config.ActiveUser().ActiveDriveId != config.Config.ActiveUser().DriveList.GetResourceDriveId() {
+						if GetActiveUser().ActiveDriveId != GetActiveUser().DriveList.GetResourceDriveId() {
 							// 只有资源库才支持私有、公开分享
 							fmt.Println("只有资源库才支持分享链接，其他请使用快传链接")
 							return nil
@@ -148,11 +147,11 @@ func CmdShareWeb() cli.Command {
 				Usage:     "列出已分享文件/目录",
 				UsageText: cmder.App().Name + " share list",
 				Action: func(c *cli.Context) error {
-					if config.Config.ActiveUser() == nil {
-						fmt.Println("未登录账号")
+					if GetActiveUser() == nil {
+						printNotLogin()
 						return nil
 					}
-					if config.Config.ActiveUser().PanClient().WebapiPanClient() == nil {
+					if GetActiveUser().PanClient().WebapiPanClient() == nil {
 						fmt.Println("WEB客户端未登录，请登录后再使用该命令")
 						return nil
 					}
@@ -168,11 +167,11 @@ func CmdShareWeb() cli.Command {
 				UsageText:   cmder.App().Name + " share cancel <shareid_1> <shareid_2> ...",
 				Description: `目前只支持通过分享id (shareid) 来取消分享.`,
 				Action: func(c *cli.Context) error {
-					if config.Config.ActiveUser() == nil {
-						fmt.Println("未登录账号")
+					if GetActiveUser() == nil {
+						printNotLogin()
 						return nil
 					}
-					if config.Config.ActiveUser().PanClient().WebapiPanClient() == nil {
+					if GetActiveUser().PanClient().WebapiPanClient() == nil {
 						fmt.Println("WEB客户端未登录，请登录后再使用该命令")
 						return nil
 					}
@@ -199,11 +198,11 @@ func CmdShareWeb() cli.Command {
 	aliyunpan share export -option 2 "d:\myfoler\share_list.csv"
 `,
 				Action: func(c *cli.Context) error {
-					if config.Config.ActiveUser() == nil {
-						fmt.Println("未登录账号")
+					if GetActiveUser() == nil {
+						printNotLogin()
 						return nil
 					}
-					if config.Config.ActiveUser().PanClient().WebapiPanClient() == nil {
+					if GetActiveUser().PanClient().WebapiPanClient() == nil {
 						fmt.Println("WEB客户端未登录，请登录后再使用该命令")
 						return nil
 					}
@@ -316,8 +315,10 @@ func RunShareList() {
 	records, err := activeUser.PanClient().WebapiPanClient().ShareLinkList(activeUser.UserId)
 	if err != nil {
 		fmt.Printf("获取分享列表失败: %s\n", err)
+		setJsonErr(err)
 		return
 	}
+	setJsonData(records)
 
 	tb := cmdtable.NewTable(os.Stdout)
 	tb.SetHeader([]string{"#", "ShARE_ID", "分享链接", "提取码", "文件名", "过期时间", "状态"})
@@ -357,6 +358,7 @@ func RunShareList() {
 func RunShareCancel(shareIdList []string) {
 	if len(shareIdList) == 0 {
 		fmt.Printf("取消分享操作失败, 没有任何 shareid\n")
+		setJsonError(JsonCodeBadArgs, "没有任何 shareid")
 		return
 	}
 
@@ -364,6 +366,7 @@ func RunShareCancel(shareIdList []string) {
 	r, err := activeUser.PanClient().WebapiPanClient().ShareLinkCancel(shareIdList)
 	if err != nil {
 		fmt.Printf("取消分享操作失败: %s\n", err)
+		setJsonErr(err)
 		return
 	}
 
@@ -371,6 +374,7 @@ func RunShareCancel(shareIdList []string) {
 		fmt.Printf("取消分享操作成功\n")
 	} else {
 		fmt.Printf("取消分享操作失败\n")
+		setJsonError(JsonCodeFailed, "取消分享操作失败")
 	}
 }
 
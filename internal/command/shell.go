@@ -0,0 +1,359 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/tickstep/aliyunpan/cmder"
+	"github.com/tickstep/aliyunpan/cmder/cmdliner/args"
+	"github.com/tickstep/aliyunpan/cmder/cmdtable"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/urfave/cli"
+)
+
+const (
+	// maxAliasExpandDepth 别名嵌套展开的最大层数
+	maxAliasExpandDepth = 10
+)
+
+type (
+	// shellFilter 交互命令行的内部管道命令，对上一个命令的输出按行处理
+	shellFilter func(lines []string) []string
+)
+
+var (
+	aliasNamePattern = regexp.MustCompile(`^[A-Za-z0-9_\-.]+$`)
+)
+
+// loadCommandAliases 读取命令别名
+func loadCommandAliases() map[string]string {
+	aliases := map[string]string{}
+	data, err := ioutil.ReadFile(config.GetCommandAliasFile())
+	if err != nil {
+		return aliases
+	}
+	if err = json.Unmarshal(data, &aliases); err != nil {
+		fmt.Printf("读取命令别名失败: %s\n", err)
+	}
+	return aliases
+}
+
+// saveCommandAliases 保存命令别名
+func saveCommandAliases(aliases map[string]string) error {
+	data, err := json.MarshalIndent(aliases, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(config.GetCommandAliasFile(), data, 0600)
+}
+
+// CommandAliasNames 全部命令别名，用于交互命令行的补全
+func CommandAliasNames() []string {
+	names := []string{}
+	for name := range loadCommandAliases() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ExpandCommandAlias 展开命令行第一个单词对应的别名，别名的内容可以包含管道以及其他别名
+func ExpandCommandAlias(line string) string {
+	aliases := loadCommandAliases()
+	if len(aliases) == 0 {
+		return line
+	}
+	expanded := map[string]bool{}
+	for i := 0; i < maxAliasExpandDepth; i++ {
+		line = strings.TrimSpace(line)
+		name := line
+		if idx := strings.IndexFunc(line, func(r rune) bool { return r == ' ' || r == '\t' || r == '|' }); idx >= 0 {
+			name = line[:idx]
+		}
+		value, ok := aliases[name]
+		if !ok || expanded[name] {
+			break
+		}
+		expanded[name] = true
+		line = value + line[len(name):]
+	}
+	return line
+}
+
+// ParseShellFilters 解析管道后面的内部命令，支持 grep、head、tail、sort、wc
+func ParseShellFilters(segments []string) ([]shellFilter, error) {
+	filters := []shellFilter{}
+	for _, segment := range segments {
+		cmdArgs := args.Parse(segment)
+		if len(cmdArgs) == 0 {
+			return nil, fmt.Errorf("管道后面缺少命令")
+		}
+		var (
+			filter shellFilter
+			err    error
+		)
+		switch cmdArgs[0] {
+		case "grep":
+			filter, err = grepFilter(cmdArgs[1:])
+		case "head", "tail":
+			filter, err = headTailFilter(cmdArgs[0], cmdArgs[1:])
+		case "sort":
+			filter, err = sortFilter(cmdArgs[1:])
+		case "wc":
+			filter = func(lines []string) []string {
+				return []string{strconv.Itoa(len(lines))}
+			}
+		default:
+			err = fmt.Errorf("不支持的管道命令 %s, 支持: grep, head, tail, sort, wc", cmdArgs[0])
+		}
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+	}
+	return filters, nil
+}
+
+// grepFilter grep [-i] [-v] pattern，pattern为正则表达式
+func grepFilter(cmdArgs []string) (shellFilter, error) {
+	ignoreCase, invert, pattern := false, false, ""
+	for _, arg := range cmdArgs {
+		switch arg {
+		case "-i":
+			ignoreCase = true
+		case "-v":
+			invert = true
+		case "-iv", "-vi":
+			ignoreCase, invert = true, true
+		default:
+			if pattern != "" {
+				return nil, fmt.Errorf("grep 只支持一个匹配规则")
+			}
+			pattern = arg
+		}
+	}
+	if pattern == "" {
+		return nil, fmt.Errorf("grep 缺少匹配规则")
+	}
+	if ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("grep 匹配规则错误: %s", err)
+	}
+	return func(lines []string) []string {
+		result := []string{}
+		for _, line := range lines {
+			if re.MatchString(line) != invert {
+				result = append(result, line)
+			}
+		}
+		return result
+	}, nil
+}
+
+// headTailFilter head/tail [-n N | -N]，默认10行
+func headTailFilter(name string, cmdArgs []string) (shellFilter, error) {
+	n := 10
+	for i := 0; i < len(cmdArgs); i++ {
+		value := strings.TrimPrefix(cmdArgs[i], "-")
+		if cmdArgs[i] == "-n" {
+			if i+1 >= len(cmdArgs) {
+				return nil, fmt.Errorf("%s 缺少行数", name)
+			}
+			i++
+			value = cmdArgs[i]
+		}
+		num, err := strconv.Atoi(value)
+		if err != nil || num < 0 {
+			return nil, fmt.Errorf("%s 行数错误: %s", name, cmdArgs[i])
+		}
+		n = num
+	}
+	return func(lines []string) []string {
+		if len(lines) <= n {
+			return lines
+		}
+		if name == "head" {
+			return lines[:n]
+		}
+		return lines[len(lines)-n:]
+	}, nil
+}
+
+// sortFilter sort [-r]
+func sortFilter(cmdArgs []string) (shellFilter, error) {
+	reverse := false
+	for _, arg := range cmdArgs {
+		if arg != "-r" {
+			return nil, fmt.Errorf("sort 不支持参数 %s", arg)
+		}
+		reverse = true
+	}
+	return func(lines []string) []string {
+		result := append([]string{}, lines...)
+		sort.SliceStable(result, func(i, j int) bool {
+			if reverse {
+				return result[i] > result[j]
+			}
+			return result[i] < result[j]
+		})
+		return result
+	}, nil
+}
+
+// RunWithShellFilters 执行命令，标准输出经过管道命令处理后再输出。没有管道命令时直接执行
+func RunWithShellFilters(filters []shellFilter, run func()) {
+	if len(filters) == 0 {
+		run()
+		return
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		fmt.Printf("创建管道失败: %s\n", err)
+		return
+	}
+	stdout := os.Stdout
+	output := make(chan []byte, 1)
+	go func() {
+		data, _ := io.ReadAll(r)
+		output <- data
+	}()
+	func() {
+		os.Stdout = w
+		defer func() {
+			os.Stdout = stdout
+			w.Close()
+		}()
+		run()
+	}()
+	data := <-output
+	r.Close()
+
+	lines := []string{}
+	if text := strings.TrimRight(string(data), "\r\n"); text != "" {
+		lines = strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	}
+	for _, filter := range filters {
+		lines = filter(lines)
+	}
+	for _, line := range lines {
+		fmt.Println(line)
+	}
+}
+
+// CmdCommandAlias 交互命令行的命令别名
+func CmdCommandAlias() cli.Command {
+	return cli.Command{
+		Name:      "cmdalias",
+		Usage:     "设置交互命令行的命令别名",
+		UsageText: cmder.App().Name + " cmdalias [名称=命令] [-d 名称]",
+		Description: `
+	把常用的多参数命令设置为别名，在交互命令行中输入别名即可执行对应的命令，别名后面的参数追加到命令的后面。
+	别名的内容可以包含管道以及其他别名。不带参数时列出全部别名。
+
+	示例:
+
+	设置别名 ll 代表 ls -l
+	aliyunpan cmdalias ll="ls -l"
+
+	设置别名 photos 上传照片目录
+	aliyunpan cmdalias photos="upload -exn .DS_Store D:/Photos /照片"
+
+	删除别名 ll
+	aliyunpan cmdalias -d ll
+
+	列出全部别名
+	aliyunpan cmdalias
+`,
+		Category: "其他",
+		Action: func(c *cli.Context) error {
+			aliases := loadCommandAliases()
+			if c.IsSet("d") {
+				for _, name := range append([]string{c.String("d")}, c.Args()...) {
+					if _, ok := aliases[name]; !ok {
+						fmt.Printf("别名 %s 不存在\n", name)
+						continue
+					}
+					delete(aliases, name)
+				}
+				if err := saveCommandAliases(aliases); err != nil {
+					fmt.Printf("保存命令别名失败: %s\n", err)
+				}
+				return nil
+			}
+			if c.NArg() == 0 {
+				names := make([]string, 0, len(aliases))
+				for name := range aliases {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				tb := cmdtable.NewTable(os.Stdout)
+				tb.SetHeader([]string{"别名", "命令"})
+				tb.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+				tb.SetColumnAlignment([]int{tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT})
+				for _, name := range names {
+					tb.Append([]string{name, aliases[name]})
+				}
+				tb.Render()
+				return nil
+			}
+			for _, item := range c.Args() {
+				idx := strings.Index(item, "=")
+				if idx <= 0 {
+					if value, ok := aliases[item]; ok {
+						fmt.Printf("%s=%s\n", item, value)
+					} else {
+						fmt.Printf("别名 %s 不存在\n", item)
+					}
+					continue
+				}
+				name, value := item[:idx], strings.TrimSpace(item[idx+1:])
+				if !aliasNamePattern.MatchString(name) {
+					fmt.Printf("别名 %s 错误, 只能包含字母、数字、下划线、短横线和点\n", name)
+					return nil
+				}
+				if value == "" {
+					fmt.Printf("别名 %s 的命令不能为空\n", name)
+					return nil
+				}
+				if cmder.App().Command(name) != nil {
+					fmt.Printf("提示: 别名 %s 和已有的命令重名, 交互命令行中优先使用别名\n", name)
+				}
+				aliases[name] = value
+			}
+			if err := saveCommandAliases(aliases); err != nil {
+				fmt.Printf("保存命令别名失败: %s\n", err)
+			}
+			return nil
+		},
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "d",
+				Usage: "删除别名",
+			},
+		},
+	}
+}
@@ -0,0 +1,55 @@
+package command
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tickstep/aliyunpan/cmder/cmdliner/args"
+	"github.com/tickstep/aliyunpan/internal/config"
+)
+
+func TestShellFilters(t *testing.T) {
+	segments := args.SplitPipe(`ls -l | grep -i "\.MP4|\.mov" | sort -r | head -n 2`)
+	if len(segments) != 4 || segments[0] != "ls -l" {
+		t.Fatalf("unexpected segments: %q", segments)
+	}
+	filters, err := ParseShellFilters(segments[1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := []string{"a.mp4", "b.txt", "c.MOV", "d.mp4"}
+	for _, f := range filters {
+		lines = f(lines)
+	}
+	if !reflect.DeepEqual(lines, []string{"d.mp4", "c.MOV"}) {
+		t.Fatalf("unexpected result: %q", lines)
+	}
+
+	if _, err = ParseShellFilters([]string{"awk '{print $1}'"}); err == nil {
+		t.Fatal("expect unsupported filter error")
+	}
+}
+
+func TestExpandCommandAlias(t *testing.T) {
+	t.Setenv(config.EnvConfigDir, t.TempDir())
+	if err := saveCommandAliases(map[string]string{
+		"ll":   "ls -l",
+		"lm":   "ll | grep mp4",
+		"loop": "loop -a",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]string{
+		"ll /照片":  "ls -l /照片",
+		"lm":      "ls -l | grep mp4",
+		"loop":    "loop -a",
+		"llx":     "llx",
+		"ll|wc":   "ls -l|wc",
+		"  cd /a": "cd /a",
+	}
+	for line, want := range cases {
+		if got := ExpandCommandAlias(line); got != want {
+			t.Errorf("ExpandCommandAlias(%q) = %q, want %q", line, got, want)
+		}
+	}
+}
@@ -18,9 +18,12 @@ import (
 	"github.com/tickstep/aliyunpan-api/aliyunpan"
 	"github.com/tickstep/aliyunpan/cmder"
 	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/functions"
 	"github.com/tickstep/aliyunpan/internal/global"
+	"github.com/tickstep/aliyunpan/internal/localfile"
 	"github.com/tickstep/aliyunpan/internal/log"
 	"github.com/tickstep/aliyunpan/internal/syncdrive"
+	"github.com/tickstep/aliyunpan/internal/systemd"
 	"github.com/tickstep/aliyunpan/internal/utils"
 	"github.com/tickstep/library-go/converter"
 	"github.com/tickstep/library-go/logger"
@@ -37,7 +40,7 @@ func CmdSync() cli.Command {
 		Usage:     "同步备份功能(Beta)",
 		UsageText: cmder.App().Name + " sync",
 		Description: `
-    备份功能。支持备份本地文件到云盘，备份云盘文件到本地两种模式。支持JavaScript插件对备份文件进行过滤。
+    备份功能。支持备份本地文件到云盘，备份云盘文件到本地，以及双向同步三种模式。支持JavaScript插件对备份文件进行过滤。
     指定本地目录和对应的一个网盘目录，以备份文件。网盘目录必须和本地目录独占使用，不要用作其他用途，不然备份可能会有问题。
 
 	备份功能支持以下模式：
@@ -45,9 +48,14 @@ func CmdSync() cli.Command {
        备份本地文件，即上传本地文件到网盘，始终保持本地文件有一个完整的备份在网盘
 	2. download 
        备份云盘文件，即下载网盘文件到本地，始终保持网盘的文件有一个完整的备份在本地
+	3. bidirectional
+       双向同步，本地和网盘任意一端新增、修改的文件都会同步到另一端。两端都修改了同一个文件时按照冲突处理策略处理
 
 	请输入以下命令查看如何配置和启动：
     aliyunpan sync start -h
+
+	误删本地数据后，可以使用还原模式把本地目录还原为和网盘一致：
+    aliyunpan sync restore -h
 `,
 		Category: "阿里云盘",
 		Before:   ReloadConfigFunc,
@@ -81,9 +89,12 @@ func CmdSync() cli.Command {
 name - 任务名称
 localFolderPath - 本地目录
 panFolderPath - 网盘目录
-mode - 备份模式，支持两种: upload(备份本地文件到云盘),download(备份云盘文件到本地)
-policy - 备份策略, 支持两种: exclusive(排他备份文件，目标目录多余的文件会被删除),increment(增量备份文件，目标目录多余的文件不会被删除)
+mode - 备份模式，支持三种: upload(备份本地文件到云盘),download(备份云盘文件到本地),bidirectional(双向同步)
+policy - 备份策略, 支持两种: exclusive(排他备份文件，目标目录多余的文件会被删除),increment(增量备份文件，目标目录多余的文件不会被删除)。双向同步模式下exclusive代表一端删除的文件另一端也会删除
+conflict - 冲突处理策略，只对双向同步模式有效，支持四种: newest(修改时间较新的优先),local(本地优先),cloud(云盘优先),keep-both(两者都保留，本地文件重命名后上传)
 driveName - 网盘名称，backup(备份盘)，resource(资源盘)
+symlink - 本地软链接处理策略，支持三种: skip(跳过，默认),follow(跟随软链接同步指向的文件或者文件夹),manifest(不同步，记录到同步数据库目录的 symlinks.json 清单文件中)
+excludeHidden - 是否不同步隐藏文件和文件夹，true/false，默认false。socket、设备文件、命名管道等特殊文件总是跳过
     
 	例子:
 	1. 查看帮助
@@ -105,10 +116,20 @@ driveName - 网盘名称，backup(备份盘)，resource(资源盘)
 	6. 使用配置文件启动同步备份服务，并配置下载并发为2，上传并发为1，下载分片大小为256KB，上传分片大小为1MB
 	aliyunpan sync start -dp 2 -up 1 -dbs 256 -ubs 1024
 
+	7. 使用命令行配置启动双向同步服务，本地目录 D:\tickstep\Documents\设计文档 和云盘目录 /sync_drive/我的文档 保持一致，两端都修改的文件以修改时间较新的为准
+	aliyunpan sync start -ldir "D:\tickstep\Documents\设计文档" -pdir "/sync_drive/我的文档" -mode "bidirectional" -conflict "newest"
+
+	8. 使用命令行配置启动同步备份服务，实时监听本地文件变更，只上传发生变化的文件，每60分钟进行一次全量扫描
+	aliyunpan sync start -ldir "/home/tickstep/Documents" -pdir "/sync_drive/我的文档" -mode "upload" -watch -fsit 60
+
+	9. 只对比文件，输出将要上传、下载、删除的文件清单，不实际执行。可以配合 --json 输出JSON格式的差异报告
+	aliyunpan sync start -dry-run
+	aliyunpan --json sync start -ldir "/home/tickstep/Documents" -pdir "/sync_drive/我的文档" -mode "upload" -policy "exclusive" -dry-run
+
 `,
 				Action: func(c *cli.Context) error {
-					if config.Config.ActiveUser() == nil {
-						fmt.Println("未登录账号")
+					if GetActiveUser() == nil {
+						printNotLogin()
 						return nil
 					}
 					activeUser := GetActiveUser()
@@ -196,7 +217,7 @@ driveName - 网盘名称，backup(备份盘)，resource(资源盘)
 							task.Mode = syncdrive.Upload
 						} else if mode == string(syncdrive.Download) {
 							task.Mode = syncdrive.Download
-						} else if mode == string(syncdrive.SyncTwoWay) {
+						} else if mode == string(syncdrive.SyncTwoWay) || mode == string(syncdrive.SyncBidirectional) {
 							task.Mode = syncdrive.SyncTwoWay
 						} else {
 							task.Mode = syncdrive.Upload
@@ -206,6 +227,19 @@ driveName - 网盘名称，backup(备份盘)，resource(资源盘)
 						} else {
 							task.Policy = syncdrive.SyncPolicyIncrement
 						}
+						conflictPolicy, e := syncdrive.ParseSyncConflictPolicy(c.String("conflict"))
+						if e != nil {
+							fmt.Println(e)
+							return nil
+						}
+						task.ConflictPolicy = conflictPolicy
+						symlinkPolicy, e := localfile.ParseSymlinkPolicy(c.String("symlink"), localfile.SymlinkSkip)
+						if e != nil {
+							fmt.Println(e)
+							return nil
+						}
+						task.Symlink = symlinkPolicy
+						task.ExcludeHidden = c.Bool("exclude-hidden")
 						task.Name = path.Base(task.LocalFolderPath)
 						task.Id = utils.Md5Str(task.LocalFolderPath)
 						task.Priority = syncOpt
@@ -235,7 +269,12 @@ driveName - 网盘名称，backup(备份盘)，resource(资源盘)
 						// 默认1分钟
 						scanIntervalTime = 60
 					}
-					RunSync(task, cycleMode, dp, up, downloadBlockSize, uploadBlockSize, syncOpt, c.Int("ldt"), scanIntervalTime)
+					fullScanIntervalTime := int64(c.Int("fsit") * 60)
+					if c.Bool("dry-run") {
+						RunSyncDryRun(task, downloadBlockSize, uploadBlockSize, syncOpt)
+						return nil
+					}
+					RunSync(task, cycleMode, dp, up, downloadBlockSize, uploadBlockSize, syncOpt, c.Int("ldt"), scanIntervalTime, c.Bool("watch"), fullScanIntervalTime)
 					return nil
 				},
 				Flags: []cli.Flag{
@@ -254,7 +293,7 @@ driveName - 网盘名称，backup(备份盘)，resource(资源盘)
 					},
 					cli.StringFlag{
 						Name:  "mode",
-						Usage: "备份模式, 支持两种: upload(备份本地文件到云盘),download(备份云盘文件到本地)",
+						Usage: "备份模式, 支持三种: upload(备份本地文件到云盘),download(备份云盘文件到本地),bidirectional(双向同步)",
 						Value: "upload",
 					},
 					cli.StringFlag{
@@ -262,6 +301,20 @@ driveName - 网盘名称，backup(备份盘)，resource(资源盘)
 						Usage: "备份策略, 支持两种: exclusive(排他备份文件，目标目录多余的文件会被删除),increment(增量备份文件，目标目录多余的文件不会被删除)",
 						Value: "increment",
 					},
+					cli.StringFlag{
+						Name:  "conflict",
+						Usage: "冲突处理策略, 只对bidirectional模式有效，本地和云盘文件都被修改时使用。支持四种: newest(修改时间较新的优先),local(本地优先),cloud(云盘优先),keep-both(两者都保留)",
+						Value: "newest",
+					},
+					cli.StringFlag{
+						Name:  "symlink",
+						Usage: "本地软链接处理策略, 支持三种: skip(跳过),follow(跟随软链接同步指向的文件或者文件夹),manifest(不同步，记录到清单文件)。使用配置文件启动时请在配置文件中设置",
+						Value: "skip",
+					},
+					cli.BoolFlag{
+						Name:  "exclude-hidden",
+						Usage: "不同步隐藏文件和文件夹。使用配置文件启动时请在配置文件中设置",
+					},
 					//cli.StringFlag{
 					//	Name:  "pri",
 					//	Usage: "同步优先级，只对sync模式有效。当网盘和本地存在同名文件，优先使用哪个，选项支持三种: time-时间优先，local-本地优先，pan-网盘优先",
@@ -307,6 +360,141 @@ driveName - 网盘名称，backup(备份盘)，resource(资源盘)
 						Usage: "scan interval time，扫描文件间隔时间，单位：分钟。",
 						Value: 1,
 					},
+					cli.BoolFlag{
+						Name:  "watch",
+						Usage: "实时监听本地文件变更，只扫描发生变化的文件夹，只对upload和bidirectional模式有效。目前只支持Linux系统，其他系统仍然使用定时全量扫描",
+					},
+					cli.IntFlag{
+						Name:  "fsit",
+						Usage: "full scan interval time，监听模式下全量扫描间隔时间，单位：分钟。用于兜底保证本地和云盘文件一致",
+						Value: 30,
+					},
+					cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "只对比本地和云盘文件，输出将要上传、下载、删除的文件清单，不实际执行，也不修改同步数据库",
+					},
+				},
+			},
+			{
+				Name:      "restore",
+				Usage:     "以网盘为准还原本地目录",
+				UsageText: cmder.App().Name + " sync restore [arguments...]",
+				Description: `
+以网盘目录为准，把本地目录还原为和网盘一致：下载本地缺失的文件，覆盖本地被修改的文件（会实际计算本地文件SHA1进行校验），
+可选删除本地多余的文件。还原只运行一次，完成后输出还原报告。
+
+	例子:
+	1. 将本地目录 D:\tickstep\Documents\设计文档 还原为和云盘目录 /sync_drive/我的文档 一致，保留本地多余的文件
+	aliyunpan sync restore -ldir "D:\tickstep\Documents\设计文档" -pdir "/sync_drive/我的文档"
+
+	2. 将本地目录 D:\tickstep\Documents\设计文档 还原为和云盘目录 /sync_drive/我的文档 一致，并删除本地多余的文件
+	aliyunpan sync restore -ldir "D:\tickstep\Documents\设计文档" -pdir "/sync_drive/我的文档" -delete
+`,
+				Action: func(c *cli.Context) error {
+					if GetActiveUser() == nil {
+						printNotLogin()
+						return nil
+					}
+					activeUser := GetActiveUser()
+
+					if c.String("log") == "true" {
+						syncdrive.LogPrompt = true
+					} else {
+						syncdrive.LogPrompt = false
+					}
+
+					localDir := c.String("ldir")
+					panDir := c.String("pdir")
+					if localDir == "" || panDir == "" {
+						cli.ShowCommandHelp(c, c.Command.Name)
+						return nil
+					}
+					if !utils.IsLocalAbsPath(localDir) {
+						pwd, _ := os.Getwd()
+						localDir = path.Join(pwd, path.Clean(localDir))
+					}
+					panDir = activeUser.PathJoin(activeUser.ActiveDriveId, panDir)
+					if !utils.IsPanAbsPath(panDir) {
+						fmt.Println("网盘目录请指定绝对路径")
+						return nil
+					}
+
+					dp := c.Int("dp")
+					if dp == 0 {
+						dp = config.Config.MaxDownloadParallel
+					}
+					if dp == 0 {
+						dp = 2
+					}
+					downloadBlockSize := int64(c.Int("dbs") * 1024)
+					if downloadBlockSize == 0 {
+						downloadBlockSize = int64(config.Config.CacheSize)
+					}
+					if downloadBlockSize == 0 {
+						downloadBlockSize = int64(256 * 1024)
+					}
+
+					task := &syncdrive.SyncTask{}
+					task.LocalFolderPath = path.Clean(strings.ReplaceAll(localDir, "\\", "/"))
+					task.PanFolderPath = panDir
+					task.Mode = syncdrive.Download
+					task.Policy = syncdrive.SyncPolicyIncrement
+					if c.Bool("delete") {
+						task.Policy = syncdrive.SyncPolicyExclusive
+					}
+					task.RestoreMode = true
+					task.Name = path.Base(task.LocalFolderPath)
+					// 使用独立的任务ID，避免和备份任务的数据库混用
+					task.Id = utils.Md5Str("restore:" + task.LocalFolderPath)
+					task.Priority = syncdrive.SyncPriorityTimestampFirst
+					task.UserId = activeUser.UserId
+					task.DriveName = c.String("drive")
+					if strings.ToLower(task.DriveName) == "resource" {
+						task.DriveId = activeUser.DriveList.GetResourceDriveId()
+					} else {
+						task.DriveName = "backup"
+						task.DriveId = activeUser.DriveList.GetFileDriveId()
+					}
+
+					RunSync(task, syncdrive.CycleOneTime, dp, 1, downloadBlockSize, aliyunpan.DefaultChunkSize, syncdrive.SyncPriorityTimestampFirst, 0, 60, false, 0)
+					if report := task.RestoreReport(); report != nil {
+						report.Print(os.Stdout)
+					}
+					return nil
+				},
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "drive",
+						Usage: "drive name, 网盘名称，backup(备份盘)，resource(资源盘)",
+						Value: "backup",
+					},
+					cli.StringFlag{
+						Name:  "ldir",
+						Usage: "local dir, 需要还原的本地文件夹完整路径",
+					},
+					cli.StringFlag{
+						Name:  "pdir",
+						Usage: "pan dir, 作为还原依据的云盘文件夹完整路径",
+					},
+					cli.BoolFlag{
+						Name:  "delete",
+						Usage: "删除本地多余的文件，即云盘中不存在的文件",
+					},
+					cli.IntFlag{
+						Name:  "dp",
+						Usage: "download parallel, 下载并发数量。0代表跟从配置文件设置（取值范围:1 ~ 10）",
+						Value: 0,
+					},
+					cli.IntFlag{
+						Name:  "dbs",
+						Usage: "download block size，下载分片大小，单位KB。推荐值：1024 ~ 10240",
+						Value: 1024,
+					},
+					cli.StringFlag{
+						Name:  "log",
+						Usage: "是否显示文件还原过程日志，true-显示，false-不显示",
+						Value: "false",
+					},
 				},
 			},
 		},
@@ -314,7 +502,7 @@ driveName - 网盘名称，backup(备份盘)，resource(资源盘)
 }
 
 func RunSync(defaultTask *syncdrive.SyncTask, cycleMode syncdrive.CycleMode, fileDownloadParallel, fileUploadParallel int, downloadBlockSize, uploadBlockSize int64,
-	flag syncdrive.SyncPriorityOption, localDelayTime int, scanTimeInterval int64) {
+	flag syncdrive.SyncPriorityOption, localDelayTime int, scanTimeInterval int64, localWatch bool, fullScanInterval int64) {
 	maxDownloadRate := config.Config.MaxDownloadRate
 	maxUploadRate := config.Config.MaxUploadRate
 	activeUser := GetActiveUser()
@@ -356,6 +544,9 @@ func RunSync(defaultTask *syncdrive.SyncTask, cycleMode syncdrive.CycleMode, fil
 
 	// 文件同步记录器
 	fileRecorder := log.NewFileRecorder(config.GetLogDir() + "/sync_file_records.csv")
+	fileRecorder.SetTargets("sync", config.Config.OpenLogTargets())
+	fileRecorder.SetHistory(log.NewTransferHistory(config.GetTransferHistoryFilePath()))
+	defer fileRecorder.Close()
 
 	option := syncdrive.SyncOption{
 		FileDownloadParallel:              fileDownloadParallel,
@@ -364,10 +555,22 @@ func RunSync(defaultTask *syncdrive.SyncTask, cycleMode syncdrive.CycleMode, fil
 		FileUploadBlockSize:               uploadBlockSize,
 		MaxDownloadRate:                   maxDownloadRate,
 		MaxUploadRate:                     maxUploadRate,
+		UploadRateFunc:                    uploadRateFunc(),
 		SyncPriority:                      flag,
 		LocalFileModifiedCheckIntervalSec: localDelayTime,
+		LocalWatch:                        localWatch,
+		LocalFullScanIntervalSec:          fullScanInterval,
 		FileRecorder:                      fileRecorder,
+		NotifyDigest:                      newNotifyDigest(),
+		Webhook:                           newNotifyWebhook(),
+		ModTimeTolerance:                  int64(config.Config.ModTimeTolerance),
 	}
+	stopDigest := runNotifyDigest(option.NotifyDigest)
+	defer stopDigest()
+	stopMetrics := startMetricsServer()
+	defer stopMetrics()
+	// 校准服务器时间，避免本地时钟偏差导致上传、下载链接签名校验失败
+	functions.CalibrateServerTime()
 	syncMgr := syncdrive.NewSyncTaskManager(activeUser, panClient, syncFolderRootPath, option)
 	syncConfigFile := syncMgr.ConfigFilePath()
 	if tasks != nil {
@@ -381,6 +584,15 @@ func RunSync(defaultTask *syncdrive.SyncTask, cycleMode syncdrive.CycleMode, fil
 		return
 	}
 
+	// 以systemd服务运行时通知启动完成，并按照看门狗时间发送心跳。任务卡死时停止心跳，由systemd重启服务
+	if ok, _ := systemd.Notify(systemd.StateReady); ok {
+		logger.Verboseln("notify systemd: service is ready")
+	}
+	watchdogStop := make(chan struct{})
+	go systemd.RunWatchdog(func() bool {
+		return syncMgr.IsAllTaskActive(systemd.WatchdogInterval())
+	}, watchdogStop)
+
 	_, ok := os.LookupEnv("ALIYUNPAN_DOCKER")
 	if ok {
 		// in docker container
@@ -429,7 +641,51 @@ func RunSync(defaultTask *syncdrive.SyncTask, cycleMode syncdrive.CycleMode, fil
 	}
 
 	fmt.Println("正在退出同步备份任务，请稍等...")
+	close(watchdogStop)
+	systemd.Notify(systemd.StateStopping)
 
 	// stop task
 	syncMgr.Stop()
 }
+
+// RunSyncDryRun 只扫描对比一次本地和云盘文件，输出差异报告，不实际上传、下载或删除文件
+func RunSyncDryRun(defaultTask *syncdrive.SyncTask, downloadBlockSize, uploadBlockSize int64, flag syncdrive.SyncPriorityOption) {
+	activeUser := GetActiveUser()
+	panClient := activeUser.PanClient()
+	panClient.OpenapiPanClient().ClearCache()
+	panClient.OpenapiPanClient().DisableCache()
+
+	var tasks []*syncdrive.SyncTask
+	if defaultTask != nil {
+		tasks = []*syncdrive.SyncTask{defaultTask}
+	}
+
+	// 扫描过程日志会输出"成功删除"等提示，dry-run模式下关闭
+	syncdrive.LogPrompt = false
+	option := syncdrive.SyncOption{
+		FileDownloadParallel:  1,
+		FileUploadParallel:    1,
+		FileDownloadBlockSize: downloadBlockSize,
+		FileUploadBlockSize:   uploadBlockSize,
+		SyncPriority:          flag,
+		DryRun:                true,
+		ModTimeTolerance:      int64(config.Config.ModTimeTolerance),
+	}
+	syncMgr := syncdrive.NewSyncTaskManager(activeUser, panClient, config.GetSyncDriveDir(), option)
+	fmt.Println("[dry-run] 正在对比本地和云盘文件，不会实际上传、下载或删除文件...")
+	if _, e := syncMgr.Start(tasks, syncdrive.CycleOneTime, 60); e != nil {
+		fmt.Println("启动任务失败：", e)
+		setJsonErr(e)
+		return
+	}
+	for !syncMgr.IsAllTaskCompletely() {
+		time.Sleep(1 * time.Second)
+	}
+	syncMgr.Stop()
+
+	reports := syncMgr.DryRunReports()
+	for _, report := range reports {
+		report.Print(os.Stdout)
+	}
+	setJsonData(reports)
+}
@@ -0,0 +1,297 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+
+	"github.com/tickstep/aliyunpan/cmder"
+	"github.com/tickstep/aliyunpan/cmder/cmdtable"
+	"github.com/tickstep/aliyunpan/internal/functions/pandownload"
+	"github.com/tickstep/aliyunpan/internal/functions/pantag"
+	"github.com/tickstep/aliyunpan/internal/utils"
+	"github.com/urfave/cli"
+)
+
+var tagDriveIdFlag = cli.StringFlag{
+	Name:  "driveId",
+	Usage: "网盘ID",
+	Value: "",
+}
+
+func CmdTag() cli.Command {
+	return cli.Command{
+		Name:      "tag",
+		Usage:     "网盘文件标签",
+		UsageText: cmder.App().Name + " tag",
+		Description: `
+	给网盘文件/目录打上自定义标签，按标签列出、下载、分享文件。
+	标签保存在本地的账号数据目录中，不会同步到网盘。文件在网盘中移动后，重新打一次标签即可更新路径。
+
+	示例:
+
+	给 /我的资源 目录下所有mp4文件打上 电影 标签，支持通配符
+	aliyunpan tag add 电影 /我的资源/*.mp4
+
+	移除 /我的资源/1.mp4 的 电影 标签
+	aliyunpan tag rm 电影 /我的资源/1.mp4
+
+	列出所有标签
+	aliyunpan tag ls
+
+	列出 电影 标签下的所有文件
+	aliyunpan tag ls 电影
+
+	下载 电影 标签下的所有文件到 d:/panfile
+	aliyunpan tag download --saveto d:/panfile 电影
+
+	创建 电影 标签下所有文件的快传链接
+	aliyunpan tag share 电影
+`,
+		Category: "阿里云盘",
+		Before:   ReloadConfigFunc,
+		Action: func(c *cli.Context) error {
+			cli.ShowCommandHelp(c, c.Command.Name)
+			return nil
+		},
+		Subcommands: []cli.Command{
+			{
+				Name:      "add",
+				Usage:     "给文件/目录打标签",
+				UsageText: cmder.App().Name + " tag add <标签> <文件/目录1> <文件/目录2> ...",
+				Action: func(c *cli.Context) error {
+					if c.NArg() < 2 {
+						cli.ShowCommandHelp(c, c.Command.Name)
+						return nil
+					}
+					if GetActiveUser() == nil {
+						printNotLogin()
+						return nil
+					}
+					RunTagSet(parseDriveId(c), c.Args().Get(0), c.Args()[1:], true)
+					return nil
+				},
+				Flags: []cli.Flag{tagDriveIdFlag},
+			},
+			{
+				Name:      "rm",
+				Usage:     "移除文件/目录的标签",
+				UsageText: cmder.App().Name + " tag rm <标签> <文件/目录1> <文件/目录2> ...",
+				Action: func(c *cli.Context) error {
+					if c.NArg() < 2 {
+						cli.ShowCommandHelp(c, c.Command.Name)
+						return nil
+					}
+					if GetActiveUser() == nil {
+						printNotLogin()
+						return nil
+					}
+					RunTagSet(parseDriveId(c), c.Args().Get(0), c.Args()[1:], false)
+					return nil
+				},
+				Flags: []cli.Flag{tagDriveIdFlag},
+			},
+			{
+				Name:      "ls",
+				Usage:     "列出所有标签，或者列出标签下的文件",
+				UsageText: cmder.App().Name + " tag ls [标签]",
+				Action: func(c *cli.Context) error {
+					if GetActiveUser() == nil {
+						printNotLogin()
+						return nil
+					}
+					RunTagList(parseDriveId(c), c.Args().Get(0))
+					return nil
+				},
+				Flags: []cli.Flag{tagDriveIdFlag},
+			},
+			{
+				Name:      "download",
+				Usage:     "下载标签下的所有文件",
+				UsageText: cmder.App().Name + " tag download <标签>",
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 1 {
+						cli.ShowCommandHelp(c, c.Command.Name)
+						return nil
+					}
+					if GetActiveUser() == nil {
+						printNotLogin()
+						return nil
+					}
+					driveId := parseDriveId(c)
+					paths := tagFilePaths(driveId, c.Args().Get(0))
+					if len(paths) == 0 {
+						return nil
+					}
+					saveTo := ""
+					if c.String("saveto") != "" {
+						saveTo = filepath.Clean(c.String("saveto"))
+					}
+					control, stopInterrupt := newInterruptControl("下载")
+					defer stopInterrupt()
+					RunDownload(paths, &DownloadOptions{
+						DownloadActionId: utils.UuidStr(),
+						OnExist:          pandownload.OnExistSkip,
+						SaveTo:           saveTo,
+						MaxRetry:         pandownload.DefaultDownloadMaxRetry,
+						ShowProgress:     true,
+						DriveId:          driveId,
+						Control:          control,
+					})
+					return nil
+				},
+				Flags: []cli.Flag{
+					tagDriveIdFlag,
+					cli.StringFlag{
+						Name:  "saveto",
+						Usage: "将下载的文件直接保存到指定的目录",
+					},
+				},
+			},
+			{
+				Name:      "share",
+				Usage:     "分享标签下的所有文件",
+				UsageText: cmder.App().Name + " tag share <标签>",
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 1 {
+						cli.ShowCommandHelp(c, c.Command.Name)
+						return nil
+					}
+					if GetActiveUser() == nil {
+						printNotLogin()
+						return nil
+					}
+					modeFlag, et, sharePwd, ok := parseShareFlags(c)
+					if !ok {
+						return nil
+					}
+					driveId := parseDriveId(c)
+					paths := tagFilePaths(driveId, c.Args().Get(0))
+					if len(paths) == 0 {
+						return nil
+					}
+					RunOpenShareSet(modeFlag, driveId, paths, et, sharePwd)
+					return nil
+				},
+				Flags: append([]cli.Flag{tagDriveIdFlag}, shareFlags...),
+			},
+		},
+	}
+}
+
+// RunTagSet 给文件打标签或者移除标签
+func RunTagSet(driveId, tag string, paths []string, isAdd bool) {
+	tag = pantag.NormalizeTag(tag)
+	if tag == "" {
+		fmt.Println("标签不能为空")
+		return
+	}
+	tagIndex, err := pantag.LoadTagIndex(activeUserDataDir())
+	if err != nil {
+		fmt.Printf("读取标签索引失败: %s\n", err)
+		return
+	}
+
+	activeUser := GetActiveUser()
+	count := 0
+	for _, p := range paths {
+		absolutePath := path.Clean(activeUser.PathJoin(driveId, p))
+		fileList, err1 := matchPathByShellPattern(driveId, absolutePath)
+		if err1 != nil || len(fileList) == 0 {
+			fmt.Println("文件不存在: " + absolutePath)
+			continue
+		}
+		for _, f := range fileList {
+			if isAdd {
+				if tagIndex.AddTag(driveId, f, tag) {
+					count++
+				}
+			} else if tagIndex.RemoveTag(driveId, f.FileId, tag) {
+				count++
+			}
+		}
+	}
+
+	if err = tagIndex.Save(); err != nil {
+		fmt.Printf("保存标签索引失败: %s\n", err)
+		return
+	}
+	if isAdd {
+		fmt.Printf("成功给 %d 个文件打上标签: %s\n", count, tag)
+	} else {
+		fmt.Printf("成功移除 %d 个文件的标签: %s\n", count, tag)
+	}
+}
+
+// RunTagList 列出所有标签，指定标签则列出标签下的文件
+func RunTagList(driveId, tag string) {
+	tagIndex, err := pantag.LoadTagIndex(activeUserDataDir())
+	if err != nil {
+		fmt.Printf("读取标签索引失败: %s\n", err)
+		return
+	}
+
+	tb := cmdtable.NewTable(os.Stdout)
+	tag = pantag.NormalizeTag(tag)
+	if tag == "" {
+		tags := tagIndex.Tags(driveId)
+		if len(tags) == 0 {
+			fmt.Println("没有任何标签")
+			return
+		}
+		tb.SetHeader([]string{"#", "标签", "文件数量"})
+		for k, t := range tags {
+			tb.Append([]string{strconv.Itoa(k + 1), t.Tag, strconv.Itoa(t.Count)})
+		}
+		tb.Render()
+		return
+	}
+
+	files := tagIndex.FilesByTag(driveId, tag)
+	if len(files) == 0 {
+		fmt.Printf("标签 %s 下没有文件\n", tag)
+		return
+	}
+	tb.SetHeader([]string{"#", "文件ID", "类型", "路径"})
+	for k, f := range files {
+		fileType := "文件"
+		if f.IsFolder {
+			fileType = "目录"
+		}
+		tb.Append([]string{strconv.Itoa(k + 1), f.FileId, fileType, f.Path})
+	}
+	tb.Render()
+}
+
+// tagFilePaths 获取标签下所有文件的网盘路径
+func tagFilePaths(driveId, tag string) []string {
+	tag = pantag.NormalizeTag(tag)
+	tagIndex, err := pantag.LoadTagIndex(activeUserDataDir())
+	if err != nil {
+		fmt.Printf("读取标签索引失败: %s\n", err)
+		return nil
+	}
+	paths := []string{}
+	for _, f := range tagIndex.FilesByTag(driveId, tag) {
+		paths = append(paths, f.Path)
+	}
+	if len(paths) == 0 {
+		fmt.Printf("标签 %s 下没有文件\n", tag)
+	}
+	return paths
+}
@@ -0,0 +1,170 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tickstep/aliyunpan/cmder"
+	"github.com/tickstep/aliyunpan/cmder/cmdtable"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/log"
+	"github.com/tickstep/library-go/converter"
+	"github.com/urfave/cli"
+)
+
+// CmdTransferHistoryList 查询传输记录
+func CmdTransferHistoryList() cli.Command {
+	return cli.Command{
+		Name:      "list",
+		Usage:     "查询上传、下载、同步的传输记录",
+		UsageText: cmder.App().Name + " history list [arguments...]",
+		Description: `
+	开启文件记录（config set -file_record_config 1）后，上传、下载、同步的每个文件都会记录到日志目录下的 transfer_history.db，
+	包括时间、文件大小、耗时以及结果，可以按条件查询，或者导出为CSV、JSON文件。
+
+	示例:
+
+	查看最近50条传输记录
+	aliyunpan history list
+
+	查看最近24小时失败的上传记录
+	aliyunpan history list --since 24h --action upload --status fail
+
+	导出路径包含"照片"的全部记录到CSV文件
+	aliyunpan history list --path 照片 --limit 0 --format csv --output D:/transfer.csv
+`,
+		Action: func(c *cli.Context) error {
+			filter := &log.TransferFilter{
+				Action: strings.ToLower(c.String("action")),
+				Path:   c.String("path"),
+			}
+			switch status := strings.ToLower(c.String("status")); status {
+			case "", log.TransferStatusSuccess, log.TransferStatusFail:
+				filter.Status = status
+			default:
+				fmt.Printf("--status 错误: %s, 支持: success, fail\n", status)
+				setJsonError(JsonCodeBadArgs, "--status 错误: "+status)
+				return nil
+			}
+			var ok bool
+			if filter.Since, ok = parseAuditTime("since", c.String("since")); !ok {
+				return nil
+			}
+			if filter.Until, ok = parseAuditTime("until", c.String("until")); !ok {
+				return nil
+			}
+			format := strings.ToLower(c.String("format"))
+			if format != "table" && format != "csv" && format != "json" {
+				fmt.Printf("--format 错误: %s, 支持: table, csv, json\n", format)
+				setJsonError(JsonCodeBadArgs, "--format 错误: "+format)
+				return nil
+			}
+
+			records, err := log.NewTransferHistory(config.GetTransferHistoryFilePath()).Query(filter, c.Int("limit"))
+			if err != nil {
+				fmt.Printf("读取传输记录失败: %s\n", err)
+				setJsonErr(err)
+				return nil
+			}
+			setJsonData(records)
+			if format == "table" {
+				printTransferRecords(records)
+				return nil
+			}
+
+			var w io.Writer = os.Stdout
+			if output := c.String("output"); output != "" {
+				file, err := os.Create(output)
+				if err != nil {
+					fmt.Printf("创建导出文件失败: %s\n", err)
+					setJsonErr(err)
+					return nil
+				}
+				defer file.Close()
+				w = file
+				defer fmt.Printf("已导出 %d 条记录到 %s\n", len(records), output)
+			}
+			if format == "csv" {
+				err = log.WriteTransferCsv(w, records)
+			} else {
+				err = log.WriteTransferJson(w, records)
+			}
+			if err != nil {
+				fmt.Printf("导出传输记录失败: %s\n", err)
+				setJsonErr(err)
+			}
+			return nil
+		},
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "since",
+				Usage: "开始时间，格式: 2006-01-02 15:04:05，或者距现在的时长，例如: 24h、30m",
+			},
+			cli.StringFlag{
+				Name:  "until",
+				Usage: "结束时间，格式同 --since",
+			},
+			cli.StringFlag{
+				Name:  "status",
+				Usage: "传输结果: success、fail",
+			},
+			cli.StringFlag{
+				Name:  "action",
+				Usage: "记录类型: upload、download、sync、webdav，sync同时匹配sync-upload和sync-download",
+			},
+			cli.StringFlag{
+				Name:  "path",
+				Usage: "文件路径包含的内容，不区分大小写",
+			},
+			cli.IntFlag{
+				Name:  "limit",
+				Usage: "最多显示最近的多少条记录，0代表全部",
+				Value: 50,
+			},
+			cli.StringFlag{
+				Name:  "format",
+				Usage: "输出格式: table、csv、json",
+				Value: "table",
+			},
+			cli.StringFlag{
+				Name:  "output",
+				Usage: "csv、json格式导出到的文件，为空输出到终端",
+			},
+		},
+	}
+}
+
+// printTransferRecords 以表格输出传输记录
+func printTransferRecords(records []*log.TransferRecord) {
+	if len(records) == 0 {
+		fmt.Println("没有满足条件的传输记录")
+		return
+	}
+	tb := cmdtable.NewTable(os.Stdout)
+	tb.SetHeader([]string{"时间", "类型", "状态", "文件大小", "耗时", "文件路径"})
+	for _, rec := range records {
+		elapsed := ""
+		if rec.Elapsed > 0 {
+			elapsed = (time.Duration(rec.Elapsed) * time.Millisecond).String()
+		}
+		tb.Append([]string{rec.Time.Format("2006-01-02 15:04:05"), rec.Action, rec.Status,
+			converter.ConvertFileSize(rec.Size, 2), elapsed, rec.Path})
+	}
+	tb.Render()
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"github.com/tickstep/aliyunpan-api/aliyunpan"
 	"github.com/tickstep/aliyunpan/cmder"
-	"github.com/tickstep/aliyunpan/internal/config"
 	"github.com/tickstep/library-go/converter"
 	"github.com/urfave/cli"
 	"path"
@@ -42,8 +41,8 @@ func CmdTree() cli.Command {
 		Category: "阿里云盘",
 		Before:   ReloadConfigFunc,
 		Action: func(c *cli.Context) error {
-			if config.Config.ActiveUser() == nil {
-				fmt.Println("未登录账号")
+			if GetActiveUser() == nil {
+				printNotLogin()
 				return nil
 			}
 			minSize := int64(0)
@@ -109,7 +108,7 @@ type (
 )
 
 func getTree(driveId, pathStr string, depth int, statistic *treeStatistic, setting *treeConfig) {
-	activeUser := config.Config.ActiveUser()
+	activeUser := GetActiveUser()
 	pathStr = activeUser.PathJoin(driveId, pathStr)
 	pathStr = path.Clean(pathStr)
 
@@ -221,7 +220,7 @@ func getTree(driveId, pathStr string, depth int, statistic *treeStatistic, setti
 
 // RunTree 列出树形图
 func RunTree(driveId, pathStr string, showFullPath, showFileSize bool, minSize, maxSize int64) {
-	activeUser := config.Config.ActiveUser()
+	activeUser := GetActiveUser()
 	activeUser.PanClient().OpenapiPanClient().ClearCache()
 	activeUser.PanClient().OpenapiPanClient().EnableCache()
 	defer activeUser.PanClient().OpenapiPanClient().DisableCache()
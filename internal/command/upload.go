@@ -14,16 +14,19 @@
 package command
 
 import (
+	"context"
 	"fmt"
 	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
 	"github.com/tickstep/aliyunpan/cmder"
 	"github.com/tickstep/aliyunpan/internal/log"
+	"github.com/tickstep/aliyunpan/internal/notify"
 	"github.com/tickstep/aliyunpan/internal/plugins"
 	"github.com/tickstep/aliyunpan/internal/utils"
 	"github.com/tickstep/library-go/requester/rio/speeds"
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -38,8 +41,12 @@ import (
 	"github.com/tickstep/aliyunpan-api/aliyunpan"
 	"github.com/tickstep/aliyunpan/cmder/cmdtable"
 	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/file/faultinject"
+	"github.com/tickstep/aliyunpan/internal/file/ratelimit"
+	"github.com/tickstep/aliyunpan/internal/functions"
 	"github.com/tickstep/aliyunpan/internal/functions/panupload"
 	"github.com/tickstep/aliyunpan/internal/localfile"
+	"github.com/tickstep/aliyunpan/internal/metrics"
 	"github.com/tickstep/aliyunpan/internal/taskframework"
 	"github.com/tickstep/library-go/converter"
 )
@@ -49,6 +56,8 @@ const (
 	DefaultUploadMaxAllParallel = 1
 	// DefaultUploadMaxRetry 默认上传失败最大重试次数
 	DefaultUploadMaxRetry = 3
+	// uploadCallbackWaitTimeout 上传结束后等待上传回调发送完成的最长时间
+	uploadCallbackWaitTimeout = 30 * time.Second
 )
 
 type (
@@ -57,14 +66,60 @@ type (
 		AllParallel    int // 所有文件并发上传数量，即可以同时并发上传多少个文件
 		Parallel       int // 单个文件并发上传数量
 		MaxRetry       int
-		MaxTimeoutSec  int // http请求超时时间，单位秒
-		NoRapidUpload  bool
+		MaxTimeoutSec  int  // http请求超时时间，单位秒
+		NoRapidUpload  bool // 不检测秒传
+		NoChecksum     bool // 不计算SHA1，无法秒传，也不进行上传后校验
 		ShowProgress   bool
 		IsOverwrite    bool // 覆盖已存在的文件，如果同名文件已存在则移到回收站里
 		IsSkipSameName bool // 跳过已存在的文件，即使文件内容不一致(不检查SHA1)
 		DriveId        string
-		ExcludeNames   []string // 排除的文件名，包括文件夹和文件。即这些文件/文件夹不进行上传，支持正则表达式
-		BlockSize      int64    // 分片大小
+		ExcludeNames   []string         // 排除的文件名，包括文件夹和文件。即这些文件/文件夹不进行上传，支持正则表达式
+		Symlink        string           // 软链接处理策略：skip、follow、manifest，为空使用follow
+		ExcludeHidden  bool             // 不上传隐藏文件和文件夹
+		BlockSize      int64            // 分片大小
+		ShowTiming     bool             // 输出每个文件各阶段耗时
+		ReportFile     string           // 上传结束后生成的HTML汇总报告文件路径，为空则不生成
+		TreeSummary    bool             // 上传结束后按目录树状汇总上传结果
+		Retention      *backupRetention // 备份保留策略，上传目标目录是日期目录时，上传成功后清理同级的旧日期目录，nil代表不清理
+		ExcludeFile    string           // 运行时排除规则文件，上传过程中可以动态增加排除规则
+		ProfileFile    string           // 上传参数profile配置文件，为空则使用配置目录下的 upload_profile.json
+		NoAlbumDedup   bool             // 上传到相册盘时不检测重复照片
+		CallbackUrl    string           // 每个文件上传结束后回调的URL，为空则使用全局配置
+		HashWorkers    int              // 预先并发计算SHA1的协程数，0代表不预先计算
+		ZipOnReject    bool             // 被网盘拒绝上传的文件自动打包成带密码的zip再上传
+		ZipPassword    string           // zip文件密码，为空则每个文件随机生成
+		TimeBudget     time.Duration    // 上传批次时间预算，到达后不再开始新的文件上传，0代表不限制
+		BudgetAbort    bool             // 到达时间预算时中止进行中的上传并保存断点，否则等待进行中的上传完成
+		Includes       []string         // 包含规则，只上传匹配的文件，支持glob通配符和re:开头的正则表达式
+		Excludes       []string         // 排除规则，匹配的文件和文件夹不上传，支持glob通配符和re:开头的正则表达式
+		Order          string           // 文件上传顺序：size-asc、size-desc、name、mtime，为空按照扫描顺序
+		Priority       []string         // 优先上传匹配的文件，排在前面的规则优先级更高
+		NameConflict   string           // 同一网盘文件夹下只有大小写或者Unicode规范化形式不同的文件名的处理策略：report、skip、rename
+		MaxRate        int64            // 本次上传所有文件共享的总限速，单位 B/s，0代表不限制
+		RateClass      string           // 限速类别，同一类别的上传、下载共用配置的类别限速，为空使用upload
+		TargetQuota    int64            // 目标目录的容量软配额，超出配额的文件拒绝上传，0代表不限制
+		RefreshQuota   bool             // 忽略缓存，重新统计目标目录已用容量
+		DryRun         bool             // 只列出将要上传的文件，不实际上传
+		Encrypt        bool             // 上传前使用配置的加密密码加密文件内容
+		EncryptName    bool             // 同时加密文件名
+		DedupeDb       string           // 上传去重索引数据库文件路径，为空则不使用
+		DedupeTrust    bool             // 信任上传去重索引，不检查网盘文件是否变化
+		DetectRename   bool             // 使用上传去重索引检测本地文件改名，直接重命名网盘文件而不重新上传
+		Resume         bool             // 使用批次清单，中断后重新执行相同的命令从中断处继续
+		FolderCache    bool             // 持久化云盘文件夹ID缓存，下次上传时继续使用
+		AutoTune       bool             // 批次开始时尝试几组文件并发数、分片大小，自动选择速度最快的组合
+		Fanout         []string         // 扇出上传的其余目标，格式: <网盘目录> 或者 <账号>:<网盘目录>
+		WarmupVideo    bool             // 视频文件上传成功后触发云端转码预热
+		// Control 外部控制，daemon通过它暂停、取消上传并查询进度，可以为nil
+		Control *taskframework.TaskControl
+		// Reporter 任务单元状态上报，可以替换为GUI等其他前端的实现，为nil时输出到命令行
+		Reporter panupload.UploadReporter
+	}
+
+	// uploadTaskSet 按(本地文件绝对路径,目标路径)记录已创建的上传任务，多个来源路径可能命中同一个文件，合并重复的任务
+	uploadTaskSet struct {
+		keys   map[string]struct{}
+		merged int // 合并的重复任务数量
 	}
 )
 
@@ -97,7 +152,15 @@ var UploadFlags = []cli.Flag{
 	},
 	cli.BoolFlag{
 		Name:  "norapid",
-		Usage: "不检测秒传。跳过费时的SHA1计算直接上传",
+		Usage: "不检测秒传，并且跳过费时的SHA1计算直接上传。等同于同时指定 --no-rapid-upload 和 --no-checksum",
+	},
+	cli.BoolFlag{
+		Name:  "no-rapid-upload",
+		Usage: "不检测秒传，但仍然计算SHA1，上传完成后校验网盘文件的SHA1",
+	},
+	cli.BoolFlag{
+		Name:  "no-checksum",
+		Usage: "不计算SHA1，无法秒传，也不进行上传后校验",
 	},
 	cli.StringFlag{
 		Name:  "driveId",
@@ -109,11 +172,170 @@ var UploadFlags = []cli.Flag{
 		Usage: "exclude name，指定排除的文件夹或者文件的名称，只支持正则表达式。支持同时排除多个名称，每一个名称就是一个exn参数",
 		Value: nil,
 	},
+	cli.BoolFlag{
+		Name:  "warmup-video",
+		Usage: "视频文件上传成功(包括秒传)后调用播放信息接口触发云端转码预热，稍后在线播放无需等待转码",
+	},
+	cli.StringFlag{
+		Name:  "symlink",
+		Usage: "软链接处理策略: skip-跳过软链接, follow-上传软链接指向的文件或者文件夹, manifest-不上传链接指向的内容, 而是记录到目标目录的 " + localfile.SymlinkManifestFileName + " 清单文件中",
+		Value: string(localfile.SymlinkFollow),
+	},
+	cli.BoolFlag{
+		Name:  "exclude-hidden",
+		Usage: "不上传隐藏文件和文件夹，即以\".\"开头的文件以及Windows设置了隐藏属性的文件",
+	},
+	cli.StringFlag{
+		Name:  "profile",
+		Usage: "上传参数profile配置文件，按扩展名/文件大小对文件使用不同的分片大小、并发数以及是否秒传。默认使用配置目录下的 upload_profile.json",
+	},
+	cli.BoolFlag{
+		Name:  "no-album-dedup",
+		Usage: "上传到相册盘时不检测重复照片。默认会按SHA1查重，相册盘已有相同内容的照片不会重复上传",
+	},
+	cli.IntFlag{
+		Name:  "hash-workers",
+		Usage: "预先并发计算排队文件SHA1的协程数，使SHA1计算和上传同时进行，适合上传大量大文件。0代表不预先计算",
+		Value: 0,
+	},
+	cli.StringFlag{
+		Name:  "callback",
+		Usage: "每个文件上传结束后使用HTTP PUT回调该URL，内容为JSON格式的文件路径、fileId、SHA1和上传结果。不指定则使用全局配置 upload_callback_url",
+	},
+	cli.BoolFlag{
+		Name:  "zip-on-reject",
+		Usage: "被网盘拒绝上传（例如文件名或内容被拦截）的文件，自动打包成文件名混淆的加密zip再上传，映射关系记录在账号数据目录的 " + panupload.ZipManifestFileName + " 中",
+	},
+	cli.StringFlag{
+		Name:  "zip-password",
+		Usage: "配合 --zip-on-reject 使用，加密zip的解压密码，不指定则每个文件随机生成",
+	},
+	cli.StringFlag{
+		Name:  "time-budget",
+		Usage: "上传批次时间预算，例如：6h、90m。到达预算后不再开始新的文件上传，等待进行中的上传完成后结束，保证备份不超出时间窗口",
+	},
+	cli.BoolFlag{
+		Name:  "time-budget-abort",
+		Usage: "配合 --time-budget 使用，到达时间预算时立即中止进行中的上传并保存断点，下次上传可以继续",
+	},
+	cli.StringSliceFlag{
+		Name:  "include",
+		Usage: "包含规则，只上传匹配的文件。支持glob通配符(例如: *.jpg、photos/**/*.png、docs/)和re:开头的正则表达式，匹配上传目录的相对路径。支持同时指定多个规则",
+	},
+	cli.StringSliceFlag{
+		Name:  "exclude",
+		Usage: "排除规则，匹配的文件和文件夹不上传。支持glob通配符(例如: node_modules/、*.tmp、.DS_Store)和re:开头的正则表达式。支持同时指定多个规则",
+	},
+	cli.StringFlag{
+		Name:  "order",
+		Usage: "文件上传顺序。可选值: size-asc(小文件优先)、size-desc(大文件优先)、name(按路径名)、mtime(先修改的文件优先)，默认按照扫描顺序",
+	},
+	cli.StringSliceFlag{
+		Name:  "priority",
+		Usage: "优先上传匹配的文件，规则格式和 --include 相同。支持同时指定多个规则，排在前面的规则优先级更高",
+	},
+	cli.StringFlag{
+		Name:  "name-conflict",
+		Usage: "上传到同一网盘文件夹下只有大小写或者Unicode规范化形式不同的文件名(例如 A.txt 和 a.txt)的处理策略。可选值: report(输出冲突报告, 照常上传)、skip(只上传最先扫描到的文件)、rename(重命名后上传, 例如 a(1).txt)",
+		Value: panupload.NameConflictReport,
+	},
+	cli.StringFlag{
+		Name:  "spool-dir",
+		Usage: "从标准输入上传时保存临时文件的目录，需要有足够的空间保存全部数据，默认使用配置目录下的 temp 目录",
+	},
+	cli.StringFlag{
+		Name:  "reporter",
+		Usage: "上传状态输出格式。可选值: cli(命令行输出)、json(每个事件输出一行JSON到标准错误，用于GUI等前端集成)",
+		Value: "cli",
+	},
+	cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "只列出将要上传的文件、创建的文件夹以及被过滤的文件，不实际上传，用于检查过滤规则和目标布局",
+	},
+	cli.StringFlag{
+		Name:  "max-rate",
+		Usage: "本次上传的总限速，例如：2MB、500KB，平均分配给同时上传的文件。和配置的单文件限速 max_upload_rate 同时生效",
+	},
+	cli.StringFlag{
+		Name:  "rate-class",
+		Usage: "限速类别，同一类别的上传、下载共用配置 rate_limit_classes 中该类别的限速，并且受总限速 rate_limit_total 约束",
+		Value: "upload",
+	},
+	cli.StringFlag{
+		Name:  "target-quota",
+		Usage: "目标目录的容量软配额，例如：1TB、500GB。上传前统计目标目录已用大小，超出配额的文件拒绝上传。统计结果缓存在账号数据目录中",
+	},
+	cli.BoolFlag{
+		Name:  "target-quota-refresh",
+		Usage: "忽略缓存，重新统计目标目录已用容量",
+	},
+	cli.BoolFlag{
+		Name:  "encrypt",
+		Usage: "上传前使用AES-256-GCM加密文件内容，密码使用 config set -encrypt_password 设置，网盘文件名增加 .aenc 后缀。下载时自动解密",
+	},
+	cli.BoolFlag{
+		Name:  "encrypt-name",
+		Usage: "加密上传时同时加密文件名，映射关系记录在账号数据目录的 " + panupload.EncryptManifestFileName + " 中",
+	},
+	cli.StringSliceFlag{
+		Name:  "fanout",
+		Usage: "扇出上传，同时上传到多个目标，每个目标一个fanout参数，格式: <网盘目录> 或者 <账号>:<网盘目录>。命令指定的目标目录实际上传，同账号的其余目标使用秒传，其他账号的目标独立上传",
+	},
+	cli.BoolFlag{
+		Name:  "resume",
+		Usage: "使用批次清单记录扫描到的文件、已创建的云盘文件夹和每个文件的上传状态，中断后使用相同的参数重新执行从中断处继续，不再重新扫描和查询已上传的文件",
+	},
+	cli.BoolFlag{
+		Name:  "persist-folder-cache",
+		Usage: "持久化云盘文件夹ID缓存到账号数据目录，缓存有效期内再次上传到相同目录时不再逐个检测云盘文件夹是否存在",
+	},
+	cli.StringFlag{
+		Name:  "dedupe-db",
+		Usage: "上传去重索引数据库文件路径，例如: upload_dedupe.db。记录已上传文件的大小、修改时间和网盘文件ID，重复上传同一目录时直接跳过没有变化的文件，不再逐个查询网盘",
+	},
+	cli.BoolFlag{
+		Name:  "detect-rename",
+		Usage: "检测本地文件改名、移动，需要同时指定 --dedupe-db。新文件和索引中本地已经不存在的文件大小、SHA1一致时，直接重命名网盘文件，不再重新上传",
+	},
+	cli.BoolFlag{
+		Name:  "auto-tune",
+		Usage: "自动参数调优。批次开始的前几分钟依次尝试几组文件并发数(不超过 -p)、分片大小(以 -bs 为基准)，每组上传30秒测速，之后锁定速度最快的组合。尝试期间上传的文件照常计入任务",
+	},
+	cli.BoolFlag{
+		Name:  "dedupe-trust",
+		Usage: "信任上传去重索引，不检查网盘文件是否被删除或者替换。网盘文件只由本程序上传时使用，可以进一步减少网盘请求",
+	},
+	cli.StringFlag{
+		Name:  "exf",
+		Usage: "exclude file，运行时排除规则文件，每行一个匹配本地文件完整路径的正则表达式。上传过程中可以随时修改该文件增加排除规则，还没开始上传的匹配文件会被直接取消",
+	},
 	cli.IntFlag{
 		Name:  "bs",
 		Usage: "block size，上传分片大小，单位KB。推荐值：1024 ~ 10240。当上传极大单文件时候请适当调高该值",
 		Value: 10240,
 	},
+	cli.StringFlag{
+		Name:  "report",
+		Usage: "上传结束后生成HTML汇总报告（统计图表、失败清单、速度曲线），参数值为报告文件保存路径，例如：report.html",
+	},
+	cli.StringFlag{
+		Name:  "retention",
+		Usage: "备份保留策略，例如：7d,4w,12m。上传目标目录是日期目录(例如 /备份/2026-01-02)时，上传成功后按策略清理同级的旧日期目录，移入回收站",
+	},
+	cli.BoolFlag{
+		Name:  "tree",
+		Usage: "上传结束后按目录树状汇总每个目录成功、失败、跳过的文件数量与大小，有失败文件的目录以 [!] 标记",
+	},
+	cli.BoolFlag{
+		Name:  "timing",
+		Usage: "输出每个文件各阶段耗时（扫描、排队等待、SHA1、创建任务、各分片、合并确认）以及阶段耗时分布报表，用于排查上传缓慢的问题",
+	},
+	cli.StringFlag{
+		Name:   "fault-inject",
+		Usage:  "错误注入测试模式，随机让分片传输失败、返回429、中断连接，用于验证断点续传，例如: fail=0.1,429=0.05,interrupt=0.05,seed=1",
+		EnvVar: faultinject.EnvFaultInject,
+		Hidden: true,
+	},
 }
 
 func CmdUpload() cli.Command {
@@ -124,6 +346,7 @@ func CmdUpload() cli.Command {
 		UsageText: cmder.App().Name + " upload <本地文件/目录的路径1> <文件/目录2> <文件/目录3> ... <目标目录>",
 		Description: `
 	上传指定的文件夹或者文件，上传的文件将会保存到 <目标目录>。支持软链接文件，包括Linux/macOS(ln命令)和Windows(mklink命令)创建的符号链接文件。
+	默认上传软链接指向的文件或者文件夹，可以使用 --symlink 修改软链接处理策略。socket、设备文件、命名管道等特殊文件会自动跳过。
 
   示例:
     1. 将本地的 C:\Users\Administrator\Desktop\1.mp4 上传到网盘 /视频 目录
@@ -157,6 +380,48 @@ func CmdUpload() cli.Command {
     10. 跳过已存在的同名文件，即使文件内容不一致(不检查SHA1)
     aliyunpan upload -skip 1.mp4 /视频
 
+    11. 上传结束后输出每个文件各阶段耗时以及耗时分布报表
+    aliyunpan upload -timing C:/Users/Administrator/Video /视频
+
+    12. 上传过程中动态排除目录，在 exclude.txt 中追加一行规则，还没开始上传的 tmp 目录下的文件会被取消上传
+    aliyunpan upload -exf exclude.txt C:/Users/Administrator/Video /视频
+    echo "/Video/tmp/" >> exclude.txt
+
+    13. 上传照片到相册盘(先使用 drive 命令切换到相册盘)，默认按SHA1查重，相册盘已有相同内容的照片会跳过。如需关闭查重使用 -no-album-dedup
+    aliyunpan upload C:/Users/Administrator/Photos /
+
+    14. 上传文件，不检测秒传，但仍然计算SHA1并在上传完成后校验网盘文件
+    aliyunpan upload --no-rapid-upload C:/Users/Administrator/Desktop/1.mp4 /视频
+
+    15. 上传文件，每个文件上传结束后回调 http://127.0.0.1:8080/callback 通知上传结果
+    aliyunpan upload -callback "http://127.0.0.1:8080/callback" C:/Users/Administrator/Desktop/1.mp4 /视频
+
+    16. 上传目录，被网盘拒绝上传的文件自动打包成加密zip再上传，解压密码为 mypass
+    aliyunpan upload --zip-on-reject --zip-password mypass C:/Users/Administrator/Documents /文档
+
+    17. 上传目录，最多运行6小时，到时后不再开始新的文件上传，等待进行中的文件上传完成后结束
+    aliyunpan upload --time-budget 6h C:/Users/Administrator/Documents /文档
+
+    18. 上传项目目录，排除 node_modules 文件夹、.tmp文件以及 .DS_Store 文件，先使用 --dry-run 检查将要上传的文件
+    aliyunpan upload --exclude "node_modules/" --exclude "*.tmp" --exclude ".DS_Store" --dry-run C:/Users/Administrator/project /项目
+
+    19. 只上传目录中的jpg和png图片
+    aliyunpan upload --include "*.jpg" --include "re:(?i)\.png$" C:/Users/Administrator/Photos /照片
+
+    20. 加密上传目录，文件内容和文件名都加密，需要先设置加密密码
+    aliyunpan config set -encrypt_password mypass
+    aliyunpan upload --encrypt --encrypt-name C:/Users/Administrator/Documents /文档
+
+    21. 路径以 / 结尾时只上传目录中的内容(rsync风格)。下面第一条命令上传到 /备份/Desktop，第二条命令把 Desktop 中的内容直接上传到 /备份
+    aliyunpan upload C:/Users/Administrator/Desktop /备份
+    aliyunpan upload C:/Users/Administrator/Desktop/ /备份
+
+    22. 从标准输入上传，本地路径使用 - ，网盘路径为文件路径。数据先写入临时文件再上传，临时文件目录可以使用 --spool-dir 指定
+    tar czf - /home/tickstep/data | aliyunpan upload - /备份/data.tgz
+
+    23. 上传目录，结束后按目录树状汇总上传结果，快速定位出错的子目录
+    aliyunpan upload --tree C:/Users/Administrator/Photos /照片
+
   参考：
     以下是典型的排除特定文件或者文件夹的例子，注意：参数值必须是正则表达式。在正则表达式中，^表示匹配开头，$表示匹配结尾。
     1)排除@eadir文件或者文件夹：-exn "^@eadir$"
@@ -191,19 +456,119 @@ func CmdUpload() cli.Command {
 			//	return nil
 			//}
 
-			RunUpload(subArgs[:c.NArg()-1], subArgs[c.NArg()-1], &UploadOptions{
+			var timeBudget time.Duration
+			if c.String("time-budget") != "" {
+				d, err := time.ParseDuration(c.String("time-budget"))
+				if err != nil || d <= 0 {
+					fmt.Printf("时间预算格式错误: %s, 示例: 6h、90m\n", c.String("time-budget"))
+					return nil
+				}
+				timeBudget = d
+			}
+
+			maxRate, ok := parseMaxRate(c.String("max-rate"))
+			if !ok {
+				return nil
+			}
+			var retention *backupRetention
+			if c.String("retention") != "" {
+				r, err := parseBackupRetention(c.String("retention"))
+				if err != nil {
+					fmt.Println(err)
+					return nil
+				}
+				retention = r
+			}
+			if _, err := localfile.ParseSymlinkPolicy(c.String("symlink"), localfile.SymlinkFollow); err != nil {
+				fmt.Println(err)
+				return nil
+			}
+			var targetQuota int64
+			if c.String("target-quota") != "" {
+				q, err := converter.ParseFileSizeStr(c.String("target-quota"))
+				if err != nil || q <= 0 {
+					fmt.Printf("目标目录配额格式错误: %s, 示例: 1TB、500GB\n", c.String("target-quota"))
+					return nil
+				}
+				targetQuota = q
+			}
+			reporter, ok := newUploadReporter(c.String("reporter"))
+			if !ok {
+				return nil
+			}
+			stopFaultInject, ok := startFaultInject(c.String("fault-inject"))
+			if !ok {
+				return nil
+			}
+			localPaths, savePath := subArgs[:c.NArg()-1], subArgs[c.NArg()-1]
+			cleanupSpool := func() {}
+			if len(localPaths) == 1 && localPaths[0] == UploadStdinPath {
+				// 从标准输入读取数据到临时文件，上传到网盘路径所在的目录
+				spoolPath, cleanup, err := spoolUploadStdin(os.Stdin, c.String("spool-dir"), savePath)
+				if err != nil {
+					fmt.Println(err)
+					stopFaultInject()
+					return nil
+				}
+				defer cleanup()
+				cleanupSpool = cleanup
+				localPaths, savePath = []string{spoolPath}, path.Dir(savePath)
+			}
+			// Ctrl+C 停止上传并保存断点，强制退出时同样删除标准输入的临时文件
+			control, stopInterrupt := newInterruptControl("上传", cleanupSpool)
+			defer stopInterrupt()
+			RunUpload(localPaths, savePath, &UploadOptions{
 				AllParallel:    c.Int("p"), // 多文件上传的时候，允许同时并行上传的文件数量
 				Parallel:       1,          // 一个文件同时多少个线程并发上传的数量。阿里云盘只支持单线程按顺序进行文件part数据上传，所以只能是1
 				MaxRetry:       c.Int("retry"),
 				MaxTimeoutSec:  timeout,
-				NoRapidUpload:  c.Bool("norapid"),
+				NoRapidUpload:  c.Bool("norapid") || c.Bool("no-rapid-upload") || c.Bool("no-checksum"),
+				NoChecksum:     c.Bool("norapid") || c.Bool("no-checksum"),
 				ShowProgress:   !c.Bool("np"),
 				IsOverwrite:    c.Bool("ow"),
 				IsSkipSameName: c.Bool("skip"),
 				DriveId:        parseDriveId(c),
 				ExcludeNames:   c.StringSlice("exn"),
+				Symlink:        c.String("symlink"),
+				ExcludeHidden:  c.Bool("exclude-hidden"),
 				BlockSize:      int64(c.Int("bs") * 1024),
+				ShowTiming:     c.Bool("timing"),
+				ReportFile:     c.String("report"),
+				TreeSummary:    c.Bool("tree"),
+				Retention:      retention,
+				ExcludeFile:    c.String("exf"),
+				ProfileFile:    c.String("profile"),
+				NoAlbumDedup:   c.Bool("no-album-dedup"),
+				CallbackUrl:    c.String("callback"),
+				HashWorkers:    c.Int("hash-workers"),
+				ZipOnReject:    c.Bool("zip-on-reject"),
+				ZipPassword:    c.String("zip-password"),
+				TimeBudget:     timeBudget,
+				BudgetAbort:    c.Bool("time-budget-abort"),
+				Includes:       c.StringSlice("include"),
+				Excludes:       c.StringSlice("exclude"),
+				Order:          c.String("order"),
+				Priority:       c.StringSlice("priority"),
+				NameConflict:   c.String("name-conflict"),
+				DryRun:         c.Bool("dry-run"),
+				Encrypt:        c.Bool("encrypt") || c.Bool("encrypt-name"),
+				EncryptName:    c.Bool("encrypt-name"),
+				DedupeDb:       c.String("dedupe-db"),
+				DedupeTrust:    c.Bool("dedupe-trust"),
+				DetectRename:   c.Bool("detect-rename"),
+				Resume:         c.Bool("resume"),
+				FolderCache:    c.Bool("persist-folder-cache"),
+				AutoTune:       c.Bool("auto-tune"),
+				Fanout:         c.StringSlice("fanout"),
+				WarmupVideo:    c.Bool("warmup-video"),
+				RateClass:      c.String("rate-class"),
+				MaxRate:        maxRate,
+				TargetQuota:    targetQuota,
+				RefreshQuota:   c.Bool("target-quota-refresh"),
+				Control:        control,
+				Reporter:       reporter,
 			})
+			stopFaultInject()
 
 			// 释放文件锁
 			//if locker != nil {
@@ -217,7 +582,15 @@ func CmdUpload() cli.Command {
 
 // RunUpload 执行文件上传
 func RunUpload(localPaths []string, savePath string, opt *UploadOptions) {
-	activeUser := GetActiveUser()
+	if opt != nil && len(opt.Fanout) > 0 {
+		runUploadFanout(localPaths, savePath, opt)
+		return
+	}
+	runUpload(GetActiveUser(), localPaths, savePath, opt)
+}
+
+// runUpload 使用指定账号上传文件，返回上传结果，上传开始前出错或者dry-run模式返回nil
+func runUpload(activeUser *config.PanUser, localPaths []string, savePath string, opt *UploadOptions) *transferJsonData {
 	activeUser.PanClient().OpenapiPanClient().EnableCache()
 	activeUser.PanClient().OpenapiPanClient().ClearCache()
 	defer activeUser.PanClient().OpenapiPanClient().DisableCache()
@@ -225,6 +598,20 @@ func RunUpload(localPaths []string, savePath string, opt *UploadOptions) {
 	if opt == nil {
 		opt = &UploadOptions{}
 	}
+	if IsJsonOutput() {
+		// JSON输出不显示进度
+		opt.ShowProgress = false
+	}
+	if opt.Reporter == nil {
+		// 所有任务单元共用，进度行之后的输出先换行
+		opt.Reporter = panupload.NewCliUploadReporter(os.Stdout, opt.ShowProgress)
+	}
+	symlinkPolicy, err := localfile.ParseSymlinkPolicy(opt.Symlink, localfile.SymlinkFollow)
+	if err != nil {
+		fmt.Println(err)
+		setJsonError(JsonCodeBadArgs, err.Error())
+		return nil
+	}
 
 	// 检测opt
 	if opt.AllParallel <= 0 {
@@ -249,7 +636,11 @@ func RunUpload(localPaths []string, savePath string, opt *UploadOptions) {
 		activeUser.PanClient().OpenapiPanClient().SetTimeout(time.Duration(opt.MaxTimeoutSec) * time.Second)
 	}
 
-	targetDriveName := config.Config.ActiveUser().DriveList.GetDriveNameById(opt.DriveId)
+	if !prepareUploadNetwork(activeUser, opt.DryRun) {
+		return nil
+	}
+
+	targetDriveName := activeUser.DriveList.GetDriveNameById(opt.DriveId)
 	fmt.Printf("\n[0] 当前文件上传最大并发量为: %d, 上传分片大小为: %s, 目标网盘: %s\n", opt.AllParallel, converter.ConvertFileSize(opt.BlockSize, 2), targetDriveName)
 
 	savePath = activeUser.PathJoin(opt.DriveId, savePath)
@@ -261,17 +652,124 @@ func RunUpload(localPaths []string, savePath string, opt *UploadOptions) {
 	switch len(localPaths) {
 	case 0:
 		fmt.Printf("本地路径为空\n")
-		return
+		setJsonError(JsonCodeBadArgs, "本地路径为空")
+		return nil
+	}
+
+	// 上传参数profile
+	profileFile := opt.ProfileFile
+	if profileFile == "" {
+		profileFile = config.GetUploadProfileFile()
+	}
+	profileConfig, err := panupload.LoadUploadProfileConfig(profileFile)
+	if err != nil {
+		fmt.Printf("加载上传参数profile配置文件错误: %s, %s\n", profileFile, err)
+		setJsonError(JsonCodeBadArgs, "加载上传参数profile配置文件错误: "+err.Error())
+		return nil
+	}
+	if profileConfig != nil {
+		fmt.Printf("[0] 已加载上传参数profile配置: %s, profile数量: %d\n", profileFile, len(profileConfig.Profiles))
+	}
+
+	// 包含、排除规则，配置文件中的规则和命令行指定的规则同时生效
+	pathFilter, err := utils.NewPathFilter(
+		append(utils.SplitPatterns(config.Config.UploadIncludePatterns), opt.Includes...),
+		append(utils.SplitPatterns(config.Config.UploadExcludePatterns), opt.Excludes...))
+	if err != nil {
+		fmt.Printf("上传过滤规则错误: %s\n", err)
+		setJsonError(JsonCodeBadArgs, "上传过滤规则错误: "+err.Error())
+		return nil
+	}
+
+	// 上传顺序和优先级
+	taskOrder, err := taskframework.ParseTaskOrder(opt.Order)
+	if err != nil {
+		fmt.Printf("%s\n", err)
+		setJsonError(JsonCodeBadArgs, err.Error())
+		return nil
+	}
+	pathPriority, err := utils.NewPathPriority(opt.Priority)
+	if err != nil {
+		fmt.Printf("上传优先级规则错误: %s\n", err)
+		setJsonError(JsonCodeBadArgs, "上传优先级规则错误: "+err.Error())
+		return nil
+	}
+	// 扫描时检测会在网盘端产生冲突的文件名
+	nameConflict, err := panupload.NewUploadNameConflict(opt.NameConflict)
+	if err != nil {
+		fmt.Printf("%s\n", err)
+		setJsonError(JsonCodeBadArgs, err.Error())
+		return nil
+	}
+
+	// 上传到相册盘，建立照片索引用于去重
+	var albumDedup *panupload.AlbumDedupIndex
+	if !opt.NoAlbumDedup && opt.DriveId == activeUser.DriveList.GetAlbumDriveId() {
+		fmt.Printf("[0] 正在建立相册照片索引用于去重...\n")
+		if albumDedup, err = panupload.NewAlbumDedupIndex(activeUser.PanClient(), opt.DriveId); err != nil {
+			fmt.Printf("建立相册照片索引失败，不进行去重检测: %s\n", err)
+			albumDedup = nil
+		} else {
+			fmt.Printf("[0] 相册照片索引建立完成, 照片数量: %d\n", albumDedup.Count())
+		}
+	}
+
+	// 文件上传结果回调
+	callbackUrl := opt.CallbackUrl
+	if callbackUrl == "" {
+		callbackUrl = config.Config.UploadCallbackUrl
 	}
+	// 扇出上传时activeUser可能不是当前登录账号，数据文件都放在该账号自己的数据目录下
+	userDataDir := config.Config.UserDataDir(activeUser.UserId)
+	uploadCallback := panupload.NewUploadCallback(callbackUrl, userDataDir)
+	defer uploadCallback.Close(uploadCallbackWaitTimeout)
 
 	// 打开上传状态数据库
-	uploadDatabase, err := panupload.NewUploadingDatabase()
+	uploadDatabase, err := panupload.NewUserUploadingDatabase(userDataDir)
 	if err != nil {
 		fmt.Printf("打开上传未完成数据库错误: %s\n", err)
-		return
+		return nil
 	}
 	defer uploadDatabase.Close()
 
+	// 上传去重索引
+	var dedupeIndex *panupload.UploadDedupeIndex
+	if opt.DetectRename && opt.DedupeDb == "" {
+		fmt.Println("检测本地文件改名需要同时指定上传去重索引 --dedupe-db")
+		setJsonError(JsonCodeBadArgs, "检测本地文件改名需要同时指定上传去重索引 --dedupe-db")
+		return nil
+	}
+	if opt.DedupeDb != "" {
+		if dedupeIndex, err = panupload.OpenUploadDedupeIndex(opt.DedupeDb, activeUser.PanClient(), opt.DedupeTrust); err != nil {
+			fmt.Printf("打开上传去重索引数据库错误: %s\n", err)
+			setJsonErr(err)
+			return nil
+		}
+		defer dedupeIndex.Close()
+		fmt.Printf("[0] 上传去重索引记录数量: %d\n", dedupeIndex.Count())
+	}
+
+	// 云盘文件夹ID缓存，同一个文件夹只检测一次是否存在
+	folderIdCache := config.GetFolderIdCache()
+	if opt.FolderCache {
+		folderCacheFile := filepath.Join(userDataDir, config.FolderIdCacheFileName)
+		if err = folderIdCache.Load(folderCacheFile); err != nil && !os.IsNotExist(err) {
+			logger.Verboseln("load folder id cache error: ", err)
+		}
+		defer func() {
+			if e := folderIdCache.Save(folderCacheFile); e != nil {
+				logger.Verboseln("save folder id cache error: ", e)
+			}
+		}()
+	}
+	// 上传准备阶段网盘API请求节流，所有上传任务共享
+	apiPacer := panupload.NewApiPacer(config.Config.UploadApiQps)
+
+	defer func() {
+		hits, misses := folderIdCache.Stats()
+		logger.Verbosef("云盘文件夹ID缓存命中: %d, 未命中: %d\n", hits, misses)
+	}()
+
 	var (
 		// 使用 task framework
 		executor = &taskframework.TaskExecutor{
@@ -283,22 +781,269 @@ func RunUpload(localPaths []string, savePath string, opt *UploadOptions) {
 		folderCreateMutex = &sync.Mutex{}
 
 		pluginManger = plugins.NewPluginManager(config.GetPluginDir())
+
+		// 耗时统计，未开启时为nil
+		timingReport *panupload.UploadTimingReport
+
+		// 运行时排除规则，未指定时为nil
+		runtimeExcluder = panupload.NewRuntimeExcluder(opt.ExcludeFile)
 	)
-	executor.SetParallel(opt.AllParallel)
+	if opt.ShowTiming {
+		timingReport = panupload.NewUploadTimingReport()
+	}
+	// 客户端加密，未开启时为nil
+	var encryptor *panupload.UploadEncryptor
+	if opt.Encrypt {
+		cipher, err := config.Config.EncryptCipher()
+		if err != nil {
+			fmt.Printf("创建加密器失败: %s\n", err)
+			return nil
+		}
+		if cipher == nil {
+			fmt.Printf("加密上传需要先设置加密密码: config set -encrypt_password <密码>\n")
+			return nil
+		}
+		encryptor = panupload.NewUploadEncryptor(cipher, opt.EncryptName, config.GetTempDir())
+	}
+	// 时间预算从开始扫描文件计时，未指定时为nil
+	timeBudget := panupload.NewUploadTimeBudget(opt.TimeBudget, opt.BudgetAbort)
+	defer timeBudget.Stop()
+	// 自动调优在 -p 以内控制文件并发数
+	var autoTuner *panupload.UploadAutoTuner
+	if opt.AutoTune && !opt.DryRun {
+		autoTuner = panupload.NewUploadAutoTuner(opt.AllParallel, opt.BlockSize, panupload.DefaultAutoTuneTrial)
+	}
+	// profile可能指定了更大的并发数，调度器使用最大值，由profile控制各类文件的并发
+	executor.SetParallel(profileConfig.Prepare(autoTuner.MaxParallel(opt.AllParallel)))
+	if taskOrder != taskframework.TaskOrderDefault || pathPriority != nil {
+		executor.SetOrder(taskOrder)
+	}
+	opt.Control.Bind(executor)
+	// 连续出现限流、登录失效等风控错误时暂停或者停止任务
+	riskGuard := functions.NewRiskGuard(executor)
 	statistic.StartTimer() // 开始计时
+	startTime := time.Now()
 
 	// 全局速度统计
 	globalSpeedsStat := &speeds.Speeds{}
+	// 本次上传的总限速，同时受限速类别和全局总限速约束，都未配置时为nil
+	sharedRateLimit := ratelimit.NewChildRateLimit(opt.MaxRate, config.Config.ClassRateLimit(rateClassOrDefault(opt.RateClass, "upload")))
+	statistic.SpeedStat = functions.NewSpeedStat(config.Config.UploadSpeedWindow)
 
 	// 获取当前插件
-	plugin, _ := pluginManger.GetPlugin()
+	plugin, _ := pluginManger.GetReloadablePlugin()
 
 	// 上传记录器
 	fileRecorder := log.NewFileRecorder(config.GetLogDir() + "/upload_file_records.csv")
+	fileRecorder.SetTargets("upload", config.Config.OpenLogTargets())
+	fileRecorder.SetHistory(log.NewTransferHistory(config.GetTransferHistoryFilePath()))
+	defer fileRecorder.Close()
+
+	// 查询账号容量，超出套餐限制的文件在扫描阶段直接跳过
+	uploadQuota, quotaErr := panupload.NewUploadQuota(activeUser.PanClient())
+	if quotaErr != nil {
+		logger.Verboseln("get upload quota error: ", quotaErr)
+		uploadQuota = nil
+		if functions.CheckAccountRisk(quotaErr) {
+			setJsonErr(quotaErr)
+			return nil
+		}
+	} else {
+		if uploadQuota.TotalSize > 0 && uploadQuota.UsedSize*100 >= uploadQuota.TotalSize*quotaWarnPercent {
+			sendQuotaWebhookEvent(fmt.Sprintf("网盘已使用 %s / %s, 剩余容量: %s", converter.ConvertFileSize(uploadQuota.UsedSize, 2),
+				converter.ConvertFileSize(uploadQuota.TotalSize, 2), converter.ConvertFileSize(uploadQuota.FreeSize(), 2)))
+		}
+	}
+
+	// 目标目录容量软配额，超出配额的文件在扫描阶段直接跳过
+	targetQuota, err := panupload.NewTargetQuota(activeUser.PanClient(), opt.DriveId, savePath, opt.TargetQuota, userDataDir, opt.RefreshQuota)
+	if err != nil {
+		fmt.Printf("统计目标目录已用容量失败: %s\n", err)
+		setJsonErr(err)
+		return nil
+	}
+	if targetQuota != nil {
+		if targetQuota.Cached {
+			fmt.Printf("[0] %s (缓存数据, 指定 --target-quota-refresh 重新统计)\n", targetQuota)
+		} else {
+			fmt.Printf("[0] %s\n", targetQuota)
+		}
+		if targetQuota.Exceeded() {
+			fmt.Printf("警告: 目标目录已用容量超出配额, 拒绝上传新的文件\n")
+			sendQuotaWebhookEvent(fmt.Sprintf("%s, 拒绝上传新的文件", targetQuota))
+			setJsonError(JsonCodeFailed, "目标目录已用容量超出配额")
+			return nil
+		}
+	}
+
+	// 磁盘源预检，扫描阶段汇总不可读的文件、无法访问的目录以及0字节文件
+	precheck := panupload.NewUploadPrecheck()
+
+	// SHA1预计算协程池，扫描到的文件在排队时就开始计算SHA1
+	hashPool := localfile.NewHashPool(opt.HashWorkers)
+	defer hashPool.Close()
+
+	// dry-run模式统计
+	var (
+		dryRunCount   int
+		dryRunSize    int64
+		filteredCount int
+	)
+
+	// 多个来源路径可能命中同一个文件，按(本地路径,目标路径)合并重复的任务
+	uploadTasks := newUploadTaskSet()
+
+	// 批次清单中已上传的文件
+	batchSkipped := 0
+
+	// 跳过的软链接、隐藏文件和特殊文件，manifest策略下软链接记录到清单中
+	var (
+		symlinkCount    int
+		hiddenCount     int
+		specialCount    int
+		symlinkManifest = localfile.NewSymlinkManifest()
+	)
+
+	// 上传去重索引跳过的文件
+	var (
+		dedupeCount int
+		dedupeSize  int64
+	)
+
+	// 检测到本地文件改名，直接重命名网盘文件的文件
+	var (
+		renameCount int
+		renameSize  int64
+	)
+
+	// 目录上传批次清单，上次扫描已完成时不再重新扫描，直接继续上传未完成的文件
+	var batchManifest *panupload.UploadBatchManifest
+	if opt.Resume && !opt.DryRun {
+		batchKey := panupload.UploadBatchKey(append([]string{activeUser.UserId, opt.DriveId, savePath,
+			strings.Join(opt.ExcludeNames, "\x00"), strings.Join(opt.Includes, "\x00"), strings.Join(opt.Excludes, "\x00"),
+			strconv.FormatBool(opt.Encrypt), strconv.FormatBool(opt.EncryptName), string(symlinkPolicy), strconv.FormatBool(opt.ExcludeHidden)}, absLocalPaths(localPaths)...)...)
+		batchManifest, err = panupload.OpenUploadBatchManifest(filepath.Join(userDataDir, panupload.UploadBatchDirName), batchKey)
+		if err != nil {
+			fmt.Printf("打开批次清单错误: %s\n", err)
+			setJsonErr(err)
+			return nil
+		}
+		if done, unfinished := batchManifest.Count(); done+unfinished > 0 {
+			fmt.Printf("[0] 从上次中断的批次继续, 已上传 %d 个文件, 未完成 %d 个文件\n", done, unfinished)
+		}
+	}
+
+	// 视频转码预热
+	var videoWarmup *panupload.VideoWarmup
+	if opt.WarmupVideo && !opt.DryRun {
+		videoWarmup = panupload.NewVideoWarmup(context.Background(), activeUser.PanClient())
+	}
+
+	// addUploadTask 创建文件上传任务，上传时会创建缺失的云盘文件夹
+	addUploadTask := func(file localfile.SymlinkFile, fi os.FileInfo, subSavePath string, scanStart time.Time) {
+		if !precheck.CheckFile(file.RealPath, file.LogicPath, fi.Size()) {
+			statistic.AddFailedFile(file.LogicPath, fi.Size(), panupload.PrecheckUnreadableFile)
+			return
+		}
+		if uploadQuota != nil {
+			if ok, reason := uploadQuota.Reserve(fi.Size()); !ok {
+				fmt.Printf("超出套餐限制(%s), 跳过: %s\n", reason, file.LogicPath)
+				statistic.AddOverLimitFile(file.LogicPath, fi.Size(), reason)
+				return
+			}
+		}
+		if targetQuota != nil {
+			if ok, reason := targetQuota.Reserve(fi.Size()); !ok {
+				// 没有加入上传队列，释放已经预占的账号容量
+				uploadQuota.Release(fi.Size())
+				fmt.Printf("警告: %s, 跳过: %s\n", reason, file.LogicPath)
+				statistic.AddOverLimitFile(file.LogicPath, fi.Size(), reason)
+				return
+			}
+		}
+		profile := profileConfig.Match(file.LogicPath, fi.Size())
+		blockSize, noRapidUpload, noChecksum := profile.Apply(opt.BlockSize, opt.NoRapidUpload, opt.NoChecksum)
+		uploadTiming := timingReport.NewTiming(file.LogicPath, fi.Size())
+		uploadTiming.Since(panupload.TimingStageScan, scanStart)
+		uploadTiming.MarkQueued()
+		if !noChecksum {
+			hashPool.Submit(file)
+		}
+		orderKey := taskframework.TaskOrderKey{
+			Priority: pathPriority.Priority(strings.TrimPrefix(subSavePath, savePath)),
+			Name:     file.LogicPath,
+			Size:     fi.Size(),
+			ModTime:  fi.ModTime().Unix(),
+		}
+		taskinfo := executor.AppendWithOrder(&panupload.UploadTaskUnit{
+			LocalFileChecksum: localfile.NewLocalSymlinkFileEntity(file),
+			SavePath:          subSavePath,
+			DriveId:           opt.DriveId,
+			PanClient:         activeUser.PanClient(),
+			User:              activeUser,
+			UploadingDatabase: uploadDatabase,
+			FolderCreateMutex: folderCreateMutex,
+			FolderIdCache:     folderIdCache,
+			ApiPacer:          apiPacer,
+			Parallel:          opt.Parallel,
+			NoRapidUpload:     noRapidUpload,
+			NoChecksum:        noChecksum,
+			BlockSize:         blockSize,
+			UploadStatistic:   statistic,
+			UploadQuota:       uploadQuota,
+			TargetQuota:       targetQuota,
+			ReservedSize:      fi.Size(),
+			UploadTiming:      uploadTiming,
+			RuntimeExcluder:   runtimeExcluder,
+			Profile:           profile,
+			AlbumDedup:        albumDedup,
+			DedupeIndex:       dedupeIndex,
+			BatchManifest:     batchManifest,
+			Callback:          uploadCallback,
+			VideoWarmup:       videoWarmup,
+			HashPool:          hashPool,
+			TimeBudget:        timeBudget,
+			Encryptor:         encryptor,
+			AutoTune:          autoTuner,
+			SharedRateLimit:   sharedRateLimit,
+			Control:           opt.Control,
+			Reporter:          opt.Reporter,
+			ShowProgress:      opt.ShowProgress,
+			ReportSkipped:     opt.TreeSummary,
+			IsOverwrite:       opt.IsOverwrite,
+			IsSkipSameName:    opt.IsSkipSameName,
+			GlobalSpeedsStat:  globalSpeedsStat,
+			FileRecorder:      fileRecorder,
+			Plugin:            plugin,
+		}, opt.MaxRetry, orderKey)
+		fmt.Printf("[%s] 加入上传队列: %s\n", taskinfo.Id(), file.LogicPath)
+	}
+
+	walkPaths := localPaths
+	if batchManifest.WalkDone() {
+		walkPaths = nil
+		for _, f := range batchManifest.UnfinishedFiles() {
+			file := localfile.SymlinkFile{LogicPath: f.LocalPath, RealPath: f.RealPath}
+			fi, er := os.Stat(f.RealPath)
+			if os.IsNotExist(er) {
+				fmt.Printf("本地文件已删除, 跳过: %s\n", f.LocalPath)
+				batchManifest.SetStatus(f.LocalPath, f.SavePath, panupload.UploadBatchDone)
+				continue
+			}
+			if er != nil {
+				precheck.AddWalkError(f.LocalPath, er)
+				statistic.AddFailedFile(f.LocalPath, f.Size, panupload.PrecheckUnreadableFile+": "+er.Error())
+				continue
+			}
+			addUploadTask(file, fi, f.SavePath, time.Now())
+		}
+	}
 
 	// 遍历指定的文件并创建上传任务
-	for _, curPath := range localPaths {
+	for _, curPath := range walkPaths {
 		var walkFunc localfile.MyWalkFunc
+		// rsync风格：以路径分隔符结尾的目录只上传目录中的内容，否则上传目录本身
+		dirContents := isDirContentsPath(curPath)
 		curPath = filepath.Clean(curPath)
 		localPathDir := filepath.Dir(curPath)
 
@@ -308,20 +1053,71 @@ func RunUpload(localPaths []string, savePath string, opt *UploadOptions) {
 			continue
 		}
 
+		if dirContents {
+			if fi, err := os.Stat(curPath); err == nil && fi.IsDir() {
+				// 使用绝对路径，避免 ./ 等相对路径去除文件名开头的"."
+				if absPath, err := filepath.Abs(curPath); err == nil {
+					curPath = absPath
+				}
+				localPathDir = curPath
+			} else {
+				dirContents = false
+			}
+		}
+
 		// 避免去除文件名开头的"."
 		if localPathDir == "." {
 			localPathDir = ""
 		}
+		// 改名检测只在同一个本地目录上传到同一个网盘目录的记录中查找
+		renameLocalRoot, _ := filepath.Abs(localPathDir)
+
+		if opt.DryRun {
+			// 展示源路径对应的目标布局
+			if dirContents {
+				fmt.Printf("[dry-run] 上传目录中的内容: %s%c => %s\n", curPath, os.PathSeparator, savePath)
+			} else {
+				fmt.Printf("[dry-run] 上传: %s => %s\n", curPath, path.Join(savePath, filepath.Base(curPath)))
+			}
+		}
 
 		walkFunc = func(file localfile.SymlinkFile, fi os.FileInfo, err error) error {
+			scanStart := time.Now()
+			if os.PathSeparator == '\\' {
+				file.LogicPath = cmdutil.ConvertToWindowsPathSeparator(file.LogicPath)
+				file.RealPath = cmdutil.ConvertToWindowsPathSeparator(file.RealPath)
+			}
+			if file.LogicPath != curPath {
+				// 命令行指定的路径本身总是上传，只对遍历到的文件应用隐藏文件、软链接策略
+				if opt.ExcludeHidden && localfile.IsHiddenFile(file.LogicPath) {
+					hiddenCount++
+					logger.Verbosef("隐藏文件, 跳过: %s\n", file.LogicPath)
+					return filepath.SkipDir
+				}
+				if symlinkPolicy != localfile.SymlinkFollow && localfile.IsSymlink(file.LogicPath) {
+					symlinkCount++
+					if symlinkPolicy == localfile.SymlinkManifestPolicy {
+						linkSavePath := path.Clean(savePath + aliyunpan.PathSeparator + cmdutil.ConvertToUnixPathSeparator(strings.TrimPrefix(file.LogicPath, localPathDir)))
+						symlinkManifest.Add(linkSavePath, localfile.ReadSymlink(file.LogicPath))
+						fmt.Printf("软链接, 记录到清单: %s\n", file.LogicPath)
+					} else {
+						logger.Verbosef("软链接, 跳过: %s\n", file.LogicPath)
+					}
+					return filepath.SkipDir
+				}
+			}
 			if err != nil {
 				// skip this error file and continue recurse
 				logger.Verboseln("upload process file: ", file, " error: ", err)
+				precheck.AddWalkError(file.LogicPath, err)
+				statistic.AddFailedFile(file.LogicPath, 0, panupload.PrecheckUnreadableDir+": "+err.Error())
 				return nil
 			}
-			if os.PathSeparator == '\\' {
-				file.LogicPath = cmdutil.ConvertToWindowsPathSeparator(file.LogicPath)
-				file.RealPath = cmdutil.ConvertToWindowsPathSeparator(file.RealPath)
+			if fileType := localfile.SpecialFileType(fi.Mode()); fileType != "" {
+				// socket、设备文件等无法读取内容，直接跳过，不作为上传失败处理
+				specialCount++
+				fmt.Printf("跳过特殊文件(%s): %s\n", fileType, file.LogicPath)
+				return nil
 			}
 
 			// 是否排除上传
@@ -329,6 +1125,10 @@ func RunUpload(localPaths []string, savePath string, opt *UploadOptions) {
 				fmt.Printf("排除文件: %s\n", file.LogicPath)
 				return filepath.SkipDir
 			}
+			if dirContents && file.LogicPath == curPath {
+				// 只上传目录中的内容，目录本身对应目标目录
+				return nil
+			}
 
 			subSavePath := strings.TrimPrefix(file.LogicPath, localPathDir)
 
@@ -336,6 +1136,17 @@ func RunUpload(localPaths []string, savePath string, opt *UploadOptions) {
 			if os.PathSeparator == '\\' {
 				subSavePath = cmdutil.ConvertToUnixPathSeparator(subSavePath)
 			}
+
+			// 包含、排除规则过滤，匹配上传目录的相对路径
+			if !pathFilter.Accept(subSavePath, fi.IsDir()) {
+				filteredCount++
+				if fi.IsDir() {
+					fmt.Printf("过滤文件夹: %s\n", file.LogicPath)
+					return filepath.SkipDir
+				}
+				fmt.Printf("过滤文件: %s\n", file.LogicPath)
+				return nil
+			}
 			subSavePath = path.Clean(savePath + aliyunpan.PathSeparator + subSavePath)
 
 			// 插件回调
@@ -365,42 +1176,112 @@ func RunUpload(localPaths []string, savePath string, opt *UploadOptions) {
 				}
 			}
 
+			// 同一网盘文件夹下只有大小写、Unicode规范化形式不同的文件名
+			conflictPath, skip := nameConflict.Check(file.LogicPath, subSavePath, fi.IsDir())
+			if skip {
+				logger.Verbosef("文件名冲突, 跳过: %s\n", file.LogicPath)
+				if fi.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			subSavePath = conflictPath
+
+			if !fi.IsDir() {
+				localAbsPath := file.LogicPath
+				if absPath, er := filepath.Abs(file.LogicPath); er == nil {
+					localAbsPath = absPath
+				}
+				if !uploadTasks.add(localAbsPath, subSavePath) {
+					logger.Verbosef("合并重复的上传任务: %s => %s\n", file.LogicPath, subSavePath)
+					return nil
+				}
+
+				if batchManifest.IsDone(file.LogicPath, subSavePath, fi.Size(), fi.ModTime().Unix()) {
+					batchSkipped++
+					if opt.TreeSummary {
+						addSkippedFileResult(statistic, file.LogicPath, subSavePath, fi.Size())
+					}
+					return nil
+				}
+				if dedupeIndex.Lookup(opt.DriveId, subSavePath, localAbsPath, fi.Size(), fi.ModTime().Unix()) {
+					dedupeCount++
+					dedupeSize += fi.Size()
+					if opt.TreeSummary {
+						addSkippedFileResult(statistic, file.LogicPath, subSavePath, fi.Size())
+					}
+					logger.Verbosef("上传去重索引中已存在, 跳过: %s => %s\n", file.LogicPath, subSavePath)
+					return nil
+				}
+				if opt.DetectRename && !opt.Encrypt {
+					// 加密上传的文件不记录到索引中，无法检测改名
+					if rec, sha1Str := dedupeIndex.FindRenamed(opt.DriveId, renameLocalRoot, savePath, localAbsPath, fi.Size()); rec != nil {
+						if opt.DryRun {
+							renameCount++
+							renameSize += fi.Size()
+							fmt.Printf("[dry-run] 将重命名云盘文件: %s => %s\n", rec.PanPath, subSavePath)
+							return nil
+						}
+						if er := panupload.MovePanFile(activeUser.PanClient(), opt.DriveId, rec.FileId, rec.PanPath, subSavePath, folderCreateMutex); er != nil {
+							fmt.Printf("重命名云盘文件失败, 重新上传: %s, %s\n", rec.PanPath, er)
+						} else {
+							dedupeIndex.Rename(rec, localAbsPath, subSavePath, sha1Str)
+							renameCount++
+							renameSize += fi.Size()
+							fmt.Printf("检测到本地文件改名, 重命名云盘文件: %s => %s\n", rec.PanPath, subSavePath)
+							return nil
+						}
+					}
+				}
+			}
+
+			if opt.DryRun {
+				// 只列出将要上传的文件，不创建任务和云盘文件夹
+				if !fi.IsDir() {
+					dryRunCount++
+					dryRunSize += fi.Size()
+					fmt.Printf("[dry-run] 将上传: %s => %s\n", file.LogicPath, encryptor.EncryptedSavePath(subSavePath))
+				} else {
+					fmt.Printf("[dry-run] 将创建文件夹: %s\n", subSavePath)
+				}
+				return nil
+			}
+
 			// 创建对应的文件上传任务
 			// 上传里面的文件会创建对应的缺失文件夹
 			if !fi.IsDir() {
-				taskinfo := executor.Append(&panupload.UploadTaskUnit{
-					LocalFileChecksum: localfile.NewLocalSymlinkFileEntity(file),
-					SavePath:          subSavePath,
-					DriveId:           opt.DriveId,
-					PanClient:         activeUser.PanClient(),
-					UploadingDatabase: uploadDatabase,
-					FolderCreateMutex: folderCreateMutex,
-					Parallel:          opt.Parallel,
-					NoRapidUpload:     opt.NoRapidUpload,
-					BlockSize:         opt.BlockSize,
-					UploadStatistic:   statistic,
-					ShowProgress:      opt.ShowProgress,
-					IsOverwrite:       opt.IsOverwrite,
-					IsSkipSameName:    opt.IsSkipSameName,
-					GlobalSpeedsStat:  globalSpeedsStat,
-					FileRecorder:      fileRecorder,
-				}, opt.MaxRetry)
-				fmt.Printf("[%s] 加入上传队列: %s\n", taskinfo.Id(), file.LogicPath)
+				batchManifest.AddFile(&panupload.UploadBatchFile{
+					LocalPath: file.LogicPath,
+					RealPath:  file.RealPath,
+					SavePath:  subSavePath,
+					Size:      fi.Size(),
+					ModTime:   fi.ModTime().Unix(),
+				})
+				addUploadTask(file, fi, subSavePath, scanStart)
 			} else {
 				// 创建文件夹
 				// 这样空文件夹也可以正确上传
 				saveFilePath := subSavePath
-				if saveFilePath != "/" {
+				if saveFilePath != "/" && !batchManifest.HasFolder(saveFilePath) && folderIdCache.Get(opt.DriveId, saveFilePath) == "" {
 					folderCreateMutex.Lock()
 					fmt.Printf("正在检测和创建云盘文件夹: %s\n", saveFilePath)
-					_, apierr1 := activeUser.PanClient().OpenapiPanClient().FileInfoByPath(opt.DriveId, saveFilePath)
-					time.Sleep(1 * time.Second)
+					apiPacer.Wait()
+					fe, apierr1 := activeUser.PanClient().OpenapiPanClient().FileInfoByPath(opt.DriveId, saveFilePath)
+					apiPacer.Done(apierr1)
 					if apierr1 != nil && apierr1.Code == apierror.ApiCodeFileNotFoundCode {
 						logger.Verbosef("%s 创建云盘文件夹: %s\n", utils.NowTimeStr(), saveFilePath)
+						apiPacer.Wait()
 						rs, apierr := activeUser.PanClient().OpenapiPanClient().MkdirByFullPath(opt.DriveId, saveFilePath)
+						apiPacer.Done(apierr)
 						if apierr != nil || rs.FileId == "" {
 							fmt.Printf("创建云盘文件夹失败: %s\n", saveFilePath)
+						} else {
+							batchManifest.AddFolder(saveFilePath)
+							folderIdCache.Put(opt.DriveId, saveFilePath, rs.FileId)
 						}
+					} else if apierr1 == nil {
+						batchManifest.AddFolder(saveFilePath)
+						folderIdCache.Put(opt.DriveId, saveFilePath, fe.FileId)
 					}
 					folderCreateMutex.Unlock()
 				}
@@ -416,16 +1297,172 @@ func RunUpload(localPaths []string, savePath string, opt *UploadOptions) {
 		}
 	}
 
+	if len(walkPaths) > 0 {
+		batchManifest.SetWalkDone()
+	}
+	if hiddenCount > 0 {
+		fmt.Printf("跳过 %d 个隐藏文件/文件夹\n", hiddenCount)
+	}
+	if specialCount > 0 {
+		fmt.Printf("跳过 %d 个特殊文件(socket、设备文件、命名管道等)\n", specialCount)
+	}
+	if symlinkCount > 0 && symlinkPolicy == localfile.SymlinkSkip {
+		fmt.Printf("跳过 %d 个软链接\n", symlinkCount)
+	}
+	if symlinkManifest.Count() > 0 {
+		// 软链接清单作为普通文件上传到目标目录
+		manifestSavePath := path.Join(savePath, localfile.SymlinkManifestFileName)
+		if opt.DryRun {
+			fmt.Printf("[dry-run] 将上传软链接清单(%d 个软链接): %s\n", symlinkManifest.Count(), manifestSavePath)
+		} else {
+			manifestPath := path.Join(config.GetTempDir(), fmt.Sprintf("symlinks-%d.json", time.Now().UnixNano()))
+			if er := symlinkManifest.Save(manifestPath); er != nil {
+				fmt.Printf("保存软链接清单失败: %s\n", er)
+			} else if fi, er := os.Stat(manifestPath); er == nil {
+				defer os.Remove(manifestPath)
+				fmt.Printf("记录 %d 个软链接到清单: %s\n", symlinkManifest.Count(), manifestSavePath)
+				addUploadTask(localfile.NewSymlinkFile(manifestPath), fi, manifestSavePath, time.Now())
+			}
+		}
+	}
+	if batchSkipped > 0 {
+		fmt.Printf("批次清单中已上传, 跳过 %d 个文件\n", batchSkipped)
+	}
+
+	if uploadTasks.merged > 0 {
+		fmt.Printf("已合并 %d 个重复的上传任务(相同的本地文件和目标路径)\n", uploadTasks.merged)
+	}
+	if dedupeCount > 0 {
+		fmt.Printf("上传去重索引跳过 %d 个已上传的文件, 数据量: %s\n", dedupeCount, converter.ConvertFileSize(dedupeSize, 2))
+	}
+	if renameCount > 0 {
+		fmt.Printf("检测到 %d 个本地文件改名, 已重命名云盘文件, 节省上传数据量: %s\n", renameCount, converter.ConvertFileSize(renameSize, 2))
+	}
+	nameConflict.Print(os.Stdout)
+
+	if opt.DryRun {
+		fmt.Printf("\ndry-run模式, 未实际上传. 将上传 %d 个文件, 数据总量: %s, 过滤 %d 个文件/文件夹\n",
+			dryRunCount, converter.ConvertFileSize(dryRunSize, 2), filteredCount)
+		return nil
+	}
+
+	precheck.Print(os.Stdout)
+
 	// 执行上传任务
+	totalCount := executor.Count()
 	var failedList []*lane.Deque
+	speedSampleDone := make(chan struct{})
+	go func() {
+		// 每秒采样全局上传速度
+		ticker := time.NewTicker(1 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-speedSampleDone:
+				return
+			case <-ticker.C:
+				statistic.SpeedStat.Add(globalSpeedsStat.GetSpeeds())
+			}
+		}
+	}()
+	// 推送上传指标，daemon中运行时同时输出到 /metrics
+	collectMetrics := func() []*metrics.Point {
+		return []*metrics.Point{{
+			Measurement: "upload",
+			Tags:        map[string]string{"user": activeUser.Nickname, "target": savePath},
+			Fields: map[string]float64{
+				"speed":         float64(globalSpeedsStat.GetSpeeds()),
+				"total_size":    float64(statistic.TotalSize()),
+				"total_files":   float64(totalCount),
+				"succeed_files": float64(statistic.SucceedCount()),
+				"failed_files":  float64(len(statistic.FailedFiles())),
+				"queue":         float64(executor.Count()),
+				"elapsed":       statistic.Elapsed().Seconds(),
+			},
+		}}
+	}
+	metricsPusher, metricsErr := metrics.NewPusher(config.Config.MetricsUrl, config.Config.MetricsInterval, collectMetrics)
+	if metricsErr != nil {
+		fmt.Printf("指标推送地址配置错误: %s\n", metricsErr)
+	}
+	metricsPusher.Start()
+	metricsKey := fmt.Sprintf("upload-%p", statistic)
+	metrics.Default.Register(metricsKey, collectMetrics)
+	opt.Control.SetProgressFunc(func() *taskframework.TaskProgress {
+		return &taskframework.TaskProgress{
+			TotalFiles:   int64(totalCount),
+			SucceedFiles: int64(statistic.SucceedCount()),
+			FailedFiles:  int64(len(statistic.FailedFiles())),
+			TotalSize:    statistic.TotalSize(),
+			Speed:        globalSpeedsStat.GetSpeeds(),
+			Elapsed:      statistic.Elapsed().Seconds(),
+		}
+	})
 	executor.Execute()
+	close(speedSampleDone)
+	autoTuner.Finish()
+	metricsPusher.Stop()
+	metrics.Default.Unregister(metricsKey)
+	if executor.IsStopped() {
+		fmt.Printf("\n上传已取消, %d 个文件没有上传\n", executor.Count())
+		fmt.Printf("正在上传的文件已保存断点, 重新执行相同的上传命令即可继续上传\n")
+	}
+	if summary := riskGuard.Summary(); summary != "" {
+		fmt.Printf("%s\n", summary)
+	}
 	failed := executor.FailedDeque()
+	// 加密上传的文件不再打包成zip，避免上传未加密的内容
+	if opt.ZipOnReject && encryptor == nil && failed.Size() > 0 && !timeBudget.Exceeded() && !executor.IsStopped() {
+		failed = retryRejectedWithZip(failed, statistic, opt.ZipPassword, userDataDir)
+	}
 	if failed.Size() > 0 {
 		failedList = append(failedList, failed)
 	}
+	if videoWarmup != nil {
+		fmt.Printf("等待视频转码预热完成...\n")
+		if succeed, failed := videoWarmup.Wait(); succeed+failed > 0 {
+			fmt.Printf("视频转码预热: 成功 %d 个, 失败 %d 个\n", succeed, failed)
+		}
+	}
+	result := newUploadJsonData(savePath, totalCount, statistic, timeBudget.Unfinished(), executor.IsStopped())
+	setUploadJsonResult(result)
 
 	fmt.Printf("\n")
 	fmt.Printf("上传结束, 时间: %s, 数据总量: %s\n", utils.ConvertTime(statistic.Elapsed()), converter.ConvertFileSize(statistic.TotalSize(), 2))
+	if targetQuota != nil {
+		targetQuota.AddUploaded(statistic.TotalSize())
+		fmt.Printf("%s\n", targetQuota)
+	}
+	failedCount := 0
+	for _, f := range failedList {
+		failedCount += f.Size()
+	}
+	notify.TaskFinished(config.Config.DesktopNotify, "上传", statistic.Elapsed(), failedCount,
+		fmt.Sprintf("上传到 %s, 数据总量: %s", savePath, converter.ConvertFileSize(statistic.TotalSize(), 2)))
+	taskBatchFinishPluginCallback(plugin, activeUser, "upload", opt.DriveId, result)
+	addNotifyDigestBatch("上传", result)
+	logTransferResult("上传", result)
+	sendUploadWebhookEvent(result)
+	if len(result.OverLimitFiles) > 0 {
+		sendQuotaWebhookEvent(fmt.Sprintf("有%d个文件超出套餐限制或目标目录配额, 未上传到 %s", len(result.OverLimitFiles), result.Target))
+	}
+	if batchManifest != nil {
+		if result.FailedFiles == 0 && !result.Canceled && len(result.Unfinished) == 0 && len(result.OverLimitFiles) == 0 {
+			// 批次全部上传完成，下次执行相同的命令重新开始
+			if err := batchManifest.Remove(); err != nil {
+				logger.Verboseln("remove upload batch manifest error: ", err)
+			}
+		} else {
+			batchManifest.Close()
+			fmt.Printf("批次清单已保存, 使用相同的参数重新执行上传命令从中断处继续\n")
+		}
+	}
+	if statistic.SpeedStat.Peak() > 0 {
+		fmt.Printf("平均速度: %s/s, 峰值速度: %s/s, P95速度: %s/s\n",
+			converter.ConvertFileSize(statistic.SpeedStat.Average(), 2),
+			converter.ConvertFileSize(statistic.SpeedStat.Peak(), 2),
+			converter.ConvertFileSize(statistic.SpeedStat.Percentile(95), 2))
+	}
 
 	// 输出上传失败的文件列表
 	for _, failed := range failedList {
@@ -439,5 +1476,300 @@ func RunUpload(localPaths []string, savePath string, opt *UploadOptions) {
 			tb.Render()
 		}
 	}
+
+	// 输出超出套餐限制的文件列表
+	if overLimitFiles := statistic.OverLimitFiles(); len(overLimitFiles) > 0 {
+		fmt.Printf("以下文件超出套餐限制或目标目录配额, 未上传: \n")
+		tb := cmdtable.NewTable(os.Stdout)
+		tb.SetHeader([]string{"文件路径", "文件大小", "原因"})
+		for _, f := range overLimitFiles {
+			tb.Append([]string{f.LocalFilePath, converter.ConvertFileSize(f.FileSize, 2), f.Reason})
+		}
+		tb.Render()
+	}
+
+	// 输出因为到达时间预算没有完成上传的文件列表
+	if unfinished := timeBudget.Unfinished(); len(unfinished) > 0 {
+		fmt.Printf("已到达时间预算 %s, 以下文件未上传完成, 重新执行相同的上传命令即可继续: \n", timeBudget.Budget)
+		tb := cmdtable.NewTable(os.Stdout)
+		for _, f := range unfinished {
+			tb.Append([]string{f})
+		}
+		tb.Render()
+	}
+
+	// 保存加密文件映射清单
+	if encryptItems := encryptor.Items(); len(encryptItems) > 0 {
+		manifestFile := filepath.Join(userDataDir, panupload.EncryptManifestFileName)
+		if err := panupload.AppendEncryptManifest(manifestFile, encryptItems); err != nil {
+			fmt.Printf("保存加密文件映射清单失败: %s\n", err)
+		} else {
+			fmt.Printf("已加密上传 %d 个文件, 映射清单已保存到: %s\n", len(encryptItems), manifestFile)
+		}
+	}
+
+	// 按目录汇总上传结果
+	if opt.TreeSummary {
+		panupload.NewUploadDirTree(result.Files).Print(os.Stdout)
+	}
+
+	// 输出耗时统计
+	timingReport.Print(os.Stdout)
+
+	// 生成HTML汇总报告
+	if opt.ReportFile != "" {
+		htmlReport := &panupload.UploadHtmlReport{
+			Title:      "阿里云盘上传报告",
+			SavePath:   savePath,
+			StartTime:  startTime,
+			Statistic:  statistic,
+			Timing:     timingReport,
+			TotalCount: totalCount,
+		}
+		if err := htmlReport.WriteFile(opt.ReportFile); err != nil {
+			fmt.Printf("生成上传报告失败: %s\n", err)
+		} else {
+			fmt.Printf("上传报告已保存到: %s\n", opt.ReportFile)
+		}
+	}
+
+	// 按保留策略清理旧的日期备份目录，本次备份不完整时不清理
+	if opt.Retention != nil {
+		if _, ok := parseBackupDate(path.Base(savePath)); !ok {
+			fmt.Printf("上传目标目录不是日期目录, 不清理旧备份: %s\n", savePath)
+		} else if result.FailedFiles > 0 || result.Canceled || len(result.Unfinished) > 0 || len(result.OverLimitFiles) > 0 {
+			fmt.Printf("本次备份没有全部上传成功, 不清理旧备份\n")
+		} else {
+			fmt.Printf("\n")
+			if err := runPruneBackup(activeUser, "upload --retention", opt.DriveId, path.Dir(savePath), opt.Retention, false); err != nil {
+				fmt.Println(err)
+			}
+		}
+	}
 	activeUser.DeleteCache(GetAllPathFolderByPath(savePath))
+	return result
+}
+
+// newUploadJsonData 上传结果，包括每个文件的上传结果
+func newUploadJsonData(savePath string, totalCount int, statistic *panupload.UploadStatistic, unfinished []string, canceled bool) *transferJsonData {
+	files := statistic.FileResults()
+	failedFiles := statistic.FailedFiles()
+	for _, f := range failedFiles {
+		files = append(files, &functions.FileResult{
+			Path:   f.LocalFilePath,
+			Size:   f.FileSize,
+			Status: functions.FileResultFailed,
+			Error:  f.Reason,
+		})
+	}
+	return &transferJsonData{
+		Target:         savePath,
+		TotalFiles:     totalCount,
+		SucceedFiles:   statistic.SucceedCount(),
+		FailedFiles:    len(failedFiles),
+		TotalSize:      statistic.TotalSize(),
+		Elapsed:        statistic.Elapsed().Seconds(),
+		Canceled:       canceled,
+		Files:          files,
+		OverLimitFiles: statistic.OverLimitFiles(),
+		Unfinished:     unfinished,
+	}
+}
+
+// addSkippedFileResult 记录扫描时已经跳过上传的文件，只在按目录树状汇总时记录，其他情况下文件结果和之前保持一致
+func addSkippedFileResult(statistic *panupload.UploadStatistic, localPath, savePath string, size int64) {
+	statistic.AddFileResult(&functions.FileResult{
+		Path:   localPath,
+		Target: savePath,
+		Size:   size,
+		Status: functions.FileResultSkipped,
+	})
+}
+
+// setUploadJsonResult 设置上传的JSON输出以及审计日志的操作详情
+func setUploadJsonResult(result *transferJsonData) {
+	setAuditDetail("%s", uploadAuditDetail(result))
+	setJsonData(result)
+	switch {
+	case result.Canceled:
+		setJsonError(JsonCodeCanceled, "上传已取消")
+	case result.FailedFiles > 0:
+		setJsonError(JsonCodePartialFailed, fmt.Sprintf("%d 个文件上传失败", result.FailedFiles))
+	}
+}
+
+// uploadAuditDetail 审计日志中上传的操作详情
+func uploadAuditDetail(result *transferJsonData) string {
+	return fmt.Sprintf("上传到 %s, 成功 %d 个文件, 失败 %d 个文件, 数据量 %s",
+		result.Target, result.SucceedFiles, result.FailedFiles, converter.ConvertFileSize(result.TotalSize, 2))
+}
+
+func newUploadTaskSet() *uploadTaskSet {
+	return &uploadTaskSet{
+		keys: map[string]struct{}{},
+	}
+}
+
+// add 记录上传任务，localAbsPath 为本地文件绝对路径。已经存在相同的任务时返回false
+func (s *uploadTaskSet) add(localAbsPath, savePath string) bool {
+	key := localAbsPath + "\x00" + savePath
+	if _, exist := s.keys[key]; exist {
+		s.merged++
+		return false
+	}
+	s.keys[key] = struct{}{}
+	return true
+}
+
+// absLocalPaths 本地路径转换为绝对路径，保留表示只上传目录内容的结尾路径分隔符
+func absLocalPaths(localPaths []string) []string {
+	paths := make([]string, 0, len(localPaths))
+	for _, p := range localPaths {
+		absPath, err := filepath.Abs(p)
+		if err != nil {
+			absPath = p
+		}
+		if isDirContentsPath(p) {
+			absPath += string(os.PathSeparator)
+		}
+		paths = append(paths, absPath)
+	}
+	return paths
+}
+
+// isDirContentsPath 本地路径是否以路径分隔符结尾。rsync风格：src/ 表示上传目录中的内容，src 表示上传目录本身
+func isDirContentsPath(localPath string) bool {
+	return strings.HasSuffix(localPath, "/") || (os.PathSeparator == '\\' && strings.HasSuffix(localPath, "\\"))
+}
+
+// prepareUploadNetwork 校准服务器时间并进行网络预检，返回false时不再上传。只列出文件时不上传，跳过全部网络检查
+func prepareUploadNetwork(activeUser *config.PanUser, dryRun bool) bool {
+	if dryRun {
+		return true
+	}
+	// 校准服务器时间，避免本地时钟偏差导致上传链接签名校验失败
+	functions.CalibrateServerTime()
+
+	// 网络预检，网络不通、token失效时立即退出，避免生成大量上传任务后逐个失败
+	preflight, err := panupload.UploadPreflight(activeUser.PanClient())
+	if err != nil {
+		fmt.Printf("上传前网络预检失败: %s\n", err)
+		setJsonError(JsonCodeFailed, "上传前网络预检失败: "+err.Error())
+		return false
+	}
+	if preflight.Warning != "" {
+		fmt.Printf("警告: %s\n", preflight.Warning)
+	}
+	logger.Verbosef("upload preflight latency: %s\n", preflight.Latency)
+	return true
+}
+
+// retryRejectedWithZip 把被网盘拒绝上传的文件打包成加密zip再上传一次，返回仍然失败的任务
+func retryRejectedWithZip(failed *lane.Deque, statistic *panupload.UploadStatistic, password, userDataDir string) *lane.Deque {
+	remain := lane.NewDeque()
+	tempDir, err := os.MkdirTemp(config.GetTempDir(), "aliyunpan-zip")
+	if err != nil {
+		fmt.Printf("创建临时目录失败, 无法压缩重传: %s\n", err)
+		return failed
+	}
+	defer os.RemoveAll(tempDir)
+
+	executor := &taskframework.TaskExecutor{
+		IsFailedDeque: true,
+	}
+	executor.SetParallel(1)
+	zipItems := map[*panupload.UploadTaskUnit]*panupload.ZipRetryItem{}
+	originals := map[*panupload.UploadTaskUnit]*taskframework.TaskInfoItem{}
+	for e := failed.Shift(); e != nil; e = failed.Shift() {
+		item := e.(*taskframework.TaskInfoItem)
+		unit := item.Unit.(*panupload.UploadTaskUnit)
+		if !unit.IsRejected() {
+			remain.Append(item)
+			continue
+		}
+		zipPassword := password
+		if zipPassword == "" {
+			zipPassword = panupload.RandomZipPassword()
+		}
+		zipItem := panupload.NewZipRetryItem(unit.LocalFileChecksum.Path.LogicPath, unit.SavePath, tempDir, zipPassword)
+		fmt.Printf("[%s] 文件被网盘拒绝, 正在压缩成加密zip: %s\n", item.Info.Id(), zipItem.LocalPath)
+		if err = zipItem.Compress(); err != nil {
+			fmt.Printf("[%s] 压缩文件失败: %s\n", item.Info.Id(), err)
+			remain.Append(item)
+			continue
+		}
+		zipUnit := &panupload.UploadTaskUnit{
+			LocalFileChecksum: localfile.NewLocalSymlinkFileEntity(localfile.NewSymlinkFile(zipItem.ZipFile)),
+			SavePath:          zipItem.ZipPath,
+			DriveId:           unit.DriveId,
+			PanClient:         unit.PanClient,
+			UploadingDatabase: unit.UploadingDatabase,
+			FolderCreateMutex: unit.FolderCreateMutex,
+			FolderIdCache:     unit.FolderIdCache,
+			ApiPacer:          unit.ApiPacer,
+			Parallel:          unit.Parallel,
+			NoRapidUpload:     true, // 压缩文件每次内容都不同，无需秒传
+			NoChecksum:        true,
+			BlockSize:         unit.BlockSize,
+			UploadStatistic:   statistic,
+			SharedRateLimit:   unit.SharedRateLimit,
+			Control:           unit.Control,
+			Reporter:          unit.Reporter,
+			ShowProgress:      unit.ShowProgress,
+			GlobalSpeedsStat:  unit.GlobalSpeedsStat,
+			FileRecorder:      unit.FileRecorder,
+			Plugin:            unit.Plugin,
+		}
+		zipItems[zipUnit] = zipItem
+		originals[zipUnit] = item
+		executor.Append(zipUnit, item.Info.MaxRetry())
+	}
+	if len(zipItems) == 0 {
+		return remain
+	}
+
+	fmt.Printf("\n开始上传被拒文件的加密zip, 数量: %d\n", len(zipItems))
+	executor.Execute()
+	for e := executor.FailedDeque().Shift(); e != nil; e = executor.FailedDeque().Shift() {
+		zipUnit := e.(*taskframework.TaskInfoItem).Unit.(*panupload.UploadTaskUnit)
+		// 保留原始文件的失败记录
+		statistic.RemoveFailedFile(zipUnit.LocalFileChecksum.Path.LogicPath)
+		remain.Append(originals[zipUnit])
+		delete(zipItems, zipUnit)
+	}
+	if len(zipItems) == 0 {
+		return remain
+	}
+
+	succeed := make([]*panupload.ZipRetryItem, 0, len(zipItems))
+	tb := cmdtable.NewTable(os.Stdout)
+	tb.SetHeader([]string{"本地文件", "网盘zip文件", "解压密码"})
+	for _, zipItem := range zipItems {
+		statistic.RemoveFailedFile(zipItem.LocalPath)
+		succeed = append(succeed, zipItem)
+		tb.Append([]string{zipItem.LocalPath, zipItem.ZipPath, zipItem.Password})
+	}
+	fmt.Printf("以下被拒文件已经打包成加密zip上传: \n")
+	tb.Render()
+	manifestFile := filepath.Join(userDataDir, panupload.ZipManifestFileName)
+	if err = panupload.AppendZipManifest(manifestFile, succeed); err != nil {
+		fmt.Printf("保存zip映射清单失败: %s\n", err)
+	} else {
+		fmt.Printf("zip映射清单已保存到: %s\n", manifestFile)
+	}
+	return remain
+}
+
+// newUploadReporter 根据 --reporter 创建任务单元状态上报，cli 返回nil使用默认的命令行输出
+func newUploadReporter(name string) (panupload.UploadReporter, bool) {
+	switch name {
+	case "", "cli":
+		return nil, true
+	case "json":
+		// 事件流输出到标准错误，和标准输出的汇总信息分开
+		return panupload.NewJsonUploadReporter(os.Stderr), true
+	}
+	fmt.Printf("上传状态输出格式错误: %s, 可选值: cli、json\n", name)
+	setJsonError(JsonCodeBadArgs, "上传状态输出格式错误: "+name)
+	return nil, false
 }
@@ -0,0 +1,235 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/tickstep/aliyunpan/cmder/cmdtable"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/utils"
+	"github.com/tickstep/library-go/converter"
+	"github.com/tickstep/library-go/logger"
+)
+
+const (
+	// fanoutModeUpload 第一个目标，实际上传文件数据
+	fanoutModeUpload = "upload"
+	// fanoutModeRapid 同账号的其余目标，使用秒传
+	fanoutModeRapid = "rapid"
+	// fanoutModeIndependent 其他账号的目标，独立上传
+	fanoutModeIndependent = "independent"
+)
+
+var fanoutModeName = map[string]string{
+	fanoutModeUpload:      "实传",
+	fanoutModeRapid:       "秒传",
+	fanoutModeIndependent: "独立上传",
+}
+
+type (
+	// uploadFanoutTarget 扇出上传的目标
+	uploadFanoutTarget struct {
+		User     *config.PanUser // 上传使用的账号
+		UserName string
+		SavePath string
+		DriveId  string
+		Mode     string
+	}
+
+	// uploadFanoutJsonData 扇出上传的JSON输出，每个目标的上传结果分别统计
+	uploadFanoutJsonData struct {
+		Targets []*uploadFanoutJsonTarget `json:"targets"`
+	}
+
+	uploadFanoutJsonTarget struct {
+		User   string            `json:"user"`
+		Mode   string            `json:"mode"`
+		Result *transferJsonData `json:"result"` // 没有上传时为null
+	}
+)
+
+// parseFanoutTarget 解析扇出目标，格式: <网盘目录> 或者 <账号>:<网盘目录>，账号可以是uid、别名、用户名或者昵称
+func parseFanoutTarget(spec string) (userKey, panPath string) {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "/") {
+		return "", spec
+	}
+	if idx := strings.Index(spec, ":"); idx >= 0 {
+		return strings.TrimSpace(spec[:idx]), strings.TrimSpace(spec[idx+1:])
+	}
+	return "", spec
+}
+
+// fanoutDriveId 其他账号中和当前目标网盘同类型的网盘ID
+func fanoutDriveId(src, dst *config.PanUser, driveId string) string {
+	switch driveId {
+	case src.DriveList.GetResourceDriveId():
+		return dst.DriveList.GetResourceDriveId()
+	case src.DriveList.GetAlbumDriveId():
+		return dst.DriveList.GetAlbumDriveId()
+	}
+	return dst.DriveList.GetFileDriveId()
+}
+
+// fanoutDedupeDb 其他账号使用的去重索引数据库文件，在原文件名后加上账号uid
+func fanoutDedupeDb(dbPath, userId string) string {
+	if dbPath == "" {
+		return ""
+	}
+	ext := filepath.Ext(dbPath)
+	return strings.TrimSuffix(dbPath, ext) + "_" + userId + ext
+}
+
+// newUploadFanoutTargets 解析并校验所有扇出目标，其他账号的目标需要先登录该账号
+func newUploadFanoutTargets(activeUser *config.PanUser, savePath string, opt *UploadOptions) ([]*uploadFanoutTarget, error) {
+	targets := []*uploadFanoutTarget{{
+		User:     activeUser,
+		UserName: activeUser.Nickname,
+		SavePath: activeUser.PathJoin(opt.DriveId, savePath),
+		DriveId:  opt.DriveId,
+		Mode:     fanoutModeUpload,
+	}}
+	exists := map[string]bool{activeUser.UserId + ":" + opt.DriveId + ":" + targets[0].SavePath: true}
+	c := config.Config
+	for _, spec := range opt.Fanout {
+		userKey, panPath := parseFanoutTarget(spec)
+		if panPath == "" {
+			return nil, fmt.Errorf("扇出目标格式错误: %s", spec)
+		}
+		target := &uploadFanoutTarget{
+			User:     activeUser,
+			UserName: activeUser.Nickname,
+			SavePath: activeUser.PathJoin(opt.DriveId, panPath),
+			DriveId:  opt.DriveId,
+			Mode:     fanoutModeRapid,
+		}
+		if userKey != "" {
+			u := c.UserList.FindUser(userKey)
+			if u == nil {
+				return nil, fmt.Errorf("扇出目标账号不存在: %s", userKey)
+			}
+			if u.UserId != activeUser.UserId {
+				user, err := config.SetupUserByCookie(u.OpenapiToken, u.WebapiToken,
+					u.TicketId, u.UserId,
+					c.DeviceId, c.DeviceName,
+					c.ClientId, c.ClientSecret)
+				if err != nil || user == nil {
+					logger.Verboseln("setup fanout user error: ", err)
+					return nil, fmt.Errorf("扇出目标账号登录失败: %s", userKey)
+				}
+				target.User = user
+				target.UserName = u.Nickname
+				target.DriveId = fanoutDriveId(activeUser, user, opt.DriveId)
+				target.SavePath = u.PathJoin(target.DriveId, panPath)
+				target.Mode = fanoutModeIndependent
+			}
+		}
+		key := target.User.UserId + ":" + target.DriveId + ":" + path.Clean(target.SavePath)
+		if exists[key] {
+			fmt.Printf("扇出目标重复, 忽略: %s\n", spec)
+			continue
+		}
+		exists[key] = true
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// runUploadFanout 扇出上传，第一个目标实际上传，同账号的其余目标使用秒传，其他账号的目标独立上传，结果分别统计
+func runUploadFanout(localPaths []string, savePath string, opt *UploadOptions) {
+	activeUser := GetActiveUser()
+	targets, err := newUploadFanoutTargets(activeUser, savePath, opt)
+	if err != nil {
+		fmt.Println(err)
+		setJsonError(JsonCodeBadArgs, err.Error())
+		return
+	}
+
+	results := make([]*transferJsonData, len(targets))
+	for k, target := range targets {
+		fopt := *opt
+		fopt.Fanout = nil
+		fopt.DriveId = target.DriveId
+		if k > 0 {
+			// 报告和目标目录配额只针对第一个目标
+			fopt.ReportFile = ""
+			fopt.TargetQuota = 0
+			if target.Mode == fanoutModeRapid {
+				// 文件已经上传到同账号的第一个目标，需要计算SHA1才能秒传
+				fopt.NoRapidUpload = false
+				fopt.NoChecksum = false
+			}
+			if target.Mode == fanoutModeIndependent {
+				// 其他账号使用自己的去重索引，避免和当前账号的记录混在一起
+				fopt.DedupeDb = fanoutDedupeDb(opt.DedupeDb, target.User.UserId)
+			}
+		}
+		fmt.Printf("\n[扇出 %d/%d] %s上传到 %s: %s\n", k+1, len(targets), fanoutModeName[target.Mode], target.UserName, target.SavePath)
+		results[k] = runUpload(target.User, localPaths, target.SavePath, &fopt)
+		if results[k] == nil && !opt.DryRun {
+			fmt.Printf("[扇出 %d/%d] 上传失败, 不再上传到其余目标\n", k+1, len(targets))
+			break
+		}
+		if results[k] != nil && results[k].Canceled {
+			break
+		}
+	}
+	if opt.DryRun {
+		return
+	}
+
+	fmt.Printf("\n扇出上传结果:\n")
+	tb := cmdtable.NewTable(os.Stdout)
+	tb.SetHeader([]string{"#", "账号", "目标目录", "方式", "成功", "失败", "数据量", "耗时"})
+	jsonData := &uploadFanoutJsonData{}
+	failed, canceled := 0, false
+	for k, target := range targets {
+		r := results[k]
+		jsonData.Targets = append(jsonData.Targets, &uploadFanoutJsonTarget{
+			User:   target.UserName,
+			Mode:   target.Mode,
+			Result: r,
+		})
+		if r == nil {
+			tb.Append([]string{strconv.Itoa(k + 1), target.UserName, target.SavePath, fanoutModeName[target.Mode], "-", "-", "-", "未上传"})
+			failed++
+			continue
+		}
+		tb.Append([]string{strconv.Itoa(k + 1), target.UserName, target.SavePath, fanoutModeName[target.Mode],
+			strconv.Itoa(r.SucceedFiles), strconv.Itoa(r.FailedFiles),
+			converter.ConvertFileSize(r.TotalSize, 2), utils.ConvertTimeSecond(int64(r.Elapsed))})
+		if r.FailedFiles > 0 {
+			failed++
+		}
+		canceled = canceled || r.Canceled
+	}
+	tb.Render()
+
+	if !IsJsonOutput() {
+		return
+	}
+	setJsonData(jsonData)
+	switch {
+	case canceled:
+		setJsonError(JsonCodeCanceled, "上传已取消")
+	case failed > 0:
+		setJsonError(JsonCodePartialFailed, fmt.Sprintf("%d 个目标上传失败", failed))
+	}
+}
@@ -0,0 +1,21 @@
+package command
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestFanoutDedupeDb(t *testing.T) {
+	cases := []struct {
+		dbPath, userId, want string
+	}{
+		{"", "u1", ""},
+		{"/data/dedupe.db", "u1", "/data/dedupe_u1.db"},
+		{"/data/dedupe", "u2", "/data/dedupe_u2"},
+	}
+	for _, c := range cases {
+		if got := fanoutDedupeDb(filepath.FromSlash(c.dbPath), c.userId); got != filepath.FromSlash(c.want) {
+			t.Errorf("fanoutDedupeDb(%q, %q) = %q, want %q", c.dbPath, c.userId, got, c.want)
+		}
+	}
+}
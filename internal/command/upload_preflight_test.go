@@ -0,0 +1,10 @@
+package command
+
+import "testing"
+
+func TestPrepareUploadNetworkDryRun(t *testing.T) {
+	// 只列出文件时跳过校准时间和网络预检，不会访问账号的网盘客户端
+	if !prepareUploadNetwork(nil, true) {
+		t.Fatal("dry-run should continue without network checks")
+	}
+}
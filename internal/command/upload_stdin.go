@@ -0,0 +1,96 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/library-go/converter"
+	"github.com/tickstep/library-go/logger"
+)
+
+const (
+	// UploadStdinPath 上传的本地路径为 - 时从标准输入读取数据
+	UploadStdinPath = "-"
+)
+
+// spoolUploadStdin 把标准输入的数据写入临时文件。创建网盘上传任务需要文件大小和SHA1，长度未知的数据流无法直接上传，
+// 临时文件使用网盘文件名命名，上传后的文件名和目标路径一致。返回的cleanup在上传结束后调用，删除临时文件，可以重复调用。
+// 读取过程中收到 Ctrl+C、SIGTERM 信号时删除临时文件后退出
+func spoolUploadStdin(r io.Reader, spoolDir, targetPath string) (localPath string, cleanup func(), err error) {
+	fileName := path.Base(targetPath)
+	if strings.HasSuffix(targetPath, "/") || fileName == "." || fileName == "/" {
+		return "", nil, fmt.Errorf("从标准输入上传时网盘路径必须是文件路径，例如 /备份/dir.tgz")
+	}
+	if spoolDir == "" {
+		spoolDir = config.GetTempDir()
+	}
+	tmpDir, err := os.MkdirTemp(spoolDir, "aliyunpan-stdin-")
+	if err != nil {
+		return "", nil, err
+	}
+	once := sync.Once{}
+	cleanup = func() {
+		once.Do(func() {
+			if e := os.RemoveAll(tmpDir); e != nil {
+				logger.Verboseln("remove stdin spool dir error: ", e)
+			}
+		})
+	}
+	localPath = filepath.Join(tmpDir, fileName)
+	f, err := os.Create(localPath)
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+
+	fmt.Printf("正在从标准输入读取数据到临时文件: %s\n", localPath)
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-sigChan:
+			fmt.Printf("\n收到中断信号, 删除临时文件后退出\n")
+			f.Close()
+			cleanup()
+			flushJsonOutput(JsonCodeCanceled, "收到中断信号")
+			os.Exit(1)
+		case <-done:
+		}
+	}()
+	timeStart := time.Now()
+	n, err := io.Copy(f, r)
+	signal.Stop(sigChan)
+	close(done)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("读取标准输入失败: %s", err)
+	}
+	fmt.Printf("标准输入读取完成, 数据大小: %s, 耗时: %s\n", converter.ConvertFileSize(n, 2), time.Since(timeStart).Round(time.Second))
+	return localPath, cleanup, nil
+}
@@ -0,0 +1,47 @@
+package command
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tickstep/aliyunpan/internal/config"
+)
+
+func TestSpoolUploadStdin(t *testing.T) {
+	spoolDir := t.TempDir()
+	localPath, cleanup, err := spoolUploadStdin(strings.NewReader("hello"), spoolDir, "/备份/a.tgz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(localPath) != "a.tgz" {
+		t.Errorf("unexpected spool file: %s", localPath)
+	}
+	if data, err := os.ReadFile(localPath); err != nil || string(data) != "hello" {
+		t.Fatalf("unexpected spool data: %q %v", data, err)
+	}
+
+	cleanup()
+	cleanup()
+	if entries, _ := os.ReadDir(spoolDir); len(entries) != 0 {
+		t.Errorf("spool dir should be removed: %v", entries)
+	}
+
+	if _, _, err = spoolUploadStdin(strings.NewReader("hello"), spoolDir, "/备份/"); err == nil {
+		t.Error("dir target path should be rejected")
+	}
+}
+
+func TestSpoolUploadStdinDefaultDir(t *testing.T) {
+	// 未指定 --spool-dir 时临时文件保存在配置目录下的 temp 目录
+	t.Setenv(config.EnvConfigDir, t.TempDir())
+	localPath, cleanup, err := spoolUploadStdin(strings.NewReader("hello"), "", "/备份/a.tgz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	if rel, err := filepath.Rel(config.GetTempDir(), localPath); err != nil || strings.HasPrefix(rel, "..") {
+		t.Fatalf("spool file should be in config temp dir: %s", localPath)
+	}
+}
@@ -0,0 +1,27 @@
+package command
+
+import "testing"
+
+func TestUploadTaskSet(t *testing.T) {
+	s := newUploadTaskSet()
+	cases := []struct {
+		localPath, savePath string
+		added               bool
+	}{
+		{"/data/a.txt", "/backup/a.txt", true},
+		// 多个来源路径命中同一个文件
+		{"/data/a.txt", "/backup/a.txt", false},
+		// 同一个文件上传到不同的目标路径不合并
+		{"/data/a.txt", "/backup/data/a.txt", true},
+		{"/data/b.txt", "/backup/a.txt", true},
+		{"/data/a.txt", "/backup/data/a.txt", false},
+	}
+	for i, c := range cases {
+		if added := s.add(c.localPath, c.savePath); added != c.added {
+			t.Errorf("case %d: added %v, want %v", i, added, c.added)
+		}
+	}
+	if s.merged != 2 {
+		t.Fatalf("merged %d", s.merged)
+	}
+}
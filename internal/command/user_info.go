@@ -18,8 +18,8 @@ import (
 	"github.com/tickstep/aliyunpan/cmder"
 	"github.com/tickstep/aliyunpan/internal/config"
 	"github.com/urfave/cli"
-	"os"
 	"strconv"
+	"strings"
 )
 
 func CmdLoglist() cli.Command {
@@ -73,6 +73,9 @@ func CmdSu() cli.Command {
 				// 直接切换
 				uid = inputData
 			} else if c.NArg() == 0 {
+				if jsonDeclineInput() {
+					return nil
+				}
 				// 输出所有帐号供选择切换
 				cli.HandleAction(cmder.App().Command("loglist").Action, c)
 
@@ -115,6 +118,51 @@ func CmdSu() cli.Command {
 	}
 }
 
+func CmdAlias() cli.Command {
+	return cli.Command{
+		Name:      "alias",
+		Usage:     "设置帐号别名",
+		UsageText: cmder.App().Name + " alias <uid|用户名|昵称> [别名]",
+		Description: `
+	设置已登录帐号的别名, 设置后可以使用 --user=<别名> 指定命令使用的帐号.
+	不提供别名参数时清除该帐号的别名.
+
+	示例:
+	aliyunpan alias 1234567890 work
+	aliyunpan --user=work ls /
+	ALIYUNPAN_USER=work aliyunpan upload a.txt /
+`,
+		Category: "阿里云盘账号",
+		Before:   ReloadConfigFunc,
+		After:    SaveConfigFunc,
+		Action: func(c *cli.Context) error {
+			if c.NArg() < 1 || c.NArg() > 2 {
+				cli.ShowCommandHelp(c, c.Command.Name)
+				return nil
+			}
+			user := config.Config.UserList.FindUser(c.Args().Get(0))
+			if user == nil {
+				fmt.Printf("未找到指定的账号: %s\n", c.Args().Get(0))
+				return nil
+			}
+			alias := strings.TrimSpace(c.Args().Get(1))
+			if alias != "" {
+				if u := config.Config.UserList.FindUser(alias); u != nil && u.UserId != user.UserId {
+					fmt.Printf("别名和其他帐号重复: %s\n", alias)
+					return nil
+				}
+			}
+			user.Alias = alias
+			if alias == "" {
+				fmt.Printf("已清除帐号 %s 的别名\n", user.Nickname)
+			} else {
+				fmt.Printf("帐号 %s 的别名设置为: %s\n", user.Nickname, alias)
+			}
+			return nil
+		},
+	}
+}
+
 func CmdWho() cli.Command {
 	return cli.Command{
 		Name:        "who",
@@ -123,11 +171,11 @@ func CmdWho() cli.Command {
 		Category:    "阿里云盘账号",
 		Before:      ReloadConfigFunc,
 		Action: func(c *cli.Context) error {
-			if config.Config.ActiveUser() == nil {
-				fmt.Println("未登录账号")
-				os.Exit(1)
+			if GetActiveUser() == nil {
+				printNotLogin()
+				return cli.NewExitError("", 1)
 			}
-			activeUser := config.Config.ActiveUser()
+			activeUser := GetActiveUser()
 			cloudName := activeUser.GetDriveById(activeUser.ActiveDriveId).DriveName
 			user, _ := GetActivePanClient().OpenapiPanClient().GetUserInfo()
 			thirdParty := "未开通"
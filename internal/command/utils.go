@@ -18,9 +18,13 @@ import (
 	"github.com/tickstep/aliyunpan-api/aliyunpan"
 	"github.com/tickstep/aliyunpan-api/aliyunpan_web"
 	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/file/faultinject"
 	"github.com/tickstep/aliyunpan/internal/functions/panlogin"
+	"github.com/tickstep/aliyunpan/internal/global"
+	"github.com/tickstep/aliyunpan/internal/log"
 	"github.com/tickstep/aliyunpan/internal/plugins"
 	"github.com/tickstep/aliyunpan/internal/utils"
+	"github.com/tickstep/library-go/converter"
 	"github.com/tickstep/library-go/logger"
 	"github.com/urfave/cli"
 	"math/rand"
@@ -42,6 +46,14 @@ var (
 		if err != nil {
 			fmt.Printf("重载配置错误: %s\n", err)
 		}
+		commandUser = nil
+		if global.CommandUser != "" {
+			// 使用 --user 指定的账号，不改变配置文件中的当前登录账号
+			if commandUser, err = config.Config.LoadUser(global.CommandUser); err != nil {
+				fmt.Printf("%s\n", err)
+				return err
+			}
+		}
 		return nil
 	}
 
@@ -206,6 +218,8 @@ func RefreshWebTokenInNeed(activeUser *config.PanUser, deviceName string) bool {
 						if er1 := plugin.UserTokenRefreshFinishCallback(plugins.GetContext(activeUser), params); er1 != nil {
 							logger.Verbosef("UserTokenRefreshFinishCallback error: " + er1.Error())
 						}
+						sendTokenRefreshFailWebhookEvent(activeUser, "webapi", params.Message)
+						log.Error("刷新Token失败", "user", activeUser.Nickname, "type", "webapi", "error", params.Message)
 					}
 				}
 			}
@@ -272,6 +286,8 @@ func RefreshOpenTokenInNeed(activeUser *config.PanUser) bool {
 						if er1 := plugin.UserTokenRefreshFinishCallback(plugins.GetContext(activeUser), params); er1 != nil {
 							logger.Verbosef("UserTokenRefreshFinishCallback error: " + er1.Error())
 						}
+						sendTokenRefreshFailWebhookEvent(activeUser, "openapi", params.Message)
+						log.Error("刷新Token失败", "user", activeUser.Nickname, "type", "openapi", "error", params.Message)
 					}
 				}
 			}
@@ -314,8 +330,58 @@ func TryLogin() *config.PanUser {
 			// reload
 			ReloadConfigFunc(nil)
 
-			return config.Config.ActiveUser()
+			return GetActiveUser()
 		}
 	}
 	return nil
 }
+
+// startFaultInject 开启错误注入测试模式，返回结束时输出统计并关闭错误注入的方法。spec为空时不开启
+func startFaultInject(spec string) (stop func(), ok bool) {
+	if spec == "" {
+		return func() {}, true
+	}
+	cfg, err := faultinject.ParseConfig(spec)
+	if err != nil {
+		fmt.Printf("错误注入参数错误: %s\n", err)
+		setJsonError(JsonCodeBadArgs, "错误注入参数错误: "+err.Error())
+		return nil, false
+	}
+	injector := faultinject.Enable(*cfg)
+	fmt.Printf("警告: 已开启错误注入测试模式(%s), 传输会随机失败\n", injector.Config())
+	return func() {
+		fmt.Printf("错误注入统计: %s\n", injector.Stats())
+		faultinject.Disable()
+	}, true
+}
+
+// uploadRateFunc 按时间段上传限速的限速函数，没有配置 upload_rate_schedule 时返回nil
+func uploadRateFunc() func(t time.Time) int64 {
+	if rateSchedule := config.Config.UploadRateLimitSchedule(); rateSchedule != nil {
+		return rateSchedule.RateAt
+	}
+	return nil
+}
+
+// rateClassOrDefault 限速类别，未指定时使用命令的默认类别
+func rateClassOrDefault(class, defaultClass string) string {
+	if class = strings.TrimSpace(class); class != "" {
+		return class
+	}
+	return defaultClass
+}
+
+// parseMaxRate 解析 --max-rate 参数，例如：1MB、500KB/s。为空或者0代表不限制
+func parseMaxRate(rateStr string) (rate int64, ok bool) {
+	rateStr = strings.TrimSuffix(strings.TrimSpace(rateStr), "/s")
+	if rateStr == "" {
+		return 0, true
+	}
+	rate, err := converter.ParseFileSizeStr(rateStr)
+	if err != nil || rate < 0 {
+		fmt.Printf("限速参数格式错误: %s, 示例: 2MB、500KB\n", rateStr)
+		setJsonError(JsonCodeBadArgs, "限速参数格式错误: "+rateStr)
+		return 0, false
+	}
+	return rate, true
+}
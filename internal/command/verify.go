@@ -0,0 +1,330 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan/cmder"
+	"github.com/tickstep/aliyunpan/cmder/cmdtable"
+	"github.com/tickstep/aliyunpan/internal/functions/panupload"
+	"github.com/tickstep/aliyunpan/internal/functions/panwalk"
+	"github.com/tickstep/aliyunpan/internal/waitgroup"
+	"github.com/tickstep/library-go/converter"
+	"github.com/urfave/cli"
+)
+
+const (
+	// verifyStatusMissing 本地有，云盘没有
+	verifyStatusMissing = "missing"
+	// verifyStatusExtra 云盘有，本地没有
+	verifyStatusExtra = "extra"
+	// verifyStatusSizeMismatch 文件大小不一致
+	verifyStatusSizeMismatch = "size_mismatch"
+	// verifyStatusSha1Mismatch 文件大小一致，SHA1不一致
+	verifyStatusSha1Mismatch = "sha1_mismatch"
+	// verifyStatusUnreadable 本地文件不可读，无法计算SHA1
+	verifyStatusUnreadable = "unreadable"
+)
+
+type (
+	// verifyItem 校验发现的不一致文件
+	verifyItem struct {
+		Status    string `json:"status"`
+		Path      string `json:"path"` // 相对于校验目录的路径
+		LocalSize int64  `json:"localSize"`
+		PanSize   int64  `json:"panSize"`
+		LocalSha1 string `json:"localSha1,omitempty"`
+		PanSha1   string `json:"panSha1,omitempty"`
+	}
+
+	// verifyResult 校验结果
+	verifyResult struct {
+		LocalDir   string        `json:"localDir"`
+		PanDir     string        `json:"panDir"`
+		LocalFiles int           `json:"localFiles"` // 本地文件数量
+		PanFiles   int           `json:"panFiles"`   // 云盘文件数量
+		Matched    int           `json:"matched"`    // 一致的文件数量
+		Missing    int           `json:"missing"`    // 云盘缺失的文件数量
+		Extra      int           `json:"extra"`      // 云盘多出的文件数量
+		Mismatched int           `json:"mismatched"` // 内容不一致或者无法校验的文件数量
+		Items      []*verifyItem `json:"items"`
+	}
+)
+
+var (
+	verifyStatusName = map[string]string{
+		verifyStatusMissing:      "云盘缺失",
+		verifyStatusExtra:        "云盘多余",
+		verifyStatusSizeMismatch: "大小不一致",
+		verifyStatusSha1Mismatch: "SHA1不一致",
+		verifyStatusUnreadable:   "本地不可读",
+	}
+	verifyStatusOrder = []string{
+		verifyStatusMissing, verifyStatusExtra, verifyStatusSizeMismatch, verifyStatusSha1Mismatch, verifyStatusUnreadable,
+	}
+)
+
+func CmdVerify() cli.Command {
+	return cli.Command{
+		Name:      "verify",
+		Usage:     "校验本地目录和云盘目录的文件是否一致",
+		UsageText: cmder.App().Name + " verify <本地目录> <云盘目录>",
+		Description: `
+	递归对比本地目录和云盘目录下的所有文件，比较文件大小和SHA1，列出云盘缺失、云盘多余以及内容不一致的文件。
+	只读取文件信息，不会上传、下载或者修改任何文件，可以用来检查备份是否完整。
+	本地文件的SHA1并发计算，云盘文件直接使用网盘记录的SHA1。指定 --json 时以JSON格式输出校验结果。
+
+	示例:
+
+	校验本地 D:/Photos 目录和云盘 /照片 目录
+	aliyunpan verify D:/Photos /照片
+
+	只比较文件大小，不计算SHA1
+	aliyunpan verify --size-only D:/Photos /照片
+
+	使用8个线程计算本地文件SHA1
+	aliyunpan verify -p 8 D:/Photos /照片
+`,
+		Category: "阿里云盘",
+		Before:   ReloadConfigFunc,
+		Action: func(c *cli.Context) error {
+			if c.NArg() != 2 {
+				cli.ShowCommandHelp(c, c.Command.Name)
+				return nil
+			}
+			if GetActiveUser() == nil {
+				printNotLogin()
+				return nil
+			}
+			RunVerify(parseDriveId(c), c.Args().Get(0), c.Args().Get(1), c.Int("p"), c.Bool("size-only"))
+			return nil
+		},
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "driveId",
+				Usage: "网盘ID",
+				Value: "",
+			},
+			cli.IntFlag{
+				Name:  "p",
+				Usage: "计算本地文件SHA1的并发数",
+				Value: 4,
+			},
+			cli.BoolFlag{
+				Name:  "size-only",
+				Usage: "只比较文件大小，不计算SHA1",
+			},
+		},
+	}
+}
+
+// RunVerify 执行校验
+func RunVerify(driveId, localDir, panDir string, parallel int, sizeOnly bool) {
+	activeUser := GetActiveUser()
+	localDir, err := filepath.Abs(localDir)
+	if err != nil {
+		fmt.Printf("本地目录错误: %s\n", err)
+		setJsonError(JsonCodeBadArgs, "本地目录错误: "+err.Error())
+		return
+	}
+	if fi, e := os.Stat(localDir); e != nil || !fi.IsDir() {
+		fmt.Printf("本地目录不存在: %s\n", localDir)
+		setJsonError(JsonCodeBadArgs, "本地目录不存在: "+localDir)
+		return
+	}
+	panDir = path.Clean(activeUser.PathJoin(driveId, panDir))
+	panDirInfo, apierr := activeUser.PanClient().OpenapiPanClient().FileInfoByPath(driveId, panDir)
+	if apierr != nil || panDirInfo == nil || !panDirInfo.IsFolder() {
+		fmt.Printf("云盘目录不存在: %s\n", panDir)
+		setJsonError(JsonCodeBadArgs, "云盘目录不存在: "+panDir)
+		return
+	}
+
+	fmt.Printf("正在扫描云盘目录: %s\n", panDir)
+	panDirInfo.Path = panDir
+	panFiles := map[string]*aliyunpan.FileEntity{}
+	err = panwalk.NewWalker(activeUser.PanClient(), driveId).Walk(panDirInfo, func(file *aliyunpan.FileEntity) error {
+		if !file.IsFolder() {
+			panFiles[strings.TrimPrefix(strings.TrimPrefix(file.Path, panDir), "/")] = file
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("扫描云盘目录失败: %s\n", err)
+		setJsonErr(err)
+		return
+	}
+	fmt.Printf("正在扫描本地目录: %s\n", localDir)
+	localFiles, err := listVerifyLocalFiles(localDir)
+	if err != nil {
+		fmt.Printf("扫描本地目录失败: %s\n", err)
+		setJsonErr(err)
+		return
+	}
+
+	var sha1Func func(relPath string) string
+	if !sizeOnly {
+		fmt.Printf("正在计算本地文件SHA1, 并发数: %d\n", parallel)
+		sha1Func = func(relPath string) string {
+			return panupload.CalcLocalFileSha1(filepath.Join(localDir, filepath.FromSlash(relPath)))
+		}
+	}
+	result := compareVerifyTrees(localFiles, panFiles, sha1Func, parallel)
+	result.LocalDir = localDir
+	result.PanDir = panDir
+
+	fmt.Printf("\n本地文件: %d, 云盘文件: %d, 一致: %d, 云盘缺失: %d, 云盘多余: %d, 不一致: %d\n",
+		result.LocalFiles, result.PanFiles, result.Matched, result.Missing, result.Extra, result.Mismatched)
+	setJsonData(result)
+	if len(result.Items) == 0 {
+		fmt.Println("校验通过，本地目录和云盘目录的文件一致")
+		return
+	}
+	tb := cmdtable.NewTable(os.Stdout)
+	tb.SetHeader([]string{"#", "状态", "路径", "本地大小", "云盘大小"})
+	for k, item := range result.Items {
+		localSize, panSize := "-", "-"
+		if item.Status != verifyStatusExtra {
+			localSize = converter.ConvertFileSize(item.LocalSize, 2)
+		}
+		if item.Status != verifyStatusMissing {
+			panSize = converter.ConvertFileSize(item.PanSize, 2)
+		}
+		tb.Append([]string{fmt.Sprint(k + 1), verifyStatusName[item.Status], item.Path, localSize, panSize})
+	}
+	tb.Render()
+	setJsonError(JsonCodeVerifyMismatch, fmt.Sprintf("发现 %d 个不一致的文件", len(result.Items)))
+}
+
+// listVerifyLocalFiles 递归获取本地目录下的所有文件，返回相对路径 => 文件大小。符号链接按照链接指向的文件处理
+func listVerifyLocalFiles(localDir string) (map[string]int64, error) {
+	files := map[string]int64{}
+	err := filepath.Walk(localDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			if info, err = os.Stat(p); err != nil || info.IsDir() {
+				return nil
+			}
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		relPath, e := filepath.Rel(localDir, p)
+		if e != nil {
+			return e
+		}
+		files[filepath.ToSlash(relPath)] = info.Size()
+		return nil
+	})
+	return files, err
+}
+
+// compareVerifyTrees 对比本地文件和云盘文件。sha1Func 为nil时只比较文件大小，大小一致的文件才会计算本地SHA1
+func compareVerifyTrees(localFiles map[string]int64, panFiles map[string]*aliyunpan.FileEntity, sha1Func func(relPath string) string, parallel int) *verifyResult {
+	result := &verifyResult{
+		LocalFiles: len(localFiles),
+		PanFiles:   len(panFiles),
+		Items:      []*verifyItem{},
+	}
+	mutex := sync.Mutex{}
+	addItem := func(item *verifyItem) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		result.Items = append(result.Items, item)
+	}
+
+	if parallel < 1 {
+		parallel = 1
+	}
+	wg := waitgroup.NewWaitGroup(parallel)
+	for relPath, localSize := range localFiles {
+		pf, ok := panFiles[relPath]
+		if !ok {
+			addItem(&verifyItem{Status: verifyStatusMissing, Path: relPath, LocalSize: localSize})
+			continue
+		}
+		item := &verifyItem{Path: relPath, LocalSize: localSize, PanSize: pf.FileSize, PanSha1: strings.ToLower(pf.ContentHash)}
+		if localSize != pf.FileSize {
+			item.Status = verifyStatusSizeMismatch
+			addItem(item)
+			continue
+		}
+		if sha1Func == nil || item.PanSha1 == "" {
+			// 云盘没有记录SHA1的文件只能比较大小
+			mutex.Lock()
+			result.Matched++
+			mutex.Unlock()
+			continue
+		}
+		wg.AddDelta()
+		go func(item *verifyItem) {
+			defer wg.Done()
+			item.LocalSha1 = sha1Func(item.Path)
+			switch {
+			case item.LocalSha1 == "":
+				item.Status = verifyStatusUnreadable
+			case item.LocalSha1 != item.PanSha1:
+				item.Status = verifyStatusSha1Mismatch
+			default:
+				mutex.Lock()
+				result.Matched++
+				mutex.Unlock()
+				return
+			}
+			addItem(item)
+		}(item)
+	}
+	wg.Wait()
+
+	for relPath, pf := range panFiles {
+		if _, ok := localFiles[relPath]; !ok {
+			result.Items = append(result.Items, &verifyItem{Status: verifyStatusExtra, Path: relPath, PanSize: pf.FileSize, PanSha1: strings.ToLower(pf.ContentHash)})
+		}
+	}
+
+	order := map[string]int{}
+	for k, status := range verifyStatusOrder {
+		order[status] = k
+	}
+	sort.Slice(result.Items, func(i, j int) bool {
+		if result.Items[i].Status != result.Items[j].Status {
+			return order[result.Items[i].Status] < order[result.Items[j].Status]
+		}
+		return result.Items[i].Path < result.Items[j].Path
+	})
+	for _, item := range result.Items {
+		switch item.Status {
+		case verifyStatusMissing:
+			result.Missing++
+		case verifyStatusExtra:
+			result.Extra++
+		default:
+			result.Mismatched++
+		}
+	}
+	return result
+}
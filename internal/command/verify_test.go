@@ -0,0 +1,49 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+)
+
+func TestCompareVerifyTrees(t *testing.T) {
+	localFiles := map[string]int64{
+		"a.txt":     10,
+		"dir/b.txt": 20,
+		"dir/c.txt": 30,
+		"d.txt":     40,
+		"e.txt":     50,
+	}
+	panFiles := map[string]*aliyunpan.FileEntity{
+		"a.txt":     {FileName: "a.txt", FileSize: 10, ContentHash: "AAA"},
+		"dir/b.txt": {FileName: "b.txt", FileSize: 21, ContentHash: "BBB"},
+		"dir/c.txt": {FileName: "c.txt", FileSize: 30, ContentHash: "CCC"},
+		"e.txt":     {FileName: "e.txt", FileSize: 50},
+		"f.txt":     {FileName: "f.txt", FileSize: 60, ContentHash: "FFF"},
+	}
+	sha1s := map[string]string{"a.txt": "aaa", "dir/c.txt": "ccc0"}
+	result := compareVerifyTrees(localFiles, panFiles, func(relPath string) string {
+		return sha1s[relPath]
+	}, 2)
+
+	if result.Matched != 2 || result.Missing != 1 || result.Extra != 1 || result.Mismatched != 2 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	expected := []struct{ status, path string }{
+		{verifyStatusMissing, "d.txt"},
+		{verifyStatusExtra, "f.txt"},
+		{verifyStatusSizeMismatch, "dir/b.txt"},
+		{verifyStatusSha1Mismatch, "dir/c.txt"},
+	}
+	for k, e := range expected {
+		if result.Items[k].Status != e.status || result.Items[k].Path != e.path {
+			t.Errorf("unexpected item %d: %+v", k, result.Items[k])
+		}
+	}
+
+	// 只比较大小时不计算SHA1
+	result = compareVerifyTrees(localFiles, panFiles, nil, 2)
+	if result.Matched != 3 || result.Mismatched != 1 {
+		t.Errorf("unexpected size only result: %+v", result)
+	}
+}
@@ -0,0 +1,301 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/tickstep/aliyunpan/cmder"
+	"github.com/tickstep/aliyunpan/cmder/cmdtable"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/webdav"
+	"github.com/tickstep/library-go/converter"
+	"github.com/urfave/cli"
+)
+
+func CmdWebdav() cli.Command {
+	return cli.Command{
+		Name:      "webdav",
+		Usage:     "启动WebDAV服务",
+		UsageText: cmder.App().Name + " webdav [arguments...]",
+		Description: `
+	把网盘映射为WebDAV服务，根目录下每个网盘（备份盘、资源库、相册）对应一个文件夹，可以使用文件管理器、播放器等WebDAV客户端挂载访问。
+	读取文件时使用Range请求按分片下载到本地缓存目录（最多缓存1GB，超过后淘汰最久未使用的分片），写入的文件在上传完成后才会出现在网盘中。服务退出后本地缓存会被清理。
+	未配置登录用户时不需要认证，建议只监听本机地址，或者配置登录用户以及HTTPS证书。
+
+	示例:
+
+	使用配置文件中的设置启动WebDAV服务，默认监听 127.0.0.1:23077
+	aliyunpan webdav
+
+	监听所有网卡的8080端口，以只读模式启动
+	aliyunpan webdav -address 0.0.0.0 -port 8080 -readonly
+
+	使用HTTPS启动
+	aliyunpan webdav -tls-cert server.crt -tls-key server.key
+
+	记录访问日志到 access.log，每10分钟输出一次各客户端的流量统计
+	aliyunpan webdav -access-log access.log -stats-interval 10m
+
+	新增或者更新登录用户 tickstep
+	aliyunpan webdav user set tickstep 123456
+
+	删除登录用户 tickstep
+	aliyunpan webdav user rm tickstep
+`,
+		Category: "阿里云盘",
+		Before:   ReloadConfigFunc,
+		Action: func(c *cli.Context) error {
+			if GetActiveUser() == nil {
+				printNotLogin()
+				return nil
+			}
+			cfg := config.Config.Webdav
+			if c.IsSet("address") {
+				cfg.Address = c.String("address")
+			}
+			if c.IsSet("port") {
+				cfg.Port = c.Int("port")
+			}
+			if c.IsSet("readonly") {
+				cfg.ReadOnly = c.Bool("readonly")
+			}
+			if c.IsSet("tls-cert") {
+				cfg.TlsCertFile = c.String("tls-cert")
+			}
+			if c.IsSet("tls-key") {
+				cfg.TlsKeyFile = c.String("tls-key")
+			}
+			if c.IsSet("access-log") {
+				cfg.AccessLogFile = c.String("access-log")
+			}
+			RunWebdav(&cfg, c.Duration("stats-interval"))
+			return nil
+		},
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "address",
+				Usage: "绑定地址，默认: " + config.DefaultWebdavAddress,
+			},
+			cli.IntFlag{
+				Name:  "port",
+				Usage: "监听端口，默认: " + strconv.Itoa(config.DefaultWebdavPort),
+			},
+			cli.BoolFlag{
+				Name:  "readonly",
+				Usage: "只读模式，禁止上传、删除、移动等写操作",
+			},
+			cli.StringFlag{
+				Name:  "tls-cert",
+				Usage: "TLS证书文件路径，和 tls-key 同时指定时启用HTTPS",
+			},
+			cli.StringFlag{
+				Name:  "tls-key",
+				Usage: "TLS私钥文件路径",
+			},
+			cli.StringFlag{
+				Name:  "access-log",
+				Usage: "访问日志文件路径，记录每个请求的客户端IP、路径、字节数以及耗时，\"-\" 代表输出到控制台",
+			},
+			cli.DurationFlag{
+				Name:  "stats-interval",
+				Usage: "定时输出各客户端流量统计的间隔，例如：10m，默认只在服务停止时输出",
+			},
+		},
+		Subcommands: []cli.Command{
+			{
+				Name:      "user",
+				Usage:     "管理WebDAV登录用户",
+				UsageText: cmder.App().Name + " webdav user",
+				Action: func(c *cli.Context) error {
+					RunWebdavUserList()
+					return nil
+				},
+				Subcommands: []cli.Command{
+					{
+						Name:      "set",
+						Usage:     "新增或者更新登录用户",
+						UsageText: cmder.App().Name + " webdav user set <用户名> <密码>",
+						Action: func(c *cli.Context) error {
+							if c.NArg() != 2 {
+								cli.ShowCommandHelp(c, c.Command.Name)
+								return nil
+							}
+							if err := config.Config.Webdav.SetUser(c.Args().Get(0), c.Args().Get(1)); err != nil {
+								fmt.Println(err)
+								return nil
+							}
+							fmt.Printf("设置登录用户成功: %s\n", c.Args().Get(0))
+							return nil
+						},
+						After: SaveConfigFunc,
+					},
+					{
+						Name:      "rm",
+						Usage:     "删除登录用户",
+						UsageText: cmder.App().Name + " webdav user rm <用户名>",
+						Action: func(c *cli.Context) error {
+							if c.NArg() != 1 {
+								cli.ShowCommandHelp(c, c.Command.Name)
+								return nil
+							}
+							if !config.Config.Webdav.RemoveUser(c.Args().Get(0)) {
+								fmt.Printf("登录用户不存在: %s\n", c.Args().Get(0))
+								return nil
+							}
+							fmt.Printf("删除登录用户成功: %s\n", c.Args().Get(0))
+							return nil
+						},
+						After: SaveConfigFunc,
+					},
+				},
+			},
+		},
+	}
+}
+
+// RunWebdavUserList 列出WebDAV登录用户
+func RunWebdavUserList() {
+	users := config.Config.Webdav.Users
+	if len(users) == 0 {
+		fmt.Println("未配置登录用户，访问WebDAV服务不需要认证")
+		return
+	}
+	tb := cmdtable.NewTable(os.Stdout)
+	tb.SetHeader([]string{"#", "用户名"})
+	for idx, u := range users {
+		tb.Append([]string{strconv.Itoa(idx + 1), u.Username})
+	}
+	tb.Render()
+}
+
+// RunWebdav 启动WebDAV服务，收到退出信号后清理本地缓存并输出流量统计
+func RunWebdav(cfg *config.WebdavConfig, statsInterval time.Duration) {
+	activeUser := GetActiveUser()
+	drives := config.DriveInfoList{}
+	for _, d := range activeUser.DriveList {
+		if d.DriveId != "" {
+			drives = append(drives, d)
+		}
+	}
+
+	cacheDir, err := os.MkdirTemp("", "aliyunpan-webdav-")
+	if err != nil {
+		fmt.Printf("创建缓存目录失败: %s\n", err)
+		return
+	}
+	transfer, err := webdav.NewTaskTransfer(activeUser.PanClient(), cacheDir, config.Config.UserDataDir(activeUser.UserId))
+	if err != nil {
+		os.RemoveAll(cacheDir)
+		fmt.Printf("启动WebDAV服务失败: %s\n", err)
+		return
+	}
+	defer transfer.Close()
+	blocks, err := webdav.NewBlockCache(activeUser.PanClient(), filepath.Join(cacheDir, "blocks"), webdav.DefaultBlockSize, webdav.DefaultBlockCacheSize)
+	if err != nil {
+		fmt.Printf("创建读缓存目录失败: %s\n", err)
+		return
+	}
+
+	fs, err := webdav.NewPanFileSystem(activeUser.PanClient(), drives,
+		filepath.Join(activeUserDataDir(), "webdav"), cfg.MetaCacheExpiration(), blocks, transfer)
+	if err != nil {
+		fmt.Printf("打开目录元数据缓存失败: %s\n", err)
+		return
+	}
+	defer fs.Close()
+
+	var accessLogOut io.Writer
+	switch cfg.AccessLogFile {
+	case "":
+	case "-":
+		accessLogOut = os.Stdout
+	default:
+		logFile, err := os.OpenFile(cfg.AccessLogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			fmt.Printf("打开访问日志文件失败: %s\n", err)
+			return
+		}
+		defer logFile.Close()
+		accessLogOut = logFile
+	}
+	accessLog := webdav.NewAccessLogger(accessLogOut)
+	defer printWebdavTraffic(accessLog)
+
+	scheme := "http"
+	if cfg.IsTlsEnabled() {
+		scheme = "https"
+	}
+	fmt.Printf("WebDAV服务已启动: %s://%s\n", scheme, cfg.ListenAddr())
+	if cfg.ReadOnly {
+		fmt.Println("只读模式，禁止所有写操作")
+	}
+	if len(cfg.Users) == 0 {
+		fmt.Println("警告：未配置登录用户，访问WebDAV服务不需要认证")
+	}
+	if cfg.AccessLogFile != "" && cfg.AccessLogFile != "-" {
+		fmt.Printf("访问日志: %s\n", cfg.AccessLogFile)
+	}
+	fmt.Println("按 Ctrl+C 停止服务")
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- webdav.ListenAndServe(cfg, webdav.NewHandler(fs), accessLog)
+	}()
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+	var statsChan <-chan time.Time
+	if statsInterval > 0 {
+		ticker := time.NewTicker(statsInterval)
+		defer ticker.Stop()
+		statsChan = ticker.C
+	}
+	for {
+		select {
+		case err = <-errChan:
+			fmt.Printf("WebDAV服务异常退出: %s\n", err)
+			return
+		case <-sigChan:
+			fmt.Println("WebDAV服务已停止")
+			return
+		case <-statsChan:
+			printWebdavTraffic(accessLog)
+		}
+	}
+}
+
+// printWebdavTraffic 输出各客户端的流量统计，按下载的数据量从大到小排序
+func printWebdavTraffic(accessLog *webdav.AccessLogger) {
+	traffic := accessLog.Traffic()
+	if len(traffic) == 0 {
+		return
+	}
+	fmt.Printf("\n客户端流量统计 (%s):\n", time.Now().Format("2006-01-02 15:04:05"))
+	tb := cmdtable.NewTable(os.Stdout)
+	tb.SetHeader([]string{"#", "客户端IP", "请求次数", "下载", "上传", "最后访问时间"})
+	for idx, ct := range traffic {
+		tb.Append([]string{strconv.Itoa(idx + 1), ct.Client, strconv.FormatInt(ct.Requests, 10),
+			converter.ConvertFileSize(ct.BytesSent, 2), converter.ConvertFileSize(ct.BytesReceived, 2),
+			ct.LastAccess.Format("2006-01-02 15:04:05")})
+	}
+	tb.Render()
+}
@@ -18,7 +18,6 @@ import (
 	"github.com/tickstep/aliyunpan-api/aliyunpan"
 	"github.com/tickstep/aliyunpan-api/aliyunpan_web"
 	"github.com/tickstep/aliyunpan/cmder/cmdtable"
-	"github.com/tickstep/aliyunpan/internal/config"
 	"github.com/urfave/cli"
 	"os"
 	"path"
@@ -52,17 +51,17 @@ func CmdXcp() cli.Command {
 				cli.ShowCommandHelp(c, c.Command.Name)
 				return nil
 			}
-			if config.Config.ActiveUser() == nil {
-				fmt.Println("未登录账号")
+			if GetActiveUser() == nil {
+				printNotLogin()
 				return nil
 			}
-			if config.Config.ActiveUser().PanClient().WebapiPanClient() == nil {
+			if GetActiveUser().PanClient().WebapiPanClient() == nil {
 				fmt.Println("WEB客户端未登录，请登录后再使用该命令")
 				return nil
 			}
 			srcDriveId := parseDriveId(c)
 			dstDriveId := ""
-			driveList := config.Config.ActiveUser().DriveList
+			driveList := GetActiveUser().DriveList
 			if driveList.GetFileDriveId() == srcDriveId {
 				dstDriveId = driveList.GetResourceDriveId()
 			} else if driveList.GetResourceDriveId() == srcDriveId {
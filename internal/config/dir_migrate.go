@@ -0,0 +1,160 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package config
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// dataDirEntries 数据目录下需要迁移的文件夹
+	dataDirEntries = []string{"users", "sync_drive"}
+
+	// cacheDirEntries 临时文件目录下需要迁移的文件：加密上传、标准输入上传、zip重试以及软链接清单产生的临时文件
+	cacheDirEntries = []string{"aliyunpan-*.aenc", "aliyunpan-stdin-*", "aliyunpan-zip*", "symlinks-*.json"}
+
+	// logDirEntries 日志目录下需要迁移的文件：文件记录、传输记录数据库、程序日志以及审计日志
+	logDirEntries = []string{"upload_file_records.csv", "download_file_records.csv", "sync_file_records.csv",
+		"webdav_file_records.csv", "transfer_history.db", "aliyunpan*.log*", "audit.log*"}
+)
+
+// MoveDirEntries 把oldDir下的文件迁移到newDir，names为需要迁移的文件或文件夹，支持通配符，为空代表全部。
+// 目录可能是 /tmp 等共用目录时必须指定names，只迁移程序自己的文件。
+// newDir中已经存在同名文件时不迁移任何文件并返回错误。不同磁盘之间无法直接移动时先复制再删除
+func MoveDirEntries(oldDir, newDir string, names []string) error {
+	if filepath.Clean(oldDir) == filepath.Clean(newDir) {
+		return nil
+	}
+	if rel, err := filepath.Rel(oldDir, newDir); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		// 复制到自身的子目录会无限递归
+		return fmt.Errorf("新目录不能位于原目录之中: %s", newDir)
+	}
+	entries, err := os.ReadDir(oldDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	moveNames := []string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if names != nil && !matchDirEntry(name, names) {
+			continue
+		}
+		if _, err := os.Lstat(filepath.Join(newDir, name)); err == nil {
+			return fmt.Errorf("目标目录已经存在 %s，请先手动处理: %s", name, newDir)
+		}
+		moveNames = append(moveNames, name)
+	}
+	if len(moveNames) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(newDir, 0755); err != nil {
+		return err
+	}
+	for _, name := range moveNames {
+		src, dst := filepath.Join(oldDir, name), filepath.Join(newDir, name)
+		if err := os.Rename(src, dst); err == nil {
+			continue
+		}
+		// 不同磁盘之间无法重命名，复制后删除原文件
+		if err := copyPath(src, dst); err != nil {
+			os.RemoveAll(dst)
+			return fmt.Errorf("迁移 %s 失败: %s", src, err)
+		}
+		if err := os.RemoveAll(src); err != nil {
+			return fmt.Errorf("删除原文件 %s 失败: %s", src, err)
+		}
+	}
+	return nil
+}
+
+// matchDirEntry 文件名是否匹配其中一个规则
+func matchDirEntry(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// copyPath 复制文件或者文件夹，保留文件权限
+func copyPath(src, dst string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	switch {
+	case info.IsDir():
+		if err = os.MkdirAll(dst, info.Mode().Perm()); err != nil {
+			return err
+		}
+		entries, err := os.ReadDir(src)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err = copyPath(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())); err != nil {
+				return err
+			}
+		}
+		return nil
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(target, dst)
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// dirOrDefault 目录配置为空时使用默认目录
+func dirOrDefault(dir, defaultDir string) string {
+	if dir == "" {
+		return defaultDir
+	}
+	return dir
+}
+
+// cleanDirValue 检查目录配置，为空代表使用默认目录，否则必须为绝对路径
+func cleanDirValue(dir string) (string, error) {
+	dir = strings.TrimSpace(dir)
+	if dir == "" {
+		return "", nil
+	}
+	if !filepath.IsAbs(dir) {
+		return "", fmt.Errorf("目录必须为绝对路径: %s", dir)
+	}
+	return filepath.Clean(dir), nil
+}
@@ -0,0 +1,175 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package config
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// FolderIdCacheFileName 持久化的云盘文件夹ID缓存文件名，保存在账号数据目录下
+	FolderIdCacheFileName = "folder_id_cache.json"
+	// DefaultFolderIdCacheTTL 云盘文件夹ID缓存的有效期
+	DefaultFolderIdCacheTTL = 30 * time.Minute
+)
+
+type (
+	folderIdCacheItem struct {
+		FileId   string `json:"fileId"`
+		ExpireAt int64  `json:"expireAt"` // 过期时间，Unix时间戳
+	}
+
+	// FolderIdCache 云盘文件夹路径 => 文件夹ID 缓存，避免上传时对同一个文件夹重复调用 FileInfoByPath。
+	// 创建、删除、移动、重命名文件夹后需要调用 Invalidate 删除失效的缓存。所有方法都支持nil调用
+	FolderIdCache struct {
+		ttl    time.Duration
+		items  map[string]*folderIdCacheItem
+		hits   int64
+		misses int64
+		mutex  sync.Mutex
+	}
+)
+
+var (
+	// folderIdCache 进程内共享的云盘文件夹ID缓存
+	folderIdCache = NewFolderIdCache(DefaultFolderIdCacheTTL)
+)
+
+// NewFolderIdCache 创建云盘文件夹ID缓存，ttl为缓存有效期
+func NewFolderIdCache(ttl time.Duration) *FolderIdCache {
+	return &FolderIdCache{
+		ttl:   ttl,
+		items: map[string]*folderIdCacheItem{},
+	}
+}
+
+// GetFolderIdCache 获取进程内共享的云盘文件夹ID缓存
+func GetFolderIdCache() *FolderIdCache {
+	return folderIdCache
+}
+
+func folderIdCacheKey(driveId, panPath string) string {
+	return driveId + ":" + path.Clean("/"+panPath)
+}
+
+// Get 获取云盘文件夹ID，没有缓存或者缓存已过期返回空字符串
+func (c *FolderIdCache) Get(driveId, panPath string) string {
+	if c == nil {
+		return ""
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	key := folderIdCacheKey(driveId, panPath)
+	item, ok := c.items[key]
+	if ok && item.ExpireAt < time.Now().Unix() {
+		delete(c.items, key)
+		ok = false
+	}
+	if !ok {
+		c.misses++
+		return ""
+	}
+	c.hits++
+	return item.FileId
+}
+
+// Put 缓存云盘文件夹ID
+func (c *FolderIdCache) Put(driveId, panPath, fileId string) {
+	if c == nil || fileId == "" {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.items[folderIdCacheKey(driveId, panPath)] = &folderIdCacheItem{
+		FileId:   fileId,
+		ExpireAt: time.Now().Add(c.ttl).Unix(),
+	}
+}
+
+// Invalidate 删除云盘文件夹以及其下所有子文件夹的缓存
+func (c *FolderIdCache) Invalidate(driveId, panPath string) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	key := folderIdCacheKey(driveId, panPath)
+	prefix := strings.TrimSuffix(key, "/") + "/"
+	for k := range c.items {
+		if k == key || strings.HasPrefix(k, prefix) {
+			delete(c.items, k)
+		}
+	}
+}
+
+// Stats 缓存命中和未命中次数
+func (c *FolderIdCache) Stats() (hits, misses int64) {
+	if c == nil {
+		return 0, 0
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.hits, c.misses
+}
+
+// Load 从文件加载持久化的缓存，已过期的缓存会被忽略
+func (c *FolderIdCache) Load(filePath string) error {
+	if c == nil {
+		return nil
+	}
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	items := map[string]*folderIdCacheItem{}
+	if err = json.Unmarshal(data, &items); err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for k, item := range items {
+		if item == nil || item.FileId == "" || item.ExpireAt < now {
+			continue
+		}
+		c.items[k] = item
+	}
+	return nil
+}
+
+// Save 保存未过期的缓存到文件
+func (c *FolderIdCache) Save(filePath string) error {
+	if c == nil {
+		return nil
+	}
+	now := time.Now().Unix()
+	c.mutex.Lock()
+	items := map[string]*folderIdCacheItem{}
+	for k, item := range c.items {
+		if item.ExpireAt >= now {
+			items[k] = item
+		}
+	}
+	c.mutex.Unlock()
+	data, err := json.Marshal(items)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filePath, data, 0600)
+}
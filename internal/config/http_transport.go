@@ -0,0 +1,83 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package config
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/tickstep/aliyunpan/internal/file/faultinject"
+	"github.com/tickstep/library-go/logger"
+	"github.com/tickstep/library-go/requester"
+)
+
+const (
+	// DefaultHttpMaxIdleConnsPerHost 默认每个域名保持的最大空闲连接数
+	DefaultHttpMaxIdleConnsPerHost = 32
+
+	// DefaultHttpIdleConnTimeout 默认空闲连接超时时间，单位：秒
+	DefaultHttpIdleConnTimeout = 90
+)
+
+var (
+	transferTransport     *http.Transport
+	transferTransportOnce sync.Once
+)
+
+// TransferHTTPClient 返回上传、下载使用的 HTTPClient
+// 所有返回的客户端共用同一个连接池，实现分片传输之间的连接复用，降低TCP/TLS握手开销。
+// 注意：返回的客户端不要再调用 SetKeepAlive, SetProxy 等会重建连接池的方法
+func (c *PanConfig) TransferHTTPClient() *requester.HTTPClient {
+	transferTransportOnce.Do(func() {
+		transferTransport = c.newTransferTransport()
+	})
+	client := requester.NewHTTPClient()
+	// requester 在第一次请求时如果内部的 Transport 还没有初始化，会新建一个 Transport 覆盖 client.Transport，
+	// 这里先初始化内部的 Transport，再替换为共用的连接池
+	client.SetKeepAlive(true)
+	// 开启错误注入时，随机让分片传输失败
+	client.Transport = faultinject.Wrap(transferTransport)
+	return client
+}
+
+// newTransferTransport 按照配置创建连接池
+func (c *PanConfig) newTransferTransport() *http.Transport {
+	// 复用 requester 默认的 Transport 配置，保留代理、本地网卡绑定、IP类型等设置
+	client := requester.NewHTTPClient()
+	client.SetKeepAlive(true)
+	t, ok := client.Transport.(*http.Transport)
+	if !ok {
+		t = http.DefaultTransport.(*http.Transport).Clone()
+	}
+
+	maxIdleConnsPerHost := c.HttpMaxIdleConnsPerHost
+	if maxIdleConnsPerHost <= 0 {
+		maxIdleConnsPerHost = DefaultHttpMaxIdleConnsPerHost
+	}
+	idleConnTimeout := c.HttpIdleConnTimeout
+	if idleConnTimeout <= 0 {
+		idleConnTimeout = DefaultHttpIdleConnTimeout
+	}
+	t.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	if t.MaxIdleConns < maxIdleConnsPerHost {
+		t.MaxIdleConns = maxIdleConnsPerHost
+	}
+	t.IdleConnTimeout = time.Duration(idleConnTimeout) * time.Second
+	// 自定义了 DialContext 和 TLSClientConfig 的 Transport 默认不会启用HTTP/2，需要显式开启
+	t.ForceAttemptHTTP2 = c.HttpEnableHttp2 == "1"
+	logger.Verbosef("transfer http transport: maxIdleConnsPerHost=%d, idleConnTimeout=%ds, http2=%t\n",
+		maxIdleConnsPerHost, idleConnTimeout, t.ForceAttemptHTTP2)
+	return t
+}
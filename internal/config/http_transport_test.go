@@ -0,0 +1,80 @@
+package config
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// resetTransferTransport 重新按配置创建共用的连接池
+func resetTransferTransport() {
+	transferTransport = nil
+	transferTransportOnce = sync.Once{}
+}
+
+func TestTransferHTTPClientSharesTransport(t *testing.T) {
+	var conns int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	resetTransferTransport()
+	defer resetTransferTransport()
+	c := &PanConfig{HttpMaxIdleConnsPerHost: 7, HttpIdleConnTimeout: 30}
+	for i := 0; i < 3; i++ {
+		client := c.TransferHTTPClient()
+		resp, err := client.Req(http.MethodGet, server.URL, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		// 请求之后仍然使用共用的连接池，没有被 requester 替换
+		if client.Transport != transferTransport {
+			t.Fatalf("request %d: transport replaced", i)
+		}
+	}
+	if n := atomic.LoadInt32(&conns); n != 1 {
+		t.Errorf("connections %d, want 1", n)
+	}
+	if transferTransport.MaxIdleConnsPerHost != 7 || transferTransport.IdleConnTimeout != 30*time.Second {
+		t.Errorf("transport not tuned: %d %s", transferTransport.MaxIdleConnsPerHost, transferTransport.IdleConnTimeout)
+	}
+}
+
+func TestNewTransferTransportDefaults(t *testing.T) {
+	// 未配置时使用默认值，不开启HTTP/2
+	tr := (&PanConfig{}).newTransferTransport()
+	if tr.MaxIdleConnsPerHost != DefaultHttpMaxIdleConnsPerHost {
+		t.Errorf("maxIdleConnsPerHost %d", tr.MaxIdleConnsPerHost)
+	}
+	if tr.MaxIdleConns != 0 && tr.MaxIdleConns < DefaultHttpMaxIdleConnsPerHost {
+		t.Errorf("maxIdleConns %d less than per host", tr.MaxIdleConns)
+	}
+	if tr.IdleConnTimeout != DefaultHttpIdleConnTimeout*time.Second {
+		t.Errorf("idleConnTimeout %s", tr.IdleConnTimeout)
+	}
+	if tr.ForceAttemptHTTP2 {
+		t.Error("http2 should be disabled by default")
+	}
+
+	tr = (&PanConfig{HttpMaxIdleConnsPerHost: 500, HttpEnableHttp2: "1"}).newTransferTransport()
+	if tr.MaxIdleConnsPerHost != 500 || tr.MaxIdleConns < 500 {
+		t.Errorf("pool not enlarged: %d %d", tr.MaxIdleConnsPerHost, tr.MaxIdleConns)
+	}
+	if !tr.ForceAttemptHTTP2 {
+		t.Error("http2 should be enabled")
+	}
+}
@@ -100,6 +100,7 @@ type PanUser struct {
 	UserId      string `json:"userId"`
 	Nickname    string `json:"nickname"`
 	AccountName string `json:"accountName"`
+	Alias       string `json:"alias"` // 别名，用于 --user 选择账号
 
 	// 文件（备份盘）
 	Workdir           string               `json:"workdir"`
@@ -0,0 +1,86 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package config
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/tickstep/aliyunpan/internal/file/ratelimit"
+	"github.com/tickstep/library-go/converter"
+)
+
+var (
+	// classRateLimits 进程内共享的按任务类别划分的限速，配置变化时重新创建
+	classRateLimits    *ratelimit.ClassRateLimits
+	classRateLimitsKey string
+	classRateLimitsMu  sync.Mutex
+)
+
+// ParseRateClasses 解析按任务类别划分的限速配置，格式: share=2MB,backup=8MB
+func ParseRateClasses(spec string) (map[string]int64, error) {
+	rates := map[string]int64{}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		class := strings.TrimSpace(kv[0])
+		if len(kv) != 2 || class == "" {
+			return nil, fmt.Errorf("类别限速格式错误: %s, 示例: share=2MB", item)
+		}
+		rate, err := converter.ParseFileSizeStr(stripPerSecond(strings.TrimSpace(kv[1])))
+		if err != nil || rate < 0 {
+			return nil, fmt.Errorf("限速值格式错误: %s", kv[1])
+		}
+		rates[class] = rate
+	}
+	return rates, nil
+}
+
+// checkRateClasses 检查各类别限速之和不超过总限速
+func checkRateClasses(total int64, rates map[string]int64) error {
+	if total <= 0 {
+		return nil
+	}
+	var sum int64
+	for _, rate := range rates {
+		if rate <= 0 {
+			return fmt.Errorf("设置了总限速时各类别的限速不能为0")
+		}
+		sum += rate
+	}
+	if sum > total {
+		return fmt.Errorf("各类别限速之和 %s 超过总限速 %s", showMaxRate(sum), showMaxRate(total))
+	}
+	return nil
+}
+
+// ClassRateLimit 获取任务类别的共享限速，同一类别的上传、下载共用配额，并且受总限速约束。没有配置限速时返回nil
+func (c *PanConfig) ClassRateLimit(class string) *ratelimit.SharedRateLimit {
+	classRateLimitsMu.Lock()
+	defer classRateLimitsMu.Unlock()
+	key := fmt.Sprintf("%d|%s", c.RateLimitTotal, c.RateLimitClasses)
+	if classRateLimits == nil || classRateLimitsKey != key {
+		rates, err := ParseRateClasses(c.RateLimitClasses)
+		if err != nil {
+			rates = nil
+		}
+		classRateLimits = ratelimit.NewClassRateLimits(c.RateLimitTotal, rates)
+		classRateLimitsKey = key
+	}
+	return classRateLimits.Get(class)
+}
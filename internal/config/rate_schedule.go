@@ -0,0 +1,107 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tickstep/library-go/converter"
+)
+
+type (
+	// RateWindow 时间段限速，时间为一天中的分钟数，结束时间小于开始时间代表跨过午夜
+	RateWindow struct {
+		Start int
+		End   int
+		Rate  int64 // 限速，单位 B/s，0代表不限制
+	}
+
+	// RateSchedule 按时间段限速，不在任何时间段内时使用默认限速
+	RateSchedule struct {
+		Windows     []*RateWindow
+		DefaultRate int64
+	}
+)
+
+// ParseRateSchedule 解析时间段限速配置，格式: 08:00-23:00=1MB,23:00-08:00=0，多个时间段重叠时使用前面的
+func ParseRateSchedule(spec string) (*RateSchedule, error) {
+	rs := &RateSchedule{}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("时间段限速格式错误: %s", item)
+		}
+		times := strings.SplitN(strings.TrimSpace(kv[0]), "-", 2)
+		if len(times) != 2 {
+			return nil, fmt.Errorf("时间段格式错误: %s", kv[0])
+		}
+		start, err := parseClockMinute(times[0])
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseClockMinute(times[1])
+		if err != nil {
+			return nil, err
+		}
+		if start == end {
+			return nil, fmt.Errorf("时间段开始和结束时间不能相同: %s", kv[0])
+		}
+		rate, err := converter.ParseFileSizeStr(stripPerSecond(strings.TrimSpace(kv[1])))
+		if err != nil {
+			return nil, fmt.Errorf("限速值格式错误: %s", kv[1])
+		}
+		rs.Windows = append(rs.Windows, &RateWindow{Start: start, End: end, Rate: rate})
+	}
+	return rs, nil
+}
+
+// parseClockMinute 解析 HH:MM 格式的时间，返回一天中的分钟数。24:00 代表午夜
+func parseClockMinute(s string) (int, error) {
+	var hour, minute int
+	if _, err := fmt.Sscanf(strings.TrimSpace(s), "%d:%d", &hour, &minute); err != nil {
+		return 0, fmt.Errorf("时间格式错误: %s, 示例: 08:00", s)
+	}
+	if hour < 0 || hour > 24 || minute < 0 || minute > 59 || (hour == 24 && minute != 0) {
+		return 0, fmt.Errorf("时间格式错误: %s, 示例: 08:00", s)
+	}
+	return (hour*60 + minute) % (24 * 60), nil
+}
+
+// RateAt 指定时间的限速，单位 B/s，0代表不限制
+func (rs *RateSchedule) RateAt(t time.Time) int64 {
+	if rs == nil {
+		return 0
+	}
+	minute := t.Hour()*60 + t.Minute()
+	for _, w := range rs.Windows {
+		if w.contains(minute) {
+			return w.Rate
+		}
+	}
+	return rs.DefaultRate
+}
+
+func (w *RateWindow) contains(minute int) bool {
+	if w.Start < w.End {
+		return minute >= w.Start && minute < w.End
+	}
+	// 跨过午夜
+	return minute >= w.Start || minute < w.End
+}
@@ -0,0 +1,23 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetTempDir(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv(EnvConfigDir, configDir)
+
+	dir := GetTempDir()
+	if dir != filepath.Join(configDir, "temp") {
+		t.Fatalf("temp dir: %s", dir)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		t.Fatalf("temp dir should be created: %v", err)
+	}
+	if GetTempDir() != dir {
+		t.Fatal("temp dir should be stable")
+	}
+}
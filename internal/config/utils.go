@@ -17,6 +17,7 @@ import (
 	"encoding/hex"
 	"github.com/olekukonko/tablewriter"
 	"github.com/tickstep/aliyunpan/cmder/cmdtable"
+	"github.com/tickstep/aliyunpan/internal/notify"
 	"github.com/tickstep/aliyunpan/library/nets"
 	"github.com/tickstep/library-go/converter"
 	"github.com/tickstep/library-go/crypto"
@@ -25,6 +26,7 @@ import (
 	"math/rand"
 	"net"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -35,10 +37,10 @@ func (pl *PanUserList) String() string {
 
 	tb := cmdtable.NewTable(builder)
 	tb.SetColumnAlignment([]int{tablewriter.ALIGN_DEFAULT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_CENTER, tablewriter.ALIGN_CENTER, tablewriter.ALIGN_CENTER})
-	tb.SetHeader([]string{"#", "uid", "用户名", "昵称"})
+	tb.SetHeader([]string{"#", "uid", "用户名", "昵称", "别名"})
 
 	for k, userInfo := range *pl {
-		tb.Append([]string{strconv.Itoa(k + 1), userInfo.UserId, userInfo.AccountName, userInfo.Nickname})
+		tb.Append([]string{strconv.Itoa(k + 1), userInfo.UserId, userInfo.AccountName, userInfo.Nickname, userInfo.Alias})
 	}
 
 	tb.Render()
@@ -56,6 +58,28 @@ func (pl *PanUserList) GetUserByUserId(userId string) *PanUser {
 	return nil
 }
 
+// FindUser 根据uid、别名、用户名或者昵称查找用户，优先匹配uid和别名
+func (pl *PanUserList) FindUser(key string) *PanUser {
+	if key == "" {
+		return nil
+	}
+	if u := pl.GetUserByUserId(key); u != nil {
+		return u
+	}
+	for _, match := range []func(u *PanUser) string{
+		func(u *PanUser) string { return u.Alias },
+		func(u *PanUser) string { return u.AccountName },
+		func(u *PanUser) string { return u.Nickname },
+	} {
+		for _, u := range *pl {
+			if match(u) == key {
+				return u
+			}
+		}
+	}
+	return nil
+}
+
 // AverageParallel 返回平均的下载最大并发量
 func AverageParallel(parallel, downloadLoad int) int {
 	if downloadLoad < 1 {
@@ -84,6 +108,51 @@ func showMaxRate(size int64) string {
 	return converter.ConvertFileSize(size, 2) + "/s"
 }
 
+// encryptConfigValue 使用本机ID加密需要保存到配置文件的密码等敏感内容
+func encryptConfigValue(value string) string {
+	return encryptedPasswordPrefix + EncryptString(value)
+}
+
+// decryptConfigValue 解密配置文件中加密保存的内容，没有加密前缀的为旧版本明文保存的内容，原样返回
+func decryptConfigValue(value string) string {
+	if !strings.HasPrefix(value, encryptedPasswordPrefix) {
+		return value
+	}
+	return DecryptString(strings.TrimPrefix(value, encryptedPasswordPrefix))
+}
+
+// notifyEmailDisplay 显示汇总邮件地址，隐藏密码
+func notifyEmailDisplay(value string) string {
+	value = decryptConfigValue(value)
+	m, err := notify.ParseMailer(value)
+	if err != nil || m == nil {
+		return value
+	}
+	return m.String()
+}
+
+// appLogLevelDisplay 显示程序日志级别，为空代表不记录
+func appLogLevelDisplay(value string) string {
+	if value == "" {
+		return "off"
+	}
+	return value
+}
+
+// webhookHeadersDisplay 显示Webhook请求头，隐藏请求头的值
+func webhookHeadersDisplay(value string) string {
+	headers, err := notify.ParseWebhookHeaders(value)
+	if err != nil {
+		return value
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name+"=***")
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
 // EncryptString 加密
 func EncryptString(text string) string {
 	if text == "" {
@@ -0,0 +1,128 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package config
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultWebdavAddress 默认WebDAV服务绑定地址，默认只监听本机
+	DefaultWebdavAddress = "127.0.0.1"
+	// DefaultWebdavPort 默认WebDAV服务端口
+	DefaultWebdavPort = 23077
+	// DefaultWebdavMetaCacheTtl 默认目录元数据缓存有效期，单位：秒
+	DefaultWebdavMetaCacheTtl = 300
+)
+
+type (
+	// WebdavUser WebDAV服务的登录用户
+	WebdavUser struct {
+		Username string `json:"username"`
+		// Password 密码，加密存储
+		Password string `json:"password"`
+	}
+
+	// WebdavConfig WebDAV服务配置
+	WebdavConfig struct {
+		// Address 绑定地址，例如：127.0.0.1，0.0.0.0
+		Address string `json:"address"`
+		// Port 监听端口
+		Port int `json:"port"`
+		// ReadOnly 只读模式，禁止所有写操作
+		ReadOnly bool `json:"readOnly"`
+		// Users 登录用户列表，为空代表不需要认证
+		Users []*WebdavUser `json:"users"`
+		// TlsCertFile TLS证书文件路径，和 TlsKeyFile 同时配置时启用HTTPS
+		TlsCertFile string `json:"tlsCertFile"`
+		// TlsKeyFile TLS私钥文件路径
+		TlsKeyFile string `json:"tlsKeyFile"`
+		// MetaCacheTtl 目录元数据缓存有效期，单位：秒。超过有效期的缓存仍然可以浏览，同时在后台刷新
+		MetaCacheTtl int `json:"metaCacheTtl"`
+		// AccessLogFile 访问日志文件路径，为空不记录访问日志，"-" 代表输出到控制台
+		AccessLogFile string `json:"accessLogFile"`
+	}
+)
+
+// ListenAddr 返回监听地址
+func (w *WebdavConfig) ListenAddr() string {
+	addr := w.Address
+	if addr == "" {
+		addr = DefaultWebdavAddress
+	}
+	port := w.Port
+	if port <= 0 {
+		port = DefaultWebdavPort
+	}
+	return net.JoinHostPort(addr, strconv.Itoa(port))
+}
+
+// MetaCacheExpiration 返回目录元数据缓存有效期
+func (w *WebdavConfig) MetaCacheExpiration() time.Duration {
+	ttl := w.MetaCacheTtl
+	if ttl <= 0 {
+		ttl = DefaultWebdavMetaCacheTtl
+	}
+	return time.Duration(ttl) * time.Second
+}
+
+// IsTlsEnabled 是否启用了TLS
+func (w *WebdavConfig) IsTlsEnabled() bool {
+	return w.TlsCertFile != "" && w.TlsKeyFile != ""
+}
+
+// SetUser 新增或者更新登录用户
+func (w *WebdavConfig) SetUser(username, password string) error {
+	if username == "" || password == "" {
+		return fmt.Errorf("用户名和密码不能为空")
+	}
+	for _, u := range w.Users {
+		if u.Username == username {
+			u.Password = EncryptString(password)
+			return nil
+		}
+	}
+	w.Users = append(w.Users, &WebdavUser{
+		Username: username,
+		Password: EncryptString(password),
+	})
+	return nil
+}
+
+// RemoveUser 删除登录用户
+func (w *WebdavConfig) RemoveUser(username string) bool {
+	for idx, u := range w.Users {
+		if u.Username == username {
+			w.Users = append(w.Users[:idx], w.Users[idx+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// CheckUser 校验用户名密码，使用常量时间比较，避免通过响应时间猜测密码
+func (w *WebdavConfig) CheckUser(username, password string) bool {
+	for _, u := range w.Users {
+		userOk := subtle.ConstantTimeCompare([]byte(u.Username), []byte(username))
+		passwordOk := subtle.ConstantTimeCompare([]byte(DecryptString(u.Password)), []byte(password))
+		if userOk&passwordOk == 1 {
+			return true
+		}
+	}
+	return false
+}
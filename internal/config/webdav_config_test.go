@@ -0,0 +1,30 @@
+package config
+
+import "testing"
+
+func TestWebdavConfigCheckUser(t *testing.T) {
+	w := &WebdavConfig{
+		Users: []*WebdavUser{
+			{Username: "admin", Password: EncryptString("admin123")},
+			{Username: "guest", Password: EncryptString("")},
+		},
+	}
+	cases := []struct {
+		username, password string
+		ok                 bool
+	}{
+		{"admin", "admin123", true},
+		{"admin", "admin12", false},
+		{"admin", "admin1234", false},
+		{"Admin", "admin123", false},
+		{"guest", "admin123", false},
+		{"guest", "", true},
+		{"", "", false},
+		{"nobody", "admin123", false},
+	}
+	for _, c := range cases {
+		if got := w.CheckUser(c.username, c.password); got != c.ok {
+			t.Errorf("CheckUser(%q, %q) = %v, want %v", c.username, c.password, got, c.ok)
+		}
+	}
+}
@@ -0,0 +1,377 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crypto 客户端加密，上传前使用AES-256-GCM分块加密文件内容和文件名，下载后解密
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// EncryptedFileSuffix 加密文件在网盘上的文件名后缀
+	EncryptedFileSuffix = ".aenc"
+
+	// DefaultChunkSize 默认加密分块大小
+	DefaultChunkSize = 64 * 1024
+
+	// 加密文件头：魔数(8) + salt(16) + nonce前缀(7) + 分块大小(4)
+	magic           = "ALYPENC1"
+	saltSize        = 16
+	noncePrefixSize = 7
+	headerSize      = len(magic) + saltSize + noncePrefixSize + 4
+	maxChunkSize    = 16 * 1024 * 1024
+
+	// 主密钥派生使用的固定salt，每个文件的内容密钥再使用随机salt派生
+	masterKeySalt = "aliyunpan-client-encrypt-v1"
+)
+
+var (
+	// ErrNotEncrypted 不是加密文件
+	ErrNotEncrypted = errors.New("不是加密文件")
+	// ErrDecrypt 解密失败，密码错误或者文件已损坏
+	ErrDecrypt = errors.New("解密失败，密码错误或者文件已损坏")
+	// ErrEmptyPassword 加密密码为空
+	ErrEmptyPassword = errors.New("加密密码不能为空")
+)
+
+type (
+	// Cipher 客户端加密器，同一个密码创建一次即可，可以并发使用
+	Cipher struct {
+		master  []byte
+		nameKey cipher.AEAD
+		nameMac []byte
+	}
+
+	encryptWriter struct {
+		w       io.Writer
+		aead    cipher.AEAD
+		prefix  []byte
+		counter uint32
+		buf     []byte
+		n       int
+		closed  bool
+	}
+
+	decryptReader struct {
+		r       *bufio.Reader
+		aead    cipher.AEAD
+		prefix  []byte
+		counter uint32
+		buf     []byte
+		plain   []byte
+		done    bool
+	}
+)
+
+// NewCipher 使用密码创建加密器，密钥使用scrypt派生
+func NewCipher(password string) (*Cipher, error) {
+	if password == "" {
+		return nil, ErrEmptyPassword
+	}
+	master, err := scrypt.Key([]byte(password), []byte(masterKeySalt), 32768, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	c := &Cipher{master: master}
+	keys := make([]byte, 64)
+	if _, err = io.ReadFull(hkdf.New(sha256.New, master, nil, []byte("file name")), keys); err != nil {
+		return nil, err
+	}
+	if c.nameKey, err = newGCM(keys[:32]); err != nil {
+		return nil, err
+	}
+	c.nameMac = keys[32:]
+	return c, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// contentAEAD 使用文件头中的salt派生文件内容密钥
+func (c *Cipher) contentAEAD(salt []byte) (cipher.AEAD, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, c.master, salt, []byte("file content")), key); err != nil {
+		return nil, err
+	}
+	return newGCM(key)
+}
+
+// chunkNonce 分块nonce：nonce前缀(7) + 分块序号(4) + 是否最后一块(1)，保证分块不能被调换或者截断
+func chunkNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], counter)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// NewWriter 创建加密写入器，写入的明文加密后写入w，必须调用Close写入最后一个分块
+func (c *Cipher) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	header := make([]byte, headerSize)
+	copy(header, magic)
+	if _, err := rand.Read(header[len(magic) : len(magic)+saltSize+noncePrefixSize]); err != nil {
+		return nil, err
+	}
+	binary.BigEndian.PutUint32(header[headerSize-4:], DefaultChunkSize)
+	aead, err := c.contentAEAD(header[len(magic) : len(magic)+saltSize])
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(header); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{
+		w:      w,
+		aead:   aead,
+		prefix: header[len(magic)+saltSize : len(magic)+saltSize+noncePrefixSize],
+		buf:    make([]byte, DefaultChunkSize, DefaultChunkSize+aead.Overhead()),
+	}, nil
+}
+
+func (ew *encryptWriter) Write(p []byte) (int, error) {
+	if ew.closed {
+		return 0, io.ErrClosedPipe
+	}
+	total := len(p)
+	for len(p) > 0 {
+		if ew.n == len(ew.buf) {
+			// 缓冲区已满并且还有数据，说明不是最后一块
+			if err := ew.flush(false); err != nil {
+				return total - len(p), err
+			}
+		}
+		k := copy(ew.buf[ew.n:], p)
+		ew.n += k
+		p = p[k:]
+	}
+	return total, nil
+}
+
+func (ew *encryptWriter) flush(last bool) error {
+	sealed := ew.aead.Seal(ew.buf[:0], chunkNonce(ew.prefix, ew.counter, last), ew.buf[:ew.n], nil)
+	ew.counter++
+	ew.n = 0
+	_, err := ew.w.Write(sealed)
+	ew.buf = ew.buf[:DefaultChunkSize]
+	return err
+}
+
+// Close 写入最后一个分块，即使没有剩余数据也会写入一个空分块用于检测截断
+func (ew *encryptWriter) Close() error {
+	if ew.closed {
+		return nil
+	}
+	ew.closed = true
+	return ew.flush(true)
+}
+
+// NewReader 创建解密读取器，从r读取密文并解密
+func (c *Cipher) NewReader(r io.Reader) (io.Reader, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrNotEncrypted
+		}
+		return nil, err
+	}
+	if string(header[:len(magic)]) != magic {
+		return nil, ErrNotEncrypted
+	}
+	chunkSize := binary.BigEndian.Uint32(header[headerSize-4:])
+	if chunkSize == 0 || chunkSize > maxChunkSize {
+		return nil, ErrDecrypt
+	}
+	aead, err := c.contentAEAD(header[len(magic) : len(magic)+saltSize])
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{
+		r:      bufio.NewReader(r),
+		aead:   aead,
+		prefix: header[len(magic)+saltSize:],
+		buf:    make([]byte, int(chunkSize)+aead.Overhead()),
+	}, nil
+}
+
+func (dr *decryptReader) Read(p []byte) (int, error) {
+	for len(dr.plain) == 0 {
+		if dr.done {
+			return 0, io.EOF
+		}
+		if err := dr.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, dr.plain)
+	dr.plain = dr.plain[n:]
+	return n, nil
+}
+
+func (dr *decryptReader) next() error {
+	n, err := io.ReadFull(dr.r, dr.buf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		if err == io.EOF {
+			// 缺少最后一个分块，文件被截断
+			return ErrDecrypt
+		}
+		return err
+	}
+	last := err == io.ErrUnexpectedEOF
+	if !last {
+		if _, e := dr.r.Peek(1); e == io.EOF {
+			last = true
+		}
+	}
+	plain, e := dr.aead.Open(dr.buf[:0], chunkNonce(dr.prefix, dr.counter, last), dr.buf[:n], nil)
+	if e != nil {
+		return ErrDecrypt
+	}
+	dr.counter++
+	dr.plain = plain
+	dr.done = last
+	return nil
+}
+
+// EncryptFile 加密本地文件src，密文写入dst
+func (c *Cipher) EncryptFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriterSize(out, 256*1024)
+	ew, err := c.NewWriter(bw)
+	if err == nil {
+		if _, err = io.Copy(ew, in); err == nil {
+			if err = ew.Close(); err == nil {
+				err = bw.Flush()
+			}
+		}
+	}
+	if e := out.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(dst)
+	}
+	return err
+}
+
+// DecryptFile 解密本地文件src，明文写入dst。解密失败时删除不完整的dst
+func (c *Cipher) DecryptFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	dr, err := c.NewReader(bufio.NewReaderSize(in, 256*1024))
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, dr)
+	if e := out.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(dst)
+	}
+	return err
+}
+
+// KeyId 密钥标识，同一个密码的标识相同，不同密码的标识不同，不会泄露密钥
+func (c *Cipher) KeyId() string {
+	mac := hmac.New(sha256.New, c.nameMac)
+	mac.Write([]byte("key id"))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// IsEncryptedFile 本地文件是否是加密文件，只检查文件头
+func IsEncryptedFile(filePath string) bool {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	buf := make([]byte, len(magic))
+	if _, err = io.ReadFull(f, buf); err != nil {
+		return false
+	}
+	return bytes.Equal(buf, []byte(magic))
+}
+
+// IsEncryptedName 网盘文件名是否是加密文件的文件名
+func IsEncryptedName(name string) bool {
+	return strings.HasSuffix(name, EncryptedFileSuffix) && len(name) > len(EncryptedFileSuffix)
+}
+
+// EncryptName 生成加密文件在网盘上的文件名。encryptName为true时加密原始文件名，
+// 同一个文件名加密结果固定，保证重复上传时可以检测到同名文件；否则只在原始文件名后加上后缀
+func (c *Cipher) EncryptName(name string, encryptName bool) string {
+	if !encryptName {
+		return name + EncryptedFileSuffix
+	}
+	mac := hmac.New(sha256.New, c.nameMac)
+	mac.Write([]byte(name))
+	nonce := mac.Sum(nil)[:c.nameKey.NonceSize()]
+	sealed := c.nameKey.Seal(nonce, nonce, []byte(name), nil)
+	return base64.RawURLEncoding.EncodeToString(sealed) + EncryptedFileSuffix
+}
+
+// DecryptName 还原加密文件的原始文件名，文件名没有加密时直接去掉后缀
+func (c *Cipher) DecryptName(name string) (string, error) {
+	if !IsEncryptedName(name) {
+		return "", ErrNotEncrypted
+	}
+	name = strings.TrimSuffix(name, EncryptedFileSuffix)
+	sealed, err := base64.RawURLEncoding.DecodeString(name)
+	if err == nil && len(sealed) > c.nameKey.NonceSize()+c.nameKey.Overhead() {
+		nonceSize := c.nameKey.NonceSize()
+		if plain, e := c.nameKey.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil); e == nil {
+			return string(plain), nil
+		}
+	}
+	return name, nil
+}
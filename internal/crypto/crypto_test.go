@@ -0,0 +1,144 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func encryptBytes(t *testing.T, c *Cipher, plain []byte) []byte {
+	buf := &bytes.Buffer{}
+	w, err := c.NewWriter(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write(plain); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func decryptBytes(c *Cipher, data []byte) ([]byte, error) {
+	r, err := c.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestCipherRoundTrip(t *testing.T) {
+	c, err := NewCipher("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range []int{0, 1, DefaultChunkSize - 1, DefaultChunkSize, DefaultChunkSize + 1, 3*DefaultChunkSize + 100} {
+		plain := make([]byte, size)
+		rand.Read(plain)
+		data, err := decryptBytes(c, encryptBytes(t, c, plain))
+		if err != nil {
+			t.Fatalf("size %d: %s", size, err)
+		}
+		if !bytes.Equal(data, plain) {
+			t.Fatalf("size %d: content mismatch", size)
+		}
+	}
+}
+
+func TestCipherWrongPassword(t *testing.T) {
+	c, _ := NewCipher("password")
+	other, _ := NewCipher("wrong")
+	data := encryptBytes(t, c, []byte("hello world"))
+	if _, err := decryptBytes(other, data); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("wrong password: %v", err)
+	}
+	if _, err := NewCipher(""); !errors.Is(err, ErrEmptyPassword) {
+		t.Fatalf("empty password: %v", err)
+	}
+}
+
+func TestCipherTruncated(t *testing.T) {
+	c, _ := NewCipher("password")
+	plain := make([]byte, 2*DefaultChunkSize+10)
+	rand.Read(plain)
+	data := encryptBytes(t, c, plain)
+	cases := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"空文件", nil, ErrNotEncrypted},
+		{"只有部分文件头", data[:headerSize-1], ErrNotEncrypted},
+		{"只有文件头", data[:headerSize], ErrDecrypt},
+		{"缺少最后一个分块", data[:headerSize+2*(DefaultChunkSize+16)], ErrDecrypt},
+		{"最后一个分块不完整", data[:len(data)-1], ErrDecrypt},
+		{"不是加密文件", []byte("plain text file content, not encrypted at all"), ErrNotEncrypted},
+	}
+	for _, c2 := range cases {
+		if _, err := decryptBytes(c, c2.data); !errors.Is(err, c2.want) {
+			t.Errorf("%s: got %v, want %v", c2.name, err, c2.want)
+		}
+	}
+}
+
+func TestCipherFile(t *testing.T) {
+	c, _ := NewCipher("password")
+	dir := t.TempDir()
+	src := filepath.Join(dir, "a.txt")
+	enc := filepath.Join(dir, "a.txt"+EncryptedFileSuffix)
+	dst := filepath.Join(dir, "b.txt")
+	os.WriteFile(src, []byte("hello world"), 0644)
+	if err := c.EncryptFile(src, enc); err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncryptedFile(enc) || IsEncryptedFile(src) {
+		t.Fatal("encrypted file detection failed")
+	}
+	if err := c.DecryptFile(enc, dst); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(dst); string(data) != "hello world" {
+		t.Fatalf("decrypted content: %s", data)
+	}
+
+	// 解密失败时删除不完整的文件
+	data, _ := os.ReadFile(enc)
+	os.WriteFile(enc, data[:len(data)-1], 0644)
+	os.Remove(dst)
+	if err := c.DecryptFile(enc, dst); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("truncated file: %v", err)
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Fatal("incomplete file should be removed")
+	}
+}
+
+func TestCipherName(t *testing.T) {
+	c, _ := NewCipher("password")
+	other, _ := NewCipher("wrong")
+	enc := c.EncryptName("报告.docx", true)
+	if enc != c.EncryptName("报告.docx", true) {
+		t.Fatal("encrypted name should be stable")
+	}
+	if name, err := c.DecryptName(enc); err != nil || name != "报告.docx" {
+		t.Fatalf("decrypt name: %s, %v", name, err)
+	}
+	if name, _ := other.DecryptName(enc); name == "报告.docx" {
+		t.Fatal("wrong password should not decrypt name")
+	}
+	if name, err := c.DecryptName(c.EncryptName("a.txt", false)); err != nil || name != "a.txt" {
+		t.Fatalf("plain name: %s, %v", name, err)
+	}
+	if _, err := c.DecryptName("a.txt"); !errors.Is(err, ErrNotEncrypted) {
+		t.Fatalf("not encrypted name: %v", err)
+	}
+	if c.KeyId() == other.KeyId() {
+		t.Fatal("key id should differ between passwords")
+	}
+}
@@ -0,0 +1,255 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package daemon
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tickstep/aliyunpan/internal/taskframework"
+)
+
+const (
+	// JobUpload 上传任务
+	JobUpload JobType = "upload"
+	// JobDownload 下载任务
+	JobDownload JobType = "download"
+	// JobSync 同步备份任务，执行一次同步后结束
+	JobSync JobType = "sync"
+
+	// JobQueued 排队中
+	JobQueued JobStatus = "queued"
+	// JobRunning 执行中
+	JobRunning JobStatus = "running"
+	// JobPaused 已暂停
+	JobPaused JobStatus = "paused"
+	// JobCompleted 已完成
+	JobCompleted JobStatus = "completed"
+	// JobCanceled 已取消
+	JobCanceled JobStatus = "canceled"
+	// JobFailed 执行失败
+	JobFailed JobStatus = "failed"
+
+	timeFormat = "2006-01-02 15:04:05"
+)
+
+type (
+	// JobType 任务类型
+	JobType string
+
+	// JobStatus 任务状态
+	JobStatus string
+
+	// JobRequest 提交任务的参数
+	JobRequest struct {
+		Type       JobType  `json:"type"`
+		DriveId    string   `json:"driveId,omitempty"`    // 网盘ID，为空使用当前网盘
+		LocalPaths []string `json:"localPaths,omitempty"` // upload: 要上传的本地文件/目录
+		PanPaths   []string `json:"panPaths,omitempty"`   // download: 要下载的网盘文件/目录
+		PanPath    string   `json:"panPath,omitempty"`    // upload: 上传到的网盘目录；sync: 同步的网盘目录
+		SaveTo     string   `json:"saveTo,omitempty"`     // download: 保存到的本地目录，为空使用配置的下载目录
+		LocalPath  string   `json:"localPath,omitempty"`  // sync: 同步的本地目录
+		Mode       string   `json:"mode,omitempty"`       // sync: 同步模式 upload/download/sync
+		Parallel   int      `json:"parallel,omitempty"`   // 同时传输的文件数量，0使用配置
+		Overwrite  bool     `json:"overwrite,omitempty"`  // 覆盖已存在的文件
+		RateClass  string   `json:"rateClass,omitempty"`  // upload/download: 限速类别，为空使用任务类型
+		Order      string   `json:"order,omitempty"`      // upload/download: 文件传输顺序 size-asc/size-desc/name/mtime
+		Priority   []string `json:"priority,omitempty"`   // upload/download: 优先传输匹配的文件
+		// Tags 自定义标签，例如 {"job":"photos"}，用于按标签查询以及批量暂停、取消任务
+		Tags map[string]string `json:"tags,omitempty"`
+	}
+
+	// TagSelector 标签过滤条件，所有条件都满足时匹配。值为空代表只要求存在该标签
+	TagSelector map[string]string
+
+	// Job 后台任务
+	Job struct {
+		id         string
+		request    *JobRequest
+		status     JobStatus
+		err        string
+		createdAt  time.Time
+		startedAt  time.Time
+		finishedAt time.Time
+		control    *taskframework.TaskControl
+		mutex      sync.Mutex
+
+		// 最后一次检测到的进度以及进度变化的时间，用于健康检测
+		lastProgress   int64
+		lastProgressAt time.Time
+	}
+
+	// JobInfo 任务信息，用于API返回
+	JobInfo struct {
+		Id         string                      `json:"id"`
+		Request    *JobRequest                 `json:"request"`
+		Status     JobStatus                   `json:"status"`
+		Error      string                      `json:"error,omitempty"`
+		CreatedAt  string                      `json:"createdAt"`
+		StartedAt  string                      `json:"startedAt,omitempty"`
+		FinishedAt string                      `json:"finishedAt,omitempty"`
+		Progress   *taskframework.TaskProgress `json:"progress,omitempty"`
+	}
+)
+
+// Pausable 是否支持暂停，同步任务只能取消
+func (t JobType) Pausable() bool {
+	return t == JobUpload || t == JobDownload
+}
+
+// Validate 检查任务参数
+func (r *JobRequest) Validate() error {
+	switch r.Type {
+	case JobUpload:
+		if len(r.LocalPaths) == 0 || r.PanPath == "" {
+			return fmt.Errorf("上传任务需要指定 localPaths 和 panPath")
+		}
+	case JobDownload:
+		if len(r.PanPaths) == 0 {
+			return fmt.Errorf("下载任务需要指定 panPaths")
+		}
+	case JobSync:
+		if r.LocalPath == "" || r.PanPath == "" {
+			return fmt.Errorf("同步任务需要指定 localPath 和 panPath")
+		}
+		switch r.Mode {
+		case "", "upload", "download", "sync":
+		default:
+			return fmt.Errorf("不支持的同步模式: %s", r.Mode)
+		}
+	default:
+		return fmt.Errorf("不支持的任务类型: %s", r.Type)
+	}
+	if r.Parallel < 0 {
+		return fmt.Errorf("parallel 不能小于0")
+	}
+	for k := range r.Tags {
+		if strings.TrimSpace(k) == "" || strings.ContainsAny(k, "=,") {
+			return fmt.Errorf("标签名称不能为空，也不能包含 = 或者 , : %q", k)
+		}
+	}
+	return nil
+}
+
+// ParseTagSelector 解析标签过滤条件，格式: job=photos,owner=me，只写标签名称代表只要求存在该标签
+func ParseTagSelector(specs ...string) (TagSelector, error) {
+	selector := TagSelector{}
+	for _, spec := range specs {
+		for _, item := range strings.Split(spec, ",") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			kv := strings.SplitN(item, "=", 2)
+			key := strings.TrimSpace(kv[0])
+			if key == "" {
+				return nil, fmt.Errorf("标签过滤条件格式错误: %s", item)
+			}
+			value := ""
+			if len(kv) == 2 {
+				value = strings.TrimSpace(kv[1])
+			}
+			selector[key] = value
+		}
+	}
+	return selector, nil
+}
+
+// Match 标签是否满足过滤条件，没有过滤条件时总是匹配
+func (s TagSelector) Match(tags map[string]string) bool {
+	for k, v := range s {
+		tv, ok := tags[k]
+		if !ok || (v != "" && tv != v) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s TagSelector) String() string {
+	items := make([]string, 0, len(s))
+	for k, v := range s {
+		if v == "" {
+			items = append(items, k)
+		} else {
+			items = append(items, k+"="+v)
+		}
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
+
+// Id 任务ID
+func (j *Job) Id() string {
+	return j.id
+}
+
+// Request 任务参数
+func (j *Job) Request() *JobRequest {
+	return j.request
+}
+
+// Status 任务状态
+func (j *Job) Status() JobStatus {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return j.status
+}
+
+// IsFinished 任务是否已经结束
+func (j *Job) IsFinished() bool {
+	switch j.Status() {
+	case JobCompleted, JobCanceled, JobFailed:
+		return true
+	}
+	return false
+}
+
+// Info 任务信息
+func (j *Job) Info() *JobInfo {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	info := &JobInfo{
+		Id:        j.id,
+		Request:   j.request,
+		Status:    j.status,
+		Error:     j.err,
+		CreatedAt: j.createdAt.Format(timeFormat),
+		Progress:  j.control.Progress(),
+	}
+	if !j.startedAt.IsZero() {
+		info.StartedAt = j.startedAt.Format(timeFormat)
+	}
+	if !j.finishedAt.IsZero() {
+		info.FinishedAt = j.finishedAt.Format(timeFormat)
+	}
+	return info
+}
+
+func (j *Job) setStatus(status JobStatus) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.status = status
+	switch status {
+	case JobRunning:
+		if j.startedAt.IsZero() {
+			j.startedAt = time.Now()
+		}
+	case JobCompleted, JobCanceled, JobFailed:
+		j.finishedAt = time.Now()
+	}
+}
@@ -0,0 +1,82 @@
+package daemon
+
+import (
+	"testing"
+)
+
+func TestParseTagSelector(t *testing.T) {
+	cases := []struct {
+		specs []string
+		want  string
+		err   bool
+	}{
+		{nil, "", false},
+		{[]string{""}, "", false},
+		{[]string{"job=photos"}, "job=photos", false},
+		{[]string{" job = photos , owner=me "}, "job=photos,owner=me", false},
+		{[]string{"job=photos", "nightly"}, "job=photos,nightly", false},
+		{[]string{"job=photos,,nightly="}, "job=photos,nightly", false},
+		{[]string{"job=a", "job=b"}, "job=b", false},
+		{[]string{"url=a=b"}, "url=a=b", false},
+		{[]string{"=photos"}, "", true},
+	}
+	for _, c := range cases {
+		s, err := ParseTagSelector(c.specs...)
+		if (err != nil) != c.err {
+			t.Errorf("%v: error %v", c.specs, err)
+			continue
+		}
+		if err == nil && s.String() != c.want {
+			t.Errorf("%v: got %s, want %s", c.specs, s.String(), c.want)
+		}
+	}
+}
+
+func TestTagSelectorMatch(t *testing.T) {
+	tags := map[string]string{"job": "photos", "owner": "me", "nightly": ""}
+	cases := []struct {
+		selector string
+		tags     map[string]string
+		want     bool
+	}{
+		{"", tags, true},
+		{"", nil, true},
+		{"job=photos", tags, true},
+		{"job=photos,owner=me", tags, true},
+		{"job=videos", tags, false},
+		{"job=photos,owner=you", tags, false},
+		{"owner", tags, true},
+		{"nightly", tags, true},
+		{"weekly", tags, false},
+		{"job", nil, false},
+	}
+	for _, c := range cases {
+		s, _ := ParseTagSelector(c.selector)
+		if got := s.Match(c.tags); got != c.want {
+			t.Errorf("%q: got %v, want %v", c.selector, got, c.want)
+		}
+	}
+	var nilSelector TagSelector
+	if !nilSelector.Match(tags) {
+		t.Fatal("nil selector should match all")
+	}
+}
+
+func TestJobRequestValidateTags(t *testing.T) {
+	cases := []struct {
+		tags map[string]string
+		err  bool
+	}{
+		{nil, false},
+		{map[string]string{"job": "photos", "nightly": ""}, false},
+		{map[string]string{" ": "photos"}, true},
+		{map[string]string{"a=b": "photos"}, true},
+		{map[string]string{"a,b": "photos"}, true},
+	}
+	for _, c := range cases {
+		req := &JobRequest{Type: JobDownload, PanPaths: []string{"/a"}, Tags: c.tags}
+		if err := req.Validate(); (err != nil) != c.err {
+			t.Errorf("%v: error %v", c.tags, err)
+		}
+	}
+}
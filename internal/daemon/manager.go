@@ -0,0 +1,372 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tickstep/aliyunpan/internal/log"
+	"github.com/tickstep/aliyunpan/internal/metrics"
+	"github.com/tickstep/aliyunpan/internal/taskframework"
+)
+
+var (
+	// ErrJobNotFound 任务不存在
+	ErrJobNotFound = errors.New("任务不存在")
+	// ErrJobFinished 任务已经结束
+	ErrJobFinished = errors.New("任务已经结束")
+	// ErrJobNotPausable 任务不支持暂停
+	ErrJobNotPausable = errors.New("同步任务不支持暂停，只能取消")
+)
+
+type (
+	// Runner 执行任务，阻塞直到任务结束。暂停、取消通过control传递给执行方，执行方同时通过control提供进度
+	Runner func(job *Job, control *taskframework.TaskControl) error
+
+	// BatchResult 按标签批量操作的结果
+	BatchResult struct {
+		Succeeded []string          `json:"succeeded"` // 操作成功的任务ID
+		Failed    map[string]string `json:"failed"`    // 操作失败的任务ID以及失败原因
+	}
+
+	// Manager 后台任务管理，按提交顺序执行任务，同时执行的任务数量不超过maxRunning
+	Manager struct {
+		runner     Runner
+		maxRunning int
+		running    int
+		jobs       []*Job
+		index      map[string]*Job
+		lastId     int
+		closed     bool
+		wg         sync.WaitGroup
+		mutex      sync.Mutex
+	}
+)
+
+// NewManager 创建任务管理
+func NewManager(runner Runner, maxRunning int) *Manager {
+	if maxRunning < 1 {
+		maxRunning = 1
+	}
+	return &Manager{
+		runner:     runner,
+		maxRunning: maxRunning,
+		index:      map[string]*Job{},
+	}
+}
+
+// Submit 提交任务
+func (m *Manager) Submit(req *JobRequest) (*Job, error) {
+	if req == nil {
+		return nil, fmt.Errorf("任务参数为空")
+	}
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.closed {
+		return nil, fmt.Errorf("daemon正在退出")
+	}
+	m.lastId++
+	job := &Job{
+		id:        strconv.Itoa(m.lastId),
+		request:   req,
+		status:    JobQueued,
+		createdAt: time.Now(),
+		control:   taskframework.NewTaskControl(),
+	}
+	m.jobs = append(m.jobs, job)
+	m.index[job.id] = job
+	m.schedule()
+	return job, nil
+}
+
+// Get 获取任务
+func (m *Manager) Get(id string) (*Job, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	job, ok := m.index[id]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	return job, nil
+}
+
+// List 所有任务，按提交顺序排列
+func (m *Manager) List() []*JobInfo {
+	return m.ListByTags(nil)
+}
+
+// ListByTags 标签匹配的任务，按提交顺序排列
+func (m *Manager) ListByTags(selector TagSelector) []*JobInfo {
+	result := []*JobInfo{}
+	for _, job := range m.jobsByTags(selector) {
+		result = append(result, job.Info())
+	}
+	return result
+}
+
+// jobsByTags 标签匹配的任务
+func (m *Manager) jobsByTags(selector TagSelector) []*Job {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	jobs := []*Job{}
+	for _, job := range m.jobs {
+		if selector.Match(job.request.Tags) {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
+
+// ApplyByTags 对标签匹配的所有任务执行暂停、恢复、取消等操作，已经结束的任务跳过
+func (m *Manager) ApplyByTags(selector TagSelector, action func(id string) error) *BatchResult {
+	result := &BatchResult{
+		Succeeded: []string{},
+		Failed:    map[string]string{},
+	}
+	for _, job := range m.jobsByTags(selector) {
+		if job.IsFinished() {
+			continue
+		}
+		if err := action(job.id); err != nil {
+			result.Failed[job.id] = err.Error()
+			continue
+		}
+		result.Succeeded = append(result.Succeeded, job.id)
+	}
+	return result
+}
+
+// Pause 暂停任务。还没有开始的任务不会被调度，正在执行的任务中止正在传输的文件并保存断点，恢复后从断点继续
+func (m *Manager) Pause(id string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	job, ok := m.index[id]
+	if !ok {
+		return ErrJobNotFound
+	}
+	if !job.request.Type.Pausable() {
+		return ErrJobNotPausable
+	}
+	switch job.Status() {
+	case JobQueued, JobRunning:
+		job.control.Pause()
+		job.setStatus(JobPaused)
+	case JobPaused:
+	default:
+		return ErrJobFinished
+	}
+	return nil
+}
+
+// Resume 恢复已暂停的任务
+func (m *Manager) Resume(id string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	job, ok := m.index[id]
+	if !ok {
+		return ErrJobNotFound
+	}
+	if job.Status() != JobPaused {
+		if job.IsFinished() {
+			return ErrJobFinished
+		}
+		return nil
+	}
+	job.control.Resume()
+	job.mutex.Lock()
+	started := !job.startedAt.IsZero()
+	job.mutex.Unlock()
+	if started {
+		job.setStatus(JobRunning)
+	} else {
+		job.setStatus(JobQueued)
+		m.schedule()
+	}
+	return nil
+}
+
+// Cancel 取消任务。正在传输的文件会继续传输完成，其余文件不再传输
+func (m *Manager) Cancel(id string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	job, ok := m.index[id]
+	if !ok {
+		return ErrJobNotFound
+	}
+	if job.IsFinished() {
+		return ErrJobFinished
+	}
+	job.control.Stop()
+	job.mutex.Lock()
+	started := !job.startedAt.IsZero()
+	job.mutex.Unlock()
+	if !started {
+		job.setStatus(JobCanceled)
+	}
+	return nil
+}
+
+// Remove 从列表中移除已经结束的任务
+func (m *Manager) Remove(id string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	job, ok := m.index[id]
+	if !ok {
+		return ErrJobNotFound
+	}
+	if !job.IsFinished() {
+		return fmt.Errorf("任务还没有结束，请先取消任务")
+	}
+	delete(m.index, id)
+	for i, j := range m.jobs {
+		if j == job {
+			m.jobs = append(m.jobs[:i], m.jobs[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// Running 正在执行的任务数量
+func (m *Manager) Running() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.running
+}
+
+// IsActive 正在执行的任务是否都在 timeout 时间内有进展，用于systemd看门狗检测任务是否卡死。
+// 传输了数据或者完成了文件都算有进展；暂停的任务以及没有提供进度的任务不检测
+func (m *Manager) IsActive(timeout time.Duration) bool {
+	now := time.Now()
+	for _, job := range m.jobsByTags(nil) {
+		progress := job.control.Progress()
+		job.mutex.Lock()
+		if job.status != JobRunning || progress == nil {
+			// 恢复执行后重新计算超时
+			job.lastProgressAt = time.Time{}
+			job.mutex.Unlock()
+			continue
+		}
+		current := progress.TotalSize + progress.SucceedFiles + progress.FailedFiles
+		if job.lastProgressAt.IsZero() || current != job.lastProgress {
+			job.lastProgress = current
+			job.lastProgressAt = now
+		}
+		stalled := now.Sub(job.lastProgressAt) > timeout
+		job.mutex.Unlock()
+		if stalled {
+			log.Warn("daemon任务没有进展", "job", job.id, "type", job.request.Type)
+			return false
+		}
+	}
+	return true
+}
+
+// CollectMetrics 按状态统计任务数量，输出到 /metrics。排队中的任务数量即为队列深度
+func (m *Manager) CollectMetrics() []*metrics.Point {
+	fields := map[string]float64{}
+	for _, status := range []JobStatus{JobQueued, JobRunning, JobPaused, JobCompleted, JobCanceled, JobFailed} {
+		fields[string(status)] = 0
+	}
+	for _, job := range m.jobsByTags(nil) {
+		job.mutex.Lock()
+		fields[string(job.status)]++
+		job.mutex.Unlock()
+	}
+	return []*metrics.Point{{
+		Measurement: "daemon_jobs",
+		Fields:      fields,
+	}}
+}
+
+// Close 取消所有任务并等待正在执行的任务结束
+func (m *Manager) Close() {
+	m.mutex.Lock()
+	m.closed = true
+	for _, job := range m.jobs {
+		if !job.IsFinished() {
+			job.control.Stop()
+			if job.Status() != JobRunning && job.Status() != JobPaused {
+				job.setStatus(JobCanceled)
+			}
+		}
+	}
+	m.mutex.Unlock()
+	m.wg.Wait()
+}
+
+// schedule 按提交顺序启动排队中的任务，调用方需持有锁
+func (m *Manager) schedule() {
+	if m.closed {
+		return
+	}
+	for _, job := range m.jobs {
+		if m.running >= m.maxRunning {
+			return
+		}
+		if job.Status() != JobQueued {
+			continue
+		}
+		job.setStatus(JobRunning)
+		m.running++
+		m.wg.Add(1)
+		go m.run(job)
+	}
+}
+
+func (m *Manager) run(job *Job) {
+	defer m.wg.Done()
+	log.Info("daemon任务开始", "job", job.id, "type", job.request.Type)
+	err := m.safeRun(job)
+	job.mutex.Lock()
+	if err != nil {
+		job.err = err.Error()
+	}
+	job.mutex.Unlock()
+	switch {
+	case job.control.IsStopped():
+		job.setStatus(JobCanceled)
+	case err != nil:
+		job.setStatus(JobFailed)
+	default:
+		job.setStatus(JobCompleted)
+	}
+	if err != nil {
+		log.Error("daemon任务结束", "job", job.id, "type", job.request.Type, "status", job.Status(), "error", err)
+	} else {
+		log.Info("daemon任务结束", "job", job.id, "type", job.request.Type, "status", job.Status())
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.running--
+	m.schedule()
+}
+
+// safeRun 执行任务，任务异常不影响daemon进程
+func (m *Manager) safeRun(job *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("任务异常: %v", r)
+		}
+	}()
+	return m.runner(job, job.control)
+}
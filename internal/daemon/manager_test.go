@@ -0,0 +1,63 @@
+package daemon
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tickstep/aliyunpan/internal/taskframework"
+)
+
+func TestManagerIsActive(t *testing.T) {
+	var transferred int64
+	release := make(chan struct{})
+	m := NewManager(func(job *Job, control *taskframework.TaskControl) error {
+		control.SetProgressFunc(func() *taskframework.TaskProgress {
+			return &taskframework.TaskProgress{TotalSize: atomic.LoadInt64(&transferred)}
+		})
+		<-release
+		return nil
+	}, 1)
+	defer m.Close()
+	if !m.IsActive(time.Minute) {
+		t.Fatal("no job")
+	}
+	job, err := m.Submit(&JobRequest{Type: JobDownload, PanPaths: []string{"/a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for job.control.Progress() == nil {
+		time.Sleep(time.Millisecond)
+	}
+
+	timeout := 50 * time.Millisecond
+	if !m.IsActive(timeout) {
+		t.Fatal("first check")
+	}
+	// 有数据传输
+	time.Sleep(2 * timeout)
+	atomic.AddInt64(&transferred, 1024)
+	if !m.IsActive(timeout) {
+		t.Fatal("job made progress")
+	}
+	// 超过timeout没有数据传输
+	time.Sleep(2 * timeout)
+	if m.IsActive(timeout) {
+		t.Fatal("job is stalled")
+	}
+
+	// 暂停的任务不检测，恢复后重新计算超时
+	if err := m.Pause(job.Id()); err != nil {
+		t.Fatal(err)
+	}
+	if !m.IsActive(timeout) {
+		t.Fatal("paused job")
+	}
+	if err := m.Resume(job.Id()); err != nil {
+		t.Fatal(err)
+	}
+	if !m.IsActive(timeout) {
+		t.Fatal("resumed job")
+	}
+	close(release)
+}
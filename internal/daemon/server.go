@@ -0,0 +1,253 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package daemon
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/tickstep/aliyunpan/internal/metrics"
+)
+
+const (
+	// DefaultListenAddr 默认监听地址，只允许本机访问
+	DefaultListenAddr = "127.0.0.1:5299"
+
+	// ApiPrefix API路径前缀
+	ApiPrefix = "/api/v1"
+
+	// maxRequestBodySize 提交任务的请求体大小限制
+	maxRequestBodySize = 1 << 20
+)
+
+type (
+	// ServerInfo daemon状态信息
+	ServerInfo struct {
+		Version   string `json:"version"`
+		User      string `json:"user"`
+		StartedAt string `json:"startedAt"`
+		Jobs      int    `json:"jobs"`
+		Running   int    `json:"running"`
+	}
+
+	// errorResponse 错误响应
+	errorResponse struct {
+		Error string `json:"error"`
+	}
+)
+
+// NewHandler 创建控制API，请求需要携带 Authorization: Bearer <token>，token为空时拒绝所有请求。
+// localOnly为true时只接受Host为本机地址的请求，避免DNS重绑定攻击。浏览器发起的跨站请求(Origin不是本机地址)总是拒绝
+//
+//	GET    /api/v1/status               daemon状态
+//	GET    /api/v1/jobs                 任务列表
+//	POST   /api/v1/jobs                 提交任务
+//	GET    /api/v1/jobs/{id}            任务详情以及进度
+//	POST   /api/v1/jobs/{id}/pause      暂停任务
+//	POST   /api/v1/jobs/{id}/resume     恢复任务
+//	POST   /api/v1/jobs/{id}/cancel     取消任务
+//	DELETE /api/v1/jobs/{id}            移除已结束的任务
+//	POST   /api/v1/jobs/batch/{action}  按标签批量暂停(pause)、恢复(resume)、取消(cancel)任务
+//	GET    /metrics                     Prometheus格式的指标
+//
+// status、jobs以及批量操作使用查询参数 tag 按标签过滤，例如 ?tag=job=photos，多个条件同时满足时匹配
+func NewHandler(m *Manager, token string, localOnly bool, version, user string) http.Handler {
+	startedAt := time.Now().Format(timeFormat)
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metrics.Default.Handler())
+	mux.HandleFunc("GET "+ApiPrefix+"/status", func(w http.ResponseWriter, r *http.Request) {
+		selector, err := tagSelector(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		info := &ServerInfo{
+			Version:   version,
+			User:      user,
+			StartedAt: startedAt,
+		}
+		if len(selector) == 0 {
+			info.Jobs = len(m.List())
+			info.Running = m.Running()
+		} else {
+			jobs := m.ListByTags(selector)
+			info.Jobs = len(jobs)
+			for _, job := range jobs {
+				if job.Status == JobRunning {
+					info.Running++
+				}
+			}
+		}
+		writeJson(w, http.StatusOK, info)
+	})
+	mux.HandleFunc("GET "+ApiPrefix+"/jobs", func(w http.ResponseWriter, r *http.Request) {
+		selector, err := tagSelector(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJson(w, http.StatusOK, m.ListByTags(selector))
+	})
+	mux.HandleFunc("POST "+ApiPrefix+"/jobs", func(w http.ResponseWriter, r *http.Request) {
+		req := &JobRequest{}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize)).Decode(req); err != nil {
+			writeError(w, http.StatusBadRequest, errors.New("请求参数格式错误: "+err.Error()))
+			return
+		}
+		job, err := m.Submit(req)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJson(w, http.StatusCreated, job.Info())
+	})
+	mux.HandleFunc("GET "+ApiPrefix+"/jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		job, err := m.Get(r.PathValue("id"))
+		if err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeJson(w, http.StatusOK, job.Info())
+	})
+	mux.HandleFunc("DELETE "+ApiPrefix+"/jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if err := m.Remove(r.PathValue("id")); err != nil {
+			writeJobError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	actions := map[string]func(id string) error{
+		"pause":  m.Pause,
+		"resume": m.Resume,
+		"cancel": m.Cancel,
+	}
+	mux.HandleFunc("POST "+ApiPrefix+"/jobs/batch/{action}", func(w http.ResponseWriter, r *http.Request) {
+		action, ok := actions[r.PathValue("action")]
+		if !ok {
+			writeError(w, http.StatusNotFound, errors.New("不支持的操作: "+r.PathValue("action")))
+			return
+		}
+		selector, err := tagSelector(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if len(selector) == 0 {
+			// 避免误操作所有任务
+			writeError(w, http.StatusBadRequest, errors.New("批量操作需要使用 tag 参数指定标签"))
+			return
+		}
+		writeJson(w, http.StatusOK, m.ApplyByTags(selector, action))
+	})
+	mux.HandleFunc("POST "+ApiPrefix+"/jobs/{id}/{action}", func(w http.ResponseWriter, r *http.Request) {
+		action, ok := actions[r.PathValue("action")]
+		if !ok {
+			writeError(w, http.StatusNotFound, errors.New("不支持的操作: "+r.PathValue("action")))
+			return
+		}
+		id := r.PathValue("id")
+		if err := action(id); err != nil {
+			writeJobError(w, err)
+			return
+		}
+		job, _ := m.Get(id)
+		writeJson(w, http.StatusOK, job.Info())
+	})
+	return originHandler(authHandler(mux, token), localOnly)
+}
+
+// GenerateToken 生成随机的访问令牌
+func GenerateToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// IsLoopbackAddr 地址是否为本机地址，支持带端口的地址
+func IsLoopbackAddr(addr string) bool {
+	host := addr
+	if h, _, err := net.SplitHostPort(addr); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// originHandler 校验请求来源，拒绝其他网站通过浏览器访问本机API
+func originHandler(next http.Handler, localOnly bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if localOnly && !IsLoopbackAddr(r.Host) {
+			writeError(w, http.StatusForbidden, errors.New("不允许的Host: "+r.Host))
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" {
+			u, err := url.Parse(origin)
+			if err != nil || !IsLoopbackAddr(u.Host) {
+				writeError(w, http.StatusForbidden, errors.New("不允许的Origin: "+origin))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// tagSelector 查询参数中的标签过滤条件
+func tagSelector(r *http.Request) (TagSelector, error) {
+	return ParseTagSelector(r.URL.Query()["tag"]...)
+}
+
+// authHandler 校验访问令牌，没有设置令牌时拒绝所有请求
+func authHandler(next http.Handler, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer"))
+		if token == "" || subtle.ConstantTimeCompare([]byte(auth), []byte(token)) != 1 {
+			writeError(w, http.StatusUnauthorized, errors.New("访问令牌错误"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJobError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrJobNotFound):
+		writeError(w, http.StatusNotFound, err)
+	default:
+		writeError(w, http.StatusConflict, err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJson(w, status, &errorResponse{Error: err.Error()})
+}
+
+func writeJson(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,62 @@
+package daemon
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tickstep/aliyunpan/internal/taskframework"
+)
+
+func TestHandlerAuth(t *testing.T) {
+	m := NewManager(func(job *Job, control *taskframework.TaskControl) error { return nil }, 1)
+	defer m.Close()
+
+	cases := []struct {
+		name      string
+		token     string
+		localOnly bool
+		host      string
+		auth      string
+		origin    string
+		want      int
+	}{
+		{"令牌正确", "secret", true, "127.0.0.1:5299", "Bearer secret", "", http.StatusOK},
+		{"缺少令牌", "secret", true, "127.0.0.1:5299", "", "", http.StatusUnauthorized},
+		{"令牌错误", "secret", true, "127.0.0.1:5299", "Bearer wrong", "", http.StatusUnauthorized},
+		{"没有设置令牌", "", true, "127.0.0.1:5299", "Bearer ", "", http.StatusUnauthorized},
+		{"localhost", "secret", true, "localhost:5299", "Bearer secret", "", http.StatusOK},
+		{"IPv6本机地址", "secret", true, "[::1]:5299", "Bearer secret", "", http.StatusOK},
+		{"DNS重绑定", "secret", true, "evil.example.com:5299", "Bearer secret", "", http.StatusForbidden},
+		{"监听其他地址", "secret", false, "192.168.1.2:5299", "Bearer secret", "", http.StatusOK},
+		{"本机页面", "secret", true, "127.0.0.1:5299", "Bearer secret", "http://localhost:8080", http.StatusOK},
+		{"跨站请求", "secret", true, "127.0.0.1:5299", "Bearer secret", "https://evil.example.com", http.StatusForbidden},
+		{"监听其他地址的跨站请求", "secret", false, "192.168.1.2:5299", "Bearer secret", "https://evil.example.com", http.StatusForbidden},
+	}
+	for _, c := range cases {
+		handler := NewHandler(m, c.token, c.localOnly, "v0.0.1", "tickstep")
+		req := httptest.NewRequest(http.MethodGet, "http://"+c.host+ApiPrefix+"/status", nil)
+		if c.auth != "" {
+			req.Header.Set("Authorization", c.auth)
+		}
+		if c.origin != "" {
+			req.Header.Set("Origin", c.origin)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != c.want {
+			t.Errorf("%s: status %d, want %d", c.name, rec.Code, c.want)
+		}
+	}
+}
+
+func TestGenerateToken(t *testing.T) {
+	a, err := GenerateToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := GenerateToken()
+	if len(a) != 32 || a == b {
+		t.Fatalf("unexpected tokens: %s, %s", a, b)
+	}
+}
@@ -14,6 +14,7 @@
 package downloader
 
 import (
+	"github.com/tickstep/aliyunpan/internal/file/ratelimit"
 	"github.com/tickstep/aliyunpan/library/requester/transfer"
 )
 
@@ -39,6 +40,7 @@ type Config struct {
 	CacheSize                  int                        // 下载缓冲
 	BlockSize                  int64                      // 每个Range区块的大小, RangeGenMode 为 RangeGenMode2 时才有效
 	MaxRate                    int64                      // 限制最大下载速度
+	SharedRateLimit            *ratelimit.SharedRateLimit // 本次下载所有文件共享的限速，和单文件限速同时生效，可以为nil
 	InstanceStateStorageFormat InstanceStateStorageFormat // 断点续传储存类型
 	InstanceStatePath          string                     // 断点续传信息路径
 	TryHTTP                    bool                       // 是否尝试使用 http 连接
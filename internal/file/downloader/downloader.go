@@ -20,7 +20,9 @@ import (
 	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
 	"github.com/tickstep/aliyunpan/cmder/cmdutil"
 	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/file/ratelimit"
 	"github.com/tickstep/aliyunpan/internal/global"
+	"github.com/tickstep/aliyunpan/internal/localfile"
 	"github.com/tickstep/aliyunpan/internal/waitgroup"
 	"github.com/tickstep/aliyunpan/library/requester/transfer"
 	"github.com/tickstep/library-go/cachepool"
@@ -30,6 +32,7 @@ import (
 	"github.com/tickstep/library-go/requester/rio/speeds"
 	"io"
 	"net/http"
+	"os"
 	"strings"
 	"sync"
 	"time"
@@ -70,6 +73,8 @@ type (
 		config                  *Config
 		monitor                 *Monitor
 		instanceState           *InstanceState
+		streamSha1Enabled       bool                  // 是否下载时流式计算SHA1
+		streamSha1              *localfile.StreamSha1 // 下载时流式计算的SHA1
 	}
 
 	// DURLCheckFunc 下载URL检测函数
@@ -108,6 +113,17 @@ func (der *Downloader) SetDriveId(driveId string) {
 	der.driveId = driveId
 }
 
+// EnableStreamSha1 下载写盘的同时流式计算SHA1，下载完成后通过 StreamSha1 获取结果。
+// writer 需要同时实现 io.ReaderAt，用于读回多线程下载时不是按顺序写入的数据
+func (der *Downloader) EnableStreamSha1() {
+	der.streamSha1Enabled = true
+}
+
+// StreamSha1 下载时流式计算的文件SHA1，没有开启或者数据不完整时返回空字符串
+func (der *Downloader) StreamSha1() string {
+	return der.streamSha1.Sum()
+}
+
 // SetClient 设置http客户端
 func (der *Downloader) SetClient(client *requester.HTTPClient) {
 	der.client = client
@@ -318,6 +334,11 @@ func (der *Downloader) Execute() error {
 		return err
 	}
 	bii = der.instanceState.Get()
+	if bii != nil && der.isLocalFileMissing(bii) {
+		// 本地文件已被删除或者截断，已下载的分段数据不存在，只能重新下载
+		logger.Verbosef("DEBUG: local file missing, discard instance state: %s\n", der.config.InstanceStatePath)
+		bii = nil
+	}
 
 	var (
 		isInstance = bii != nil // 是否存在断点信息
@@ -336,9 +357,15 @@ func (der *Downloader) Execute() error {
 		status.SetTotalSize(der.fileInfo.FileSize)
 	}
 
-	// 设置限速
+	// 设置限速，单文件限速和任务共享限速同时生效
+	var fileRateLimit, taskRateLimit ratelimit.Limiter
 	if der.config.MaxRate > 0 {
-		rl := speeds.NewRateLimit(der.config.MaxRate)
+		fileRateLimit = speeds.NewRateLimit(der.config.MaxRate)
+	}
+	if der.config.SharedRateLimit != nil {
+		taskRateLimit = der.config.SharedRateLimit.NewUnit()
+	}
+	if rl := ratelimit.Chain(fileRateLimit, taskRateLimit); rl != nil {
 		status.SetRateLimit(rl)
 		defer rl.Stop()
 	}
@@ -387,6 +414,16 @@ func (der *Downloader) Execute() error {
 		}
 	}
 
+	if der.streamSha1Enabled {
+		reader, _ := der.writer.(io.ReaderAt)
+		der.streamSha1 = localfile.NewStreamSha1(status.TotalSize(), reader)
+		if isRange {
+			// 断点续传之前已经下载的数据需要从文件读回计算
+			markDownloadedRanges(der.streamSha1, bii.Ranges, status.TotalSize())
+		}
+		writer = &streamSha1Writer{writer: writer, streamSha1: der.streamSha1}
+	}
+
 	var (
 		writeMu = &sync.Mutex{}
 	)
@@ -409,8 +446,7 @@ func (der *Downloader) Execute() error {
 		}
 
 		logger.Verbosef("work id: %d, download url: %v\n", k, panClientUrl.FileUrl)
-		client := requester.NewHTTPClient()
-		client.SetKeepAlive(true)
+		client := config.Config.TransferHTTPClient()
 		client.SetTimeout(10 * time.Minute)
 
 		realUrl := panClientUrl.FileUrl
@@ -438,7 +474,7 @@ func (der *Downloader) Execute() error {
 	// 开始执行
 	der.executeTime = time.Now()
 	cmdutil.Trigger(der.onExecuteEvent)
-	der.downloadStatusEvent() // 启动执行状态处理事件
+	der.downloadStatusEvent(moniterCtx) // 启动执行状态处理事件
 	der.monitor.Execute(moniterCtx)
 
 	// 检查错误
@@ -458,6 +494,32 @@ func (der *Downloader) Execute() error {
 	return err
 }
 
+// isLocalFileMissing 断点信息记录已经下载了数据，但是本地文件比已下载的数据短
+func (der *Downloader) isLocalFileMissing(bii *transfer.DownloadInstanceInfo) bool {
+	if bii.DownloadStatus == nil || bii.DownloadStatus.Downloaded() <= 0 {
+		return false
+	}
+	st, ok := der.writer.(interface{ Stat() (os.FileInfo, error) })
+	if !ok {
+		return false
+	}
+	fi, err := st.Stat()
+	if err != nil {
+		return false
+	}
+	if fi.Size() == 0 {
+		return true
+	}
+	// 第一个未下载分段之前的数据都已经写入文件
+	var begin int64 = -1
+	for _, r := range bii.Ranges {
+		if r != nil && r.LoadBegin() < r.LoadEnd() && (begin < 0 || r.LoadBegin() < begin) {
+			begin = r.LoadBegin()
+		}
+	}
+	return fi.Size() < begin
+}
+
 // 获取对应网盘文件的下载链接
 func (der *Downloader) getFileAllClientDownloadUrl() ([]*panClientDownloadUrlEntity, error) {
 	if der.filePanSource == global.AlbumSource {
@@ -618,7 +680,7 @@ func (der *Downloader) getAlbumSourceDownloadUrl() ([]*panClientDownloadUrlEntit
 }
 
 // downloadStatusEvent 执行状态处理事件
-func (der *Downloader) downloadStatusEvent() {
+func (der *Downloader) downloadStatusEvent(cancelCtx context.Context) {
 	if der.onDownloadStatusEvent == nil {
 		return
 	}
@@ -631,6 +693,8 @@ func (der *Downloader) downloadStatusEvent() {
 			select {
 			case <-der.monitor.completed:
 				return
+			case <-cancelCtx.Done():
+				return
 			case <-ticker.C:
 				time.Sleep(500 * time.Millisecond)
 				der.onDownloadStatusEvent(status, der.monitor.RangeWorker)
@@ -15,21 +15,24 @@ package downloader
 
 import (
 	"errors"
+	"os"
+	"strings"
+	"sync"
+
 	"github.com/json-iterator/go"
-	"github.com/tickstep/library-go/cachepool"
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan/library/requester/transfer"
 	"github.com/tickstep/library-go/crypto"
 	"github.com/tickstep/library-go/logger"
-	"github.com/tickstep/aliyunpan/library/requester/transfer"
-	"os"
-	"sync"
 )
 
 type (
 	//InstanceState 状态, 断点续传信息
 	InstanceState struct {
-		saveFile *os.File
+		savePath string
 		format   InstanceStateStorageFormat
 		ii       *transfer.DownloadInstanceInfoExport
+		fileInfo *aliyunpan.FileEntity // 下载的网盘文件，和断点信息一起保存，用于续传时检查网盘文件是否变化
 		mu       sync.Mutex
 	}
 
@@ -44,16 +47,16 @@ const (
 	InstanceStateStorageFormatProto3
 )
 
-//NewInstanceState 初始化InstanceState
-func NewInstanceState(saveFile *os.File, format InstanceStateStorageFormat) *InstanceState {
+//NewInstanceState 初始化InstanceState, savePath 为空代表不保存断点信息
+func NewInstanceState(savePath string, format InstanceStateStorageFormat) *InstanceState {
 	return &InstanceState{
-		saveFile: saveFile,
+		savePath: savePath,
 		format:   format,
 	}
 }
 
 func (is *InstanceState) checkSaveFile() bool {
-	return is.saveFile != nil
+	return is.savePath != ""
 }
 
 func (is *InstanceState) getSaveFileContents() []byte {
@@ -61,24 +64,21 @@ func (is *InstanceState) getSaveFileContents() []byte {
 		return nil
 	}
 
-	finfo, err := is.saveFile.Stat()
+	data, err := os.ReadFile(is.savePath)
 	if err != nil {
-		panic(err)
-	}
-
-	size := finfo.Size()
-	if size > 0xffffffff {
-		panic("savePath too large")
+		return nil
 	}
-	intSize := int(size)
-
-	buf := cachepool.RawMallocByteSlice(intSize)
+	return crypto.Base64Decode(data)
+}
 
-	n, _ := is.saveFile.ReadAt(buf, 0)
-	return crypto.Base64Decode(buf[:n])
+// SetFileInfo 设置下载的网盘文件，保存断点信息时一起记录文件ID、大小和SHA1
+func (is *InstanceState) SetFileInfo(f *aliyunpan.FileEntity) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	is.fileInfo = f
 }
 
-//Get 获取断点续传信息
+//Get 获取断点续传信息，网盘文件已经变化的断点信息视为无效
 func (is *InstanceState) Get() (eii *transfer.DownloadInstanceInfo) {
 	if !is.checkSaveFile() {
 		return nil
@@ -92,20 +92,40 @@ func (is *InstanceState) Get() (eii *transfer.DownloadInstanceInfo) {
 		return
 	}
 
-	is.ii = &transfer.DownloadInstanceInfoExport{}
-	var err error
-	err = jsoniter.Unmarshal(contents, is.ii)
-
+	ii := &transfer.DownloadInstanceInfoExport{}
+	err := jsoniter.Unmarshal(contents, ii)
 	if err != nil {
 		logger.Verbosef("DEBUG: InstanceInfo unmarshal error: %s\n", err)
 		return
 	}
+	if !is.matchFileInfo(ii) {
+		logger.Verbosef("DEBUG: remote file changed, discard instance state: %s\n", is.savePath)
+		return
+	}
 
+	is.ii = ii
 	eii = is.ii.GetInstanceInfo()
 	return
 }
 
-//Put 提交断点续传信息
+// matchFileInfo 断点信息是否属于当前要下载的网盘文件。旧版本的断点信息没有记录文件ID，只检查文件大小
+func (is *InstanceState) matchFileInfo(ii *transfer.DownloadInstanceInfoExport) bool {
+	if is.fileInfo == nil {
+		return true
+	}
+	if ii.TotalSize != is.fileInfo.FileSize {
+		return false
+	}
+	if ii.FileId != "" && ii.FileId != is.fileInfo.FileId {
+		return false
+	}
+	if ii.ContentHash != "" && is.fileInfo.ContentHash != "" && !strings.EqualFold(ii.ContentHash, is.fileInfo.ContentHash) {
+		return false
+	}
+	return true
+}
+
+//Put 提交断点续传信息。先写入临时文件再重命名，程序中途退出也不会留下不完整的断点信息
 func (is *InstanceState) Put(eii *transfer.DownloadInstanceInfo) {
 	if !is.checkSaveFile() {
 		return
@@ -118,6 +138,10 @@ func (is *InstanceState) Put(eii *transfer.DownloadInstanceInfo) {
 		is.ii = &transfer.DownloadInstanceInfoExport{}
 	}
 	is.ii.SetInstanceInfo(eii)
+	if is.fileInfo != nil {
+		is.ii.FileId = is.fileInfo.FileId
+		is.ii.ContentHash = is.fileInfo.ContentHash
+	}
 	var (
 		data []byte
 		err  error
@@ -127,24 +151,22 @@ func (is *InstanceState) Put(eii *transfer.DownloadInstanceInfo) {
 		panic(err)
 	}
 
-	err = is.saveFile.Truncate(int64(len(data)))
+	tmpPath := is.savePath + ".tmp"
+	err = os.WriteFile(tmpPath, crypto.Base64Encode(data), 0777)
 	if err != nil {
-		logger.Verbosef("DEBUG: truncate file error: %s\n", err)
+		logger.Verbosef("DEBUG: write instance state error: %s\n", err)
+		return
 	}
-
-	_, err = is.saveFile.WriteAt(crypto.Base64Encode(data), 0)
+	err = os.Rename(tmpPath, is.savePath)
 	if err != nil {
-		logger.Verbosef("DEBUG: write instance state error: %s\n", err)
+		logger.Verbosef("DEBUG: rename instance state error: %s\n", err)
+		os.Remove(tmpPath)
 	}
 }
 
 //Close 关闭
 func (is *InstanceState) Close() error {
-	if !is.checkSaveFile() {
-		return nil
-	}
-
-	return is.saveFile.Close()
+	return nil
 }
 
 func (der *Downloader) initInstanceState(format InstanceStateStorageFormat) (err error) {
@@ -152,15 +174,8 @@ func (der *Downloader) initInstanceState(format InstanceStateStorageFormat) (err
 		return errors.New("already initInstanceState")
 	}
 
-	var saveFile *os.File
-	if der.config.InstanceStatePath != "" {
-		saveFile, err = os.OpenFile(der.config.InstanceStatePath, os.O_RDWR|os.O_CREATE, 0777)
-		if err != nil {
-			return err
-		}
-	}
-
-	der.instanceState = NewInstanceState(saveFile, format)
+	der.instanceState = NewInstanceState(der.config.InstanceStatePath, format)
+	der.instanceState.SetFileInfo(der.fileInfo)
 	return nil
 }
 
@@ -0,0 +1,64 @@
+package downloader
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan/library/requester/transfer"
+)
+
+func TestMatchFileInfo(t *testing.T) {
+	file := &aliyunpan.FileEntity{FileId: "f1", FileSize: 100, ContentHash: "AAF4C61DDCC5E8A2DABEDE0F3B482CD9AEA9434D"}
+	cases := []struct {
+		name     string
+		fileInfo *aliyunpan.FileEntity
+		ii       *transfer.DownloadInstanceInfoExport
+		want     bool
+	}{
+		{"没有设置网盘文件", nil, &transfer.DownloadInstanceInfoExport{TotalSize: 1}, true},
+		{"文件一致", file, &transfer.DownloadInstanceInfoExport{TotalSize: 100, FileId: "f1", ContentHash: file.ContentHash}, true},
+		{"SHA1大小写不同", file, &transfer.DownloadInstanceInfoExport{TotalSize: 100, FileId: "f1", ContentHash: "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d"}, true},
+		{"旧版本断点信息只检查大小", file, &transfer.DownloadInstanceInfoExport{TotalSize: 100}, true},
+		{"旧版本断点信息大小不同", file, &transfer.DownloadInstanceInfoExport{TotalSize: 99}, false},
+		{"文件大小不同", file, &transfer.DownloadInstanceInfoExport{TotalSize: 99, FileId: "f1", ContentHash: file.ContentHash}, false},
+		{"文件ID不同", file, &transfer.DownloadInstanceInfoExport{TotalSize: 100, FileId: "f2", ContentHash: file.ContentHash}, false},
+		{"文件内容不同", file, &transfer.DownloadInstanceInfoExport{TotalSize: 100, FileId: "f1", ContentHash: "DA39A3EE5E6B4B0D3255BFEF95601890AFD80709"}, false},
+		{"网盘文件没有SHA1", &aliyunpan.FileEntity{FileId: "f1", FileSize: 100}, &transfer.DownloadInstanceInfoExport{TotalSize: 100, FileId: "f1", ContentHash: file.ContentHash}, true},
+	}
+	for _, c := range cases {
+		is := NewInstanceState("", InstanceStateStorageFormatJSON)
+		is.SetFileInfo(c.fileInfo)
+		if got := is.matchFileInfo(c.ii); got != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestInstanceStateFileInfo(t *testing.T) {
+	savePath := filepath.Join(t.TempDir(), "state")
+	file := &aliyunpan.FileEntity{FileId: "f1", FileSize: 100, ContentHash: "AAF4C61DDCC5E8A2DABEDE0F3B482CD9AEA9434D"}
+	status := transfer.NewDownloadStatus()
+	status.SetTotalSize(100)
+
+	is := NewInstanceState(savePath, InstanceStateStorageFormatJSON)
+	is.SetFileInfo(file)
+	is.Put(&transfer.DownloadInstanceInfo{DownloadStatus: status, Ranges: transfer.RangeList{{Begin: 0, End: 100}}})
+
+	cases := []struct {
+		name     string
+		fileInfo *aliyunpan.FileEntity
+		want     bool
+	}{
+		{"网盘文件没有变化", file, true},
+		{"网盘文件被替换", &aliyunpan.FileEntity{FileId: "f2", FileSize: 100, ContentHash: file.ContentHash}, false},
+		{"网盘文件被修改", &aliyunpan.FileEntity{FileId: "f1", FileSize: 100, ContentHash: "DA39A3EE5E6B4B0D3255BFEF95601890AFD80709"}, false},
+	}
+	for _, c := range cases {
+		is := NewInstanceState(savePath, InstanceStateStorageFormatJSON)
+		is.SetFileInfo(c.fileInfo)
+		if got := is.Get() != nil; got != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
@@ -161,8 +161,8 @@ func (mt *Monitor) IsLeftWorkersAllFailed() bool {
 	return failedNum != 0
 }
 
-// registerAllCompleted 全部完成则发送消息
-func (mt *Monitor) registerAllCompleted() {
+// registerAllCompleted 全部完成则发送消息，取消执行后不再检查
+func (mt *Monitor) registerAllCompleted(cancelCtx context.Context) {
 	mt.completed = make(chan struct{}, 0)
 	var (
 		workerNum   = len(mt.workers)
@@ -171,7 +171,11 @@ func (mt *Monitor) registerAllCompleted() {
 
 	go func() {
 		for {
-			time.Sleep(1 * time.Second)
+			select {
+			case <-cancelCtx.Done():
+				return
+			case <-time.After(1 * time.Second):
+			}
 
 			completeNum = 0
 			for _, worker := range mt.workers {
@@ -372,7 +376,7 @@ func (mt *Monitor) Execute(cancelCtx context.Context) {
 		go worker.Execute()
 	}
 
-	mt.registerAllCompleted() // 注册completed
+	mt.registerAllCompleted(cancelCtx) // 注册completed
 	ticker := time.NewTicker(990 * time.Millisecond)
 	defer ticker.Stop()
 
@@ -386,6 +390,16 @@ func (mt *Monitor) Execute(cancelCtx context.Context) {
 					logger.Verbosef("DEBUG: cancel failed, worker id: %d, err: %s\n", worker.ID(), err)
 				}
 			}
+			// 保存断点信息，下次从断点继续
+			if mt.instanceState != nil {
+				mt.instanceState.Put(&transfer.DownloadInstanceInfo{
+					DownloadStatus: mt.status,
+					Ranges:         mt.GetAllWorkersRange(),
+				})
+			}
+			if mt.err == nil {
+				mt.err = context.Canceled
+			}
 			return
 		case <-mt.completed:
 			return
@@ -15,6 +15,7 @@ package downloader
 
 import (
 	"errors"
+	"github.com/tickstep/aliyunpan/internal/utils"
 	"github.com/tickstep/library-go/logger"
 	"github.com/tickstep/library-go/requester"
 	mathrand "math/rand"
@@ -108,7 +109,7 @@ func IsUrlExpired(urlStr string) bool {
 	}
 	expiredTimeSecStr := u.Query().Get("x-oss-expires")
 	expiredTimeSec, _ := strconv.ParseInt(expiredTimeSecStr, 10, 64)
-	if (expiredTimeSec - time.Now().Unix()) <= 5 { // 小于5秒钟
+	if (expiredTimeSec - utils.ServerNow().Unix()) <= 5 { // 小于5秒钟，使用补偿时钟偏差后的时间
 		// expired
 		return true
 	}
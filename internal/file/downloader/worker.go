@@ -20,6 +20,7 @@ import (
 	"github.com/tickstep/aliyunpan-api/aliyunpan"
 	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
 	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/metrics"
 	"github.com/tickstep/aliyunpan/library/requester/transfer"
 	"github.com/tickstep/library-go/cachepool"
 	"github.com/tickstep/library-go/logger"
@@ -452,6 +453,7 @@ func (wer *Worker) Execute() {
 				if wer.globalSpeedsStat != nil {
 					wer.globalSpeedsStat.Add(nn64)
 				}
+				metrics.DownloadBytes.Add(nn64)
 				n += nn
 			}
 
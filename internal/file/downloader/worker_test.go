@@ -0,0 +1,78 @@
+package downloader
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan_open"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/file/faultinject"
+	"github.com/tickstep/aliyunpan/library/requester/transfer"
+)
+
+// memWriterAt 内存中的下载文件
+type memWriterAt struct {
+	data []byte
+}
+
+func (m *memWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	return copy(m.data[off:], p), nil
+}
+
+// TestWorkerFaultInjectResume 开启错误注入后，下载失败的分片从已下载的位置继续下载，最终数据完整
+func TestWorkerFaultInjectResume(t *testing.T) {
+	data := make([]byte, 512*1024)
+	rand.New(rand.NewSource(1)).Read(data)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "data.bin", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	injector := faultinject.Enable(faultinject.Config{FailRate: 0.2, TooManyRequestsRate: 0.1, InterruptRate: 0.3, Seed: 1})
+	defer faultinject.Disable()
+
+	writer := &memWriterAt{data: make([]byte, len(data))}
+	durl := fmt.Sprintf("%s/data.bin?x-oss-expires=%d", server.URL, time.Now().Add(time.Hour).Unix())
+	worker := NewWorker(0, "drive", "file", durl, writer, nil)
+	worker.SetClient(config.Config.TransferHTTPClient())
+	worker.SetPanClient(config.NewPanClient(nil, &aliyunpan_open.OpenPanClient{}))
+	worker.SetWriteMutex(&sync.Mutex{})
+	worker.SetTotalSize(int64(len(data)))
+	worker.SetAcceptRange("bytes")
+
+	// 按分片依次下载，每个分片失败后重新执行，从已下载的位置继续
+	const blockSize = 32 * 1024
+	resumed, retry := 0, 0
+	for begin := int64(0); begin < int64(len(data)); begin += blockSize {
+		worker.SetRange(&transfer.Range{Begin: begin, End: begin + blockSize})
+		for {
+			if retry++; retry > 500 {
+				t.Fatalf("too many retries, stats: %s", injector.Stats())
+			}
+			worker.Execute()
+			if worker.GetStatus().StatusCode() == StatusCodeSuccessed {
+				break
+			}
+			if worker.GetRange().Begin > begin {
+				resumed++
+			}
+		}
+	}
+
+	stats := injector.Stats()
+	if stats.Failed == 0 || stats.TooManyRequests == 0 || stats.Interrupted == 0 {
+		t.Fatalf("faults not injected: %s", stats)
+	}
+	if resumed == 0 {
+		t.Fatal("download should resume from the interrupted offset")
+	}
+	if !bytes.Equal(writer.data, data) {
+		t.Fatal("downloaded data mismatch")
+	}
+}
@@ -17,6 +17,10 @@ import (
 	"io"
 	"os"
 	"runtime"
+	"sort"
+
+	"github.com/tickstep/aliyunpan/internal/localfile"
+	"github.com/tickstep/aliyunpan/library/requester/transfer"
 )
 
 type (
@@ -29,6 +33,12 @@ type (
 	Writer interface {
 		io.WriterAt
 	}
+
+	// streamSha1Writer 写入数据的同时流式计算SHA1
+	streamSha1Writer struct {
+		writer     Writer
+		streamSha1 *localfile.StreamSha1
+	}
 )
 
 // NewDownloaderWriterByFilename 创建下载器数据输出接口, 类似于os.OpenFile
@@ -44,3 +54,32 @@ func NewDownloaderWriterByFilename(name string, flag int, perm os.FileMode) (wri
 	writer = file
 	return
 }
+
+func (w *streamSha1Writer) WriteAt(p []byte, off int64) (n int, err error) {
+	n, err = w.writer.WriteAt(p, off)
+	if n > 0 {
+		w.streamSha1.Written(p[:n], off)
+	}
+	return
+}
+
+// markDownloadedRanges 断点续传时，未下载的Range以外的数据都已经下载
+func markDownloadedRanges(streamSha1 *localfile.StreamSha1, ranges transfer.RangeList, totalSize int64) {
+	pending := make([]*transfer.Range, 0, len(ranges))
+	for _, r := range ranges {
+		if r != nil && r.LoadBegin() < r.LoadEnd() {
+			pending = append(pending, &transfer.Range{Begin: r.LoadBegin(), End: r.LoadEnd()})
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].Begin < pending[j].Begin
+	})
+	var offset int64
+	for _, r := range pending {
+		streamSha1.MarkWritten(offset, r.Begin)
+		if r.End > offset {
+			offset = r.End
+		}
+	}
+	streamSha1.MarkWritten(offset, totalSize)
+}
@@ -0,0 +1,302 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package faultinject 上传、下载的错误注入，用于验证断点续传以及重试逻辑
+package faultinject
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// EnvFaultInject 错误注入配置环境变量
+	EnvFaultInject = "ALIYUNPAN_FAULT_INJECT"
+
+	faultNone fault = iota
+	faultFail
+	faultTooManyRequests
+	faultInterrupt
+
+	tooManyRequestsBody = `<?xml version="1.0" encoding="UTF-8"?>
+<Error><Code>TooManyRequests</Code><Message>fault-inject: too many requests</Message></Error>`
+)
+
+var (
+	// ErrInjectedFailure 注入的请求失败
+	ErrInjectedFailure = errors.New("fault-inject: 模拟请求失败")
+	// ErrInjectedInterrupt 注入的连接中断
+	ErrInjectedInterrupt = errors.New("fault-inject: 模拟连接中断")
+
+	defaultInjector      *Injector
+	defaultInjectorMutex sync.RWMutex
+)
+
+type (
+	fault int
+
+	// Config 错误注入配置，各项为每个请求触发的概率，取值0-1
+	Config struct {
+		FailRate            float64 // 请求直接失败，模拟分片传输失败
+		TooManyRequestsRate float64 // 返回429 Too Many Requests，模拟被限流
+		InterruptRate       float64 // 传输到一半断开连接
+		Seed                int64   // 随机种子，相同的种子复现相同的错误序列
+	}
+
+	// Stats 错误注入统计
+	Stats struct {
+		Requests        int64 // 请求总数
+		Failed          int64 // 注入请求失败的次数
+		TooManyRequests int64 // 注入429的次数
+		Interrupted     int64 // 注入连接中断的次数
+	}
+
+	// Injector 按配置随机注入错误
+	Injector struct {
+		config Config
+		rand   *rand.Rand
+		stats  Stats
+		mutex  sync.Mutex
+	}
+
+	transport struct {
+		base     http.RoundTripper
+		injector *Injector
+	}
+
+	// interruptReader 读取指定长度后返回连接中断错误
+	interruptReader struct {
+		rc     io.ReadCloser
+		remain int64
+	}
+)
+
+// ParseConfig 解析错误注入配置，格式: fail=0.1,429=0.05,interrupt=0.05,seed=1
+// 只指定一个数字时，三种错误都使用该概率
+func ParseConfig(spec string) (*Config, error) {
+	cfg := &Config{}
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, fmt.Errorf("错误注入配置为空")
+	}
+	if rate, err := strconv.ParseFloat(spec, 64); err == nil {
+		cfg.FailRate, cfg.TooManyRequestsRate, cfg.InterruptRate = rate, rate, rate
+		return cfg, cfg.validate()
+	}
+	for _, item := range strings.Split(spec, ",") {
+		kv := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("错误注入配置格式错误: %s", item)
+		}
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		if key == "seed" {
+			seed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("随机种子格式错误: %s", value)
+			}
+			cfg.Seed = seed
+			continue
+		}
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("错误注入概率格式错误: %s", item)
+		}
+		switch key {
+		case "fail":
+			cfg.FailRate = rate
+		case "429":
+			cfg.TooManyRequestsRate = rate
+		case "interrupt":
+			cfg.InterruptRate = rate
+		default:
+			return nil, fmt.Errorf("不支持的错误注入类型: %s", key)
+		}
+	}
+	return cfg, cfg.validate()
+}
+
+func (c *Config) validate() error {
+	for _, rate := range []float64{c.FailRate, c.TooManyRequestsRate, c.InterruptRate} {
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("错误注入概率需要在0-1之间")
+		}
+	}
+	if c.FailRate+c.TooManyRequestsRate+c.InterruptRate > 1 {
+		return fmt.Errorf("错误注入概率之和不能大于1")
+	}
+	return nil
+}
+
+func (c Config) String() string {
+	return fmt.Sprintf("fail=%g,429=%g,interrupt=%g,seed=%d", c.FailRate, c.TooManyRequestsRate, c.InterruptRate, c.Seed)
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("请求 %d 次, 模拟失败 %d 次, 模拟429 %d 次, 模拟中断 %d 次", s.Requests, s.Failed, s.TooManyRequests, s.Interrupted)
+}
+
+// NewInjector 创建错误注入，没有指定随机种子时使用当前时间
+func NewInjector(cfg Config) *Injector {
+	if cfg.Seed == 0 {
+		cfg.Seed = time.Now().UnixNano()
+	}
+	return &Injector{
+		config: cfg,
+		rand:   rand.New(rand.NewSource(cfg.Seed)),
+	}
+}
+
+// Config 错误注入配置
+func (in *Injector) Config() Config {
+	return in.config
+}
+
+// Stats 错误注入统计
+func (in *Injector) Stats() Stats {
+	in.mutex.Lock()
+	defer in.mutex.Unlock()
+	return in.stats
+}
+
+// Wrap 包装 http.RoundTripper，经过的请求按配置随机注入错误
+func (in *Injector) Wrap(base http.RoundTripper) http.RoundTripper {
+	if in == nil {
+		return base
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{base: base, injector: in}
+}
+
+// next 决定下一个请求注入的错误
+func (in *Injector) next() fault {
+	in.mutex.Lock()
+	defer in.mutex.Unlock()
+	in.stats.Requests++
+	r := in.rand.Float64()
+	switch {
+	case r < in.config.FailRate:
+		in.stats.Failed++
+		return faultFail
+	case r < in.config.FailRate+in.config.TooManyRequestsRate:
+		in.stats.TooManyRequests++
+		return faultTooManyRequests
+	case r < in.config.FailRate+in.config.TooManyRequestsRate+in.config.InterruptRate:
+		in.stats.Interrupted++
+		return faultInterrupt
+	}
+	return faultNone
+}
+
+// Enable 开启全局错误注入，上传、下载的传输客户端会使用该配置
+func Enable(cfg Config) *Injector {
+	in := NewInjector(cfg)
+	defaultInjectorMutex.Lock()
+	defer defaultInjectorMutex.Unlock()
+	defaultInjector = in
+	return in
+}
+
+// Disable 关闭全局错误注入
+func Disable() {
+	defaultInjectorMutex.Lock()
+	defer defaultInjectorMutex.Unlock()
+	defaultInjector = nil
+}
+
+// Default 全局错误注入，没有开启时返回nil
+func Default() *Injector {
+	defaultInjectorMutex.RLock()
+	defer defaultInjectorMutex.RUnlock()
+	return defaultInjector
+}
+
+// Wrap 使用全局错误注入包装 http.RoundTripper，没有开启时直接返回base
+func Wrap(base http.RoundTripper) http.RoundTripper {
+	return Default().Wrap(base)
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch t.injector.next() {
+	case faultFail:
+		closeBody(req)
+		return nil, ErrInjectedFailure
+	case faultTooManyRequests:
+		closeBody(req)
+		return &http.Response{
+			Status:     "429 Too Many Requests",
+			StatusCode: http.StatusTooManyRequests,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header: http.Header{
+				"Content-Type":   {"application/xml"},
+				"Content-Length": {strconv.Itoa(len(tooManyRequestsBody))},
+				"Retry-After":    {"1"},
+			},
+			Body:          io.NopCloser(strings.NewReader(tooManyRequestsBody)),
+			ContentLength: int64(len(tooManyRequestsBody)),
+			Request:       req,
+		}, nil
+	case faultInterrupt:
+		if req.Body != nil && req.Body != http.NoBody {
+			// 上传请求，发送一半数据后中断
+			req = req.Clone(req.Context())
+			req.Body = &interruptReader{rc: req.Body, remain: req.ContentLength / 2}
+			return t.base.RoundTrip(req)
+		}
+		// 下载请求，接收一半数据后中断
+		resp, err := t.base.RoundTrip(req)
+		if err != nil {
+			return resp, err
+		}
+		resp.Body = &interruptReader{rc: resp.Body, remain: resp.ContentLength / 2}
+		return resp, nil
+	}
+	return t.base.RoundTrip(req)
+}
+
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+func (r *interruptReader) Read(p []byte) (int, error) {
+	if r.remain <= 0 {
+		return 0, ErrInjectedInterrupt
+	}
+	if int64(len(p)) > r.remain {
+		p = p[:r.remain]
+	}
+	n, err := r.rc.Read(p)
+	r.remain -= int64(n)
+	if err == io.EOF {
+		// 数据比预期的少，仍然按中断处理
+		err = ErrInjectedInterrupt
+	}
+	return n, err
+}
+
+func (r *interruptReader) Close() error {
+	return r.rc.Close()
+}
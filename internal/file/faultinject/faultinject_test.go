@@ -0,0 +1,87 @@
+package faultinject
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := ParseConfig("fail=0.1, 429=0.2,interrupt=0.3,seed=7")
+	if err != nil || cfg.FailRate != 0.1 || cfg.TooManyRequestsRate != 0.2 || cfg.InterruptRate != 0.3 || cfg.Seed != 7 {
+		t.Errorf("unexpected config: %+v %v", cfg, err)
+	}
+	if cfg, err = ParseConfig("0.2"); err != nil || cfg.FailRate != 0.2 || cfg.InterruptRate != 0.2 {
+		t.Errorf("unexpected config: %+v %v", cfg, err)
+	}
+	for _, spec := range []string{"", "fail", "fail=2", "fail=0.5,429=0.6", "drop=0.1", "seed=a"} {
+		if _, err = ParseConfig(spec); err == nil {
+			t.Errorf("spec %q should be invalid", spec)
+		}
+	}
+}
+
+// TestResumeDownload 模拟分片断点续传：每次请求从已接收的位置继续下载一个分片，注入错误后数据仍然完整
+func TestResumeDownload(t *testing.T) {
+	data := make([]byte, 256*1024)
+	rand.New(rand.NewSource(1)).Read(data)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "data.bin", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	injector := NewInjector(Config{FailRate: 0.2, TooManyRequestsRate: 0.2, InterruptRate: 0.3, Seed: 1})
+	client := &http.Client{Transport: injector.Wrap(http.DefaultTransport)}
+	received := &bytes.Buffer{}
+	for retry := 0; received.Len() < len(data); retry++ {
+		if retry > 500 {
+			t.Fatalf("too many retries, received %d bytes", received.Len())
+		}
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		end := received.Len() + 16*1024
+		if end > len(data) {
+			end = len(data)
+		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", received.Len(), end-1))
+		resp, err := client.Do(req)
+		if err != nil {
+			continue
+		}
+		if resp.StatusCode == http.StatusPartialContent {
+			io.Copy(received, resp.Body)
+		}
+		resp.Body.Close()
+	}
+	if !bytes.Equal(received.Bytes(), data) {
+		t.Error("resumed data mismatch")
+	}
+	stats := injector.Stats()
+	if stats.Failed == 0 || stats.TooManyRequests == 0 || stats.Interrupted == 0 {
+		t.Errorf("expected all kinds of faults, got %s", stats)
+	}
+}
+
+// TestInterruptUpload 上传请求中途中断，服务端不会收到完整的数据
+func TestInterruptUpload(t *testing.T) {
+	var got int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got = len(b)
+	}))
+	defer server.Close()
+
+	injector := NewInjector(Config{InterruptRate: 1, Seed: 1})
+	client := &http.Client{Transport: injector.Wrap(http.DefaultTransport)}
+	body := bytes.Repeat([]byte("a"), 1024)
+	if _, err := client.Post(server.URL, "application/octet-stream", bytes.NewReader(body)); err == nil {
+		t.Error("interrupted upload should fail")
+	}
+	if got == len(body) {
+		t.Error("server should not receive the whole body")
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ratelimit 多个文件共享的传输限速，总速度按正在传输的文件平均分配
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// activeWindow 最近该时间内有传输数据的文件才参与分配速度
+	activeWindow = time.Second
+	// maxWait 单次等待的最长时间，等待过程中其他文件结束时可以及时获得更多的速度
+	maxWait = 200 * time.Millisecond
+)
+
+type (
+	// Limiter 限速，Add 超出限速时阻塞
+	Limiter interface {
+		Add(count int64)
+		Stop()
+	}
+
+	// SharedRateLimit 一次上传或者下载命令的总限速，使用令牌桶实现。
+	// 每个文件通过 NewUnit 获取自己的令牌桶，总速度在最近有传输数据的文件之间平均分配，避免一个大文件占满带宽
+	SharedRateLimit struct {
+		maxRate int64
+		parent  *SharedRateLimit // 上级限速，可以为nil
+		units   map[*UnitRateLimit]struct{}
+		mutex   sync.Mutex
+	}
+
+	// UnitRateLimit 单个文件的令牌桶，令牌不足时阻塞
+	UnitRateLimit struct {
+		shared     *SharedRateLimit
+		parent     *UnitRateLimit // 上级限速的令牌桶，可以为nil
+		tokens     float64
+		lastFill   time.Time
+		lastActive time.Time
+	}
+
+	// ClassRateLimits 按任务类别划分的限速，每个类别有独立的配额，所有类别共享总限速。
+	// 进程内同一类别的上传、下载共用一个配额，例如下载分享文件和备份上传互不抢带宽
+	ClassRateLimits struct {
+		total   *SharedRateLimit
+		classes map[string]*SharedRateLimit
+	}
+
+	// chainLimiter 同时使用多个限速
+	chainLimiter []Limiter
+)
+
+// NewSharedRateLimit 创建共享限速，maxRate 单位 B/s，小于等于0时返回nil，代表不限制
+func NewSharedRateLimit(maxRate int64) *SharedRateLimit {
+	if maxRate <= 0 {
+		return nil
+	}
+	return &SharedRateLimit{
+		maxRate: maxRate,
+		units:   map[*UnitRateLimit]struct{}{},
+	}
+}
+
+// NewChildRateLimit 创建受上级限速约束的共享限速，传输的数据需要同时满足自身和上级的限速。
+// maxRate 小于等于0时直接返回上级限速，上级为nil时等同于 NewSharedRateLimit
+func NewChildRateLimit(maxRate int64, parent *SharedRateLimit) *SharedRateLimit {
+	if maxRate <= 0 {
+		return parent
+	}
+	s := NewSharedRateLimit(maxRate)
+	s.parent = parent
+	return s
+}
+
+// MaxRate 总限速，单位 B/s
+func (s *SharedRateLimit) MaxRate() int64 {
+	if s == nil {
+		return 0
+	}
+	return s.maxRate
+}
+
+// NewUnit 为一个文件创建令牌桶，传输结束后需要调用 Stop 释放分配的速度。s 为nil时返回nil
+func (s *SharedRateLimit) NewUnit() *UnitRateLimit {
+	if s == nil {
+		return nil
+	}
+	now := time.Now()
+	u := &UnitRateLimit{
+		shared:     s,
+		parent:     s.parent.NewUnit(),
+		lastFill:   now,
+		lastActive: now,
+	}
+	s.mutex.Lock()
+	s.units[u] = struct{}{}
+	s.mutex.Unlock()
+	return u
+}
+
+// shareLocked 每个活跃文件分配的速度，调用前需要加锁
+func (s *SharedRateLimit) shareLocked(now time.Time) float64 {
+	active := 0
+	for u := range s.units {
+		if now.Sub(u.lastActive) < activeWindow {
+			active++
+		}
+	}
+	if active == 0 {
+		active = 1
+	}
+	return float64(s.maxRate) / float64(active)
+}
+
+// Add 记录传输的数据量，令牌不足时阻塞到补充足够的令牌
+func (u *UnitRateLimit) Add(count int64) {
+	s := u.shared
+	for {
+		s.mutex.Lock()
+		now := time.Now()
+		u.lastActive = now
+		share := s.shareLocked(now)
+		u.tokens += share * now.Sub(u.lastFill).Seconds()
+		u.lastFill = now
+		if u.tokens > share {
+			// 最多积攒1秒的令牌
+			u.tokens = share
+		}
+		if u.tokens >= 0 {
+			// 允许透支，透支的部分由后续的等待补偿
+			u.tokens -= float64(count)
+			s.mutex.Unlock()
+			if u.parent != nil {
+				u.parent.Add(count)
+			}
+			return
+		}
+		wait := time.Duration(-u.tokens / share * float64(time.Second))
+		s.mutex.Unlock()
+		if wait > maxWait {
+			wait = maxWait
+		}
+		time.Sleep(wait)
+	}
+}
+
+// Stop 文件传输结束，释放分配的速度
+func (u *UnitRateLimit) Stop() {
+	u.shared.mutex.Lock()
+	delete(u.shared.units, u)
+	u.shared.mutex.Unlock()
+	if u.parent != nil {
+		u.parent.Stop()
+	}
+}
+
+// NewClassRateLimits 创建按任务类别划分的限速，total 为总限速，rates 为各类别的限速，单位 B/s，0代表不限制
+func NewClassRateLimits(total int64, rates map[string]int64) *ClassRateLimits {
+	c := &ClassRateLimits{
+		total:   NewSharedRateLimit(total),
+		classes: map[string]*SharedRateLimit{},
+	}
+	for class, rate := range rates {
+		if rate > 0 {
+			c.classes[class] = NewChildRateLimit(rate, c.total)
+		}
+	}
+	return c
+}
+
+// Get 获取任务类别的限速，没有单独配置的类别只受总限速约束，都没有配置时返回nil
+func (c *ClassRateLimits) Get(class string) *SharedRateLimit {
+	if c == nil {
+		return nil
+	}
+	if s, ok := c.classes[class]; ok {
+		return s
+	}
+	return c.total
+}
+
+// Chain 组合多个限速，传输的数据需要同时满足所有限速，忽略nil。没有有效的限速时返回nil
+func Chain(limiters ...Limiter) Limiter {
+	chain := chainLimiter{}
+	for _, l := range limiters {
+		if l != nil {
+			chain = append(chain, l)
+		}
+	}
+	switch len(chain) {
+	case 0:
+		return nil
+	case 1:
+		return chain[0]
+	}
+	return chain
+}
+
+func (c chainLimiter) Add(count int64) {
+	for _, l := range c {
+		l.Add(count)
+	}
+}
+
+func (c chainLimiter) Stop() {
+	for _, l := range c {
+		l.Stop()
+	}
+}
@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestSharedRateLimitFair 两个文件同时传输，总速度不超过限速，并且平均分配
+func TestSharedRateLimitFair(t *testing.T) {
+	const rate = 200 * 1024
+	shared := NewSharedRateLimit(rate)
+	counts := make([]int64, 2)
+	deadline := time.Now().Add(time.Second)
+	wg := sync.WaitGroup{}
+	for i := range counts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			unit := shared.NewUnit()
+			defer unit.Stop()
+			for time.Now().Before(deadline) {
+				unit.Add(4 * 1024)
+				counts[i] += 4 * 1024
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	total := counts[0] + counts[1]
+	// 每个文件最多积攒1秒的令牌，允许超出一倍
+	if total > 2*rate+16*1024 {
+		t.Errorf("total %d exceeds rate %d", total, rate)
+	}
+	if counts[0] < counts[1]/2 || counts[1] < counts[0]/2 {
+		t.Errorf("unfair share: %v", counts)
+	}
+	if len(shared.units) != 0 {
+		t.Errorf("units should be released, got %d", len(shared.units))
+	}
+}
+
+func TestChain(t *testing.T) {
+	if NewSharedRateLimit(0) != nil {
+		t.Error("zero rate should be unlimited")
+	}
+	if Chain(nil, nil) != nil {
+		t.Error("chain of nil should be nil")
+	}
+	unit := NewSharedRateLimit(1024).NewUnit()
+	if Chain(nil, unit) != Limiter(unit) {
+		t.Error("chain of single limiter should return itself")
+	}
+}
+
+// TestClassRateLimits 各类别的限速都受总限速约束，没有配置的类别只受总限速约束
+func TestClassRateLimits(t *testing.T) {
+	c := NewClassRateLimits(4096, map[string]int64{"share": 1024, "backup": 0})
+	share := c.Get("share")
+	if share.MaxRate() != 1024 || share.parent != c.Get("upload") || c.Get("backup").MaxRate() != 4096 {
+		t.Errorf("unexpected class rate limits: %d %d", share.MaxRate(), c.Get("backup").MaxRate())
+	}
+	unit := NewChildRateLimit(512, share).NewUnit()
+	if unit.parent == nil || unit.parent.parent == nil {
+		t.Fatal("unit should be limited by class and total rate")
+	}
+	unit.Add(100)
+	unit.Stop()
+	if len(share.units) != 0 || len(c.total.units) != 0 {
+		t.Error("parent units should be released")
+	}
+	if NewClassRateLimits(0, nil).Get("share") != nil {
+		t.Error("no rate configured should be unlimited")
+	}
+}
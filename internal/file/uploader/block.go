@@ -16,6 +16,8 @@ package uploader
 import (
 	"bufio"
 	"fmt"
+	"github.com/tickstep/aliyunpan/internal/file/ratelimit"
+	"github.com/tickstep/aliyunpan/internal/metrics"
 	"github.com/tickstep/aliyunpan/library/requester/transfer"
 	"github.com/tickstep/library-go/requester/rio/speeds"
 	"io"
@@ -39,7 +41,7 @@ type (
 		readerAt            io.ReaderAt
 		speedsStatRef       *speeds.Speeds
 		globalSpeedsStatRef *speeds.Speeds
-		rateLimit           *speeds.RateLimit
+		rateLimit           ratelimit.Limiter
 		mu                  sync.Mutex
 	}
 
@@ -65,7 +67,7 @@ func SplitBlock(fileSize, blockSize int64) (blockList []*BlockState) {
 }
 
 // NewBufioSplitUnit io.ReaderAt实现SplitUnit接口, 有Buffer支持
-func NewBufioSplitUnit(readerAt io.ReaderAt, readRange transfer.Range, speedsStat *speeds.Speeds, rateLimit *speeds.RateLimit, globalSpeedsStat *speeds.Speeds) SplitUnit {
+func NewBufioSplitUnit(readerAt io.ReaderAt, readRange transfer.Range, speedsStat *speeds.Speeds, rateLimit ratelimit.Limiter, globalSpeedsStat *speeds.Speeds) SplitUnit {
 	su := &fileBlock{
 		readerAt:            readerAt,
 		readRange:           readRange,
@@ -110,6 +112,7 @@ func (fb *fileBlock) Read(b []byte) (n int, err error) {
 	if fb.globalSpeedsStatRef != nil {
 		fb.globalSpeedsStatRef.Add(n64)
 	}
+	metrics.UploadBytes.Add(n64)
 	return
 }
 
@@ -13,7 +13,11 @@
 // limitations under the License.
 package uploader
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/tickstep/aliyunpan/library/requester/transfer"
+)
 
 var (
 	UploadUrlExpired       = fmt.Errorf("UrlExpired")
@@ -32,6 +36,14 @@ type (
 		Terminated    bool
 		NeedStartOver bool // 是否从头开始上传
 	}
+
+	// BadBlockError 同一个分片失败次数达到阈值，可能是源文件所在磁盘有坏块
+	BadBlockError struct {
+		ID        int            // 分片ID，从0开始计数
+		Range     transfer.Range // 分片在文件中的偏移
+		FailCount int            // 失败次数
+		Err       error          // 最后一次失败的错误
+	}
 )
 
 func (me *MultiError) Error() string {
@@ -40,3 +52,15 @@ func (me *MultiError) Error() string {
 	}
 	return ""
 }
+
+func (be *BadBlockError) Error() string {
+	msg := fmt.Sprintf("分片%d(偏移 %d-%d)已失败%d次", be.ID+1, be.Range.Begin, be.Range.End, be.FailCount)
+	if be.Err != nil && be.Err.Error() != "" {
+		msg += ": " + be.Err.Error()
+	}
+	return msg
+}
+
+func (be *BadBlockError) Unwrap() error {
+	return be.Err
+}
@@ -23,6 +23,10 @@ type (
 		ID         int            `json:"id"`
 		Range      transfer.Range `json:"range"`
 		UploadDone bool           `json:"upload_done"`
+		// FailCount 分片上传失败次数，任务重试时累加
+		FailCount int `json:"fail_count,omitempty"`
+		// Bad 失败次数超过阈值的问题分片，可能是源文件所在磁盘有坏块
+		Bad bool `json:"bad,omitempty"`
 	}
 
 	// InstanceState 上传断点续传信息
@@ -31,6 +35,34 @@ type (
 	}
 )
 
+// DoneSize 已经上传完成的分片大小
+func (is *InstanceState) DoneSize() int64 {
+	if is == nil {
+		return 0
+	}
+	var size int64
+	for _, blockState := range is.BlockList {
+		if blockState.UploadDone {
+			size += blockState.Range.Len()
+		}
+	}
+	return size
+}
+
+// BadBlocks 失败次数超过阈值的问题分片
+func (is *InstanceState) BadBlocks() []*BlockState {
+	if is == nil {
+		return nil
+	}
+	var blocks []*BlockState
+	for _, blockState := range is.BlockList {
+		if blockState.Bad {
+			blocks = append(blocks, blockState)
+		}
+	}
+	return blocks
+}
+
 func (muer *MultiUploader) getWorkerListByInstanceState(is *InstanceState) workerList {
 	workers := make(workerList, 0, len(is.BlockList))
 	for _, blockState := range is.BlockList {
@@ -40,6 +72,7 @@ func (muer *MultiUploader) getWorkerListByInstanceState(is *InstanceState) worke
 				partOffset: blockState.Range.Begin,
 				splitUnit:  NewBufioSplitUnit(muer.file, blockState.Range, muer.speedsStat, muer.rateLimit, muer.globalSpeedsStat),
 				uploadDone: false,
+				failCount:  blockState.FailCount,
 			})
 		} else {
 			// 已经完成的, 也要加入
@@ -17,6 +17,7 @@ import (
 	"context"
 	"github.com/tickstep/aliyunpan-api/aliyunpan"
 	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/file/ratelimit"
 	"github.com/tickstep/aliyunpan/internal/utils"
 	"github.com/tickstep/library-go/converter"
 	"github.com/tickstep/library-go/logger"
@@ -51,7 +52,7 @@ type (
 		config           *MultiUploaderConfig
 		workers          workerList
 		speedsStat       *speeds.Speeds
-		rateLimit        *speeds.RateLimit
+		rateLimit        ratelimit.Limiter
 		globalSpeedsStat *speeds.Speeds // 全局速度统计
 
 		executeTime             time.Time
@@ -70,6 +71,12 @@ type (
 		Parallel  int   // 上传并发量
 		BlockSize int64 // 上传分块
 		MaxRate   int64 // 限制最大上传速度
+		// RateFunc 按时间动态限速，返回指定时间的限速值，0代表不限制。不为nil时忽略MaxRate
+		RateFunc func(t time.Time) int64
+		// SharedRateLimit 本次上传所有文件共享的限速，和单文件限速同时生效，可以为nil
+		SharedRateLimit *ratelimit.SharedRateLimit
+		// BadBlockThreshold 同一个分片失败次数达到阈值时标记为问题分片并停止上传，0代表不限制
+		BadBlockThreshold int
 	}
 )
 
@@ -131,9 +138,17 @@ func (muer *MultiUploader) Execute() error {
 	muer.check()
 	muer.lazyInit()
 
-	// 初始化限速
-	if muer.config.MaxRate > 0 {
-		muer.rateLimit = speeds.NewRateLimit(muer.config.MaxRate)
+	// 初始化限速，单文件限速和任务共享限速同时生效
+	var fileRateLimit, taskRateLimit ratelimit.Limiter
+	if muer.config.RateFunc != nil {
+		fileRateLimit = NewScheduleRateLimit(muer.config.RateFunc)
+	} else if muer.config.MaxRate > 0 {
+		fileRateLimit = speeds.NewRateLimit(muer.config.MaxRate)
+	}
+	if muer.config.SharedRateLimit != nil {
+		taskRateLimit = muer.config.SharedRateLimit.NewUnit()
+	}
+	if muer.rateLimit = ratelimit.Chain(fileRateLimit, taskRateLimit); muer.rateLimit != nil {
 		defer muer.rateLimit.Stop()
 	}
 
@@ -186,6 +201,8 @@ func (muer *MultiUploader) InstanceState() *InstanceState {
 			ID:         wer.id,
 			Range:      wer.splitUnit.Range(),
 			UploadDone: wer.uploadDone,
+			FailCount:  wer.failCount,
+			Bad:        muer.config.BadBlockThreshold > 0 && wer.failCount >= muer.config.BadBlockThreshold,
 		})
 	}
 	return &InstanceState{
@@ -195,7 +212,9 @@ func (muer *MultiUploader) InstanceState() *InstanceState {
 
 // Cancel 取消上传
 func (muer *MultiUploader) Cancel() {
-	close(muer.canceled)
+	muer.closeCanceledOnce.Do(func() { // 只关闭一次
+		close(muer.canceled)
+	})
 }
 
 // OnExecute 设置开始上传事件
@@ -0,0 +1,194 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package uploader_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan/internal/file/uploader"
+	"github.com/tickstep/library-go/requester"
+	"github.com/tickstep/library-go/requester/rio"
+)
+
+// failPartUpload 指定分片总是上传失败
+type failPartUpload struct {
+	failPart int
+}
+
+func (f *failPartUpload) Precreate() error {
+	return nil
+}
+
+func (f *failPartUpload) UploadFile(ctx context.Context, partseq int, partOffset int64, partEnd int64, readerlen64 rio.ReaderLen64, uploadClient *requester.HTTPClient) (bool, error) {
+	if partseq == f.failPart {
+		return false, errors.New("read error")
+	}
+	return true, nil
+}
+
+func (f *failPartUpload) CommitFile() error {
+	return nil
+}
+
+func TestMultiUploaderBadBlock(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.Truncate(3000)
+	file := rio.NewFileReaderAtLen64(f)
+	muer := uploader.NewMultiUploader(&failPartUpload{failPart: 1}, file, &uploader.MultiUploaderConfig{
+		Parallel:          1,
+		BlockSize:         1000,
+		BadBlockThreshold: 3,
+	}, &aliyunpan.CreateFileUploadResult{}, nil, nil)
+
+	err = muer.Execute()
+	var bbe *uploader.BadBlockError
+	if !errors.As(err, &bbe) {
+		t.Fatalf("expect bad block error, got: %v", err)
+	}
+	if bbe.ID != 1 || bbe.Range.Begin != 1000 || bbe.Range.End != 2000 || bbe.FailCount != 3 {
+		t.Fatalf("unexpected bad block: %+v", bbe)
+	}
+
+	is := muer.InstanceState()
+	if !is.BlockList[0].UploadDone || is.BlockList[1].UploadDone || is.BlockList[2].UploadDone {
+		t.Fatalf("unexpected upload state: %+v", is.BlockList)
+	}
+	bad := is.BadBlocks()
+	if len(bad) != 1 || bad[0].ID != 1 || bad[0].FailCount != 3 {
+		t.Fatalf("unexpected bad blocks: %+v", bad)
+	}
+
+	// 断点续传时失败次数继续累加
+	resume := uploader.NewMultiUploader(&failPartUpload{failPart: 1}, file, &uploader.MultiUploaderConfig{
+		Parallel:          1,
+		BlockSize:         1000,
+		BadBlockThreshold: 5,
+	}, &aliyunpan.CreateFileUploadResult{}, nil, nil)
+	resume.SetInstanceState(is)
+	err = resume.Execute()
+	if !errors.As(err, &bbe) || bbe.FailCount != 5 {
+		t.Fatalf("expect fail count accumulated, got: %v", err)
+	}
+}
+
+// notSeqPartUpload 指定分片第一次上传时返回分片乱序错误
+type notSeqPartUpload struct {
+	notSeqPart int
+	uploaded   []int
+}
+
+func (f *notSeqPartUpload) Precreate() error {
+	return nil
+}
+
+func (f *notSeqPartUpload) UploadFile(ctx context.Context, partseq int, partOffset int64, partEnd int64, readerlen64 rio.ReaderLen64, uploadClient *requester.HTTPClient) (bool, error) {
+	if partseq == f.notSeqPart {
+		f.notSeqPart = -1
+		return false, &uploader.MultiError{Err: uploader.UploadPartNotSeq}
+	}
+	f.uploaded = append(f.uploaded, partseq)
+	return true, nil
+}
+
+func (f *notSeqPartUpload) CommitFile() error {
+	return nil
+}
+
+func TestMultiUploaderPartNotSeq(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.Truncate(4000)
+	file := rio.NewFileReaderAtLen64(f)
+	upload := &notSeqPartUpload{notSeqPart: 2}
+	muerConfig := &uploader.MultiUploaderConfig{
+		Parallel:          1,
+		BlockSize:         1000,
+		BadBlockThreshold: 1,
+	}
+	muer := uploader.NewMultiUploader(upload, file, muerConfig, &aliyunpan.CreateFileUploadResult{}, nil, nil)
+
+	// 分片乱序停止上传，不计入问题分片，已上传的分片保留在断点续传信息中
+	if err = muer.Execute(); !errors.Is(err, uploader.UploadPartNotSeq) {
+		t.Fatalf("expect part not seq error, got: %v", err)
+	}
+	is := muer.InstanceState()
+	if !is.BlockList[0].UploadDone || !is.BlockList[1].UploadDone || is.BlockList[2].UploadDone || is.BlockList[2].FailCount != 0 {
+		t.Fatalf("unexpected upload state: %+v", is.BlockList)
+	}
+
+	// 修正后继续上传，只上传剩余的分片
+	resume := uploader.NewMultiUploader(upload, file, muerConfig, &aliyunpan.CreateFileUploadResult{}, nil, nil)
+	resume.SetInstanceState(is)
+	if err = resume.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if len(upload.uploaded) != 4 || upload.uploaded[2] != 2 || upload.uploaded[3] != 3 {
+		t.Fatalf("unexpected uploaded parts: %v", upload.uploaded)
+	}
+}
+
+// blockingUpload 分片上传一直阻塞，直到上传被取消
+type blockingUpload struct {
+	started chan struct{}
+}
+
+func (b *blockingUpload) Precreate() error {
+	return nil
+}
+
+func (b *blockingUpload) UploadFile(ctx context.Context, partseq int, partOffset int64, partEnd int64, readerlen64 rio.ReaderLen64, uploadClient *requester.HTTPClient) (bool, error) {
+	close(b.started)
+	<-ctx.Done()
+	return false, ctx.Err()
+}
+
+func (b *blockingUpload) CommitFile() error {
+	return nil
+}
+
+func TestMultiUploaderCancelTwice(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.Truncate(1000)
+	upload := &blockingUpload{started: make(chan struct{})}
+	muer := uploader.NewMultiUploader(upload, rio.NewFileReaderAtLen64(f), &uploader.MultiUploaderConfig{
+		Parallel:  1,
+		BlockSize: 1000,
+	}, &aliyunpan.CreateFileUploadResult{}, nil, nil)
+
+	// 时间预算和用户中断可能同时取消上传，重复取消不会panic
+	go func() {
+		<-upload.started
+		muer.Cancel()
+		muer.Cancel()
+	}()
+	if err = muer.Execute(); err != context.Canceled {
+		t.Fatalf("expect canceled, got: %v", err)
+	}
+}
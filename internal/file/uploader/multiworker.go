@@ -17,9 +17,9 @@ import (
 	"context"
 	"errors"
 	"github.com/oleiade/lane"
+	"github.com/tickstep/aliyunpan/internal/config"
 	"github.com/tickstep/aliyunpan/internal/waitgroup"
 	"github.com/tickstep/library-go/logger"
-	"github.com/tickstep/library-go/requester"
 	"io"
 	"strconv"
 )
@@ -30,6 +30,7 @@ type (
 		partOffset int64
 		splitUnit  SplitUnit
 		uploadDone bool
+		failCount  int // 上传失败次数
 	}
 
 	workerList []*worker
@@ -70,11 +71,15 @@ func (muer *MultiUploader) upload() (uperr error) {
 	}
 
 	// 上传客户端
-	uploadClient := requester.NewHTTPClient()
+	uploadClient := config.Config.TransferHTTPClient()
 	uploadClient.SetTimeout(0)
-	uploadClient.SetKeepAlive(true)
 
 	for {
+		// 上传已经被取消或终止，不再继续发送剩余的分片，否则分片上传成功了也不会记录到断点续传信息
+		if muer.isCanceled() {
+			break
+		}
+
 		// 阿里云盘只支持分片按顺序上传，这里必须是parallel = 1
 		wg := waitgroup.NewWaitGroup(muer.config.Parallel)
 		wg.AddDelta()
@@ -115,6 +120,14 @@ func (muer *MultiUploader) upload() (uperr error) {
 			cancel()
 			if terr != nil {
 				logger.Verbosef("upload file part err: %+v\n", terr)
+				if bberr := muer.addBlockFailure(wer, terr); bberr != nil {
+					// 同一个分片反复失败，停止上传，避免无休止的重试
+					muer.closeCanceledOnce.Do(func() { // 只关闭一次
+						close(muer.canceled)
+					})
+					uperr = bberr
+					return
+				}
 				if me, ok := terr.(*MultiError); ok {
 					if me.Terminated { // 终止
 						muer.closeCanceledOnce.Do(func() { // 只关闭一次
@@ -155,6 +168,11 @@ func (muer *MultiUploader) upload() (uperr error) {
 				// 清空数据，准备重新上传
 				uploadDeque = lane.NewDeque() // 清空待上传列表
 			}
+			var bberr *BadBlockError
+			if errors.As(uperr, &bberr) {
+				// 问题分片，停止上传，保留错误信息
+				break
+			}
 		}
 		// 没有任务了
 		if uploadDeque.Size() == 0 {
@@ -162,8 +180,7 @@ func (muer *MultiUploader) upload() (uperr error) {
 		}
 	}
 
-	// 释放链路
-	uploadClient.CloseIdleConnections()
+	// 连接池为全局共享，空闲连接由连接池按超时时间释放，这里不主动关闭
 
 	// 返回错误，通知上层客户端
 	if errors.Is(uperr, UploadPartNotSeq) || errors.Is(uperr, UploadNoSuchUpload) {
@@ -197,3 +214,34 @@ func (muer *MultiUploader) upload() (uperr error) {
 
 	return
 }
+
+// isCanceled 上传是否已经被取消或终止
+func (muer *MultiUploader) isCanceled() bool {
+	select {
+	case <-muer.canceled:
+		return true
+	default:
+		return false
+	}
+}
+
+// addBlockFailure 记录分片上传失败，失败次数达到阈值时返回 BadBlockError。
+// 分片乱序、上传任务不存在是网盘端的错误，和分片数据无关，不计入失败次数
+func (muer *MultiUploader) addBlockFailure(wer *worker, terr error) *BadBlockError {
+	if errors.Is(terr, UploadPartNotSeq) || errors.Is(terr, UploadNoSuchUpload) {
+		return nil
+	}
+	if me, ok := terr.(*MultiError); ok && (errors.Is(me.Err, UploadPartNotSeq) || errors.Is(me.Err, UploadNoSuchUpload)) {
+		return nil
+	}
+	wer.failCount++
+	if muer.config.BadBlockThreshold <= 0 || wer.failCount < muer.config.BadBlockThreshold {
+		return nil
+	}
+	return &BadBlockError{
+		ID:        wer.id,
+		Range:     wer.splitUnit.Range(),
+		FailCount: wer.failCount,
+		Err:       terr,
+	}
+}
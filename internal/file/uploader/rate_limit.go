@@ -0,0 +1,61 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package uploader
+
+import (
+	"sync"
+	"time"
+)
+
+type (
+	// ScheduleRateLimit 动态限速，每次读取数据时按当前时间查询限速值，上传过程中到达时间段边界自动切换
+	ScheduleRateLimit struct {
+		rateFunc    func(t time.Time) int64
+		windowStart time.Time
+		count       int64
+		mutex       sync.Mutex
+	}
+)
+
+// NewScheduleRateLimit 创建动态限速，rateFunc 返回指定时间的限速值，单位 B/s，0代表不限制
+func NewScheduleRateLimit(rateFunc func(t time.Time) int64) *ScheduleRateLimit {
+	return &ScheduleRateLimit{
+		rateFunc: rateFunc,
+	}
+}
+
+// Add 记录读取的数据量，当前一秒内的数据量超出限速时阻塞到下一秒
+func (rl *ScheduleRateLimit) Add(count int64) {
+	for {
+		rl.mutex.Lock()
+		now := time.Now()
+		rate := rl.rateFunc(now)
+		if now.Sub(rl.windowStart) >= time.Second {
+			rl.windowStart = now
+			rl.count = 0
+		}
+		if rate <= 0 || rl.count < rate {
+			rl.count += count
+			rl.mutex.Unlock()
+			return
+		}
+		wait := time.Second - now.Sub(rl.windowStart)
+		rl.mutex.Unlock()
+		time.Sleep(wait)
+	}
+}
+
+// Stop 停止限速，没有后台任务，不需要释放资源
+func (rl *ScheduleRateLimit) Stop() {
+}
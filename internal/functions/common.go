@@ -13,7 +13,23 @@
 // limitations under the License.
 package functions
 
-import "time"
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
+	"github.com/tickstep/aliyunpan/internal/taskframework"
+)
+
+var (
+	// defaultRateLimitBackoff 没有配置限流退避策略时使用，限流时短时间内重试大概率仍然会被限流
+	defaultRateLimitBackoff = &taskframework.RetryBackoff{
+		Strategy: taskframework.BackoffJitter,
+		Base:     5 * time.Second,
+		Max:      120 * time.Second,
+	}
+)
 
 // RetryWait 失败重试等待事件
 func RetryWait(retry int) time.Duration {
@@ -22,3 +38,37 @@ func RetryWait(retry int) time.Duration {
 	}
 	return 6 * time.Second
 }
+
+// RetryErrorType 获取错误对应的重试错误类型
+func RetryErrorType(err error) string {
+	if err == nil {
+		return taskframework.RetryErrorDefault
+	}
+	var apiErr *apierror.ApiError
+	if errors.As(err, &apiErr) {
+		switch apiErr.Code {
+		case apierror.ApiCodeTooManyRequests, apierror.ApiCodeBadGateway:
+			return taskframework.RetryErrorRateLimit
+		case apierror.ApiCodeNetError:
+			return taskframework.RetryErrorNetwork
+		}
+		return taskframework.RetryErrorDefault
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return taskframework.RetryErrorNetwork
+	}
+	return taskframework.RetryErrorDefault
+}
+
+// RetryWaitWithPolicy 按照错误类型对应的退避策略计算重试等待时间，没有配置策略的使用 RetryWait
+func RetryWaitWithPolicy(retry int, err error, policy taskframework.RetryBackoffPolicy) time.Duration {
+	errType := RetryErrorType(err)
+	if b := policy.Get(errType); b != nil {
+		return b.Wait(retry)
+	}
+	if errType == taskframework.RetryErrorRateLimit {
+		return defaultRateLimitBackoff.Wait(retry)
+	}
+	return RetryWait(retry)
+}
@@ -0,0 +1,39 @@
+package pandownload
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigratePartFile(t *testing.T) {
+	root := t.TempDir()
+	p := filepath.Join(root, "a.mp4")
+
+	// 没有断点信息的文件是已经下载完成的，不能改名
+	os.WriteFile(p, []byte("done"), 0644)
+	migratePartFile(p)
+	if _, err := os.Stat(p + DownloadPartSuffix); err == nil {
+		t.Fatal("complete file should not be renamed")
+	}
+
+	// 旧版本下载到一半的文件改名为临时文件继续断点续传
+	os.WriteFile(p+DownloadSuffix, []byte("{}"), 0644)
+	migratePartFile(p)
+	if _, err := os.Stat(p); err == nil {
+		t.Fatal("old downloading file should be renamed")
+	}
+	if data, err := os.ReadFile(p + DownloadPartSuffix); err != nil || string(data) != "done" {
+		t.Fatalf("part file: %q %v", data, err)
+	}
+
+	// 已经存在临时文件时保留临时文件，不覆盖
+	os.WriteFile(p, []byte("other"), 0644)
+	migratePartFile(p)
+	if data, _ := os.ReadFile(p + DownloadPartSuffix); string(data) != "done" {
+		t.Fatalf("part file should be kept: %q", data)
+	}
+	if _, err := os.Stat(p); err != nil {
+		t.Fatal("target file should be untouched")
+	}
+}
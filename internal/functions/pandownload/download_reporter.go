@@ -0,0 +1,184 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pandownload
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/tickstep/library-go/converter"
+	"github.com/tickstep/library-go/logger"
+)
+
+type (
+	// DownloadEventType 下载事件类型
+	DownloadEventType string
+
+	// DownloadProgress 下载进度
+	DownloadProgress struct {
+		Downloaded  int64 `json:"downloaded"`  // 已下载的字节数
+		TotalSize   int64 `json:"totalSize"`   // 文件大小
+		Speed       int64 `json:"speed"`       // 当前文件下载速度，单位 B/s
+		GlobalSpeed int64 `json:"globalSpeed"` // 所有文件的总下载速度，单位 B/s
+		Elapsed     int64 `json:"elapsed"`     // 已用时间，单位秒
+		Left        int64 `json:"left"`        // 预计剩余时间，单位秒，-1代表未知
+	}
+
+	// DownloadEvent 下载任务单元上报的事件
+	DownloadEvent struct {
+		Type      DownloadEventType `json:"type"`
+		TaskId    string            `json:"taskId"`
+		Time      time.Time         `json:"time"`
+		PanPath   string            `json:"panPath,omitempty"`
+		LocalPath string            `json:"localPath,omitempty"`
+		Message   string            `json:"message,omitempty"`
+		Error     string            `json:"error,omitempty"`
+		Retry     int               `json:"retry,omitempty"`
+		MaxRetry  int               `json:"maxRetry,omitempty"`
+		Progress  *DownloadProgress `json:"progress,omitempty"`
+	}
+
+	// DownloadReporter 下载状态上报接口，任务单元的进度、结果和错误信息都通过该接口输出，
+	// 可以替换为其他实现，例如GUI前端。Report 会被多个任务单元并发调用
+	DownloadReporter interface {
+		Report(event *DownloadEvent)
+	}
+
+	// CliDownloadReporter 命令行输出
+	CliDownloadReporter struct {
+		w            io.Writer
+		showProgress bool
+		progressing  bool // 上一次输出的是进度，没有换行
+		mutex        sync.Mutex
+	}
+
+	// JsonDownloadReporter JSON事件流输出，每个事件一行JSON
+	JsonDownloadReporter struct {
+		encoder *json.Encoder
+		mutex   sync.Mutex
+	}
+)
+
+const (
+	// DownloadEventPrepare 准备下载
+	DownloadEventPrepare DownloadEventType = "prepare"
+	// DownloadEventFile 文件详情
+	DownloadEventFile DownloadEventType = "file"
+	// DownloadEventQueue 目录下的文件加入下载队列
+	DownloadEventQueue DownloadEventType = "queue"
+	// DownloadEventInfo 下载过程中的提示信息
+	DownloadEventInfo DownloadEventType = "info"
+	// DownloadEventProgress 下载进度，Message 为各个下载线程的状态表格，只有开启 --status 时有值
+	DownloadEventProgress DownloadEventType = "progress"
+	// DownloadEventSuccess 下载成功
+	DownloadEventSuccess DownloadEventType = "success"
+	// DownloadEventSkip 跳过下载，例如本地已存在同名文件、排除的文件
+	DownloadEventSkip DownloadEventType = "skip"
+	// DownloadEventError 下载出错
+	DownloadEventError DownloadEventType = "error"
+	// DownloadEventRetry 下载出错，等待重试
+	DownloadEventRetry DownloadEventType = "retry"
+	// DownloadEventPause 下载已暂停
+	DownloadEventPause DownloadEventType = "pause"
+	// DownloadEventResume 下载已恢复
+	DownloadEventResume DownloadEventType = "resume"
+	// DownloadEventCancel 下载已中止
+	DownloadEventCancel DownloadEventType = "cancel"
+)
+
+// NewCliDownloadReporter 创建命令行输出，showProgress 为false时不输出下载进度
+func NewCliDownloadReporter(w io.Writer, showProgress bool) *CliDownloadReporter {
+	return &CliDownloadReporter{
+		w:            w,
+		showProgress: showProgress,
+	}
+}
+
+// Report 输出事件
+func (r *CliDownloadReporter) Report(event *DownloadEvent) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if event.Type == DownloadEventProgress {
+		if event.Message != "" {
+			// 各个下载线程的状态，先空两行
+			fmt.Fprintf(r.w, "%s\n\n", event.Message)
+			r.progressing = false
+		}
+		if !r.showProgress || event.Progress == nil {
+			return
+		}
+		p := event.Progress
+		leftStr := "-" // 如果下载速度为0, 剩余时间未知, 则用 - 代替
+		if p.Left >= 0 {
+			leftStr = (time.Duration(p.Left) * time.Second).String()
+		}
+		var percentage float64
+		if p.TotalSize > 0 {
+			percentage = float64(p.Downloaded) / float64(p.TotalSize) * 100
+		}
+		fmt.Fprintf(r.w, "\r[%s] ↓ %s/%s(%.2f%%) %s/s(%s/s) in %s, left %s ............", event.TaskId,
+			converter.ConvertFileSize(p.Downloaded, 2),
+			converter.ConvertFileSize(p.TotalSize, 2),
+			percentage,
+			converter.ConvertFileSize(p.Speed, 2),
+			converter.ConvertFileSize(p.GlobalSpeed, 2),
+			time.Duration(p.Elapsed)*time.Second,
+			leftStr,
+		)
+		r.progressing = true
+		return
+	}
+
+	if r.progressing {
+		// 结束进度行
+		fmt.Fprintln(r.w)
+		r.progressing = false
+	}
+	msg := event.Message
+	switch event.Type {
+	case DownloadEventFile:
+		// 文件详情前空一行，和上一个文件的输出分开
+		fmt.Fprintf(r.w, "\n[%s] ----\n%s\n", event.TaskId, msg)
+		return
+	case DownloadEventRetry:
+		if event.Error != "" {
+			msg += ", " + event.Error
+		}
+		msg = fmt.Sprintf("%s, 重试 %d/%d", msg, event.Retry, event.MaxRetry)
+	case DownloadEventError:
+		if event.Error != "" {
+			msg += ", " + event.Error
+		}
+	}
+	fmt.Fprintf(r.w, "[%s] %s\n", event.TaskId, msg)
+}
+
+// NewJsonDownloadReporter 创建JSON事件流输出
+func NewJsonDownloadReporter(w io.Writer) *JsonDownloadReporter {
+	return &JsonDownloadReporter{
+		encoder: json.NewEncoder(w),
+	}
+}
+
+// Report 输出一行JSON
+func (r *JsonDownloadReporter) Report(event *DownloadEvent) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if err := r.encoder.Encode(event); err != nil {
+		logger.Verboseln("write download event error: ", err)
+	}
+}
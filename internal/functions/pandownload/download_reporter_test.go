@@ -0,0 +1,120 @@
+package pandownload
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tickstep/aliyunpan/internal/taskframework"
+)
+
+type recordReporter struct {
+	mutex  sync.Mutex
+	events []*DownloadEvent
+}
+
+func (r *recordReporter) Report(event *DownloadEvent) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.events = append(r.events, event)
+}
+
+func newReportUnit(reporter DownloadReporter) *DownloadTaskUnit {
+	dtu := &DownloadTaskUnit{
+		FilePanPath: "/视频/1.mp4",
+		Reporter:    reporter,
+	}
+	executor := &taskframework.TaskExecutor{}
+	executor.Append(dtu, 3)
+	return dtu
+}
+
+func TestCliDownloadReporter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	r := NewCliDownloadReporter(buf, true)
+	r.Report(&DownloadEvent{Type: DownloadEventFile, TaskId: "1", Message: "文件详情"})
+	r.Report(&DownloadEvent{Type: DownloadEventProgress, TaskId: "1", Progress: &DownloadProgress{
+		Downloaded: 50, TotalSize: 100, Left: -1,
+	}})
+	r.Report(&DownloadEvent{Type: DownloadEventRetry, TaskId: "1", Message: StrDownloadFailed, Error: "timeout", Retry: 1, MaxRetry: 3})
+	r.Report(&DownloadEvent{Type: DownloadEventError, TaskId: "1", Message: StrDownloadFailed})
+
+	want := "\n[1] ----\n文件详情\n" +
+		"\r[1] ↓ 50B/100B(50.00%) 0B/s(0B/s) in 0s, left - ............\n" +
+		"[1] 下载文件失败, timeout, 重试 1/3\n" +
+		"[1] 下载文件失败\n"
+	if buf.String() != want {
+		t.Fatalf("output = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestCliDownloadReporterNoProgress(t *testing.T) {
+	buf := &bytes.Buffer{}
+	r := NewCliDownloadReporter(buf, false)
+	r.Report(&DownloadEvent{Type: DownloadEventProgress, TaskId: "1", Progress: &DownloadProgress{Downloaded: 1, TotalSize: 2}})
+	r.Report(&DownloadEvent{Type: DownloadEventSuccess, TaskId: "1", Message: "下载完成"})
+	if buf.String() != "[1] 下载完成\n" {
+		t.Fatalf("output = %q", buf.String())
+	}
+}
+
+func TestJsonDownloadReporter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	r := NewJsonDownloadReporter(buf)
+	r.Report(&DownloadEvent{Type: DownloadEventProgress, TaskId: "1", Progress: &DownloadProgress{Downloaded: 10, TotalSize: 20}})
+	r.Report(&DownloadEvent{Type: DownloadEventSuccess, TaskId: "1", Message: "下载完成"})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("lines = %d, want 2", len(lines))
+	}
+	event := &DownloadEvent{}
+	if err := json.Unmarshal([]byte(lines[0]), event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != DownloadEventProgress || event.Progress == nil || event.Progress.Downloaded != 10 {
+		t.Fatalf("event = %+v", event)
+	}
+}
+
+func TestDownloadTaskUnitReport(t *testing.T) {
+	reporter := &recordReporter{}
+	dtu := newReportUnit(reporter)
+
+	dtu.OnRetry(&taskframework.TaskUnitRunResult{ResultMessage: StrDownloadFailed, Err: errors.New("timeout")})
+	if len(reporter.events) != 1 {
+		t.Fatalf("events = %d, want 1", len(reporter.events))
+	}
+	event := reporter.events[0]
+	if event.Type != DownloadEventRetry || event.TaskId != "1" || event.PanPath != "/视频/1.mp4" {
+		t.Fatalf("event = %+v", event)
+	}
+	if event.Error != "timeout" || event.MaxRetry != 3 || event.Time.IsZero() {
+		t.Fatalf("event = %+v", event)
+	}
+}
+
+func TestDownloadTaskUnitReportSkipExisted(t *testing.T) {
+	dir := t.TempDir()
+	savePath := filepath.Join(dir, "1.mp4")
+	if err := os.WriteFile(savePath, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	reporter := &recordReporter{}
+	dtu := newReportUnit(reporter)
+	dtu.SavePath = savePath
+	dtu.OriginSaveRootPath = dir
+	dtu.OnExist = OnExistSkip
+
+	if !dtu.resolveExistedFile() {
+		t.Fatal("existed file should be skipped")
+	}
+	if len(reporter.events) != 1 || reporter.events[0].Type != DownloadEventSkip || reporter.events[0].LocalPath != savePath {
+		t.Fatalf("events = %+v", reporter.events)
+	}
+}
@@ -14,16 +14,20 @@
 package pandownload
 
 import (
+	"context"
 	"fmt"
 	"github.com/tickstep/aliyunpan-api/aliyunpan"
 	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
 	"github.com/tickstep/aliyunpan/cmder/cmdtable"
 	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/crypto"
 	"github.com/tickstep/aliyunpan/internal/file/downloader"
 	"github.com/tickstep/aliyunpan/internal/functions"
+	"github.com/tickstep/aliyunpan/internal/functions/panwalk"
 	"github.com/tickstep/aliyunpan/internal/global"
 	"github.com/tickstep/aliyunpan/internal/localfile"
 	"github.com/tickstep/aliyunpan/internal/log"
+	"github.com/tickstep/aliyunpan/internal/metrics"
 	"github.com/tickstep/aliyunpan/internal/plugins"
 	"github.com/tickstep/aliyunpan/internal/taskframework"
 	"github.com/tickstep/aliyunpan/internal/utils"
@@ -32,6 +36,7 @@ import (
 	"github.com/tickstep/library-go/logger"
 	"github.com/tickstep/library-go/requester/rio/speeds"
 	"io"
+	"math"
 	"os"
 	"path"
 	"path/filepath"
@@ -50,6 +55,7 @@ type (
 
 		Cfg                *downloader.Config
 		PanClient          *config.PanClient
+		User               *config.PanUser     // 下载使用的账号，用于插件回调，为nil时使用当前登录账号
 		SubPanClientList   []*config.PanClient // 辅助下载子账号列表
 		ParentTaskExecutor *taskframework.TaskExecutor
 
@@ -59,10 +65,13 @@ type (
 		// 可选项
 		VerbosePrinter       *logger.CmdVerbose
 		PrintFormat          string
-		IsPrintStatus        bool // 是否输出各个下载线程的详细信息
-		IsExecutedPermission bool // 下载成功后是否加上执行权限
-		IsOverwrite          bool // 是否覆盖已存在的文件
-		NoCheck              bool // 不校验文件
+		IsPrintStatus        bool           // 是否输出各个下载线程的详细信息
+		IsExecutedPermission bool           // 下载成功后是否加上执行权限
+		IsOverwrite          bool           // 是否覆盖已存在的文件
+		OnExist              string         // 本地已存在同名文件的处理策略，overwrite/skip/rename/ask
+		NoCheck              bool           // 不校验文件
+		Verify               bool           // 下载完成后校验本地文件SHA1与网盘记录是否一致
+		Cipher               *crypto.Cipher // 客户端加密密钥，用于解密加密上传的文件，可以为nil
 
 		FilePanSource      global.FileSourceType // 要下载的网盘文件来源
 		FilePanPath        string                // 要下载的网盘文件路径
@@ -70,10 +79,23 @@ type (
 		OriginSaveRootPath string                // 文件保存在本地的根目录路径
 		DriveId            string                // 网盘ID
 
-		fileInfo *aliyunpan.FileEntity // 文件或目录详情
+		fileInfo     *aliyunpan.FileEntity // 文件或目录详情
+		lastRetryErr error                 // 最近一次需要重试的错误，用于选择重试退避策略
+		verifyResult string                // SHA1校验结果，为空代表没有校验
+		streamSha1   string                // 下载时流式计算的SHA1，为空代表没有计算
 
 		// 下载文件记录器
 		FileRecorder *log.FileRecorder
+		// Plugin 插件，所有下载任务共用，为nil时每次回调重新加载插件
+		Plugin plugins.Plugin
+		// Control 外部控制，暂停时中止进行中的下载并保存断点，恢复后从断点继续，可以为nil
+		Control *taskframework.TaskControl
+		// PathPriority 下载优先级规则，目录中的文件按照该规则调度，可以为nil
+		PathPriority *utils.PathPriority
+		// FolderWalker 获取目录下的文件列表，所有目录任务共用请求频率限制，为nil时自动创建
+		FolderWalker *panwalk.Walker
+		// Reporter 下载状态上报，所有任务单元共用，为nil时输出到命令行
+		Reporter DownloadReporter
 	}
 )
 
@@ -82,6 +104,8 @@ const (
 	DefaultPrintFormat = "\r[%s] ↓ %s/%s %s/s in %s, left %s ............"
 	//DownloadSuffix 文件下载后缀
 	DownloadSuffix = ".aliyunpan-downloading"
+	// DownloadPartSuffix 未完成下载的文件后缀，下载完成后重命名为目标文件名
+	DownloadPartSuffix = ".aliyunpan.part"
 	//StrDownloadInitError 初始化下载发生错误
 	StrDownloadInitError = "初始化下载发生错误"
 	// StrDownloadFailed 下载文件失败
@@ -94,6 +118,29 @@ const (
 	DefaultDownloadMaxRetry = 3
 )
 
+// report 上报事件，补全任务ID、时间和文件路径
+func (dtu *DownloadTaskUnit) report(event *DownloadEvent) {
+	if dtu.Reporter == nil {
+		dtu.Reporter = NewCliDownloadReporter(os.Stdout, dtu.Cfg != nil && dtu.Cfg.ShowProgress)
+	}
+	if event.TaskId == "" && dtu.taskInfo != nil {
+		event.TaskId = dtu.taskInfo.Id()
+	}
+	event.Time = time.Now()
+	if event.PanPath == "" {
+		event.PanPath = dtu.FilePanPath
+	}
+	if event.LocalPath == "" {
+		event.LocalPath = dtu.SavePath
+	}
+	dtu.Reporter.Report(event)
+}
+
+// reportf 上报提示信息
+func (dtu *DownloadTaskUnit) reportf(eventType DownloadEventType, format string, a ...interface{}) {
+	dtu.report(&DownloadEvent{Type: eventType, Message: fmt.Sprintf(format, a...)})
+}
+
 // SetFileInfo 设置文件信息
 func (dtu *DownloadTaskUnit) SetFileInfo(source global.FileSourceType, f *aliyunpan.FileEntity) {
 	dtu.FilePanSource = source
@@ -165,9 +212,18 @@ func (dtu *DownloadTaskUnit) download() (err error) {
 
 	// 下载配置文件存储路径
 	dtu.Cfg.InstanceStatePath = savePathSymlinkFile.RealPath + DownloadSuffix
-
-	// 打开文件
-	writer, file, err = downloader.NewDownloaderWriterByFilename(savePathSymlinkFile.RealPath, os.O_CREATE|os.O_WRONLY, 0666)
+	// 下载过程中写入临时文件，完成后重命名，避免其他程序读到不完整的文件
+	partPath := savePathSymlinkFile.RealPath + DownloadPartSuffix
+	migratePartFile(savePathSymlinkFile.RealPath)
+
+	// 打开文件，流式计算SHA1时需要读回多线程下载时不是按顺序写入的数据
+	dtu.streamSha1 = ""
+	streamSha1 := dtu.Verify && !dtu.NoCheck && IsSha1Supported(dtu.fileInfo)
+	flag := os.O_CREATE | os.O_WRONLY
+	if streamSha1 {
+		flag = os.O_CREATE | os.O_RDWR
+	}
+	writer, file, err = downloader.NewDownloaderWriterByFilename(partPath, flag, 0666)
 	if err != nil {
 		return fmt.Errorf("%s, %s", StrDownloadInitError, err)
 	}
@@ -176,6 +232,9 @@ func (dtu *DownloadTaskUnit) download() (err error) {
 	der := downloader.NewDownloader(writer, dtu.Cfg, dtu.PanClient, dtu.SubPanClientList, dtu.GlobalSpeedsStat)
 	der.SetFileInfo(dtu.FilePanSource, dtu.fileInfo)
 	der.SetDriveId(dtu.DriveId)
+	if streamSha1 {
+		der.EnableStreamSha1()
+	}
 	der.SetStatusCodeBodyCheckFunc(func(respBody io.Reader) error {
 		// 解析错误
 		return apierror.NewFailedApiError("")
@@ -190,6 +249,9 @@ func (dtu *DownloadTaskUnit) download() (err error) {
 	isComplete := false
 	der.OnDownloadStatusEvent(func(status transfer.DownloadStatuser, workersCallback func(downloader.RangeWorkerFunc)) {
 		// 这里可能会下载结束了, 还会输出内容
+		if isComplete {
+			return
+		}
 		builder := &strings.Builder{}
 		if dtu.IsPrintStatus {
 			// 输出所有的worker状态
@@ -203,43 +265,67 @@ func (dtu *DownloadTaskUnit) download() (err error) {
 				return true
 			})
 
-			// 先空两行
-			builder.WriteString("\n\n")
 			tb.Render()
 		}
 
-		// 如果下载速度为0, 剩余下载时间未知, 则用 - 代替
-		var leftStr string
-		left := status.TimeLeft()
-		if left < 0 {
-			leftStr = "-"
-		} else {
-			leftStr = left.String()
-		}
-
-		if dtu.Cfg.ShowProgress {
-			downloadedPercentage := fmt.Sprintf("%.2f%%", float64(status.Downloaded())/float64(status.TotalSize())*100)
-			fmt.Fprintf(builder, "\r[%s] ↓ %s/%s(%s) %s/s(%s/s) in %s, left %s ............", dtu.taskInfo.Id(),
-				converter.ConvertFileSize(status.Downloaded(), 2),
-				converter.ConvertFileSize(status.TotalSize(), 2),
-				downloadedPercentage,
-				converter.ConvertFileSize(status.SpeedsPerSecond(), 2),
-				converter.ConvertFileSize(dtu.GlobalSpeedsStat.GetSpeeds(), 2),
-				status.TimeElapsed()/1e7*1e7, leftStr,
-			)
-		}
-
-		if !isComplete {
-			// 如果未完成下载, 就输出
-			fmt.Print(builder.String())
+		// 如果下载速度为0, 剩余下载时间未知, 用 -1 代替
+		left := int64(-1)
+		if status.TimeLeft() >= 0 {
+			left = int64(status.TimeLeft() / time.Second)
 		}
+		dtu.report(&DownloadEvent{
+			Type:    DownloadEventProgress,
+			Message: strings.TrimRight(builder.String(), "\n"),
+			Progress: &DownloadProgress{
+				Downloaded:  status.Downloaded(),
+				TotalSize:   status.TotalSize(),
+				Speed:       status.SpeedsPerSecond(),
+				GlobalSpeed: dtu.GlobalSpeedsStat.GetSpeeds(),
+				Elapsed:     int64(status.TimeElapsed() / time.Second),
+				Left:        left,
+			},
+		})
 	})
 
+	downloadFinished := make(chan struct{})
+	defer close(downloadFinished)
 	der.OnExecute(func() {
-		fmt.Printf("[%s] 下载开始\n", dtu.taskInfo.Id())
+		dtu.reportf(DownloadEventInfo, "下载开始")
+		if dtu.Control == nil {
+			return
+		}
+		// 暂停或者停止时中止进行中的下载
+		go func() {
+			for {
+				changed := dtu.Control.Changed()
+				if dtu.Control.IsPaused() || dtu.Control.IsStopped() {
+					der.Cancel()
+					return
+				}
+				select {
+				case <-changed:
+				case <-downloadFinished:
+					return
+				}
+			}
+		}()
 	})
 
 	err = der.Execute()
+	if err == context.Canceled && (dtu.Control.IsPaused() || dtu.Control.IsStopped()) {
+		// 断点信息已经保存，恢复后重新打开文件从断点继续
+		file.Close()
+		if dtu.Control.IsStopped() {
+			dtu.reportf(DownloadEventCancel, "下载已中止, 已保存断点: %s", dtu.SavePath)
+			return err
+		}
+		dtu.reportf(DownloadEventPause, "下载已暂停, 已保存断点: %s", dtu.SavePath)
+		if !dtu.Control.WaitResume() {
+			return err
+		}
+		dtu.reportf(DownloadEventResume, "恢复下载: %s", dtu.SavePath)
+		return dtu.download()
+	}
 	if err != nil {
 		// check zero size file
 		if err == downloader.ErrNoWokers && dtu.fileInfo.FileSize == 0 {
@@ -249,11 +335,11 @@ func (dtu *DownloadTaskUnit) download() (err error) {
 			// 文件被禁止下载
 			isComplete = false
 			// 删除本地文件
-			removeErr := os.Remove(dtu.SavePath)
+			removeErr := os.Remove(partPath)
 			if removeErr != nil {
 				dtu.verboseInfof("[%s] remove file error: %s\n", dtu.taskInfo.Id(), removeErr)
 			}
-			fmt.Printf("[%s] 下载失败，文件不合法或者被禁止下载: %s\n", dtu.taskInfo.Id(), dtu.SavePath)
+			dtu.reportf(DownloadEventError, "下载失败，文件不合法或者被禁止下载: %s", dtu.SavePath)
 			return err
 		} else {
 			// 下载发生错误
@@ -261,8 +347,8 @@ func (dtu *DownloadTaskUnit) download() (err error) {
 			if info, infoErr := file.Stat(); infoErr == nil {
 				if info.Size() == 0 {
 					// 空文件, 应该删除
-					dtu.verboseInfof("[%s] remove empty file: %s\n", dtu.taskInfo.Id(), dtu.SavePath)
-					removeErr := os.Remove(dtu.SavePath)
+					dtu.verboseInfof("[%s] remove empty file: %s\n", dtu.taskInfo.Id(), partPath)
+					removeErr := os.Remove(partPath)
 					if removeErr != nil {
 						dtu.verboseInfof("[%s] remove file error: %s\n", dtu.taskInfo.Id(), removeErr)
 					}
@@ -272,20 +358,54 @@ func (dtu *DownloadTaskUnit) download() (err error) {
 		}
 	} else {
 		isComplete = true
+		dtu.streamSha1 = der.StreamSha1()
 	}
 
 	// 下载成功
 	if dtu.IsExecutedPermission {
 		err = file.Chmod(0766)
 		if err != nil {
-			fmt.Printf("[%s] 警告, 加执行权限错误: %s\n", dtu.taskInfo.Id(), err)
+			dtu.reportf(DownloadEventInfo, "警告, 加执行权限错误: %s", err)
 		}
 	}
-	fmt.Printf("\n[%s] 下载完成, 保存位置: %s\n", dtu.taskInfo.Id(), dtu.SavePath)
+	file.Close()
+	if err = os.Rename(partPath, savePathSymlinkFile.RealPath); err != nil {
+		return fmt.Errorf("%s, %s", StrDownloadFailed, err)
+	}
+	dtu.reportf(DownloadEventSuccess, "下载完成, 保存位置: %s", dtu.SavePath)
 
 	return nil
 }
 
+// migratePartFile 旧版本直接写入目标文件，存在断点信息时把未完成的文件改名为临时文件，继续断点续传
+func migratePartFile(realPath string) {
+	if _, err := os.Stat(realPath + DownloadSuffix); err != nil {
+		return
+	}
+	if _, err := os.Stat(realPath + DownloadPartSuffix); err == nil {
+		return
+	}
+	if _, err := os.Stat(realPath); err != nil {
+		return
+	}
+	if err := os.Rename(realPath, realPath+DownloadPartSuffix); err != nil {
+		logger.Verboseln("rename downloading file error: ", err)
+	}
+}
+
+// DownloadOrderKey 下载任务的调度排序依据。目录需要先获取文件列表才能调度其中的文件，总是优先执行
+func DownloadOrderKey(f *aliyunpan.FileEntity, priority *utils.PathPriority) taskframework.TaskOrderKey {
+	if f.IsFolder() {
+		return taskframework.TaskOrderKey{Priority: math.MaxInt32, Name: f.Path}
+	}
+	return taskframework.TaskOrderKey{
+		Priority: priority.Priority(f.Path),
+		Name:     f.Path,
+		Size:     f.FileSize,
+		ModTime:  utils.ParseTimeStr(f.UpdatedAt).Unix(),
+	}
+}
+
 // handleError 下载错误处理器
 func (dtu *DownloadTaskUnit) handleError(result *taskframework.TaskUnitRunResult) {
 	switch value := result.Err.(type) {
@@ -321,11 +441,14 @@ func (dtu *DownloadTaskUnit) checkFileValid(result *taskframework.TaskUnitRunRes
 
 	if dtu.fileInfo.FileSize >= 128*converter.MB {
 		// 大文件, 输出一句提示消息
-		fmt.Printf("[%s] 开始检验文件有效性, 请稍候...\n", dtu.taskInfo.Id())
+		dtu.reportf(DownloadEventInfo, "开始检验文件有效性, 请稍候...")
 	}
 
 	// 就在这里处理校验出错
 	err := CheckFileValid(dtu.SavePath, dtu.fileInfo)
+	if err == nil && dtu.Verify {
+		err = dtu.verifySha1()
+	}
 	if err != nil {
 		result.ResultMessage = StrDownloadChecksumFailed
 		result.Err = err
@@ -334,7 +457,7 @@ func (dtu *DownloadTaskUnit) checkFileValid(result *taskframework.TaskUnitRunRes
 			// 文件不支持校验
 			result.ResultMessage = "检验文件有效性"
 			result.Err = err
-			fmt.Printf("[%s] 检验文件有效性: %s\n", dtu.taskInfo.Id(), err)
+			dtu.reportf(DownloadEventInfo, "检验文件有效性: %s", err)
 			return true
 		case ErrDownloadFileBanned:
 			// 违规文件
@@ -346,30 +469,115 @@ func (dtu *DownloadTaskUnit) checkFileValid(result *taskframework.TaskUnitRunRes
 			// 设置允许覆盖
 			dtu.IsOverwrite = true
 			return
+		case ErrDownloadSha1Mismatch:
+			// 网盘只提供整个文件的SHA1，无法定位损坏的分片，删除本地文件后重新下载
+			dtu.reportf(DownloadEventInfo, "%s, 删除本地文件后重新下载", err)
+			if e := os.Remove(dtu.SavePath); e != nil {
+				logger.Verboseln("remove corrupted file error: ", e)
+			}
+			result.NeedRetry = true
+			dtu.IsOverwrite = true
+			return
 		default:
 			result.NeedRetry = false
 			return
 		}
 	}
 
-	fmt.Printf("[%s] 检验文件有效性成功: %s\n", dtu.taskInfo.Id(), dtu.SavePath)
+	dtu.reportf(DownloadEventInfo, "检验文件有效性成功: %s", dtu.SavePath)
 	return true
 }
 
+// verifySha1 计算本地文件SHA1并与网盘记录比较，记录校验结果
+func (dtu *DownloadTaskUnit) verifySha1() error {
+	var err error
+	if dtu.streamSha1 != "" {
+		// 下载时已经流式计算了SHA1，不需要再读取整个文件
+		err = CompareSha1(dtu.streamSha1, dtu.fileInfo)
+	} else {
+		if dtu.fileInfo.FileSize >= 128*converter.MB {
+			dtu.reportf(DownloadEventInfo, "开始校验文件SHA1, 请稍候...")
+		}
+		err = VerifyFileSha1(dtu.SavePath, dtu.fileInfo)
+	}
+	switch err {
+	case nil:
+		dtu.verifyResult = "通过"
+		dtu.reportf(DownloadEventInfo, "文件SHA1校验通过")
+	case ErrDownloadNotSupportChecksum:
+		dtu.verifyResult = "不支持"
+	case ErrDownloadSha1Mismatch:
+		dtu.verifyResult = "不一致"
+	default:
+		dtu.verifyResult = "失败"
+	}
+	return err
+}
+
+// decryptFile 解密下载的加密文件，还原原始文件名，解密成功后删除加密文件
+func (dtu *DownloadTaskUnit) decryptFile() error {
+	if !crypto.IsEncryptedFile(dtu.SavePath) {
+		// 只是文件名后缀相同，不是加密文件
+		return nil
+	}
+	name, err := dtu.Cipher.DecryptName(dtu.fileInfo.FileName)
+	if err != nil {
+		return err
+	}
+	plainPath, ok := dtu.resolveDecryptPath(filepath.Join(filepath.Dir(dtu.SavePath), filepath.Base(name)))
+	if !ok {
+		// 保留本地已存在的文件，删除下载的加密文件
+		if err = os.Remove(dtu.SavePath); err != nil {
+			logger.Verboseln("remove encrypted file error: ", err)
+		}
+		dtu.SavePath = plainPath
+		return nil
+	}
+	tempPath := plainPath + DownloadPartSuffix
+	if err = dtu.Cipher.DecryptFile(dtu.SavePath, tempPath); err != nil {
+		return err
+	}
+	if err = os.Rename(tempPath, plainPath); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	if err = os.Remove(dtu.SavePath); err != nil {
+		logger.Verboseln("remove encrypted file error: ", err)
+	}
+	dtu.reportf(DownloadEventInfo, "解密完成, 保存位置: %s", plainPath)
+	dtu.SavePath = plainPath
+	return nil
+}
+
 func (dtu *DownloadTaskUnit) OnRetry(lastRunResult *taskframework.TaskUnitRunResult) {
+	dtu.lastRetryErr = lastRunResult.Err
+	metrics.CountRetry("download")
 	// 输出错误信息
-	if lastRunResult.Err == nil {
-		// result中不包含Err, 忽略输出
-		fmt.Printf("[%s] %s, 重试 %d/%d\n", dtu.taskInfo.Id(), lastRunResult.ResultMessage, dtu.taskInfo.Retry(), dtu.taskInfo.MaxRetry())
-		return
+	event := &DownloadEvent{
+		Type:     DownloadEventRetry,
+		Message:  lastRunResult.ResultMessage,
+		Retry:    dtu.taskInfo.Retry(),
+		MaxRetry: dtu.taskInfo.MaxRetry(),
 	}
-	fmt.Printf("[%s] %s, %s, 重试 %d/%d\n", dtu.taskInfo.Id(), lastRunResult.ResultMessage, lastRunResult.Err, dtu.taskInfo.Retry(), dtu.taskInfo.MaxRetry())
+	if lastRunResult.Err != nil {
+		event.Error = lastRunResult.Err.Error()
+	}
+	dtu.report(event)
 }
 
 func (dtu *DownloadTaskUnit) OnSuccess(lastRunResult *taskframework.TaskUnitRunResult) {
 	// 执行插件
 	dtu.pluginCallback("success")
 
+	if dtu.fileInfo != nil && dtu.fileInfo.IsFile() {
+		dtu.DownloadStatistic.AddFileResult(&functions.FileResult{
+			Path:   dtu.fileInfo.Path,
+			Target: dtu.SavePath,
+			Size:   dtu.fileInfo.FileSize,
+			Status: functions.FileResultSucceed,
+		})
+	}
+
 	// 下载文件数据记录
 	if config.Config.FileRecordConfig == "1" {
 		if dtu.fileInfo.IsFile() {
@@ -379,6 +587,7 @@ func (dtu *DownloadTaskUnit) OnSuccess(lastRunResult *taskframework.TaskUnitRunR
 					TimeStr:  utils.NowTimeStr(),
 					FileSize: dtu.fileInfo.FileSize,
 					FilePath: dtu.fileInfo.Path,
+					Verify:   dtu.verifyResult,
 				})
 			}
 		}
@@ -389,21 +598,62 @@ func (dtu *DownloadTaskUnit) OnFailed(lastRunResult *taskframework.TaskUnitRunRe
 	// 失败
 	dtu.pluginCallback("fail")
 
+	failedResult := &functions.FileResult{
+		Path:   dtu.FilePanPath,
+		Target: dtu.SavePath,
+		Status: functions.FileResultFailed,
+		Error:  lastRunResult.ResultMessage,
+	}
+	if dtu.fileInfo != nil {
+		failedResult.Size = dtu.fileInfo.FileSize
+	}
+	if lastRunResult.Err != nil {
+		failedResult.Error += ": " + lastRunResult.Err.Error()
+	}
+	dtu.DownloadStatistic.AddFileResult(failedResult)
+
+	// 下载文件数据记录
+	if config.Config.FileRecordConfig == "1" && dtu.fileInfo != nil && dtu.fileInfo.IsFile() && dtu.FileRecorder != nil {
+		dtu.FileRecorder.Append(&log.FileRecordItem{
+			Status:   "失败",
+			TimeStr:  utils.NowTimeStr(),
+			FileSize: dtu.fileInfo.FileSize,
+			FilePath: dtu.fileInfo.Path,
+			Verify:   dtu.verifyResult,
+		})
+	}
+
 	// 失败
-	if lastRunResult.Err == nil {
-		// result中不包含Err, 忽略输出
-		fmt.Printf("[%s] %s\n", dtu.taskInfo.Id(), lastRunResult.ResultMessage)
-		return
+	event := &DownloadEvent{Type: DownloadEventError, Message: lastRunResult.ResultMessage}
+	if lastRunResult.Err != nil {
+		event.Error = lastRunResult.Err.Error()
 	}
-	fmt.Printf("[%s] %s, %s\n", dtu.taskInfo.Id(), lastRunResult.ResultMessage, lastRunResult.Err)
+	dtu.report(event)
+}
+
+// pluginContext 插件回调的上下文，使用下载文件的账号
+func (dtu *DownloadTaskUnit) pluginContext() *plugins.Context {
+	user := dtu.User
+	if user == nil {
+		user = config.Config.ActiveUser()
+	}
+	return plugins.GetContext(user)
+}
+
+// plugin 获取插件，没有设置共用的插件时重新加载
+func (dtu *DownloadTaskUnit) plugin() plugins.Plugin {
+	if dtu.Plugin != nil {
+		return dtu.Plugin
+	}
+	plugin, _ := plugins.NewPluginManager(config.GetPluginDir()).GetPlugin()
+	return plugin
 }
 
 func (dtu *DownloadTaskUnit) pluginCallback(result string) {
 	if dtu.fileInfo == nil {
 		return
 	}
-	pluginManger := plugins.NewPluginManager(config.GetPluginDir())
-	plugin, _ := pluginManger.GetPlugin()
+	plugin := dtu.plugin()
 	pluginParam := &plugins.DownloadFileFinishParams{
 		DownloadActionId:   dtu.DownloadActionId,
 		DriveId:            dtu.fileInfo.DriveId,
@@ -417,7 +667,7 @@ func (dtu *DownloadTaskUnit) pluginCallback(result string) {
 		DownloadResult:     result,
 		LocalFilePath:      dtu.SavePath,
 	}
-	if er := plugin.DownloadFileFinishCallback(plugins.GetContext(config.Config.ActiveUser()), pluginParam); er != nil {
+	if er := plugin.DownloadFileFinishCallback(dtu.pluginContext(), pluginParam); er != nil {
 		logger.Verboseln("插件DownloadFileFinishCallback调用失败： {}", er)
 	} else {
 		logger.Verboseln("插件DownloadFileFinishCallback调用成功")
@@ -428,11 +678,14 @@ func (dtu *DownloadTaskUnit) OnComplete(lastRunResult *taskframework.TaskUnitRun
 }
 
 func (dtu *DownloadTaskUnit) OnCancel(lastRunResult *taskframework.TaskUnitRunResult) {
-
+	if dtu.Control.IsStopped() {
+		// 任务被停止，正在下载的文件已经保存断点
+		dtu.pluginCallback("cancelled")
+	}
 }
 
 func (dtu *DownloadTaskUnit) RetryWait() time.Duration {
-	return functions.RetryWait(dtu.taskInfo.Retry())
+	return functions.RetryWaitWithPolicy(dtu.taskInfo.Retry(), dtu.lastRetryErr, config.Config.RetryBackoffPolicy())
 }
 
 func (dtu *DownloadTaskUnit) Run() (result *taskframework.TaskUnitRunResult) {
@@ -455,16 +708,14 @@ func (dtu *DownloadTaskUnit) Run() (result *taskframework.TaskUnitRunResult) {
 	}
 
 	// 输出文件信息
-	fmt.Print("\n")
-	fmt.Printf("[%s] ----\n%s\n", dtu.taskInfo.Id(), dtu.fileInfo.String())
+	dtu.report(&DownloadEvent{Type: DownloadEventFile, Message: dtu.fileInfo.String()})
 
 	// 调用插件
 	ft := "file"
 	if dtu.fileInfo.IsFolder() {
 		ft = "folder"
 	}
-	pluginManger := plugins.NewPluginManager(config.GetPluginDir())
-	plugin, _ := pluginManger.GetPlugin()
+	plugin := dtu.plugin()
 	localFilePath := strings.TrimPrefix(dtu.SavePath, dtu.OriginSaveRootPath)
 	localFilePath = strings.TrimPrefix(strings.TrimPrefix(localFilePath, "\\"), "/")
 	pluginParam := &plugins.DownloadFilePrepareParams{
@@ -478,10 +729,10 @@ func (dtu *DownloadTaskUnit) Run() (result *taskframework.TaskUnitRunResult) {
 		DriveFileUpdatedAt: dtu.fileInfo.UpdatedAt,
 		LocalFilePath:      localFilePath,
 	}
-	if downloadFilePrepareResult, er := plugin.DownloadFilePrepareCallback(plugins.GetContext(config.Config.ActiveUser()), pluginParam); er == nil && downloadFilePrepareResult != nil {
+	if downloadFilePrepareResult, er := plugin.DownloadFilePrepareCallback(dtu.pluginContext(), pluginParam); er == nil && downloadFilePrepareResult != nil {
 		if strings.Compare("yes", downloadFilePrepareResult.DownloadApproved) != 0 {
 			// skip download this file
-			fmt.Printf("插件取消了该文件下载: %s\n", dtu.fileInfo.Path)
+			dtu.reportf(DownloadEventSkip, "插件取消了该文件下载: %s", dtu.fileInfo.Path)
 			result.Succeed = false
 			result.Cancel = true
 			return
@@ -490,7 +741,7 @@ func (dtu *DownloadTaskUnit) Run() (result *taskframework.TaskUnitRunResult) {
 			targetSaveRelativePath := strings.TrimPrefix(downloadFilePrepareResult.LocalFilePath, "/")
 			targetSaveRelativePath = strings.TrimPrefix(targetSaveRelativePath, "\\")
 			dtu.SavePath = path.Clean(dtu.OriginSaveRootPath + string(os.PathSeparator) + targetSaveRelativePath)
-			fmt.Printf("插件修改文件下载保存路径为: %s\n", dtu.SavePath)
+			dtu.reportf(DownloadEventInfo, "插件修改文件下载保存路径为: %s", dtu.SavePath)
 		}
 	}
 
@@ -520,38 +771,22 @@ func (dtu *DownloadTaskUnit) Run() (result *taskframework.TaskUnitRunResult) {
 			}
 		}
 
-		// 获取该目录下的文件列表
-		fileList, apierr := dtu.PanClient.OpenapiPanClient().FileListGetAll(&aliyunpan.FileListParam{
-			DriveId:      dtu.DriveId,
-			ParentFileId: dtu.fileInfo.FileId,
-		}, 1000)
-		if apierr != nil {
-			// retry one more time
-			time.Sleep(3 * time.Second)
-
-			fileList, apierr = dtu.PanClient.OpenapiPanClient().FileListGetAll(&aliyunpan.FileListParam{
-				DriveId:      dtu.DriveId,
-				ParentFileId: dtu.fileInfo.FileId,
-			}, 1000)
-			if apierr != nil {
-				logger.Verbosef("[%s] get download file list for %s error: %s\n",
-					dtu.taskInfo.Id(), dtu.FilePanPath, apierr)
-
-				// 下次重试
-				result.ResultMessage = "获取目录信息错误"
-				result.Succeed = false
-				result.Err = apierr
-				result.NeedRetry = true
-				return
-			}
+		// 获取该目录下的文件列表，分页获取，失败自动重试，请求频率受限避免触发风控
+		if dtu.FolderWalker == nil {
+			dtu.FolderWalker = panwalk.NewWalker(dtu.PanClient, dtu.DriveId)
 		}
-		if fileList == nil {
+		fileList, err := dtu.FolderWalker.ListFolder(dtu.fileInfo.FileId)
+		if err != nil {
+			logger.Verbosef("[%s] get download file list for %s error: %s\n",
+				dtu.taskInfo.Id(), dtu.FilePanPath, err)
+
+			// 下次重试
 			result.ResultMessage = "获取目录信息错误"
+			result.Succeed = false
 			result.Err = err
 			result.NeedRetry = true
 			return
 		}
-		time.Sleep(1 * time.Second)
 
 		// 排序，按名称排序，从小到大
 		sort.Slice(fileList, func(i, j int) bool {
@@ -563,7 +798,7 @@ func (dtu *DownloadTaskUnit) Run() (result *taskframework.TaskUnitRunResult) {
 
 			// 是否排除下载
 			if utils.IsExcludeFile(fileList[k].Path, &dtu.Cfg.ExcludeNames) {
-				fmt.Printf("排除文件: %s\n", fileList[k].Path)
+				dtu.report(&DownloadEvent{Type: DownloadEventSkip, PanPath: fileList[k].Path, Message: "排除文件: " + fileList[k].Path})
 				continue
 			}
 
@@ -582,8 +817,14 @@ func (dtu *DownloadTaskUnit) Run() (result *taskframework.TaskUnitRunResult) {
 			subUnit.SavePath = filepath.Join(dtu.OriginSaveRootPath, fileList[k].Path) // 保存位置
 
 			// 加入父队列，按照队列调度进行下载
-			info := dtu.ParentTaskExecutor.Append(&subUnit, dtu.taskInfo.MaxRetry())
-			fmt.Printf("[%s] 加入下载队列: %s\n", info.Id(), fileList[k].Path)
+			info := dtu.ParentTaskExecutor.AppendWithOrder(&subUnit, dtu.taskInfo.MaxRetry(), DownloadOrderKey(fileList[k], dtu.PathPriority))
+			dtu.report(&DownloadEvent{
+				Type:      DownloadEventQueue,
+				TaskId:    info.Id(),
+				PanPath:   subUnit.FilePanPath,
+				LocalPath: subUnit.SavePath,
+				Message:   "加入下载队列: " + fileList[k].Path,
+			})
 		}
 
 		// 本下载任务执行成功
@@ -591,7 +832,7 @@ func (dtu *DownloadTaskUnit) Run() (result *taskframework.TaskUnitRunResult) {
 		return
 	}
 
-	fmt.Printf("[%s] 准备下载: %s\n", dtu.taskInfo.Id(), dtu.FilePanPath)
+	dtu.reportf(DownloadEventPrepare, "准备下载: %s", dtu.FilePanPath)
 
 	//if !dtu.IsOverwrite && FileExist(dtu.SavePath) {
 	//	fmt.Printf("[%s] 文件已经存在: %s, 跳过...\n", dtu.taskInfo.Id(), dtu.SavePath)
@@ -600,16 +841,21 @@ func (dtu *DownloadTaskUnit) Run() (result *taskframework.TaskUnitRunResult) {
 	//}
 	// 支持符号文件，逻辑和注释代码一致
 	if !dtu.IsOverwrite && SymlinkFileExist(dtu.SavePath, dtu.OriginSaveRootPath) {
-		fmt.Printf("[%s] 文件已经存在: %s, 跳过...\n", dtu.taskInfo.Id(), dtu.SavePath)
-		result.Succeed = true // 执行成功
-		return
+		if dtu.resolveExistedFile() {
+			result.Succeed = true // 执行成功
+			return
+		}
 	}
 
-	fmt.Printf("[%s] 将会下载到路径: %s\n", dtu.taskInfo.Id(), dtu.SavePath)
+	dtu.reportf(DownloadEventInfo, "将会下载到路径: %s", dtu.SavePath)
 
 	var ok bool
 	er := dtu.download()
 
+	if er == context.Canceled && dtu.Control.IsStopped() {
+		result.Cancel = true
+		return result
+	}
 	if er != nil {
 		// 以上执行不成功, 返回
 		result.ResultMessage = StrDownloadFailed
@@ -630,6 +876,15 @@ func (dtu *DownloadTaskUnit) Run() (result *taskframework.TaskUnitRunResult) {
 	//	logger.Verbosef(err.Error())
 	//}
 
+	// 解密客户端加密上传的文件
+	if dtu.Cipher != nil && crypto.IsEncryptedName(dtu.fileInfo.FileName) {
+		if err := dtu.decryptFile(); err != nil {
+			result.ResultMessage = "解密文件失败"
+			result.Err = err
+			return
+		}
+	}
+
 	// 统计下载
 	dtu.DownloadStatistic.AddTotalSize(dtu.fileInfo.FileSize)
 	// 下载成功
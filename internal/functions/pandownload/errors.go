@@ -20,6 +20,8 @@ var (
 	ErrDownloadNotSupportChecksum = errors.New("该文件不支持校验")
 	// ErrDownloadChecksumFailed 文件校验失败
 	ErrDownloadChecksumFailed = errors.New("该文件校验失败, 文件md5值与服务器记录的不匹配")
+	// ErrDownloadSha1Mismatch 本地文件SHA1与网盘记录的不一致
+	ErrDownloadSha1Mismatch = errors.New("文件SHA1与网盘记录的不一致, 文件可能已损坏")
 	// ErrDownloadFileBanned 违规文件
 	ErrDownloadFileBanned = errors.New("该文件可能是违规文件, 不支持校验")
 	// ErrDlinkNotFound 未取得下载链接
@@ -0,0 +1,174 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pandownload
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan/internal/localfile"
+	"github.com/tickstep/library-go/logger"
+)
+
+const (
+	// OnExistOverwrite 覆盖本地已存在的文件
+	OnExistOverwrite = "overwrite"
+	// OnExistSkip 跳过下载
+	OnExistSkip = "skip"
+	// OnExistRename 自动重命名，文件名追加 (1) 后缀
+	OnExistRename = "rename"
+	// OnExistAsk 询问用户
+	OnExistAsk = "ask"
+)
+
+var (
+	// askMutex 保证多个下载任务同时只有一个询问用户
+	askMutex = &sync.Mutex{}
+)
+
+// IsValidOnExistPolicy 是否是有效的同名文件处理策略
+func IsValidOnExistPolicy(policy string) bool {
+	switch policy {
+	case OnExistOverwrite, OnExistSkip, OnExistRename, OnExistAsk:
+		return true
+	}
+	return false
+}
+
+// IsLocalFileSameAsPan 本地文件和云盘文件内容是否一致，需要计算本地文件SHA1
+func IsLocalFileSameAsPan(fullPath, rootPath string, fileInfo *aliyunpan.FileEntity) bool {
+	if fileInfo == nil || fileInfo.ContentHash == "" {
+		return false
+	}
+	originSaveRootSymlinkFile := localfile.NewSymlinkFile(rootPath)
+	suffixPath := localfile.GetSuffixPath(fullPath, rootPath)
+	savePathSymlinkFile, savePathFileInfo, err := localfile.RetrieveRealPathFromLogicSuffixPath(originSaveRootSymlinkFile, suffixPath)
+	if err != nil || savePathFileInfo == nil || savePathFileInfo.IsDir() {
+		return false
+	}
+	if savePathFileInfo.Size() != fileInfo.FileSize {
+		return false
+	}
+	fileSum := localfile.NewLocalSymlinkFileEntity(savePathSymlinkFile)
+	if err = fileSum.OpenPath(); err != nil {
+		logger.Verbosef("文件不可读, 错误信息: %s\n", err)
+		return false
+	}
+	defer fileSum.Close()
+	fileSum.Sum(localfile.CHECKSUM_SHA1)
+	return strings.ToLower(fileSum.SHA1) == strings.ToLower(fileInfo.ContentHash)
+}
+
+// NextAvailableSavePath 获取可用的重命名保存路径，例如：1.mp4 -> 1 (1).mp4
+func NextAvailableSavePath(savePath, rootPath string) string {
+	dir := filepath.Dir(savePath)
+	ext := filepath.Ext(savePath)
+	name := strings.TrimSuffix(filepath.Base(savePath), ext)
+	for i := 1; ; i++ {
+		p := filepath.Join(dir, fmt.Sprintf("%s (%d)%s", name, i, ext))
+		if SymlinkFileExist(p, rootPath) {
+			continue
+		}
+		if _, err := os.Stat(p + DownloadPartSuffix); err == nil {
+			// 正在下载中的文件
+			continue
+		}
+		if _, err := os.Stat(p + DownloadSuffix); err == nil {
+			continue
+		}
+		return p
+	}
+}
+
+// resolveExistedFile 本地已存在同名文件，按照策略进行处理。返回 true 代表跳过下载
+func (dtu *DownloadTaskUnit) resolveExistedFile() bool {
+	policy := dtu.OnExist
+	if policy == "" || policy == OnExistSkip {
+		dtu.reportf(DownloadEventSkip, "文件已经存在: %s, 跳过...", dtu.SavePath)
+		return true
+	}
+	if policy == OnExistOverwrite {
+		return false
+	}
+
+	// 重命名和询问之前先检测文件内容，内容一致无需重复下载
+	if IsLocalFileSameAsPan(dtu.SavePath, dtu.OriginSaveRootPath, dtu.fileInfo) {
+		dtu.reportf(DownloadEventSkip, "文件已经存在且内容一致: %s, 跳过...", dtu.SavePath)
+		return true
+	}
+
+	if policy == OnExistAsk {
+		policy = dtu.askOnExist(dtu.SavePath, "本地已存在同名文件且内容不同")
+	}
+
+	switch policy {
+	case OnExistOverwrite:
+		dtu.reportf(DownloadEventInfo, "覆盖已存在的文件: %s", dtu.SavePath)
+		dtu.IsOverwrite = true
+		return false
+	case OnExistRename:
+		dtu.SavePath = NextAvailableSavePath(dtu.SavePath, dtu.OriginSaveRootPath)
+		dtu.reportf(DownloadEventInfo, "文件已经存在，重命名保存为: %s", dtu.SavePath)
+		return false
+	}
+	dtu.reportf(DownloadEventSkip, "文件已经存在: %s, 跳过...", dtu.SavePath)
+	return true
+}
+
+// askOnExist 询问用户如何处理本地已存在的同名文件，返回选择的策略
+func (dtu *DownloadTaskUnit) askOnExist(savePath, prompt string) string {
+	askMutex.Lock()
+	defer askMutex.Unlock()
+	fmt.Printf("\n[%s] %s: %s\n", dtu.taskInfo.Id(), prompt, savePath)
+	fmt.Printf("请选择处理方式，覆盖(o)/跳过(s)/重命名(r): ")
+	answer := ""
+	fmt.Scanln(&answer)
+	switch strings.ToLower(answer) {
+	case "o":
+		return OnExistOverwrite
+	case "r":
+		return OnExistRename
+	}
+	return OnExistSkip
+}
+
+// resolveDecryptPath 解密后的文件路径，本地已存在同名文件时按照策略处理。返回 false 代表跳过解密，保留本地已存在的文件。
+// 加密文件的内容和原始文件不同，无法比较内容是否一致
+func (dtu *DownloadTaskUnit) resolveDecryptPath(plainPath string) (string, bool) {
+	if _, err := os.Lstat(plainPath); err != nil {
+		return plainPath, true
+	}
+	policy := dtu.OnExist
+	if dtu.IsOverwrite {
+		policy = OnExistOverwrite
+	}
+	if policy == OnExistAsk {
+		policy = dtu.askOnExist(plainPath, "本地已存在解密后的同名文件")
+	}
+	switch policy {
+	case OnExistOverwrite:
+		dtu.reportf(DownloadEventInfo, "覆盖已存在的文件: %s", plainPath)
+		return plainPath, true
+	case OnExistRename:
+		plainPath = NextAvailableSavePath(plainPath, dtu.OriginSaveRootPath)
+		dtu.reportf(DownloadEventInfo, "文件已经存在，重命名保存为: %s", plainPath)
+		return plainPath, true
+	}
+	dtu.reportf(DownloadEventSkip, "文件已经存在: %s, 跳过解密...", plainPath)
+	return plainPath, false
+}
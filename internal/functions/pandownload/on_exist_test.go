@@ -0,0 +1,157 @@
+package pandownload
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+)
+
+// sha1 of "hello"
+const helloSha1 = "AAF4C61DDCC5E8A2DABEDE0F3B482CD9AEA9434D"
+
+func TestIsValidOnExistPolicy(t *testing.T) {
+	for _, p := range []string{OnExistOverwrite, OnExistSkip, OnExistRename, OnExistAsk} {
+		if !IsValidOnExistPolicy(p) {
+			t.Errorf("%s should be valid", p)
+		}
+	}
+	for _, p := range []string{"", "replace", "Skip"} {
+		if IsValidOnExistPolicy(p) {
+			t.Errorf("%q should be invalid", p)
+		}
+	}
+}
+
+func TestIsLocalFileSameAsPan(t *testing.T) {
+	root := t.TempDir()
+	p := filepath.Join(root, "a.txt")
+	os.WriteFile(p, []byte("hello"), 0644)
+
+	cases := []struct {
+		fileInfo *aliyunpan.FileEntity
+		same     bool
+	}{
+		{&aliyunpan.FileEntity{FileSize: 5, ContentHash: helloSha1}, true},
+		{&aliyunpan.FileEntity{FileSize: 5, ContentHash: "0000000000000000000000000000000000000000"}, false},
+		{&aliyunpan.FileEntity{FileSize: 6, ContentHash: helloSha1}, false},
+		// 没有SHA1无法比较
+		{&aliyunpan.FileEntity{FileSize: 5}, false},
+		{nil, false},
+	}
+	for i, c := range cases {
+		if got := IsLocalFileSameAsPan(p, root, c.fileInfo); got != c.same {
+			t.Errorf("case %d: same %v, want %v", i, got, c.same)
+		}
+	}
+	if IsLocalFileSameAsPan(filepath.Join(root, "none.txt"), root, cases[0].fileInfo) {
+		t.Error("missing file should not be the same")
+	}
+}
+
+func TestNextAvailableSavePath(t *testing.T) {
+	root := t.TempDir()
+	p := filepath.Join(root, "1.mp4")
+	os.WriteFile(p, []byte("1"), 0644)
+	if got := NextAvailableSavePath(p, root); got != filepath.Join(root, "1 (1).mp4") {
+		t.Fatalf("next path: %s", got)
+	}
+
+	// 已存在的文件以及正在下载中的文件都不能使用
+	os.WriteFile(filepath.Join(root, "1 (1).mp4"), []byte("1"), 0644)
+	os.WriteFile(filepath.Join(root, "1 (2).mp4"+DownloadPartSuffix), []byte("1"), 0644)
+	os.WriteFile(filepath.Join(root, "1 (3).mp4"+DownloadSuffix), []byte("1"), 0644)
+	if got := NextAvailableSavePath(p, root); got != filepath.Join(root, "1 (4).mp4") {
+		t.Fatalf("next path: %s", got)
+	}
+}
+
+func newOnExistUnit(root, savePath, policy string, fileInfo *aliyunpan.FileEntity) (*DownloadTaskUnit, *recordReporter) {
+	r := &recordReporter{}
+	dtu := newReportUnit(r)
+	dtu.SavePath = savePath
+	dtu.OriginSaveRootPath = root
+	dtu.OnExist = policy
+	dtu.fileInfo = fileInfo
+	return dtu, r
+}
+
+func TestResolveExistedFile(t *testing.T) {
+	root := t.TempDir()
+	p := filepath.Join(root, "a.txt")
+	os.WriteFile(p, []byte("hellx"), 0644)
+	changed := &aliyunpan.FileEntity{FileSize: 5, ContentHash: helloSha1}
+
+	cases := []struct {
+		policy    string
+		fileInfo  *aliyunpan.FileEntity
+		skip      bool
+		savePath  string
+		overwrite bool
+		event     DownloadEventType
+	}{
+		// 未指定策略时跳过，兼容旧版本
+		{"", changed, true, p, false, DownloadEventSkip},
+		{OnExistSkip, changed, true, p, false, DownloadEventSkip},
+		{OnExistOverwrite, changed, false, p, false, ""},
+		{OnExistRename, changed, false, filepath.Join(root, "a (1).txt"), false, DownloadEventInfo},
+	}
+	for i, c := range cases {
+		dtu, r := newOnExistUnit(root, p, c.policy, c.fileInfo)
+		if skip := dtu.resolveExistedFile(); skip != c.skip {
+			t.Errorf("case %d: skip %v, want %v", i, skip, c.skip)
+		}
+		if dtu.SavePath != c.savePath || dtu.IsOverwrite != c.overwrite {
+			t.Errorf("case %d: save path %s, overwrite %v", i, dtu.SavePath, dtu.IsOverwrite)
+		}
+		if c.event == "" {
+			if len(r.events) != 0 {
+				t.Errorf("case %d: unexpected events %v", i, r.events)
+			}
+		} else if len(r.events) != 1 || r.events[0].Type != c.event {
+			t.Errorf("case %d: events %v", i, r.events)
+		}
+	}
+	// 本地文件不会被删除或修改
+	if data, _ := os.ReadFile(p); string(data) != "hellx" {
+		t.Fatal("local file should be kept")
+	}
+}
+
+func TestResolveExistedFileSameContent(t *testing.T) {
+	root := t.TempDir()
+	p := filepath.Join(root, "a.txt")
+	os.WriteFile(p, []byte("hello"), 0644)
+	dtu, r := newOnExistUnit(root, p, OnExistRename, &aliyunpan.FileEntity{FileSize: 5, ContentHash: helloSha1})
+	if !dtu.resolveExistedFile() {
+		t.Fatal("same content should be skipped")
+	}
+	if dtu.SavePath != p || len(r.events) != 1 || r.events[0].Type != DownloadEventSkip {
+		t.Fatalf("save path %s, events %v", dtu.SavePath, r.events)
+	}
+}
+
+func TestResolveDecryptPath(t *testing.T) {
+	root := t.TempDir()
+	plain := filepath.Join(root, "a.txt")
+	none := filepath.Join(root, "none.txt")
+	os.WriteFile(plain, []byte("plain"), 0644)
+
+	dtu, _ := newOnExistUnit(root, plain+".aenc", OnExistSkip, nil)
+	if got, ok := dtu.resolveDecryptPath(none); !ok || got != none {
+		t.Fatalf("not existed: %s %v", got, ok)
+	}
+	if _, ok := dtu.resolveDecryptPath(plain); ok {
+		t.Fatal("existed plain file should be skipped")
+	}
+	// 加密文件选择了覆盖，解密后的文件同样覆盖
+	dtu.IsOverwrite = true
+	if got, ok := dtu.resolveDecryptPath(plain); !ok || got != plain {
+		t.Fatalf("overwrite: %s %v", got, ok)
+	}
+	dtu, _ = newOnExistUnit(root, plain+".aenc", OnExistRename, nil)
+	if got, ok := dtu.resolveDecryptPath(plain); !ok || got != filepath.Join(root, "a (1).txt") {
+		t.Fatalf("rename: %s %v", got, ok)
+	}
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/tickstep/aliyunpan-api/aliyunpan"
 	"github.com/tickstep/aliyunpan/internal/localfile"
 	"os"
+	"strings"
 )
 
 // CheckFileValid 检测文件有效性
@@ -27,6 +28,36 @@ func CheckFileValid(filePath string, fileInfo *aliyunpan.FileEntity) error {
 	return nil
 }
 
+// IsSha1Supported 网盘文件是否记录了SHA1，可以用于校验下载的文件
+func IsSha1Supported(fileInfo *aliyunpan.FileEntity) bool {
+	return fileInfo != nil && fileInfo.ContentHash != "" && (fileInfo.ContentHashName == "" || strings.EqualFold(fileInfo.ContentHashName, "sha1"))
+}
+
+// VerifyFileSha1 计算本地文件的SHA1并与网盘记录的ContentHash比较
+func VerifyFileSha1(filePath string, fileInfo *aliyunpan.FileEntity) error {
+	if !IsSha1Supported(fileInfo) {
+		return ErrDownloadNotSupportChecksum
+	}
+	fileSum := localfile.NewLocalSymlinkFileEntity(localfile.NewSymlinkFile(filePath))
+	if err := fileSum.OpenPath(); err != nil {
+		return err
+	}
+	defer fileSum.Close()
+	fileSum.Sum(localfile.CHECKSUM_SHA1)
+	return CompareSha1(fileSum.SHA1, fileInfo)
+}
+
+// CompareSha1 比较已经计算好的SHA1与网盘记录的ContentHash
+func CompareSha1(sha1 string, fileInfo *aliyunpan.FileEntity) error {
+	if !IsSha1Supported(fileInfo) {
+		return ErrDownloadNotSupportChecksum
+	}
+	if !strings.EqualFold(sha1, fileInfo.ContentHash) {
+		return ErrDownloadSha1Mismatch
+	}
+	return nil
+}
+
 // FileExist 检查文件是否存在
 //
 // 只有当文件存在, 文件大小不为0或断点续传文件不存在时, 才判断为存在
@@ -0,0 +1,182 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pantag 网盘文件自定义标签。网盘不支持保存自定义标签，标签保存在账号数据目录下的本地索引中
+package pantag
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+)
+
+const (
+	// TagIndexFileName 标签索引文件名
+	TagIndexFileName = "aliyunpan_tags.json"
+)
+
+type (
+	// TaggedFile 打了标签的网盘文件
+	TaggedFile struct {
+		DriveId  string   `json:"driveId"`
+		FileId   string   `json:"fileId"`
+		Path     string   `json:"path"` // 打标签时文件的网盘路径
+		IsFolder bool     `json:"isFolder"`
+		Tags     []string `json:"tags"`
+	}
+
+	// TagCount 标签以及标签下的文件数量
+	TagCount struct {
+		Tag   string
+		Count int
+	}
+
+	// TagIndex 标签索引
+	TagIndex struct {
+		Files []*TaggedFile `json:"files"`
+
+		filePath string
+	}
+)
+
+// LoadTagIndex 加载数据目录下的标签索引，文件不存在返回空索引
+func LoadTagIndex(dataDir string) (*TagIndex, error) {
+	ti := &TagIndex{
+		Files:    []*TaggedFile{},
+		filePath: filepath.Join(dataDir, TagIndexFileName),
+	}
+	data, err := os.ReadFile(ti.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ti, nil
+		}
+		return nil, err
+	}
+	if len(data) == 0 {
+		return ti, nil
+	}
+	if err = json.Unmarshal(data, ti); err != nil {
+		return nil, err
+	}
+	return ti, nil
+}
+
+// Save 保存标签索引，先写入临时文件再替换，避免保存过程中退出导致索引损坏
+func (ti *TagIndex) Save() error {
+	data, err := json.MarshalIndent(ti, "", " ")
+	if err != nil {
+		return err
+	}
+	tempFilePath := ti.filePath + ".tmp"
+	if err = os.WriteFile(tempFilePath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tempFilePath, ti.filePath)
+}
+
+// NormalizeTag 去掉标签首尾空白
+func NormalizeTag(tag string) string {
+	return strings.TrimSpace(tag)
+}
+
+func (ti *TagIndex) find(driveId, fileId string) (int, *TaggedFile) {
+	for i, f := range ti.Files {
+		if f.DriveId == driveId && f.FileId == fileId {
+			return i, f
+		}
+	}
+	return -1, nil
+}
+
+// AddTag 给文件打标签，文件已经有该标签返回false
+func (ti *TagIndex) AddTag(driveId string, fe *aliyunpan.FileEntity, tag string) bool {
+	_, f := ti.find(driveId, fe.FileId)
+	if f == nil {
+		f = &TaggedFile{
+			DriveId: driveId,
+			FileId:  fe.FileId,
+		}
+		ti.Files = append(ti.Files, f)
+	}
+	// 更新文件路径，文件移动后重新打标签可以修正路径
+	f.Path = fe.Path
+	f.IsFolder = fe.IsFolder()
+	for _, t := range f.Tags {
+		if t == tag {
+			return false
+		}
+	}
+	f.Tags = append(f.Tags, tag)
+	return true
+}
+
+// RemoveTag 移除文件的标签，文件没有该标签返回false。没有任何标签的文件会从索引中删除
+func (ti *TagIndex) RemoveTag(driveId, fileId, tag string) bool {
+	idx, f := ti.find(driveId, fileId)
+	if f == nil {
+		return false
+	}
+	for i, t := range f.Tags {
+		if t == tag {
+			f.Tags = append(f.Tags[:i], f.Tags[i+1:]...)
+			if len(f.Tags) == 0 {
+				ti.Files = append(ti.Files[:idx], ti.Files[idx+1:]...)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// FilesByTag 获取网盘下打了该标签的所有文件
+func (ti *TagIndex) FilesByTag(driveId, tag string) []*TaggedFile {
+	files := []*TaggedFile{}
+	for _, f := range ti.Files {
+		if f.DriveId != driveId {
+			continue
+		}
+		for _, t := range f.Tags {
+			if t == tag {
+				files = append(files, f)
+				break
+			}
+		}
+	}
+	return files
+}
+
+// Tags 获取网盘下的所有标签以及文件数量，按标签名称排序
+func (ti *TagIndex) Tags(driveId string) []*TagCount {
+	counts := map[string]int{}
+	for _, f := range ti.Files {
+		if f.DriveId != driveId {
+			continue
+		}
+		for _, t := range f.Tags {
+			counts[t]++
+		}
+	}
+	tags := make([]*TagCount, 0, len(counts))
+	for t, c := range counts {
+		tags = append(tags, &TagCount{Tag: t, Count: c})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].Tag < tags[j].Tag
+	})
+	return tags
+}
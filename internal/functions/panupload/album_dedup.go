@@ -0,0 +1,106 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panupload
+
+import (
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/library-go/logger"
+)
+
+type (
+	// AlbumDedupIndex 相册盘照片内容索引，按照SHA1查找相册盘中是否已经存在相同内容的照片。所有方法都支持nil调用
+	AlbumDedupIndex struct {
+		files map[string]string // SHA1 => 照片网盘路径
+		mutex sync.Mutex
+	}
+)
+
+// NewAlbumDedupIndex 遍历相册盘所有文件建立SHA1索引
+func NewAlbumDedupIndex(panClient *config.PanClient, albumDriveId string) (*AlbumDedupIndex, error) {
+	return buildAlbumDedupIndex(func(folderId string) (aliyunpan.FileList, error) {
+		fileList, err := panClient.OpenapiPanClient().FileListGetAll(&aliyunpan.FileListParam{
+			DriveId:      albumDriveId,
+			ParentFileId: folderId,
+		}, 500)
+		if err != nil {
+			return nil, err
+		}
+		return fileList, nil
+	})
+}
+
+// buildAlbumDedupIndex 从根目录开始逐层获取文件列表建立SHA1索引
+func buildAlbumDedupIndex(listAll func(folderId string) (aliyunpan.FileList, error)) (*AlbumDedupIndex, error) {
+	idx := &AlbumDedupIndex{
+		files: map[string]string{},
+	}
+	folders := []*aliyunpan.FileEntity{
+		{FileId: aliyunpan.DefaultRootParentFileId, Path: "/"},
+	}
+	for len(folders) > 0 {
+		folder := folders[0]
+		folders = folders[1:]
+		fileList, err := listAll(folder.FileId)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range fileList {
+			f.Path = path.Join(folder.Path, f.FileName)
+			if f.IsFolder() {
+				folders = append(folders, f)
+				continue
+			}
+			if f.ContentHash != "" {
+				idx.files[strings.ToLower(f.ContentHash)] = f.Path
+			}
+		}
+	}
+	logger.Verbosef("album dedup index built, %d files\n", len(idx.files))
+	return idx, nil
+}
+
+// Count 索引的照片数量
+func (idx *AlbumDedupIndex) Count() int {
+	if idx == nil {
+		return 0
+	}
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+	return len(idx.files)
+}
+
+// Find 查找相同内容的照片，返回照片的网盘路径，不存在返回空字符串
+func (idx *AlbumDedupIndex) Find(sha1Str string) string {
+	if idx == nil || sha1Str == "" {
+		return ""
+	}
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+	return idx.files[strings.ToLower(sha1Str)]
+}
+
+// Add 上传成功的照片加入索引，避免同一批次中相同内容的照片重复上传
+func (idx *AlbumDedupIndex) Add(sha1Str, panFilePath string) {
+	if idx == nil || sha1Str == "" {
+		return
+	}
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+	idx.files[strings.ToLower(sha1Str)] = panFilePath
+}
@@ -0,0 +1,66 @@
+package panupload
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+)
+
+func TestAlbumDedupIndex(t *testing.T) {
+	tree := map[string]aliyunpan.FileList{
+		aliyunpan.DefaultRootParentFileId: {
+			{FileId: "1", FileName: "a.jpg", FileType: "file", ContentHash: "AAF4C61DDCC5E8A2DABEDE0F3B482CD9AEA9434D"},
+			{FileId: "2", FileName: "2024", FileType: "folder"},
+		},
+		"2": {
+			{FileId: "3", FileName: "b.jpg", FileType: "file", ContentHash: "bbbb"},
+			// 没有SHA1的文件不加入索引
+			{FileId: "4", FileName: "c.jpg", FileType: "file"},
+		},
+	}
+	idx, err := buildAlbumDedupIndex(func(folderId string) (aliyunpan.FileList, error) {
+		return tree[folderId], nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx.Count() != 2 {
+		t.Fatalf("count %d", idx.Count())
+	}
+	// SHA1不区分大小写
+	if p := idx.Find("aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d"); p != "/a.jpg" {
+		t.Fatalf("find: %s", p)
+	}
+	if p := idx.Find("BBBB"); p != "/2024/b.jpg" {
+		t.Fatalf("find: %s", p)
+	}
+	if idx.Find("cccc") != "" || idx.Find("") != "" {
+		t.Fatal("unknown photo should not be found")
+	}
+
+	// 同一批次中上传成功的照片
+	idx.Add("CCCC", "/2024/d.jpg")
+	idx.Add("", "/2024/e.jpg")
+	if p := idx.Find("cccc"); p != "/2024/d.jpg" || idx.Count() != 3 {
+		t.Fatalf("find after add: %s, count %d", p, idx.Count())
+	}
+
+	var nilIdx *AlbumDedupIndex
+	nilIdx.Add("aaaa", "/a.jpg")
+	if nilIdx.Find("aaaa") != "" || nilIdx.Count() != 0 {
+		t.Fatal("nil index should be empty")
+	}
+}
+
+func TestAlbumDedupIndexListError(t *testing.T) {
+	_, err := buildAlbumDedupIndex(func(folderId string) (aliyunpan.FileList, error) {
+		if folderId == "2" {
+			return nil, errors.New("list failed")
+		}
+		return aliyunpan.FileList{{FileId: "2", FileName: "2024", FileType: "folder"}}, nil
+	})
+	if err == nil {
+		t.Fatal("list error should be returned")
+	}
+}
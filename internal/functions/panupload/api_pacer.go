@@ -0,0 +1,105 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panupload
+
+import (
+	"sync"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/taskframework"
+	"github.com/tickstep/library-go/logger"
+)
+
+const (
+	// apiPacerMaxInterval 被限流时请求间隔的上限
+	apiPacerMaxInterval = 30 * time.Second
+)
+
+type (
+	// ApiPacer 上传准备阶段网盘API请求的节流器，所有上传任务共享。
+	// 正常情况下按照每秒最大请求数均匀发出请求；被限流时带随机抖动的指数退避暂停所有请求，并加大请求间隔，
+	// 之后每次请求成功逐渐缩短请求间隔，直到恢复到每秒最大请求数。所有方法都支持nil调用
+	ApiPacer struct {
+		minInterval time.Duration // 每秒最大请求数对应的请求间隔
+		interval    time.Duration // 当前的请求间隔
+		next        time.Time     // 下一个请求最早的开始时间
+		limited     int           // 连续被限流的次数
+		backoff     *taskframework.RetryBackoff
+		mutex       sync.Mutex
+	}
+)
+
+// NewApiPacer 创建API请求节流器，qps为每秒最大请求数，小于等于0使用默认值
+func NewApiPacer(qps int) *ApiPacer {
+	if qps <= 0 {
+		qps = config.DefaultUploadApiQps
+	}
+	minInterval := time.Second / time.Duration(qps)
+	return &ApiPacer{
+		minInterval: minInterval,
+		interval:    minInterval,
+		backoff: &taskframework.RetryBackoff{
+			Strategy: taskframework.BackoffJitter,
+			Base:     2 * time.Second,
+			Max:      60 * time.Second,
+		},
+	}
+}
+
+// Wait 等待到可以发出下一个请求
+func (p *ApiPacer) Wait() {
+	if p == nil {
+		return
+	}
+	p.mutex.Lock()
+	now := time.Now()
+	start := p.next
+	if start.Before(now) {
+		start = now
+	}
+	p.next = start.Add(p.interval)
+	p.mutex.Unlock()
+	time.Sleep(start.Sub(now))
+}
+
+// Done 记录请求结果，被限流时退避并降低请求频率，请求成功时逐渐恢复请求频率
+func (p *ApiPacer) Done(err *apierror.ApiError) {
+	if p == nil {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if err != nil && (err.Code == apierror.ApiCodeTooManyRequests || err.Code == apierror.ApiCodeBadGateway) {
+		p.limited++
+		p.interval *= 2
+		if p.interval > apiPacerMaxInterval {
+			p.interval = apiPacerMaxInterval
+		}
+		pause := p.backoff.Wait(p.limited)
+		if next := time.Now().Add(pause); next.After(p.next) {
+			p.next = next
+		}
+		logger.Verbosef("网盘API请求被限流, 暂停 %s, 请求间隔调整为 %s\n", pause, p.interval)
+		return
+	}
+	p.limited = 0
+	if p.interval > p.minInterval {
+		p.interval = p.interval * 3 / 4
+		if p.interval < p.minInterval {
+			p.interval = p.minInterval
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package panupload
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
+	"github.com/tickstep/aliyunpan/internal/config"
+)
+
+func TestNewApiPacer(t *testing.T) {
+	cases := []struct {
+		qps  int
+		want time.Duration
+	}{
+		{10, 100 * time.Millisecond},
+		{1, time.Second},
+		{0, time.Second / config.DefaultUploadApiQps},
+		{-1, time.Second / config.DefaultUploadApiQps},
+	}
+	for _, c := range cases {
+		p := NewApiPacer(c.qps)
+		if p.minInterval != c.want || p.interval != c.want {
+			t.Errorf("qps %d: interval %s, want %s", c.qps, p.interval, c.want)
+		}
+	}
+}
+
+func TestApiPacerDone(t *testing.T) {
+	limited := apierror.NewApiError(apierror.ApiCodeTooManyRequests, "too many requests")
+	badGateway := apierror.NewApiError(apierror.ApiCodeBadGateway, "bad gateway")
+	other := apierror.NewApiError(apierror.ApiCodeFailed, "failed")
+	cases := []struct {
+		name     string
+		results  []*apierror.ApiError
+		interval time.Duration
+		limited  int
+		paused   bool
+	}{
+		{"请求成功", []*apierror.ApiError{nil, nil}, 100 * time.Millisecond, 0, false},
+		{"其他错误不退避", []*apierror.ApiError{other}, 100 * time.Millisecond, 0, false},
+		{"被限流", []*apierror.ApiError{limited}, 200 * time.Millisecond, 1, true},
+		{"网关错误", []*apierror.ApiError{badGateway, limited}, 400 * time.Millisecond, 2, true},
+		{"限流后逐渐恢复", []*apierror.ApiError{limited, limited, nil}, 300 * time.Millisecond, 0, true},
+		{"恢复到最小间隔", []*apierror.ApiError{limited, nil, nil, nil}, 100 * time.Millisecond, 0, true},
+		{"间隔不超过上限", []*apierror.ApiError{limited, limited, limited, limited, limited, limited, limited, limited, limited}, apiPacerMaxInterval, 9, true},
+	}
+	for _, c := range cases {
+		p := NewApiPacer(10)
+		start := time.Now()
+		for _, r := range c.results {
+			p.Done(r)
+		}
+		if p.interval != c.interval || p.limited != c.limited {
+			t.Errorf("%s: interval %s, limited %d, want %s, %d", c.name, p.interval, p.limited, c.interval, c.limited)
+		}
+		if paused := p.next.After(start); paused != c.paused {
+			t.Errorf("%s: paused %v, want %v", c.name, paused, c.paused)
+		}
+	}
+}
+
+func TestApiPacerWait(t *testing.T) {
+	p := NewApiPacer(50)
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		p.Wait()
+	}
+	// 第一个请求立即发出，之后每个请求间隔20ms
+	if d := time.Since(start); d < 60*time.Millisecond {
+		t.Fatalf("requests not paced: %s", d)
+	}
+
+	var nilPacer *ApiPacer
+	nilPacer.Wait()
+	nilPacer.Done(apierror.NewApiError(apierror.ApiCodeTooManyRequests, "too many requests"))
+}
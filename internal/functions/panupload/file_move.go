@@ -0,0 +1,86 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panupload
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/localfile"
+	"github.com/tickstep/library-go/logger"
+)
+
+// CalcLocalFileSha1 计算本地文件SHA1，文件不可读返回空字符串
+func CalcLocalFileSha1(localPath string) string {
+	fileSum := localfile.NewLocalFileEntity(localPath)
+	if err := fileSum.OpenPath(); err != nil {
+		logger.Verbosef("文件不可读, 错误信息: %s\n", err)
+		return ""
+	}
+	defer fileSum.Close()
+	logger.Verbosef("正在计算文件SHA1: %s\n", localPath)
+	fileSum.Sum(localfile.CHECKSUM_SHA1)
+	return strings.ToLower(fileSum.SHA1)
+}
+
+// MovePanFile 移动/重命名云盘文件到指定路径，目标文件夹不存在会自动创建。
+// 本地文件被移动或者重命名后，直接移动网盘中对应的文件，避免重新上传。mkdirMutex 用于和其他创建文件夹的操作互斥，可以为nil
+func MovePanFile(panClient *config.PanClient, driveId, fileId, srcPanPath, targetPanPath string, mkdirMutex *sync.Mutex) error {
+	targetPanPath = path.Clean(strings.ReplaceAll(targetPanPath, "\\", "/"))
+	targetDir := path.Dir(targetPanPath)
+	targetName := path.Base(targetPanPath)
+	openClient := panClient.OpenapiPanClient()
+
+	if path.Dir(srcPanPath) != targetDir {
+		targetDirId := aliyunpan.DefaultRootParentFileId
+		if targetDir != "/" {
+			if mkdirMutex != nil {
+				mkdirMutex.Lock()
+			}
+			rs, err := openClient.MkdirByFullPath(driveId, targetDir)
+			if mkdirMutex != nil {
+				mkdirMutex.Unlock()
+			}
+			if err != nil {
+				return err
+			}
+			if rs == nil || rs.FileId == "" {
+				return fmt.Errorf("创建云盘文件夹失败: %s", targetDir)
+			}
+			targetDirId = rs.FileId
+		}
+		r, err := openClient.FileMove(&aliyunpan.FileMoveParam{
+			DriveId:        driveId,
+			FileId:         fileId,
+			ToDriveId:      driveId,
+			ToParentFileId: targetDirId,
+		})
+		if err != nil {
+			return err
+		}
+		if r == nil || !r.Success {
+			return fmt.Errorf("移动云盘文件失败: %s", srcPanPath)
+		}
+	}
+	if path.Base(srcPanPath) != targetName {
+		if _, err := openClient.FileRename(driveId, fileId, targetName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
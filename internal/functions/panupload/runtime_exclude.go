@@ -0,0 +1,114 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panupload
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tickstep/library-go/logger"
+)
+
+const (
+	// runtimeExcludeCheckInterval 检测排除规则文件变化的最小间隔
+	runtimeExcludeCheckInterval = 2 * time.Second
+)
+
+type (
+	// RuntimeExcluder 运行时排除规则，上传过程中修改规则文件即可动态增加排除规则。
+	// 规则文件每行一个正则表达式，匹配本地文件的完整路径，空行和#开头的行会被忽略。所有方法都支持nil调用
+	RuntimeExcluder struct {
+		filePath  string
+		rules     []*regexp.Regexp
+		modTime   time.Time
+		lastCheck time.Time
+		mutex     sync.Mutex
+	}
+)
+
+// NewRuntimeExcluder 创建运行时排除规则，filePath为空返回nil
+func NewRuntimeExcluder(filePath string) *RuntimeExcluder {
+	if filePath == "" {
+		return nil
+	}
+	re := &RuntimeExcluder{
+		filePath: filePath,
+	}
+	re.reload()
+	return re
+}
+
+// reload 规则文件有变化则重新加载
+func (re *RuntimeExcluder) reload() {
+	re.lastCheck = time.Now()
+	info, err := os.Stat(re.filePath)
+	if err != nil {
+		if len(re.rules) > 0 {
+			logger.Verboseln("runtime exclude file is removed, clear all rules")
+		}
+		re.rules = nil
+		re.modTime = time.Time{}
+		return
+	}
+	if info.ModTime().Equal(re.modTime) {
+		return
+	}
+	re.modTime = info.ModTime()
+
+	f, err := os.Open(re.filePath)
+	if err != nil {
+		logger.Verboseln("open runtime exclude file error: ", err)
+		return
+	}
+	defer f.Close()
+	rules := []*regexp.Regexp{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r, e := regexp.Compile(line)
+		if e != nil {
+			logger.Verbosef("无效的排除规则: %s, %s\n", line, e)
+			continue
+		}
+		rules = append(rules, r)
+	}
+	re.rules = rules
+	logger.Verbosef("加载运行时排除规则: %d 条\n", len(rules))
+}
+
+// IsExcluded 本地文件是否被排除
+func (re *RuntimeExcluder) IsExcluded(localFilePath string) bool {
+	if re == nil {
+		return false
+	}
+	re.mutex.Lock()
+	defer re.mutex.Unlock()
+	if time.Since(re.lastCheck) >= runtimeExcludeCheckInterval {
+		re.reload()
+	}
+	p := strings.ReplaceAll(localFilePath, "\\", "/")
+	for _, r := range re.rules {
+		if r.MatchString(p) {
+			return true
+		}
+	}
+	return false
+}
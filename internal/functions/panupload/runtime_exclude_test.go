@@ -0,0 +1,55 @@
+package panupload
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRuntimeExcluder(t *testing.T) {
+	var nilExcluder *RuntimeExcluder
+	if nilExcluder.IsExcluded("/data/a.txt") || NewRuntimeExcluder("") != nil {
+		t.Fatal("nil excluder should not exclude anything")
+	}
+
+	ruleFile := filepath.Join(t.TempDir(), "exclude.txt")
+	// 规则文件可以在上传开始之后才创建
+	re := NewRuntimeExcluder(ruleFile)
+	if re.IsExcluded("/data/tmp/a.txt") {
+		t.Fatal("no rules yet")
+	}
+
+	os.WriteFile(ruleFile, []byte("# 临时文件\n\n/tmp/\n[invalid\n\\.log$\n"), 0644)
+	// 检测间隔内不重新加载规则
+	if re.IsExcluded("/data/tmp/a.txt") {
+		t.Fatal("rules should not be reloaded within check interval")
+	}
+	re.lastCheck = time.Time{}
+	cases := []struct {
+		path     string
+		excluded bool
+	}{
+		{"/data/tmp/a.txt", true},
+		{"C:\\data\\tmp\\a.txt", true},
+		{"/data/app.log", true},
+		{"/data/app.log.txt", false},
+		{"/data/a.txt", false},
+	}
+	for _, c := range cases {
+		if got := re.IsExcluded(c.path); got != c.excluded {
+			t.Errorf("IsExcluded(%s) = %v, want %v", c.path, got, c.excluded)
+		}
+	}
+	// 无效的规则被忽略
+	if len(re.rules) != 2 {
+		t.Fatalf("rules: %v", re.rules)
+	}
+
+	// 规则文件被删除，清空全部规则
+	os.Remove(ruleFile)
+	re.lastCheck = time.Time{}
+	if re.IsExcluded("/data/tmp/a.txt") {
+		t.Fatal("rules should be cleared")
+	}
+}
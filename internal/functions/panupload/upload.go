@@ -17,6 +17,8 @@ import (
 	"context"
 	"encoding/xml"
 	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/functions"
+	"github.com/tickstep/aliyunpan/internal/utils"
 	"github.com/tickstep/library-go/logger"
 	"github.com/tickstep/library-go/requester"
 	"io"
@@ -110,9 +112,8 @@ func (pu *PanUpload) UploadFile(ctx context.Context, partseq int, partOffset int
 
 		// do http upload request
 		if uploadClient == nil {
-			uploadClient = requester.NewHTTPClient()
+			uploadClient = config.Config.TransferHTTPClient()
 			uploadClient.SetTimeout(0)
-			uploadClient.SetKeepAlive(true)
 		}
 		resp, err = uploadClient.Req(httpMethod, fullUrl, r, headers)
 		if err != nil {
@@ -145,7 +146,10 @@ func (pu *PanUpload) UploadFile(ctx context.Context, partseq int, partOffset int
 									NeedStartOver: false,
 								}
 								return resp, respError
-							} else if "AccessDenied" == errResp.Code && "Request has expired." == errResp.Message {
+							} else if ("AccessDenied" == errResp.Code && "Request has expired." == errResp.Message) || "RequestTimeTooSkewed" == errResp.Code {
+								// 链接签名过期，可能是本地时钟偏差导致提前使用了过期的链接，根据服务器时间重新校准
+								utils.UpdateServerTimeByHeader(resp.Header, time.Now())
+								functions.WarnClockSkew()
 								respError = uploader.UploadUrlExpired
 								respErr = &uploader.MultiError{
 									Err:        uploader.UploadUrlExpired,
@@ -0,0 +1,218 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panupload
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tickstep/library-go/converter"
+)
+
+const (
+	// DefaultAutoTuneTrial 自动调优每组参数的尝试时间
+	DefaultAutoTuneTrial = 30 * time.Second
+
+	minAutoTuneBlockSize = 1 * converter.MB
+	maxAutoTuneBlockSize = 50 * converter.MB
+)
+
+type (
+	// AutoTuneTrial 自动调优尝试的一组参数以及测得的速度
+	AutoTuneTrial struct {
+		Parallel  int   // 文件并发数
+		BlockSize int64 // 分片大小
+		Speed     int64 // 平均速度，单位：字节/秒
+	}
+
+	// UploadAutoTuner 上传批次的自动参数调优。批次开始后依次尝试几组文件并发数，再用最快的并发数尝试不同的分片大小，
+	// 每组参数上传一段时间并统计速度，全部尝试完成后锁定最快的组合。尝试期间上传的文件照常计入任务。所有方法都支持nil调用
+	UploadAutoTuner struct {
+		trialDuration time.Duration
+		baseBlockSize int64
+		trials        []*AutoTuneTrial
+		parallelCount int // 前parallelCount组是文件并发数的尝试
+		current       int
+		locked        bool
+
+		trialStart time.Time
+		trialBytes int64
+		running    int
+		cond       *sync.Cond
+		mutex      sync.Mutex
+	}
+)
+
+// NewUploadAutoTuner 创建自动调优，maxParallel为文件并发数上限，blockSize为基准分片大小
+func NewUploadAutoTuner(maxParallel int, blockSize int64, trialDuration time.Duration) *UploadAutoTuner {
+	if maxParallel < 1 {
+		maxParallel = 1
+	}
+	if trialDuration <= 0 {
+		trialDuration = DefaultAutoTuneTrial
+	}
+	t := &UploadAutoTuner{
+		trialDuration: trialDuration,
+		baseBlockSize: blockSize,
+	}
+	t.cond = sync.NewCond(&t.mutex)
+	for _, p := range []int{maxParallel / 4, maxParallel / 2, maxParallel} {
+		if p < 1 || (len(t.trials) > 0 && t.trials[len(t.trials)-1].Parallel == p) {
+			continue
+		}
+		t.trials = append(t.trials, &AutoTuneTrial{Parallel: p, BlockSize: blockSize})
+	}
+	t.parallelCount = len(t.trials)
+	return t
+}
+
+// MaxParallel 文件并发数上限，任务执行器按照该值设置并发数
+func (t *UploadAutoTuner) MaxParallel(defaultParallel int) int {
+	if t == nil {
+		return defaultParallel
+	}
+	return t.trials[t.parallelCount-1].Parallel
+}
+
+// Acquire 获取上传名额，正在上传的文件数达到当前尝试的并发数时阻塞
+func (t *UploadAutoTuner) Acquire() {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.trialStart.IsZero() {
+		// 第一个文件开始上传时开始计时
+		t.trialStart = time.Now()
+		t.printTrialLocked()
+	}
+	t.advanceLocked(time.Now())
+	for t.running >= t.trials[t.current].Parallel {
+		t.cond.Wait()
+	}
+	t.running++
+}
+
+// Release 释放上传名额
+func (t *UploadAutoTuner) Release() {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.running--
+	t.advanceLocked(time.Now())
+	t.cond.Broadcast()
+}
+
+// BlockSize 当前尝试的分片大小，只对开始上传的新文件生效
+func (t *UploadAutoTuner) BlockSize(defaultBlockSize int64) int64 {
+	if t == nil {
+		return defaultBlockSize
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.trials[t.current].BlockSize
+}
+
+// Add 记录上传的数据量
+func (t *UploadAutoTuner) Add(n int64) {
+	if t == nil || n <= 0 {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.advanceLocked(time.Now())
+	t.trialBytes += n
+}
+
+// advanceLocked 当前参数的尝试时间已到，统计速度并切换到下一组参数，调用方需持有锁
+func (t *UploadAutoTuner) advanceLocked(now time.Time) {
+	if t.locked || t.trialStart.IsZero() {
+		return
+	}
+	elapsed := now.Sub(t.trialStart)
+	if elapsed < t.trialDuration {
+		return
+	}
+	t.trials[t.current].Speed = int64(float64(t.trialBytes) / elapsed.Seconds())
+	t.current++
+	if t.current == t.parallelCount {
+		// 文件并发数尝试完成，用最快的并发数尝试不同的分片大小
+		best := t.bestLocked()
+		if half := t.baseBlockSize / 2; half >= minAutoTuneBlockSize {
+			t.trials = append(t.trials, &AutoTuneTrial{Parallel: best.Parallel, BlockSize: half})
+		}
+		if double := t.baseBlockSize * 2; double <= maxAutoTuneBlockSize {
+			t.trials = append(t.trials, &AutoTuneTrial{Parallel: best.Parallel, BlockSize: double})
+		}
+	}
+	if t.current >= len(t.trials) {
+		best := t.bestLocked()
+		t.current = t.indexOf(best)
+		t.locked = true
+		fmt.Printf("[0] 自动调优完成, 锁定文件并发数: %d, 分片大小: %s, 平均速度: %s/s\n",
+			best.Parallel, converter.ConvertFileSize(best.BlockSize, 2), converter.ConvertFileSize(best.Speed, 2))
+	} else {
+		t.trialStart = now
+		t.trialBytes = 0
+		t.printTrialLocked()
+	}
+	t.cond.Broadcast()
+}
+
+// bestLocked 已经完成尝试的参数中速度最快的一组，调用方需持有锁
+func (t *UploadAutoTuner) bestLocked() *AutoTuneTrial {
+	best := t.trials[0]
+	for _, trial := range t.trials[:t.current] {
+		if trial.Speed > best.Speed {
+			best = trial
+		}
+	}
+	return best
+}
+
+func (t *UploadAutoTuner) indexOf(trial *AutoTuneTrial) int {
+	for k, item := range t.trials {
+		if item == trial {
+			return k
+		}
+	}
+	return 0
+}
+
+func (t *UploadAutoTuner) printTrialLocked() {
+	trial := t.trials[t.current]
+	fmt.Printf("[0] 自动调优: 尝试文件并发数: %d, 分片大小: %s\n", trial.Parallel, converter.ConvertFileSize(trial.BlockSize, 2))
+}
+
+// Finish 上传结束时还没有完成全部尝试，输出已经测得的最快组合
+func (t *UploadAutoTuner) Finish() {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.locked || t.trialStart.IsZero() {
+		return
+	}
+	t.advanceLocked(time.Now())
+	if t.locked || t.current == 0 {
+		return
+	}
+	best := t.bestLocked()
+	fmt.Printf("[0] 上传已结束, 自动调优未完成全部尝试, 目前最快的组合: 文件并发数: %d, 分片大小: %s, 平均速度: %s/s\n",
+		best.Parallel, converter.ConvertFileSize(best.BlockSize, 2), converter.ConvertFileSize(best.Speed, 2))
+}
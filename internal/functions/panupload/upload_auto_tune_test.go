@@ -0,0 +1,122 @@
+package panupload
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tickstep/library-go/converter"
+)
+
+func TestNewUploadAutoTuner(t *testing.T) {
+	cases := []struct {
+		maxParallel int
+		want        []int
+	}{
+		{8, []int{2, 4, 8}},
+		{3, []int{1, 3}},
+		{2, []int{1, 2}},
+		{1, []int{1}},
+		{0, []int{1}},
+	}
+	for _, c := range cases {
+		tuner := NewUploadAutoTuner(c.maxParallel, 10*converter.MB, 0)
+		if tuner.trialDuration != DefaultAutoTuneTrial {
+			t.Errorf("max %d: trial duration %s", c.maxParallel, tuner.trialDuration)
+		}
+		got := []int{}
+		for _, trial := range tuner.trials {
+			got = append(got, trial.Parallel)
+		}
+		if len(got) != len(c.want) || tuner.parallelCount != len(c.want) {
+			t.Errorf("max %d: parallel trials %v, want %v", c.maxParallel, got, c.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Errorf("max %d: parallel trials %v, want %v", c.maxParallel, got, c.want)
+				break
+			}
+		}
+		if p := tuner.MaxParallel(100); p != c.want[len(c.want)-1] {
+			t.Errorf("max %d: max parallel %d", c.maxParallel, p)
+		}
+	}
+}
+
+func TestUploadAutoTunerLock(t *testing.T) {
+	cases := []struct {
+		name        string
+		maxParallel int
+		blockSize   int64
+		bytes       []int64 // 每组参数尝试期间上传的数据量
+		parallel    int
+		lockedBlock int64
+		trials      int
+	}{
+		{"并发数越大越快", 8, 10 * converter.MB, []int64{100, 200, 300, 250, 350}, 8, 20 * converter.MB, 5},
+		{"中间的并发数最快", 8, 10 * converter.MB, []int64{100, 300, 200, 400, 250}, 4, 5 * converter.MB, 5},
+		{"调整分片大小没有变快", 8, 10 * converter.MB, []int64{100, 300, 200, 100, 100}, 4, 10 * converter.MB, 5},
+		{"分片大小已是最小值", 2, converter.MB, []int64{100, 200, 300}, 2, 2 * converter.MB, 3},
+		{"分片大小已是最大值", 2, 50 * converter.MB, []int64{100, 200, 300}, 2, 25 * converter.MB, 3},
+	}
+	for _, c := range cases {
+		tuner := NewUploadAutoTuner(c.maxParallel, c.blockSize, time.Second)
+		now := time.Now()
+		tuner.trialStart = now
+		for _, n := range c.bytes {
+			if tuner.locked {
+				t.Fatalf("%s: locked too early", c.name)
+			}
+			tuner.trialBytes = n
+			now = now.Add(time.Second)
+			tuner.advanceLocked(now)
+		}
+		if !tuner.locked || len(tuner.trials) != c.trials {
+			t.Errorf("%s: locked %v, trials %d", c.name, tuner.locked, len(tuner.trials))
+			continue
+		}
+		trial := tuner.trials[tuner.current]
+		if trial.Parallel != c.parallel || tuner.BlockSize(0) != c.lockedBlock {
+			t.Errorf("%s: locked parallel %d, block size %d", c.name, trial.Parallel, tuner.BlockSize(0))
+		}
+		// 锁定后不再切换参数
+		tuner.advanceLocked(now.Add(time.Hour))
+		if tuner.trials[tuner.current] != trial {
+			t.Errorf("%s: trial changed after locked", c.name)
+		}
+	}
+}
+
+func TestUploadAutoTunerAcquire(t *testing.T) {
+	tuner := NewUploadAutoTuner(2, converter.MB, time.Hour)
+	tuner.Acquire()
+	acquired := make(chan struct{})
+	go func() {
+		// 第一组尝试的并发数为1，需要等待释放名额
+		tuner.Acquire()
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("acquire should block when parallel is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+	tuner.Release()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("acquire should continue after release")
+	}
+	tuner.Release()
+}
+
+func TestUploadAutoTunerNil(t *testing.T) {
+	var tuner *UploadAutoTuner
+	tuner.Acquire()
+	tuner.Add(100)
+	tuner.Release()
+	tuner.Finish()
+	if tuner.MaxParallel(3) != 3 || tuner.BlockSize(5) != 5 {
+		t.Fatal("nil tuner should use default values")
+	}
+}
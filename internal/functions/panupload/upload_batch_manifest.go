@@ -0,0 +1,315 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panupload
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/tickstep/bolt"
+	"github.com/tickstep/library-go/logger"
+)
+
+const (
+	// UploadBatchDirName 批次清单保存目录，位于账号数据目录下
+	UploadBatchDirName = "upload_batch"
+
+	// UploadBatchPending 等待上传
+	UploadBatchPending = "pending"
+	// UploadBatchDone 上传成功
+	UploadBatchDone = "done"
+	// UploadBatchFailed 上传失败，下次继续时重新上传
+	UploadBatchFailed = "failed"
+
+	uploadBatchMetaBucket   = "meta"
+	uploadBatchFileBucket   = "files"
+	uploadBatchFolderBucket = "folders"
+	uploadBatchWalkDoneKey  = "walkDone"
+
+	// uploadBatchFlushSize 扫描阶段累计的文件数量达到该值后批量写入数据库
+	uploadBatchFlushSize = 500
+)
+
+type (
+	// UploadBatchFile 批次清单中的文件
+	UploadBatchFile struct {
+		LocalPath string `json:"localPath"` // 本地文件路径
+		RealPath  string `json:"realPath"`  // 本地文件真实路径，符号链接指向的文件
+		SavePath  string `json:"savePath"`  // 网盘保存路径
+		Size      int64  `json:"size"`
+		ModTime   int64  `json:"modTime"`
+		Status    string `json:"status"`
+	}
+
+	// UploadBatchManifest 目录上传批次清单，记录扫描到的文件、已创建的网盘文件夹以及每个文件的上传状态。
+	// 上传中断后重新执行相同的上传命令，扫描已完成时不再重新扫描本地目录，直接继续上传未完成的文件；
+	// 扫描未完成时重新扫描，但跳过已上传的文件和已创建的网盘文件夹。所有方法都支持nil调用
+	UploadBatchManifest struct {
+		db       *bolt.DB
+		filePath string
+		walkDone bool
+		buffer   []*UploadBatchFile // 扫描阶段还没有写入数据库的文件
+		mutex    sync.Mutex
+	}
+)
+
+// UploadBatchKey 根据上传参数生成批次标识，相同的本地路径、目标目录和过滤规则对应同一个批次
+func UploadBatchKey(parts ...string) string {
+	h := sha1.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// OpenUploadBatchManifest 打开批次清单，不存在则创建
+func OpenUploadBatchManifest(dir, key string) (*UploadBatchManifest, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	filePath := filepath.Join(dir, key+".db")
+	db, err := bolt.Open(filePath, 0755, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	m := &UploadBatchManifest{
+		db:       db,
+		filePath: filePath,
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range []string{uploadBatchMetaBucket, uploadBatchFileBucket, uploadBatchFolderBucket} {
+			if _, e := tx.CreateBucketIfNotExists([]byte(name)); e != nil {
+				return e
+			}
+		}
+		m.walkDone = tx.Bucket([]byte(uploadBatchMetaBucket)).Get([]byte(uploadBatchWalkDoneKey)) != nil
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+func uploadBatchFileKey(localPath, savePath string) []byte {
+	if absPath, err := filepath.Abs(localPath); err == nil {
+		localPath = absPath
+	}
+	return []byte(localPath + "\x00" + path.Clean(savePath))
+}
+
+// FilePath 批次清单文件路径
+func (m *UploadBatchManifest) FilePath() string {
+	if m == nil {
+		return ""
+	}
+	return m.filePath
+}
+
+// WalkDone 上次运行是否已经完成扫描
+func (m *UploadBatchManifest) WalkDone() bool {
+	return m != nil && m.walkDone
+}
+
+// Count 已上传和未完成的文件数量
+func (m *UploadBatchManifest) Count() (done, unfinished int) {
+	if m == nil {
+		return
+	}
+	m.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(uploadBatchFileBucket)).ForEach(func(k, v []byte) error {
+			f := &UploadBatchFile{}
+			if json.Unmarshal(v, f) == nil && f.Status == UploadBatchDone {
+				done++
+			} else {
+				unfinished++
+			}
+			return nil
+		})
+	})
+	return
+}
+
+// IsDone 文件是否已经上传成功，本地文件修改过则需要重新上传
+func (m *UploadBatchManifest) IsDone(localPath, savePath string, size, modTime int64) bool {
+	if m == nil {
+		return false
+	}
+	done := false
+	m.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket([]byte(uploadBatchFileBucket)).Get(uploadBatchFileKey(localPath, savePath))
+		f := &UploadBatchFile{}
+		if data != nil && json.Unmarshal(data, f) == nil {
+			done = f.Status == UploadBatchDone && f.Size == size && modTimeEqual(f.ModTime, modTime)
+		}
+		return nil
+	})
+	return done
+}
+
+// AddFile 记录扫描到的文件，扫描阶段批量写入数据库
+func (m *UploadBatchManifest) AddFile(f *UploadBatchFile) {
+	if m == nil {
+		return
+	}
+	f.Status = UploadBatchPending
+	m.mutex.Lock()
+	m.buffer = append(m.buffer, f)
+	flush := len(m.buffer) >= uploadBatchFlushSize
+	m.mutex.Unlock()
+	if flush {
+		m.flush()
+	}
+}
+
+func (m *UploadBatchManifest) flush() {
+	m.mutex.Lock()
+	buffer := m.buffer
+	m.buffer = nil
+	m.mutex.Unlock()
+	if len(buffer) == 0 {
+		return
+	}
+	err := m.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(uploadBatchFileBucket))
+		for _, f := range buffer {
+			data, e := json.Marshal(f)
+			if e != nil {
+				return e
+			}
+			if e = bucket.Put(uploadBatchFileKey(f.LocalPath, f.SavePath), data); e != nil {
+				return e
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Verboseln("save upload batch manifest error: ", err)
+	}
+}
+
+// SetWalkDone 扫描完成，下次继续时不再重新扫描本地目录
+func (m *UploadBatchManifest) SetWalkDone() {
+	if m == nil {
+		return
+	}
+	m.flush()
+	err := m.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(uploadBatchMetaBucket)).Put([]byte(uploadBatchWalkDoneKey), []byte(time.Now().Format(time.RFC3339)))
+	})
+	if err != nil {
+		logger.Verboseln("save upload batch manifest error: ", err)
+		return
+	}
+	m.walkDone = true
+}
+
+// UnfinishedFiles 没有上传成功的文件
+func (m *UploadBatchManifest) UnfinishedFiles() []*UploadBatchFile {
+	if m == nil {
+		return nil
+	}
+	files := []*UploadBatchFile{}
+	m.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(uploadBatchFileBucket)).ForEach(func(k, v []byte) error {
+			f := &UploadBatchFile{}
+			if err := json.Unmarshal(v, f); err != nil {
+				logger.Verboseln("parse upload batch manifest error: ", err)
+				return nil
+			}
+			if f.Status != UploadBatchDone {
+				files = append(files, f)
+			}
+			return nil
+		})
+	})
+	return files
+}
+
+// SetStatus 更新文件的上传状态
+func (m *UploadBatchManifest) SetStatus(localPath, savePath, status string) {
+	if m == nil {
+		return
+	}
+	m.flush()
+	err := m.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(uploadBatchFileBucket))
+		key := uploadBatchFileKey(localPath, savePath)
+		f := &UploadBatchFile{}
+		if data := bucket.Get(key); data == nil || json.Unmarshal(data, f) != nil {
+			return nil
+		}
+		f.Status = status
+		data, e := json.Marshal(f)
+		if e != nil {
+			return e
+		}
+		return bucket.Put(key, data)
+	})
+	if err != nil {
+		logger.Verboseln("save upload batch manifest error: ", err)
+	}
+}
+
+// HasFolder 网盘文件夹是否已经创建
+func (m *UploadBatchManifest) HasFolder(panPath string) bool {
+	if m == nil {
+		return false
+	}
+	exist := false
+	m.db.View(func(tx *bolt.Tx) error {
+		exist = tx.Bucket([]byte(uploadBatchFolderBucket)).Get([]byte(path.Clean(panPath))) != nil
+		return nil
+	})
+	return exist
+}
+
+// AddFolder 记录已创建的网盘文件夹
+func (m *UploadBatchManifest) AddFolder(panPath string) {
+	if m == nil {
+		return
+	}
+	err := m.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(uploadBatchFolderBucket)).Put([]byte(path.Clean(panPath)), []byte{1})
+	})
+	if err != nil {
+		logger.Verboseln("save upload batch manifest error: ", err)
+	}
+}
+
+// Close 保存并关闭批次清单
+func (m *UploadBatchManifest) Close() error {
+	if m == nil {
+		return nil
+	}
+	m.flush()
+	return m.db.Close()
+}
+
+// Remove 批次全部上传完成，关闭并删除批次清单
+func (m *UploadBatchManifest) Remove() error {
+	if m == nil {
+		return nil
+	}
+	m.db.Close()
+	return os.Remove(m.filePath)
+}
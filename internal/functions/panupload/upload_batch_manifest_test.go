@@ -0,0 +1,100 @@
+package panupload
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUploadBatchManifestRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	key := UploadBatchKey("/home/user/docs", "/backup", "*.tmp")
+	if key == UploadBatchKey("/home/user/docs", "/backup") || len(key) != 16 {
+		t.Fatalf("unexpected key %s", key)
+	}
+
+	m, err := OpenUploadBatchManifest(dir, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.WalkDone() {
+		t.Fatal("new manifest should not be walk done")
+	}
+	files := []*UploadBatchFile{
+		{LocalPath: "/l/a.txt", SavePath: "/backup/a.txt", Size: 1, ModTime: 100},
+		{LocalPath: "/l/b.txt", SavePath: "/backup/b.txt", Size: 2, ModTime: 200},
+		{LocalPath: "/l/c.txt", SavePath: "/backup/c.txt", Size: 3, ModTime: 300},
+	}
+	for _, f := range files {
+		m.AddFile(f)
+	}
+	m.AddFolder("/backup/sub/")
+	// 更新状态前先写入扫描阶段缓存的文件
+	m.SetStatus("/l/a.txt", "/backup/a.txt", UploadBatchDone)
+	m.SetStatus("/l/b.txt", "/backup/b.txt", UploadBatchFailed)
+	m.SetWalkDone()
+	if err = m.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新打开后继续上传
+	m, err = OpenUploadBatchManifest(dir, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.WalkDone() || m.FilePath() != filepath.Join(dir, key+".db") {
+		t.Fatalf("walk done %v, file path %s", m.WalkDone(), m.FilePath())
+	}
+	if done, unfinished := m.Count(); done != 1 || unfinished != 2 {
+		t.Fatalf("done %d, unfinished %d", done, unfinished)
+	}
+	if !m.HasFolder("/backup/sub") || m.HasFolder("/backup") {
+		t.Fatal("unexpected folders")
+	}
+
+	cases := []struct {
+		name      string
+		localPath string
+		savePath  string
+		size      int64
+		modTime   int64
+		want      bool
+	}{
+		{"已上传", "/l/a.txt", "/backup/a.txt", 1, 100, true},
+		{"已上传但文件大小变化", "/l/a.txt", "/backup/a.txt", 2, 100, false},
+		{"已上传但修改时间变化", "/l/a.txt", "/backup/a.txt", 1, 1000, false},
+		{"上传失败", "/l/b.txt", "/backup/b.txt", 2, 200, false},
+		{"等待上传", "/l/c.txt", "/backup/c.txt", 3, 300, false},
+		{"不在清单中", "/l/d.txt", "/backup/d.txt", 4, 400, false},
+	}
+	for _, c := range cases {
+		if got := m.IsDone(c.localPath, c.savePath, c.size, c.modTime); got != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+	unfinished := map[string]string{}
+	for _, f := range m.UnfinishedFiles() {
+		unfinished[f.LocalPath] = f.Status
+	}
+	if len(unfinished) != 2 || unfinished["/l/b.txt"] != UploadBatchFailed || unfinished["/l/c.txt"] != UploadBatchPending {
+		t.Fatalf("unfinished files %v", unfinished)
+	}
+
+	if err = m.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(m.FilePath()); !os.IsNotExist(err) {
+		t.Fatal("manifest file should be removed")
+	}
+}
+
+func TestUploadBatchManifestNil(t *testing.T) {
+	var m *UploadBatchManifest
+	m.AddFile(&UploadBatchFile{})
+	m.AddFolder("/a")
+	m.SetStatus("/a", "/a", UploadBatchDone)
+	m.SetWalkDone()
+	if m.WalkDone() || m.IsDone("/a", "/a", 1, 1) || m.HasFolder("/a") || m.UnfinishedFiles() != nil || m.Close() != nil {
+		t.Fatal("nil manifest should do nothing")
+	}
+}
@@ -0,0 +1,256 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panupload
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/tickstep/library-go/logger"
+)
+
+const (
+	// UploadCallbackQueueFileName 回调失败的请求落盘队列文件名
+	UploadCallbackQueueFileName = "aliyunpan_upload_callback_queue.json"
+
+	// uploadCallbackMaxRetry 单次回调失败的最大重试次数
+	uploadCallbackMaxRetry = 3
+	// uploadCallbackQueueSize 内存中等待发送的回调数量，队列已满时直接保存到落盘队列
+	uploadCallbackQueueSize = 256
+)
+
+type (
+	// UploadCallbackPayload 每个文件上传结束后回调的内容
+	UploadCallbackPayload struct {
+		LocalPath string `json:"localPath"`
+		PanPath   string `json:"panPath"`
+		DriveId   string `json:"driveId"`
+		FileId    string `json:"fileId"`
+		Sha1      string `json:"sha1"`
+		Size      int64  `json:"size"`
+		Result    string `json:"result"` // 上传结果：success-成功，fail-失败
+		Message   string `json:"message"`
+		Timestamp int64  `json:"timestamp"`
+	}
+
+	// uploadCallbackItem 回调队列中的一项，记录回调地址，以便回调地址变更后仍然能回调到原地址
+	uploadCallbackItem struct {
+		Url     string                 `json:"url"`
+		Payload *UploadCallbackPayload `json:"payload"`
+	}
+
+	// UploadCallback 上传文件回调，使用HTTP PUT将每个文件的上传结果推送到指定URL。
+	// 回调以及失败重试都在后台协程中执行，不会阻塞上传。所有方法都支持nil调用
+	UploadCallback struct {
+		url       string
+		queueFile string
+		client    *http.Client
+		queue     chan *uploadCallbackItem
+		ctx       context.Context
+		cancel    context.CancelFunc // 取消后不再发送，剩余的回调保存到落盘队列
+		done      chan struct{}
+		closeOnce sync.Once
+		mutex     sync.Mutex // 保护落盘队列文件
+	}
+)
+
+// NewUploadCallback 创建上传回调，url为空返回nil。后台协程会先重发上次失败落盘的回调，使用完需要调用 Close
+func NewUploadCallback(url, dataDir string) *UploadCallback {
+	if url == "" {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	uc := &UploadCallback{
+		url:       url,
+		queueFile: filepath.Join(dataDir, UploadCallbackQueueFileName),
+		client:    &http.Client{Timeout: 10 * time.Second},
+		queue:     make(chan *uploadCallbackItem, uploadCallbackQueueSize),
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+	go uc.run()
+	return uc
+}
+
+// Notify 回调文件上传结果，放入队列后立即返回。
+// 后台发送重试失败或者队列已满时保存到落盘队列，下次上传时重发
+func (uc *UploadCallback) Notify(payload *UploadCallbackPayload) {
+	if uc == nil || payload == nil {
+		return
+	}
+	if payload.Timestamp == 0 {
+		payload.Timestamp = time.Now().Unix()
+	}
+	item := &uploadCallbackItem{Url: uc.url, Payload: payload}
+	select {
+	case uc.queue <- item:
+	default:
+		logger.Verboseln("upload callback queue is full, save to file: ", payload.LocalPath)
+		uc.saveQueue(item)
+	}
+}
+
+// Close 等待队列中的回调发送完成，最多等待timeout，超时后把没有发送的回调保存到落盘队列。调用后不能再调用 Notify
+func (uc *UploadCallback) Close(timeout time.Duration) {
+	if uc == nil {
+		return
+	}
+	uc.closeOnce.Do(func() {
+		close(uc.queue)
+	})
+	select {
+	case <-uc.done:
+		return
+	case <-time.After(timeout):
+	}
+	fmt.Printf("等待上传回调超时，未发送的回调已保存到队列，下次上传时重新发送\n")
+	uc.cancel()
+	<-uc.done
+}
+
+// run 后台先重发落盘队列，再依次发送队列中的回调
+func (uc *UploadCallback) run() {
+	defer close(uc.done)
+	defer uc.cancel()
+	uc.flushQueue()
+	for item := range uc.queue {
+		if uc.ctx.Err() != nil {
+			uc.saveQueue(item)
+			continue
+		}
+		if err := uc.sendWithRetry(item); err != nil {
+			logger.Verboseln("upload callback error: ", err)
+			uc.saveQueue(item)
+		}
+	}
+}
+
+// saveQueue 保存到落盘队列
+func (uc *UploadCallback) saveQueue(item *uploadCallbackItem) {
+	uc.mutex.Lock()
+	defer uc.mutex.Unlock()
+	if err := uc.appendQueue([]*uploadCallbackItem{item}); err != nil {
+		logger.Verboseln("save upload callback queue error: ", err)
+	}
+}
+
+// flushQueue 重发落盘队列中的回调，仍然失败的重新保存到队列中。发送时不持有锁，避免阻塞 Notify
+func (uc *UploadCallback) flushQueue() {
+	uc.mutex.Lock()
+	items := uc.loadQueue()
+	os.Remove(uc.queueFile)
+	uc.mutex.Unlock()
+	if len(items) == 0 {
+		return
+	}
+	logger.Verbosef("resend %d upload callbacks in queue\n", len(items))
+	failed := []*uploadCallbackItem{}
+	for _, item := range items {
+		if uc.ctx.Err() != nil || uc.send(item) != nil {
+			failed = append(failed, item)
+		}
+	}
+	if len(failed) > 0 {
+		uc.mutex.Lock()
+		if err := uc.appendQueue(failed); err != nil {
+			logger.Verboseln("save upload callback queue error: ", err)
+		}
+		uc.mutex.Unlock()
+		fmt.Printf("有%d个上传回调请求发送失败，已保存到队列，下次上传时重新发送\n", len(failed))
+	}
+}
+
+func (uc *UploadCallback) sendWithRetry(item *uploadCallbackItem) (err error) {
+	for i := 0; i < uploadCallbackMaxRetry; i++ {
+		if i > 0 {
+			select {
+			case <-time.After(time.Duration(i) * time.Second):
+			case <-uc.ctx.Done():
+				return uc.ctx.Err()
+			}
+		}
+		if err = uc.send(item); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (uc *UploadCallback) send(item *uploadCallbackItem) error {
+	data, err := json.Marshal(item.Payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(uc.ctx, http.MethodPut, item.Url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	resp, err := uc.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("upload callback response status: %s", resp.Status)
+	}
+	return nil
+}
+
+// loadQueue 读取落盘队列，每行一个回调请求
+func (uc *UploadCallback) loadQueue() []*uploadCallbackItem {
+	file, err := os.Open(uc.queueFile)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	items := []*uploadCallbackItem{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		item := &uploadCallbackItem{}
+		if json.Unmarshal(scanner.Bytes(), item) != nil || item.Payload == nil {
+			continue
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+func (uc *UploadCallback) appendQueue(items []*uploadCallbackItem) error {
+	file, err := os.OpenFile(uc.queueFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	for _, item := range items {
+		data, e := json.Marshal(item)
+		if e != nil {
+			continue
+		}
+		if _, err = file.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
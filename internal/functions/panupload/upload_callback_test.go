@@ -0,0 +1,111 @@
+package panupload
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// callbackRecorder 记录收到的回调，可以修改返回的状态码以及响应延时
+type callbackRecorder struct {
+	mutex  sync.Mutex
+	paths  []string
+	status int
+	delay  time.Duration
+}
+
+func (r *callbackRecorder) set(status int, delay time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.status, r.delay = status, delay
+}
+
+func (r *callbackRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mutex.Lock()
+	status, delay := r.status, r.delay
+	r.mutex.Unlock()
+	payload := &UploadCallbackPayload{}
+	json.NewDecoder(req.Body).Decode(payload)
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return
+		}
+	}
+	r.mutex.Lock()
+	r.paths = append(r.paths, payload.LocalPath)
+	r.mutex.Unlock()
+	w.WriteHeader(status)
+}
+
+func (r *callbackRecorder) count() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return len(r.paths)
+}
+
+func TestUploadCallbackNotifyAsync(t *testing.T) {
+	rec := &callbackRecorder{status: http.StatusOK, delay: 200 * time.Millisecond}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+
+	uc := NewUploadCallback(srv.URL, t.TempDir())
+	start := time.Now()
+	uc.Notify(&UploadCallbackPayload{LocalPath: "/a"})
+	uc.Notify(&UploadCallbackPayload{LocalPath: "/b"})
+	if time.Since(start) > 100*time.Millisecond {
+		t.Fatal("Notify should not wait for the callback")
+	}
+	uc.Close(10 * time.Second)
+	if rec.count() != 2 {
+		t.Fatalf("callbacks = %d", rec.count())
+	}
+}
+
+func TestUploadCallbackQueueFile(t *testing.T) {
+	dir := t.TempDir()
+	rec := &callbackRecorder{status: http.StatusInternalServerError}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+
+	// 重试失败后保存到落盘队列
+	uc := NewUploadCallback(srv.URL, dir)
+	uc.Notify(&UploadCallbackPayload{LocalPath: "/a"})
+	uc.Close(30 * time.Second)
+	if rec.count() != uploadCallbackMaxRetry {
+		t.Fatalf("attempts = %d", rec.count())
+	}
+	if items := uc.loadQueue(); len(items) != 1 || items[0].Url != srv.URL {
+		t.Fatalf("queue = %v", items)
+	}
+
+	// 等待超时，没有发送完成的回调也保存到落盘队列
+	rec.set(http.StatusOK, time.Minute)
+	uc = NewUploadCallback(srv.URL+"/slow", dir)
+	uc.Notify(&UploadCallbackPayload{LocalPath: "/b"})
+	uc.Close(200 * time.Millisecond)
+	items := uc.loadQueue()
+	if len(items) != 2 {
+		t.Fatalf("queue = %d", len(items))
+	}
+	// 回调地址使用保存时的地址
+	if items[0].Url != srv.URL || items[1].Url != srv.URL+"/slow" {
+		t.Fatalf("urls = %s, %s", items[0].Url, items[1].Url)
+	}
+
+	// 下次创建时重发落盘队列中的回调
+	rec.set(http.StatusOK, 0)
+	sent := rec.count()
+	uc = NewUploadCallback(srv.URL, dir)
+	uc.Close(10 * time.Second)
+	if rec.count()-sent != 2 {
+		t.Fatalf("resend = %d", rec.count()-sent)
+	}
+	if items := uc.loadQueue(); len(items) != 0 {
+		t.Fatalf("queue = %d", len(items))
+	}
+}
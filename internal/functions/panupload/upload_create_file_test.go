@@ -0,0 +1,105 @@
+package panupload
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/taskframework"
+)
+
+// fakeUploadFileCreator 云盘文件夹被删除后，只有重新创建的文件夹才能创建上传任务
+type fakeUploadFileCreator struct {
+	validParentId string
+	mkdirFileId   string
+	createParents []string
+	mkdirPaths    []string
+}
+
+func (c *fakeUploadFileCreator) CreateUploadFile(param *aliyunpan.CreateFileUploadParam) (*aliyunpan.CreateFileUploadResult, *apierror.ApiError) {
+	c.createParents = append(c.createParents, param.ParentFileId)
+	if param.ParentFileId != c.validParentId {
+		return nil, apierror.NewApiError(apierror.ApiCodeFileNotFoundCode, "parent not found")
+	}
+	return &aliyunpan.CreateFileUploadResult{FileId: "file", ParentFileId: param.ParentFileId}, nil
+}
+
+func (c *fakeUploadFileCreator) MkdirByFullPath(driveId, fullPath string) (*aliyunpan.MkdirResult, *apierror.ApiError) {
+	c.mkdirPaths = append(c.mkdirPaths, fullPath)
+	if c.mkdirFileId == "" {
+		return nil, apierror.NewFailedApiError("mkdir failed")
+	}
+	return &aliyunpan.MkdirResult{FileId: c.mkdirFileId}, nil
+}
+
+func newCreateFileTestUnit(out *bytes.Buffer) *UploadTaskUnit {
+	utu := &UploadTaskUnit{
+		DriveId:           "drive",
+		FolderCreateMutex: &sync.Mutex{},
+		FolderIdCache:     config.NewFolderIdCache(time.Hour),
+		Reporter:          NewCliUploadReporter(out, false),
+	}
+	utu.SetTaskInfo(&taskframework.TaskInfo{})
+	return utu
+}
+
+func TestCreateUploadFileRecreateParentFolder(t *testing.T) {
+	out := &bytes.Buffer{}
+	utu := newCreateFileTestUnit(out)
+	utu.FolderIdCache.Put("drive", "/backup", "deleted")
+	client := &fakeUploadFileCreator{validParentId: "new", mkdirFileId: "new"}
+
+	result, apierr, ok := utu.createUploadFile(client, &aliyunpan.CreateFileUploadParam{ParentFileId: "deleted"}, "/backup")
+	if !ok || apierr != nil || result == nil || result.ParentFileId != "new" {
+		t.Fatalf("create upload file: %v %v %v", result, apierr, ok)
+	}
+	if len(client.mkdirPaths) != 1 || client.mkdirPaths[0] != "/backup" {
+		t.Fatalf("mkdir: %v", client.mkdirPaths)
+	}
+	if strings.Join(client.createParents, ",") != "deleted,new" {
+		t.Fatalf("create parents: %v", client.createParents)
+	}
+	// 文件夹ID缓存更新为重新创建的文件夹
+	if id := utu.FolderIdCache.Get("drive", "/backup"); id != "new" {
+		t.Fatalf("folder id cache: %s", id)
+	}
+	if !strings.Contains(out.String(), "云盘文件夹已失效，重新创建文件夹: /backup") {
+		t.Fatal(out.String())
+	}
+}
+
+func TestCreateUploadFileRetryOnce(t *testing.T) {
+	// 重新创建的文件夹仍然无法创建上传任务，只重试一次
+	utu := newCreateFileTestUnit(&bytes.Buffer{})
+	client := &fakeUploadFileCreator{validParentId: "never", mkdirFileId: "new"}
+	_, apierr, ok := utu.createUploadFile(client, &aliyunpan.CreateFileUploadParam{ParentFileId: "deleted"}, "/backup")
+	if !ok || apierr == nil || apierr.Code != apierror.ApiCodeFileNotFoundCode {
+		t.Fatalf("unexpected result: %v %v", apierr, ok)
+	}
+	if len(client.createParents) != 2 || len(client.mkdirPaths) != 1 {
+		t.Fatalf("create %d times, mkdir %d times", len(client.createParents), len(client.mkdirPaths))
+	}
+
+	// 重新创建文件夹失败
+	client = &fakeUploadFileCreator{validParentId: "never"}
+	if _, _, ok = utu.createUploadFile(client, &aliyunpan.CreateFileUploadParam{ParentFileId: "deleted"}, "/backup"); ok {
+		t.Fatal("recreate parent folder should fail")
+	}
+	if id := utu.FolderIdCache.Get("drive", "/backup"); id != "" {
+		t.Fatalf("stale folder id should be invalidated: %s", id)
+	}
+
+	// 根目录不会被删除，不重新创建
+	client = &fakeUploadFileCreator{validParentId: "never", mkdirFileId: "new"}
+	if _, apierr, ok = utu.createUploadFile(client, &aliyunpan.CreateFileUploadParam{ParentFileId: "root"}, "/"); !ok || apierr == nil {
+		t.Fatalf("unexpected result: %v %v", apierr, ok)
+	}
+	if len(client.mkdirPaths) != 0 {
+		t.Fatal("root folder should not be recreated")
+	}
+}
@@ -14,12 +14,15 @@
 package panupload
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
 	"github.com/tickstep/library-go/logger"
-	"io"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/tickstep/aliyunpan/internal/config"
@@ -41,57 +44,106 @@ type (
 		UploadingList []*Uploading `json:"upload_state"`
 		Timestamp     int64        `json:"timestamp"`
 
-		dataFile *os.File
+		dataDir    string    // 数据文件所在目录，按账号隔离
+		lastBackup time.Time // 最后一次滚动备份的时间
+		saveMutex  sync.Mutex
 	}
 )
 
-// NewUploadingDatabase 初始化未完成上传的数据库, 从库中读取内容
-func NewUploadingDatabase() (ud *UploadingDatabase, err error) {
-	file, err := os.OpenFile(filepath.Join(config.GetConfigDir(), UploadingFileName), os.O_CREATE|os.O_RDWR, 0777)
-	if err != nil {
-		// 打开文件错误，一般是文件权限问题
-		return nil, err
-	}
+// NewUserUploadingDatabase 初始化指定账号数据目录下未完成上传的数据库, 从库中读取内容
+func NewUserUploadingDatabase(dataDir string) (ud *UploadingDatabase, err error) {
+	// 断点数据按账号分目录存放，避免多账号之间串数据
+	migrateLegacyUploadingDatabase(config.GetConfigDir(), dataDir)
 
 	ud = &UploadingDatabase{
-		dataFile: file,
-	}
-	info, err := file.Stat()
-	if err != nil {
-		return nil, err
+		dataDir: dataDir,
 	}
+	// 清理上次保存中断遗留的临时文件
+	os.Remove(ud.tempFilePath())
 
-	if info.Size() <= 0 {
-		return ud, nil
-	}
-
-	err = jsonhelper.UnmarshalData(file, ud)
-	if err != nil {
-		// 上传数据库文件内容解析错误
-		// 尝试从备份的文件读取数据
-		bakFile, err1 := os.OpenFile(filepath.Join(config.GetConfigDir(), UploadingBackupFileName), os.O_CREATE|os.O_RDONLY, 0777)
+	// 依次尝试数据文件和滚动备份文件，使用第一份能正常解析的数据
+	var lastErr error
+	for i, filePath := range ud.candidateFilePaths() {
+		data, err1 := os.ReadFile(filePath)
 		if err1 != nil {
-			return nil, err
+			if !os.IsNotExist(err1) {
+				// 读取文件错误，一般是文件权限问题
+				return nil, err1
+			}
+			continue
 		}
-		err2 := jsonhelper.UnmarshalData(bakFile, ud)
-		if err2 != nil {
-			return nil, err
+		if i == 0 && len(data) == 0 {
+			// 数据文件为空，没有未完成的上传
+			return ud, nil
+		}
+		if err1 = jsonhelper.UnmarshalData(bytes.NewReader(data), ud); err1 != nil {
+			logger.Verbosef("上传数据库文件解析错误: %s, %s\n", filePath, err1)
+			ud.UploadingList = nil
+			lastErr = err1
+			continue
+		}
+		if i > 0 {
+			// 保留损坏的数据文件方便排查，并用可用的备份覆盖数据文件
+			mainFilePath := ud.mainFilePath()
+			os.Rename(mainFilePath, mainFilePath+".corrupt")
+			if err2 := writeFileAtomic(mainFilePath, data); err2 != nil {
+				logger.Verboseln("恢复上传数据库文件出错： ", err2)
+			}
+			fmt.Printf("上传数据库文件损坏，已自动从备份恢复: %s\n", filepath.Base(filePath))
 		}
-		bakFile.Close()
-		// 旧的备份文件可以正常使用，复制备份的数据文件到当前数据文件中
-		ud.copyFile(filepath.Join(config.GetConfigDir(), UploadingFileName), filepath.Join(config.GetConfigDir(), UploadingBackupFileName))
 		return ud, nil
 	}
 
+	if lastErr != nil {
+		// 数据文件以及所有备份都无法使用，保留损坏的文件后以空数据库继续，未完成的上传需要从头开始
+		mainFilePath := ud.mainFilePath()
+		os.Rename(mainFilePath, mainFilePath+".corrupt")
+		fmt.Printf("上传数据库文件损坏且没有可用的备份，未完成的上传将重新开始: %s\n", lastErr)
+	}
 	return ud, nil
 }
 
+// migrateLegacyUploadingDatabase 旧版本的断点数据保存在配置目录下，迁移到当前账号的数据目录。
+// 迁移完成后在配置目录下写入版本标记，只迁移一次，避免之后配置目录下的数据被其他账号再次迁移走
+func migrateLegacyUploadingDatabase(legacyDir, dataDir string) {
+	if filepath.Clean(legacyDir) == filepath.Clean(dataDir) {
+		return
+	}
+	markerFile := filepath.Join(legacyDir, UploadingMigrateFileName)
+	if data, err := os.ReadFile(markerFile); err == nil && strings.TrimSpace(string(data)) == UploadingMigrateVersion {
+		return
+	}
+	defer func() {
+		if err := os.WriteFile(markerFile, []byte(UploadingMigrateVersion), 0600); err != nil {
+			logger.Verboseln("保存上传数据库迁移标记出错： ", err)
+		}
+	}()
+	if _, err := os.Stat(filepath.Join(dataDir, UploadingFileName)); err == nil {
+		// 已经存在账号自己的数据文件
+		return
+	}
+	for _, name := range []string{UploadingFileName, UploadingBackupFileName} {
+		legacyFile := filepath.Join(legacyDir, name)
+		if _, err := os.Stat(legacyFile); err != nil {
+			continue
+		}
+		if err := os.Rename(legacyFile, filepath.Join(dataDir, name)); err != nil {
+			logger.Verboseln("迁移旧的上传数据库文件出错： ", err)
+		} else {
+			logger.Verboseln("迁移旧的上传数据库文件到账号数据目录： ", dataDir)
+		}
+	}
+}
+
 // Save 保存内容
 func (ud *UploadingDatabase) Save() error {
-	if ud.dataFile == nil {
-		return errors.New("dataFile is nil")
+	if ud.dataDir == "" {
+		return errors.New("dataDir is empty")
 	}
 
+	ud.saveMutex.Lock()
+	defer ud.saveMutex.Unlock()
+
 	ud.Timestamp = time.Now().Unix()
 
 	var (
@@ -102,50 +154,89 @@ func (ud *UploadingDatabase) Save() error {
 		panic(err)
 	}
 
-	// 备份旧的数据库文件
-	// 因为下面有文件内容清空、写入新内容的操作。有小概率出现文件保存没有完成程序就退出的问题，这会导致数据库内容丢失。所以这里必须备份一下旧文件
-	err1 := ud.copyFile(filepath.Join(config.GetConfigDir(), UploadingBackupFileName), filepath.Join(config.GetConfigDir(), UploadingFileName))
-	if err1 != nil {
-		logger.Verboseln("备份上传数据库文件出错： {}", err1)
-	} else {
-		logger.Verboseln("成功备份旧的上传数据库文件")
+	// 先写入临时文件，写入完成后再替换数据文件，避免保存过程中程序退出导致数据库内容丢失
+	tempFilePath := ud.tempFilePath()
+	if err = writeFile(tempFilePath, converter.ToBytes(builder.String())); err != nil {
+		os.Remove(tempFilePath)
+		return err
+	}
+
+	// 滚动备份旧的数据库文件。进度每次更新都会保存，只在打开后第一次保存以及间隔一段时间后备份，
+	// 否则备份很快都会变成最近几次进度，起不到保留旧数据的作用
+	if ud.lastBackup.IsZero() || time.Since(ud.lastBackup) >= UploadingBackupInterval {
+		ud.rotateBackups()
+		ud.lastBackup = time.Now()
 	}
 
 	logger.Verboseln("保存最新上传数据库内容")
-	// 清空文件旧内容
-	err = ud.dataFile.Truncate(int64(builder.Len()))
-	if err != nil {
-		return err
+	return os.Rename(tempFilePath, ud.mainFilePath())
+}
+
+// rotateBackups 滚动备份数据文件，.bak 为最新的备份，.bak.1、.bak.2 ... 依次更旧
+func (ud *UploadingDatabase) rotateBackups() {
+	mainFilePath := ud.mainFilePath()
+	if _, err := os.Stat(mainFilePath); err != nil {
+		return
+	}
+	os.Remove(ud.backupFilePath(UploadingBackupCount - 1))
+	for i := UploadingBackupCount - 1; i > 0; i-- {
+		os.Rename(ud.backupFilePath(i-1), ud.backupFilePath(i))
 	}
+	if err := os.Rename(mainFilePath, ud.backupFilePath(0)); err != nil {
+		logger.Verboseln("备份上传数据库文件出错： ", err)
+	}
+}
 
-	// 写入新内容
-	str := builder.String()
-	_, err = ud.dataFile.WriteAt(converter.ToBytes(str), 0)
-	if err != nil {
-		return err
+func (ud *UploadingDatabase) mainFilePath() string {
+	return filepath.Join(ud.dataDir, UploadingFileName)
+}
+
+func (ud *UploadingDatabase) tempFilePath() string {
+	return filepath.Join(ud.dataDir, UploadingFileName+".tmp")
+}
+
+// backupFilePath 第index份备份文件的路径，index从0开始
+func (ud *UploadingDatabase) backupFilePath(index int) string {
+	if index == 0 {
+		return filepath.Join(ud.dataDir, UploadingBackupFileName)
 	}
+	return filepath.Join(ud.dataDir, UploadingBackupFileName+"."+strconv.Itoa(index))
+}
 
-	return nil
+// candidateFilePaths 加载数据库时依次尝试的文件，数据文件在前，备份文件由新到旧
+func (ud *UploadingDatabase) candidateFilePaths() []string {
+	paths := []string{ud.mainFilePath()}
+	for i := 0; i < UploadingBackupCount; i++ {
+		paths = append(paths, ud.backupFilePath(i))
+	}
+	return paths
 }
 
-// copyFile 复制文件
-func (ud *UploadingDatabase) copyFile(dstFilePath string, srcFilePath string) error {
-	os.Remove(dstFilePath)
-	dstFile, err1 := os.OpenFile(dstFilePath, os.O_CREATE|os.O_WRONLY, 0777)
-	if err1 != nil {
-		return err1
+// writeFile 写入文件并刷新到磁盘
+func writeFile(filePath string, data []byte) error {
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0777)
+	if err != nil {
+		return err
 	}
-	srcFile, err2 := os.OpenFile(srcFilePath, os.O_CREATE|os.O_RDONLY, 0777)
-	if err2 != nil {
-		return err2
+	if _, err = file.Write(data); err != nil {
+		file.Close()
+		return err
 	}
-	_, err3 := io.Copy(dstFile, srcFile)
-	if err3 != nil {
-		return err3
+	if err = file.Sync(); err != nil {
+		file.Close()
+		return err
 	}
-	dstFile.Close()
-	srcFile.Close()
-	return nil
+	return file.Close()
+}
+
+// writeFileAtomic 通过临时文件+rename原子写入文件
+func writeFileAtomic(filePath string, data []byte) error {
+	tempFilePath := filePath + ".tmp"
+	if err := writeFile(tempFilePath, data); err != nil {
+		os.Remove(tempFilePath)
+		return err
+	}
+	return os.Rename(tempFilePath, filePath)
 }
 
 // UpdateUploading 更新正在上传
@@ -223,6 +314,10 @@ func (ud *UploadingDatabase) Search(meta *localfile.LocalFileMeta) *uploader.Ins
 			meta.SHA1 = uploading.LocalFileMeta.SHA1
 			meta.ParentFolderId = uploading.LocalFileMeta.ParentFolderId
 			meta.UploadOpEntity = uploading.LocalFileMeta.UploadOpEntity
+			if uploading.LocalFileMeta.Path.LogicPath == meta.Path.LogicPath {
+				// SHA1计算进度只能用于同一个文件
+				meta.SHA1Checkpoint = uploading.LocalFileMeta.SHA1Checkpoint
+			}
 			return uploading.State
 		}
 	}
@@ -248,7 +343,7 @@ func (ud *UploadingDatabase) clearModTimeChange() {
 			continue
 		}
 
-		if uploading.LocalFileMeta.ModTime != info.ModTime().Unix() {
+		if !modTimeEqual(uploading.LocalFileMeta.ModTime, info.ModTime().Unix()) {
 			ud.deleteIndex(i)
 			i--
 			cmdUploadVerbose.Infof("clear modified file path: %s\n", uploading.LocalFileMeta.Path)
@@ -259,5 +354,6 @@ func (ud *UploadingDatabase) clearModTimeChange() {
 
 // Close 关闭数据库
 func (ud *UploadingDatabase) Close() error {
-	return ud.dataFile.Close()
+	// 数据每次保存都是完整写入，没有需要关闭的文件句柄
+	return nil
 }
@@ -0,0 +1,203 @@
+package panupload
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/file/uploader"
+	"github.com/tickstep/aliyunpan/internal/localfile"
+)
+
+func TestMigrateLegacyUploadingDatabase(t *testing.T) {
+	writeFile := func(dir, name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	readFile := func(dir, name string) string {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return ""
+		}
+		return string(data)
+	}
+	newDirs := func() (string, string, string) {
+		legacyDir := t.TempDir()
+		userA := filepath.Join(legacyDir, "users", "a")
+		userB := filepath.Join(legacyDir, "users", "b")
+		for _, dir := range []string{userA, userB} {
+			if err := os.MkdirAll(dir, 0700); err != nil {
+				t.Fatal(err)
+			}
+		}
+		writeFile(legacyDir, UploadingFileName, "legacy")
+		writeFile(legacyDir, UploadingBackupFileName, "legacy bak")
+		return legacyDir, userA, userB
+	}
+
+	// 第一次迁移，数据文件移动到账号目录并写入迁移标记
+	legacyDir, userA, userB := newDirs()
+	migrateLegacyUploadingDatabase(legacyDir, userA)
+	if readFile(userA, UploadingFileName) != "legacy" || readFile(userA, UploadingBackupFileName) != "legacy bak" {
+		t.Fatal("legacy files should be migrated to user dir")
+	}
+	if readFile(legacyDir, UploadingFileName) != "" || readFile(legacyDir, UploadingBackupFileName) != "" {
+		t.Fatal("legacy files should be moved")
+	}
+	if readFile(legacyDir, UploadingMigrateFileName) != UploadingMigrateVersion {
+		t.Fatal("migrate marker should be written")
+	}
+
+	// 已经迁移过，配置目录下新出现的数据不会被其他账号再次迁移走
+	writeFile(legacyDir, UploadingFileName, "new legacy")
+	migrateLegacyUploadingDatabase(legacyDir, userB)
+	migrateLegacyUploadingDatabase(legacyDir, userA)
+	if readFile(userB, UploadingFileName) != "" || readFile(userA, UploadingFileName) != "legacy" {
+		t.Fatal("migration should run only once")
+	}
+	if readFile(legacyDir, UploadingFileName) != "new legacy" {
+		t.Fatal("legacy file should be kept")
+	}
+
+	cases := []struct {
+		name     string
+		setup    func(legacyDir, userA string) string
+		want     string
+		marked   bool
+		legacyOk bool
+	}{
+		{"账号目录已存在数据文件", func(legacyDir, userA string) string {
+			writeFile(userA, UploadingFileName, "user")
+			return userA
+		}, "user", true, true},
+		{"账号目录就是配置目录", func(legacyDir, userA string) string {
+			return legacyDir
+		}, "legacy", false, true},
+		{"迁移标记版本不一致", func(legacyDir, userA string) string {
+			writeFile(legacyDir, UploadingMigrateFileName, "0")
+			return userA
+		}, "legacy", true, false},
+	}
+	for _, c := range cases {
+		legacyDir, userA, _ := newDirs()
+		dataDir := c.setup(legacyDir, userA)
+		migrateLegacyUploadingDatabase(legacyDir, dataDir)
+		if got := readFile(dataDir, UploadingFileName); got != c.want {
+			t.Errorf("%s: data %q, want %q", c.name, got, c.want)
+		}
+		if marked := readFile(legacyDir, UploadingMigrateFileName) == UploadingMigrateVersion; marked != c.marked {
+			t.Errorf("%s: marked %v, want %v", c.name, marked, c.marked)
+		}
+		if legacyOk := readFile(legacyDir, UploadingFileName) != ""; legacyOk != c.legacyOk {
+			t.Errorf("%s: legacy file kept %v, want %v", c.name, legacyOk, c.legacyOk)
+		}
+	}
+}
+
+// openTestUploadingDatabase 打开临时目录下的上传数据库，配置目录也使用临时目录，避免迁移真实的断点数据
+func openTestUploadingDatabase(t *testing.T, dataDir string) *UploadingDatabase {
+	t.Setenv(config.EnvConfigDir, dataDir)
+	ud, err := NewUserUploadingDatabase(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ud
+}
+
+func testUploadingMeta(name string) *localfile.LocalFileMeta {
+	return &localfile.LocalFileMeta{
+		Path:    localfile.SymlinkFile{LogicPath: "/data/" + name, RealPath: "/data/" + name},
+		Length:  1024,
+		ModTime: 1700000000,
+	}
+}
+
+func uploadingNames(ud *UploadingDatabase) []string {
+	names := []string{}
+	for _, u := range ud.UploadingList {
+		names = append(names, filepath.Base(u.LocalFileMeta.Path.LogicPath))
+	}
+	return names
+}
+
+func TestUploadingDatabaseBackupRotation(t *testing.T) {
+	dataDir := t.TempDir()
+	ud := openTestUploadingDatabase(t, dataDir)
+	ud.UpdateUploading(testUploadingMeta("a"), &uploader.InstanceState{})
+	if err := ud.Save(); err != nil {
+		t.Fatal(err)
+	}
+	first, _ := os.ReadFile(ud.mainFilePath())
+
+	// 重新打开后第一次保存备份一次，之后的进度保存不再备份
+	ud = openTestUploadingDatabase(t, dataDir)
+	for i := 0; i < 10; i++ {
+		ud.UpdateUploading(testUploadingMeta("b"), &uploader.InstanceState{})
+		if err := ud.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if data, _ := os.ReadFile(ud.backupFilePath(0)); string(data) != string(first) {
+		t.Fatal("backup should keep the data before this session")
+	}
+	if _, err := os.Stat(ud.backupFilePath(1)); err == nil {
+		t.Fatal("progress saves should not rotate backups")
+	}
+
+	// 超过备份间隔后再次备份
+	ud.lastBackup = time.Now().Add(-UploadingBackupInterval)
+	if err := ud.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(ud.backupFilePath(1)); string(data) != string(first) {
+		t.Fatal("older backup should be rotated")
+	}
+	if _, err := os.Stat(ud.tempFilePath()); err == nil {
+		t.Fatal("temp file should be renamed")
+	}
+}
+
+func TestUploadingDatabaseCorruptRecovery(t *testing.T) {
+	dataDir := t.TempDir()
+	ud := openTestUploadingDatabase(t, dataDir)
+	ud.UpdateUploading(testUploadingMeta("a"), &uploader.InstanceState{})
+	ud.Save()
+	ud = openTestUploadingDatabase(t, dataDir)
+	ud.UpdateUploading(testUploadingMeta("b"), &uploader.InstanceState{})
+	ud.Save()
+
+	// 数据文件损坏，从最新的备份恢复
+	mainFilePath := ud.mainFilePath()
+	os.WriteFile(mainFilePath, []byte("{\"upload_state\": [broken"), 0600)
+	ud = openTestUploadingDatabase(t, dataDir)
+	if names := uploadingNames(ud); len(names) != 1 || names[0] != "a" {
+		t.Fatalf("recovered %v", names)
+	}
+	if data, _ := os.ReadFile(mainFilePath + ".corrupt"); string(data) != "{\"upload_state\": [broken" {
+		t.Fatal("corrupt file should be kept")
+	}
+	if data, _ := os.ReadFile(mainFilePath); string(data) == "{\"upload_state\": [broken" {
+		t.Fatal("data file should be restored from backup")
+	}
+
+	// 数据文件以及备份都损坏，以空数据库继续
+	for _, p := range ud.candidateFilePaths() {
+		os.WriteFile(p, []byte("broken"), 0600)
+	}
+	ud = openTestUploadingDatabase(t, dataDir)
+	if len(ud.UploadingList) != 0 {
+		t.Fatalf("expect empty database, got %v", uploadingNames(ud))
+	}
+	if err := ud.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 空的数据文件表示没有未完成的上传
+	os.WriteFile(mainFilePath, nil, 0600)
+	if ud = openTestUploadingDatabase(t, dataDir); len(ud.UploadingList) != 0 {
+		t.Fatal("empty data file")
+	}
+}
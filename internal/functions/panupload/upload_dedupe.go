@@ -0,0 +1,359 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panupload
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/bolt"
+	"github.com/tickstep/library-go/logger"
+)
+
+const (
+	uploadDedupeBucket = "uploaded"
+)
+
+type (
+	// UploadDedupeRecord 已上传文件记录
+	UploadDedupeRecord struct {
+		LocalPath    string `json:"localPath"`    // 本地文件绝对路径
+		Size         int64  `json:"size"`         // 上传时的文件大小
+		ModTime      int64  `json:"modTime"`      // 上传时的文件修改时间，Unix时间戳
+		Sha1         string `json:"sha1"`         // 文件SHA1，没有计算时为空
+		DriveId      string `json:"driveId"`      // 网盘ID
+		PanPath      string `json:"panPath"`      // 网盘保存路径
+		ParentFileId string `json:"parentFileId"` // 网盘父目录ID
+		FileId       string `json:"fileId"`       // 网盘文件ID
+		UpdatedAt    int64  `json:"updatedAt"`    // 记录时间，Unix时间戳
+	}
+
+	// UploadDedupeIndex 上传去重索引，记录本地文件上传到网盘后的文件ID。
+	// 重复上传同一个目录时，本地文件的大小、修改时间都没有变化，并且网盘文件仍然存在，则直接跳过，不再逐个查询网盘。所有方法都支持nil调用
+	UploadDedupeIndex struct {
+		db        *bolt.DB
+		panClient *config.PanClient
+		trust     bool // 信任索引，不检查网盘文件是否变化
+
+		// folders 本次运行已经获取的网盘目录文件列表，父目录ID => 文件ID => 文件，nil代表目录已不存在
+		folders map[string]map[string]*aliyunpan.FileEntity
+		// vanished 本地文件已经不存在的记录，网盘ID => 文件大小 => 记录，用于检测本地文件改名
+		vanished map[string]map[int64][]*UploadDedupeRecord
+		mutex    sync.Mutex
+	}
+)
+
+// OpenUploadDedupeIndex 打开上传去重索引数据库，trust为true时不检查网盘文件是否变化
+func OpenUploadDedupeIndex(dbPath string, panClient *config.PanClient, trust bool) (*UploadDedupeIndex, error) {
+	db, err := bolt.Open(dbPath, 0755, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, e := tx.CreateBucketIfNotExists([]byte(uploadDedupeBucket))
+		return e
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &UploadDedupeIndex{
+		db:        db,
+		panClient: panClient,
+		trust:     trust,
+		folders:   map[string]map[string]*aliyunpan.FileEntity{},
+		vanished:  map[string]map[int64][]*UploadDedupeRecord{},
+	}, nil
+}
+
+func uploadDedupeKey(driveId, panPath string) []byte {
+	return []byte(driveId + ":" + path.Clean("/"+panPath))
+}
+
+// Count 索引的文件数量
+func (idx *UploadDedupeIndex) Count() int {
+	if idx == nil {
+		return 0
+	}
+	count := 0
+	idx.db.View(func(tx *bolt.Tx) error {
+		count = tx.Bucket([]byte(uploadDedupeBucket)).Stats().KeyN
+		return nil
+	})
+	return count
+}
+
+// get 获取网盘路径对应的上传记录
+func (idx *UploadDedupeIndex) get(driveId, panPath string) *UploadDedupeRecord {
+	var rec *UploadDedupeRecord
+	idx.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket([]byte(uploadDedupeBucket)).Get(uploadDedupeKey(driveId, panPath))
+		if data == nil {
+			return nil
+		}
+		r := &UploadDedupeRecord{}
+		if err := json.Unmarshal(data, r); err != nil {
+			logger.Verboseln("parse upload dedupe record error: ", err)
+			return nil
+		}
+		rec = r
+		return nil
+	})
+	return rec
+}
+
+// Lookup 本地文件是否已经上传到网盘的指定路径。
+// 本地文件大小、修改时间和记录不一致，或者网盘文件已被删除、替换，返回false，并删除失效的记录
+func (idx *UploadDedupeIndex) Lookup(driveId, panPath, localPath string, size, modTime int64) bool {
+	if idx == nil {
+		return false
+	}
+	rec := idx.get(driveId, panPath)
+	if rec == nil {
+		return false
+	}
+	if rec.LocalPath != localPath || rec.Size != size || !modTimeEqual(rec.ModTime, modTime) {
+		// 本地文件已变化，需要重新上传
+		idx.Invalidate(driveId, panPath)
+		return false
+	}
+	if idx.trust {
+		return true
+	}
+	if !idx.verify(rec) {
+		logger.Verbosef("网盘文件已变化，上传去重记录失效: %s\n", rec.PanPath)
+		idx.Invalidate(driveId, panPath)
+		return false
+	}
+	return true
+}
+
+// verify 检查记录的网盘文件是否仍然存在并且内容没有变化。
+// 同一个父目录的文件列表在本次运行中只获取一次，避免逐个文件查询网盘
+func (idx *UploadDedupeIndex) verify(rec *UploadDedupeRecord) bool {
+	if rec.ParentFileId == "" {
+		fe, err := idx.panClient.OpenapiPanClient().FileInfoByPath(rec.DriveId, rec.PanPath)
+		if err != nil {
+			return false
+		}
+		return idx.match(rec, fe)
+	}
+
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+	files, ok := idx.folders[rec.ParentFileId]
+	if !ok {
+		fileList, err := idx.panClient.OpenapiPanClient().FileListGetAll(&aliyunpan.FileListParam{
+			DriveId:      rec.DriveId,
+			ParentFileId: rec.ParentFileId,
+		}, 500)
+		if err != nil {
+			if err.Code != apierror.ApiCodeFileNotFoundCode {
+				// 网络等错误不能确认网盘文件状态，按失效处理，重新走正常的上传流程
+				logger.Verbosef("获取网盘目录失败: %s, %s\n", path.Dir(rec.PanPath), err)
+				return false
+			}
+			// 目录已被删除
+			idx.folders[rec.ParentFileId] = nil
+			return false
+		}
+		files = map[string]*aliyunpan.FileEntity{}
+		for _, f := range fileList {
+			files[f.FileId] = f
+		}
+		idx.folders[rec.ParentFileId] = files
+	}
+	return idx.match(rec, files[rec.FileId])
+}
+
+// match 网盘文件和记录是否一致：文件ID、文件名、大小相同，并且记录了SHA1时内容也相同
+func (idx *UploadDedupeIndex) match(rec *UploadDedupeRecord, fe *aliyunpan.FileEntity) bool {
+	if fe == nil || fe.IsFolder() {
+		return false
+	}
+	if fe.FileId != rec.FileId || fe.FileName != path.Base(rec.PanPath) || fe.FileSize != rec.Size {
+		return false
+	}
+	if rec.Sha1 != "" && fe.ContentHash != "" && !strings.EqualFold(fe.ContentHash, rec.Sha1) {
+		return false
+	}
+	return true
+}
+
+// Put 记录上传成功的文件
+func (idx *UploadDedupeIndex) Put(rec *UploadDedupeRecord) {
+	if idx == nil || rec == nil || rec.FileId == "" {
+		return
+	}
+	fi, err := os.Stat(rec.LocalPath)
+	if err != nil || fi.Size() != rec.Size {
+		// 上传过程中文件发生了变化，不记录
+		return
+	}
+	rec.ModTime = fi.ModTime().Unix()
+	rec.UpdatedAt = time.Now().Unix()
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+	err = idx.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(uploadDedupeBucket)).Put(uploadDedupeKey(rec.DriveId, rec.PanPath), data)
+	})
+	if err != nil {
+		logger.Verboseln("save upload dedupe record error: ", err)
+	}
+}
+
+// Invalidate 删除网盘路径对应的上传记录
+func (idx *UploadDedupeIndex) Invalidate(driveId, panPath string) {
+	if idx == nil {
+		return
+	}
+	err := idx.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(uploadDedupeBucket)).Delete(uploadDedupeKey(driveId, panPath))
+	})
+	if err != nil {
+		logger.Verboseln("delete upload dedupe record error: ", err)
+	}
+}
+
+// loadVanished 获取本地文件已经不存在的记录，按文件大小索引。每次运行只扫描一次索引
+func (idx *UploadDedupeIndex) loadVanished(driveId string) map[int64][]*UploadDedupeRecord {
+	if records, ok := idx.vanished[driveId]; ok {
+		return records
+	}
+	records := map[int64][]*UploadDedupeRecord{}
+	idx.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(uploadDedupeBucket)).ForEach(func(k, v []byte) error {
+			rec := &UploadDedupeRecord{}
+			if err := json.Unmarshal(v, rec); err != nil || rec.DriveId != driveId || rec.Size == 0 {
+				return nil
+			}
+			if _, err := os.Stat(rec.LocalPath); os.IsNotExist(err) {
+				records[rec.Size] = append(records[rec.Size], rec)
+			}
+			return nil
+		})
+	})
+	idx.vanished[driveId] = records
+	return records
+}
+
+// renameCandidates 本地文件已经不存在的记录中，同样从localRoot目录上传到panRoot目录的记录。
+// 其他目录上传的文件即使内容相同也不是本次上传的文件改名而来，不能移动
+func renameCandidates(candidates []*UploadDedupeRecord, localRoot, panRoot string) []*UploadDedupeRecord {
+	var result []*UploadDedupeRecord
+	for _, rec := range candidates {
+		if !localPathWithin(localRoot, rec.LocalPath) || !panPathWithin(panRoot, rec.PanPath) {
+			continue
+		}
+		result = append(result, rec)
+	}
+	return result
+}
+
+// localPathWithin 本地路径p是否位于root目录之中
+func localPathWithin(root, p string) bool {
+	rel, err := filepath.Rel(root, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// panPathWithin 网盘路径p是否位于root目录之中
+func panPathWithin(root, p string) bool {
+	root = path.Clean("/" + root)
+	p = path.Clean("/" + p)
+	return root == "/" || strings.HasPrefix(p, root+"/")
+}
+
+// FindRenamed 检测本地文件是否由已上传的文件改名、移动而来，只在同样从localRoot目录上传到panRoot目录的记录中查找。
+// 先按文件大小查找本地文件已经不存在的记录，有候选记录时才计算本地文件SHA1，和网盘文件内容一致则返回该记录以及本地文件SHA1
+func (idx *UploadDedupeIndex) FindRenamed(driveId, localRoot, panRoot, localPath string, size int64) (*UploadDedupeRecord, string) {
+	if idx == nil || size == 0 {
+		return nil, ""
+	}
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+	records := idx.loadVanished(driveId)
+	candidates := renameCandidates(records[size], localRoot, panRoot)
+	if len(candidates) == 0 {
+		return nil, ""
+	}
+	sha1Str := CalcLocalFileSha1(localPath)
+	if sha1Str == "" {
+		return nil, ""
+	}
+	for _, rec := range candidates {
+		if rec.Sha1 != "" && !strings.EqualFold(rec.Sha1, sha1Str) {
+			continue
+		}
+		fe, err := idx.panClient.OpenapiPanClient().FileInfoById(rec.DriveId, rec.FileId)
+		if err != nil || fe == nil || fe.IsFolder() || fe.FileSize != size || !strings.EqualFold(fe.ContentHash, sha1Str) {
+			continue
+		}
+		// 网盘文件已经被其他客户端改名，记录已失效
+		if fe.FileName != path.Base(rec.PanPath) {
+			continue
+		}
+		records[size] = removeDedupeRecord(records[size], rec)
+		return rec, sha1Str
+	}
+	return nil, ""
+}
+
+// removeDedupeRecord 从记录列表中删除指定的记录
+func removeDedupeRecord(records []*UploadDedupeRecord, rec *UploadDedupeRecord) []*UploadDedupeRecord {
+	for i, r := range records {
+		if r == rec {
+			return append(records[:i:i], records[i+1:]...)
+		}
+	}
+	return records
+}
+
+// Rename 本地文件改名后已经移动了对应的网盘文件，更新上传记录
+func (idx *UploadDedupeIndex) Rename(rec *UploadDedupeRecord, localPath, panPath, sha1Str string) {
+	if idx == nil || rec == nil {
+		return
+	}
+	idx.Invalidate(rec.DriveId, rec.PanPath)
+	parentFileId := ""
+	if path.Dir(path.Clean("/"+rec.PanPath)) == path.Dir(path.Clean("/"+panPath)) {
+		parentFileId = rec.ParentFileId
+	}
+	idx.Put(&UploadDedupeRecord{
+		LocalPath:    localPath,
+		Size:         rec.Size,
+		Sha1:         sha1Str,
+		DriveId:      rec.DriveId,
+		PanPath:      panPath,
+		ParentFileId: parentFileId,
+		FileId:       rec.FileId,
+	})
+}
+
+// Close 关闭数据库
+func (idx *UploadDedupeIndex) Close() error {
+	if idx == nil {
+		return nil
+	}
+	return idx.db.Close()
+}
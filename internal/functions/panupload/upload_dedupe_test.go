@@ -0,0 +1,166 @@
+package panupload
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRenameCandidates(t *testing.T) {
+	root := filepath.Join(string(filepath.Separator), "home", "user")
+	records := []*UploadDedupeRecord{
+		{LocalPath: filepath.Join(root, "docs", "a.txt"), PanPath: "/backup/docs/a.txt"},
+		{LocalPath: filepath.Join(root, "docs", "sub", "b.txt"), PanPath: "/backup/docs/sub/b.txt"},
+		// 其他本地目录上传的同样内容的文件
+		{LocalPath: filepath.Join(string(filepath.Separator), "data", "a.txt"), PanPath: "/backup/docs/c.txt"},
+		// 上传到其他网盘目录
+		{LocalPath: filepath.Join(root, "docs", "d.txt"), PanPath: "/photos/d.txt"},
+		// 网盘目录名前缀相同
+		{LocalPath: filepath.Join(root, "docs", "e.txt"), PanPath: "/backup2/e.txt"},
+		{LocalPath: filepath.Join(root+"2", "f.txt"), PanPath: "/backup/f.txt"},
+	}
+	cases := []struct {
+		name      string
+		localRoot string
+		panRoot   string
+		want      []string
+	}{
+		{"同一目录", root, "/backup", []string{"/backup/docs/a.txt", "/backup/docs/sub/b.txt"}},
+		{"子目录", filepath.Join(root, "docs", "sub"), "/backup/docs/sub", []string{"/backup/docs/sub/b.txt"}},
+		{"网盘根目录", root, "/", []string{"/backup/docs/a.txt", "/backup/docs/sub/b.txt", "/photos/d.txt", "/backup2/e.txt"}},
+		{"其他目录", filepath.Join(string(filepath.Separator), "tmp"), "/backup", nil},
+	}
+	for _, c := range cases {
+		got := renameCandidates(records, c.localRoot, c.panRoot)
+		if len(got) != len(c.want) {
+			t.Errorf("%s: got %d candidates, want %d", c.name, len(got), len(c.want))
+			continue
+		}
+		for i, rec := range got {
+			if rec.PanPath != c.want[i] {
+				t.Errorf("%s: candidate %d is %s, want %s", c.name, i, rec.PanPath, c.want[i])
+			}
+		}
+	}
+}
+
+func TestRemoveDedupeRecord(t *testing.T) {
+	a, b, c := &UploadDedupeRecord{PanPath: "/a"}, &UploadDedupeRecord{PanPath: "/b"}, &UploadDedupeRecord{PanPath: "/c"}
+	records := []*UploadDedupeRecord{a, b, c}
+	left := removeDedupeRecord(records, b)
+	if len(left) != 2 || left[0] != a || left[1] != c {
+		t.Fatalf("unexpected records: %v", left)
+	}
+	if records[1] != b {
+		t.Fatal("original slice should not be modified")
+	}
+}
+
+// openTestDedupeIndex 在临时目录中打开信任模式的上传去重索引，不需要访问网盘
+func openTestDedupeIndex(t *testing.T, dbPath string) *UploadDedupeIndex {
+	idx, err := OpenUploadDedupeIndex(dbPath, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return idx
+}
+
+func TestUploadDedupeIndexRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(t.TempDir(), "dedupe.db")
+	localPath := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(localPath, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fi, _ := os.Stat(localPath)
+	modTime := fi.ModTime().Unix()
+
+	idx := openTestDedupeIndex(t, dbPath)
+	idx.Put(&UploadDedupeRecord{LocalPath: localPath, Size: 5, DriveId: "d1", PanPath: "/backup/a.txt", ParentFileId: "p1", FileId: "f1"})
+	// 没有文件ID或者文件大小已变化的记录不保存
+	idx.Put(&UploadDedupeRecord{LocalPath: localPath, Size: 5, DriveId: "d1", PanPath: "/backup/b.txt"})
+	idx.Put(&UploadDedupeRecord{LocalPath: localPath, Size: 6, DriveId: "d1", PanPath: "/backup/c.txt", FileId: "f3"})
+	if n := idx.Count(); n != 1 {
+		t.Fatalf("count %d", n)
+	}
+	idx.Close()
+
+	// 重新打开后记录仍然存在
+	idx = openTestDedupeIndex(t, dbPath)
+	defer idx.Close()
+	rec := idx.get("d1", "backup/a.txt")
+	if rec == nil || rec.FileId != "f1" || rec.ParentFileId != "p1" || rec.ModTime != modTime || rec.UpdatedAt == 0 {
+		t.Fatalf("record %+v", rec)
+	}
+
+	cases := []struct {
+		name      string
+		driveId   string
+		localPath string
+		size      int64
+		modTime   int64
+		want      bool
+	}{
+		{"其他网盘", "d2", localPath, 5, modTime, false},
+		{"本地文件未变化", "d1", localPath, 5, modTime, true},
+		{"本地路径不同", "d1", filepath.Join(dir, "b.txt"), 5, modTime, false},
+		{"记录已失效", "d1", localPath, 5, modTime, false},
+	}
+	for _, c := range cases {
+		if got := idx.Lookup(c.driveId, "/backup/a.txt", c.localPath, c.size, c.modTime); got != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+	if n := idx.Count(); n != 0 {
+		t.Fatalf("changed file should invalidate record, count %d", n)
+	}
+}
+
+func TestUploadDedupeIndexRename(t *testing.T) {
+	dir := t.TempDir()
+	oldPath, newPath := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	for _, p := range []string{oldPath, newPath} {
+		if err := os.WriteFile(p, []byte("hello"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	idx := openTestDedupeIndex(t, filepath.Join(t.TempDir(), "dedupe.db"))
+	defer idx.Close()
+	idx.Put(&UploadDedupeRecord{LocalPath: oldPath, Size: 5, DriveId: "d1", PanPath: "/backup/a.txt", ParentFileId: "p1", FileId: "f1"})
+	os.Remove(oldPath)
+
+	vanished := idx.loadVanished("d1")
+	if len(vanished[5]) != 1 || vanished[5][0].FileId != "f1" {
+		t.Fatalf("vanished %v", vanished)
+	}
+	if len(idx.loadVanished("d2")) != 0 {
+		t.Fatal("other drive should have no vanished records")
+	}
+
+	idx.Rename(vanished[5][0], newPath, "/backup/b.txt", "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d")
+	if idx.get("d1", "/backup/a.txt") != nil {
+		t.Fatal("old record should be removed")
+	}
+	rec := idx.get("d1", "/backup/b.txt")
+	if rec == nil || rec.LocalPath != newPath || rec.FileId != "f1" || rec.ParentFileId != "p1" || rec.Sha1 == "" {
+		t.Fatalf("renamed record %+v", rec)
+	}
+
+	// 移动到其他目录时不保留父目录ID
+	idx.Rename(rec, newPath, "/other/b.txt", rec.Sha1)
+	if rec = idx.get("d1", "/other/b.txt"); rec == nil || rec.ParentFileId != "" {
+		t.Fatalf("moved record %+v", rec)
+	}
+}
+
+func TestUploadDedupeIndexNil(t *testing.T) {
+	var idx *UploadDedupeIndex
+	idx.Put(&UploadDedupeRecord{FileId: "f1"})
+	idx.Invalidate("d1", "/a")
+	if idx.Count() != 0 || idx.Lookup("d1", "/a", "/a", 1, 1) || idx.Close() != nil {
+		t.Fatal("nil index should do nothing")
+	}
+	if rec, _ := idx.FindRenamed("d1", "/", "/", "/a", 1); rec != nil {
+		t.Fatal("nil index should find nothing")
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panupload
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/tickstep/aliyunpan/internal/crypto"
+)
+
+const (
+	// EncryptManifestFileName 加密上传文件的映射清单文件名
+	EncryptManifestFileName = "upload_encrypt_manifest.csv"
+)
+
+type (
+	// UploadEncryptor 上传前加密文件内容和文件名。所有方法都支持nil调用，nil代表不加密
+	UploadEncryptor struct {
+		Cipher      *crypto.Cipher
+		EncryptName bool   // 是否加密文件名
+		TempDir     string // 加密后的临时文件保存目录
+
+		items []*EncryptItem // 加密上传成功的文件
+		mutex sync.Mutex
+	}
+
+	// EncryptItem 加密上传文件的映射
+	EncryptItem struct {
+		LocalPath string // 原始本地文件路径
+		SavePath  string // 原始网盘保存路径
+		EncPath   string // 加密文件的网盘保存路径
+	}
+)
+
+// NewUploadEncryptor 创建上传加密器，tempDir为空使用系统临时目录
+func NewUploadEncryptor(cipher *crypto.Cipher, encryptName bool, tempDir string) *UploadEncryptor {
+	if cipher == nil {
+		return nil
+	}
+	if tempDir == "" {
+		tempDir = os.TempDir()
+	}
+	return &UploadEncryptor{
+		Cipher:      cipher,
+		EncryptName: encryptName,
+		TempDir:     tempDir,
+	}
+}
+
+// EncryptedSavePath 加密文件的网盘保存路径
+func (e *UploadEncryptor) EncryptedSavePath(savePath string) string {
+	if e == nil {
+		return savePath
+	}
+	return path.Join(path.Dir(savePath), e.Cipher.EncryptName(path.Base(savePath), e.EncryptName))
+}
+
+// EncryptFile 把本地文件加密到临时文件，返回临时文件路径。
+// 每次加密使用随机salt，密文都不相同，所以临时文件名由本地文件路径、大小、修改时间决定，
+// 中断后重新上传时直接使用上一次加密的临时文件，保证断点续传记录的SHA1、分片和密文一致
+func (e *UploadEncryptor) EncryptFile(localPath string) (string, error) {
+	fi, err := os.Stat(localPath)
+	if err != nil {
+		return "", err
+	}
+	tempFile := e.tempFilePath(localPath, fi)
+	if tfi, er := os.Stat(tempFile); er == nil && !tfi.IsDir() {
+		return tempFile, nil
+	}
+	// 先加密到临时文件再改名，避免使用加密了一半的文件
+	partFile := strings.TrimSuffix(tempFile, crypto.EncryptedFileSuffix) + ".part" + crypto.EncryptedFileSuffix
+	if err = e.Cipher.EncryptFile(localPath, partFile); err != nil {
+		return "", err
+	}
+	if err = os.Rename(partFile, tempFile); err != nil {
+		os.Remove(partFile)
+		return "", err
+	}
+	return tempFile, nil
+}
+
+// tempFilePath 本地文件加密后的临时文件路径，文件被修改后对应新的临时文件
+func (e *UploadEncryptor) tempFilePath(localPath string, fi os.FileInfo) string {
+	// 密码不同密文也不同
+	key := fmt.Sprintf("%s|%d|%d|%s", localPath, fi.Size(), fi.ModTime().UnixNano(), e.Cipher.KeyId())
+	sum := sha1.Sum([]byte(key))
+	return filepath.Join(e.TempDir, "aliyunpan-"+hex.EncodeToString(sum[:8])+crypto.EncryptedFileSuffix)
+}
+
+// Add 记录加密上传成功的文件
+func (e *UploadEncryptor) Add(item *EncryptItem) {
+	if e == nil {
+		return
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.items = append(e.items, item)
+}
+
+// Items 加密上传成功的文件
+func (e *UploadEncryptor) Items() []*EncryptItem {
+	if e == nil {
+		return nil
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return append([]*EncryptItem{}, e.items...)
+}
+
+// AppendEncryptManifest 追加加密文件映射到清单文件，加密文件名后也能找到对应的原始文件
+func AppendEncryptManifest(manifestFile string, items []*EncryptItem) error {
+	rows := [][]string{}
+	for _, item := range items {
+		rows = append(rows, []string{item.LocalPath, item.SavePath, item.EncPath})
+	}
+	return appendCsvManifest(manifestFile, []string{"本地文件", "原网盘路径", "加密文件网盘路径"}, rows)
+}
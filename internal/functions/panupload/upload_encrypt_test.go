@@ -0,0 +1,50 @@
+package panupload
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tickstep/aliyunpan/internal/crypto"
+)
+
+func TestUploadEncryptorReuseTempFile(t *testing.T) {
+	c, _ := crypto.NewCipher("password")
+	dir := t.TempDir()
+	e := NewUploadEncryptor(c, false, dir)
+	src := filepath.Join(dir, "a.txt")
+	os.WriteFile(src, []byte("hello world"), 0644)
+
+	first, err := e.EncryptFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstData, _ := os.ReadFile(first)
+	// 中断后重新上传，使用同一个密文才能断点续传
+	second, err := e.EncryptFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondData, _ := os.ReadFile(second)
+	if first != second || !bytes.Equal(firstData, secondData) {
+		t.Fatal("encrypted temp file should be reused")
+	}
+
+	// 文件被修改后重新加密
+	os.WriteFile(src, []byte("hello world!"), 0644)
+	os.Chtimes(src, time.Now(), time.Now().Add(time.Minute))
+	if third, _ := e.EncryptFile(src); third == first {
+		t.Fatal("modified file should use a new temp file")
+	}
+
+	// 不同密码使用不同的临时文件
+	other, _ := crypto.NewCipher("other")
+	if p, _ := NewUploadEncryptor(other, false, dir).EncryptFile(src); p == first {
+		t.Fatal("different password should use a new temp file")
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*.part"+crypto.EncryptedFileSuffix)); len(matches) != 0 {
+		t.Fatalf("part files left: %v", matches)
+	}
+}
@@ -0,0 +1,125 @@
+package panupload
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan-api/aliyunpan_open"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/file/faultinject"
+	"github.com/tickstep/aliyunpan/internal/file/uploader"
+	"github.com/tickstep/library-go/requester/rio"
+)
+
+// noCommitUpload 分片通过 PanUpload 真正发送到测试服务器，跳过提交文件的网盘接口
+type noCommitUpload struct {
+	*PanUpload
+	committed bool
+}
+
+func (u *noCommitUpload) CommitFile() error {
+	u.committed = true
+	return nil
+}
+
+// TestUploadFaultInjectResume 开启错误注入后，分片上传失败的任务按断点续传信息重试，最终数据完整且已上传的分片不会重复上传
+func TestUploadFaultInjectResume(t *testing.T) {
+	const (
+		blockSize = 8 * 1024
+		partCount = 8
+	)
+	data := make([]byte, blockSize*partCount)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	var (
+		mutex    sync.Mutex
+		parts    = map[int][]byte{}
+		received = map[int]int{}
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			// 连接中断，分片没有上传完整
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		partNum, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/part/"))
+		mutex.Lock()
+		parts[partNum] = body
+		received[partNum]++
+		mutex.Unlock()
+	}))
+	defer server.Close()
+
+	expires := time.Now().Add(time.Hour).Unix()
+	uploadOpEntity := &aliyunpan.CreateFileUploadResult{FileId: "file"}
+	for i := 1; i <= partCount; i++ {
+		uploadOpEntity.PartInfoList = append(uploadOpEntity.PartInfoList, aliyunpan.FileUploadPartInfoResult{
+			PartNumber: i,
+			UploadURL:  fmt.Sprintf("%s/part/%d?x-oss-expires=%d", server.URL, i, expires),
+		})
+	}
+	f, err := os.Create(filepath.Join(t.TempDir(), "data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.Write(data)
+	file := rio.NewFileReaderAtLen64(f)
+
+	injector := faultinject.Enable(faultinject.Config{FailRate: 0.2, TooManyRequestsRate: 0.1, InterruptRate: 0.2, Seed: 1})
+	defer faultinject.Disable()
+	upload := &noCommitUpload{PanUpload: &PanUpload{
+		panClient:      config.NewPanClient(nil, &aliyunpan_open.OpenPanClient{}),
+		uploadOpEntity: uploadOpEntity,
+	}}
+
+	var state *uploader.InstanceState
+	for retry := 0; ; retry++ {
+		if retry > 200 {
+			t.Fatalf("too many retries, stats: %s", injector.Stats())
+		}
+		muer := uploader.NewMultiUploader(upload, file, &uploader.MultiUploaderConfig{
+			Parallel:  1,
+			BlockSize: blockSize,
+		}, uploadOpEntity, nil, nil)
+		if state != nil {
+			muer.SetInstanceState(state)
+		}
+		err = muer.Execute()
+		state = muer.InstanceState()
+		if err == nil {
+			break
+		}
+	}
+
+	stats := injector.Stats()
+	if stats.Failed == 0 || stats.TooManyRequests == 0 || stats.Interrupted == 0 {
+		t.Fatalf("faults not injected: %s", stats)
+	}
+	if !upload.committed {
+		t.Fatal("file should be committed")
+	}
+	uploaded := &bytes.Buffer{}
+	for i := 1; i <= partCount; i++ {
+		if received[i] != 1 {
+			t.Errorf("part %d uploaded %d times", i, received[i])
+		}
+		uploaded.Write(parts[i])
+	}
+	if !bytes.Equal(uploaded.Bytes(), data) {
+		t.Fatal("uploaded data mismatch")
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panupload
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tickstep/library-go/converter"
+)
+
+const (
+	reportChartWidth  = 800
+	reportChartHeight = 200
+)
+
+type (
+	// UploadHtmlReport 上传批次汇总HTML报告
+	UploadHtmlReport struct {
+		Title      string
+		SavePath   string // 上传的网盘目标目录
+		StartTime  time.Time
+		Statistic  *UploadStatistic
+		Timing     *UploadTimingReport // 可以为nil
+		TotalCount int                 // 加入上传队列的文件数量
+	}
+
+	// reportBar 柱状图中的一项
+	reportBar struct {
+		Name    string
+		Count   int
+		Color   string
+		Width   float64
+		Percent string
+	}
+
+	// reportFile 报告中的文件项
+	reportFile struct {
+		Path   string
+		Size   string
+		Reason string
+	}
+
+	// reportStage 报告中的阶段耗时项
+	reportStage struct {
+		Name    string
+		Count   int
+		Total   string
+		Average string
+		Max     string
+		Percent string
+		Width   float64
+	}
+)
+
+var uploadHtmlReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"barsHeight": func(n int) int { return n*24 + 4 },
+	"barY":       func(i, offset int) int { return i*24 + offset },
+	"barLabelX":  func(w float64) float64 { return w + 88 },
+}).Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Microsoft YaHei", sans-serif; margin: 24px; color: #333; }
+h1 { font-size: 22px; }
+h2 { font-size: 18px; margin-top: 32px; border-left: 4px solid #3a7afe; padding-left: 8px; }
+table { border-collapse: collapse; min-width: 600px; }
+th, td { border: 1px solid #ddd; padding: 6px 10px; text-align: left; font-size: 13px; }
+th { background: #f5f7fa; }
+.summary td:first-child { color: #666; width: 140px; }
+.empty { color: #999; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<table class="summary">
+<tr><td>目标目录</td><td>{{.SavePath}}</td></tr>
+<tr><td>开始时间</td><td>{{.StartTime}}</td></tr>
+<tr><td>总耗时</td><td>{{.Elapsed}}</td></tr>
+<tr><td>上传数据总量</td><td>{{.TotalSize}}</td></tr>
+<tr><td>平均速度</td><td>{{.AverageSpeed}}/s</td></tr>
+<tr><td>峰值速度</td><td>{{.PeakSpeed}}/s</td></tr>
+<tr><td>P95速度</td><td>{{.P95Speed}}/s</td></tr>
+</table>
+
+<h2>上传结果</h2>
+<svg width="{{.ChartWidth}}" height="{{len .Bars | barsHeight}}">
+{{range $i, $b := .Bars}}<text x="0" y="{{barY $i 16}}" font-size="13">{{$b.Name}}</text>
+<rect x="80" y="{{barY $i 4}}" width="{{$b.Width}}" height="16" fill="{{$b.Color}}"></rect>
+<text x="{{barLabelX $b.Width}}" y="{{barY $i 16}}" font-size="13">{{$b.Count}} ({{$b.Percent}})</text>
+{{end}}</svg>
+
+<h2>速度曲线</h2>
+{{if .SpeedPoints}}<svg width="{{.ChartWidth}}" height="{{.ChartHeight}}" style="border:1px solid #eee">
+<polyline points="{{.SpeedPoints}}" fill="none" stroke="#3a7afe" stroke-width="1.5"></polyline>
+<text x="4" y="14" font-size="12" fill="#999">{{.PeakSpeed}}/s</text>
+<text x="4" y="{{.ChartHeight}}" dy="-4" font-size="12" fill="#999">0</text>
+</svg>
+<div class="empty">横轴为时间，每秒采样一次，共 {{.SpeedSampleCount}} 秒</div>
+{{else}}<div class="empty">没有速度采样数据</div>{{end}}
+
+{{if .Stages}}<h2>阶段耗时分布</h2>
+<table>
+<tr><th>阶段</th><th>次数</th><th>总耗时</th><th>平均耗时</th><th>最大耗时</th><th>占比</th></tr>
+{{range .Stages}}<tr><td>{{.Name}}</td><td>{{.Count}}</td><td>{{.Total}}</td><td>{{.Average}}</td><td>{{.Max}}</td>
+<td><svg width="100" height="10"><rect width="{{.Width}}" height="10" fill="#3a7afe"></rect></svg> {{.Percent}}</td></tr>
+{{end}}</table>{{end}}
+
+<h2>失败文件清单</h2>
+{{if .FailedFiles}}<table>
+<tr><th>文件路径</th><th>文件大小</th><th>失败原因</th></tr>
+{{range .FailedFiles}}<tr><td>{{.Path}}</td><td>{{.Size}}</td><td>{{.Reason}}</td></tr>
+{{end}}</table>{{else}}<div class="empty">没有上传失败的文件</div>{{end}}
+
+{{if .OverLimitFiles}}<h2>超出套餐限制的文件</h2>
+<table>
+<tr><th>文件路径</th><th>文件大小</th><th>原因</th></tr>
+{{range .OverLimitFiles}}<tr><td>{{.Path}}</td><td>{{.Size}}</td><td>{{.Reason}}</td></tr>
+{{end}}</table>{{end}}
+
+<p class="empty">报告生成时间：{{.CreatedAt}}</p>
+</body>
+</html>
+`))
+
+// WriteFile 生成HTML报告并写入文件
+func (r *UploadHtmlReport) WriteFile(filePath string) error {
+	if r.Statistic == nil {
+		return fmt.Errorf("没有上传统计数据")
+	}
+	if dir := filepath.Dir(filePath); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return uploadHtmlReportTemplate.Execute(f, r.templateData())
+}
+
+func (r *UploadHtmlReport) templateData() map[string]interface{} {
+	st := r.Statistic
+	failedFiles := []*reportFile{}
+	for _, f := range st.FailedFiles() {
+		failedFiles = append(failedFiles, &reportFile{Path: f.LocalFilePath, Size: converter.ConvertFileSize(f.FileSize, 2), Reason: f.Reason})
+	}
+	overLimitFiles := []*reportFile{}
+	for _, f := range st.OverLimitFiles() {
+		overLimitFiles = append(overLimitFiles, &reportFile{Path: f.LocalFilePath, Size: converter.ConvertFileSize(f.FileSize, 2), Reason: f.Reason})
+	}
+
+	// 上传结果柱状图
+	succeedCount := st.SucceedCount()
+	otherCount := r.TotalCount - succeedCount - len(failedFiles)
+	if otherCount < 0 {
+		otherCount = 0
+	}
+	bars := []*reportBar{
+		{Name: "成功", Count: succeedCount, Color: "#52c41a"},
+		{Name: "失败", Count: len(failedFiles), Color: "#f5222d"},
+		{Name: "超出限制", Count: len(overLimitFiles), Color: "#faad14"},
+	}
+	if otherCount > 0 {
+		bars = append(bars, &reportBar{Name: "未完成", Count: otherCount, Color: "#bfbfbf"})
+	}
+	barTotal := 0
+	for _, b := range bars {
+		barTotal += b.Count
+	}
+	for _, b := range bars {
+		b.Percent = "0.00%"
+		if barTotal > 0 {
+			b.Width = float64(b.Count) / float64(barTotal) * (reportChartWidth - 200)
+			b.Percent = fmt.Sprintf("%.2f%%", float64(b.Count)/float64(barTotal)*100)
+		}
+	}
+
+	// 速度曲线
+	var averageSpeed, peakSpeed, p95Speed int64
+	var speedSeries []int64
+	if st.SpeedStat != nil {
+		averageSpeed = st.SpeedStat.Average()
+		peakSpeed = st.SpeedStat.Peak()
+		p95Speed = st.SpeedStat.Percentile(95)
+		speedSeries = st.SpeedStat.Series()
+	}
+	speedPoints := ""
+	if peakSpeed > 0 && len(speedSeries) > 1 {
+		points := make([]string, 0, len(speedSeries))
+		for i, v := range speedSeries {
+			x := float64(i) / float64(len(speedSeries)-1) * reportChartWidth
+			y := reportChartHeight - float64(v)/float64(peakSpeed)*(reportChartHeight-20)
+			points = append(points, fmt.Sprintf("%.1f,%.1f", x, y))
+		}
+		speedPoints = strings.Join(points, " ")
+	}
+
+	// 阶段耗时
+	stages := []*reportStage{}
+	for _, ss := range r.Timing.StageSummaries() {
+		stages = append(stages, &reportStage{
+			Name:    ss.Name,
+			Count:   ss.Count,
+			Total:   formatTimingDuration(ss.Total),
+			Average: formatTimingDuration(ss.Average()),
+			Max:     formatTimingDuration(ss.Max),
+			Percent: fmt.Sprintf("%.2f%%", ss.Percent),
+			Width:   ss.Percent,
+		})
+	}
+
+	return map[string]interface{}{
+		"Title":            r.Title,
+		"SavePath":         r.SavePath,
+		"StartTime":        r.StartTime.Format("2006-01-02 15:04:05"),
+		"Elapsed":          st.Elapsed().Round(time.Second).String(),
+		"TotalSize":        converter.ConvertFileSize(st.TotalSize(), 2),
+		"AverageSpeed":     converter.ConvertFileSize(averageSpeed, 2),
+		"PeakSpeed":        converter.ConvertFileSize(peakSpeed, 2),
+		"P95Speed":         converter.ConvertFileSize(p95Speed, 2),
+		"ChartWidth":       reportChartWidth,
+		"ChartHeight":      reportChartHeight,
+		"Bars":             bars,
+		"SpeedPoints":      speedPoints,
+		"SpeedSampleCount": len(speedSeries),
+		"Stages":           stages,
+		"FailedFiles":      failedFiles,
+		"OverLimitFiles":   overLimitFiles,
+		"CreatedAt":        time.Now().Format("2006-01-02 15:04:05"),
+	}
+}
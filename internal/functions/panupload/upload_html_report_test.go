@@ -0,0 +1,88 @@
+package panupload
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tickstep/aliyunpan/internal/functions"
+)
+
+func TestUploadHtmlReport(t *testing.T) {
+	st := &UploadStatistic{SpeedStat: functions.NewSpeedStat(5)}
+	st.StartTimer()
+	st.AddTotalSize(3072)
+	for _, v := range []int64{0, 1024, 2048} {
+		st.SpeedStat.Add(v)
+	}
+	st.AddSucceedFile()
+	st.AddSucceedFile()
+	st.AddFailedFile("/data/<b>.txt", 1024, "网络错误")
+	st.AddOverLimitFile("/data/big.iso", 1024, "超出单文件大小上限")
+
+	timing := NewUploadTimingReport()
+	timing.NewTiming("/data/a.txt", 1024).AddStage(TimingStageCreate, 0, time.Second)
+
+	// 报告目录不存在时自动创建
+	reportFile := filepath.Join(t.TempDir(), "report", "upload.html")
+	r := &UploadHtmlReport{
+		Title:      "上传报告",
+		SavePath:   "/backup",
+		StartTime:  time.Now(),
+		Statistic:  st,
+		Timing:     timing,
+		TotalCount: 4,
+	}
+	if err := r.WriteFile(reportFile); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(reportFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := string(data)
+	for _, s := range []string{
+		"<title>上传报告</title>",
+		"<td>/backup</td>",
+		"2 (40.00%)", // 成功
+		"1 (20.00%)", // 失败、超出限制、未完成
+		"未完成",
+		"<polyline points=",
+		"共 3 秒",
+		"<td>" + TimingStageCreate + "</td>",
+		"网络错误",
+		"/data/big.iso",
+		// 文件名需要转义
+		"/data/&lt;b&gt;.txt",
+	} {
+		if !strings.Contains(html, s) {
+			t.Errorf("report should contain %q", s)
+		}
+	}
+}
+
+func TestUploadHtmlReportEmpty(t *testing.T) {
+	r := &UploadHtmlReport{Title: "上传报告"}
+	if err := r.WriteFile(filepath.Join(t.TempDir(), "a.html")); err == nil {
+		t.Fatal("report without statistic should fail")
+	}
+
+	// 没有速度采样和耗时统计
+	reportFile := filepath.Join(t.TempDir(), "empty.html")
+	r.Statistic = &UploadStatistic{}
+	if err := r.WriteFile(reportFile); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(reportFile)
+	html := string(data)
+	for _, s := range []string{"没有速度采样数据", "没有上传失败的文件"} {
+		if !strings.Contains(html, s) {
+			t.Errorf("report should contain %q", s)
+		}
+	}
+	if strings.Contains(html, "阶段耗时分布") || strings.Contains(html, "未完成") {
+		t.Error("empty sections should be hidden")
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panupload
+
+import (
+	"encoding/csv"
+	"os"
+	"time"
+)
+
+// appendCsvManifest 追加记录到CSV清单文件，每行第一列为记录时间。清单文件不存在时先写入表头
+func appendCsvManifest(manifestFile string, header []string, rows [][]string) error {
+	_, statErr := os.Stat(manifestFile)
+	f, err := os.OpenFile(manifestFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	if os.IsNotExist(statErr) {
+		w.Write(append([]string{"时间"}, header...))
+	}
+	now := time.Now().Format("2006-01-02 15:04:05")
+	for _, row := range rows {
+		w.Write(append([]string{now}, row...))
+	}
+	w.Flush()
+	return w.Error()
+}
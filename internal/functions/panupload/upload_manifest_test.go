@@ -0,0 +1,52 @@
+package panupload
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readManifest(t *testing.T, file string) [][]string {
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func TestAppendManifest(t *testing.T) {
+	dir := t.TempDir()
+
+	encFile := filepath.Join(dir, "encrypt.csv")
+	for i := 0; i < 2; i++ {
+		if err := AppendEncryptManifest(encFile, []*EncryptItem{{LocalPath: "/a.txt", SavePath: "/pan/a.txt", EncPath: "/pan/a.txt.aenc"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	records := readManifest(t, encFile)
+	// 表头只写一次
+	if len(records) != 3 || records[0][0] != "时间" || records[0][3] != "加密文件网盘路径" {
+		t.Fatalf("unexpected encrypt manifest: %v", records)
+	}
+	if records[2][1] != "/a.txt" || records[2][3] != "/pan/a.txt.aenc" {
+		t.Fatalf("unexpected encrypt row: %v", records[2])
+	}
+
+	zipFile := filepath.Join(dir, "zip.csv")
+	if err := AppendZipManifest(zipFile, []*ZipRetryItem{{LocalPath: "/b.exe", SavePath: "/pan/b.exe", ZipPath: "/pan/x.zip", Password: "pwd"}}); err != nil {
+		t.Fatal(err)
+	}
+	records = readManifest(t, zipFile)
+	if len(records) != 2 || len(records[0]) != 5 || records[1][4] != "pwd" || records[1][3] != "/pan/x.zip" {
+		t.Fatalf("unexpected zip manifest: %v", records)
+	}
+	if info, _ := os.Stat(zipFile); info.Mode().Perm() != 0600 {
+		t.Fatalf("manifest perm: %v", info.Mode().Perm())
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panupload
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/tickstep/aliyunpan/cmder/cmdtable"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// NameConflictReport 只输出冲突报告，冲突的文件照常上传
+	NameConflictReport = "report"
+	// NameConflictSkip 同一文件夹下只上传最先扫描到的文件，跳过其余冲突的文件
+	NameConflictSkip = "skip"
+	// NameConflictRename 冲突的文件重命名后上传，例如 a.txt 上传为 a(1).txt
+	NameConflictRename = "rename"
+)
+
+type (
+	// NameConflictItem 上传到网盘同一文件夹下会产生冲突的文件
+	NameConflictItem struct {
+		Kind      string // 冲突类型：大小写、Unicode规范化
+		LocalPath string // 冲突的本地文件
+		PanPath   string // 原本要保存的网盘路径
+		FirstPath string // 先扫描到的同名文件的网盘路径
+		Action    string // 处理方式
+	}
+
+	// UploadNameConflict 扫描阶段检测上传到同一网盘文件夹下，只有大小写或者Unicode规范化形式不同的文件名。
+	// 这类文件在不区分大小写的文件系统上会互相覆盖，例如Windows本地的 A.txt 和 a.txt。所有方法都支持nil调用
+	UploadNameConflict struct {
+		policy string
+		// names 网盘文件夹 => 规范化的文件名 => 最先扫描到的文件名
+		names map[string]map[string]string
+		// renamedDirs 重命名或者所在的上级文件夹被重命名的文件夹，原网盘路径 => 实际网盘路径
+		renamedDirs map[string]string
+		items       []*NameConflictItem
+		mutex       sync.Mutex
+	}
+)
+
+// NewUploadNameConflict 创建文件名冲突检测，policy为 report、skip、rename
+func NewUploadNameConflict(policy string) (*UploadNameConflict, error) {
+	switch policy {
+	case "":
+		policy = NameConflictReport
+	case NameConflictReport, NameConflictSkip, NameConflictRename:
+	default:
+		return nil, fmt.Errorf("不支持的文件名冲突处理策略: %s, 可选值: report, skip, rename", policy)
+	}
+	return &UploadNameConflict{
+		policy:      policy,
+		names:       map[string]map[string]string{},
+		renamedDirs: map[string]string{},
+	}, nil
+}
+
+// foldName 文件名的规范化形式，统一为NFC形式并忽略大小写
+func foldName(name string) string {
+	return strings.ToLower(norm.NFC.String(name))
+}
+
+// Check 检测文件或者文件夹的网盘保存路径，返回实际使用的网盘路径，skip为true代表跳过该文件或者文件夹。
+// 文件夹需要先于其中的文件检测，文件夹被重命名后其中的文件会保存到重命名后的文件夹
+func (c *UploadNameConflict) Check(localPath, panPath string, isDir bool) (string, bool) {
+	if c == nil {
+		return panPath, false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	origPath := path.Clean(panPath)
+	dir, name := path.Split(origPath)
+	dir = path.Clean(dir)
+	if renamed, ok := c.renamedDirs[dir]; ok {
+		dir = renamed
+	}
+	targetPath := path.Join(dir, name)
+
+	names := c.names[dir]
+	if names == nil {
+		names = map[string]string{}
+		c.names[dir] = names
+	}
+	key := foldName(name)
+	first, exist := names[key]
+	if !exist || first == name {
+		names[key] = name
+		c.mapDir(origPath, targetPath, isDir)
+		return targetPath, false
+	}
+
+	item := &NameConflictItem{
+		Kind:      "大小写",
+		LocalPath: localPath,
+		PanPath:   targetPath,
+		FirstPath: path.Join(dir, first),
+	}
+	if norm.NFC.String(name) == norm.NFC.String(first) {
+		item.Kind = "Unicode规范化"
+	}
+	c.items = append(c.items, item)
+	switch c.policy {
+	case NameConflictSkip:
+		item.Action = "跳过"
+		return "", true
+	case NameConflictRename:
+		newName := c.uniqueName(names, name, isDir)
+		names[foldName(newName)] = newName
+		targetPath = path.Join(dir, newName)
+		item.Action = "重命名为 " + newName
+	default:
+		item.Action = "照常上传"
+	}
+	c.mapDir(origPath, targetPath, isDir)
+	return targetPath, false
+}
+
+// mapDir 记录文件夹实际使用的网盘路径，调用方需持有锁
+func (c *UploadNameConflict) mapDir(origPath, targetPath string, isDir bool) {
+	if isDir && origPath != targetPath {
+		c.renamedDirs[origPath] = targetPath
+	}
+}
+
+// uniqueName 生成和文件夹中已有文件名都不冲突的新文件名，例如 a(1).txt。调用方需持有锁
+func (c *UploadNameConflict) uniqueName(names map[string]string, name string, isDir bool) string {
+	base, ext := name, ""
+	if !isDir {
+		ext = path.Ext(name)
+		base = strings.TrimSuffix(name, ext)
+	}
+	for i := 1; ; i++ {
+		newName := fmt.Sprintf("%s(%d)%s", base, i, ext)
+		if _, exist := names[foldName(newName)]; !exist {
+			return newName
+		}
+	}
+}
+
+// Count 冲突的文件数量
+func (c *UploadNameConflict) Count() int {
+	if c == nil {
+		return 0
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.items)
+}
+
+// Print 输出冲突报告
+func (c *UploadNameConflict) Print(w io.Writer) {
+	if c.Count() == 0 {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	fmt.Fprintf(w, "检测到 %d 个文件名冲突, 以下文件和同一网盘文件夹下的其他文件只有大小写或者Unicode规范化形式不同, 在不区分大小写的系统中会互相覆盖: \n", len(c.items))
+	tb := cmdtable.NewTable(w)
+	tb.SetHeader([]string{"类型", "本地文件", "网盘路径", "冲突的网盘路径", "处理"})
+	for _, item := range c.items {
+		tb.Append([]string{item.Kind, item.LocalPath, item.PanPath, item.FirstPath, item.Action})
+	}
+	tb.Render()
+	if c.policy == NameConflictReport {
+		fmt.Fprintf(w, "可以使用 --name-conflict skip 跳过冲突的文件, 或者 --name-conflict rename 重命名后上传\n")
+	}
+}
@@ -0,0 +1,110 @@
+package panupload
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestNewUploadNameConflict(t *testing.T) {
+	cases := []struct {
+		policy string
+		want   string
+		err    bool
+	}{
+		{"", NameConflictReport, false},
+		{NameConflictSkip, NameConflictSkip, false},
+		{NameConflictRename, NameConflictRename, false},
+		{"overwrite", "", true},
+	}
+	for _, c := range cases {
+		nc, err := NewUploadNameConflict(c.policy)
+		if (err != nil) != c.err {
+			t.Errorf("policy %q: error %v", c.policy, err)
+			continue
+		}
+		if err == nil && nc.policy != c.want {
+			t.Errorf("policy %q: got %s, want %s", c.policy, nc.policy, c.want)
+		}
+	}
+}
+
+func TestUploadNameConflictCheck(t *testing.T) {
+	type check struct {
+		panPath string
+		isDir   bool
+		want    string
+		skip    bool
+	}
+	composed, decomposed := "caf\u00e9.txt", "cafe\u0301.txt"
+	cases := []struct {
+		name   string
+		policy string
+		checks []check
+		count  int
+	}{
+		{"没有冲突", NameConflictRename, []check{
+			{"/backup/a.txt", false, "/backup/a.txt", false},
+			{"/backup/b.txt", false, "/backup/b.txt", false},
+			{"/backup/sub/A.txt", false, "/backup/sub/A.txt", false},
+			{"/backup/a.txt", false, "/backup/a.txt", false},
+		}, 0},
+		{"报告大小写冲突", NameConflictReport, []check{
+			{"/backup/a.txt", false, "/backup/a.txt", false},
+			{"/backup/A.txt", false, "/backup/A.txt", false},
+		}, 1},
+		{"跳过冲突文件", NameConflictSkip, []check{
+			{"/backup/a.txt", false, "/backup/a.txt", false},
+			{"/backup/A.TXT", false, "", true},
+			{"/backup/" + decomposed, false, "/backup/" + decomposed, false},
+			{"/backup/" + composed, false, "", true},
+		}, 2},
+		{"重命名冲突文件", NameConflictRename, []check{
+			{"/backup/a.txt", false, "/backup/a.txt", false},
+			{"/backup/A.txt", false, "/backup/A(1).txt", false},
+			{"/backup/a(1).TXT", false, "/backup/a(1)(1).TXT", false},
+			{"/backup/A.Txt", false, "/backup/A(2).Txt", false},
+		}, 3},
+		{"重命名冲突文件夹", NameConflictRename, []check{
+			{"/backup/docs", true, "/backup/docs", false},
+			{"/backup/Docs.v1", true, "/backup/Docs.v1", false},
+			{"/backup/DOCS.V1", true, "/backup/DOCS.V1(1)", false},
+			{"/backup/DOCS.V1/a.txt", false, "/backup/DOCS.V1(1)/a.txt", false},
+			{"/backup/DOCS.V1/sub", true, "/backup/DOCS.V1(1)/sub", false},
+			{"/backup/DOCS.V1/sub/b.txt", false, "/backup/DOCS.V1(1)/sub/b.txt", false},
+		}, 1},
+	}
+	for _, c := range cases {
+		nc, _ := NewUploadNameConflict(c.policy)
+		for _, ck := range c.checks {
+			got, skip := nc.Check("/local"+ck.panPath, ck.panPath, ck.isDir)
+			if got != ck.want || skip != ck.skip {
+				t.Errorf("%s: check %s got %s, %v, want %s, %v", c.name, ck.panPath, got, skip, ck.want, ck.skip)
+			}
+		}
+		if nc.Count() != c.count {
+			t.Errorf("%s: count %d, want %d", c.name, nc.Count(), c.count)
+		}
+	}
+}
+
+func TestUploadNameConflictPrint(t *testing.T) {
+	nc, _ := NewUploadNameConflict(NameConflictSkip)
+	nc.Check("/l/a.txt", "/backup/a.txt", false)
+	nc.Check("/l/A.txt", "/backup/A.txt", false)
+	buf := &bytes.Buffer{}
+	nc.Print(buf)
+	if !strings.Contains(buf.String(), "检测到 1 个文件名冲突") || !strings.Contains(buf.String(), "跳过") {
+		t.Fatal(buf.String())
+	}
+
+	var nilConflict *UploadNameConflict
+	if p, skip := nilConflict.Check("/l/a.txt", "/backup/a.txt", false); p != "/backup/a.txt" || skip {
+		t.Fatal("nil conflict should keep path")
+	}
+	buf.Reset()
+	nilConflict.Print(buf)
+	if buf.Len() != 0 {
+		t.Fatal("nil conflict should print nothing")
+	}
+}
@@ -0,0 +1,46 @@
+package panupload
+
+import (
+	"testing"
+
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/localfile"
+	"github.com/tickstep/aliyunpan/internal/plugins"
+)
+
+// finishRecordPlugin 记录上传完成回调
+type finishRecordPlugin struct {
+	plugins.IdlePlugin
+	results []string
+}
+
+func (p *finishRecordPlugin) UploadFileFinishCallback(context *plugins.Context, params *plugins.UploadFileFinishParams) error {
+	p.results = append(p.results, params.LocalFileName+":"+params.UploadResult)
+	return nil
+}
+
+func TestUploadPluginCallbackSharedPlugin(t *testing.T) {
+	// 批次内的所有任务共用同一个插件，回调不重新加载插件
+	plugin := &finishRecordPlugin{}
+	user := &config.PanUser{UserId: "u1"}
+	for _, name := range []string{"a.txt", "b.txt"} {
+		utu := &UploadTaskUnit{
+			LocalFileChecksum: localfile.NewLocalSymlinkFileEntity(localfile.NewSymlinkFile("/data/" + name)),
+			User:              user,
+			Plugin:            plugin,
+		}
+		if utu.plugin() != plugin {
+			t.Fatal("should use the shared plugin")
+		}
+		utu.pluginCallback("success")
+	}
+	if len(plugin.results) != 2 || plugin.results[0] != "a.txt:success" || plugin.results[1] != "b.txt:success" {
+		t.Fatalf("callbacks %v", plugin.results)
+	}
+
+	// 没有共用插件时按需加载，没有插件文件时使用空插件
+	t.Setenv(config.EnvConfigDir, t.TempDir())
+	if (&UploadTaskUnit{}).plugin() == nil {
+		t.Fatal("should load a plugin")
+	}
+}
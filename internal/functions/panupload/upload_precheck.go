@@ -0,0 +1,101 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panupload
+
+import (
+	"io"
+	"os"
+
+	"github.com/tickstep/aliyunpan/cmder/cmdtable"
+	"github.com/tickstep/library-go/converter"
+)
+
+const (
+	// PrecheckUnreadableFile 文件不可读
+	PrecheckUnreadableFile = "文件不可读"
+	// PrecheckUnreadableDir 目录无法访问
+	PrecheckUnreadableDir = "目录无法访问"
+	// PrecheckEmptyFile 0字节文件
+	PrecheckEmptyFile = "0字节文件"
+)
+
+type (
+	// PrecheckIssue 上传预检发现的问题
+	PrecheckIssue struct {
+		Kind      string
+		LocalPath string
+		FileSize  int64
+		Reason    string
+	}
+
+	// UploadPrecheck 上传扫描阶段的磁盘源预检，提前发现不可读的文件、无法访问的目录以及0字节文件，
+	// 汇总输出，避免到任务执行时才逐个报错
+	UploadPrecheck struct {
+		issues []*PrecheckIssue
+	}
+)
+
+// NewUploadPrecheck 创建上传预检
+func NewUploadPrecheck() *UploadPrecheck {
+	return &UploadPrecheck{
+		issues: []*PrecheckIssue{},
+	}
+}
+
+// CheckFile 检测文件是否可以上传，不可读的文件返回 false，0字节文件只记录警告
+func (p *UploadPrecheck) CheckFile(realPath, logicPath string, fileSize int64) bool {
+	f, err := os.Open(realPath)
+	if err != nil {
+		p.add(PrecheckUnreadableFile, logicPath, fileSize, err.Error())
+		return false
+	}
+	f.Close()
+	if fileSize == 0 {
+		p.add(PrecheckEmptyFile, logicPath, fileSize, "")
+	}
+	return true
+}
+
+// AddWalkError 记录遍历过程中无法访问的文件或目录
+func (p *UploadPrecheck) AddWalkError(logicPath string, err error) {
+	p.add(PrecheckUnreadableDir, logicPath, 0, err.Error())
+}
+
+func (p *UploadPrecheck) add(kind, logicPath string, fileSize int64, reason string) {
+	p.issues = append(p.issues, &PrecheckIssue{
+		Kind:      kind,
+		LocalPath: logicPath,
+		FileSize:  fileSize,
+		Reason:    reason,
+	})
+}
+
+// Issues 所有发现的问题
+func (p *UploadPrecheck) Issues() []*PrecheckIssue {
+	return p.issues
+}
+
+// Print 汇总输出预检发现的问题
+func (p *UploadPrecheck) Print(w io.Writer) {
+	if len(p.issues) == 0 {
+		return
+	}
+	io.WriteString(w, "上传预检发现以下问题, 不可读的文件和无法访问的目录不会上传: \n")
+	tb := cmdtable.NewTable(w)
+	tb.SetHeader([]string{"类型", "文件路径", "文件大小", "原因"})
+	for _, issue := range p.issues {
+		tb.Append([]string{issue.Kind, issue.LocalPath, converter.ConvertFileSize(issue.FileSize, 2), issue.Reason})
+	}
+	tb.Render()
+}
@@ -0,0 +1,64 @@
+package panupload
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUploadPrecheck(t *testing.T) {
+	dir := t.TempDir()
+	normal := filepath.Join(dir, "a.txt")
+	os.WriteFile(normal, []byte("hello"), 0644)
+	empty := filepath.Join(dir, "empty.txt")
+	os.WriteFile(empty, nil, 0644)
+
+	p := NewUploadPrecheck()
+	buf := &bytes.Buffer{}
+	p.Print(buf)
+	if buf.Len() != 0 {
+		t.Fatal("nothing should be printed without issues")
+	}
+
+	if !p.CheckFile(normal, "/data/a.txt", 5) {
+		t.Fatal("readable file should pass")
+	}
+	// 0字节文件只警告，仍然上传
+	if !p.CheckFile(empty, "/data/empty.txt", 0) {
+		t.Fatal("empty file should pass")
+	}
+	if p.CheckFile(filepath.Join(dir, "none.txt"), "/data/none.txt", 5) {
+		t.Fatal("unreadable file should fail")
+	}
+	if os.Getuid() != 0 {
+		locked := filepath.Join(dir, "locked.txt")
+		os.WriteFile(locked, []byte("locked"), 0000)
+		if p.CheckFile(locked, "/data/locked.txt", 6) {
+			t.Fatal("file without read permission should fail")
+		}
+		p.issues = p.issues[:len(p.issues)-1]
+	}
+	p.AddWalkError("/data/private", errors.New("permission denied"))
+
+	issues := p.Issues()
+	if len(issues) != 3 {
+		t.Fatalf("issues: %d", len(issues))
+	}
+	kinds := []string{PrecheckEmptyFile, PrecheckUnreadableFile, PrecheckUnreadableDir}
+	paths := []string{"/data/empty.txt", "/data/none.txt", "/data/private"}
+	for i, issue := range issues {
+		if issue.Kind != kinds[i] || issue.LocalPath != paths[i] {
+			t.Errorf("issue %d: %s %s", i, issue.Kind, issue.LocalPath)
+		}
+	}
+
+	p.Print(buf)
+	for _, s := range append(paths, "permission denied", "上传预检发现以下问题") {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("output should contain %q", s)
+		}
+	}
+}
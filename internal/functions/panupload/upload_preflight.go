@@ -0,0 +1,75 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panupload
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
+	"github.com/tickstep/aliyunpan-api/aliyunpan_open/openapi"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/functions"
+)
+
+var (
+	// UploadPreflightTimeout 预检请求的超时时间
+	UploadPreflightTimeout = 10 * time.Second
+	// UploadPreflightSlowLatency 预检时延超过该值时提示网络状况较差，上传可能比较慢或者较多失败重试，不影响上传
+	UploadPreflightSlowLatency = 5 * time.Second
+)
+
+// UploadPreflightResult 上传前网络预检结果
+type UploadPreflightResult struct {
+	Latency time.Duration // 访问API服务的时延
+	Warning string        // 不影响上传的警告，例如时延过高
+}
+
+// UploadPreflight 批量上传前的轻量探测：API服务是否可达、时延是否正常、登录token是否有效。
+// 服务不可达、token失效时返回明确的错误，调用方直接退出，不再生成上传任务后逐个失败；时延过高只给出警告
+func UploadPreflight(panClient *config.PanClient) (*UploadPreflightResult, error) {
+	return uploadPreflight(openapi.OPENAPI_URL, func() *apierror.ApiError {
+		_, apierr := panClient.OpenapiPanClient().GetUserInfo()
+		return apierr
+	})
+}
+
+// uploadPreflight 探测 probeURL 是否可达并测量时延，再通过 checkToken 检查登录token
+func uploadPreflight(probeURL string, checkToken func() *apierror.ApiError) (*UploadPreflightResult, error) {
+	result := &UploadPreflightResult{}
+
+	// API服务可达，并测量时延
+	client := config.Config.HTTPClient("")
+	client.SetTimeout(UploadPreflightTimeout)
+	requestStart := time.Now()
+	resp, err := client.Req(http.MethodHead, probeURL, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("无法连接阿里云盘服务 %s, 请检查网络或者代理设置: %s", probeURL, err)
+	}
+	resp.Body.Close()
+	result.Latency = time.Since(requestStart)
+	if result.Latency > UploadPreflightSlowLatency {
+		result.Warning = fmt.Sprintf("访问阿里云盘服务时延较高(%s), 上传可能比较慢", result.Latency.Round(time.Millisecond))
+	}
+
+	// 登录token有效
+	if apierr := checkToken(); apierr != nil {
+		if kind := functions.ClassifyRiskError(apierr); kind != functions.RiskNone {
+			return result, fmt.Errorf("%s, %s", apierr, functions.GetRiskAdvice(kind))
+		}
+		return result, fmt.Errorf("获取用户信息失败, 请检查登录状态: %s", apierr)
+	}
+	return result, nil
+}
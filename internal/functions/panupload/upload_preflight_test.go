@@ -0,0 +1,84 @@
+package panupload
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
+)
+
+func tokenOk() *apierror.ApiError {
+	return nil
+}
+
+func TestUploadPreflight(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	result, err := uploadPreflight(server.URL, tokenOk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Latency <= 0 || result.Warning != "" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+}
+
+func TestUploadPreflightSlowLatencyWarns(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer server.Close()
+	old := UploadPreflightSlowLatency
+	UploadPreflightSlowLatency = 10 * time.Millisecond
+	defer func() { UploadPreflightSlowLatency = old }()
+
+	// 时延过高只警告，不影响上传
+	result, err := uploadPreflight(server.URL, tokenOk)
+	if err != nil {
+		t.Fatalf("slow latency should not fail: %s", err)
+	}
+	if !strings.Contains(result.Warning, "时延较高") {
+		t.Fatalf("expect latency warning: %+v", result)
+	}
+}
+
+func TestUploadPreflightUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := server.URL
+	server.Close()
+
+	checked := false
+	_, err := uploadPreflight(url, func() *apierror.ApiError {
+		checked = true
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "无法连接阿里云盘服务") {
+		t.Fatalf("expect unreachable error: %v", err)
+	}
+	if checked {
+		t.Error("token should not be checked when server is unreachable")
+	}
+}
+
+func TestUploadPreflightTokenInvalid(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	_, err := uploadPreflight(server.URL, func() *apierror.ApiError {
+		return apierror.NewApiError(apierror.ApiCodeTokenExpiredCode, "token expired")
+	})
+	if err == nil || !strings.Contains(err.Error(), "token expired") {
+		t.Fatalf("expect token error: %v", err)
+	}
+
+	_, err = uploadPreflight(server.URL, func() *apierror.ApiError {
+		return apierror.NewApiError(apierror.ApiCodeFailed, "failed")
+	})
+	if err == nil || !strings.Contains(err.Error(), "请检查登录状态") {
+		t.Fatalf("expect login error: %v", err)
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panupload
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/tickstep/library-go/converter"
+)
+
+type (
+	// UploadProfile 上传参数profile，按扩展名和文件大小匹配文件，对匹配的文件使用不同的上传参数
+	UploadProfile struct {
+		// Name 名称
+		Name string `json:"name"`
+		// Extensions 匹配的扩展名，例如：.mp4，为空代表不限制扩展名
+		Extensions []string `json:"extensions"`
+		// MinSize 匹配的最小文件大小（包含），例如：100MB，为空代表不限制
+		MinSize string `json:"minSize"`
+		// MaxSize 匹配的最大文件大小（不包含），例如：1GB，为空代表不限制
+		MaxSize string `json:"maxSize"`
+		// BlockSize 上传分片大小，例如：20MB，为空代表使用默认值
+		BlockSize string `json:"blockSize"`
+		// Parallel 该类文件同时上传的最大数量，0代表使用默认值
+		Parallel int `json:"parallel"`
+		// RapidUpload 是否检测秒传，为空代表使用默认值
+		RapidUpload *bool `json:"rapidUpload"`
+
+		minSize   int64
+		maxSize   int64
+		blockSize int64
+		slots     chan struct{} // 并发控制
+	}
+
+	// UploadProfileConfig 上传参数profile配置文件
+	UploadProfileConfig struct {
+		Profiles []*UploadProfile `json:"profiles"`
+
+		defaultProfile *UploadProfile // 没有匹配任何profile的文件使用的默认profile
+	}
+)
+
+// LoadUploadProfileConfig 加载上传参数profile配置文件，文件不存在返回nil
+func LoadUploadProfileConfig(filePath string) (*UploadProfileConfig, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	cfg := &UploadProfileConfig{}
+	if err = jsoniter.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("配置文件格式错误: %s", err)
+	}
+	if len(cfg.Profiles) == 0 {
+		return nil, nil
+	}
+	for _, p := range cfg.Profiles {
+		if err = p.parse(); err != nil {
+			return nil, fmt.Errorf("profile %s 配置错误: %s", p.Name, err)
+		}
+	}
+	return cfg, nil
+}
+
+func (p *UploadProfile) parse() (err error) {
+	if p.MinSize != "" {
+		if p.minSize, err = converter.ParseFileSizeStr(p.MinSize); err != nil {
+			return
+		}
+	}
+	if p.MaxSize != "" {
+		if p.maxSize, err = converter.ParseFileSizeStr(p.MaxSize); err != nil {
+			return
+		}
+	}
+	if p.BlockSize != "" {
+		if p.blockSize, err = converter.ParseFileSizeStr(p.BlockSize); err != nil {
+			return
+		}
+	}
+	if p.Parallel < 0 {
+		return fmt.Errorf("parallel 不能小于0")
+	}
+	for i, ext := range p.Extensions {
+		ext = strings.ToLower(ext)
+		if ext != "" && !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		p.Extensions[i] = ext
+	}
+	return nil
+}
+
+// Prepare 根据默认并发数初始化各个profile的并发控制，返回任务调度器需要的最大并发数
+func (c *UploadProfileConfig) Prepare(defaultParallel int) int {
+	if c == nil {
+		return defaultParallel
+	}
+	maxParallel := defaultParallel
+	for _, p := range c.Profiles {
+		if p.Parallel <= 0 {
+			p.Parallel = defaultParallel
+		}
+		p.slots = make(chan struct{}, p.Parallel)
+		if p.Parallel > maxParallel {
+			maxParallel = p.Parallel
+		}
+	}
+	c.defaultProfile = &UploadProfile{
+		Name:     "default",
+		Parallel: defaultParallel,
+		slots:    make(chan struct{}, defaultParallel),
+	}
+	return maxParallel
+}
+
+// Match 按照配置顺序匹配文件使用的profile，没有匹配的返回默认profile
+func (c *UploadProfileConfig) Match(filePath string, fileSize int64) *UploadProfile {
+	if c == nil {
+		return nil
+	}
+	ext := strings.ToLower(filepath.Ext(filePath))
+	for _, p := range c.Profiles {
+		if len(p.Extensions) > 0 {
+			matched := false
+			for _, e := range p.Extensions {
+				if e == ext {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				continue
+			}
+		}
+		if p.MinSize != "" && fileSize < p.minSize {
+			continue
+		}
+		if p.MaxSize != "" && fileSize >= p.maxSize {
+			continue
+		}
+		return p
+	}
+	return c.defaultProfile
+}
+
+// Apply 使用profile的参数覆盖默认的分片大小以及秒传选项。profile不检测秒传时同时跳过SHA1计算
+func (p *UploadProfile) Apply(blockSize int64, noRapidUpload, noChecksum bool) (int64, bool, bool) {
+	if p == nil {
+		return blockSize, noRapidUpload, noChecksum
+	}
+	if p.blockSize > 0 {
+		blockSize = p.blockSize
+	}
+	if p.RapidUpload != nil {
+		noRapidUpload = !*p.RapidUpload
+		noChecksum = noRapidUpload
+	}
+	return blockSize, noRapidUpload, noChecksum
+}
+
+// TryAcquire 占用一个上传并发名额，名额用完时返回false，不会等待。
+// 名额用完的文件让出执行位置，其他profile的文件可以继续上传，避免一类文件阻塞整个队列
+func (p *UploadProfile) TryAcquire() bool {
+	if p == nil || p.slots == nil {
+		return true
+	}
+	select {
+	case p.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Release 释放上传并发名额
+func (p *UploadProfile) Release() {
+	if p == nil || p.slots == nil {
+		return
+	}
+	<-p.slots
+}
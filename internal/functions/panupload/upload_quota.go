@@ -0,0 +1,82 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panupload
+
+import (
+	"sync"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
+	"github.com/tickstep/aliyunpan/internal/config"
+)
+
+type (
+	// UploadQuota 账号的上传容量限制。用于在扫描阶段提前识别超出网盘剩余容量的文件。
+	// 开放平台接口不提供单文件大小上限，只有Web端的个人信息接口返回，并且SDK没有公开该字段，
+	// 所以扫描阶段不判断单文件大小，超出上限的文件在创建上传任务返回 ApiCodeUploadPayloadTooLarge 时记为超出套餐限制
+	UploadQuota struct {
+		ThirdPartyVip bool  // 是否开通了三方权益包
+		TotalSize     int64 // 网盘总容量
+		UsedSize      int64 // 网盘已使用容量
+
+		// reservedSize 扫描阶段已经预占的容量
+		reservedSize int64
+		mutex        sync.Mutex
+	}
+)
+
+// NewUploadQuota 查询账号容量信息并创建上传容量限制
+func NewUploadQuota(panClient *config.PanClient) (*UploadQuota, *apierror.ApiError) {
+	userInfo, err := panClient.OpenapiPanClient().GetUserInfo()
+	if err != nil {
+		return nil, err
+	}
+	return &UploadQuota{
+		ThirdPartyVip: userInfo.ThirdPartyVip,
+		TotalSize:     int64(userInfo.TotalSize),
+		UsedSize:      int64(userInfo.UsedSize),
+	}, nil
+}
+
+// FreeSize 剩余可用容量
+func (q *UploadQuota) FreeSize() int64 {
+	free := q.TotalSize - q.UsedSize
+	if free < 0 {
+		return 0
+	}
+	return free
+}
+
+// Reserve 为待上传文件预占容量，文件超出套餐限制时返回 false 以及原因
+func (q *UploadQuota) Reserve(fileSize int64) (ok bool, reason string) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.TotalSize > 0 && q.reservedSize+fileSize > q.TotalSize-q.UsedSize {
+		return false, "超出网盘剩余容量"
+	}
+	q.reservedSize += fileSize
+	return true, ""
+}
+
+// Release 释放预占的容量，文件上传失败、取消或者没有加入上传队列时调用
+func (q *UploadQuota) Release(fileSize int64) {
+	if q == nil {
+		return
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.reservedSize -= fileSize
+	if q.reservedSize < 0 {
+		q.reservedSize = 0
+	}
+}
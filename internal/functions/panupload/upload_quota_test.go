@@ -0,0 +1,60 @@
+package panupload
+
+import (
+	"testing"
+)
+
+func TestUploadQuotaReleaseOnFailure(t *testing.T) {
+	uploadQuota := &UploadQuota{TotalSize: 1000, UsedSize: 0}
+	targetQuota := &TargetQuota{Limit: 1000}
+	for _, q := range []interface {
+		Reserve(int64) (bool, string)
+	}{uploadQuota, targetQuota} {
+		if ok, _ := q.Reserve(800); !ok {
+			t.Fatal("reserve should succeed")
+		}
+		if ok, _ := q.Reserve(300); ok {
+			t.Fatal("reserve over quota should fail")
+		}
+	}
+
+	// 文件没有上传成功时释放预占的容量，只释放一次
+	utu := &UploadTaskUnit{UploadQuota: uploadQuota, TargetQuota: targetQuota, ReservedSize: 800}
+	utu.OnComplete(nil)
+	utu.OnComplete(nil)
+	if uploadQuota.reservedSize != 0 || targetQuota.reservedSize != 0 {
+		t.Fatalf("reserved = %d, %d", uploadQuota.reservedSize, targetQuota.reservedSize)
+	}
+	for _, q := range []interface {
+		Reserve(int64) (bool, string)
+	}{uploadQuota, targetQuota} {
+		if ok, _ := q.Reserve(300); !ok {
+			t.Fatal("released quota should be available")
+		}
+	}
+
+	// nil 也可以调用
+	(*UploadQuota)(nil).Release(100)
+	(*TargetQuota)(nil).Release(100)
+}
+
+func TestUploadQuotaReserve(t *testing.T) {
+	cases := []struct {
+		name  string
+		quota *UploadQuota
+		sizes []int64
+		want  []bool
+	}{
+		// 单文件大小上限无法查询，扫描阶段只按剩余容量判断
+		{"大文件不超出剩余容量", &UploadQuota{TotalSize: 1 << 50, UsedSize: 1 << 40}, []int64{1 << 41, 1 << 41}, []bool{true, true}},
+		{"累计超出剩余容量", &UploadQuota{TotalSize: 1000, UsedSize: 400}, []int64{500, 200, 100}, []bool{true, false, true}},
+		{"容量未知", &UploadQuota{}, []int64{1 << 40}, []bool{true}},
+	}
+	for _, c := range cases {
+		for i, size := range c.sizes {
+			if ok, reason := c.quota.Reserve(size); ok != c.want[i] {
+				t.Errorf("%s: reserve %d = %v, %s", c.name, size, ok, reason)
+			}
+		}
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panupload
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/tickstep/aliyunpan/internal/utils"
+	"github.com/tickstep/library-go/converter"
+	"github.com/tickstep/library-go/logger"
+)
+
+type (
+	// UploadEventType 上传事件类型
+	UploadEventType string
+
+	// UploadProgress 上传进度
+	UploadProgress struct {
+		Uploaded    int64 `json:"uploaded"`    // 已上传的字节数
+		TotalSize   int64 `json:"totalSize"`   // 文件大小
+		Speed       int64 `json:"speed"`       // 当前文件上传速度，单位 B/s
+		GlobalSpeed int64 `json:"globalSpeed"` // 所有文件的总上传速度，单位 B/s
+		Elapsed     int64 `json:"elapsed"`     // 已用时间，单位秒
+		Left        int64 `json:"left"`        // 预计剩余时间，单位秒，-1代表未知
+	}
+
+	// UploadEvent 上传任务单元上报的事件
+	UploadEvent struct {
+		Type      UploadEventType `json:"type"`
+		TaskId    string          `json:"taskId"`
+		Time      time.Time       `json:"time"`
+		LocalPath string          `json:"localPath,omitempty"`
+		PanPath   string          `json:"panPath,omitempty"`
+		Message   string          `json:"message,omitempty"`
+		Error     string          `json:"error,omitempty"`
+		// Succeed 任务单元运行结果，只有 result 事件有效
+		Succeed bool `json:"succeed,omitempty"`
+		// Elapsed 任务单元运行耗时，单位秒，只有 result 事件有效
+		Elapsed  float64         `json:"elapsed,omitempty"`
+		Retry    int             `json:"retry,omitempty"`
+		MaxRetry int             `json:"maxRetry,omitempty"`
+		Progress *UploadProgress `json:"progress,omitempty"`
+	}
+
+	// UploadReporter 上传状态上报接口，任务单元的进度、结果和错误信息都通过该接口输出，
+	// 可以替换为其他实现，例如GUI前端。Report 会被多个任务单元并发调用
+	UploadReporter interface {
+		Report(event *UploadEvent)
+	}
+
+	// CliUploadReporter 命令行输出
+	CliUploadReporter struct {
+		w            io.Writer
+		showProgress bool
+		progressing  bool // 上一次输出的是进度，没有换行
+		mutex        sync.Mutex
+	}
+
+	// JsonUploadReporter JSON事件流输出，每个事件一行JSON
+	JsonUploadReporter struct {
+		encoder *json.Encoder
+		mutex   sync.Mutex
+	}
+)
+
+const (
+	// UploadEventPrepare 准备上传
+	UploadEventPrepare UploadEventType = "prepare"
+	// UploadEventInfo 上传过程中的提示信息
+	UploadEventInfo UploadEventType = "info"
+	// UploadEventProgress 上传进度
+	UploadEventProgress UploadEventType = "progress"
+	// UploadEventSuccess 上传成功
+	UploadEventSuccess UploadEventType = "success"
+	// UploadEventSkip 跳过上传，例如网盘已存在同名文件
+	UploadEventSkip UploadEventType = "skip"
+	// UploadEventError 上传出错
+	UploadEventError UploadEventType = "error"
+	// UploadEventRetry 上传出错，等待重试
+	UploadEventRetry UploadEventType = "retry"
+	// UploadEventPause 上传已暂停
+	UploadEventPause UploadEventType = "pause"
+	// UploadEventResume 上传已恢复
+	UploadEventResume UploadEventType = "resume"
+	// UploadEventCancel 上传已取消
+	UploadEventCancel UploadEventType = "cancel"
+	// UploadEventResult 任务单元运行结束，每次运行(包括重试)上报一次
+	UploadEventResult UploadEventType = "result"
+)
+
+// NewCliUploadReporter 创建命令行输出，showProgress 为false时不输出上传进度
+func NewCliUploadReporter(w io.Writer, showProgress bool) *CliUploadReporter {
+	return &CliUploadReporter{
+		w:            w,
+		showProgress: showProgress,
+	}
+}
+
+// Report 输出事件
+func (r *CliUploadReporter) Report(event *UploadEvent) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if event.Type == UploadEventProgress {
+		if !r.showProgress || event.Progress == nil {
+			return
+		}
+		p := event.Progress
+		leftStr := "-" // 如果上传速度为0, 剩余时间未知, 则用 - 代替
+		if p.Left >= 0 {
+			leftStr = (time.Duration(p.Left) * time.Second).String()
+		}
+		var percentage float64
+		if p.TotalSize > 0 {
+			percentage = float64(p.Uploaded) / float64(p.TotalSize) * 100
+		}
+		fmt.Fprintf(r.w, "\r[%s] ↑ %s/%s(%.2f%%) %s/s(%s/s) in %s, left %s ............", event.TaskId,
+			converter.ConvertFileSize(p.Uploaded, 2),
+			converter.ConvertFileSize(p.TotalSize, 2),
+			percentage,
+			converter.ConvertFileSize(p.Speed, 2),
+			converter.ConvertFileSize(p.GlobalSpeed, 2),
+			time.Duration(p.Elapsed)*time.Second,
+			leftStr,
+		)
+		r.progressing = true
+		return
+	}
+
+	if r.progressing {
+		// 结束进度行
+		fmt.Fprintln(r.w)
+		r.progressing = false
+	}
+	msg := event.Message
+	switch event.Type {
+	case UploadEventRetry:
+		if event.Error != "" {
+			msg += ", " + event.Error
+		}
+		msg = fmt.Sprintf("%s, 重试 %d/%d", msg, event.Retry, event.MaxRetry)
+	case UploadEventResult:
+		if event.Error != "" {
+			msg = "失败！" + msg + "," + event.Error
+		} else if event.Succeed {
+			msg = "成功！" + msg
+		}
+		msg = fmt.Sprintf("文件上传结果： %s 耗时 %s", msg, utils.ConvertTime(time.Duration(event.Elapsed*float64(time.Second))))
+	}
+	fmt.Fprintf(r.w, "[%s] %s %s\n", event.TaskId, event.Time.Format("2006-01-02 15:04:05"), msg)
+}
+
+// NewJsonUploadReporter 创建JSON事件流输出
+func NewJsonUploadReporter(w io.Writer) *JsonUploadReporter {
+	return &JsonUploadReporter{
+		encoder: json.NewEncoder(w),
+	}
+}
+
+// Report 输出一行JSON
+func (r *JsonUploadReporter) Report(event *UploadEvent) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if err := r.encoder.Encode(event); err != nil {
+		logger.Verboseln("write upload event error: ", err)
+	}
+}
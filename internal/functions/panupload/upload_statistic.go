@@ -14,11 +14,95 @@
 package panupload
 
 import (
+	"sync"
+
 	"github.com/tickstep/aliyunpan/internal/functions"
 )
 
 type (
 	UploadStatistic struct {
 		functions.Statistic
+		SpeedStat *functions.SpeedStat // 全局上传速度统计，可以为nil
+
+		overLimitFiles []*OverLimitFile // 超出套餐限制而跳过的文件
+		succeedCount   int              // 上传成功的文件数量
+		failedFiles    []*FailedFile    // 上传失败的文件
+		mutex          sync.Mutex
+	}
+
+	// FailedFile 上传失败的文件
+	FailedFile struct {
+		LocalFilePath string `json:"localFilePath"`
+		FileSize      int64  `json:"fileSize"`
+		Reason        string `json:"reason"`
+	}
+
+	// OverLimitFile 超出套餐限制的文件
+	OverLimitFile struct {
+		LocalFilePath string `json:"localFilePath"`
+		FileSize      int64  `json:"fileSize"`
+		Reason        string `json:"reason"`
 	}
 )
+
+// AddOverLimitFile 记录超出套餐限制的文件
+func (us *UploadStatistic) AddOverLimitFile(localFilePath string, fileSize int64, reason string) {
+	us.mutex.Lock()
+	defer us.mutex.Unlock()
+	us.overLimitFiles = append(us.overLimitFiles, &OverLimitFile{
+		LocalFilePath: localFilePath,
+		FileSize:      fileSize,
+		Reason:        reason,
+	})
+}
+
+// OverLimitFiles 超出套餐限制的文件列表
+func (us *UploadStatistic) OverLimitFiles() []*OverLimitFile {
+	us.mutex.Lock()
+	defer us.mutex.Unlock()
+	return us.overLimitFiles
+}
+
+// AddSucceedFile 记录上传成功的文件
+func (us *UploadStatistic) AddSucceedFile() {
+	us.mutex.Lock()
+	defer us.mutex.Unlock()
+	us.succeedCount += 1
+}
+
+// SucceedCount 上传成功的文件数量
+func (us *UploadStatistic) SucceedCount() int {
+	us.mutex.Lock()
+	defer us.mutex.Unlock()
+	return us.succeedCount
+}
+
+// AddFailedFile 记录上传失败的文件
+func (us *UploadStatistic) AddFailedFile(localFilePath string, fileSize int64, reason string) {
+	us.mutex.Lock()
+	defer us.mutex.Unlock()
+	us.failedFiles = append(us.failedFiles, &FailedFile{
+		LocalFilePath: localFilePath,
+		FileSize:      fileSize,
+		Reason:        reason,
+	})
+}
+
+// RemoveFailedFile 移除上传失败的文件记录，用于失败后通过其他方式上传成功的文件
+func (us *UploadStatistic) RemoveFailedFile(localFilePath string) {
+	us.mutex.Lock()
+	defer us.mutex.Unlock()
+	for i, f := range us.failedFiles {
+		if f.LocalFilePath == localFilePath {
+			us.failedFiles = append(us.failedFiles[:i], us.failedFiles[i+1:]...)
+			return
+		}
+	}
+}
+
+// FailedFiles 上传失败的文件列表
+func (us *UploadStatistic) FailedFiles() []*FailedFile {
+	us.mutex.Lock()
+	defer us.mutex.Unlock()
+	return us.failedFiles
+}
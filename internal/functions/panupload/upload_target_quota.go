@@ -0,0 +1,194 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panupload
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/library-go/converter"
+	"github.com/tickstep/library-go/logger"
+)
+
+const (
+	// TargetQuotaCacheFileName 目标目录已用容量缓存文件名
+	TargetQuotaCacheFileName = "upload_target_quota_cache.json"
+
+	// TargetQuotaCacheTTL 目标目录已用容量缓存有效期，过期后重新统计
+	TargetQuotaCacheTTL = 24 * time.Hour
+)
+
+type (
+	// TargetQuota 目标目录的容量软配额。上传前统计目标目录已用大小，超出配额的文件拒绝上传。
+	// 统计整个目录比较耗时，统计结果缓存在账号数据目录中，上传结束后累加本次上传的数据量
+	TargetQuota struct {
+		DriveId    string
+		TargetPath string
+		Limit      int64 // 配额
+		UsedSize   int64 // 目标目录已用大小
+		Cached     bool  // 已用大小是否来自缓存
+
+		cacheFile string
+		// fetchedAt 已用大小实际统计的时间，Unix时间戳。累加上传数据量不更新该时间，缓存按统计时间过期
+		fetchedAt int64
+		// reservedSize 扫描阶段已经预占的容量
+		reservedSize int64
+		mutex        sync.Mutex
+	}
+
+	// targetQuotaCacheItem 目标目录已用容量缓存
+	targetQuotaCacheItem struct {
+		UsedSize  int64 `json:"usedSize"`
+		UpdatedAt int64 `json:"updatedAt"` // 实际统计已用大小的时间
+	}
+)
+
+// NewTargetQuota 创建目标目录配额，limit为0返回nil。refresh为true时忽略缓存重新统计
+func NewTargetQuota(panClient *config.PanClient, driveId, targetPath string, limit int64, dataDir string, refresh bool) (*TargetQuota, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+	q := &TargetQuota{
+		DriveId:    driveId,
+		TargetPath: targetPath,
+		Limit:      limit,
+		cacheFile:  filepath.Join(dataDir, TargetQuotaCacheFileName),
+	}
+	if !refresh {
+		if item := q.loadCache()[q.cacheKey()]; item != nil && time.Since(time.Unix(item.UpdatedAt, 0)) < TargetQuotaCacheTTL {
+			q.UsedSize = item.UsedSize
+			q.Cached = true
+			q.fetchedAt = item.UpdatedAt
+			return q, nil
+		}
+	}
+	used, err := PanDirUsedSize(panClient, driveId, targetPath)
+	if err != nil {
+		return nil, err
+	}
+	q.UsedSize = used
+	q.fetchedAt = time.Now().Unix()
+	q.saveCache(used)
+	return q, nil
+}
+
+// PanDirUsedSize 统计网盘目录下所有文件的大小，目录不存在时返回0
+func PanDirUsedSize(panClient *config.PanClient, driveId, dirPath string) (int64, error) {
+	var (
+		size   int64
+		apiErr *apierror.ApiError
+	)
+	panClient.OpenapiPanClient().FilesDirectoriesRecurseList(driveId, dirPath, func(depth int, _ string, fd *aliyunpan.FileEntity, err *apierror.ApiError) bool {
+		if err != nil {
+			apiErr = err
+			return false
+		}
+		if !fd.IsFolder() {
+			size += fd.FileSize
+		}
+		return true
+	})
+	if apiErr != nil {
+		if apiErr.Code == apierror.ApiCodeFileNotFoundCode {
+			return 0, nil
+		}
+		return 0, apiErr
+	}
+	return size, nil
+}
+
+// Reserve 为待上传文件预占配额，超出配额时返回 false 以及原因
+func (q *TargetQuota) Reserve(fileSize int64) (ok bool, reason string) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.UsedSize+q.reservedSize+fileSize > q.Limit {
+		return false, "超出目标目录配额 " + converter.ConvertFileSize(q.Limit, 2)
+	}
+	q.reservedSize += fileSize
+	return true, ""
+}
+
+// Release 释放预占的配额，文件上传失败或者取消时调用
+func (q *TargetQuota) Release(fileSize int64) {
+	if q == nil {
+		return
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.reservedSize -= fileSize
+	if q.reservedSize < 0 {
+		q.reservedSize = 0
+	}
+}
+
+// Exceeded 目标目录已用大小是否已经达到配额
+func (q *TargetQuota) Exceeded() bool {
+	return q.UsedSize >= q.Limit
+}
+
+func (q *TargetQuota) String() string {
+	return fmt.Sprintf("目标目录: %s, 配额: %s, 已使用: %s", q.TargetPath,
+		converter.ConvertFileSize(q.Limit, 2), converter.ConvertFileSize(q.UsedSize, 2))
+}
+
+// AddUploaded 上传结束后把本次上传成功的数据量累加到缓存的已用大小中
+func (q *TargetQuota) AddUploaded(size int64) {
+	if size <= 0 {
+		return
+	}
+	q.mutex.Lock()
+	q.UsedSize += size
+	used := q.UsedSize
+	q.mutex.Unlock()
+	q.saveCache(used)
+}
+
+func (q *TargetQuota) cacheKey() string {
+	return q.DriveId + ":" + q.TargetPath
+}
+
+func (q *TargetQuota) loadCache() map[string]*targetQuotaCacheItem {
+	cache := map[string]*targetQuotaCacheItem{}
+	data, err := os.ReadFile(q.cacheFile)
+	if err != nil {
+		return cache
+	}
+	if err = json.Unmarshal(data, &cache); err != nil {
+		logger.Verboseln("parse target quota cache error: ", err)
+		return map[string]*targetQuotaCacheItem{}
+	}
+	return cache
+}
+
+func (q *TargetQuota) saveCache(used int64) {
+	cache := q.loadCache()
+	cache[q.cacheKey()] = &targetQuotaCacheItem{
+		UsedSize:  used,
+		UpdatedAt: q.fetchedAt,
+	}
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return
+	}
+	if err = os.WriteFile(q.cacheFile, data, 0644); err != nil {
+		logger.Verboseln("save target quota cache error: ", err)
+	}
+}
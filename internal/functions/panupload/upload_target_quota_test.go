@@ -0,0 +1,34 @@
+package panupload
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTargetQuotaCacheKeepsFetchTime(t *testing.T) {
+	dir := t.TempDir()
+	fetchedAt := time.Now().Add(-time.Hour).Unix()
+	q := &TargetQuota{DriveId: "d1", TargetPath: "/备份", Limit: 1000}
+	q.cacheFile = dir + "/" + TargetQuotaCacheFileName
+	q.fetchedAt = fetchedAt
+	q.saveCache(100)
+
+	// 缓存有效期内使用缓存，不需要访问网盘
+	cached, err := NewTargetQuota(nil, "d1", "/备份", 1000, dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cached.Cached || cached.UsedSize != 100 {
+		t.Fatalf("expect cached used size: %+v", cached)
+	}
+	if ok, _ := cached.Reserve(950); ok {
+		t.Fatal("reserve over limit should fail")
+	}
+
+	// 累加上传的数据量不延长缓存有效期
+	cached.AddUploaded(50)
+	item := cached.loadCache()[cached.cacheKey()]
+	if item.UsedSize != 150 || item.UpdatedAt != fetchedAt {
+		t.Fatalf("cache should keep fetch time: %+v", item)
+	}
+}
@@ -14,9 +14,11 @@
 package panupload
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/tickstep/aliyunpan/internal/log"
+	"github.com/tickstep/aliyunpan/internal/metrics"
 	"github.com/tickstep/aliyunpan/internal/plugins"
 	"github.com/tickstep/library-go/logger"
 	"os"
@@ -32,6 +34,7 @@ import (
 	"github.com/tickstep/aliyunpan-api/aliyunpan"
 	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
 	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/file/ratelimit"
 	"github.com/tickstep/aliyunpan/internal/file/uploader"
 	"github.com/tickstep/aliyunpan/internal/functions"
 	"github.com/tickstep/aliyunpan/internal/localfile"
@@ -43,6 +46,12 @@ import (
 const (
 	// DefaultCheckPreHashFileSize PreHash计算文件大小门限，默认100MB以上文件才计算
 	DefaultCheckPreHashFileSize = 100 * 1024 * 1024
+
+	// DefaultSHA1CheckpointFileSize 保存SHA1计算进度的文件大小门限，大文件中断后可以从上次的进度继续计算SHA1
+	DefaultSHA1CheckpointFileSize = 2 * 1024 * 1024 * 1024
+
+	// BadBlockFailThreshold 同一个分片失败次数达到该值后标记为问题分片，不再重试该文件。失败次数保存在断点信息中，任务重试时累加
+	BadBlockFailThreshold = 10
 )
 
 type (
@@ -56,21 +65,58 @@ type (
 		SavePath          string // 保存路径
 		DriveId           string // 网盘ID，例如：文件网盘，相册网盘
 		FolderCreateMutex *sync.Mutex
+		FolderIdCache     *config.FolderIdCache // 云盘文件夹ID缓存，可以为nil
+		ApiPacer          *ApiPacer             // 上传准备阶段网盘API请求节流器，所有任务共享，可以为nil
 
 		PanClient         *config.PanClient
+		User              *config.PanUser    // 上传使用的账号，插件回调使用该账号的上下文，为nil则使用当前登录账号
 		UploadingDatabase *UploadingDatabase // 数据库
 		Parallel          int
-		NoRapidUpload     bool  // 禁用秒传，无需计算SHA1，直接上传
+		NoRapidUpload     bool  // 禁用秒传，直接上传
+		NoChecksum        bool  // 不计算SHA1，禁用秒传时也不进行上传后校验
 		BlockSize         int64 // 分片大小
 
 		UploadStatistic *UploadStatistic
+		UploadQuota     *UploadQuota         // 账号上传容量限制，可以为nil
+		TargetQuota     *TargetQuota         // 目标目录配额，可以为nil
+		ReservedSize    int64                // 加入队列时预占的容量和配额大小，上传失败或者取消时释放
+		UploadTiming    *UploadTiming        // 各阶段耗时统计，可以为nil
+		RuntimeExcluder *RuntimeExcluder     // 运行时排除规则，可以为nil
+		Profile         *UploadProfile       // 上传参数profile，用于控制该类文件的上传并发数，可以为nil
+		AlbumDedup      *AlbumDedupIndex     // 相册盘照片去重索引，可以为nil
+		DedupeIndex     *UploadDedupeIndex   // 上传去重索引，可以为nil
+		BatchManifest   *UploadBatchManifest // 目录上传批次清单，可以为nil
+		Callback        *UploadCallback      // 文件上传结果回调，可以为nil
+		HashPool        *localfile.HashPool  // SHA1预计算协程池，可以为nil
+		TimeBudget      *UploadTimeBudget    // 上传批次时间预算，可以为nil
+		Encryptor       *UploadEncryptor     // 客户端加密，可以为nil
+		AutoTune        *UploadAutoTuner     // 自动参数调优，可以为nil
+		VideoWarmup     *VideoWarmup         // 视频转码预热，可以为nil
+		// Reporter 上传状态上报，为nil时输出到命令行
+		Reporter UploadReporter
+		// Control 外部控制，暂停时中止进行中的上传并保存断点，恢复后从断点继续，可以为nil
+		Control *taskframework.TaskControl
+		// SharedRateLimit 本次上传所有文件共享的限速，可以为nil
+		SharedRateLimit *ratelimit.SharedRateLimit
 
 		taskInfo *taskframework.TaskInfo
 		panDir   string
 		panFile  string
 		state    *uploader.InstanceState
+		rejected bool // 文件被网盘拒绝上传
+
+		encryptedFile  string // 加密后的本地临时文件
+		originSavePath string // 加密前的网盘保存路径
+
+		lastRetryErr error // 最近一次需要重试的错误，用于选择重试退避策略
+
+		startTime     time.Time // 第一次开始上传的时间
+		rapidUploaded bool      // 是否秒传成功
+		skipped       bool      // 网盘已存在相同的文件，跳过上传
+		transferBytes int64     // 实际上传的字节数
 
 		ShowProgress   bool
+		ReportSkipped  bool // 文件结果中区分跳过上传的文件，用于按目录树状汇总。为false时跳过的文件记为成功
 		IsOverwrite    bool // 覆盖已存在的文件，如果同名文件已存在则移到回收站里
 		IsSkipSameName bool // 跳过已存在的文件，即使文件内容不一致(不检查SHA1)
 
@@ -79,6 +125,8 @@ type (
 
 		// 上传文件记录器
 		FileRecorder *log.FileRecorder
+		// Plugin 插件，所有上传任务共用，为nil时每次回调重新加载插件
+		Plugin plugins.Plugin
 	}
 )
 
@@ -97,10 +145,68 @@ const (
 	StrUploadFailed = "上传文件失败"
 )
 
+type (
+	// uploadFileCreator 创建上传任务需要用到的网盘接口
+	uploadFileCreator interface {
+		CreateUploadFile(param *aliyunpan.CreateFileUploadParam) (*aliyunpan.CreateFileUploadResult, *apierror.ApiError)
+		MkdirByFullPath(driveId, fullPath string) (*aliyunpan.MkdirResult, *apierror.ApiError)
+	}
+)
+
 func (utu *UploadTaskUnit) SetTaskInfo(taskInfo *taskframework.TaskInfo) {
 	utu.taskInfo = taskInfo
 }
 
+// report 上报事件，补充任务ID、时间和文件路径
+func (utu *UploadTaskUnit) report(event *UploadEvent) {
+	if utu.Reporter == nil {
+		utu.Reporter = NewCliUploadReporter(os.Stdout, utu.ShowProgress)
+	}
+	event.TaskId = utu.taskInfo.Id()
+	event.Time = time.Now()
+	if utu.LocalFileChecksum != nil {
+		event.LocalPath = utu.LocalFileChecksum.Path.LogicPath
+	}
+	event.PanPath = utu.SavePath
+	utu.Reporter.Report(event)
+}
+
+// reportf 上报提示信息
+func (utu *UploadTaskUnit) reportf(eventType UploadEventType, format string, a ...interface{}) {
+	utu.report(&UploadEvent{Type: eventType, Message: fmt.Sprintf(format, a...)})
+}
+
+// createUploadFile 创建上传任务。任务排队期间云盘文件夹被删除时，重新创建文件夹后再重试一次，
+// 重新创建文件夹失败时 ok 返回false
+func (utu *UploadTaskUnit) createUploadFile(client uploadFileCreator, param *aliyunpan.CreateFileUploadParam, saveFilePath string) (uploadOpEntity *aliyunpan.CreateFileUploadResult, apierr *apierror.ApiError, ok bool) {
+	parentFolderRecreated := false
+	for {
+		stageStart := time.Now()
+		utu.ApiPacer.Wait()
+		uploadOpEntity, apierr = client.CreateUploadFile(param)
+		utu.ApiPacer.Done(apierr)
+		utu.UploadTiming.Since(TimingStageCreate, stageStart)
+		if apierr == nil || parentFolderRecreated || saveFilePath == "/" ||
+			(apierr.Code != apierror.ApiCodeFileNotFoundCode && apierr.Code != apierror.ApiCodeForbiddenFileInTheRecycleBin) {
+			return uploadOpEntity, apierr, true
+		}
+
+		parentFolderRecreated = true
+		utu.reportf(UploadEventInfo, "云盘文件夹已失效，重新创建文件夹: %s", saveFilePath)
+		utu.FolderIdCache.Invalidate(utu.DriveId, saveFilePath)
+		utu.FolderCreateMutex.Lock()
+		utu.ApiPacer.Wait()
+		rs, er := client.MkdirByFullPath(utu.DriveId, saveFilePath)
+		utu.ApiPacer.Done(er)
+		utu.FolderCreateMutex.Unlock()
+		if er != nil || rs == nil || rs.FileId == "" {
+			return nil, er, false
+		}
+		utu.FolderIdCache.Put(utu.DriveId, saveFilePath, rs.FileId)
+		param.ParentFileId = rs.FileId
+	}
+}
+
 // prepareFile 解析文件准备阶段
 func (utu *UploadTaskUnit) prepareFile() {
 	// 解析文件保存路径
@@ -142,13 +248,14 @@ func (utu *UploadTaskUnit) rapidUpload() (isContinue bool, result *taskframework
 
 	// 是否可以秒传
 	result = &taskframework.TaskUnitRunResult{}
-	fmt.Printf("[%s] %s 检测秒传中, 请稍候...\n", utu.taskInfo.Id(), time.Now().Format("2006-01-02 15:04:06"))
+	utu.reportf(UploadEventInfo, "检测秒传中, 请稍候...")
 	if utu.LocalFileChecksum.UploadOpEntity.RapidUpload {
-		fmt.Printf("[%s] %s 秒传成功, 保存到网盘路径: %s\n", utu.taskInfo.Id(), time.Now().Format("2006-01-02 15:04:06"), utu.SavePath)
+		utu.rapidUploaded = true
+		utu.reportf(UploadEventSuccess, "秒传成功, 保存到网盘路径: %s", utu.SavePath)
 		result.Succeed = true
 		return false, result
 	} else {
-		fmt.Printf("[%s] %s 秒传失败，开始正常上传文件\n", utu.taskInfo.Id(), time.Now().Format("2006-01-02 15:04:06"))
+		utu.reportf(UploadEventInfo, "秒传失败，开始正常上传文件")
 		result.Succeed = false
 		result.ResultMessage = "文件未曾上传，无法秒传"
 		return true, result
@@ -159,23 +266,53 @@ func (utu *UploadTaskUnit) rapidUpload() (isContinue bool, result *taskframework
 func (utu *UploadTaskUnit) upload() (result *taskframework.TaskUnitRunResult) {
 	utu.Step = StepUploadUpload
 
+	// 按时间段限速，本次上传的总限速由所有文件共享
+	muerConfig := &uploader.MultiUploaderConfig{
+		Parallel:          utu.Parallel,
+		BlockSize:         utu.BlockSize,
+		MaxRate:           config.Config.MaxUploadRate,
+		SharedRateLimit:   utu.SharedRateLimit,
+		BadBlockThreshold: BadBlockFailThreshold,
+	}
+	if rateSchedule := config.Config.UploadRateLimitSchedule(); rateSchedule != nil {
+		muerConfig.RateFunc = rateSchedule.RateAt
+	}
+
 	// 创建分片上传器
 	// 阿里云盘默认就是分片上传，每一个分片对应一个part_info
 	// 但是不支持分片同时上传，必须单线程，并且按照顺序从1开始一个一个上传
 	muer := uploader.NewMultiUploader(
-		NewPanUpload(utu.PanClient, utu.SavePath, utu.DriveId, utu.LocalFileChecksum.UploadOpEntity),
-		rio.NewFileReaderAtLen64(utu.LocalFileChecksum.GetFile()), &uploader.MultiUploaderConfig{
-			Parallel:  utu.Parallel,
-			BlockSize: utu.BlockSize,
-			MaxRate:   config.Config.MaxUploadRate,
-		}, utu.LocalFileChecksum.UploadOpEntity, utu.PanClient, utu.GlobalSpeedsStat)
+		utu.UploadTiming.WrapMultiUpload(NewPanUpload(utu.PanClient, utu.SavePath, utu.DriveId, utu.LocalFileChecksum.UploadOpEntity)),
+		rio.NewFileReaderAtLen64(utu.LocalFileChecksum.GetFile()), muerConfig,
+		utu.LocalFileChecksum.UploadOpEntity, utu.PanClient, utu.GlobalSpeedsStat)
 
 	// 设置断点续传
 	if utu.state != nil {
 		muer.SetInstanceState(utu.state)
 	}
 
+	// 断点续传已经完成的部分不计入实际上传字节
+	resumedBytes := utu.state.DoneSize()
+	var uploadedBytes int64
+	defer func() {
+		if uploadedBytes > resumedBytes {
+			utu.transferBytes += uploadedBytes - resumedBytes
+		}
+	}()
+
+	// 速度采用滑动窗口平均，避免瞬时速度跳动过大
+	fileSpeedStat := functions.NewSpeedStat(config.Config.UploadSpeedWindow)
 	muer.OnUploadStatusEvent(func(status uploader.Status, updateChan <-chan struct{}) {
+		fileSpeedStat.Add(status.SpeedsPerSecond())
+		uploaded := status.Uploaded()
+		if last := uploadedBytes; uploaded > last {
+			if last < resumedBytes {
+				last = resumedBytes
+			}
+			utu.AutoTune.Add(uploaded - last)
+		}
+		uploadedBytes = uploaded
+
 		select {
 		case <-updateChan:
 			utu.UploadingDatabase.UpdateUploading(&utu.LocalFileChecksum.LocalFileMeta, muer.InstanceState())
@@ -183,35 +320,34 @@ func (utu *UploadTaskUnit) upload() (result *taskframework.TaskUnitRunResult) {
 		default:
 		}
 
-		if utu.ShowProgress {
-			// 如果上传速度为0, 剩余时间未知, 则用 - 代替
-			var leftStr string
-			left := status.TimeLeft()
-			if left < 0 {
-				leftStr = "-"
-			} else {
-				leftStr = left.String()
-			}
-			uploadedPercentage := fmt.Sprintf("%.2f%%", float64(status.Uploaded())/float64(status.TotalSize())*100)
-			fmt.Printf("\r[%s] ↑ %s/%s(%s) %s/s(%s/s) in %s, left %s ............", utu.taskInfo.Id(),
-				converter.ConvertFileSize(status.Uploaded(), 2),
-				converter.ConvertFileSize(status.TotalSize(), 2),
-				uploadedPercentage,
-				converter.ConvertFileSize(status.SpeedsPerSecond(), 2),
-				converter.ConvertFileSize(utu.GlobalSpeedsStat.GetSpeeds(), 2),
-				status.TimeElapsed(),
-				leftStr,
-			)
+		globalSpeeds := utu.GlobalSpeedsStat.GetSpeeds()
+		if utu.UploadStatistic.SpeedStat != nil {
+			globalSpeeds = utu.UploadStatistic.SpeedStat.WindowAverage()
+		}
+		left := int64(-1)
+		if status.TimeLeft() >= 0 {
+			left = int64(status.TimeLeft().Seconds())
 		}
+		utu.report(&UploadEvent{
+			Type: UploadEventProgress,
+			Progress: &UploadProgress{
+				Uploaded:    status.Uploaded(),
+				TotalSize:   status.TotalSize(),
+				Speed:       fileSpeedStat.WindowAverage(),
+				GlobalSpeed: globalSpeeds,
+				Elapsed:     int64(status.TimeElapsed().Seconds()),
+				Left:        left,
+			},
+		})
 	})
 
 	// result
 	result = &taskframework.TaskUnitRunResult{}
 	muer.OnSuccess(func() {
-		fmt.Printf("\n")
-		fmt.Printf("[%s] %s 上传文件成功, 保存到网盘路径: %s\n", utu.taskInfo.Id(), time.Now().Format("2006-01-02 15:04:06"), utu.SavePath)
+		utu.reportf(UploadEventSuccess, "上传文件成功, 保存到网盘路径: %s", utu.SavePath)
 		// 统计
 		utu.UploadStatistic.AddTotalSize(utu.LocalFileChecksum.Length)
+		uploadedBytes = utu.LocalFileChecksum.Length
 		utu.UploadingDatabase.Delete(&utu.LocalFileChecksum.LocalFileMeta) // 删除
 		utu.UploadingDatabase.Save()
 		result.Succeed = true
@@ -237,13 +373,75 @@ func (utu *UploadTaskUnit) upload() (result *taskframework.TaskUnitRunResult) {
 		}
 		return
 	})
+	// 到达时间预算、暂停或者停止时中止进行中的上传
+	var budgetDone <-chan struct{}
+	if utu.TimeBudget.AbortInFlight() {
+		budgetDone = utu.TimeBudget.Done()
+	}
+	if budgetDone != nil || utu.Control != nil {
+		uploadFinished := make(chan struct{})
+		defer close(uploadFinished)
+		muer.OnExecute(func() {
+			for {
+				changed := utu.Control.Changed()
+				if utu.Control.IsPaused() || utu.Control.IsStopped() {
+					muer.Cancel()
+					return
+				}
+				select {
+				case <-budgetDone:
+					muer.Cancel()
+					return
+				case <-changed:
+				case <-uploadFinished:
+					return
+				}
+			}
+		})
+	}
 	er := muer.Execute()
+	if er == context.Canceled && (utu.Control.IsPaused() || utu.Control.IsStopped()) {
+		// 保存已上传的分片作为断点，恢复后从断点继续
+		utu.state = muer.InstanceState()
+		utu.UploadingDatabase.UpdateUploading(&utu.LocalFileChecksum.LocalFileMeta, utu.state)
+		utu.UploadingDatabase.Save()
+		if utu.Control.IsStopped() {
+			utu.reportf(UploadEventCancel, "上传已中止, 已保存断点: %s", utu.LocalFileChecksum.Path.LogicPath)
+			return &taskframework.TaskUnitRunResult{Cancel: true}
+		}
+		utu.reportf(UploadEventPause, "上传已暂停, 已保存断点: %s", utu.LocalFileChecksum.Path.LogicPath)
+		if !utu.Control.WaitResume() {
+			return &taskframework.TaskUnitRunResult{Cancel: true}
+		}
+		utu.reportf(UploadEventResume, "恢复上传: %s", utu.LocalFileChecksum.Path.LogicPath)
+		return utu.upload()
+	}
+	if er == context.Canceled && utu.TimeBudget.Exceeded() {
+		// 保存已上传的分片作为断点，下次上传同一个文件可以继续
+		utu.reportf(UploadEventCancel, "已到达时间预算, 中止上传并保存断点: %s", utu.LocalFileChecksum.Path.LogicPath)
+		utu.UploadingDatabase.UpdateUploading(&utu.LocalFileChecksum.LocalFileMeta, muer.InstanceState())
+		utu.UploadingDatabase.Save()
+		utu.TimeBudget.AddUnfinished(utu.LocalFileChecksum.Path.LogicPath)
+		return &taskframework.TaskUnitRunResult{Cancel: true}
+	}
 	if er != nil {
 		result.ResultMessage = StrUploadFailed
 		result.NeedRetry = true
 		if errors.Is(er, uploader.UploadNoSuchUpload) {
 			// do not need retry
 			result.NeedRetry = false
+		} else {
+			// 保存分片失败次数，任务重试时继续累加
+			utu.state = muer.InstanceState()
+			utu.UploadingDatabase.UpdateUploading(&utu.LocalFileChecksum.LocalFileMeta, utu.state)
+			utu.UploadingDatabase.Save()
+		}
+		var bbe *uploader.BadBlockError
+		if errors.As(er, &bbe) {
+			// 同一个分片反复失败，继续重试没有意义
+			result.ResultMessage = fmt.Sprintf("%s, 问题分片偏移: %d-%d, 请检查本地文件所在磁盘", StrUploadFailed, bbe.Range.Begin, bbe.Range.End)
+			result.NeedRetry = false
+			utu.reportf(UploadEventError, "分片%d(偏移 %d-%d)已失败%d次, 标记为问题分片: %s", bbe.ID+1, bbe.Range.Begin, bbe.Range.End, bbe.FailCount, utu.LocalFileChecksum.Path.LogicPath)
 		}
 		result.Err = er
 	}
@@ -251,18 +449,59 @@ func (utu *UploadTaskUnit) upload() (result *taskframework.TaskUnitRunResult) {
 }
 
 func (utu *UploadTaskUnit) OnRetry(lastRunResult *taskframework.TaskUnitRunResult) {
-	// 输出错误信息
-	if lastRunResult.Err == nil {
-		// result中不包含Err, 忽略输出
-		fmt.Printf("[%s] %s, 重试 %d/%d\n", utu.taskInfo.Id(), lastRunResult.ResultMessage, utu.taskInfo.Retry(), utu.taskInfo.MaxRetry())
-		return
+	utu.lastRetryErr = lastRunResult.Err
+	metrics.CountRetry("upload")
+	// 输出错误信息，result中不包含Err时只输出结果信息
+	event := &UploadEvent{
+		Type:     UploadEventRetry,
+		Message:  lastRunResult.ResultMessage,
+		Retry:    utu.taskInfo.Retry(),
+		MaxRetry: utu.taskInfo.MaxRetry(),
 	}
-	fmt.Printf("[%s] %s, %s, 重试 %d/%d\n", utu.taskInfo.Id(), lastRunResult.ResultMessage, lastRunResult.Err, utu.taskInfo.Retry(), utu.taskInfo.MaxRetry())
+	if lastRunResult.Err != nil {
+		event.Error = lastRunResult.Err.Error()
+	}
+	utu.report(event)
 }
 
 func (utu *UploadTaskUnit) OnSuccess(lastRunResult *taskframework.TaskUnitRunResult) {
+	utu.UploadStatistic.AddSucceedFile()
+	status := functions.FileResultSucceed
+	if utu.skipped && utu.ReportSkipped {
+		status = functions.FileResultSkipped
+	}
+	utu.UploadStatistic.AddFileResult(&functions.FileResult{
+		Path:   utu.LocalFileChecksum.Path.LogicPath,
+		Target: utu.SavePath,
+		Size:   utu.LocalFileChecksum.Length,
+		Status: status,
+	})
+	if utu.encryptedFile == "" {
+		// 加密的文件内容无法转码
+		utu.VideoWarmup.Add(utu.DriveId, utu.resultFileId(lastRunResult), utu.SavePath)
+	}
+	if utu.encryptedFile != "" {
+		utu.Encryptor.Add(&EncryptItem{
+			LocalPath: utu.LocalFileChecksum.Path.LogicPath,
+			SavePath:  utu.originSavePath,
+			EncPath:   utu.SavePath,
+		})
+		utu.removeEncryptedFile()
+	}
+	// 秒传成功等情况没有经过上传流程，移除保存的SHA1计算进度
+	if utu.UploadingDatabase.Delete(&utu.LocalFileChecksum.LocalFileMeta) {
+		utu.UploadingDatabase.Save()
+	}
+	utu.AlbumDedup.Add(utu.LocalFileChecksum.SHA1, utu.SavePath)
+	if utu.encryptedFile == "" {
+		// 加密上传的文件每次加密结果不同，不记录
+		utu.addDedupeRecord(lastRunResult)
+	}
+	utu.BatchManifest.SetStatus(utu.LocalFileChecksum.Path.LogicPath, utu.scanSavePath(), UploadBatchDone)
+
 	// 执行插件
 	utu.pluginCallback("success")
+	utu.urlCallback("success", lastRunResult)
 
 	// 上传文件数据记录
 	if config.Config.FileRecordConfig == "1" {
@@ -271,21 +510,156 @@ func (utu *UploadTaskUnit) OnSuccess(lastRunResult *taskframework.TaskUnitRunRes
 			TimeStr:  utils.NowTimeStr(),
 			FileSize: utu.LocalFileChecksum.LocalFileMeta.Length,
 			FilePath: utu.LocalFileChecksum.Path.LogicPath,
+			Transfer: utu.recordTransfer(lastRunResult),
 		})
 	}
 }
 
 func (utu *UploadTaskUnit) OnFailed(lastRunResult *taskframework.TaskUnitRunResult) {
+	defer utu.releaseQuota()
 	// 失败
+	if utu.LocalFileChecksum != nil {
+		reason := lastRunResult.ResultMessage
+		if lastRunResult.Err != nil {
+			reason += ": " + lastRunResult.Err.Error()
+		}
+		utu.UploadStatistic.AddFailedFile(utu.LocalFileChecksum.Path.LogicPath, utu.LocalFileChecksum.Length, reason)
+	}
+	utu.rejected = IsUploadRejected(lastRunResult.Err)
+	utu.removeEncryptedFile()
+	if utu.LocalFileChecksum != nil {
+		utu.BatchManifest.SetStatus(utu.LocalFileChecksum.Path.LogicPath, utu.scanSavePath(), UploadBatchFailed)
+	}
+
 	utu.pluginCallback("fail")
+	utu.urlCallback("fail", lastRunResult)
+
+	// 上传文件数据记录
+	if config.Config.FileRecordConfig == "1" && utu.LocalFileChecksum != nil {
+		utu.FileRecorder.Append(&log.FileRecordItem{
+			Status:   "失败",
+			TimeStr:  utils.NowTimeStr(),
+			FileSize: utu.LocalFileChecksum.LocalFileMeta.Length,
+			FilePath: utu.LocalFileChecksum.Path.LogicPath,
+			Transfer: utu.recordTransfer(lastRunResult),
+		})
+	}
+}
+
+// IsRejected 文件是否被网盘拒绝上传，例如文件名或者内容被拦截
+func (utu *UploadTaskUnit) IsRejected() bool {
+	return utu.rejected
+}
+
+// urlCallback 回调上传结果到配置的URL
+func (utu *UploadTaskUnit) urlCallback(result string, lastRunResult *taskframework.TaskUnitRunResult) {
+	if utu.Callback == nil || utu.LocalFileChecksum == nil {
+		return
+	}
+	payload := &UploadCallbackPayload{
+		LocalPath: utu.LocalFileChecksum.Path.LogicPath,
+		PanPath:   utu.SavePath,
+		DriveId:   utu.DriveId,
+		Sha1:      utu.LocalFileChecksum.SHA1,
+		Size:      utu.LocalFileChecksum.Length,
+		Result:    result,
+	}
+	payload.FileId = utu.resultFileId(lastRunResult)
+	if lastRunResult != nil {
+		payload.Message = lastRunResult.ResultMessage
+		if lastRunResult.Err != nil {
+			payload.Message += ": " + lastRunResult.Err.Error()
+		}
+		// 跳过上传的同名文件，使用网盘已存在文件的信息
+		if efi, ok := lastRunResult.Extra.(*aliyunpan.FileEntity); ok && efi != nil && payload.Sha1 == "" {
+			payload.Sha1 = efi.ContentHash
+		}
+	}
+	utu.Callback.Notify(payload)
+}
+
+// resultFileId 上传结果对应的网盘文件ID，跳过上传的同名文件使用网盘已存在文件的ID
+func (utu *UploadTaskUnit) resultFileId(lastRunResult *taskframework.TaskUnitRunResult) string {
+	if lastRunResult != nil {
+		if efi, ok := lastRunResult.Extra.(*aliyunpan.FileEntity); ok && efi != nil {
+			return efi.FileId
+		}
+	}
+	if utu.LocalFileChecksum.UploadOpEntity != nil {
+		return utu.LocalFileChecksum.UploadOpEntity.FileId
+	}
+	return ""
+}
+
+// scanSavePath 扫描时确定的网盘保存路径，加密文件名之前的路径
+func (utu *UploadTaskUnit) scanSavePath() string {
+	if utu.originSavePath != "" {
+		return utu.originSavePath
+	}
+	return utu.SavePath
+}
+
+// addDedupeRecord 记录上传成功的文件到上传去重索引
+func (utu *UploadTaskUnit) addDedupeRecord(lastRunResult *taskframework.TaskUnitRunResult) {
+	if utu.DedupeIndex == nil {
+		return
+	}
+	localPath := utu.LocalFileChecksum.Path.LogicPath
+	if absPath, err := filepath.Abs(localPath); err == nil {
+		localPath = absPath
+	}
+	rec := &UploadDedupeRecord{
+		LocalPath: localPath,
+		Size:      utu.LocalFileChecksum.Length,
+		Sha1:      utu.LocalFileChecksum.SHA1,
+		DriveId:   utu.DriveId,
+		PanPath:   utu.SavePath,
+		FileId:    utu.resultFileId(lastRunResult),
+	}
+	if lastRunResult != nil {
+		if efi, ok := lastRunResult.Extra.(*aliyunpan.FileEntity); ok && efi != nil {
+			rec.ParentFileId = efi.ParentFileId
+			if rec.Sha1 == "" {
+				rec.Sha1 = efi.ContentHash
+			}
+		}
+	}
+	if rec.ParentFileId == "" && utu.LocalFileChecksum.UploadOpEntity != nil {
+		rec.ParentFileId = utu.LocalFileChecksum.UploadOpEntity.ParentFileId
+	}
+	utu.DedupeIndex.Put(rec)
+}
+
+// recordTransfer 文件记录中的传输详情
+func (utu *UploadTaskUnit) recordTransfer(lastRunResult *taskframework.TaskUnitRunResult) *log.FileRecordTransfer {
+	t := &log.FileRecordTransfer{
+		RapidUpload:   utu.rapidUploaded,
+		TransferBytes: utu.transferBytes,
+		FileId:        utu.resultFileId(lastRunResult),
+	}
+	if utu.taskInfo != nil {
+		t.Retry = utu.taskInfo.Retry()
+	}
+	if !utu.startTime.IsZero() {
+		t.Elapsed = time.Since(utu.startTime)
+	}
+	return t
+}
+
+// plugin 获取插件，没有设置共用的插件时重新加载
+func (utu *UploadTaskUnit) plugin() plugins.Plugin {
+	if utu.Plugin != nil {
+		return utu.Plugin
+	}
+	plugin, _ := plugins.NewPluginManager(config.GetPluginDir()).GetPlugin()
+	return plugin
 }
 
 func (utu *UploadTaskUnit) pluginCallback(result string) {
 	if utu.LocalFileChecksum == nil {
 		return
 	}
-	pluginManger := plugins.NewPluginManager(config.GetPluginDir())
-	plugin, _ := pluginManger.GetPlugin()
+	plugin := utu.plugin()
 	_, fileName := filepath.Split(utu.LocalFileChecksum.Path.LogicPath)
 	pluginParam := &plugins.UploadFileFinishParams{
 		LocalFilePath:      utu.LocalFileChecksum.Path.LogicPath,
@@ -298,7 +672,11 @@ func (utu *UploadTaskUnit) pluginCallback(result string) {
 		DriveId:            utu.DriveId,
 		DriveFilePath:      utu.panDir + "/" + utu.panFile,
 	}
-	if er := plugin.UploadFileFinishCallback(plugins.GetContext(config.Config.ActiveUser()), pluginParam); er != nil {
+	user := utu.User
+	if user == nil {
+		user = config.Config.ActiveUser()
+	}
+	if er := plugin.UploadFileFinishCallback(plugins.GetContext(user), pluginParam); er != nil {
 		logger.Verboseln("插件UploadFileFinishCallback调用失败： {}", er)
 	} else {
 		logger.Verboseln("插件UploadFileFinishCallback调用成功")
@@ -307,37 +685,127 @@ func (utu *UploadTaskUnit) pluginCallback(result string) {
 
 func (utu *UploadTaskUnit) OnComplete(lastRunResult *taskframework.TaskUnitRunResult) {
 	// 任务结束，可能成功也可能失败
+	if lastRunResult == nil {
+		// 文件不可读等情况直接结束，没有调用 OnFailed
+		utu.releaseQuota()
+	}
 }
+
+// releaseQuota 文件没有上传成功，释放加入队列时预占的容量和配额，只释放一次
+func (utu *UploadTaskUnit) releaseQuota() {
+	if utu.ReservedSize <= 0 {
+		return
+	}
+	utu.UploadQuota.Release(utu.ReservedSize)
+	utu.TargetQuota.Release(utu.ReservedSize)
+	utu.ReservedSize = 0
+}
+
 func (utu *UploadTaskUnit) OnCancel(lastRunResult *taskframework.TaskUnitRunResult) {
+	defer utu.releaseQuota()
+	if utu.state == nil {
+		// 已经开始上传的文件保留加密后的临时文件，重新上传时使用同一个密文断点续传
+		utu.removeEncryptedFile()
+	}
+	if utu.Control.IsStopped() {
+		// 任务被停止，正在上传的文件已经保存断点
+		utu.pluginCallback("cancelled")
+	}
+}
+
+// encryptLocalFile 加密本地文件，上传的文件替换为加密后的临时文件，保存路径替换为加密后的文件名
+func (utu *UploadTaskUnit) encryptLocalFile() error {
+	tempFile, err := utu.Encryptor.EncryptFile(utu.LocalFileChecksum.Path.RealPath)
+	if err != nil {
+		return err
+	}
+	utu.encryptedFile = tempFile
+	utu.originSavePath = utu.SavePath
+	utu.LocalFileChecksum = localfile.NewLocalSymlinkFileEntity(localfile.SymlinkFile{
+		LogicPath: utu.LocalFileChecksum.Path.LogicPath,
+		RealPath:  tempFile,
+	})
+	utu.SavePath = utu.Encryptor.EncryptedSavePath(utu.SavePath)
+	return nil
+}
 
+// removeEncryptedFile 删除加密后的临时文件
+func (utu *UploadTaskUnit) removeEncryptedFile() {
+	if utu.encryptedFile == "" {
+		return
+	}
+	if err := os.Remove(utu.encryptedFile); err != nil {
+		logger.Verboseln("remove encrypted temp file error: ", err)
+	}
+	utu.encryptedFile = ""
 }
+
 func (utu *UploadTaskUnit) RetryWait() time.Duration {
-	return functions.RetryWait(utu.taskInfo.Retry())
+	return functions.RetryWaitWithPolicy(utu.taskInfo.Retry(), utu.lastRetryErr, config.Config.RetryBackoffPolicy())
 }
 
 func (utu *UploadTaskUnit) Run() (result *taskframework.TaskUnitRunResult) {
+	if utu.taskInfo.Retry() == 0 && utu.RuntimeExcluder.IsExcluded(utu.LocalFileChecksum.Path.LogicPath) {
+		// 还没开始上传的任务命中了运行时排除规则，直接取消
+		utu.reportf(UploadEventCancel, "命中运行时排除规则, 取消上传: %s", utu.LocalFileChecksum.Path.LogicPath)
+		return &taskframework.TaskUnitRunResult{Cancel: true}
+	}
+
+	// 按照profile控制该类文件的上传并发数，名额已满时先上传队列中的其他文件
+	if !utu.Profile.TryAcquire() {
+		return &taskframework.TaskUnitRunResult{Deferred: true}
+	}
+	defer utu.Profile.Release()
+
+	if utu.Encryptor != nil && utu.encryptedFile == "" {
+		// 加密到临时文件后上传临时文件，重试时直接使用已经加密的文件
+		if err := utu.encryptLocalFile(); err != nil {
+			utu.reportf(UploadEventError, "文件加密失败, 错误信息: %s, 跳过...", err)
+			return &taskframework.TaskUnitRunResult{ResultMessage: "文件加密失败", Err: err}
+		}
+	}
+
 	err := utu.LocalFileChecksum.OpenPath()
 	if err != nil {
-		fmt.Printf("[%s] 文件不可读, 错误信息: %s, 跳过...\n", utu.taskInfo.Id(), err)
+		utu.reportf(UploadEventError, "文件不可读, 错误信息: %s, 跳过...", err)
 		return
 	}
 	defer utu.LocalFileChecksum.Close() // 关闭文件
 
+	// 自动调优控制文件并发数，新文件使用当前尝试的分片大小
+	utu.AutoTune.Acquire()
+	defer utu.AutoTune.Release()
+	if utu.taskInfo.Retry() == 0 {
+		utu.BlockSize = utu.AutoTune.BlockSize(utu.BlockSize)
+	}
+
+	if utu.TimeBudget.Exceeded() {
+		// 已经到达时间预算，不再开始新的上传。保存的断点不受影响，下次上传可以继续
+		utu.reportf(UploadEventCancel, "已到达时间预算, 不再上传: %s", utu.LocalFileChecksum.Path.LogicPath)
+		utu.TimeBudget.AddUnfinished(utu.LocalFileChecksum.Path.LogicPath)
+		return &taskframework.TaskUnitRunResult{Cancel: true}
+	}
+
 	timeStart := time.Now()
+	if utu.startTime.IsZero() {
+		utu.startTime = timeStart
+	}
 	result = &taskframework.TaskUnitRunResult{}
+	utu.UploadTiming.MarkDequeued()
 
-	fmt.Printf("[%s] %s 准备上传: %s => %s\n", utu.taskInfo.Id(), time.Now().Format("2006-01-02 15:04:06"), utu.LocalFileChecksum.Path.LogicPath, utu.SavePath)
+	utu.reportf(UploadEventPrepare, "准备上传: %s => %s", utu.LocalFileChecksum.Path.LogicPath, utu.SavePath)
 
 	defer func() {
-		var msg string
+		event := &UploadEvent{
+			Type:    UploadEventResult,
+			Message: result.ResultMessage,
+			Succeed: result.Succeed,
+			Elapsed: time.Since(timeStart).Seconds(),
+		}
 		if result.Err != nil {
-			msg = "失败！" + result.ResultMessage + "," + result.Err.Error()
-		} else if result.Succeed {
-			msg = "成功！" + result.ResultMessage
-		} else {
-			msg = result.ResultMessage
+			event.Error = result.Err.Error()
 		}
-		fmt.Printf("[%s] %s 文件上传结果： %s 耗时 %s\n", utu.taskInfo.Id(), time.Now().Format("2006-01-02 15:04:06"), msg, utils.ConvertTime(time.Now().Sub(timeStart)))
+		utu.report(event)
 	}()
 
 	// 准备文件
@@ -357,6 +825,8 @@ func (utu *UploadTaskUnit) Run() (result *taskframework.TaskUnitRunResult) {
 	var localFileInfo os.FileInfo
 	var localFile *os.File
 	var newBlockSize int64
+	var stageStart time.Time
+	var createOk bool
 
 	switch utu.Step {
 	case StepUploadPrepareUpload:
@@ -370,40 +840,51 @@ func (utu *UploadTaskUnit) Run() (result *taskframework.TaskUnitRunResult) {
 StepUploadPrepareUpload:
 	// 创建上传任务
 	// 创建云盘文件夹
+	stageStart = time.Now()
 	saveFilePath = path.Dir(utu.SavePath)
 	if saveFilePath != "/" {
 		utu.FolderCreateMutex.Lock()
-		fmt.Printf("[%s] %s 正在检测和创建云盘文件夹: %s\n", utu.taskInfo.Id(), time.Now().Format("2006-01-02 15:04:06"), saveFilePath)
-		fe, apierr1 := utu.PanClient.OpenapiPanClient().FileInfoByPath(utu.DriveId, saveFilePath)
-		time.Sleep(1 * time.Second)
-		needToCreateFolder := false
-		if apierr1 != nil && apierr1.Code == apierror.ApiCodeFileNotFoundCode {
-			needToCreateFolder = true
+		if folderId := utu.FolderIdCache.Get(utu.DriveId, saveFilePath); folderId != "" {
+			// 本次运行已经检测或者创建过该文件夹，直接使用缓存的文件夹ID
+			logger.Verbosef("[%s] %s 使用缓存的云盘文件夹: %s\n", utu.taskInfo.Id(), time.Now().Format("2006-01-02 15:04:06"), saveFilePath)
+			rs = &aliyunpan.MkdirResult{FileId: folderId}
 		} else {
-			if fe == nil {
+			utu.reportf(UploadEventInfo, "正在检测和创建云盘文件夹: %s", saveFilePath)
+			utu.ApiPacer.Wait()
+			fe, apierr1 := utu.PanClient.OpenapiPanClient().FileInfoByPath(utu.DriveId, saveFilePath)
+			utu.ApiPacer.Done(apierr1)
+			needToCreateFolder := false
+			if apierr1 != nil && apierr1.Code == apierror.ApiCodeFileNotFoundCode {
 				needToCreateFolder = true
 			} else {
-				rs = &aliyunpan.MkdirResult{}
-				rs.FileId = fe.FileId
+				if fe == nil {
+					needToCreateFolder = true
+				} else {
+					rs = &aliyunpan.MkdirResult{}
+					rs.FileId = fe.FileId
+				}
 			}
-		}
-		if needToCreateFolder {
-			logger.Verbosef("[%s] %s 创建云盘文件夹: %s\n", utu.taskInfo.Id(), time.Now().Format("2006-01-02 15:04:06"), saveFilePath)
-			rs, apierr = utu.PanClient.OpenapiPanClient().MkdirByFullPath(utu.DriveId, saveFilePath)
-			if apierr != nil || rs.FileId == "" {
-				result.Err = apierr
-				result.ResultMessage = "创建云盘文件夹失败"
-				utu.FolderCreateMutex.Unlock()
-				return
+			if needToCreateFolder {
+				logger.Verbosef("[%s] %s 创建云盘文件夹: %s\n", utu.taskInfo.Id(), time.Now().Format("2006-01-02 15:04:06"), saveFilePath)
+				utu.ApiPacer.Wait()
+				rs, apierr = utu.PanClient.OpenapiPanClient().MkdirByFullPath(utu.DriveId, saveFilePath)
+				utu.ApiPacer.Done(apierr)
+				if apierr != nil || rs.FileId == "" {
+					result.Err = apierr
+					result.ResultMessage = "创建云盘文件夹失败"
+					utu.FolderCreateMutex.Unlock()
+					return
+				}
+				logger.Verbosef("[%s] %s 创建云盘文件夹成功\n", utu.taskInfo.Id(), time.Now().Format("2006-01-02 15:04:06"))
 			}
-			logger.Verbosef("[%s] %s 创建云盘文件夹成功\n", utu.taskInfo.Id(), time.Now().Format("2006-01-02 15:04:06"))
+			utu.FolderIdCache.Put(utu.DriveId, saveFilePath, rs.FileId)
 		}
 		utu.FolderCreateMutex.Unlock()
 	} else {
 		rs = &aliyunpan.MkdirResult{}
 		rs.FileId = ""
 	}
-	time.Sleep(time.Duration(2) * time.Second)
+	utu.UploadTiming.Since(TimingStageMkdir, stageStart)
 
 	sha1Str = ""
 	proofCode = ""
@@ -411,7 +892,9 @@ StepUploadPrepareUpload:
 	checkNameMode = "auto_rename"
 	// 如果启用了 覆盖/跳过 已存在的文件,则需要提前检查文件是否存在
 	if utu.IsOverwrite || utu.IsSkipSameName {
+		utu.ApiPacer.Wait()
 		efi, apierr = utu.PanClient.OpenapiPanClient().FileInfoByPath(utu.DriveId, utu.SavePath)
+		utu.ApiPacer.Done(apierr)
 		if apierr != nil && apierr.Code != apierror.ApiCodeFileNotFoundCode {
 			result.Err = apierr
 			result.ResultMessage = "检测同名文件失败"
@@ -422,24 +905,35 @@ StepUploadPrepareUpload:
 		if efi != nil && efi.FileId != "" {
 			result.Succeed = true
 			result.Extra = efi
-			fmt.Printf("[%s] %s 检测到同名文件，跳过上传: %s\n", utu.taskInfo.Id(), time.Now().Format("2006-01-02 15:04:06"), utu.SavePath)
+			utu.skipped = true
+			utu.reportf(UploadEventSkip, "检测到同名文件，跳过上传: %s", utu.SavePath)
 			return
 		}
 	}
 	if !utu.NoRapidUpload {
 		// 正常上传流程，检测是否能秒传
+		stageStart = time.Now()
 		preHashMatch := true
+		pooled := utu.takePooledHash()
 		if utu.LocalFileChecksum.Length >= DefaultCheckPreHashFileSize {
-			// 大文件，先计算 PreHash，用于检测是否可能支持秒传
-			preHash := CalcFilePreHash(utu.LocalFileChecksum.Path.RealPath)
+			// 大文件，先计算 PreHash，用于检测是否可能支持秒传，协程池已经预先计算的直接使用
+			var preHash string
+			if pooled != nil {
+				preHash = pooled.PreHash
+			} else {
+				preHash = CalcFilePreHash(utu.LocalFileChecksum.Path.RealPath)
+			}
 			if len(preHash) > 0 {
-				if b, er := utu.PanClient.OpenapiPanClient().CheckUploadFilePreHash(&aliyunpan.FileUploadCheckPreHashParam{
+				utu.ApiPacer.Wait()
+				b, er := utu.PanClient.OpenapiPanClient().CheckUploadFilePreHash(&aliyunpan.FileUploadCheckPreHashParam{
 					DriveId:      utu.DriveId,
 					Name:         filepath.Base(utu.SavePath),
 					Size:         utu.LocalFileChecksum.Length,
 					ParentFileId: rs.FileId,
 					PreHash:      preHash,
-				}); er == nil {
+				})
+				utu.ApiPacer.Done(er)
+				if er == nil {
 					preHashMatch = b
 				}
 			}
@@ -447,8 +941,10 @@ StepUploadPrepareUpload:
 
 		if preHashMatch { // preHashMatch为true，代表该文件可能已经被上传过，能够支持秒传，所以需要进一步计算完整SHA1进行检测是否能秒传
 			// 计算完整文件SHA1
-			fmt.Printf("[%s] %s 正在计算文件SHA1: %s\n", utu.taskInfo.Id(), time.Now().Format("2006-01-02 15:04:06"), utu.LocalFileChecksum.Path.LogicPath)
-			utu.LocalFileChecksum.Sum(localfile.CHECKSUM_SHA1)
+			if pooled == nil {
+				utu.reportf(UploadEventInfo, "正在计算文件SHA1: %s", utu.LocalFileChecksum.Path.LogicPath)
+				utu.sumSHA1()
+			}
 			sha1Str = utu.LocalFileChecksum.SHA1
 			if utu.LocalFileChecksum.Length == 0 {
 				sha1Str = aliyunpan.DefaultZeroSizeFileContentHash
@@ -466,8 +962,25 @@ StepUploadPrepareUpload:
 			contentHashName = ""
 			checkNameMode = "auto_rename"
 		}
+		utu.UploadTiming.Since(TimingStageSha1, stageStart)
+
+		// 相册盘去重，已经存在相同内容的照片则跳过
+		if existedPath := utu.AlbumDedup.Find(sha1Str); existedPath != "" && utu.LocalFileChecksum.Length > 0 {
+			result.Succeed = true
+			result.ResultMessage = "相册已存在相同内容的照片"
+			utu.skipped = true
+			utu.reportf(UploadEventSkip, "相册已存在相同内容的照片 %s，跳过上传: %s", existedPath, utu.LocalFileChecksum.Path.LogicPath)
+			return
+		}
 	} else {
-		fmt.Printf("[%s] %s 已经禁用秒传检测，直接上传\n", utu.taskInfo.Id(), time.Now().Format("2006-01-02 15:04:06"))
+		utu.reportf(UploadEventInfo, "已经禁用秒传检测，直接上传")
+		if !utu.NoChecksum && utu.takePooledHash() == nil {
+			// 不秒传但仍然计算SHA1，用于上传完成后校验
+			stageStart = time.Now()
+			utu.reportf(UploadEventInfo, "正在计算文件SHA1用于上传后校验: %s", utu.LocalFileChecksum.Path.LogicPath)
+			utu.sumSHA1()
+			utu.UploadTiming.Since(TimingStageSha1, stageStart)
+		}
 		sha1Str = ""
 		contentHashName = ""
 		checkNameMode = "auto_rename"
@@ -480,20 +993,22 @@ StepUploadPrepareUpload:
 			if strings.ToUpper(efi.ContentHash) == strings.ToUpper(sha1Str) {
 				result.Succeed = true
 				result.Extra = efi
-				fmt.Printf("[%s] %s 检测到同名文件，文件内容完全一致，无需重复上传: %s\n", utu.taskInfo.Id(), time.Now().Format("2006-01-02 15:04:06"), utu.SavePath)
+				utu.skipped = true
+				utu.reportf(UploadEventSkip, "检测到同名文件，文件内容完全一致，无需重复上传: %s", utu.SavePath)
 				return
 			}
 			// existed, delete it
 			var fileDeleteResult *aliyunpan.FileBatchActionResult
 			var err *apierror.ApiError
+			utu.ApiPacer.Wait()
 			fileDeleteResult, err = utu.PanClient.OpenapiPanClient().FileDelete(&aliyunpan.FileBatchActionParam{DriveId: efi.DriveId, FileId: efi.FileId})
+			utu.ApiPacer.Done(err)
 			if err != nil || !fileDeleteResult.Success {
 				result.Err = err
 				result.ResultMessage = "无法删除文件，请稍后重试"
 				return
 			}
-			time.Sleep(time.Duration(500) * time.Millisecond)
-			fmt.Printf("[%s] %s 检测到同名文件，文件内容不一致，已将旧文件移动到回收站: %s\n", utu.taskInfo.Id(), time.Now().Format("2006-01-02 15:04:06"), utu.SavePath)
+			utu.reportf(UploadEventInfo, "检测到同名文件，文件内容不一致，已将旧文件移动到回收站: %s", utu.SavePath)
 		}
 	}
 
@@ -535,7 +1050,12 @@ StepUploadPrepareUpload:
 		}
 	}
 
-	uploadOpEntity, apierr = utu.PanClient.OpenapiPanClient().CreateUploadFile(appCreateUploadFileParam)
+	uploadOpEntity, apierr, createOk = utu.createUploadFile(utu.PanClient.OpenapiPanClient(), appCreateUploadFileParam, saveFilePath)
+	if !createOk {
+		result.Err = apierr
+		result.ResultMessage = "重新创建云盘文件夹失败"
+		return
+	}
 	if apierr != nil {
 		result.Err = apierr
 		result.ResultMessage = "创建上传任务失败：" + apierr.Error()
@@ -544,7 +1064,13 @@ StepUploadPrepareUpload:
 			// 重试
 			result.NeedRetry = true
 		} else if apierr.Code == apierror.ApiCodeUploadPayloadTooLarge {
-			fmt.Printf("[%s] %s 上传文件的大小超出限制，你可能需要开通阿里云盘三方权益包以便上传大文件\n", utu.taskInfo.Id(), time.Now().Format("2006-01-02 15:04:06"))
+			// 单文件大小上限无法提前查询，只有文件实际超出上限时才提示三方权益包
+			if utu.UploadQuota != nil && utu.UploadQuota.ThirdPartyVip {
+				utu.reportf(UploadEventError, "上传文件的大小超出单文件大小上限")
+			} else {
+				utu.reportf(UploadEventError, "上传文件的大小超出限制，你可能需要开通阿里云盘三方权益包以便上传大文件")
+			}
+			utu.UploadStatistic.AddOverLimitFile(utu.LocalFileChecksum.Path.LogicPath, utu.LocalFileChecksum.Length, "超出单文件大小上限")
 		}
 		return
 	}
@@ -569,10 +1095,12 @@ stepUploadUpload:
 		// 处理上传错误
 		if errors.Is(uploadResult.Err, uploader.UploadPartNotSeq) {
 			// 分片乱序错误
+			// 单个文件本身就是单线程按顺序上传分片的(Parallel=1)，没有可以降级的并发设置，
+			// 只能按网盘已经收到的分片修正序号后继续上传，保留已经上传的分片
 			if ee := utu.amendFileUploadPartNum(); ee != nil {
 				// 修正分片乱序失败，先令上传任务直接失败
 				logger.Verboseln("WARNING! amend uploaded parts num failed")
-				fmt.Printf("[%s] %s 无法修正上传分片乱序的错误，建议重新上传\n", utu.taskInfo.Id(), time.Now().Format("2006-01-02 15:04:06"))
+				utu.reportf(UploadEventError, "无法修正上传分片乱序的错误，建议重新上传")
 				uploadResult = &taskframework.TaskUnitRunResult{
 					Succeed:       false,
 					NeedRetry:     false,
@@ -588,7 +1116,7 @@ stepUploadUpload:
 		}
 		if errors.Is(uploadResult.Err, uploader.UploadNoSuchUpload) {
 			// 上传任务过期
-			fmt.Printf("[%s] %s 网盘上传任务不存在，创建新任务重新上传文件\n", utu.taskInfo.Id(), time.Now().Format("2006-01-02 15:04:06"))
+			utu.reportf(UploadEventInfo, "网盘上传任务不存在，创建新任务重新上传文件")
 			// 需要重新从0开始上传
 			uploadResult = nil
 			utu.LocalFileChecksum.UploadOpEntity = nil
@@ -599,7 +1127,7 @@ stepUploadUpload:
 		if errors.As(uploadResult.Err, &apier) {
 			// 上传任务过期
 			if apier.Code == apierror.ApiCodeUploadIdNotFound {
-				fmt.Printf("[%s] %s 网盘上传任务已失效，创建新任务重新上传文件\n", utu.taskInfo.Id(), time.Now().Format("2006-01-02 15:04:06"))
+				utu.reportf(UploadEventInfo, "网盘上传任务已失效，创建新任务重新上传文件")
 				uploadResult = nil
 				utu.LocalFileChecksum.UploadOpEntity = nil
 				utu.state = nil
@@ -607,9 +1135,74 @@ stepUploadUpload:
 			}
 		}
 	}
+	if uploadResult != nil && uploadResult.Succeed && utu.NoRapidUpload && !utu.NoChecksum {
+		utu.verifyUploadedFile(uploadResult)
+	}
 	return uploadResult
 }
 
+// sumSHA1 计算文件SHA1，大文件会周期性保存计算进度到上传数据库，中断后重新上传可以从上次的进度继续计算
+func (utu *UploadTaskUnit) sumSHA1() {
+	lfc := utu.LocalFileChecksum
+	if lfc.Length < DefaultSHA1CheckpointFileSize {
+		lfc.Sum(localfile.CHECKSUM_SHA1)
+		return
+	}
+	if lfc.SHA1Checkpoint != nil && lfc.SHA1Checkpoint.Length == lfc.Length && lfc.SHA1Checkpoint.ModTime == lfc.ModTime {
+		utu.reportf(UploadEventInfo, "从上次的进度 %s 继续计算文件SHA1", converter.ConvertFileSize(lfc.SHA1Checkpoint.Offset, 2))
+	}
+	lfc.OnSHA1Checkpoint = func() {
+		utu.UploadingDatabase.UpdateUploading(&lfc.LocalFileMeta, utu.state)
+		utu.UploadingDatabase.Save()
+	}
+	defer func() {
+		lfc.OnSHA1Checkpoint = nil
+	}()
+	lfc.Sum(localfile.CHECKSUM_SHA1)
+}
+
+// takePooledHash 从SHA1预计算协程池获取文件的SHA1和PreHash，没有结果或者文件计算后被修改过返回nil，需要重新计算
+func (utu *UploadTaskUnit) takePooledHash() *localfile.HashResult {
+	r := utu.HashPool.Take(utu.LocalFileChecksum.Path.RealPath)
+	if r == nil || r.Err != nil || r.SHA1 == "" {
+		return nil
+	}
+	if r.Length != utu.LocalFileChecksum.Length || r.ModTime != utu.LocalFileChecksum.ModTime {
+		return nil
+	}
+	utu.LocalFileChecksum.SHA1 = r.SHA1
+	logger.Verbosef("[%s] use pre-computed sha1: %s\n", utu.taskInfo.Id(), r.SHA1)
+	return r
+}
+
+// verifyUploadedFile 不秒传但计算了SHA1的文件，上传完成后校验网盘文件的SHA1
+func (utu *UploadTaskUnit) verifyUploadedFile(result *taskframework.TaskUnitRunResult) {
+	if utu.LocalFileChecksum.SHA1 == "" || utu.LocalFileChecksum.UploadOpEntity == nil {
+		return
+	}
+	fe, apierr := utu.PanClient.OpenapiPanClient().FileInfoById(utu.DriveId, utu.LocalFileChecksum.UploadOpEntity.FileId)
+	if apierr != nil {
+		logger.Verboseln("get uploaded file info error: ", apierr)
+		utu.reportf(UploadEventError, "获取网盘文件信息失败，无法校验SHA1: %s", utu.SavePath)
+		return
+	}
+	if !strings.EqualFold(fe.ContentHash, utu.LocalFileChecksum.SHA1) {
+		result.Succeed = false
+		result.Err = fmt.Errorf("SHA1不一致, 本地: %s, 网盘: %s", utu.LocalFileChecksum.SHA1, fe.ContentHash)
+		result.ResultMessage = "上传文件SHA1校验失败"
+		// 内容错误的文件不能留在目标路径，移动到回收站，需要时可以从回收站恢复
+		r, apierr := utu.PanClient.OpenapiPanClient().FileDelete(&aliyunpan.FileBatchActionParam{DriveId: utu.DriveId, FileId: fe.FileId})
+		if apierr != nil || r == nil || !r.Success {
+			logger.Verboseln("delete corrupted uploaded file error: ", apierr)
+			result.ResultMessage += ", 移动网盘文件到回收站失败, 请手动删除"
+			return
+		}
+		utu.reportf(UploadEventError, "上传文件SHA1校验失败, 已将网盘文件移动到回收站: %s", utu.SavePath)
+		return
+	}
+	utu.reportf(UploadEventInfo, "上传文件SHA1校验通过: %s", utu.SavePath)
+}
+
 // amendFileUploadPartNum 修正文件分片上传顺序错误
 func (utu *UploadTaskUnit) amendFileUploadPartNum() error {
 	if utu.LocalFileChecksum.LocalFileMeta.UploadOpEntity == nil || utu.state == nil {
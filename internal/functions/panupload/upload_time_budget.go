@@ -0,0 +1,116 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panupload
+
+import (
+	"sync"
+	"time"
+)
+
+type (
+	// UploadTimeBudget 上传批次的时间预算。到达预算后不再开始新的文件上传，
+	// abort模式下进行中的上传也会被中止并保存断点。所有方法都支持nil调用，nil代表不限制时间
+	UploadTimeBudget struct {
+		Budget time.Duration
+
+		deadline   time.Time
+		abort      bool
+		done       chan struct{}
+		timer      *time.Timer
+		unfinished []string // 因为到达时间预算没有完成上传的本地文件
+		mutex      sync.Mutex
+	}
+)
+
+// NewUploadTimeBudget 创建时间预算并开始计时，budget小于等于0返回nil
+func NewUploadTimeBudget(budget time.Duration, abort bool) *UploadTimeBudget {
+	if budget <= 0 {
+		return nil
+	}
+	b := &UploadTimeBudget{
+		Budget:   budget,
+		deadline: time.Now().Add(budget),
+		abort:    abort,
+		done:     make(chan struct{}),
+	}
+	b.timer = time.AfterFunc(budget, func() {
+		close(b.done)
+	})
+	return b
+}
+
+// Exceeded 是否已经到达时间预算
+func (b *UploadTimeBudget) Exceeded() bool {
+	if b == nil {
+		return false
+	}
+	select {
+	case <-b.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Done 到达时间预算时关闭的channel，nil对应的channel永远不会关闭
+func (b *UploadTimeBudget) Done() <-chan struct{} {
+	if b == nil {
+		return nil
+	}
+	return b.done
+}
+
+// AbortInFlight 到达时间预算时是否中止进行中的上传
+func (b *UploadTimeBudget) AbortInFlight() bool {
+	return b != nil && b.abort
+}
+
+// Remaining 剩余时间
+func (b *UploadTimeBudget) Remaining() time.Duration {
+	if b == nil {
+		return 0
+	}
+	if d := time.Until(b.deadline); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// AddUnfinished 记录因为到达时间预算没有完成上传的文件
+func (b *UploadTimeBudget) AddUnfinished(localFilePath string) {
+	if b == nil {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.unfinished = append(b.unfinished, localFilePath)
+}
+
+// Unfinished 因为到达时间预算没有完成上传的文件
+func (b *UploadTimeBudget) Unfinished() []string {
+	if b == nil {
+		return nil
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return append([]string{}, b.unfinished...)
+}
+
+// Stop 停止计时
+func (b *UploadTimeBudget) Stop() {
+	if b == nil {
+		return
+	}
+	b.timer.Stop()
+}
@@ -0,0 +1,56 @@
+package panupload
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUploadTimeBudgetNil(t *testing.T) {
+	// 不限制时间
+	b := NewUploadTimeBudget(0, true)
+	if b != nil {
+		t.Fatal("budget <= 0 should return nil")
+	}
+	b.AddUnfinished("/a.txt")
+	b.Stop()
+	if b.Exceeded() || b.AbortInFlight() || b.Remaining() != 0 || b.Done() != nil || b.Unfinished() != nil {
+		t.Fatal("nil budget should never be exceeded")
+	}
+}
+
+func TestUploadTimeBudgetExceeded(t *testing.T) {
+	b := NewUploadTimeBudget(50*time.Millisecond, true)
+	if b.Exceeded() || b.Remaining() <= 0 || !b.AbortInFlight() {
+		t.Fatal("budget should not be exceeded yet")
+	}
+	select {
+	case <-b.Done():
+	case <-time.After(time.Second):
+		t.Fatal("budget should be exceeded")
+	}
+	if !b.Exceeded() || b.Remaining() != 0 {
+		t.Fatal("budget should be exceeded")
+	}
+
+	b.AddUnfinished("/a.txt")
+	b.AddUnfinished("/b.txt")
+	unfinished := b.Unfinished()
+	if len(unfinished) != 2 || unfinished[1] != "/b.txt" {
+		t.Fatalf("unfinished: %v", unfinished)
+	}
+	// 返回的是副本
+	unfinished[0] = "/c.txt"
+	if b.Unfinished()[0] != "/a.txt" {
+		t.Fatal("unfinished should be copied")
+	}
+}
+
+func TestUploadTimeBudgetStop(t *testing.T) {
+	// 上传全部完成后停止计时，不再触发
+	b := NewUploadTimeBudget(20*time.Millisecond, false)
+	b.Stop()
+	time.Sleep(50 * time.Millisecond)
+	if b.Exceeded() || b.AbortInFlight() {
+		t.Fatal("stopped budget should not be exceeded")
+	}
+}
@@ -0,0 +1,284 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panupload
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/tickstep/aliyunpan/cmder/cmdtable"
+	"github.com/tickstep/aliyunpan/internal/file/uploader"
+	"github.com/tickstep/library-go/converter"
+	"github.com/tickstep/library-go/requester"
+	"github.com/tickstep/library-go/requester/rio"
+)
+
+const (
+	TimingStageScan   = "扫描"
+	TimingStageQueue  = "排队等待"
+	TimingStageMkdir  = "创建文件夹"
+	TimingStageSha1   = "SHA1"
+	TimingStageCreate = "创建任务"
+	TimingStagePart   = "分片上传"
+	TimingStageCommit = "合并确认"
+)
+
+// timingStageOrder 报表中阶段的输出顺序
+var timingStageOrder = []string{
+	TimingStageScan, TimingStageQueue, TimingStageMkdir, TimingStageSha1, TimingStageCreate, TimingStagePart, TimingStageCommit,
+}
+
+type (
+	// TimingStage 上传阶段耗时
+	TimingStage struct {
+		Name     string
+		PartNum  int // 分片编号，从1开始，非分片阶段为0
+		Duration time.Duration
+	}
+
+	// UploadTiming 单个文件上传的时间线，所有方法都支持nil调用，nil代表未开启耗时统计
+	UploadTiming struct {
+		LocalFilePath string
+		FileSize      int64
+
+		queuedAt time.Time // 加入上传队列的时间，由 mutex 保护
+		stages   []*TimingStage
+		mutex    sync.Mutex
+	}
+
+	// TimingStageSummary 阶段耗时汇总
+	TimingStageSummary struct {
+		Name    string
+		Count   int
+		Total   time.Duration
+		Max     time.Duration
+		Percent float64 // 占全部耗时的百分比
+	}
+
+	// UploadTimingReport 上传耗时报表
+	UploadTimingReport struct {
+		timings []*UploadTiming
+		mutex   sync.Mutex
+	}
+
+	// timingMultiUpload 记录分片上传和合并确认耗时的 MultiUpload
+	timingMultiUpload struct {
+		uploader.MultiUpload
+		timing *UploadTiming
+	}
+)
+
+// NewUploadTiming 创建文件上传时间线
+func NewUploadTiming(localFilePath string, fileSize int64) *UploadTiming {
+	return &UploadTiming{
+		LocalFilePath: localFilePath,
+		FileSize:      fileSize,
+	}
+}
+
+// AddStage 记录阶段耗时
+func (ut *UploadTiming) AddStage(name string, partNum int, d time.Duration) {
+	if ut == nil {
+		return
+	}
+	ut.mutex.Lock()
+	defer ut.mutex.Unlock()
+	ut.stages = append(ut.stages, &TimingStage{
+		Name:     name,
+		PartNum:  partNum,
+		Duration: d,
+	})
+}
+
+// Since 记录从 start 开始到现在的阶段耗时
+func (ut *UploadTiming) Since(name string, start time.Time) {
+	ut.AddStage(name, 0, time.Since(start))
+}
+
+// MarkQueued 标记加入上传队列
+func (ut *UploadTiming) MarkQueued() {
+	if ut == nil {
+		return
+	}
+	ut.mutex.Lock()
+	defer ut.mutex.Unlock()
+	ut.queuedAt = time.Now()
+}
+
+// MarkDequeued 标记开始执行，记录排队等待耗时。重试时不重复记录
+func (ut *UploadTiming) MarkDequeued() {
+	if ut == nil {
+		return
+	}
+	ut.mutex.Lock()
+	queuedAt := ut.queuedAt
+	ut.queuedAt = time.Time{}
+	ut.mutex.Unlock()
+	if queuedAt.IsZero() {
+		return
+	}
+	ut.Since(TimingStageQueue, queuedAt)
+}
+
+// Stages 阶段耗时列表
+func (ut *UploadTiming) Stages() []*TimingStage {
+	ut.mutex.Lock()
+	defer ut.mutex.Unlock()
+	return append([]*TimingStage{}, ut.stages...)
+}
+
+// Total 总耗时
+func (ut *UploadTiming) Total() time.Duration {
+	var total time.Duration
+	for _, s := range ut.Stages() {
+		total += s.Duration
+	}
+	return total
+}
+
+// WrapMultiUpload 包装 MultiUpload 记录分片上传和合并确认的耗时
+func (ut *UploadTiming) WrapMultiUpload(mu uploader.MultiUpload) uploader.MultiUpload {
+	if ut == nil {
+		return mu
+	}
+	return &timingMultiUpload{
+		MultiUpload: mu,
+		timing:      ut,
+	}
+}
+
+func (tmu *timingMultiUpload) UploadFile(ctx context.Context, partseq int, partOffset int64, partEnd int64, readerlen64 rio.ReaderLen64, uploadClient *requester.HTTPClient) (uploadDone bool, terr error) {
+	start := time.Now()
+	uploadDone, terr = tmu.MultiUpload.UploadFile(ctx, partseq, partOffset, partEnd, readerlen64, uploadClient)
+	tmu.timing.AddStage(TimingStagePart, partseq+1, time.Since(start))
+	return
+}
+
+func (tmu *timingMultiUpload) CommitFile() (cerr error) {
+	start := time.Now()
+	cerr = tmu.MultiUpload.CommitFile()
+	tmu.timing.Since(TimingStageCommit, start)
+	return
+}
+
+// NewUploadTimingReport 创建上传耗时报表
+func NewUploadTimingReport() *UploadTimingReport {
+	return &UploadTimingReport{}
+}
+
+// NewTiming 创建文件时间线并加入报表，报表为nil时返回nil
+func (r *UploadTimingReport) NewTiming(localFilePath string, fileSize int64) *UploadTiming {
+	if r == nil {
+		return nil
+	}
+	ut := NewUploadTiming(localFilePath, fileSize)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.timings = append(r.timings, ut)
+	return ut
+}
+
+// Print 输出每个文件的时间线以及阶段耗时分布
+func (r *UploadTimingReport) Print(w io.Writer) {
+	if r == nil || len(r.timings) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "文件上传时间线: \n")
+	tb := cmdtable.NewTable(w)
+	tb.SetHeader([]string{"文件路径", "文件大小", "总耗时", "时间线"})
+	tb.SetColumnAlignment([]int{tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT})
+	for _, ut := range r.timings {
+		items := []string{}
+		for _, s := range ut.Stages() {
+			name := s.Name
+			if s.PartNum > 0 {
+				name = fmt.Sprintf("分片%d", s.PartNum)
+			}
+			items = append(items, name+" "+formatTimingDuration(s.Duration))
+		}
+		tb.Append([]string{ut.LocalFilePath, converter.ConvertFileSize(ut.FileSize, 2), formatTimingDuration(ut.Total()), strings.Join(items, " → ")})
+	}
+	tb.Render()
+
+	// 阶段耗时分布
+	fmt.Fprintf(w, "阶段耗时分布: \n")
+	tb = cmdtable.NewTable(w)
+	tb.SetHeader([]string{"阶段", "次数", "总耗时", "平均耗时", "最大耗时", "占比"})
+	for _, ss := range r.StageSummaries() {
+		tb.Append([]string{
+			ss.Name,
+			fmt.Sprintf("%d", ss.Count),
+			formatTimingDuration(ss.Total),
+			formatTimingDuration(ss.Average()),
+			formatTimingDuration(ss.Max),
+			fmt.Sprintf("%.2f%%", ss.Percent),
+		})
+	}
+	tb.Render()
+}
+
+// StageSummaries 按阶段汇总耗时分布
+func (r *UploadTimingReport) StageSummaries() []*TimingStageSummary {
+	if r == nil {
+		return nil
+	}
+	summary := map[string]*TimingStageSummary{}
+	var allTotal time.Duration
+	for _, ut := range r.timings {
+		for _, s := range ut.Stages() {
+			ss, ok := summary[s.Name]
+			if !ok {
+				ss = &TimingStageSummary{Name: s.Name}
+				summary[s.Name] = ss
+			}
+			ss.Count += 1
+			ss.Total += s.Duration
+			if s.Duration > ss.Max {
+				ss.Max = s.Duration
+			}
+			allTotal += s.Duration
+		}
+	}
+	result := []*TimingStageSummary{}
+	for _, name := range timingStageOrder {
+		ss, ok := summary[name]
+		if !ok {
+			continue
+		}
+		if allTotal > 0 {
+			ss.Percent = float64(ss.Total) / float64(allTotal) * 100
+		}
+		result = append(result, ss)
+	}
+	return result
+}
+
+// Average 平均耗时
+func (ss *TimingStageSummary) Average() time.Duration {
+	if ss.Count == 0 {
+		return 0
+	}
+	return ss.Total / time.Duration(ss.Count)
+}
+
+// formatTimingDuration 耗时精确到毫秒
+func formatTimingDuration(d time.Duration) string {
+	return d.Round(time.Millisecond).String()
+}
@@ -0,0 +1,55 @@
+package panupload
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUploadTimingQueueStage(t *testing.T) {
+	ut := NewUploadTiming("/tmp/a.txt", 10)
+	ut.MarkQueued()
+	ut.MarkDequeued()
+	// 重试时不重复记录排队耗时
+	ut.MarkDequeued()
+	stages := ut.Stages()
+	if len(stages) != 1 || stages[0].Name != TimingStageQueue {
+		t.Fatalf("unexpected stages: %v", stages)
+	}
+
+	// nil代表未开启耗时统计
+	var nilTiming *UploadTiming
+	nilTiming.MarkQueued()
+	nilTiming.MarkDequeued()
+}
+
+func TestUploadTimingConcurrent(t *testing.T) {
+	ut := NewUploadTiming("/tmp/a.txt", 10)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			ut.MarkQueued()
+		}()
+		go func() {
+			defer wg.Done()
+			ut.MarkDequeued()
+		}()
+		go func(i int) {
+			defer wg.Done()
+			ut.AddStage(TimingStagePart, i+1, time.Millisecond)
+			ut.Total()
+		}(i)
+	}
+	wg.Wait()
+	parts := 0
+	for _, s := range ut.Stages() {
+		if s.Name == TimingStagePart {
+			parts++
+		}
+	}
+	if parts != 20 {
+		t.Fatalf("part stages: %d", parts)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panupload
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/tickstep/aliyunpan/internal/functions"
+	"github.com/tickstep/library-go/converter"
+)
+
+type (
+	// UploadDirSummary 按目录汇总的上传结果，统计数量包含所有子目录中的文件
+	UploadDirSummary struct {
+		Name         string // 目录名称
+		Path         string // 目录完整路径
+		SucceedCount int
+		SucceedSize  int64
+		FailedCount  int
+		FailedSize   int64
+		SkippedCount int
+		SkippedSize  int64
+		Children     []*UploadDirSummary
+
+		childMap map[string]*UploadDirSummary
+	}
+)
+
+// NewUploadDirTree 按本地文件所在的目录聚合上传结果，根节点为所有文件的公共父目录
+func NewUploadDirTree(files []*functions.FileResult) *UploadDirSummary {
+	if len(files) == 0 {
+		return nil
+	}
+	dirs := make([][]string, len(files))
+	var common []string
+	for i, f := range files {
+		dirs[i] = strings.Split(filepath.ToSlash(filepath.Dir(filepath.Clean(f.Path))), "/")
+		if i == 0 {
+			common = dirs[i]
+			continue
+		}
+		n := 0
+		for n < len(common) && n < len(dirs[i]) && common[n] == dirs[i][n] {
+			n++
+		}
+		common = common[:n]
+	}
+
+	rootPath := strings.Join(common, "/")
+	if len(common) == 1 && common[0] == "" {
+		rootPath = "/"
+	} else if rootPath == "" {
+		rootPath = "."
+	}
+	root := &UploadDirSummary{Name: rootPath, Path: rootPath}
+	for i, f := range files {
+		node := root
+		node.add(f)
+		for _, name := range dirs[i][len(common):] {
+			node = node.child(name)
+			node.add(f)
+		}
+	}
+	root.sortChildren()
+	return root
+}
+
+func (s *UploadDirSummary) child(name string) *UploadDirSummary {
+	if s.childMap == nil {
+		s.childMap = map[string]*UploadDirSummary{}
+	}
+	c, ok := s.childMap[name]
+	if !ok {
+		c = &UploadDirSummary{Name: name, Path: strings.TrimSuffix(s.Path, "/") + "/" + name}
+		s.childMap[name] = c
+		s.Children = append(s.Children, c)
+	}
+	return c
+}
+
+func (s *UploadDirSummary) add(f *functions.FileResult) {
+	switch f.Status {
+	case functions.FileResultFailed:
+		s.FailedCount++
+		s.FailedSize += f.Size
+	case functions.FileResultSkipped:
+		s.SkippedCount++
+		s.SkippedSize += f.Size
+	default:
+		s.SucceedCount++
+		s.SucceedSize += f.Size
+	}
+}
+
+func (s *UploadDirSummary) sortChildren() {
+	sort.Slice(s.Children, func(i, j int) bool {
+		return s.Children[i].Name < s.Children[j].Name
+	})
+	for _, c := range s.Children {
+		c.sortChildren()
+	}
+}
+
+// String 目录的汇总结果，数量为0的项不显示
+func (s *UploadDirSummary) String() string {
+	items := []string{fmt.Sprintf("成功 %d (%s)", s.SucceedCount, converter.ConvertFileSize(s.SucceedSize, 2))}
+	if s.FailedCount > 0 {
+		items = append(items, fmt.Sprintf("失败 %d (%s)", s.FailedCount, converter.ConvertFileSize(s.FailedSize, 2)))
+	}
+	if s.SkippedCount > 0 {
+		items = append(items, fmt.Sprintf("跳过 %d (%s)", s.SkippedCount, converter.ConvertFileSize(s.SkippedSize, 2)))
+	}
+	return strings.Join(items, ", ")
+}
+
+// Print 以树状输出每个目录的汇总结果，有失败文件的目录以 [!] 标记
+func (s *UploadDirSummary) Print(w io.Writer) {
+	if s == nil {
+		return
+	}
+	fmt.Fprintf(w, "按目录汇总上传结果: \n")
+	fmt.Fprintf(w, "%s%s  %s\n", failedMark(s), s.Name, s)
+	s.printChildren(w, "")
+}
+
+func (s *UploadDirSummary) printChildren(w io.Writer, prefix string) {
+	for i, c := range s.Children {
+		branch, next := "├── ", "│   "
+		if i == len(s.Children)-1 {
+			branch, next = "└── ", "    "
+		}
+		fmt.Fprintf(w, "%s%s%s%s  %s\n", prefix, branch, failedMark(c), c.Name, c)
+		c.printChildren(w, prefix+next)
+	}
+}
+
+func failedMark(s *UploadDirSummary) string {
+	if s.FailedCount > 0 {
+		return "[!] "
+	}
+	return ""
+}
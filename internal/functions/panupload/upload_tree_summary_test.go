@@ -0,0 +1,56 @@
+package panupload
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tickstep/aliyunpan/internal/functions"
+)
+
+func TestNewUploadDirTree(t *testing.T) {
+	if NewUploadDirTree(nil) != nil {
+		t.Fatal("empty result should have no tree")
+	}
+	root := NewUploadDirTree([]*functions.FileResult{
+		{Path: "/data/photos/2024/a.jpg", Size: 100, Status: functions.FileResultSucceed},
+		{Path: "/data/photos/2024/b.jpg", Size: 200, Status: functions.FileResultFailed},
+		{Path: "/data/photos/2023/c.jpg", Size: 300, Status: functions.FileResultSkipped},
+		{Path: "/data/docs/d.txt", Size: 10, Status: functions.FileResultSucceed},
+	})
+	if root.Path != "/data" || root.SucceedCount != 2 || root.FailedCount != 1 || root.SkippedCount != 1 || root.SucceedSize != 110 {
+		t.Fatalf("unexpected root: %+v", root)
+	}
+	if len(root.Children) != 2 || root.Children[0].Name != "docs" || root.Children[1].Name != "photos" {
+		t.Fatalf("children should be sorted by name: %+v", root.Children)
+	}
+	photos := root.Children[1]
+	if photos.Path != "/data/photos" || len(photos.Children) != 2 {
+		t.Fatalf("unexpected photos: %+v", photos)
+	}
+	y2023, y2024 := photos.Children[0], photos.Children[1]
+	if y2023.SkippedCount != 1 || y2023.SkippedSize != 300 || y2024.FailedCount != 1 || y2024.SucceedCount != 1 {
+		t.Fatalf("unexpected year summary: %+v %+v", y2023, y2024)
+	}
+
+	buf := &strings.Builder{}
+	root.Print(buf)
+	for _, line := range []string{
+		"[!] /data  成功 2 (110B), 失败 1 (200B), 跳过 1 (300B)\n",
+		"├── docs  成功 1 (10B)\n",
+		"    └── [!] 2024  成功 1 (100B), 失败 1 (200B)\n",
+	} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("missing line %q in:\n%s", line, buf.String())
+		}
+	}
+}
+
+func TestNewUploadDirTreeSingleDir(t *testing.T) {
+	root := NewUploadDirTree([]*functions.FileResult{
+		{Path: "a.txt", Size: 1, Status: functions.FileResultSucceed},
+		{Path: "b.txt", Size: 2, Status: functions.FileResultSucceed},
+	})
+	if root.Path != "." || root.SucceedCount != 2 || len(root.Children) != 0 {
+		t.Fatalf("unexpected tree: %+v", root)
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panupload
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/library-go/logger"
+)
+
+const (
+	// videoWarmupDelay 文件创建完成后等待一段时间再触发转码，太早调用接口可能还没有文件信息
+	videoWarmupDelay = 3 * time.Second
+	// videoWarmupMaxRetry 触发转码失败的最大重试次数
+	videoWarmupMaxRetry = 3
+	// videoWarmupRetryInterval 触发转码失败的重试间隔
+	videoWarmupRetryInterval = 5 * time.Second
+)
+
+type (
+	videoWarmupItem struct {
+		driveId string
+		fileId  string
+		panPath string
+		addedAt time.Time
+	}
+
+	// VideoWarmup 视频转码预热，视频文件上传成功后在后台调用播放信息接口触发云端转码，之后在线播放不需要等待转码。
+	// 只使用一个协程依次调用，避免请求过于频繁触发风控。所有方法都支持nil调用
+	VideoWarmup struct {
+		panClient *config.PanClient
+		ctx       context.Context
+		queue     chan *videoWarmupItem
+		wg        sync.WaitGroup
+
+		closed  bool
+		succeed int
+		failed  int
+		mutex   sync.Mutex
+	}
+)
+
+// NewVideoWarmup 创建视频转码预热，并启动后台协程。ctx取消后不再触发转码
+func NewVideoWarmup(ctx context.Context, panClient *config.PanClient) *VideoWarmup {
+	w := &VideoWarmup{
+		panClient: panClient,
+		ctx:       ctx,
+		queue:     make(chan *videoWarmupItem, 1000),
+	}
+	w.wg.Add(1)
+	go w.run()
+	return w
+}
+
+// Add 上传成功的文件加入预热队列，非视频文件忽略。
+// 不会阻塞上传：队列已满、已经调用 Wait 或者ctx已取消时直接放弃该文件，记为失败
+func (w *VideoWarmup) Add(driveId, fileId, panPath string) {
+	if w == nil || fileId == "" || !IsVideoFile(panPath) {
+		return
+	}
+	item := &videoWarmupItem{
+		driveId: driveId,
+		fileId:  fileId,
+		panPath: panPath,
+		addedAt: time.Now(),
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if !w.closed && w.ctx.Err() == nil {
+		select {
+		case w.queue <- item:
+			return
+		default:
+		}
+	}
+	w.failed++
+	logger.Verboseln("视频转码预热队列已满或已停止，跳过：" + panPath)
+}
+
+// sleep 等待一段时间，ctx取消时返回false
+func (w *VideoWarmup) sleep(d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-w.ctx.Done():
+		return false
+	}
+}
+
+func (w *VideoWarmup) run() {
+	defer w.wg.Done()
+	for item := range w.queue {
+		ok := false
+		if d := videoWarmupDelay - time.Since(item.addedAt); d <= 0 || w.sleep(d) {
+			ok = w.warmup(item)
+		}
+		w.mutex.Lock()
+		if ok {
+			w.succeed++
+		} else {
+			w.failed++
+		}
+		w.mutex.Unlock()
+	}
+}
+
+// warmup 调用播放信息接口触发转码，失败时重试
+func (w *VideoWarmup) warmup(item *videoWarmupItem) bool {
+	for i := 0; i <= videoWarmupMaxRetry; i++ {
+		if i > 0 && !w.sleep(videoWarmupRetryInterval) {
+			return false
+		}
+		_, err := w.panClient.OpenapiPanClient().VideoGetPreviewPlayInfo(&aliyunpan.VideoGetPreviewPlayInfoParam{
+			DriveId: item.driveId,
+			FileId:  item.fileId,
+		})
+		if err == nil {
+			logger.Verboseln("触发视频转码预热成功：" + item.panPath)
+			return true
+		}
+		logger.Verbosef("触发视频转码预热失败: %s, %s\n", item.panPath, err)
+	}
+	return false
+}
+
+// Wait 等待队列中的视频全部触发完成，返回成功和失败的数量。调用后不能再加入新的文件
+func (w *VideoWarmup) Wait() (succeed, failed int) {
+	if w == nil {
+		return 0, 0
+	}
+	w.mutex.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mutex.Unlock()
+	w.wg.Wait()
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.succeed, w.failed
+}
@@ -0,0 +1,54 @@
+package panupload
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tickstep/aliyunpan/internal/config"
+)
+
+func setVideoExtensions(t *testing.T) {
+	old := config.Config.VideoFileExtensions
+	config.Config.VideoFileExtensions = config.DefaultVideoFileExtensions
+	t.Cleanup(func() {
+		config.Config.VideoFileExtensions = old
+	})
+}
+
+func TestVideoWarmupAddNonBlocking(t *testing.T) {
+	setVideoExtensions(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	// 不启动后台协程，模拟预热协程正在忙
+	w := &VideoWarmup{ctx: ctx, queue: make(chan *videoWarmupItem, 1)}
+
+	done := make(chan struct{})
+	go func() {
+		w.Add("d1", "f1", "/a.mp4")
+		w.Add("d1", "f2", "/b.mp4") // 队列已满
+		w.Add("d1", "f3", "/c.txt") // 非视频文件忽略
+		cancel()
+		w.Add("d1", "f4", "/d.mp4") // ctx已取消
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Add blocked")
+	}
+	if len(w.queue) != 1 || w.failed != 2 {
+		t.Fatalf("queue = %d, failed = %d", len(w.queue), w.failed)
+	}
+}
+
+func TestVideoWarmupAddAfterWait(t *testing.T) {
+	setVideoExtensions(t)
+	w := NewVideoWarmup(context.Background(), nil)
+	if succeed, failed := w.Wait(); succeed != 0 || failed != 0 {
+		t.Fatalf("succeed = %d, failed = %d", succeed, failed)
+	}
+	w.Add("d1", "f1", "/a.mp4")
+	if _, failed := w.Wait(); failed != 1 {
+		t.Fatalf("failed = %d", failed)
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package panupload
+
+import (
+	"archive/zip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
+)
+
+const (
+	// ZipManifestFileName 被拒文件压缩上传的映射清单文件名
+	ZipManifestFileName = "upload_zip_manifest.csv"
+)
+
+type (
+	// ZipRetryItem 被拒文件压缩后重新上传的映射
+	ZipRetryItem struct {
+		LocalPath string // 原始本地文件路径
+		SavePath  string // 原始网盘保存路径
+		ZipFile   string // 本地临时压缩文件路径
+		ZipPath   string // 压缩文件的网盘保存路径
+		Password  string // 压缩文件密码
+	}
+
+	// zipCrypto 传统PKWARE加密，7-Zip、WinRAR等常用解压软件都支持
+	zipCrypto struct {
+		keys [3]uint32
+	}
+)
+
+// IsUploadRejected 是否是文件被网盘拒绝的错误，例如文件名或者内容被拦截。
+// 只有网盘明确禁止的错误码才视为被拒，限流、网络错误、token失效以及通用的请求失败都可能是暂时的，不会打包重新上传
+func IsUploadRejected(err error) bool {
+	var apiErr *apierror.ApiError
+	if !errors.As(err, &apiErr) || apiErr == nil {
+		return false
+	}
+	return apiErr.Code == apierror.ApiCodeForbidden
+}
+
+// NewZipRetryItem 为被拒的文件生成混淆后的压缩文件名，压缩文件保存在tempDir，上传到原文件所在的网盘目录
+func NewZipRetryItem(localPath, savePath, tempDir, password string) *ZipRetryItem {
+	sum := sha1.Sum([]byte(localPath + time.Now().String()))
+	name := hex.EncodeToString(sum[:8]) + ".zip"
+	return &ZipRetryItem{
+		LocalPath: localPath,
+		SavePath:  savePath,
+		ZipFile:   filepath.Join(tempDir, name),
+		ZipPath:   path.Join(path.Dir(savePath), name),
+		Password:  password,
+	}
+}
+
+// Compress 把原始文件打包成带密码的zip文件，压缩包内的文件名同样经过混淆，只保留扩展名
+func (item *ZipRetryItem) Compress() error {
+	entryName := strings.TrimSuffix(path.Base(item.ZipPath), ".zip") + strings.ToLower(filepath.Ext(item.LocalPath))
+	return ZipEncryptFile(item.LocalPath, item.ZipFile, entryName, item.Password)
+}
+
+// AppendZipManifest 追加压缩文件映射到清单文件，方便日后找回原始文件
+func AppendZipManifest(manifestFile string, items []*ZipRetryItem) error {
+	rows := [][]string{}
+	for _, item := range items {
+		rows = append(rows, []string{item.LocalPath, item.SavePath, item.ZipPath, item.Password})
+	}
+	return appendCsvManifest(manifestFile, []string{"本地文件", "原网盘路径", "压缩文件网盘路径", "解压密码"}, rows)
+}
+
+// RandomZipPassword 生成随机的压缩密码
+func RandomZipPassword() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// ZipEncryptFile 使用传统PKWARE加密把单个文件打包成zip，文件内容不压缩
+func ZipEncryptFile(srcPath, zipPath, entryName, password string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	// 加密头需要用到CRC32，先计算一遍
+	crc := crc32.NewIEEE()
+	if _, err = io.Copy(crc, src); err != nil {
+		return err
+	}
+	if _, err = src.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	dst, err := os.Create(zipPath)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	zw := zip.NewWriter(dst)
+	fh := &zip.FileHeader{
+		Name:               entryName,
+		Method:             zip.Store,
+		Flags:              0x1 | 0x800, // 加密、UTF-8文件名
+		CRC32:              crc.Sum32(),
+		CompressedSize64:   uint64(info.Size()) + 12,
+		UncompressedSize64: uint64(info.Size()),
+		Modified:           info.ModTime(),
+	}
+	w, err := zw.CreateRaw(fh)
+	if err != nil {
+		return err
+	}
+
+	zc := newZipCrypto(password)
+	header := make([]byte, 12)
+	rand.Read(header[:11])
+	header[11] = byte(fh.CRC32 >> 24)
+	zc.encrypt(header)
+	if _, err = w.Write(header); err != nil {
+		return err
+	}
+	buf := make([]byte, 256*1024)
+	for {
+		n, e := src.Read(buf)
+		if n > 0 {
+			zc.encrypt(buf[:n])
+			if _, err = w.Write(buf[:n]); err != nil {
+				return err
+			}
+		}
+		if e == io.EOF {
+			break
+		}
+		if e != nil {
+			return e
+		}
+	}
+	return zw.Close()
+}
+
+func newZipCrypto(password string) *zipCrypto {
+	zc := &zipCrypto{keys: [3]uint32{0x12345678, 0x23456789, 0x34567890}}
+	for _, b := range []byte(password) {
+		zc.update(b)
+	}
+	return zc
+}
+
+func crc32Update(crc uint32, b byte) uint32 {
+	return crc32.IEEETable[(crc^uint32(b))&0xff] ^ (crc >> 8)
+}
+
+func (zc *zipCrypto) update(b byte) {
+	zc.keys[0] = crc32Update(zc.keys[0], b)
+	zc.keys[1] = (zc.keys[1]+(zc.keys[0]&0xff))*134775813 + 1
+	zc.keys[2] = crc32Update(zc.keys[2], byte(zc.keys[1]>>24))
+}
+
+func (zc *zipCrypto) encrypt(data []byte) {
+	for i, b := range data {
+		t := (zc.keys[2] | 2) & 0xffff
+		data[i] = b ^ byte((t*(t^1))>>8)
+		zc.update(b)
+	}
+}
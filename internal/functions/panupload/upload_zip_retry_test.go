@@ -0,0 +1,34 @@
+package panupload
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
+)
+
+func TestIsUploadRejected(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("read file error"), false},
+		{apierror.NewApiError(apierror.ApiCodeForbidden, "forbidden"), true},
+		{fmt.Errorf("upload failed: %w", apierror.NewApiError(apierror.ApiCodeForbidden, "forbidden")), true},
+		{apierror.NewFailedApiError("request failed"), false},
+		{apierror.NewApiError(apierror.ApiCodeNetError, "timeout"), false},
+		{apierror.NewApiError(apierror.ApiCodeTooManyRequests, "too many requests"), false},
+		{apierror.NewApiError(apierror.ApiCodeBadGateway, "bad gateway"), false},
+		{apierror.NewApiError(apierror.ApiCodeTokenExpiredCode, "token expired"), false},
+		{apierror.NewApiError(apierror.ApiCodeBadRequest, "bad request"), false},
+		{apierror.NewApiError(apierror.ApiCodeInvalidResource, "folder"), false},
+		{apierror.NewApiError(apierror.ApiCodeUploadIdNotFound, "upload id"), false},
+	}
+	for _, c := range cases {
+		if got := IsUploadRejected(c.err); got != c.want {
+			t.Errorf("IsUploadRejected(%v) = %v, want %v", c.err, got, c.want)
+		}
+	}
+}
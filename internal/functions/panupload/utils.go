@@ -17,6 +17,8 @@ import (
 	"crypto/sha1"
 	"encoding/hex"
 	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/localfile"
+	"github.com/tickstep/aliyunpan/internal/utils"
 	"github.com/tickstep/library-go/converter"
 	"github.com/tickstep/library-go/logger"
 	"net/url"
@@ -39,6 +41,14 @@ const (
 	UploadingFileName = "aliyunpan_uploading.json"
 	// UploadingBackupFileName 上传文件上传状态的副本
 	UploadingBackupFileName = "aliyunpan_uploading.json.bak"
+	// UploadingBackupCount 上传文件上传状态保留的滚动备份份数
+	UploadingBackupCount = 3
+	// UploadingBackupInterval 上传文件上传状态滚动备份的最小间隔，打开后第一次保存时总是备份
+	UploadingBackupInterval = 10 * time.Minute
+	// UploadingMigrateFileName 旧版本上传状态迁移标记文件名
+	UploadingMigrateFileName = "aliyunpan_uploading.migrated"
+	// UploadingMigrateVersion 上传状态迁移版本，迁移过一次之后不再重复迁移
+	UploadingMigrateVersion = "1"
 )
 
 var (
@@ -61,7 +71,7 @@ func IsUrlExpired(urlStr string) bool {
 	}
 	expiredTimeSecStr := u.Query().Get("x-oss-expires")
 	expiredTimeSec, _ := strconv.ParseInt(expiredTimeSecStr, 10, 64)
-	if (expiredTimeSec - time.Now().Unix()) <= 300 { // 小于5分钟
+	if (expiredTimeSec - utils.ServerNow().Unix()) <= 300 { // 小于5分钟，使用补偿时钟偏差后的时间
 		// expired
 		return true
 	}
@@ -97,3 +107,12 @@ func CalcFilePreHash(filePath string) string {
 	hashCode := hex.EncodeToString(shaBytes)
 	return strings.ToUpper(hashCode)
 }
+
+// modTimeEqual 按照配置的容差比较文件修改时间，相差不超过 mtime_tolerance 秒视为没有修改
+func modTimeEqual(t1, t2 int64) bool {
+	tolerance := int64(config.DefaultModTimeTolerance)
+	if config.Config != nil {
+		tolerance = int64(config.Config.ModTimeTolerance)
+	}
+	return localfile.ModTimeEqual(t1, t2, tolerance)
+}
@@ -0,0 +1,387 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package panwalk 并发遍历网盘目录树的通用组件，支持并发度、请求频率限制、分页失败重试和断点续遍历
+package panwalk
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/functions"
+	"github.com/tickstep/library-go/logger"
+)
+
+const (
+	// DefaultParallel 默认同时遍历的目录数量
+	DefaultParallel = 3
+	// DefaultQPS 默认每秒最多请求文件列表的次数，每一页算一次请求
+	DefaultQPS = 5
+	// DefaultMaxRetry 默认获取文件列表失败的重试次数
+	DefaultMaxRetry = 2
+	// DefaultPageSize 默认每页获取的文件数量
+	DefaultPageSize = 100
+)
+
+var (
+	// SkipDir WalkFunc 对文件夹返回 SkipDir 时不再遍历该文件夹
+	SkipDir = errors.New("skip this directory")
+)
+
+type (
+	// WalkFunc 遍历到文件或者文件夹时的回调，file.Path 已设置为完整的网盘路径。
+	// 回调不会被并发调用，返回 SkipDir 以外的错误时停止遍历
+	WalkFunc func(file *aliyunpan.FileEntity) error
+
+	// ListPageFunc 获取一页文件列表
+	ListPageFunc func(param *aliyunpan.FileListParam) (*aliyunpan.FileListResult, *apierror.ApiError)
+
+	// Walker 网盘目录树遍历器，多个目录同时遍历，所有请求共用同一个频率限制。
+	// 同一个 Walker 可以被多个任务共用，例如下载时所有文件夹任务通过 ListFolder 获取文件列表
+	Walker struct {
+		driveId    string
+		listPage   ListPageFunc
+		parallel   int
+		maxRetry   int
+		pageSize   int
+		cursorPath string
+		limiter    *qpsLimiter
+	}
+
+	// walkFolder 等待遍历的文件夹，Marker 不为空代表该文件夹已经遍历了部分分页
+	walkFolder struct {
+		FileId string `json:"fileId"`
+		Path   string `json:"path"`
+		Marker string `json:"marker,omitempty"`
+	}
+
+	// walkCursor 断点续遍历的游标，记录还没有遍历完成的文件夹
+	walkCursor struct {
+		DriveId string        `json:"driveId"`
+		RootId  string        `json:"rootId"`
+		Pending []*walkFolder `json:"pending"`
+	}
+
+	// walkState 一次遍历的状态
+	walkState struct {
+		walker  *Walker
+		rootId  string
+		queue   []*walkFolder
+		pending map[string]*walkFolder // 排队和正在遍历的文件夹，文件夹ID => 文件夹
+		active  int
+		err     error
+		mutex   sync.Mutex
+		cond    *sync.Cond
+		fnMutex sync.Mutex
+	}
+
+	// qpsLimiter 请求频率限制，两次请求之间至少间隔 interval
+	qpsLimiter struct {
+		interval time.Duration
+		next     time.Time
+		mutex    sync.Mutex
+	}
+)
+
+// NewWalker 创建遍历器，使用默认的并发度和请求频率限制
+func NewWalker(panClient *config.PanClient, driveId string) *Walker {
+	w := &Walker{
+		driveId:  driveId,
+		listPage: panClient.OpenapiPanClient().FileList,
+		parallel: DefaultParallel,
+		maxRetry: DefaultMaxRetry,
+		pageSize: DefaultPageSize,
+	}
+	w.SetQPS(DefaultQPS)
+	return w
+}
+
+// SetListPageFunc 设置获取一页文件列表的函数
+func (w *Walker) SetListPageFunc(f ListPageFunc) {
+	w.listPage = f
+}
+
+// SetParallel 设置同时遍历的目录数量
+func (w *Walker) SetParallel(parallel int) {
+	if parallel < 1 {
+		parallel = 1
+	}
+	w.parallel = parallel
+}
+
+// SetQPS 设置每秒最多请求文件列表的次数，0代表不限制
+func (w *Walker) SetQPS(qps int) {
+	if qps <= 0 {
+		w.limiter = nil
+		return
+	}
+	w.limiter = &qpsLimiter{interval: time.Second / time.Duration(qps)}
+}
+
+// SetMaxRetry 设置获取文件列表失败的重试次数
+func (w *Walker) SetMaxRetry(maxRetry int) {
+	if maxRetry < 0 {
+		maxRetry = 0
+	}
+	w.maxRetry = maxRetry
+}
+
+// SetCursorFile 设置断点续遍历的游标文件，为空代表不记录。
+// 遍历中断后使用相同的游标文件再次遍历同一个目录时，从未完成的文件夹和分页继续，已经遍历的文件不再回调。
+// 中断时正在处理的分页会重新回调，遍历全部完成后游标文件自动删除
+func (w *Walker) SetCursorFile(cursorPath string) {
+	w.cursorPath = cursorPath
+}
+
+// wait 等待到可以发起下一次请求
+func (l *qpsLimiter) wait() {
+	if l == nil {
+		return
+	}
+	l.mutex.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mutex.Unlock()
+	time.Sleep(wait)
+}
+
+// listPageWithRetry 获取一页文件列表，失败时重试，限流错误等待更长的时间
+func (w *Walker) listPageWithRetry(param *aliyunpan.FileListParam) (*aliyunpan.FileListResult, error) {
+	for retry := 0; ; retry++ {
+		w.limiter.wait()
+		result, apierr := w.listPage(param)
+		if apierr == nil && result != nil {
+			return result, nil
+		}
+		var err error = apierror.NewFailedApiError("获取文件列表失败")
+		if apierr != nil {
+			err = apierr
+		}
+		if retry >= w.maxRetry {
+			return nil, err
+		}
+		wait := time.Duration(retry+1) * 3 * time.Second
+		if functions.ClassifyRiskError(err) == functions.RiskRateLimited {
+			wait *= 3
+		}
+		logger.Verbosef("list folder %s error: %s, retry %d/%d after %s\n", param.ParentFileId, err, retry+1, w.maxRetry, wait)
+		time.Sleep(wait)
+	}
+}
+
+// ListFolder 获取文件夹下的所有文件，分页获取，受请求频率限制
+func (w *Walker) ListFolder(folderId string) (aliyunpan.FileList, error) {
+	param := &aliyunpan.FileListParam{
+		DriveId:      w.driveId,
+		ParentFileId: folderId,
+		Limit:        w.pageSize,
+	}
+	fileList := aliyunpan.FileList{}
+	for {
+		result, err := w.listPageWithRetry(param)
+		if err != nil {
+			return nil, err
+		}
+		fileList = append(fileList, result.FileList...)
+		if result.NextMarker == "" {
+			return fileList, nil
+		}
+		param.Marker = result.NextMarker
+	}
+}
+
+// Walk 并发遍历文件夹下的所有文件和文件夹，不包括 root 本身。root.Path 需要设置为完整的网盘路径
+func (w *Walker) Walk(root *aliyunpan.FileEntity, fn WalkFunc) error {
+	st := &walkState{
+		walker:  w,
+		rootId:  root.FileId,
+		pending: map[string]*walkFolder{},
+	}
+	st.cond = sync.NewCond(&st.mutex)
+	if cursor := w.loadCursor(root.FileId); cursor != nil {
+		logger.Verbosef("resume walking %s, pending folders: %d\n", root.Path, len(cursor.Pending))
+		for _, f := range cursor.Pending {
+			st.add(f)
+		}
+	} else {
+		st.add(&walkFolder{FileId: root.FileId, Path: root.Path})
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < w.parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				folder := st.next()
+				if folder == nil {
+					return
+				}
+				st.finish(folder, st.walkFolder(folder, fn))
+			}
+		}()
+	}
+	wg.Wait()
+
+	if st.err == nil && w.cursorPath != "" {
+		os.Remove(w.cursorPath)
+	}
+	return st.err
+}
+
+// walkFolder 分页遍历一个文件夹，每一页处理完成后保存游标
+func (st *walkState) walkFolder(folder *walkFolder, fn WalkFunc) error {
+	param := &aliyunpan.FileListParam{
+		DriveId:      st.walker.driveId,
+		ParentFileId: folder.FileId,
+		Limit:        st.walker.pageSize,
+		Marker:       folder.Marker,
+	}
+	for {
+		result, err := st.walker.listPageWithRetry(param)
+		if err != nil {
+			return err
+		}
+		for _, f := range result.FileList {
+			f.Path = path.Join(folder.Path, f.FileName)
+			st.fnMutex.Lock()
+			e := fn(f)
+			st.fnMutex.Unlock()
+			if e == SkipDir && f.IsFolder() {
+				continue
+			}
+			if e != nil && e != SkipDir {
+				return e
+			}
+			if f.IsFolder() {
+				st.add(&walkFolder{FileId: f.FileId, Path: f.Path})
+			}
+		}
+		if result.NextMarker == "" {
+			return nil
+		}
+		param.Marker = result.NextMarker
+		st.mutex.Lock()
+		folder.Marker = result.NextMarker
+		st.saveCursor()
+		st.mutex.Unlock()
+	}
+}
+
+// add 加入等待遍历的文件夹
+func (st *walkState) add(folder *walkFolder) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	if _, ok := st.pending[folder.FileId]; ok {
+		// 断点续遍历时重新处理的分页会再次加入已经在游标中的文件夹
+		return
+	}
+	st.queue = append(st.queue, folder)
+	st.pending[folder.FileId] = folder
+	st.cond.Signal()
+}
+
+// next 获取下一个等待遍历的文件夹，全部遍历完成或者出错时返回nil
+func (st *walkState) next() *walkFolder {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	for len(st.queue) == 0 && st.active > 0 && st.err == nil {
+		st.cond.Wait()
+	}
+	if len(st.queue) == 0 || st.err != nil {
+		return nil
+	}
+	folder := st.queue[0]
+	st.queue = st.queue[1:]
+	st.active++
+	return folder
+}
+
+// finish 文件夹遍历结束，成功时从游标中移除
+func (st *walkState) finish(folder *walkFolder, err error) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	st.active--
+	if err != nil {
+		if st.err == nil {
+			st.err = err
+		}
+	} else {
+		delete(st.pending, folder.FileId)
+	}
+	st.saveCursor()
+	st.cond.Broadcast()
+}
+
+// saveCursor 保存游标，先写入临时文件再重命名。调用方需要持有锁
+func (st *walkState) saveCursor() {
+	if st.walker.cursorPath == "" {
+		return
+	}
+	cursor := &walkCursor{
+		DriveId: st.walker.driveId,
+		RootId:  st.rootId,
+		Pending: make([]*walkFolder, 0, len(st.pending)),
+	}
+	for _, f := range st.pending {
+		cursor.Pending = append(cursor.Pending, &walkFolder{FileId: f.FileId, Path: f.Path, Marker: f.Marker})
+	}
+	sort.Slice(cursor.Pending, func(i, j int) bool {
+		return cursor.Pending[i].Path < cursor.Pending[j].Path
+	})
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return
+	}
+	tmpPath := st.walker.cursorPath + ".tmp"
+	if err = os.WriteFile(tmpPath, data, 0644); err != nil {
+		logger.Verbosef("save walk cursor error: %s\n", err)
+		return
+	}
+	if err = os.Rename(tmpPath, st.walker.cursorPath); err != nil {
+		logger.Verbosef("save walk cursor error: %s\n", err)
+	}
+}
+
+// loadCursor 读取游标，游标不属于本次遍历的目录时忽略
+func (w *Walker) loadCursor(rootId string) *walkCursor {
+	if w.cursorPath == "" {
+		return nil
+	}
+	data, err := os.ReadFile(w.cursorPath)
+	if err != nil {
+		return nil
+	}
+	cursor := &walkCursor{}
+	if err = json.Unmarshal(data, cursor); err != nil {
+		logger.Verbosef("parse walk cursor error: %s\n", err)
+		return nil
+	}
+	if cursor.DriveId != w.driveId || cursor.RootId != rootId || len(cursor.Pending) == 0 {
+		return nil
+	}
+	return cursor
+}
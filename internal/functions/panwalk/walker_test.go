@@ -0,0 +1,212 @@
+package panwalk
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
+)
+
+// fakeTree 内存中的网盘目录树，文件夹ID => 文件列表
+type fakeTree struct {
+	folders map[string]aliyunpan.FileList
+	failed  map[string]bool // 获取文件列表失败的文件夹
+	calls   int
+	mutex   sync.Mutex
+}
+
+func newFakeTree() *fakeTree {
+	file := func(name string) *aliyunpan.FileEntity {
+		return &aliyunpan.FileEntity{FileId: name, FileName: name, FileType: "file"}
+	}
+	folder := func(name string) *aliyunpan.FileEntity {
+		return &aliyunpan.FileEntity{FileId: name, FileName: name, FileType: "folder"}
+	}
+	return &fakeTree{
+		folders: map[string]aliyunpan.FileList{
+			"root": {file("a.txt"), folder("docs"), folder("skip"), file("b.txt")},
+			"docs": {file("c.txt"), folder("sub")},
+			"sub":  {file("d.txt")},
+			"skip": {file("e.txt")},
+		},
+		failed: map[string]bool{},
+	}
+}
+
+// listPage 分页获取文件列表，Marker 为下一页第一个文件的序号
+func (ft *fakeTree) listPage(param *aliyunpan.FileListParam) (*aliyunpan.FileListResult, *apierror.ApiError) {
+	ft.mutex.Lock()
+	defer ft.mutex.Unlock()
+	ft.calls++
+	if ft.failed[param.ParentFileId] {
+		return nil, apierror.NewFailedApiError("list failed")
+	}
+	files := ft.folders[param.ParentFileId]
+	start, _ := strconv.Atoi(param.Marker)
+	end := start + param.Limit
+	result := &aliyunpan.FileListResult{}
+	if end < len(files) {
+		result.NextMarker = strconv.Itoa(end)
+	} else {
+		end = len(files)
+	}
+	// 每次返回新的对象，和真实的接口一样
+	for _, f := range files[start:end] {
+		c := *f
+		result.FileList = append(result.FileList, &c)
+	}
+	return result, nil
+}
+
+func newTestWalker(ft *fakeTree, parallel int) *Walker {
+	w := &Walker{driveId: "d1", pageSize: 2}
+	w.SetListPageFunc(ft.listPage)
+	w.SetParallel(parallel)
+	w.SetQPS(0)
+	w.SetMaxRetry(0)
+	return w
+}
+
+// walkPaths 遍历并返回排序后的路径
+func walkPaths(w *Walker, fn func(file *aliyunpan.FileEntity) error) ([]string, error) {
+	paths := []string{}
+	err := w.Walk(&aliyunpan.FileEntity{FileId: "root", Path: "/r"}, func(file *aliyunpan.FileEntity) error {
+		paths = append(paths, file.Path)
+		if fn != nil {
+			return fn(file)
+		}
+		return nil
+	})
+	sort.Strings(paths)
+	return paths, err
+}
+
+func TestWalkerWalk(t *testing.T) {
+	all := []string{"/r/a.txt", "/r/b.txt", "/r/docs", "/r/docs/c.txt", "/r/docs/sub", "/r/docs/sub/d.txt", "/r/skip", "/r/skip/e.txt"}
+	stop := errors.New("stop")
+	cases := []struct {
+		name     string
+		parallel int
+		failed   string
+		fn       func(file *aliyunpan.FileEntity) error
+		want     []string
+		err      bool
+	}{
+		{"单个并发", 1, "", nil, all, false},
+		{"多个并发", 3, "", nil, all, false},
+		{"跳过文件夹", 2, "", func(file *aliyunpan.FileEntity) error {
+			if file.FileName == "skip" {
+				return SkipDir
+			}
+			return nil
+		}, []string{"/r/a.txt", "/r/b.txt", "/r/docs", "/r/docs/c.txt", "/r/docs/sub", "/r/docs/sub/d.txt", "/r/skip"}, false},
+		{"文件返回SkipDir照常遍历", 1, "", func(file *aliyunpan.FileEntity) error {
+			if file.FileName == "a.txt" {
+				return SkipDir
+			}
+			return nil
+		}, all, false},
+		{"回调出错停止遍历", 1, "", func(file *aliyunpan.FileEntity) error {
+			if file.FileName == "b.txt" {
+				return stop
+			}
+			return nil
+		}, []string{"/r/a.txt", "/r/b.txt", "/r/docs", "/r/skip"}, true},
+		{"获取文件列表失败", 1, "docs", nil, []string{"/r/a.txt", "/r/b.txt", "/r/docs", "/r/skip"}, true},
+	}
+	for _, c := range cases {
+		ft := newFakeTree()
+		if c.failed != "" {
+			ft.failed[c.failed] = true
+		}
+		got, err := walkPaths(newTestWalker(ft, c.parallel), c.fn)
+		if (err != nil) != c.err {
+			t.Errorf("%s: error %v", c.name, err)
+		}
+		if strings.Join(got, ",") != strings.Join(c.want, ",") {
+			t.Errorf("%s: paths %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestWalkerListFolder(t *testing.T) {
+	ft := newFakeTree()
+	files, err := newTestWalker(ft, 1).ListFolder("root")
+	if err != nil || len(files) != 4 || files[3].FileName != "b.txt" {
+		t.Fatalf("files %v, error %v", files, err)
+	}
+	if ft.calls != 2 {
+		t.Fatalf("list page calls %d", ft.calls)
+	}
+	ft.failed["docs"] = true
+	if _, err = newTestWalker(ft, 1).ListFolder("docs"); err == nil {
+		t.Fatal("expect list error")
+	}
+}
+
+func TestWalkerResume(t *testing.T) {
+	cursorPath := filepath.Join(t.TempDir(), "cursor.json")
+	ft := newFakeTree()
+	w := newTestWalker(ft, 1)
+	w.SetCursorFile(cursorPath)
+	_, err := walkPaths(w, func(file *aliyunpan.FileEntity) error {
+		if file.FileName == "b.txt" {
+			return errors.New("interrupted")
+		}
+		return nil
+	})
+	if err == nil {
+		t.Fatal("expect interrupted error")
+	}
+	if _, err = os.Stat(cursorPath); err != nil {
+		t.Fatal("cursor should be saved after interrupted")
+	}
+
+	// 其他目录不使用游标
+	if cursor := w.loadCursor("docs"); cursor != nil {
+		t.Fatal("cursor of other root should be ignored")
+	}
+
+	// 从中断的分页继续，已经遍历的第一页不再回调
+	got, err := walkPaths(w, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/r/b.txt", "/r/docs/c.txt", "/r/docs/sub", "/r/docs/sub/d.txt", "/r/skip", "/r/skip/e.txt"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("resumed paths %v, want %v", got, want)
+	}
+	if _, err = os.Stat(cursorPath); !os.IsNotExist(err) {
+		t.Fatal("cursor should be removed after walk finished")
+	}
+}
+
+func TestQpsLimiter(t *testing.T) {
+	w := &Walker{}
+	cases := []struct {
+		qps     int
+		enabled bool
+	}{
+		{0, false},
+		{-1, false},
+		{10, true},
+	}
+	for _, c := range cases {
+		w.SetQPS(c.qps)
+		if (w.limiter != nil) != c.enabled {
+			t.Errorf("qps %d: limiter %v", c.qps, w.limiter)
+		}
+	}
+	w.SetParallel(0)
+	w.SetMaxRetry(-1)
+	if w.parallel != 1 || w.maxRetry != 0 {
+		t.Fatalf("parallel %d, max retry %d", w.parallel, w.maxRetry)
+	}
+}
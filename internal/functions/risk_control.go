@@ -0,0 +1,248 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package functions
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
+	"github.com/tickstep/aliyunpan/internal/metrics"
+	"github.com/tickstep/aliyunpan/internal/taskframework"
+)
+
+type (
+	// RiskKind 账号风控错误类型
+	RiskKind string
+
+	// RiskAdvice 风控错误的友好提示
+	RiskAdvice struct {
+		Reason     string        // 原因
+		Suggestion string        // 处理建议
+		Wait       time.Duration // 建议等待的时间，0代表等待无法恢复
+		Relogin    bool          // 是否需要重新登录
+	}
+
+	// RiskGuard 检测一批任务中的风控错误，连续出现风控错误时暂停或者停止执行器，避免海量失败
+	RiskGuard struct {
+		executor   *taskframework.TaskExecutor
+		threshold  int
+		pauseWait  time.Duration
+		streakKind RiskKind
+		streak     int
+		counts     map[RiskKind]int
+		mutex      sync.Mutex
+	}
+)
+
+const (
+	// RiskNone 不是风控错误
+	RiskNone RiskKind = ""
+	// RiskRateLimited 请求太频繁被限流
+	RiskRateLimited RiskKind = "rate_limited"
+	// RiskNeedRelogin 登录已失效
+	RiskNeedRelogin RiskKind = "need_relogin"
+	// RiskDeviceOffline 登录设备数量超出限制
+	RiskDeviceOffline RiskKind = "device_offline"
+	// RiskDayFlowLimited 当日流量超出限制
+	RiskDayFlowLimited RiskKind = "day_flow_limited"
+	// RiskForbidden 账号没有权限，可能被封禁
+	RiskForbidden RiskKind = "forbidden"
+
+	// RiskGuardThreshold 连续出现同一类风控错误的次数达到该值时暂停或者停止任务
+	RiskGuardThreshold = 5
+	// riskPauseWaitMin 限流时首次暂停的时间，之后每次翻倍
+	riskPauseWaitMin = 1 * time.Minute
+	// riskPauseWaitMax 限流时最长暂停的时间
+	riskPauseWaitMax = 10 * time.Minute
+)
+
+var (
+	riskAdvices = map[RiskKind]*RiskAdvice{
+		RiskRateLimited: {
+			Reason:     "请求太频繁，已被阿里云盘临时限流",
+			Suggestion: "建议等待5~10分钟后重试，或者降低并发数量",
+			Wait:       5 * time.Minute,
+		},
+		RiskNeedRelogin: {
+			Reason:     "登录已失效",
+			Suggestion: "请使用 login 命令重新登录",
+			Relogin:    true,
+		},
+		RiskDeviceOffline: {
+			Reason:     "账号登录的设备数量超出限制",
+			Suggestion: "请在阿里云盘App中下线一台设备，然后重新登录",
+			Relogin:    true,
+		},
+		RiskDayFlowLimited: {
+			Reason:     "账号当日流量已超出限制",
+			Suggestion: "请明天再试",
+			Wait:       24 * time.Hour,
+		},
+		RiskForbidden: {
+			Reason:     "账号没有访问权限，可能被风控或者封禁",
+			Suggestion: "请登录阿里云盘App或者网页版确认账号状态，解除限制后再试",
+		},
+	}
+	riskKindNames = map[RiskKind]string{
+		RiskRateLimited:    "限流",
+		RiskNeedRelogin:    "登录失效",
+		RiskDeviceOffline:  "设备超限",
+		RiskDayFlowLimited: "流量超限",
+		RiskForbidden:      "无权限",
+	}
+)
+
+// ClassifyRiskError 判断错误是否是风控相关的错误
+func ClassifyRiskError(err error) RiskKind {
+	var apiErr *apierror.ApiError
+	if err == nil || !errors.As(err, &apiErr) || apiErr == nil {
+		return RiskNone
+	}
+	switch apiErr.Code {
+	case apierror.ApiCodeTooManyRequests, apierror.ApiCodeBadGateway:
+		return RiskRateLimited
+	case apierror.ApiCodeTokenExpiredCode, apierror.ApiCodeAccessTokenInvalid, apierror.ApiCodeRefreshTokenExpiredCode,
+		apierror.ApiCodeDeviceSessionSignatureInvalid:
+		return RiskNeedRelogin
+	case apierror.ApiCodeUserDeviceOffline:
+		return RiskDeviceOffline
+	case apierror.ApiCodeUserDayFlowOverLimited:
+		return RiskDayFlowLimited
+	case apierror.ApiCodeForbidden, apierror.ApiCodeUserNotAllowedAccessDrive:
+		return RiskForbidden
+	}
+	return RiskNone
+}
+
+// GetRiskAdvice 获取风控错误的友好提示，不是风控错误返回nil
+func GetRiskAdvice(kind RiskKind) *RiskAdvice {
+	return riskAdvices[kind]
+}
+
+func (a *RiskAdvice) String() string {
+	s := a.Reason + "，" + a.Suggestion
+	if a.Wait > 0 && a.Wait < 24*time.Hour {
+		s += fmt.Sprintf("（建议等待 %s）", a.Wait)
+	}
+	return s
+}
+
+// CheckAccountRisk 检查启动时接口返回的错误是否是风控错误，是则输出友好提示。返回是否需要终止本次任务
+func CheckAccountRisk(err error) bool {
+	kind := ClassifyRiskError(err)
+	advice := GetRiskAdvice(kind)
+	if advice == nil {
+		return false
+	}
+	fmt.Printf("警告: 检测到账号异常, %s\n", advice)
+	// 限流可以等待恢复，其他情况继续执行只会大量失败
+	return kind != RiskRateLimited
+}
+
+// NewRiskGuard 创建风控检测，设置到执行器的结果回调中
+func NewRiskGuard(executor *taskframework.TaskExecutor) *RiskGuard {
+	g := &RiskGuard{
+		executor:  executor,
+		threshold: RiskGuardThreshold,
+		pauseWait: riskPauseWaitMin,
+		counts:    map[RiskKind]int{},
+	}
+	executor.ResultHook = g.Observe
+	return g
+}
+
+// Observe 统计任务执行结果，连续出现同一类风控错误时，限流暂停执行器一段时间，其他风控错误停止执行器
+func (g *RiskGuard) Observe(result *taskframework.TaskUnitRunResult) {
+	kind := RiskNone
+	if !result.Succeed && !result.Cancel {
+		kind = ClassifyRiskError(result.Err)
+		metrics.CountApiError(result.Err)
+	}
+
+	g.mutex.Lock()
+	if kind == RiskNone {
+		g.streakKind, g.streak = RiskNone, 0
+		g.mutex.Unlock()
+		return
+	}
+	g.counts[kind]++
+	if kind == g.streakKind {
+		g.streak++
+	} else {
+		g.streakKind, g.streak = kind, 1
+	}
+	if g.streak < g.threshold {
+		g.mutex.Unlock()
+		return
+	}
+	g.streak = 0
+	wait := g.pauseWait
+	if kind == RiskRateLimited {
+		g.pauseWait *= 2
+		if g.pauseWait > riskPauseWaitMax {
+			g.pauseWait = riskPauseWaitMax
+		}
+	}
+	g.mutex.Unlock()
+
+	advice := GetRiskAdvice(kind)
+	if kind == RiskRateLimited {
+		// 已经暂停时不处理，避免恢复用户手动暂停的任务
+		seq, ok := g.executor.TryPause()
+		if !ok {
+			return
+		}
+		fmt.Printf("\n警告: 连续 %d 次请求失败, %s。暂停开始新的任务 %s 后自动继续\n", g.threshold, advice.Reason, wait)
+		go func() {
+			time.Sleep(wait)
+			// 暂停期间用户手动暂停或者恢复过的，由用户决定何时继续
+			if g.executor.ResumePaused(seq) {
+				fmt.Printf("\n风控暂停结束，继续执行任务\n")
+			}
+		}()
+		return
+	}
+	if g.executor.IsStopped() {
+		return
+	}
+	fmt.Printf("\n警告: 连续 %d 次请求失败, %s。已停止执行剩余的任务, %s\n", g.threshold, advice.Reason, advice.Suggestion)
+	g.executor.Stop()
+}
+
+// Summary 风控错误统计，没有风控错误返回空字符串
+func (g *RiskGuard) Summary() string {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if len(g.counts) == 0 {
+		return ""
+	}
+	kinds := make([]string, 0, len(g.counts))
+	for kind := range g.counts {
+		kinds = append(kinds, string(kind))
+	}
+	sort.Strings(kinds)
+	items := make([]string, 0, len(kinds))
+	suggestions := make([]string, 0, len(kinds))
+	for _, k := range kinds {
+		kind := RiskKind(k)
+		items = append(items, fmt.Sprintf("%s %d 次", riskKindNames[kind], g.counts[kind]))
+		suggestions = append(suggestions, GetRiskAdvice(kind).String())
+	}
+	return fmt.Sprintf("风控相关错误: %s\n%s", strings.Join(items, ", "), strings.Join(suggestions, "\n"))
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package functions
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan_open/openapi"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/utils"
+	"github.com/tickstep/library-go/logger"
+)
+
+var (
+	calibrateServerTimeOnce sync.Once
+	clockSkewWarnOnce       sync.Once
+)
+
+// CalibrateServerTime 和服务器校准一次时间，之后判断上传、下载链接是否过期会自动补偿本地时钟偏差
+func CalibrateServerTime() {
+	calibrateServerTimeOnce.Do(func() {
+		client := config.Config.HTTPClient("")
+		client.SetTimeout(10 * time.Second)
+		requestStart := time.Now()
+		resp, err := client.Req(http.MethodHead, openapi.OPENAPI_URL, nil, nil)
+		if err != nil {
+			logger.Verboseln("calibrate server time error: ", err)
+			return
+		}
+		defer resp.Body.Close()
+		if utils.UpdateServerTimeByHeader(resp.Header, requestStart) {
+			logger.Verbosef("server time offset: %s\n", utils.ServerTimeOffset())
+		}
+		WarnClockSkew()
+	})
+}
+
+// WarnClockSkew 时钟偏差过大时提示用户校准系统时间，只提示一次
+func WarnClockSkew() {
+	tip := utils.ClockSkewTip()
+	if tip == "" {
+		return
+	}
+	clockSkewWarnOnce.Do(func() {
+		fmt.Printf("\n警告: %s\n", tip)
+	})
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package functions
+
+import (
+	"sort"
+	"sync"
+)
+
+const (
+	// DefaultSpeedWindowSize 默认速度滑动窗口大小，单位：秒
+	DefaultSpeedWindowSize = 5
+)
+
+type (
+	// SpeedStat 速度统计，每秒采样一次。支持滑动窗口平均速度以及平均/峰值/P95速度汇总
+	SpeedStat struct {
+		windowSize int
+		window     []int64 // 滑动窗口环形缓冲区
+		windowPos  int
+		windowLen  int
+		samples    []int64 // 全部有效采样，用于汇总统计
+		series     []int64 // 全部采样（包括速度为0的采样），用于绘制速度曲线
+		mutex      sync.Mutex
+	}
+)
+
+// NewSpeedStat 创建速度统计，windowSize 为滑动窗口大小，即采样个数
+func NewSpeedStat(windowSize int) *SpeedStat {
+	if windowSize <= 0 {
+		windowSize = DefaultSpeedWindowSize
+	}
+	return &SpeedStat{
+		windowSize: windowSize,
+		window:     make([]int64, windowSize),
+	}
+}
+
+// Add 增加一个速度采样，单位 B/s
+func (s *SpeedStat) Add(speed int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.window[s.windowPos] = speed
+	s.windowPos = (s.windowPos + 1) % s.windowSize
+	if s.windowLen < s.windowSize {
+		s.windowLen += 1
+	}
+	s.series = append(s.series, speed)
+	if speed > 0 {
+		// 速度为0的采样一般是在计算SHA1或者等待，不计入汇总统计
+		s.samples = append(s.samples, speed)
+	}
+}
+
+// Series 全部采样，每秒一个
+func (s *SpeedStat) Series() []int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	series := make([]int64, len(s.series))
+	copy(series, s.series)
+	return series
+}
+
+// WindowAverage 滑动窗口平均速度
+func (s *SpeedStat) WindowAverage() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.windowLen == 0 {
+		return 0
+	}
+	var sum int64
+	for i := 0; i < s.windowLen; i++ {
+		sum += s.window[i]
+	}
+	return sum / int64(s.windowLen)
+}
+
+// Average 平均速度
+func (s *SpeedStat) Average() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.samples) == 0 {
+		return 0
+	}
+	var sum int64
+	for _, v := range s.samples {
+		sum += v
+	}
+	return sum / int64(len(s.samples))
+}
+
+// Peak 峰值速度
+func (s *SpeedStat) Peak() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var peak int64
+	for _, v := range s.samples {
+		if v > peak {
+			peak = v
+		}
+	}
+	return peak
+}
+
+// Percentile 百分位速度，例如 p=95 返回P95速度
+func (s *SpeedStat) Percentile(p float64) int64 {
+	s.mutex.Lock()
+	sorted := make([]int64, len(s.samples))
+	copy(sorted, s.samples)
+	s.mutex.Unlock()
+	if len(sorted) == 0 {
+		return 0
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	idx := int(float64(len(sorted))*p/100+0.5) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
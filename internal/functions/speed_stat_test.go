@@ -0,0 +1,62 @@
+package functions
+
+import "testing"
+
+func TestSpeedStatWindowAverage(t *testing.T) {
+	s := NewSpeedStat(3)
+	if s.WindowAverage() != 0 {
+		t.Fatal("empty window average should be 0")
+	}
+	s.Add(30)
+	if v := s.WindowAverage(); v != 30 {
+		t.Fatalf("window average %d", v)
+	}
+	for _, v := range []int64{60, 90, 120} {
+		s.Add(v)
+	}
+	// 窗口只保留最近3个采样：60 90 120
+	if v := s.WindowAverage(); v != 90 {
+		t.Fatalf("window average %d", v)
+	}
+
+	// 未指定窗口大小时使用默认值
+	if d := NewSpeedStat(0); d.windowSize != DefaultSpeedWindowSize {
+		t.Fatalf("default window size %d", d.windowSize)
+	}
+}
+
+func TestSpeedStatSummary(t *testing.T) {
+	s := NewSpeedStat(5)
+	for _, v := range []int64{0, 10, 20, 0, 30, 40, 50, 60, 70, 80, 90, 100} {
+		s.Add(v)
+	}
+	// 速度为0的采样不计入汇总，但保留在速度曲线中
+	if n := len(s.Series()); n != 12 {
+		t.Fatalf("series len %d", n)
+	}
+	if v := s.Average(); v != 55 {
+		t.Fatalf("average %d", v)
+	}
+	if v := s.Peak(); v != 100 {
+		t.Fatalf("peak %d", v)
+	}
+	cases := []struct {
+		p    float64
+		want int64
+	}{
+		{95, 100},
+		{50, 50},
+		{0, 10},
+		{100, 100},
+	}
+	for _, c := range cases {
+		if v := s.Percentile(c.p); v != c.want {
+			t.Errorf("P%v = %d, want %d", c.p, v, c.want)
+		}
+	}
+
+	empty := NewSpeedStat(5)
+	if empty.Average() != 0 || empty.Peak() != 0 || empty.Percentile(95) != 0 {
+		t.Fatal("empty stat should be 0")
+	}
+}
@@ -14,14 +14,35 @@
 package functions
 
 import (
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
+const (
+	// FileResultSucceed 传输成功
+	FileResultSucceed = "succeed"
+	// FileResultFailed 传输失败
+	FileResultFailed = "failed"
+	// FileResultSkipped 目标已存在相同的文件，跳过传输
+	FileResultSkipped = "skipped"
+)
+
 type (
 	Statistic struct {
-		totalSize int64
-		startTime time.Time
+		totalSize   int64
+		startTime   time.Time
+		fileResults []*FileResult
+		resultMutex sync.Mutex
+	}
+
+	// FileResult 单个文件的传输结果，用于JSON输出
+	FileResult struct {
+		Path   string `json:"path"`            // 源文件路径
+		Target string `json:"target"`          // 目标路径
+		Size   int64  `json:"size"`            // 文件大小，单位：字节
+		Status string `json:"status"`          // 传输结果 succeed/failed/skipped
+		Error  string `json:"error,omitempty"` // 失败原因
 	}
 )
 
@@ -40,3 +61,17 @@ func (s *Statistic) StartTimer() {
 func (s *Statistic) Elapsed() time.Duration {
 	return time.Now().Sub(s.startTime)
 }
+
+// AddFileResult 记录单个文件的传输结果
+func (s *Statistic) AddFileResult(result *FileResult) {
+	s.resultMutex.Lock()
+	defer s.resultMutex.Unlock()
+	s.fileResults = append(s.fileResults, result)
+}
+
+// FileResults 所有文件的传输结果
+func (s *Statistic) FileResults() []*FileResult {
+	s.resultMutex.Lock()
+	defer s.resultMutex.Unlock()
+	return append([]*FileResult{}, s.fileResults...)
+}
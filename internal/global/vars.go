@@ -9,4 +9,10 @@ var (
 
 	// IsSupportNoneOpenApiCommands 是否开启非OpenAPI的命令
 	IsSupportNoneOpenApiCommands = false
+
+	// IsJsonOutput 是否以JSON格式输出命令结果
+	IsJsonOutput = false
+
+	// CommandUser 通过 --user 指定的本次运行使用的账号
+	CommandUser = ""
 )
@@ -21,4 +21,5 @@ var (
 	ErrFileIsNil            = errors.New("file is nil")
 	ErrChecksumWriteStop    = errors.New("checksum write stop")
 	ErrChecksumWriteAllStop = errors.New("checksum write all stop")
+	ErrStreamSha1NoReader   = errors.New("stream sha1 reader is nil")
 )
@@ -41,6 +41,19 @@ func (lfm *LocalFileMeta) EqualLengthSHA1(m *LocalFileMeta) bool {
 	return true
 }
 
+// ModTimeEqual 检测文件修改时间(Unix时间戳，单位：秒)是否相同，相差不超过tolerance秒视为相同。
+// FAT/exFAT等文件系统的修改时间精度只有2秒，精确比较会把没有修改的文件误判为已修改
+func ModTimeEqual(t1, t2, tolerance int64) bool {
+	d := t1 - t2
+	if d < 0 {
+		d = -d
+	}
+	if tolerance < 0 {
+		tolerance = 0
+	}
+	return d <= tolerance
+}
+
 // CompleteAbsPath 补齐绝对路径
 func (lfm *LocalFileMeta) CompleteAbsPath() {
 	if filepath.IsAbs(lfm.Path.LogicPath) {
@@ -0,0 +1,9 @@
+//go:build !windows
+// +build !windows
+
+package localfile
+
+// hasHiddenAttribute 非Windows系统没有隐藏属性，只以文件名判断
+func hasHiddenAttribute(filePath string) bool {
+	return false
+}
@@ -0,0 +1,19 @@
+//go:build windows
+// +build windows
+
+package localfile
+
+import "syscall"
+
+// hasHiddenAttribute 文件是否设置了Windows隐藏属性
+func hasHiddenAttribute(filePath string) bool {
+	p, err := syscall.UTF16PtrFromString(filePath)
+	if err != nil {
+		return false
+	}
+	attrs, err := syscall.GetFileAttributes(p)
+	if err != nil {
+		return false
+	}
+	return attrs&syscall.FILE_ATTRIBUTE_HIDDEN != 0
+}
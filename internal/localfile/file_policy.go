@@ -0,0 +1,163 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package localfile
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type (
+	// SymlinkPolicy 软链接处理策略
+	SymlinkPolicy string
+
+	// SymlinkManifestItem 软链接清单记录
+	SymlinkManifestItem struct {
+		// Path 软链接的路径，上传时为网盘路径，同步时为本地路径
+		Path string `json:"path"`
+		// Target 软链接指向的目标，即链接本身保存的内容
+		Target string `json:"target"`
+	}
+
+	// SymlinkManifest 软链接清单，manifest 策略下不上传软链接指向的内容，而是把链接记录到清单文件中，需要时可以据此重建软链接
+	SymlinkManifest struct {
+		items map[string]string
+		mutex sync.Mutex
+	}
+)
+
+const (
+	// SymlinkSkip 跳过软链接
+	SymlinkSkip SymlinkPolicy = "skip"
+	// SymlinkFollow 跟随软链接，按照链接指向的文件或者文件夹处理
+	SymlinkFollow SymlinkPolicy = "follow"
+	// SymlinkManifestPolicy 不跟随软链接，把软链接记录到清单文件
+	SymlinkManifestPolicy SymlinkPolicy = "manifest"
+
+	// SymlinkManifestFileName 软链接清单文件名称
+	SymlinkManifestFileName = ".aliyunpan-symlinks.json"
+)
+
+// ParseSymlinkPolicy 解析软链接处理策略，为空时返回defaultPolicy
+func ParseSymlinkPolicy(s string, defaultPolicy SymlinkPolicy) (SymlinkPolicy, error) {
+	switch SymlinkPolicy(strings.ToLower(strings.TrimSpace(s))) {
+	case "":
+		return defaultPolicy, nil
+	case SymlinkSkip:
+		return SymlinkSkip, nil
+	case SymlinkFollow:
+		return SymlinkFollow, nil
+	case SymlinkManifestPolicy:
+		return SymlinkManifestPolicy, nil
+	}
+	return defaultPolicy, fmt.Errorf("软链接处理策略错误: %s, 可选值: skip, follow, manifest", s)
+}
+
+// IsSymlink 文件本身是否是软链接，不跟随软链接
+func IsSymlink(filePath string) bool {
+	info, err := os.Lstat(filePath)
+	return err == nil && info.Mode()&os.ModeSymlink != 0
+}
+
+// ReadSymlink 读取软链接指向的目标，统一使用"/"分隔符
+func ReadSymlink(filePath string) string {
+	target, err := os.Readlink(filePath)
+	if err != nil {
+		return ""
+	}
+	return strings.ReplaceAll(target, "\\", "/")
+}
+
+// IsHiddenFile 是否是隐藏文件，包括以"."开头的文件，以及Windows设置了隐藏属性的文件
+func IsHiddenFile(filePath string) bool {
+	name := path.Base(strings.ReplaceAll(filePath, "\\", "/"))
+	if strings.HasPrefix(name, ".") && name != "." && name != ".." {
+		return true
+	}
+	return hasHiddenAttribute(filePath)
+}
+
+// SpecialFileType 特殊文件的类型，包括socket、设备文件、命名管道等无法读取内容上传的文件，普通文件和文件夹返回空
+func SpecialFileType(mode os.FileMode) string {
+	switch {
+	case mode&os.ModeSocket != 0:
+		return "socket"
+	case mode&os.ModeCharDevice != 0:
+		return "字符设备"
+	case mode&os.ModeDevice != 0:
+		return "块设备"
+	case mode&os.ModeNamedPipe != 0:
+		return "命名管道"
+	case mode&os.ModeIrregular != 0:
+		return "未知类型文件"
+	}
+	return ""
+}
+
+// NewSymlinkManifest 创建软链接清单
+func NewSymlinkManifest() *SymlinkManifest {
+	return &SymlinkManifest{
+		items: map[string]string{},
+	}
+}
+
+// Add 记录软链接，返回清单是否发生了变化
+func (m *SymlinkManifest) Add(linkPath, target string) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if t, ok := m.items[linkPath]; ok && t == target {
+		return false
+	}
+	m.items[linkPath] = target
+	return true
+}
+
+// Count 清单中的软链接数量
+func (m *SymlinkManifest) Count() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return len(m.items)
+}
+
+// Items 按照路径排序的清单记录
+func (m *SymlinkManifest) Items() []*SymlinkManifestItem {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	items := make([]*SymlinkManifestItem, 0, len(m.items))
+	for p, t := range m.items {
+		items = append(items, &SymlinkManifestItem{Path: p, Target: t})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Path < items[j].Path
+	})
+	return items
+}
+
+// Save 保存清单到文件，先写临时文件再重命名，避免中断时留下不完整的清单
+func (m *SymlinkManifest) Save(filePath string) error {
+	data, err := json.MarshalIndent(m.Items(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpPath := filePath + ".tmp"
+	if err = os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, filePath)
+}
@@ -0,0 +1,71 @@
+package localfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseSymlinkPolicy(t *testing.T) {
+	p, err := ParseSymlinkPolicy("", SymlinkSkip)
+	if err != nil || p != SymlinkSkip {
+		t.Fatalf("default policy: %s, %v", p, err)
+	}
+	p, err = ParseSymlinkPolicy("Manifest", SymlinkSkip)
+	if err != nil || p != SymlinkManifestPolicy {
+		t.Fatalf("manifest policy: %s, %v", p, err)
+	}
+	if _, err = ParseSymlinkPolicy("copy", SymlinkSkip); err == nil {
+		t.Fatal("expect error for unknown policy")
+	}
+}
+
+func TestSpecialFileType(t *testing.T) {
+	if SpecialFileType(0644) != "" || SpecialFileType(os.ModeDir|0755) != "" {
+		t.Fatal("regular file and dir are not special")
+	}
+	if SpecialFileType(os.ModeSocket|0755) != "socket" {
+		t.Fatal("expect socket")
+	}
+	if SpecialFileType(os.ModeDevice|os.ModeCharDevice) != "字符设备" {
+		t.Fatal("expect char device")
+	}
+	if SpecialFileType(os.ModeNamedPipe) != "命名管道" {
+		t.Fatal("expect named pipe")
+	}
+}
+
+func TestIsHiddenFile(t *testing.T) {
+	if !IsHiddenFile("/data/.git") || !IsHiddenFile(".env") {
+		t.Fatal("expect hidden")
+	}
+	if IsHiddenFile("/data/a.txt") || IsHiddenFile(".") {
+		t.Fatal("expect not hidden")
+	}
+}
+
+func TestRelativeSymlink(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("a.txt", filepath.Join(dir, "b.txt")); err != nil {
+		t.Skip("symlink not supported: ", err)
+	}
+	linkPath := filepath.ToSlash(filepath.Join(dir, "b.txt"))
+	if !IsSymlink(linkPath) || ReadSymlink(linkPath) != "a.txt" {
+		t.Fatal("expect symlink to a.txt")
+	}
+	sf, fi, err := RetrieveRealPath(NewSymlinkFile(linkPath))
+	if err != nil || fi.Size() != 1 || sf.RealPath != filepath.ToSlash(filepath.Join(dir, "a.txt")) {
+		t.Fatalf("retrieve real path: %v, %v", sf, err)
+	}
+
+	m := NewSymlinkManifest()
+	if !m.Add("/pan/b.txt", "a.txt") || m.Add("/pan/b.txt", "a.txt") || m.Count() != 1 {
+		t.Fatal("manifest add")
+	}
+	if err = m.Save(filepath.Join(dir, SymlinkManifestFileName)); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package localfile
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"strings"
+	"sync"
+)
+
+const (
+	// PreHashSize 计算PreHash使用的文件头部数据长度，用于秒传预检测
+	PreHashSize = 1024
+)
+
+type (
+	// HashResult 预先计算的文件摘要
+	HashResult struct {
+		SHA1    string
+		PreHash string // 文件头部 PreHashSize 字节的SHA1，用于秒传预检测
+		Length  int64  // 计算时的文件大小，用于判断文件是否已经被修改
+		ModTime int64  // 计算时的文件修改时间
+		Err     error
+
+		done chan struct{}
+	}
+
+	// HashPool 文件SHA1计算协程池。
+	// 扫描阶段提交排队的文件，由多个协程按提交顺序并发计算SHA1，使网络传输和SHA1计算可以重叠进行。所有方法都支持nil调用
+	HashPool struct {
+		queue   []SymlinkFile
+		results map[string]*HashResult // RealPath => 计算结果，包括正在计算的
+		closed  bool
+		mutex   sync.Mutex
+		cond    *sync.Cond
+		wg      sync.WaitGroup
+	}
+)
+
+// NewHashPool 创建SHA1计算协程池，workers小于1返回nil
+func NewHashPool(workers int) *HashPool {
+	if workers < 1 {
+		return nil
+	}
+	hp := &HashPool{
+		queue:   []SymlinkFile{},
+		results: map[string]*HashResult{},
+	}
+	hp.cond = sync.NewCond(&hp.mutex)
+	for i := 0; i < workers; i++ {
+		hp.wg.Add(1)
+		go hp.work()
+	}
+	return hp
+}
+
+// Submit 提交需要计算SHA1的文件
+func (hp *HashPool) Submit(file SymlinkFile) {
+	if hp == nil {
+		return
+	}
+	hp.mutex.Lock()
+	defer hp.mutex.Unlock()
+	if hp.closed {
+		return
+	}
+	hp.queue = append(hp.queue, file)
+	hp.cond.Signal()
+}
+
+// Take 获取文件的SHA1计算结果。
+// 文件正在计算则等待计算完成；还在排队则从队列中移除并返回nil，由调用方自行计算，避免等待
+func (hp *HashPool) Take(realPath string) *HashResult {
+	if hp == nil {
+		return nil
+	}
+	hp.mutex.Lock()
+	if r, ok := hp.results[realPath]; ok {
+		delete(hp.results, realPath)
+		hp.mutex.Unlock()
+		<-r.done
+		return r
+	}
+	for i, f := range hp.queue {
+		if f.RealPath == realPath {
+			hp.queue = append(hp.queue[:i], hp.queue[i+1:]...)
+			break
+		}
+	}
+	hp.mutex.Unlock()
+	return nil
+}
+
+// Close 停止计算，丢弃还在排队的文件
+func (hp *HashPool) Close() {
+	if hp == nil {
+		return
+	}
+	hp.mutex.Lock()
+	hp.closed = true
+	hp.queue = nil
+	hp.cond.Broadcast()
+	hp.mutex.Unlock()
+	hp.wg.Wait()
+}
+
+func (hp *HashPool) work() {
+	defer hp.wg.Done()
+	for {
+		hp.mutex.Lock()
+		for len(hp.queue) == 0 && !hp.closed {
+			hp.cond.Wait()
+		}
+		if hp.closed {
+			hp.mutex.Unlock()
+			return
+		}
+		file := hp.queue[0]
+		hp.queue = hp.queue[1:]
+		r := &HashResult{done: make(chan struct{})}
+		hp.results[file.RealPath] = r
+		hp.mutex.Unlock()
+
+		hp.sum(file, r)
+		close(r.done)
+	}
+}
+
+func (hp *HashPool) sum(file SymlinkFile, r *HashResult) {
+	entity := NewLocalSymlinkFileEntity(file)
+	if r.Err = entity.OpenPath(); r.Err != nil {
+		return
+	}
+	defer entity.Close()
+	r.Length = entity.Length
+	r.ModTime = entity.ModTime
+	if r.PreHash, r.Err = calcPreHash(entity.GetFile()); r.Err != nil {
+		return
+	}
+	if r.Err = entity.Sum(CHECKSUM_SHA1); r.Err != nil {
+		return
+	}
+	r.SHA1 = entity.SHA1
+}
+
+// calcPreHash 计算文件头部 PreHashSize 字节的SHA1
+func calcPreHash(r io.ReaderAt) (string, error) {
+	buf := make([]byte, PreHashSize)
+	n, err := r.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	sum := sha1.Sum(buf[:n])
+	return strings.ToUpper(hex.EncodeToString(sum[:])), nil
+}
@@ -0,0 +1,58 @@
+package localfile
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHashPool(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(filePath, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	hp := NewHashPool(2)
+	defer hp.Close()
+	hp.Submit(NewSymlinkFile(filePath))
+
+	var r *HashResult
+	for r == nil {
+		// 还在排队时Take会移除任务，重新提交直到开始计算
+		if r = hp.Take(filePath); r == nil {
+			hp.Submit(NewSymlinkFile(filePath))
+		}
+	}
+	if r.Err != nil {
+		t.Fatal(r.Err)
+	}
+	if r.SHA1 != "AAF4C61DDCC5E8A2DABEDE0F3B482CD9AEA9434D" || r.Length != 5 {
+		t.Errorf("unexpected hash result: %s %d", r.SHA1, r.Length)
+	}
+	// 文件小于 PreHashSize 时 PreHash 和完整SHA1相同
+	if r.PreHash != r.SHA1 {
+		t.Errorf("unexpected pre hash: %s", r.PreHash)
+	}
+	if hp.Take(filePath) != nil {
+		t.Error("result should be removed after take")
+	}
+}
+
+func TestCalcPreHash(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 300)
+	sum := sha1.Sum(data[:PreHashSize])
+	want := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	preHash, err := calcPreHash(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preHash != want {
+		t.Errorf("pre hash %s, want %s", preHash, want)
+	}
+}
@@ -16,6 +16,7 @@ package localfile
 import (
 	"crypto/md5"
 	"crypto/sha1"
+	"encoding"
 	"encoding/hex"
 	"github.com/tickstep/aliyunpan-api/aliyunpan"
 	"hash/crc32"
@@ -30,6 +31,9 @@ import (
 const (
 	// DefaultBufSize 默认的bufSize
 	DefaultBufSize = int(256 * converter.KB)
+
+	// SHA1CheckpointInterval 计算SHA1时保存进度的间隔
+	SHA1CheckpointInterval = 512 * converter.MB
 )
 
 const (
@@ -58,6 +62,17 @@ type (
 
 		// ParentFolderId 存储云盘的目录ID
 		ParentFolderId string `json:"parent_folder_id,omitempty"`
+
+		// SHA1Checkpoint SHA1计算进度，用于中断后继续计算
+		SHA1Checkpoint *SHA1Checkpoint `json:"sha1Checkpoint,omitempty"`
+	}
+
+	// SHA1Checkpoint SHA1计算的中间状态
+	SHA1Checkpoint struct {
+		Offset  int64  `json:"offset"`  // 已经计算的数据长度
+		State   []byte `json:"state"`   // SHA1摘要的中间状态
+		Length  int64  `json:"length"`  // 计算时的文件大小，文件变化后进度失效
+		ModTime int64  `json:"modtime"` // 计算时的文件修改时间
 	}
 
 	// LocalFileEntity 校验本地文件
@@ -66,6 +81,9 @@ type (
 		bufSize int
 		buf     []byte
 		file    *os.File // 文件
+
+		// OnSHA1Checkpoint 设置后单独计算SHA1时会周期性保存计算进度到 SHA1Checkpoint，并回调该方法用于持久化
+		OnSHA1Checkpoint func()
 	}
 )
 
@@ -203,6 +221,9 @@ func (lfc *LocalFileEntity) createChecksumWriteUnit(cw ChecksumWriter, isAll boo
 // Sum 计算文件摘要值
 func (lfc *LocalFileEntity) Sum(checkSumFlag int) (err error) {
 	lfc.fix()
+	if checkSumFlag == CHECKSUM_SHA1 && lfc.OnSHA1Checkpoint != nil {
+		return lfc.sumSHA1Resumable()
+	}
 	wus := make([]*ChecksumWriteUnit, 0, 2)
 	if (checkSumFlag & (CHECKSUM_MD5)) != 0 {
 		md5w := md5.New()
@@ -264,6 +285,75 @@ func (lfc *LocalFileEntity) Sum(checkSumFlag int) (err error) {
 	return
 }
 
+// sumSHA1Resumable 计算SHA1，从上次保存的进度继续计算，并周期性保存计算进度
+func (lfc *LocalFileEntity) sumSHA1Resumable() (err error) {
+	if lfc.file == nil {
+		return ErrFileIsNil
+	}
+	lfc.initBuf()
+
+	h := sha1.New()
+	offset := int64(0)
+	if cp := lfc.SHA1Checkpoint; cp != nil && cp.Length == lfc.Length && cp.ModTime == lfc.ModTime && cp.Offset > 0 && cp.Offset <= lfc.Length {
+		if e := h.(encoding.BinaryUnmarshaler).UnmarshalBinary(cp.State); e == nil {
+			offset = cp.Offset
+		} else {
+			h.Reset()
+		}
+	}
+
+	defer func() {
+		_, e := lfc.file.Seek(0, io.SeekStart) // 恢复文件指针
+		if err == nil {
+			err = e
+		}
+	}()
+	if _, err = lfc.file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	lastCheckpoint := offset
+	for offset < lfc.Length {
+		buf := lfc.buf
+		if left := lfc.Length - offset; left < int64(len(buf)) {
+			buf = buf[:left]
+		}
+		n, e := lfc.file.Read(buf)
+		if n > 0 {
+			h.Write(buf[:n])
+			offset += int64(n)
+		}
+		if e == io.EOF {
+			break
+		}
+		if e != nil {
+			return e
+		}
+		if offset-lastCheckpoint >= SHA1CheckpointInterval {
+			lastCheckpoint = offset
+			state, e1 := h.(encoding.BinaryMarshaler).MarshalBinary()
+			if e1 != nil {
+				continue
+			}
+			lfc.SHA1Checkpoint = &SHA1Checkpoint{
+				Offset:  offset,
+				State:   state,
+				Length:  lfc.Length,
+				ModTime: lfc.ModTime,
+			}
+			lfc.OnSHA1Checkpoint()
+		}
+	}
+
+	lfc.SHA1 = strings.ToUpper(hex.EncodeToString(h.Sum(nil)))
+	// zero size file
+	if lfc.Length == 0 {
+		lfc.SHA1 = aliyunpan.DefaultZeroSizeFileContentHash
+	}
+	lfc.SHA1Checkpoint = nil
+	return nil
+}
+
 func (lfc *LocalFileEntity) fix() {
 	if lfc.bufSize < DefaultBufSize {
 		lfc.bufSize = DefaultBufSize
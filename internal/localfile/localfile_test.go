@@ -0,0 +1,67 @@
+package localfile
+
+import (
+	"crypto/sha1"
+	"encoding"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSumSHA1Resumable(t *testing.T) {
+	data := []byte(strings.Repeat("aliyunpan", 1000))
+	filePath := filepath.Join(t.TempDir(), "a.bin")
+	if err := os.WriteFile(filePath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	full := sha1.Sum(data)
+	expected := strings.ToUpper(hex.EncodeToString(full[:]))
+
+	// 模拟上次计算到一半中断保存的进度
+	h := sha1.New()
+	h.Write(data[:4000])
+	state, _ := h.(encoding.BinaryMarshaler).MarshalBinary()
+
+	lfc := NewLocalFileEntity(filePath)
+	if err := lfc.OpenPath(); err != nil {
+		t.Fatal(err)
+	}
+	defer lfc.Close()
+	lfc.SHA1Checkpoint = &SHA1Checkpoint{
+		Offset:  4000,
+		State:   state,
+		Length:  lfc.Length,
+		ModTime: lfc.ModTime,
+	}
+	lfc.OnSHA1Checkpoint = func() {}
+	if err := lfc.Sum(CHECKSUM_SHA1); err != nil {
+		t.Fatal(err)
+	}
+	if lfc.SHA1 != expected {
+		t.Errorf("resumed sha1 = %s, want %s", lfc.SHA1, expected)
+	}
+	if lfc.SHA1Checkpoint != nil {
+		t.Error("checkpoint should be cleared after sum")
+	}
+}
+
+func TestModTimeEqual(t *testing.T) {
+	cases := []struct {
+		t1, t2, tolerance int64
+		want              bool
+	}{
+		{100, 100, 0, true},
+		{100, 101, 0, false},
+		{100, 102, 2, true},
+		{102, 100, 2, true},
+		{100, 103, 2, false},
+		{100, 101, -1, false},
+	}
+	for _, c := range cases {
+		if got := ModTimeEqual(c.t1, c.t2, c.tolerance); got != c.want {
+			t.Errorf("ModTimeEqual(%d, %d, %d) = %v, want %v", c.t1, c.t2, c.tolerance, got, c.want)
+		}
+	}
+}
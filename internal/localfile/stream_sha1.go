@@ -0,0 +1,203 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package localfile
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"hash"
+	"io"
+	"sort"
+	"sync"
+)
+
+const (
+	// streamSha1ReadSize 从文件读回数据计算SHA1时每次读取的大小
+	streamSha1ReadSize = 1024 * 1024
+)
+
+type (
+	// hashSegment 已经写入但还没有计算SHA1的数据区间 [begin, end)
+	hashSegment struct {
+		begin int64
+		end   int64
+	}
+
+	// StreamSha1 写入文件的同时流式计算SHA1，用于下载完成后立即得出校验结果。
+	// SHA1只能按顺序计算，而多线程分段下载时各个分段是并发写入的：写入位置正好是计算游标时直接计算写入的数据，
+	// 否则只记录已写入的区间，游标追上该区间后由后台协程从文件读回计算，刚写入的数据通常还在系统缓存中。
+	// 这样下载完成时几乎所有数据都已经计算完，不需要再完整读取一遍文件。所有方法都支持nil调用
+	StreamSha1 struct {
+		size     int64
+		reader   io.ReaderAt
+		hash     hash.Hash
+		offset   int64          // 计算游标，之前的数据都已经计算
+		segments []*hashSegment // 已写入但未计算的区间，按位置排序并且互不相邻
+		catching bool           // 后台协程是否正在读回数据计算
+		err      error
+		mutex    sync.Mutex
+		cond     *sync.Cond
+	}
+)
+
+// NewStreamSha1 创建流式SHA1计算，size为文件大小，reader用于读回不是按顺序写入的数据，可以为nil
+func NewStreamSha1(size int64, reader io.ReaderAt) *StreamSha1 {
+	s := &StreamSha1{
+		size:   size,
+		reader: reader,
+		hash:   sha1.New(),
+	}
+	s.cond = sync.NewCond(&s.mutex)
+	return s
+}
+
+// Written 记录写入文件的数据，off为数据在文件中的位置。p在返回后可以被复用
+func (s *StreamSha1) Written(p []byte, off int64) {
+	if s == nil || len(p) == 0 {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	end := off + int64(len(p))
+	if s.err != nil || end <= s.offset {
+		// 出错或者重复写入已经计算过的数据
+		return
+	}
+	if !s.catching && off <= s.offset {
+		s.hash.Write(p[s.offset-off:])
+		s.offset = end
+	} else {
+		if off < s.offset {
+			off = s.offset
+		}
+		s.addSegment(off, end)
+	}
+	s.startCatchUp()
+}
+
+// MarkWritten 标记文件中已经写入的区间，例如断点续传之前已经下载的数据，这些数据会从文件读回计算
+func (s *StreamSha1) MarkWritten(begin, end int64) {
+	if s == nil || end <= begin {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if begin < s.offset {
+		begin = s.offset
+	}
+	if end <= begin {
+		return
+	}
+	s.addSegment(begin, end)
+	s.startCatchUp()
+}
+
+// Sum 等待读回的数据计算完成，返回整个文件的SHA1。数据不完整或者读取文件出错时返回空字符串
+func (s *StreamSha1) Sum() string {
+	if s == nil {
+		return ""
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for s.catching {
+		s.cond.Wait()
+	}
+	if s.err != nil || s.offset != s.size {
+		return ""
+	}
+	return hex.EncodeToString(s.hash.Sum(nil))
+}
+
+// addSegment 添加已写入的区间，合并重叠和相邻的区间
+func (s *StreamSha1) addSegment(begin, end int64) {
+	s.segments = append(s.segments, &hashSegment{begin: begin, end: end})
+	sort.Slice(s.segments, func(i, j int) bool {
+		return s.segments[i].begin < s.segments[j].begin
+	})
+	merged := s.segments[:1]
+	for _, seg := range s.segments[1:] {
+		last := merged[len(merged)-1]
+		if seg.begin <= last.end {
+			if seg.end > last.end {
+				last.end = seg.end
+			}
+			continue
+		}
+		merged = append(merged, seg)
+	}
+	s.segments = merged
+}
+
+// dropSegments 去掉已经计算过的区间
+func (s *StreamSha1) dropSegments() {
+	for len(s.segments) > 0 && s.segments[0].end <= s.offset {
+		s.segments = s.segments[1:]
+	}
+}
+
+// startCatchUp 计算游标到达已写入的区间时，启动后台协程读回数据计算
+func (s *StreamSha1) startCatchUp() {
+	s.dropSegments()
+	if s.catching || len(s.segments) == 0 || s.segments[0].begin > s.offset {
+		return
+	}
+	s.catching = true
+	go s.catchUp()
+}
+
+// catchUp 从文件读回计算游标之后连续的已写入数据
+func (s *StreamSha1) catchUp() {
+	buf := make([]byte, streamSha1ReadSize)
+	for {
+		s.mutex.Lock()
+		s.dropSegments()
+		if len(s.segments) == 0 || s.segments[0].begin > s.offset {
+			s.catching = false
+			s.cond.Broadcast()
+			s.mutex.Unlock()
+			return
+		}
+		start, end := s.offset, s.segments[0].end
+		if end-start > int64(len(buf)) {
+			end = start + int64(len(buf))
+		}
+		s.mutex.Unlock()
+
+		// 读回数据时不持有锁，不阻塞写入。读回期间只有本协程会推进计算游标
+		var (
+			n   int
+			err error
+		)
+		if s.reader == nil {
+			err = ErrStreamSha1NoReader
+		} else {
+			n, err = s.reader.ReadAt(buf[:end-start], start)
+		}
+
+		s.mutex.Lock()
+		if int64(n) < end-start {
+			if err == nil {
+				err = io.ErrUnexpectedEOF
+			}
+			s.err = err
+			s.catching = false
+			s.cond.Broadcast()
+			s.mutex.Unlock()
+			return
+		}
+		s.hash.Write(buf[:n])
+		s.offset = end
+		s.mutex.Unlock()
+	}
+}
@@ -0,0 +1,53 @@
+package localfile
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStreamSha1(t *testing.T) {
+	data := make([]byte, 3*streamSha1ReadSize+123)
+	rand.New(rand.NewSource(1)).Read(data)
+	sum := sha1.Sum(data)
+	want := hex.EncodeToString(sum[:])
+
+	// 模拟多线程分段下载：分段乱序写入，前 resumed 字节是断点续传之前已经下载的数据
+	for _, resumed := range []int{0, streamSha1ReadSize + 7} {
+		file, err := os.OpenFile(filepath.Join(t.TempDir(), "data.bin"), os.O_CREATE|os.O_RDWR, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.WriteAt(data[:resumed], 0)
+
+		s := NewStreamSha1(int64(len(data)), file)
+		s.MarkWritten(0, int64(resumed))
+		chunks := []int{}
+		for off := resumed; off < len(data); off += 64 * 1024 {
+			chunks = append(chunks, off)
+		}
+		rand.New(rand.NewSource(2)).Shuffle(len(chunks), func(i, j int) { chunks[i], chunks[j] = chunks[j], chunks[i] })
+		for _, off := range chunks {
+			end := off + 64*1024
+			if end > len(data) {
+				end = len(data)
+			}
+			file.WriteAt(data[off:end], int64(off))
+			s.Written(data[off:end], int64(off))
+		}
+		if got := s.Sum(); got != want {
+			t.Errorf("resumed %d: sha1 mismatch, got %q", resumed, got)
+		}
+		file.Close()
+	}
+
+	// 数据不完整时没有结果
+	s := NewStreamSha1(10, nil)
+	s.Written([]byte("hello"), 0)
+	if s.Sum() != "" {
+		t.Error("incomplete data should have no sha1")
+	}
+}
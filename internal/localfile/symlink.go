@@ -61,7 +61,12 @@ func RetrieveRealPath(file SymlinkFile) (SymlinkFile, os.FileInfo, error) {
 		if info.Mode()&os.ModeSymlink != 0 {
 			// 软链接文件
 			if f, e := os.Readlink(file.RealPath); e == nil {
-				file.RealPath = strings.ReplaceAll(f, "\\", "/")
+				f = strings.ReplaceAll(f, "\\", "/")
+				if !path.IsAbs(f) && !filepath.IsAbs(f) {
+					// 相对路径的软链接，相对于软链接所在的目录
+					f = path.Join(path.Dir(file.RealPath), f)
+				}
+				file.RealPath = f
 				return RetrieveRealPath(file)
 			}
 		}
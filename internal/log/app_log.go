@@ -0,0 +1,244 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// FormatText key=value格式
+	FormatText = "text"
+	// FormatJson 每行一条JSON记录
+	FormatJson = "json"
+)
+
+type (
+	// Logger 结构化的程序日志，每条记录包括时间、级别、消息以及附加的键值对。
+	// 程序日志只写入日志文件，终端上的进度等提示信息仍然直接输出，两者互不影响。所有方法都支持nil调用
+	Logger struct {
+		Level  Level
+		Format string
+
+		out   io.Writer
+		mutex sync.Mutex
+	}
+
+	// verboseWriter 把调试输出转换为debug级别的程序日志，按行写入
+	verboseWriter struct {
+		logger *Logger
+		buf    bytes.Buffer
+		mutex  sync.Mutex
+	}
+)
+
+var (
+	// std 全局程序日志，为nil代表不记录
+	std *Logger
+)
+
+// CheckFormat 检查日志格式
+func CheckFormat(format string) error {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", FormatText, FormatJson:
+		return nil
+	}
+	return fmt.Errorf("不支持的日志格式: %s, 支持: text, json", format)
+}
+
+// NewLogger 创建程序日志，format为空时使用text格式
+func NewLogger(out io.Writer, level Level, format string) *Logger {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format == "" {
+		format = FormatText
+	}
+	return &Logger{
+		Level:  level,
+		Format: format,
+		out:    out,
+	}
+}
+
+// SetDefault 设置全局程序日志
+func SetDefault(l *Logger) {
+	std = l
+}
+
+// Default 全局程序日志，没有开启时返回nil
+func Default() *Logger {
+	return std
+}
+
+// Enabled 是否输出该级别的日志
+func (l *Logger) Enabled(level Level) bool {
+	return l != nil && level >= l.Level
+}
+
+// Log 输出一条日志，keyValues为键值对，依次为键和值
+func (l *Logger) Log(level Level, msg string, keyValues ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	line := l.format(time.Now(), level, msg, keyValues)
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.out.Write(line)
+}
+
+func (l *Logger) format(t time.Time, level Level, msg string, keyValues []interface{}) []byte {
+	keys := []string{"time", "level", "msg"}
+	values := []string{t.Format(time.RFC3339), level.String(), msg}
+	for i := 0; i < len(keyValues); i += 2 {
+		key := fmt.Sprint(keyValues[i])
+		value := "(MISSING)"
+		if i+1 < len(keyValues) {
+			value = valueString(keyValues[i+1])
+		}
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+
+	buf := &bytes.Buffer{}
+	if l.Format == FormatJson {
+		buf.WriteByte('{')
+		for i, key := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			k, _ := json.Marshal(key)
+			v, _ := json.Marshal(values[i])
+			buf.Write(k)
+			buf.WriteByte(':')
+			buf.Write(v)
+		}
+		buf.WriteString("}\n")
+		return buf.Bytes()
+	}
+	for i, key := range keys {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(key)
+		buf.WriteByte('=')
+		buf.WriteString(quoteIfNeeded(values[i]))
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+func valueString(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case error:
+		return value.Error()
+	case time.Duration:
+		return value.String()
+	case time.Time:
+		return value.Format(time.RFC3339)
+	}
+	return fmt.Sprint(v)
+}
+
+// quoteIfNeeded text格式中包含空白、引号或者等号的值加上引号
+func quoteIfNeeded(s string) string {
+	if s == "" {
+		return `""`
+	}
+	if strings.ContainsAny(s, " \t\r\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// Debug 输出debug级别日志
+func (l *Logger) Debug(msg string, keyValues ...interface{}) {
+	l.Log(LevelDebug, msg, keyValues...)
+}
+
+// Info 输出info级别日志
+func (l *Logger) Info(msg string, keyValues ...interface{}) {
+	l.Log(LevelInfo, msg, keyValues...)
+}
+
+// Warn 输出warning级别日志
+func (l *Logger) Warn(msg string, keyValues ...interface{}) {
+	l.Log(LevelWarning, msg, keyValues...)
+}
+
+// Error 输出error级别日志
+func (l *Logger) Error(msg string, keyValues ...interface{}) {
+	l.Log(LevelError, msg, keyValues...)
+}
+
+// Close 关闭日志文件
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	if c, ok := l.out.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// VerboseWriter 返回把调试输出写入程序日志的Writer，每一行作为一条debug级别的日志，
+// 用于接收 logger.Verboseln 等调试输出。行首的时间前缀会被去掉
+func (l *Logger) VerboseWriter() io.Writer {
+	return &verboseWriter{logger: l}
+}
+
+func (w *verboseWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.buf.Write(p)
+	for {
+		data := w.buf.Bytes()
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		line := string(data[:i])
+		w.buf.Next(i + 1)
+		if line = trimVerbosePrefix(line); line != "" {
+			w.logger.Debug(line)
+		}
+	}
+	return len(p), nil
+}
+
+// trimVerbosePrefix 去掉调试输出行首的时间前缀，例如 [2026-01-01 15:04:05]
+func trimVerbosePrefix(line string) string {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "[") {
+		if i := strings.Index(line, "]"); i > 0 {
+			line = strings.TrimSpace(line[i+1:])
+		}
+	}
+	return line
+}
+
+// Debug 输出debug级别的全局程序日志
+func Debug(msg string, keyValues ...interface{}) {
+	std.Debug(msg, keyValues...)
+}
+
+// Info 输出info级别的全局程序日志
+func Info(msg string, keyValues ...interface{}) {
+	std.Info(msg, keyValues...)
+}
+
+// Warn 输出warning级别的全局程序日志
+func Warn(msg string, keyValues ...interface{}) {
+	std.Warn(msg, keyValues...)
+}
+
+// Error 输出error级别的全局程序日志
+func Error(msg string, keyValues ...interface{}) {
+	std.Error(msg, keyValues...)
+}
@@ -0,0 +1,80 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoggerFormat(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := NewLogger(buf, LevelInfo, FormatText)
+	l.Debug("ignored")
+	l.Info("上传结束", "target", "/我的 文档", "failed", 0)
+	line := buf.String()
+	if strings.Contains(line, "ignored") {
+		t.Fatalf("debug log should be filtered: %s", line)
+	}
+	if !strings.Contains(line, `level=info msg=上传结束 target="/我的 文档" failed=0`) {
+		t.Fatalf("unexpected text log: %s", line)
+	}
+
+	buf.Reset()
+	l = NewLogger(buf, LevelDebug, FormatJson)
+	l.Error("刷新Token失败", "error", errors.New("token expired"))
+	m := map[string]string{}
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["level"] != "error" || m["msg"] != "刷新Token失败" || m["error"] != "token expired" {
+		t.Fatalf("unexpected json log: %v", m)
+	}
+
+	buf.Reset()
+	w := l.VerboseWriter()
+	w.Write([]byte("[2026-01-01 15:04:05] "))
+	w.Write([]byte("create folder\n"))
+	if !strings.Contains(buf.String(), `"msg":"create folder"`) {
+		t.Fatalf("unexpected verbose log: %s", buf.String())
+	}
+
+	var nilLogger *Logger
+	nilLogger.Info("nil logger")
+}
+
+func TestRotateWriter(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "aliyunpan.log")
+	now := time.Date(2026, 1, 1, 10, 0, 0, 0, time.Local)
+	w := NewRotateWriter(filePath, 10, RotateDaily, 2)
+	w.now = func() time.Time { return now }
+	defer w.Close()
+
+	// 超过大小切割
+	w.Write([]byte("0123456789"))
+	now = now.Add(time.Second)
+	w.Write([]byte("abc"))
+	if n := len(w.Backups()); n != 1 {
+		t.Fatalf("backups = %d, want 1", n)
+	}
+
+	// 进入新的一天切割
+	now = now.Add(24 * time.Hour)
+	w.Write([]byte("def"))
+	now = now.Add(24 * time.Hour)
+	w.Write([]byte("ghi"))
+	backups := w.Backups()
+	if len(backups) != 2 {
+		t.Fatalf("backups = %d, want 2", len(backups))
+	}
+	if data, _ := os.ReadFile(backups[1]); string(data) != "def" {
+		t.Fatalf("latest backup = %s, want def", data)
+	}
+	if data, _ := os.ReadFile(filePath); string(data) != "ghi" {
+		t.Fatalf("current log = %s, want ghi", data)
+	}
+}
@@ -0,0 +1,138 @@
+package log
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// AuditResultSuccess 操作成功
+	AuditResultSuccess = "success"
+	// AuditResultFail 操作失败或者部分失败
+	AuditResultFail = "fail"
+)
+
+type (
+	// AuditRecord 审计日志记录，每次写操作一条
+	AuditRecord struct {
+		Time      time.Time `json:"time"`
+		Host      string    `json:"host"`      // 执行操作的主机名
+		User      string    `json:"user"`      // 执行操作的系统用户
+		Account   string    `json:"account"`   // 网盘账号昵称
+		AccountId string    `json:"accountId"` // 网盘账号ID
+		Command   string    `json:"command"`   // 命令，例如：upload、rm、recycle delete
+		Args      []string  `json:"args"`      // 命令参数
+		Result    string    `json:"result"`    // 操作结果：success、fail
+		Message   string    `json:"message,omitempty"`
+	}
+
+	// AuditFilter 审计日志查询条件，为空的条件不过滤
+	AuditFilter struct {
+		Since   time.Time
+		Until   time.Time
+		Command string // 命令，匹配命令本身以及子命令
+		User    string
+		Host    string
+		Account string // 匹配账号昵称或者账号ID
+		Result  string
+		Keyword string // 匹配参数和操作详情
+	}
+
+	// AuditLog 仅追加的审计日志文件，每行一条JSON记录
+	AuditLog struct {
+		Path  string
+		mutex sync.Mutex
+	}
+)
+
+// NewAuditLog 创建审计日志
+func NewAuditLog(filePath string) *AuditLog {
+	return &AuditLog{
+		Path: filePath,
+	}
+}
+
+// Append 追加一条记录。文件只以追加方式打开，不会修改已有的记录
+func (a *AuditLog) Append(rec *AuditRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	f, err := os.OpenFile(a.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// Query 查询满足条件的记录，按时间顺序返回最后limit条，limit<=0返回全部。无法解析的行跳过
+func (a *AuditLog) Query(filter *AuditFilter, limit int) ([]*AuditRecord, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	f, err := os.Open(a.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*AuditRecord{}, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	records := []*AuditRecord{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		rec := &AuditRecord{}
+		if json.Unmarshal(scanner.Bytes(), rec) != nil {
+			continue
+		}
+		if filter != nil && !filter.Match(rec) {
+			continue
+		}
+		records = append(records, rec)
+		if limit > 0 && len(records) > limit {
+			records = records[1:]
+		}
+	}
+	return records, scanner.Err()
+}
+
+// Match 记录是否满足查询条件
+func (f *AuditFilter) Match(rec *AuditRecord) bool {
+	if !f.Since.IsZero() && rec.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && rec.Time.After(f.Until) {
+		return false
+	}
+	if f.Command != "" && rec.Command != f.Command && !strings.HasPrefix(rec.Command, f.Command+" ") {
+		return false
+	}
+	if f.User != "" && rec.User != f.User {
+		return false
+	}
+	if f.Host != "" && rec.Host != f.Host {
+		return false
+	}
+	if f.Account != "" && rec.Account != f.Account && rec.AccountId != f.Account {
+		return false
+	}
+	if f.Result != "" && rec.Result != f.Result {
+		return false
+	}
+	if f.Keyword != "" {
+		text := rec.Message + "\n" + strings.Join(rec.Args, "\n")
+		if !strings.Contains(text, f.Keyword) {
+			return false
+		}
+	}
+	return true
+}
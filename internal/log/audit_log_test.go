@@ -0,0 +1,41 @@
+package log
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAuditLog(t *testing.T) {
+	auditLog := NewAuditLog(filepath.Join(t.TempDir(), "audit.log"))
+	if records, err := auditLog.Query(nil, 0); err != nil || len(records) != 0 {
+		t.Fatalf("审计日志不存在时应该返回空记录: %v %v", records, err)
+	}
+	now := time.Now()
+	for k, cmd := range []string{"upload", "rm", "recycle delete", "rm"} {
+		auditLog.Append(&AuditRecord{
+			Time:    now.Add(time.Duration(k) * time.Minute),
+			User:    "alice",
+			Command: cmd,
+			Args:    []string{"/备份/" + cmd},
+			Result:  AuditResultSuccess,
+		})
+	}
+
+	records, _ := auditLog.Query(&AuditFilter{Command: "rm"}, 0)
+	if len(records) != 2 {
+		t.Errorf("expected 2 rm records, got %d", len(records))
+	}
+	records, _ = auditLog.Query(&AuditFilter{Command: "recycle"}, 0)
+	if len(records) != 1 || records[0].Command != "recycle delete" {
+		t.Errorf("子命令应该匹配: %v", records)
+	}
+	records, _ = auditLog.Query(&AuditFilter{Since: now.Add(90 * time.Second), Keyword: "rm"}, 0)
+	if len(records) != 1 || !records[0].Time.After(now) {
+		t.Errorf("unexpected records: %v", records)
+	}
+	records, _ = auditLog.Query(nil, 3)
+	if len(records) != 3 || records[0].Command != "rm" {
+		t.Errorf("应该返回最后3条记录: %v", records)
+	}
+}
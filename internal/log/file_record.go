@@ -1,6 +1,7 @@
 package log
 
 import (
+	"bufio"
 	"encoding/csv"
 	"fmt"
 	"github.com/tickstep/aliyunpan/internal/utils"
@@ -8,7 +9,10 @@ import (
 	"github.com/tickstep/library-go/logger"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 type (
@@ -17,14 +21,57 @@ type (
 		TimeStr  string `json:"timeStr"`
 		FileSize int64  `json:"fileSize"`
 		FilePath string `json:"filePath"`
+
+		// Transfer 传输详情，为nil时扩展字段留空
+		Transfer *FileRecordTransfer `json:"transfer,omitempty"`
+		// Verify 下载后的SHA1校验结果，为空代表没有校验
+		Verify string `json:"verify,omitempty"`
+	}
+
+	// FileRecordTransfer 文件传输详情
+	FileRecordTransfer struct {
+		RapidUpload   bool          `json:"rapidUpload"`   // 是否秒传
+		TransferBytes int64         `json:"transferBytes"` // 实际传输字节数，秒传以及断点续传的部分不计算在内
+		Elapsed       time.Duration `json:"elapsed"`       // 耗时
+		Retry         int           `json:"retry"`         // 重试次数
+		FileId        string        `json:"fileId"`        // 网盘文件ID
 	}
 
 	FileRecorder struct {
 		Path   string `json:"path"`
 		locker *sync.Mutex
+
+		action  string           // 记录类型，例如：upload、download、sync，用于系统日志
+		targets *LogTargets      // 系统日志输出目标，为nil只写本地记录文件
+		history *TransferHistory // 传输记录数据库，为nil代表不记录
 	}
 )
 
+var (
+	// fileRecordHeaderV1 第一版记录文件表头，已存在的旧记录文件继续使用该格式追加
+	fileRecordHeaderV1 = []string{"状态", "时间", "文件大小", "文件路径"}
+	// fileRecordHeaderV2 在第一版的基础上追加传输详情字段，前面的字段保持不变
+	fileRecordHeaderV2 = append(append([]string{}, fileRecordHeaderV1...), "秒传", "传输字节", "节省字节", "耗时", "平均速度", "重试次数", "文件ID")
+	// fileRecordHeaderV3 在第二版的基础上追加校验结果字段
+	fileRecordHeaderV3 = append(append([]string{}, fileRecordHeaderV2...), "校验结果")
+)
+
+// SavedBytes 秒传或者断点续传节省的字节数
+func (t *FileRecordTransfer) SavedBytes(fileSize int64) int64 {
+	if t.TransferBytes >= fileSize {
+		return 0
+	}
+	return fileSize - t.TransferBytes
+}
+
+// AverageSpeed 平均传输速度，单位：字节/秒
+func (t *FileRecordTransfer) AverageSpeed() int64 {
+	if t.Elapsed <= 0 {
+		return 0
+	}
+	return int64(float64(t.TransferBytes) / t.Elapsed.Seconds())
+}
+
 // NewFileRecorder 创建文件记录器
 func NewFileRecorder(filePath string) *FileRecorder {
 	return &FileRecorder{
@@ -33,8 +80,56 @@ func NewFileRecorder(filePath string) *FileRecorder {
 	}
 }
 
+// SetTargets 设置系统日志输出目标，action为记录类型，例如：upload、download、sync
+func (f *FileRecorder) SetTargets(action string, targets *LogTargets) {
+	f.action = action
+	f.targets = targets
+}
+
+// SetHistory 设置传输记录数据库，每条记录同时写入数据库用于查询
+func (f *FileRecorder) SetHistory(history *TransferHistory) {
+	f.history = history
+}
+
+// Close 关闭系统日志输出目标，写入传输记录数据库中缓存的记录
+func (f *FileRecorder) Close() error {
+	if err := f.history.Close(); err != nil {
+		logger.Verbosef("写入传输记录数据库失败: %s\n", err)
+	}
+	return f.targets.Close()
+}
+
 // Append 增加数据记录
 func (f *FileRecorder) Append(item *FileRecordItem) error {
+	fields := map[string]string{
+		"action":    f.action,
+		"status":    item.Status,
+		"file_path": item.FilePath,
+		"file_size": strconv.FormatInt(item.FileSize, 10),
+	}
+	if t := item.Transfer; t != nil {
+		fields["rapid_upload"] = strconv.FormatBool(t.RapidUpload)
+		fields["transfer_bytes"] = strconv.FormatInt(t.TransferBytes, 10)
+		fields["saved_bytes"] = strconv.FormatInt(t.SavedBytes(item.FileSize), 10)
+		fields["elapsed_ms"] = strconv.FormatInt(t.Elapsed.Milliseconds(), 10)
+		fields["retry"] = strconv.Itoa(t.Retry)
+		fields["file_id"] = t.FileId
+	}
+	if item.Verify != "" {
+		fields["verify"] = item.Verify
+	}
+	f.targets.Log(recordLevel(item.Status), fmt.Sprintf("%s %s: %s (%s)", f.action, item.Status, item.FilePath, converter.ConvertFileSize(item.FileSize, 2)), fields)
+	if err := f.history.Add(f.transferRecord(item)); err != nil {
+		logger.Verbosef("写入传输记录数据库失败: %s\n", err)
+	}
+	if f.targets != nil && !f.targets.WriteFile {
+		return nil
+	}
+	return f.appendFile(item)
+}
+
+// appendFile 写入本地记录文件
+func (f *FileRecorder) appendFile(item *FileRecordItem) error {
 	f.locker.Lock()
 	defer f.locker.Unlock()
 	savePath := f.Path
@@ -45,8 +140,10 @@ func (f *FileRecorder) Append(item *FileRecordItem) error {
 
 	var fp *os.File
 	var write *csv.Writer
+	header := fileRecordHeaderV3
 	if b, err := utils.PathExists(savePath); err == nil && b {
-		file, err1 := os.OpenFile(savePath, os.O_APPEND, 0755)
+		header = readRecordHeader(savePath)
+		file, err1 := os.OpenFile(savePath, os.O_APPEND|os.O_WRONLY, 0755)
 		if err1 != nil {
 			logger.Verbosef("打开文件["+savePath+"]失败,%v", err1)
 			return err1
@@ -62,7 +159,7 @@ func (f *FileRecorder) Append(item *FileRecordItem) error {
 		fp = file
 		fp.WriteString("\xEF\xBB\xBF") // 写入UTF-8 BOM
 		write = csv.NewWriter(fp)      //创建一个新的写入文件流
-		write.Write([]string{"状态", "时间", "文件大小", "文件路径"})
+		write.Write(header)
 	}
 	if fp == nil || write == nil {
 		return fmt.Errorf("open recorder file error")
@@ -70,7 +167,87 @@ func (f *FileRecorder) Append(item *FileRecordItem) error {
 	defer fp.Close()
 
 	data := []string{item.Status, item.TimeStr, converter.ConvertFileSize(item.FileSize, 2), item.FilePath}
+	if len(header) > len(fileRecordHeaderV1) {
+		data = append(data, transferColumns(item)...)
+	}
+	if len(header) > len(fileRecordHeaderV2) {
+		data = append(data, item.Verify)
+	}
 	write.Write(data)
 	write.Flush()
 	return nil
 }
+
+// transferRecord 文件记录对应的传输记录。同步的记录状态例如"成功-上传"，类型记录为sync-upload
+func (f *FileRecorder) transferRecord(item *FileRecordItem) *TransferRecord {
+	rec := &TransferRecord{
+		Action: f.action,
+		Status: TransferStatusSuccess,
+		Path:   item.FilePath,
+		Size:   item.FileSize,
+		Verify: item.Verify,
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04:05", item.TimeStr, time.Local); err == nil {
+		rec.Time = t
+	} else {
+		rec.Time = time.Now()
+	}
+	if strings.HasPrefix(item.Status, "失败") {
+		rec.Status = TransferStatusFail
+	}
+	if strings.HasSuffix(item.Status, "-上传") {
+		rec.Action += "-upload"
+	} else if strings.HasSuffix(item.Status, "-下载") {
+		rec.Action += "-download"
+	}
+	if t := item.Transfer; t != nil {
+		rec.TransferBytes = t.TransferBytes
+		rec.Elapsed = t.Elapsed.Milliseconds()
+		rec.RapidUpload = t.RapidUpload
+		rec.Retry = t.Retry
+		rec.FileId = t.FileId
+	}
+	return rec
+}
+
+// readRecordHeader 读取已存在记录文件的表头，用于兼容旧版本的记录文件
+func readRecordHeader(savePath string) []string {
+	file, err := os.Open(savePath)
+	if err != nil {
+		return fileRecordHeaderV3
+	}
+	defer file.Close()
+	line, err := bufio.NewReader(file).ReadString('\n')
+	if err != nil && line == "" {
+		return fileRecordHeaderV3
+	}
+	header, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(line, "\xEF\xBB\xBF"))).Read()
+	if err != nil || len(header) <= len(fileRecordHeaderV1) {
+		return fileRecordHeaderV1
+	}
+	if len(header) <= len(fileRecordHeaderV2) {
+		return fileRecordHeaderV2
+	}
+	return fileRecordHeaderV3
+}
+
+// transferColumns 传输详情字段
+func transferColumns(item *FileRecordItem) []string {
+	t := item.Transfer
+	if t == nil {
+		return make([]string, len(fileRecordHeaderV2)-len(fileRecordHeaderV1))
+	}
+	rapid := "否"
+	if t.RapidUpload {
+		rapid = "是"
+	}
+	return []string{
+		rapid,
+		converter.ConvertFileSize(t.TransferBytes, 2),
+		converter.ConvertFileSize(t.SavedBytes(item.FileSize), 2),
+		utils.ConvertTime(t.Elapsed),
+		converter.ConvertFileSize(t.AverageSpeed(), 2) + "/s",
+		strconv.Itoa(t.Retry),
+		t.FileId,
+	}
+}
@@ -1,7 +1,13 @@
 package log
 
 import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestCsvFile(t *testing.T) {
@@ -14,3 +20,110 @@ func TestCsvFile(t *testing.T) {
 		FilePath: "D:\\smb\\feny\\goprojects\\dev\\myfile.mp4",
 	})
 }
+
+func TestFileRecordHeaderCompatible(t *testing.T) {
+	savePath := filepath.Join(t.TempDir(), "file_upload_records.csv")
+	os.WriteFile(savePath, []byte("\xEF\xBB\xBF状态,时间,文件大小,文件路径\n"), 0755)
+	recorder := NewFileRecorder(savePath)
+	recorder.Append(&FileRecordItem{
+		Status:   "成功",
+		TimeStr:  "2022-12-19 16:46:36",
+		FileSize: 453450,
+		FilePath: "/myfile.mp4",
+		Transfer: &FileRecordTransfer{RapidUpload: true, FileId: "abc"},
+	})
+	data, _ := os.ReadFile(savePath)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || strings.Count(lines[1], ",") != 3 {
+		t.Fatalf("旧版本记录文件应该继续使用旧格式: %q", lines)
+	}
+
+	savePath = filepath.Join(t.TempDir(), "file_upload_records.csv")
+	recorder = NewFileRecorder(savePath)
+	recorder.Append(&FileRecordItem{
+		Status:   "成功",
+		TimeStr:  "2022-12-19 16:46:36",
+		FileSize: 453450,
+		FilePath: "/myfile.mp4",
+		Transfer: &FileRecordTransfer{RapidUpload: true, FileId: "abc"},
+	})
+	if readRecordHeader(savePath)[len(fileRecordHeaderV2)-1] != "文件ID" {
+		t.Fatalf("新记录文件应该使用新格式")
+	}
+	data, _ = os.ReadFile(savePath)
+	if !strings.Contains(string(data), ",是,") || !strings.HasSuffix(strings.TrimSpace(string(data)), ",abc,") {
+		t.Fatalf("传输详情写入错误: %s", data)
+	}
+
+	// 第二版记录文件不写入校验结果
+	savePath = filepath.Join(t.TempDir(), "file_download_records.csv")
+	os.WriteFile(savePath, []byte("\xEF\xBB\xBF"+strings.Join(fileRecordHeaderV2, ",")+"\n"), 0755)
+	recorder = NewFileRecorder(savePath)
+	recorder.Append(&FileRecordItem{Status: "成功", FilePath: "/myfile.mp4", Verify: "通过"})
+	data, _ = os.ReadFile(savePath)
+	if strings.Contains(string(data), "通过") {
+		t.Fatalf("第二版记录文件应该继续使用第二版格式: %s", data)
+	}
+}
+
+func TestFileRecordTransferHistory(t *testing.T) {
+	dir := t.TempDir()
+	history := NewTransferHistory(filepath.Join(dir, "transfer_history.db"))
+	recorder := NewFileRecorder(filepath.Join(dir, "sync_file_records.csv"))
+	recorder.SetTargets("sync", nil)
+	recorder.SetHistory(history)
+	recorder.Append(&FileRecordItem{Status: "成功-上传", TimeStr: "2026-01-01 10:00:00", FileSize: 100, FilePath: "/照片/a.jpg"})
+	recorder.Append(&FileRecordItem{Status: "失败-下载", TimeStr: "2026-01-02 10:00:00", FileSize: 200, FilePath: "/文档/b.doc"})
+	recorder.Append(&FileRecordItem{Status: "成功-下载", TimeStr: "2026-01-03 10:00:00", FileSize: 300, FilePath: "/照片/c.jpg"})
+
+	records, err := history.Query(&TransferFilter{Path: "照片"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Path != "/照片/a.jpg" || records[1].Action != "sync-download" {
+		t.Fatalf("unexpected records: %+v", records)
+	}
+	records, _ = history.Query(&TransferFilter{Status: TransferStatusFail}, 0)
+	if len(records) != 1 || records[0].Size != 200 {
+		t.Fatalf("unexpected fail records: %+v", records)
+	}
+	since, _ := time.ParseInLocation("2006-01-02", "2026-01-02", time.Local)
+	records, _ = history.Query(&TransferFilter{Since: since, Action: "sync"}, 1)
+	if len(records) != 1 || records[0].Path != "/照片/c.jpg" {
+		t.Fatalf("unexpected latest records: %+v", records)
+	}
+
+	buf := &strings.Builder{}
+	if err = WriteTransferCsv(buf, records); err != nil || !strings.Contains(buf.String(), "sync-download,success,/照片/c.jpg,300") {
+		t.Fatalf("unexpected csv: %s, %v", buf.String(), err)
+	}
+}
+
+func TestTransferHistoryBatchAndTrim(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "transfer_history.db")
+	history := NewTransferHistory(dbPath)
+	history.MaxRecords = 150
+	for i := 0; i < 250; i++ {
+		history.Add(&TransferRecord{Time: time.Now(), Action: "upload", Status: TransferStatusSuccess, Path: "/f" + strconv.Itoa(i)})
+	}
+	// 其他进程打开数据库只能看到已经批量写入的记录
+	other := NewTransferHistory(dbPath)
+	records, err := other.Query(&TransferFilter{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 150 || records[0].Path != "/f50" {
+		t.Fatalf("expect 150 flushed records from /f50, got %d", len(records))
+	}
+
+	if err = history.Close(); err != nil {
+		t.Fatal(err)
+	}
+	records, _ = other.Query(&TransferFilter{}, 0)
+	if len(records) != 150 || records[0].Path != "/f100" || records[149].Path != "/f249" {
+		t.Fatalf("expect latest 150 records after close, got %d", len(records))
+	}
+	if info, err := os.Stat(dbPath); err != nil || (runtime.GOOS != "windows" && info.Mode().Perm() != 0600) {
+		t.Fatalf("database file should be created with 0600: %v %v", info.Mode(), err)
+	}
+}
@@ -0,0 +1,350 @@
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// Level 日志级别
+	Level int
+
+	// LogTarget 日志输出目标
+	LogTarget interface {
+		Write(level Level, msg string, fields map[string]string) error
+		Close() error
+	}
+
+	// LogTargets 上传、下载记录的输出目标集合，按级别过滤后写入syslog、journald。所有方法都支持nil调用
+	LogTargets struct {
+		WriteFile bool  // 是否同时写本地记录文件
+		Level     Level // 低于该级别的记录不输出
+
+		targets []LogTarget
+	}
+
+	// syslogTarget 使用RFC3164格式写入本地或者远程syslog
+	syslogTarget struct {
+		network  string
+		addr     string
+		tag      string
+		hostname string
+		conn     net.Conn
+		mutex    sync.Mutex
+	}
+
+	// journaldTarget 使用journald原生协议写入systemd日志
+	journaldTarget struct {
+		tag   string
+		conn  *net.UnixConn
+		addr  *net.UnixAddr
+		mutex sync.Mutex
+	}
+)
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarning
+	LevelError
+
+	// LogTargetFile 本地记录文件
+	LogTargetFile = "file"
+	// LogTargetSyslog 本地syslog，远程syslog使用 syslog://host:port(UDP) 或者 syslog+tcp://host:port
+	LogTargetSyslog = "syslog"
+	// LogTargetJournald systemd journald
+	LogTargetJournald = "journald"
+
+	// syslogFacilityUser syslog user-level facility
+	syslogFacilityUser = 1
+
+	journaldSocket = "/run/systemd/journal/socket"
+)
+
+var (
+	levelNames = map[Level]string{
+		LevelDebug:   "debug",
+		LevelInfo:    "info",
+		LevelWarning: "warning",
+		LevelError:   "error",
+	}
+
+	// 本地syslog的unix socket路径
+	localSyslogPaths = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+)
+
+// ParseLevel 解析日志级别，为空返回info
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return LevelDebug, nil
+	case "", "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarning, nil
+	case "error":
+		return LevelError, nil
+	}
+	return LevelInfo, fmt.Errorf("不支持的日志级别: %s, 支持: debug, info, warning, error", s)
+}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+// syslogSeverity 日志级别对应的syslog severity，同时用于journald的PRIORITY
+func (l Level) syslogSeverity() int {
+	switch l {
+	case LevelDebug:
+		return 7
+	case LevelWarning:
+		return 4
+	case LevelError:
+		return 3
+	}
+	return 6
+}
+
+// CheckLogTargets 检查日志输出目标配置，多个目标用逗号隔开
+func CheckLogTargets(spec string) error {
+	for _, item := range strings.Split(spec, ",") {
+		if _, _, _, err := parseLogTarget(strings.TrimSpace(item)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseLogTarget 解析单个日志输出目标，返回目标类型以及syslog的网络类型和地址
+func parseLogTarget(item string) (kind, network, addr string, err error) {
+	switch item {
+	case "", LogTargetFile:
+		return LogTargetFile, "", "", nil
+	case LogTargetSyslog, LogTargetJournald:
+		return item, "", "", nil
+	}
+	u, e := url.Parse(item)
+	if e != nil || u.Host == "" && u.Path == "" {
+		return "", "", "", fmt.Errorf("日志输出目标格式错误: %s", item)
+	}
+	switch u.Scheme {
+	case "syslog", "syslog+udp":
+		network = "udp"
+	case "syslog+tcp":
+		network = "tcp"
+	case "syslog+unix":
+		return LogTargetSyslog, "unixgram", u.Path, nil
+	default:
+		return "", "", "", fmt.Errorf("不支持的日志输出目标: %s, 支持: file, syslog, syslog://host:port, syslog+tcp://host:port, journald", item)
+	}
+	addr = u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "514")
+	}
+	return LogTargetSyslog, network, addr, nil
+}
+
+// NewLogTargets 创建日志输出目标，spec为逗号隔开的目标列表，为空代表只写本地记录文件。
+// tag为syslog的TAG以及journald的SYSLOG_IDENTIFIER
+func NewLogTargets(spec, level, tag string) (*LogTargets, error) {
+	lv, err := ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	if tag == "" {
+		tag = defaultLogTag()
+	}
+	lt := &LogTargets{Level: lv}
+	for _, item := range strings.Split(spec, ",") {
+		kind, network, addr, err := parseLogTarget(strings.TrimSpace(item))
+		if err != nil {
+			lt.Close()
+			return nil, err
+		}
+		switch kind {
+		case LogTargetFile:
+			lt.WriteFile = true
+		case LogTargetSyslog:
+			lt.targets = append(lt.targets, newSyslogTarget(network, addr, tag))
+		case LogTargetJournald:
+			t, err := newJournaldTarget(tag)
+			if err != nil {
+				lt.Close()
+				return nil, err
+			}
+			lt.targets = append(lt.targets, t)
+		}
+	}
+	return lt, nil
+}
+
+// Log 输出到所有目标，低于配置级别的记录直接忽略
+func (lt *LogTargets) Log(level Level, msg string, fields map[string]string) {
+	if lt == nil || level < lt.Level {
+		return
+	}
+	for _, t := range lt.targets {
+		if err := t.Write(level, msg, fields); err != nil {
+			fmt.Fprintf(os.Stderr, "写入系统日志失败: %s\n", err)
+		}
+	}
+}
+
+// Close 关闭所有目标
+func (lt *LogTargets) Close() error {
+	if lt == nil {
+		return nil
+	}
+	for _, t := range lt.targets {
+		t.Close()
+	}
+	lt.targets = nil
+	return nil
+}
+
+func newSyslogTarget(network, addr, tag string) *syslogTarget {
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "localhost"
+	}
+	return &syslogTarget{
+		network:  network,
+		addr:     addr,
+		tag:      tag,
+		hostname: hostname,
+	}
+}
+
+// connect 建立连接，连接断开后写入时重新连接
+func (st *syslogTarget) connect() (err error) {
+	if st.network != "" {
+		st.conn, err = net.DialTimeout(st.network, st.addr, 5*time.Second)
+		return
+	}
+	for _, p := range localSyslogPaths {
+		for _, network := range []string{"unixgram", "unix"} {
+			if st.conn, err = net.Dial(network, p); err == nil {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("连接本地syslog失败: %s", err)
+}
+
+func (st *syslogTarget) Write(level Level, msg string, fields map[string]string) error {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	line := fmt.Sprintf("<%d>%s %s %s[%d]: %s", syslogFacilityUser*8+level.syslogSeverity(),
+		time.Now().Format(time.Stamp), st.hostname, st.tag, os.Getpid(), msg)
+	if st.network == "tcp" {
+		// TCP需要换行分隔每条日志
+		line += "\n"
+	}
+	var err error
+	for i := 0; i < 2; i++ {
+		if st.conn == nil {
+			if err = st.connect(); err != nil {
+				return err
+			}
+		}
+		if _, err = st.conn.Write([]byte(line)); err == nil {
+			return nil
+		}
+		// 连接已失效，重新连接后再试一次
+		st.conn.Close()
+		st.conn = nil
+	}
+	return err
+}
+
+func (st *syslogTarget) Close() error {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	if st.conn == nil {
+		return nil
+	}
+	err := st.conn.Close()
+	st.conn = nil
+	return err
+}
+
+func newJournaldTarget(tag string) (*journaldTarget, error) {
+	if _, err := os.Stat(journaldSocket); err != nil {
+		return nil, fmt.Errorf("journald不可用: %s", err)
+	}
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &journaldTarget{
+		tag:  tag,
+		conn: conn,
+		addr: &net.UnixAddr{Name: journaldSocket, Net: "unixgram"},
+	}, nil
+}
+
+// appendJournaldField 追加journald字段，值包含换行时使用二进制格式
+func appendJournaldField(buf *bytes.Buffer, key, value string) {
+	buf.WriteString(key)
+	if strings.ContainsRune(value, '\n') {
+		buf.WriteByte('\n')
+		binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	} else {
+		buf.WriteByte('=')
+	}
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+// journaldFieldName journald字段名只能包含大写字母、数字和下划线
+func journaldFieldName(key string) string {
+	key = strings.ToUpper(key)
+	return strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, key)
+}
+
+func (jt *journaldTarget) Write(level Level, msg string, fields map[string]string) error {
+	buf := &bytes.Buffer{}
+	appendJournaldField(buf, "MESSAGE", msg)
+	appendJournaldField(buf, "PRIORITY", fmt.Sprintf("%d", level.syslogSeverity()))
+	appendJournaldField(buf, "SYSLOG_IDENTIFIER", jt.tag)
+	for k, v := range fields {
+		appendJournaldField(buf, "ALIYUNPAN_"+journaldFieldName(k), v)
+	}
+	jt.mutex.Lock()
+	defer jt.mutex.Unlock()
+	_, _, err := jt.conn.WriteMsgUnix(buf.Bytes(), nil, jt.addr)
+	return err
+}
+
+func (jt *journaldTarget) Close() error {
+	return jt.conn.Close()
+}
+
+// recordLevel 记录状态对应的日志级别
+func recordLevel(status string) Level {
+	switch status {
+	case "成功":
+		return LevelInfo
+	case "失败":
+		return LevelError
+	}
+	return LevelWarning
+}
+
+// defaultLogTag 默认的syslog TAG
+func defaultLogTag() string {
+	return strings.TrimSuffix(filepath.Base(os.Args[0]), filepath.Ext(os.Args[0]))
+}
@@ -0,0 +1,189 @@
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordTarget 记录写入的日志
+type recordTarget struct {
+	msgs []string
+}
+
+func (rt *recordTarget) Write(level Level, msg string, fields map[string]string) error {
+	rt.msgs = append(rt.msgs, level.String()+":"+msg)
+	return nil
+}
+
+func (rt *recordTarget) Close() error {
+	return nil
+}
+
+func TestParseLevel(t *testing.T) {
+	cases := []struct {
+		s    string
+		want Level
+		err  bool
+	}{
+		{"", LevelInfo, false},
+		{"debug", LevelDebug, false},
+		{" INFO ", LevelInfo, false},
+		{"warn", LevelWarning, false},
+		{"Warning", LevelWarning, false},
+		{"error", LevelError, false},
+		{"fatal", LevelInfo, true},
+	}
+	for _, c := range cases {
+		got, err := ParseLevel(c.s)
+		if got != c.want || (err != nil) != c.err {
+			t.Errorf("ParseLevel(%q) = %s, %v", c.s, got, err)
+		}
+	}
+}
+
+func TestParseLogTarget(t *testing.T) {
+	cases := []struct {
+		item    string
+		kind    string
+		network string
+		addr    string
+		err     bool
+	}{
+		{"", LogTargetFile, "", "", false},
+		{"file", LogTargetFile, "", "", false},
+		{"syslog", LogTargetSyslog, "", "", false},
+		{"journald", LogTargetJournald, "", "", false},
+		{"syslog://10.0.0.1", LogTargetSyslog, "udp", "10.0.0.1:514", false},
+		{"syslog+udp://10.0.0.1:1514", LogTargetSyslog, "udp", "10.0.0.1:1514", false},
+		{"syslog+tcp://log.example.com:601", LogTargetSyslog, "tcp", "log.example.com:601", false},
+		{"syslog+unix:///dev/log", LogTargetSyslog, "unixgram", "/dev/log", false},
+		{"http://10.0.0.1", "", "", "", true},
+		{"unknown", "", "", "", true},
+	}
+	for _, c := range cases {
+		kind, network, addr, err := parseLogTarget(c.item)
+		if kind != c.kind || network != c.network || addr != c.addr || (err != nil) != c.err {
+			t.Errorf("parseLogTarget(%q) = %s, %s, %s, %v", c.item, kind, network, addr, err)
+		}
+	}
+	if err := CheckLogTargets("file, syslog://10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckLogTargets("file,unknown"); err == nil {
+		t.Fatal("expect error for unknown target")
+	}
+}
+
+func TestSyslogSeverity(t *testing.T) {
+	cases := []struct {
+		level    Level
+		severity int
+		status   string
+	}{
+		{LevelDebug, 7, ""},
+		{LevelInfo, 6, "成功"},
+		{LevelWarning, 4, "跳过"},
+		{LevelError, 3, "失败"},
+	}
+	for _, c := range cases {
+		if s := c.level.syslogSeverity(); s != c.severity {
+			t.Errorf("%s: severity %d, want %d", c.level, s, c.severity)
+		}
+		if c.status != "" && recordLevel(c.status) != c.level {
+			t.Errorf("status %s: level %s, want %s", c.status, recordLevel(c.status), c.level)
+		}
+	}
+}
+
+func TestJournaldField(t *testing.T) {
+	cases := []struct {
+		key  string
+		want string
+	}{
+		{"status", "STATUS"},
+		{"file-path", "FILE_PATH"},
+		{"drive.id2", "DRIVE_ID2"},
+		{"文件", "__"},
+	}
+	for _, c := range cases {
+		if got := journaldFieldName(c.key); got != c.want {
+			t.Errorf("journaldFieldName(%q) = %s, want %s", c.key, got, c.want)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	appendJournaldField(buf, "MESSAGE", "hello")
+	if buf.String() != "MESSAGE=hello\n" {
+		t.Fatalf("field %q", buf.String())
+	}
+	// 包含换行的值使用二进制格式：字段名、换行、8字节小端长度、值、换行
+	buf.Reset()
+	appendJournaldField(buf, "MESSAGE", "a\nb")
+	want := &bytes.Buffer{}
+	want.WriteString("MESSAGE\n")
+	binary.Write(want, binary.LittleEndian, uint64(3))
+	want.WriteString("a\nb\n")
+	if !bytes.Equal(buf.Bytes(), want.Bytes()) {
+		t.Fatalf("binary field %q", buf.String())
+	}
+}
+
+func TestLogTargetsLevel(t *testing.T) {
+	rt := &recordTarget{}
+	lt := &LogTargets{Level: LevelWarning, targets: []LogTarget{rt}}
+	lt.Log(LevelDebug, "debug", nil)
+	lt.Log(LevelInfo, "info", nil)
+	lt.Log(LevelWarning, "warning", nil)
+	lt.Log(LevelError, "error", nil)
+	if strings.Join(rt.msgs, ",") != "warning:warning,error:error" {
+		t.Fatalf("msgs %v", rt.msgs)
+	}
+
+	var nilTargets *LogTargets
+	nilTargets.Log(LevelError, "error", nil)
+	if nilTargets.Close() != nil {
+		t.Fatal("nil targets should do nothing")
+	}
+
+	lt, err := NewLogTargets("file", "error", "aliyunpan")
+	if err != nil || !lt.WriteFile || lt.Level != LevelError || len(lt.targets) != 0 {
+		t.Fatalf("targets %+v, error %v", lt, err)
+	}
+	if _, err = NewLogTargets("file", "fatal", ""); err == nil {
+		t.Fatal("expect level error")
+	}
+}
+
+func TestSyslogTarget(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer conn.Close()
+
+	lt, err := NewLogTargets("syslog://"+conn.LocalAddr().String(), "info", "aliyunpan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lt.Close()
+	if lt.WriteFile {
+		t.Fatal("file should not be written without file target")
+	}
+	lt.Log(LevelError, "上传失败: /a.txt", nil)
+
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := string(buf[:n])
+	// user facility(1) * 8 + error severity(3)
+	if !strings.HasPrefix(line, "<11>") || !strings.Contains(line, " aliyunpan[") || !strings.HasSuffix(line, "]: 上传失败: /a.txt") {
+		t.Fatalf("syslog line %q", line)
+	}
+}
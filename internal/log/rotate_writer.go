@@ -0,0 +1,165 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// RotateNone 不按时间切割
+	RotateNone = "none"
+	// RotateDaily 每天切割
+	RotateDaily = "daily"
+	// RotateHourly 每小时切割
+	RotateHourly = "hourly"
+
+	// rotateBackupTimeLayout 切割后的文件名时间后缀，例如 aliyunpan.log.20260101-150405
+	rotateBackupTimeLayout = "20060102-150405"
+)
+
+type (
+	// RotateWriter 按大小以及时间切割的日志文件，切割后的文件以时间为后缀保存在同一目录
+	RotateWriter struct {
+		Path       string
+		MaxSize    int64  // 单个文件的最大字节数，0代表不按大小切割
+		Rotate     string // 按时间切割的周期：daily、hourly、none
+		MaxBackups int    // 保留的切割文件数，0代表全部保留
+
+		file   *os.File
+		size   int64
+		period string // 当前文件所属的时间周期
+		now    func() time.Time
+		mutex  sync.Mutex
+	}
+)
+
+// CheckRotate 检查按时间切割的周期
+func CheckRotate(rotate string) error {
+	switch strings.ToLower(strings.TrimSpace(rotate)) {
+	case "", RotateNone, RotateDaily, RotateHourly:
+		return nil
+	}
+	return fmt.Errorf("不支持的切割周期: %s, 支持: daily, hourly, none", rotate)
+}
+
+// NewRotateWriter 创建切割日志文件，文件在第一次写入时打开
+func NewRotateWriter(filePath string, maxSize int64, rotate string, maxBackups int) *RotateWriter {
+	return &RotateWriter{
+		Path:       filePath,
+		MaxSize:    maxSize,
+		Rotate:     strings.ToLower(strings.TrimSpace(rotate)),
+		MaxBackups: maxBackups,
+		now:        time.Now,
+	}
+}
+
+// periodOf 时间所属的切割周期
+func (w *RotateWriter) periodOf(t time.Time) string {
+	switch w.Rotate {
+	case RotateDaily:
+		return t.Format("20060102")
+	case RotateHourly:
+		return t.Format("2006010215")
+	}
+	return ""
+}
+
+func (w *RotateWriter) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.Path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(w.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file = f
+	w.size = info.Size()
+	// 已有的日志文件按最后修改时间确定所属周期，避免程序重启后跨周期的记录写入同一个文件
+	w.period = w.periodOf(info.ModTime())
+	return nil
+}
+
+// rotate 切割当前文件，并清理超出数量的旧文件
+func (w *RotateWriter) rotate() error {
+	if w.file != nil {
+		w.file.Close()
+		w.file = nil
+	}
+	backup := w.Path + "." + w.now().Format(rotateBackupTimeLayout)
+	if _, err := os.Stat(backup); err == nil {
+		// 同一秒内多次切割
+		backup = fmt.Sprintf("%s.%d", backup, w.now().UnixNano())
+	}
+	if err := os.Rename(w.Path, backup); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	w.removeOldBackups()
+	return w.open()
+}
+
+// Backups 已切割的文件，按时间从旧到新排列
+func (w *RotateWriter) Backups() []string {
+	files, _ := filepath.Glob(w.Path + ".*")
+	sort.Strings(files)
+	return files
+}
+
+func (w *RotateWriter) removeOldBackups() {
+	if w.MaxBackups <= 0 {
+		return
+	}
+	backups := w.Backups()
+	for i := 0; i < len(backups)-w.MaxBackups; i++ {
+		os.Remove(backups[i])
+	}
+}
+
+// Write 写入日志，超过大小或者进入新的时间周期时先切割文件
+func (w *RotateWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return 0, err
+		}
+	}
+	needRotate := w.size > 0 && w.MaxSize > 0 && w.size+int64(len(p)) > w.MaxSize
+	if period := w.periodOf(w.now()); period != w.period {
+		needRotate = needRotate || w.size > 0
+		w.period = period
+	}
+	if needRotate {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+		w.period = w.periodOf(w.now())
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Close 关闭文件
+func (w *RotateWriter) Close() error {
+	if w == nil {
+		return nil
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
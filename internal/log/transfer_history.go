@@ -0,0 +1,292 @@
+package log
+
+import (
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tickstep/bolt"
+	"github.com/tickstep/library-go/logger"
+)
+
+const (
+	// TransferStatusSuccess 传输成功
+	TransferStatusSuccess = "success"
+	// TransferStatusFail 传输失败
+	TransferStatusFail = "fail"
+
+	// DefaultTransferHistoryMaxRecords 传输记录数据库默认最多保留的记录数量
+	DefaultTransferHistoryMaxRecords = 100000
+
+	transferHistoryBucket = "transfer"
+	// transferHistoryFlushSize 缓存的记录达到该数量时写入数据库
+	transferHistoryFlushSize = 100
+	// transferHistoryFlushInterval 缓存的记录最多等待该时间后写入数据库
+	transferHistoryFlushInterval = 5 * time.Second
+)
+
+type (
+	// TransferRecord 一个文件的上传、下载或者同步记录
+	TransferRecord struct {
+		Id            uint64    `json:"id"`
+		Time          time.Time `json:"time"`
+		Action        string    `json:"action"`                  // upload、download、sync-upload、sync-download等
+		Status        string    `json:"status"`                  // success、fail
+		Path          string    `json:"path"`                    // 文件路径
+		Size          int64     `json:"size"`                    // 文件大小，单位：字节
+		TransferBytes int64     `json:"transferBytes,omitempty"` // 实际传输字节数
+		Elapsed       int64     `json:"elapsed,omitempty"`       // 耗时，单位：毫秒
+		RapidUpload   bool      `json:"rapidUpload,omitempty"`   // 是否秒传
+		Retry         int       `json:"retry,omitempty"`         // 重试次数
+		FileId        string    `json:"fileId,omitempty"`        // 网盘文件ID
+		Verify        string    `json:"verify,omitempty"`        // 下载校验结果
+	}
+
+	// TransferFilter 传输记录查询条件，为空的条件不过滤
+	TransferFilter struct {
+		Since  time.Time
+		Until  time.Time
+		Action string // 匹配记录类型的开头，例如sync匹配sync-upload和sync-download
+		Status string
+		Path   string // 匹配路径中包含的内容，不区分大小写
+	}
+
+	// TransferHistory 本地传输记录数据库，按记录的先后顺序保存。
+	// 新记录先缓存在内存中批量写入，每次读写时才打开数据库，同步、daemon等常驻进程运行时也可以查询。
+	// 超过 MaxRecords 时删除最旧的记录
+	TransferHistory struct {
+		Path string
+		// MaxRecords 最多保留的记录数量，小于等于0使用 DefaultTransferHistoryMaxRecords
+		MaxRecords int
+
+		mutex   sync.Mutex
+		pending []*TransferRecord // 还没有写入数据库的记录
+		timer   *time.Timer       // 定时写入缓存的记录
+	}
+)
+
+var (
+	transferCsvHeader = []string{"时间", "类型", "状态", "文件路径", "文件大小", "传输字节", "耗时(毫秒)", "秒传", "重试次数", "文件ID", "校验结果"}
+)
+
+// NewTransferHistory 创建传输记录数据库
+func NewTransferHistory(filePath string) *TransferHistory {
+	return &TransferHistory{
+		Path: filePath,
+	}
+}
+
+func (h *TransferHistory) open() (*bolt.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(h.Path), 0755); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(h.Path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err == nil {
+		// 旧版本创建的数据库文件权限过大
+		os.Chmod(h.Path, 0600)
+	}
+	return db, err
+}
+
+// Add 增加一条记录。记录先缓存在内存中，累计 transferHistoryFlushSize 条或者等待 transferHistoryFlushInterval 后批量写入数据库
+func (h *TransferHistory) Add(rec *TransferRecord) error {
+	if h == nil {
+		return nil
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.pending = append(h.pending, rec)
+	if len(h.pending) >= transferHistoryFlushSize {
+		return h.flush()
+	}
+	if h.timer == nil {
+		h.timer = time.AfterFunc(transferHistoryFlushInterval, func() {
+			if err := h.Flush(); err != nil {
+				logger.Verbosef("写入传输记录数据库失败: %s\n", err)
+			}
+		})
+	}
+	return nil
+}
+
+// Flush 把缓存的记录写入数据库
+func (h *TransferHistory) Flush() error {
+	if h == nil {
+		return nil
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.flush()
+}
+
+// Close 写入缓存的记录，程序退出前调用
+func (h *TransferHistory) Close() error {
+	return h.Flush()
+}
+
+func (h *TransferHistory) flush() error {
+	if h.timer != nil {
+		h.timer.Stop()
+		h.timer = nil
+	}
+	if len(h.pending) == 0 {
+		return nil
+	}
+	records := h.pending
+	h.pending = nil
+	db, err := h.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.Update(func(tx *bolt.Tx) error {
+		bkt, e := tx.CreateBucketIfNotExists([]byte(transferHistoryBucket))
+		if e != nil {
+			return e
+		}
+		for _, rec := range records {
+			if rec.Id, e = bkt.NextSequence(); e != nil {
+				return e
+			}
+			data, e := json.Marshal(rec)
+			if e != nil {
+				return e
+			}
+			if e = bkt.Put(transferHistoryKey(rec.Id), data); e != nil {
+				return e
+			}
+		}
+		return h.trim(bkt)
+	})
+}
+
+// trim 删除超过数量限制的最旧的记录。记录ID连续递增并且只从最旧的记录开始删除，记录数量为最新和最旧的ID之差
+func (h *TransferHistory) trim(bkt *bolt.Bucket) error {
+	maxRecords := h.MaxRecords
+	if maxRecords <= 0 {
+		maxRecords = DefaultTransferHistoryMaxRecords
+	}
+	first, _ := bkt.Cursor().First()
+	if first == nil {
+		return nil
+	}
+	firstId, lastId := binary.BigEndian.Uint64(first), bkt.Sequence()
+	for id := firstId; lastId-id+1 > uint64(maxRecords); id++ {
+		if e := bkt.Delete(transferHistoryKey(id)); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+func transferHistoryKey(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
+
+// Match 记录是否满足查询条件
+func (f *TransferFilter) Match(rec *TransferRecord) bool {
+	if !f.Since.IsZero() && rec.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && rec.Time.After(f.Until) {
+		return false
+	}
+	if f.Action != "" && !strings.HasPrefix(rec.Action, f.Action) {
+		return false
+	}
+	if f.Status != "" && rec.Status != f.Status {
+		return false
+	}
+	if f.Path != "" && !strings.Contains(strings.ToLower(rec.Path), strings.ToLower(f.Path)) {
+		return false
+	}
+	return true
+}
+
+// Query 查询满足条件的最近limit条记录，按时间从旧到新返回，limit小于等于0返回全部
+func (h *TransferHistory) Query(filter *TransferFilter, limit int) ([]*TransferRecord, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if err := h.flush(); err != nil {
+		return nil, err
+	}
+	db, err := h.open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	records := []*TransferRecord{}
+	err = db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(transferHistoryBucket))
+		if bkt == nil {
+			return nil
+		}
+		c := bkt.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			rec := &TransferRecord{}
+			if json.Unmarshal(v, rec) != nil {
+				continue
+			}
+			if !filter.Since.IsZero() && rec.Time.Before(filter.Since) {
+				// 记录按时间顺序保存，之前的记录都不满足条件
+				break
+			}
+			if !filter.Match(rec) {
+				continue
+			}
+			records = append(records, rec)
+			if limit > 0 && len(records) >= limit {
+				break
+			}
+		}
+		return nil
+	})
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+	return records, err
+}
+
+// WriteTransferCsv 以CSV格式导出记录
+func WriteTransferCsv(w io.Writer, records []*TransferRecord) error {
+	io.WriteString(w, "\xEF\xBB\xBF") // UTF-8 BOM，方便Excel打开
+	cw := csv.NewWriter(w)
+	cw.Write(transferCsvHeader)
+	for _, rec := range records {
+		rapid := "否"
+		if rec.RapidUpload {
+			rapid = "是"
+		}
+		cw.Write([]string{
+			rec.Time.Format("2006-01-02 15:04:05"),
+			rec.Action,
+			rec.Status,
+			rec.Path,
+			strconv.FormatInt(rec.Size, 10),
+			strconv.FormatInt(rec.TransferBytes, 10),
+			strconv.FormatInt(rec.Elapsed, 10),
+			rapid,
+			strconv.Itoa(rec.Retry),
+			rec.FileId,
+			rec.Verify,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteTransferJson 以JSON数组格式导出记录
+func WriteTransferJson(w io.Writer, records []*TransferRecord) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(records)
+}
@@ -0,0 +1,233 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics 周期推送上传、下载指标到 InfluxDB 或者 StatsD，方便接入Grafana等监控面板
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tickstep/library-go/logger"
+)
+
+const (
+	// DefaultPushInterval 默认推送间隔，单位：秒
+	DefaultPushInterval = 10
+
+	// metricPrefix 指标名称前缀
+	metricPrefix = "aliyunpan"
+)
+
+type (
+	// Point 指标数据点
+	Point struct {
+		Measurement string             // 指标名称，例如：upload
+		Tags        map[string]string  // 标签
+		Fields      map[string]float64 // 指标值
+	}
+
+	// CollectFunc 采集指标
+	CollectFunc func() []*Point
+
+	// Sink 指标推送目标
+	Sink interface {
+		Write(points []*Point) error
+		Close() error
+	}
+
+	// Pusher 周期采集并推送指标
+	Pusher struct {
+		sink     Sink
+		interval time.Duration
+		collect  CollectFunc
+		stop     chan struct{}
+		wg       sync.WaitGroup
+	}
+
+	// statsdSink StatsD，使用UDP发送gauge指标
+	statsdSink struct {
+		conn net.Conn
+	}
+
+	// influxSink InfluxDB，使用HTTP写入行协议数据
+	influxSink struct {
+		writeUrl string
+		client   *http.Client
+	}
+)
+
+// NewSink 根据地址创建推送目标。
+// statsd://127.0.0.1:8125 推送到StatsD；http(s)://127.0.0.1:8086/write?db=aliyunpan 推送到InfluxDB
+func NewSink(addr string) (Sink, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "statsd", "udp":
+		conn, e := net.Dial("udp", u.Host)
+		if e != nil {
+			return nil, e
+		}
+		return &statsdSink{conn: conn}, nil
+	case "http", "https":
+		return &influxSink{
+			writeUrl: addr,
+			client:   &http.Client{Timeout: 10 * time.Second},
+		}, nil
+	}
+	return nil, fmt.Errorf("不支持的指标推送地址: %s", addr)
+}
+
+// NewPusher 创建指标推送器，addr 为空返回nil
+func NewPusher(addr string, intervalSec int, collect CollectFunc) (*Pusher, error) {
+	if addr == "" {
+		return nil, nil
+	}
+	sink, err := NewSink(addr)
+	if err != nil {
+		return nil, err
+	}
+	if intervalSec <= 0 {
+		intervalSec = DefaultPushInterval
+	}
+	return &Pusher{
+		sink:     sink,
+		interval: time.Duration(intervalSec) * time.Second,
+		collect:  collect,
+		stop:     make(chan struct{}),
+	}, nil
+}
+
+// Start 开始周期推送
+func (p *Pusher) Start() {
+	if p == nil {
+		return
+	}
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+				p.push()
+			}
+		}
+	}()
+}
+
+// Stop 停止推送，停止前会推送最后一次指标
+func (p *Pusher) Stop() {
+	if p == nil {
+		return
+	}
+	close(p.stop)
+	p.wg.Wait()
+	p.push()
+	p.sink.Close()
+}
+
+func (p *Pusher) push() {
+	points := p.collect()
+	if len(points) == 0 {
+		return
+	}
+	if err := p.sink.Write(points); err != nil {
+		logger.Verboseln("push metrics error: ", err)
+	}
+}
+
+func (s *statsdSink) Write(points []*Point) error {
+	buf := &bytes.Buffer{}
+	for _, pt := range points {
+		for _, k := range sortedKeys(pt.Fields) {
+			fmt.Fprintf(buf, "%s.%s.%s:%s|g\n", metricPrefix, pt.Measurement, k, formatValue(pt.Fields[k]))
+		}
+	}
+	_, err := s.conn.Write(buf.Bytes())
+	return err
+}
+
+func (s *statsdSink) Close() error {
+	return s.conn.Close()
+}
+
+func (s *influxSink) Write(points []*Point) error {
+	buf := &bytes.Buffer{}
+	now := time.Now().UnixNano()
+	for _, pt := range points {
+		buf.WriteString(escapeInflux(metricPrefix + "_" + pt.Measurement))
+		tagKeys := make([]string, 0, len(pt.Tags))
+		for k := range pt.Tags {
+			tagKeys = append(tagKeys, k)
+		}
+		sort.Strings(tagKeys)
+		for _, k := range tagKeys {
+			if pt.Tags[k] == "" {
+				continue
+			}
+			buf.WriteString("," + escapeInflux(k) + "=" + escapeInflux(pt.Tags[k]))
+		}
+		fields := []string{}
+		for _, k := range sortedKeys(pt.Fields) {
+			fields = append(fields, escapeInflux(k)+"="+formatValue(pt.Fields[k]))
+		}
+		buf.WriteString(" " + strings.Join(fields, ",") + " " + strconv.FormatInt(now, 10) + "\n")
+	}
+	resp, err := s.client.Post(s.writeUrl, "text/plain; charset=utf-8", buf)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("influxdb response status: %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *influxSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// escapeInflux 转义行协议中的逗号、空格和等号
+func escapeInflux(s string) string {
+	return strings.NewReplacer(",", "\\,", " ", "\\ ", "=", "\\=").Replace(s)
+}
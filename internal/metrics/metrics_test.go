@@ -0,0 +1,139 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metrics
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func testPoints() []*Point {
+	return []*Point{
+		{
+			Measurement: "upload",
+			Tags:        map[string]string{"user": "tick step"},
+			Fields:      map[string]float64{"speed": 1024, "total_size": 2048},
+		},
+	}
+}
+
+func TestInfluxSink(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sink, err := NewSink(server.URL + "/write?db=aliyunpan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sink.Write(testPoints()); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(body, "aliyunpan_upload,user=tick\\ step speed=1024,total_size=2048 ") {
+		t.Errorf("unexpected line protocol: %s", body)
+	}
+}
+
+func TestStatsdSink(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	sink, err := NewSink("statsd://" + conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	if err = sink.Write(testPoints()); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 1024)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "aliyunpan.upload.speed:1024|g\naliyunpan.upload.total_size:2048|g\n"
+	if string(buf[:n]) != expected {
+		t.Errorf("unexpected statsd data: %s", string(buf[:n]))
+	}
+}
+
+func TestNewSinkUnsupported(t *testing.T) {
+	if _, err := NewSink("ftp://127.0.0.1"); err == nil {
+		t.Error("expected error for unsupported scheme")
+	}
+}
+
+func TestRegistryWriteText(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("aliyunpan_api_errors_total", "接口错误", "code", "429").Add(2)
+	r.Counter("aliyunpan_api_errors_total", "接口错误", "code", "429").Add(1)
+	r.Counter("aliyunpan_upload_bytes_total", "上传").Add(100)
+	r.Register("upload", testPoints)
+
+	buf := &strings.Builder{}
+	if err := r.WriteText(buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"# TYPE aliyunpan_api_errors_total counter",
+		`aliyunpan_api_errors_total{code="429"} 3`,
+		"aliyunpan_upload_bytes_total 100",
+		"# TYPE aliyunpan_upload_speed gauge",
+		`aliyunpan_upload_speed{user="tick step"} 1024`,
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("missing line %q in:\n%s", line, buf.String())
+		}
+	}
+
+	r.Unregister("upload")
+	buf.Reset()
+	r.WriteText(buf)
+	if strings.Contains(buf.String(), "aliyunpan_upload_speed") {
+		t.Error("unregistered collector should not be written")
+	}
+}
+
+func TestRegistryWriteTextMergeDuplicateSeries(t *testing.T) {
+	r := NewRegistry()
+	// 两个上传到同一目录的任务输出相同名称和标签的序列
+	r.Register("upload-1", testPoints)
+	r.Register("upload-2", testPoints)
+
+	buf := &strings.Builder{}
+	if err := r.WriteText(buf); err != nil {
+		t.Fatal(err)
+	}
+	text := buf.String()
+	if n := strings.Count(text, "aliyunpan_upload_speed{"); n != 1 {
+		t.Fatalf("duplicate series should be merged, got %d in:\n%s", n, text)
+	}
+	if n := strings.Count(text, "# TYPE aliyunpan_upload_speed gauge"); n != 1 {
+		t.Fatalf("type line should be written once, got %d", n)
+	}
+	if !strings.Contains(text, `aliyunpan_upload_speed{user="tick step"} 2048`+"\n") {
+		t.Errorf("merged series should be summed:\n%s", text)
+	}
+}
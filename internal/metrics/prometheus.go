@@ -0,0 +1,243 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metrics
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
+)
+
+type (
+	// Counter 单调递增的计数器
+	Counter struct {
+		value int64
+	}
+
+	// counterFamily 同名计数器，按标签区分
+	counterFamily struct {
+		help    string
+		samples map[string]*Counter // 标签 => 计数器
+	}
+
+	// Registry Prometheus指标注册表。计数器在事件发生时累加，仪表盘在每次抓取时通过CollectFunc采集
+	Registry struct {
+		mutex      sync.Mutex
+		counters   map[string]*counterFamily
+		collectors map[string]CollectFunc
+	}
+)
+
+var (
+	// Default 默认的注册表，daemon以及同步备份的 /metrics 输出该注册表的指标
+	Default = NewRegistry()
+
+	// UploadBytes 上传的数据量
+	UploadBytes = Default.Counter(metricPrefix+"_upload_bytes_total", "上传的数据量，单位：字节")
+	// DownloadBytes 下载的数据量
+	DownloadBytes = Default.Counter(metricPrefix+"_download_bytes_total", "下载的数据量，单位：字节")
+)
+
+// NewRegistry 创建注册表
+func NewRegistry() *Registry {
+	return &Registry{
+		counters:   map[string]*counterFamily{},
+		collectors: map[string]CollectFunc{},
+	}
+}
+
+// Add 累加计数，支持nil调用
+func (c *Counter) Add(n int64) {
+	if c == nil {
+		return
+	}
+	atomic.AddInt64(&c.value, n)
+}
+
+// Value 当前计数
+func (c *Counter) Value() int64 {
+	if c == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&c.value)
+}
+
+// Counter 获取计数器，不存在时创建。labels 为标签名和标签值交替的列表，例如 "code", "TooManyRequests"
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	key := formatLabels(labels)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	family, ok := r.counters[name]
+	if !ok {
+		family = &counterFamily{help: help, samples: map[string]*Counter{}}
+		r.counters[name] = family
+	}
+	c, ok := family.samples[key]
+	if !ok {
+		c = &Counter{}
+		family.samples[key] = c
+	}
+	return c
+}
+
+// Register 注册仪表盘采集函数，每次抓取时调用。Point的指标名称为 aliyunpan_<Measurement>_<Field>，Tags为标签。
+// 相同key的采集函数会被替换
+func (r *Registry) Register(key string, collect CollectFunc) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.collectors[key] = collect
+}
+
+// Unregister 移除采集函数
+func (r *Registry) Unregister(key string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.collectors, key)
+}
+
+// WriteText 按照Prometheus文本格式输出全部指标
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mutex.Lock()
+	counterNames := make([]string, 0, len(r.counters))
+	for name := range r.counters {
+		counterNames = append(counterNames, name)
+	}
+	sort.Strings(counterNames)
+	bw := bufio.NewWriter(w)
+	for _, name := range counterNames {
+		family := r.counters[name]
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s counter\n", name, family.help, name)
+		keys := make([]string, 0, len(family.samples))
+		for key := range family.samples {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(bw, "%s%s %d\n", name, key, family.samples[key].Value())
+		}
+	}
+	collectors := make([]CollectFunc, 0, len(r.collectors))
+	collectorKeys := make([]string, 0, len(r.collectors))
+	for key := range r.collectors {
+		collectorKeys = append(collectorKeys, key)
+	}
+	sort.Strings(collectorKeys)
+	for _, key := range collectorKeys {
+		collectors = append(collectors, r.collectors[key])
+	}
+	r.mutex.Unlock()
+
+	// 采集函数可能比较耗时，不持有锁调用。同名指标合并输出，
+	// 多个采集函数输出了名称和标签都相同的序列时（例如同时运行两个上传到同一目录的任务）数值相加，避免输出重复的序列
+	gauges := map[string]map[string]float64{} // 指标名称 => 标签 => 数值
+	for _, collect := range collectors {
+		for _, p := range collect() {
+			labels := make([]string, 0, len(p.Tags)*2)
+			for _, k := range sortedTagKeys(p.Tags) {
+				labels = append(labels, k, p.Tags[k])
+			}
+			key := formatLabels(labels)
+			for _, field := range sortedKeys(p.Fields) {
+				name := metricPrefix + "_" + p.Measurement + "_" + field
+				if gauges[name] == nil {
+					gauges[name] = map[string]float64{}
+				}
+				gauges[name][key] += p.Fields[field]
+			}
+		}
+	}
+	gaugeNames := make([]string, 0, len(gauges))
+	for name := range gauges {
+		gaugeNames = append(gaugeNames, name)
+	}
+	sort.Strings(gaugeNames)
+	for _, name := range gaugeNames {
+		fmt.Fprintf(bw, "# TYPE %s gauge\n", name)
+		keys := make([]string, 0, len(gauges[name]))
+		for key := range gauges[name] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(bw, "%s%s %s\n", name, key, formatValue(gauges[name][key]))
+		}
+	}
+	return bw.Flush()
+}
+
+// Handler 输出指标的HTTP处理器，用于 /metrics
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := r.WriteText(w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// CountApiError 统计网盘接口错误，按错误码分类。不是接口错误时不统计
+func CountApiError(err error) {
+	var apiErr *apierror.ApiError
+	if err == nil || !errors.As(err, &apiErr) || apiErr == nil {
+		return
+	}
+	Default.Counter(metricPrefix+"_api_errors_total", "网盘接口错误次数，按错误码分类", "code", strconv.Itoa(int(apiErr.Code))).Add(1)
+}
+
+// CountRetry 统计任务重试次数，taskType 为 upload、download、sync_upload、sync_download 等
+func CountRetry(taskType string) {
+	Default.Counter(metricPrefix+"_retries_total", "任务重试次数", "type", taskType).Add(1)
+}
+
+// formatLabels 生成标签字符串，例如 {code="1",type="upload"}
+func formatLabels(labels []string) string {
+	if len(labels) < 2 {
+		return ""
+	}
+	builder := &strings.Builder{}
+	builder.WriteString("{")
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			builder.WriteString(",")
+		}
+		builder.WriteString(labels[i])
+		builder.WriteString(`="`)
+		builder.WriteString(escapeLabelValue(labels[i+1]))
+		builder.WriteString(`"`)
+	}
+	builder.WriteString("}")
+	return builder.String()
+}
+
+func escapeLabelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func sortedTagKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,346 @@
+//go:build linux
+// +build linux
+
+package mount
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// FUSE内核协议，参考 linux/fuse.h，只实现网盘挂载需要的部分
+const (
+	fuseKernelVersion      = 7
+	fuseKernelMinorVersion = 28
+	fuseMinKernelMinor     = 12
+
+	fuseRootId = 1
+
+	opLookup      = 1
+	opForget      = 2
+	opGetattr     = 3
+	opSetattr     = 4
+	opMkdir       = 9
+	opUnlink      = 10
+	opRmdir       = 11
+	opRename      = 12
+	opOpen        = 14
+	opRead        = 15
+	opWrite       = 16
+	opStatfs      = 17
+	opRelease     = 18
+	opFsync       = 20
+	opFlush       = 25
+	opInit        = 26
+	opOpendir     = 27
+	opReaddir     = 28
+	opReleasedir  = 29
+	opFsyncdir    = 30
+	opAccess      = 34
+	opCreate      = 35
+	opInterrupt   = 36
+	opDestroy     = 38
+	opBatchForget = 42
+	opRename2     = 45
+
+	// init flags
+	fuseAsyncRead = 1 << 0
+
+	// access mask，同 W_OK
+	accessWrite = 2
+
+	fuseMaxWrite = 128 * 1024
+	// fuseBufferSize 读取请求的缓冲区大小，需要能放下最大的写入请求
+	fuseBufferSize = fuseMaxWrite + 64*1024
+
+	fuseInHeaderSize  = 40
+	fuseOutHeaderSize = 16
+)
+
+type (
+	fuseInHeader struct {
+		Len     uint32
+		Opcode  uint32
+		Unique  uint64
+		Nodeid  uint64
+		Uid     uint32
+		Gid     uint32
+		Pid     uint32
+		Padding uint32
+	}
+
+	fuseOutHeader struct {
+		Len    uint32
+		Error  int32
+		Unique uint64
+	}
+
+	fuseInitIn struct {
+		Major        uint32
+		Minor        uint32
+		MaxReadahead uint32
+		Flags        uint32
+	}
+
+	fuseInitOut struct {
+		Major               uint32
+		Minor               uint32
+		MaxReadahead        uint32
+		Flags               uint32
+		MaxBackground       uint16
+		CongestionThreshold uint16
+		MaxWrite            uint32
+		TimeGran            uint32
+		MaxPages            uint16
+		MapAlignment        uint16
+		Flags2              uint32
+		Unused              [7]uint32
+	}
+
+	fuseAttr struct {
+		Ino       uint64
+		Size      uint64
+		Blocks    uint64
+		Atime     uint64
+		Mtime     uint64
+		Ctime     uint64
+		Atimensec uint32
+		Mtimensec uint32
+		Ctimensec uint32
+		Mode      uint32
+		Nlink     uint32
+		Uid       uint32
+		Gid       uint32
+		Rdev      uint32
+		Blksize   uint32
+		Flags     uint32
+	}
+
+	fuseEntryOut struct {
+		Nodeid         uint64
+		Generation     uint64
+		EntryValid     uint64
+		AttrValid      uint64
+		EntryValidNsec uint32
+		AttrValidNsec  uint32
+		Attr           fuseAttr
+	}
+
+	fuseAttrOut struct {
+		AttrValid     uint64
+		AttrValidNsec uint32
+		Dummy         uint32
+		Attr          fuseAttr
+	}
+
+	fuseOpenIn struct {
+		Flags     uint32
+		OpenFlags uint32
+	}
+
+	fuseOpenOut struct {
+		Fh        uint64
+		OpenFlags uint32
+		Padding   uint32
+	}
+
+	fuseReadIn struct {
+		Fh        uint64
+		Offset    uint64
+		Size      uint32
+		ReadFlags uint32
+		LockOwner uint64
+		Flags     uint32
+		Padding   uint32
+	}
+
+	fuseReleaseIn struct {
+		Fh           uint64
+		Flags        uint32
+		ReleaseFlags uint32
+		LockOwner    uint64
+	}
+
+	fuseAccessIn struct {
+		Mask    uint32
+		Padding uint32
+	}
+
+	fuseBatchForgetIn struct {
+		Count uint32
+		Dummy uint32
+	}
+
+	fuseForgetOne struct {
+		Nodeid  uint64
+		Nlookup uint64
+	}
+
+	fuseForgetIn struct {
+		Nlookup uint64
+	}
+
+	fuseKstatfs struct {
+		Blocks  uint64
+		Bfree   uint64
+		Bavail  uint64
+		Files   uint64
+		Ffree   uint64
+		Bsize   uint32
+		Namelen uint32
+		Frsize  uint32
+		Padding uint32
+		Spare   [6]uint32
+	}
+
+	fuseDirent struct {
+		Ino     uint64
+		Off     uint64
+		Namelen uint32
+		Type    uint32
+	}
+
+	// fuseRequest 内核发来的请求
+	fuseRequest struct {
+		header fuseInHeader
+		body   []byte
+	}
+)
+
+// decode 解析请求参数，body剩余部分返回给调用方，例如文件名
+func (r *fuseRequest) decode(v interface{}) ([]byte, error) {
+	size := binary.Size(v)
+	if size < 0 || len(r.body) < size {
+		return nil, syscall.EINVAL
+	}
+	if err := binary.Read(bytes.NewReader(r.body[:size]), binary.NativeEndian, v); err != nil {
+		return nil, err
+	}
+	return r.body[size:], nil
+}
+
+// cString 解析以0结尾的字符串，返回字符串以及剩余的数据
+func cString(b []byte) (string, []byte) {
+	idx := bytes.IndexByte(b, 0)
+	if idx < 0 {
+		return string(b), nil
+	}
+	return string(b[:idx]), b[idx+1:]
+}
+
+// encode 编码响应数据
+func encode(values ...interface{}) []byte {
+	buf := &bytes.Buffer{}
+	for _, v := range values {
+		if b, ok := v.([]byte); ok {
+			buf.Write(b)
+			continue
+		}
+		binary.Write(buf, binary.NativeEndian, v)
+	}
+	return buf.Bytes()
+}
+
+// mountFuse 只读挂载FUSE文件系统，返回/dev/fuse的文件句柄。没有权限直接挂载时使用fusermount
+func mountFuse(mountpoint string, opts *Options) (fd int, viaFusermount bool, err error) {
+	fd, err = syscall.Open("/dev/fuse", syscall.O_RDWR|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return mountByFusermount(mountpoint, opts)
+	}
+	flags := uintptr(syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_RDONLY)
+	data := fmt.Sprintf("fd=%d,rootmode=%o,user_id=%d,group_id=%d", fd, syscall.S_IFDIR, os.Getuid(), os.Getgid())
+	if err = syscall.Mount(opts.FsName, mountpoint, "fuse."+opts.FsName, flags, data); err != nil {
+		syscall.Close(fd)
+		if err == syscall.EPERM {
+			return mountByFusermount(mountpoint, opts)
+		}
+		return -1, false, err
+	}
+	return fd, false, nil
+}
+
+// fusermountBinary 查找fusermount程序
+func fusermountBinary() (string, error) {
+	for _, name := range []string{"fusermount3", "fusermount"} {
+		if p, err := exec.LookPath(name); err == nil {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("没有权限挂载，并且没有找到 fusermount，请安装 fuse 或者使用root用户运行")
+}
+
+// mountByFusermount 普通用户通过fusermount挂载，fusermount通过unix socket传回/dev/fuse的文件句柄
+func mountByFusermount(mountpoint string, opts *Options) (int, bool, error) {
+	bin, err := fusermountBinary()
+	if err != nil {
+		return -1, false, err
+	}
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		return -1, false, err
+	}
+	local := os.NewFile(uintptr(fds[0]), "fusermount-local")
+	remote := os.NewFile(uintptr(fds[1]), "fusermount-remote")
+	defer local.Close()
+
+	mountOpts := []string{"fsname=" + opts.FsName, "subtype=" + opts.FsName, "nosuid", "nodev", "ro"}
+	cmd := exec.Command(bin, "-o", strings.Join(mountOpts, ","), "--", mountpoint)
+	cmd.ExtraFiles = []*os.File{remote}
+	cmd.Env = append(os.Environ(), "_FUSE_COMMFD=3")
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	remote.Close()
+	if err != nil {
+		return -1, false, fmt.Errorf("fusermount 挂载失败: %s", err)
+	}
+
+	conn, err := net.FileConn(local)
+	if err != nil {
+		return -1, false, err
+	}
+	defer conn.Close()
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return -1, false, fmt.Errorf("fusermount 通信失败")
+	}
+	buf := make([]byte, 32)
+	oob := make([]byte, syscall.CmsgSpace(4))
+	_, oobn, _, _, err := unixConn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		return -1, false, err
+	}
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(msgs) == 0 {
+		return -1, false, fmt.Errorf("fusermount 没有返回文件句柄")
+	}
+	rights, err := syscall.ParseUnixRights(&msgs[0])
+	if err != nil || len(rights) == 0 {
+		return -1, false, fmt.Errorf("fusermount 没有返回文件句柄")
+	}
+	syscall.CloseOnExec(rights[0])
+	return rights[0], true, nil
+}
+
+// unmountFuse 卸载，目录正在使用时延迟卸载
+func unmountFuse(mountpoint string, viaFusermount bool) error {
+	if viaFusermount {
+		bin, err := fusermountBinary()
+		if err != nil {
+			return err
+		}
+		if out, err := exec.Command(bin, "-u", "-z", mountpoint).CombinedOutput(); err != nil {
+			return fmt.Errorf("%s: %s", err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+	if err := syscall.Unmount(mountpoint, 0); err != nil {
+		return syscall.Unmount(mountpoint, syscall.MNT_DETACH)
+	}
+	return nil
+}
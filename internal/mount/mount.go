@@ -0,0 +1,39 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package mount
+
+import (
+	"errors"
+	"runtime"
+)
+
+var (
+	// ErrMountNotSupported 当前系统不支持挂载
+	ErrMountNotSupported = errors.New("当前系统不支持挂载网盘，mount 只支持Linux(需要安装fuse)。macOS、Windows 请使用 webdav 命令启动服务，再通过访达(Finder)或资源管理器连接")
+)
+
+// Supported 当前系统是否支持挂载，只支持Linux。
+// 挂载只提供只读浏览：回写到网盘以及macOS(macFUSE)不在支持范围内，需要写入或者在其他系统上使用请用 webdav 服务
+func Supported() bool {
+	return runtime.GOOS == "linux"
+}
+
+type (
+	// Options 挂载选项, 挂载总是只读的
+	Options struct {
+		FsName string // 文件系统名称，显示在mount、df的输出中
+		// StatFs 获取网盘总空间以及已使用空间，用于df等命令显示，可以为nil
+		StatFs func() (total, used uint64, err error)
+	}
+)
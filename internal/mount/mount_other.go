@@ -0,0 +1,26 @@
+//go:build !linux
+// +build !linux
+
+package mount
+
+import (
+	"golang.org/x/net/webdav"
+)
+
+// Server 其他系统暂不支持挂载
+type Server struct{}
+
+// Mount 其他系统暂不支持挂载
+func Mount(mountpoint string, fs webdav.FileSystem, opts *Options) (*Server, error) {
+	return nil, ErrMountNotSupported
+}
+
+// Serve 其他系统暂不支持挂载
+func (s *Server) Serve() error {
+	return ErrMountNotSupported
+}
+
+// Unmount 其他系统暂不支持挂载
+func (s *Server) Unmount() error {
+	return ErrMountNotSupported
+}
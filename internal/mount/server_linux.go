@@ -0,0 +1,608 @@
+//go:build linux
+// +build linux
+
+package mount
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/tickstep/library-go/logger"
+	"golang.org/x/net/webdav"
+)
+
+const (
+	// attrValid 文件属性在内核中的缓存时间
+	attrValid = time.Second
+	// statfsValid 网盘空间信息的缓存时间
+	statfsValid = time.Minute
+)
+
+type (
+	// Server FUSE挂载服务，把 webdav.FileSystem 只读挂载为本地目录，文件支持 io.ReaderAt 时按位置读取。
+	// 创建、写入、删除、重命名等写操作都返回 EROFS，上传文件请使用 upload、webdav 等命令
+	Server struct {
+		mountpoint    string
+		fd            int
+		viaFusermount bool
+		fs            webdav.FileSystem
+		opts          *Options
+		uid, gid      uint32
+
+		nodes   map[uint64]*node
+		paths   map[string]uint64
+		nextIno uint64
+
+		handles    map[uint64]*handle
+		nextHandle uint64
+
+		statfsTime time.Time
+		statfs     fuseKstatfs
+
+		mutex sync.Mutex
+		wg    sync.WaitGroup
+	}
+
+	// node 内核引用的文件节点
+	node struct {
+		path   string
+		lookup uint64
+	}
+
+	// handle 打开的文件或者目录
+	handle struct {
+		path    string
+		file    webdav.File
+		entries []os.FileInfo // 目录列表
+		mutex   sync.Mutex
+	}
+)
+
+// Mount 挂载文件系统到本地目录，需要调用 Serve 处理请求
+func Mount(mountpoint string, fs webdav.FileSystem, opts *Options) (*Server, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	if opts.FsName == "" {
+		opts.FsName = "aliyunpan"
+	}
+	mountpoint, err := filepath.Abs(mountpoint)
+	if err != nil {
+		return nil, err
+	}
+	if fi, err := os.Stat(mountpoint); err != nil {
+		return nil, err
+	} else if !fi.IsDir() {
+		return nil, fmt.Errorf("挂载路径不是目录: %s", mountpoint)
+	}
+	fd, viaFusermount, err := mountFuse(mountpoint, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{
+		mountpoint:    mountpoint,
+		fd:            fd,
+		viaFusermount: viaFusermount,
+		fs:            fs,
+		opts:          opts,
+		uid:           uint32(os.Getuid()),
+		gid:           uint32(os.Getgid()),
+		nodes:         map[uint64]*node{fuseRootId: {path: "/", lookup: 1}},
+		paths:         map[string]uint64{"/": fuseRootId},
+		nextIno:       fuseRootId + 1,
+		handles:       map[uint64]*handle{},
+		nextHandle:    1,
+	}, nil
+}
+
+// Serve 处理内核请求，直到文件系统被卸载
+func (s *Server) Serve() error {
+	defer func() {
+		s.wg.Wait()
+		syscall.Close(s.fd)
+	}()
+	for {
+		buf := make([]byte, fuseBufferSize)
+		n, err := syscall.Read(s.fd, buf)
+		if err != nil {
+			switch err {
+			case syscall.EINTR, syscall.EAGAIN, syscall.ENOENT:
+				// 请求已经被中断
+				continue
+			case syscall.ENODEV:
+				// 已经卸载
+				return nil
+			}
+			return err
+		}
+		if n < fuseInHeaderSize {
+			continue
+		}
+		req := &fuseRequest{body: buf[fuseInHeaderSize:n]}
+		if _, err := (&fuseRequest{body: buf[:fuseInHeaderSize]}).decode(&req.header); err != nil {
+			continue
+		}
+		if req.header.Opcode == opDestroy {
+			s.reply(req, 0)
+			return nil
+		}
+		// 下载等耗时操作不能阻塞其他请求
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(req)
+		}()
+	}
+}
+
+// Unmount 卸载文件系统，Serve 会在卸载后返回
+func (s *Server) Unmount() error {
+	return unmountFuse(s.mountpoint, s.viaFusermount)
+}
+
+// reply 返回响应，errno不为0时忽略数据
+func (s *Server) reply(req *fuseRequest, errno syscall.Errno, data ...[]byte) {
+	var body []byte
+	if errno == 0 {
+		for _, d := range data {
+			body = append(body, d...)
+		}
+	}
+	out := encode(fuseOutHeader{
+		Len:    uint32(fuseOutHeaderSize + len(body)),
+		Error:  -int32(errno),
+		Unique: req.header.Unique,
+	}, body)
+	if _, err := syscall.Write(s.fd, out); err != nil && err != syscall.ENOENT {
+		logger.Verbosef("fuse reply error: opcode=%d %s\n", req.header.Opcode, err)
+	}
+}
+
+// toErrno 转换为FUSE错误码
+func toErrno(err error) syscall.Errno {
+	var errno syscall.Errno
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &errno):
+		return errno
+	case errors.Is(err, os.ErrNotExist):
+		return syscall.ENOENT
+	case errors.Is(err, os.ErrExist):
+		return syscall.EEXIST
+	case errors.Is(err, os.ErrPermission):
+		return syscall.EACCES
+	case errors.Is(err, os.ErrInvalid):
+		return syscall.EINVAL
+	}
+	logger.Verbosef("fuse error: %s\n", err)
+	return syscall.EIO
+}
+
+func (s *Server) handle(req *fuseRequest) {
+	ctx := context.Background()
+	switch req.header.Opcode {
+	case opInit:
+		s.opInit(req)
+	case opLookup:
+		s.opLookup(ctx, req)
+	case opForget:
+		in := fuseForgetIn{}
+		if _, err := req.decode(&in); err == nil {
+			s.forget(req.header.Nodeid, in.Nlookup)
+		}
+	case opBatchForget:
+		s.opBatchForget(req)
+	case opGetattr:
+		s.opGetattr(ctx, req)
+	case opOpen:
+		s.opOpen(ctx, req)
+	case opRead:
+		s.opRead(req)
+	case opSetattr, opCreate, opWrite, opMkdir, opUnlink, opRmdir, opRename, opRename2:
+		// 只读挂载
+		s.reply(req, syscall.EROFS)
+	case opRelease, opReleasedir:
+		s.opRelease(req)
+	case opFlush, opFsync, opFsyncdir:
+		s.reply(req, 0)
+	case opOpendir:
+		s.opOpendir(ctx, req)
+	case opReaddir:
+		s.opReaddir(req)
+	case opStatfs:
+		s.opStatfs(req)
+	case opAccess:
+		in := fuseAccessIn{}
+		if _, err := req.decode(&in); err == nil && in.Mask&accessWrite != 0 {
+			s.reply(req, syscall.EROFS)
+			return
+		}
+		s.reply(req, 0)
+	case opInterrupt:
+		// 不支持中断，请求完成后正常返回
+	default:
+		s.reply(req, syscall.ENOSYS)
+	}
+}
+
+func (s *Server) opInit(req *fuseRequest) {
+	in := fuseInitIn{}
+	if _, err := req.decode(&in); err != nil {
+		s.reply(req, syscall.EINVAL)
+		return
+	}
+	if in.Major != fuseKernelVersion || in.Minor < fuseMinKernelMinor {
+		logger.Verbosef("不支持的FUSE内核协议版本: %d.%d\n", in.Major, in.Minor)
+		s.reply(req, syscall.EPROTO)
+		return
+	}
+	minor := in.Minor
+	if minor > fuseKernelMinorVersion {
+		minor = fuseKernelMinorVersion
+	}
+	s.reply(req, 0, encode(fuseInitOut{
+		Major:               fuseKernelVersion,
+		Minor:               minor,
+		MaxReadahead:        in.MaxReadahead,
+		Flags:               in.Flags & fuseAsyncRead,
+		MaxBackground:       16,
+		CongestionThreshold: 12,
+		MaxWrite:            fuseMaxWrite,
+		TimeGran:            1,
+	}))
+}
+
+// nodePath 节点对应的路径
+func (s *Server) nodePath(ino uint64) (string, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	n, ok := s.nodes[ino]
+	if !ok {
+		return "", false
+	}
+	return n.path, true
+}
+
+// childPath 解析请求中的文件名，返回完整路径
+func (s *Server) childPath(parent uint64, name string) (string, syscall.Errno) {
+	dir, ok := s.nodePath(parent)
+	if !ok {
+		return "", syscall.ENOENT
+	}
+	if name == "" || strings.Contains(name, "/") {
+		return "", syscall.EINVAL
+	}
+	return path.Join(dir, name), 0
+}
+
+// addLookup 内核引用了该路径的节点
+func (s *Server) addLookup(p string) uint64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if ino, ok := s.paths[p]; ok {
+		s.nodes[ino].lookup++
+		return ino
+	}
+	ino := s.nextIno
+	s.nextIno++
+	s.nodes[ino] = &node{path: p, lookup: 1}
+	s.paths[p] = ino
+	return ino
+}
+
+// forget 内核释放了节点的引用
+func (s *Server) forget(ino, nlookup uint64) {
+	if ino == fuseRootId {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	n, ok := s.nodes[ino]
+	if !ok {
+		return
+	}
+	if n.lookup > nlookup {
+		n.lookup -= nlookup
+		return
+	}
+	delete(s.nodes, ino)
+	if s.paths[n.path] == ino {
+		delete(s.paths, n.path)
+	}
+}
+
+func (s *Server) opBatchForget(req *fuseRequest) {
+	in := fuseBatchForgetIn{}
+	rest, err := req.decode(&in)
+	if err != nil {
+		return
+	}
+	r := &fuseRequest{body: rest}
+	for i := uint32(0); i < in.Count; i++ {
+		one := fuseForgetOne{}
+		if r.body, err = r.decode(&one); err != nil {
+			return
+		}
+		s.forget(one.Nodeid, one.Nlookup)
+	}
+}
+
+// stat 获取文件信息
+func (s *Server) stat(ctx context.Context, p string) (os.FileInfo, error) {
+	return s.fs.Stat(ctx, p)
+}
+
+// attr 转换文件属性
+func (s *Server) attr(ino uint64, info os.FileInfo) fuseAttr {
+	a := fuseAttr{
+		Ino:     ino,
+		Size:    uint64(info.Size()),
+		Blocks:  uint64(info.Size()+511) / 512,
+		Nlink:   1,
+		Uid:     s.uid,
+		Gid:     s.gid,
+		Blksize: 4096,
+	}
+	mtime := info.ModTime()
+	a.Mtime, a.Mtimensec = uint64(mtime.Unix()), uint32(mtime.Nanosecond())
+	a.Atime, a.Atimensec = a.Mtime, a.Mtimensec
+	a.Ctime, a.Ctimensec = a.Mtime, a.Mtimensec
+	if info.IsDir() {
+		a.Mode = syscall.S_IFDIR | 0555
+		a.Nlink = 2
+	} else {
+		a.Mode = syscall.S_IFREG | 0444
+	}
+	return a
+}
+
+// entryOut 返回节点信息，同时增加节点引用
+func (s *Server) entryOut(p string, info os.FileInfo) []byte {
+	ino := s.addLookup(p)
+	return encode(fuseEntryOut{
+		Nodeid:     ino,
+		EntryValid: uint64(attrValid / time.Second),
+		AttrValid:  uint64(attrValid / time.Second),
+		Attr:       s.attr(ino, info),
+	})
+}
+
+func (s *Server) attrOut(ino uint64, info os.FileInfo) []byte {
+	return encode(fuseAttrOut{
+		AttrValid: uint64(attrValid / time.Second),
+		Attr:      s.attr(ino, info),
+	})
+}
+
+func (s *Server) opLookup(ctx context.Context, req *fuseRequest) {
+	name, _ := cString(req.body)
+	p, errno := s.childPath(req.header.Nodeid, name)
+	if errno != 0 {
+		s.reply(req, errno)
+		return
+	}
+	info, err := s.stat(ctx, p)
+	if err != nil {
+		s.reply(req, toErrno(err))
+		return
+	}
+	s.reply(req, 0, s.entryOut(p, info))
+}
+
+func (s *Server) opGetattr(ctx context.Context, req *fuseRequest) {
+	p, ok := s.nodePath(req.header.Nodeid)
+	if !ok {
+		s.reply(req, syscall.ENOENT)
+		return
+	}
+	info, err := s.stat(ctx, p)
+	if err != nil {
+		s.reply(req, toErrno(err))
+		return
+	}
+	s.reply(req, 0, s.attrOut(req.header.Nodeid, info))
+}
+
+// addHandle 保存打开的文件，返回文件句柄
+func (s *Server) addHandle(h *handle) uint64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	fh := s.nextHandle
+	s.nextHandle++
+	s.handles[fh] = h
+	return fh
+}
+
+func (s *Server) getHandle(fh uint64) *handle {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.handles[fh]
+}
+
+func (s *Server) opOpen(ctx context.Context, req *fuseRequest) {
+	in := fuseOpenIn{}
+	if _, err := req.decode(&in); err != nil {
+		s.reply(req, syscall.EINVAL)
+		return
+	}
+	p, ok := s.nodePath(req.header.Nodeid)
+	if !ok {
+		s.reply(req, syscall.ENOENT)
+		return
+	}
+	if in.Flags&syscall.O_ACCMODE != syscall.O_RDONLY || in.Flags&syscall.O_TRUNC != 0 {
+		s.reply(req, syscall.EROFS)
+		return
+	}
+	f, err := s.fs.OpenFile(ctx, p, os.O_RDONLY, 0)
+	if err != nil {
+		s.reply(req, toErrno(err))
+		return
+	}
+	h := &handle{path: p, file: f}
+	s.reply(req, 0, encode(fuseOpenOut{Fh: s.addHandle(h)}))
+}
+
+func (s *Server) opRead(req *fuseRequest) {
+	in := fuseReadIn{}
+	if _, err := req.decode(&in); err != nil {
+		s.reply(req, syscall.EINVAL)
+		return
+	}
+	h := s.getHandle(in.Fh)
+	if h == nil {
+		s.reply(req, syscall.EBADF)
+		return
+	}
+	buf := make([]byte, in.Size)
+	var n int
+	var err error
+	if r, ok := h.file.(io.ReaderAt); ok {
+		// 网盘文件通过分片读缓存读取，可以并发读取
+		n, err = r.ReadAt(buf, int64(in.Offset))
+	} else {
+		h.mutex.Lock()
+		if _, err = h.file.Seek(int64(in.Offset), io.SeekStart); err == nil {
+			n, err = io.ReadFull(h.file, buf)
+		}
+		h.mutex.Unlock()
+	}
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		s.reply(req, toErrno(err))
+		return
+	}
+	s.reply(req, 0, buf[:n])
+}
+
+// opRelease 关闭文件
+func (s *Server) opRelease(req *fuseRequest) {
+	in := fuseReleaseIn{}
+	if _, err := req.decode(&in); err != nil {
+		s.reply(req, syscall.EINVAL)
+		return
+	}
+	s.mutex.Lock()
+	h := s.handles[in.Fh]
+	delete(s.handles, in.Fh)
+	s.mutex.Unlock()
+	if h == nil {
+		s.reply(req, 0)
+		return
+	}
+	if h.file != nil {
+		h.mutex.Lock()
+		h.file.Close()
+		h.mutex.Unlock()
+	}
+	s.reply(req, 0)
+}
+
+func (s *Server) opOpendir(ctx context.Context, req *fuseRequest) {
+	p, ok := s.nodePath(req.header.Nodeid)
+	if !ok {
+		s.reply(req, syscall.ENOENT)
+		return
+	}
+	f, err := s.fs.OpenFile(ctx, p, os.O_RDONLY, 0)
+	if err != nil {
+		s.reply(req, toErrno(err))
+		return
+	}
+	defer f.Close()
+	entries, err := f.Readdir(0)
+	if err != nil {
+		s.reply(req, toErrno(err))
+		return
+	}
+	s.reply(req, 0, encode(fuseOpenOut{Fh: s.addHandle(&handle{path: p, entries: entries})}))
+}
+
+// direntIno 目录项的inode，内核不会使用该值查找文件，只需要保证非0
+func direntIno(p string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(p))
+	return h.Sum64() | 1
+}
+
+func (s *Server) opReaddir(req *fuseRequest) {
+	in := fuseReadIn{}
+	if _, err := req.decode(&in); err != nil {
+		s.reply(req, syscall.EINVAL)
+		return
+	}
+	h := s.getHandle(in.Fh)
+	if h == nil {
+		s.reply(req, syscall.EBADF)
+		return
+	}
+	type dirent struct {
+		name  string
+		isDir bool
+	}
+	list := []dirent{{".", true}, {"..", true}}
+	for _, e := range h.entries {
+		list = append(list, dirent{e.Name(), e.IsDir()})
+	}
+	var out []byte
+	for i := in.Offset; i < uint64(len(list)); i++ {
+		d := list[i]
+		typ := uint32(syscall.DT_REG)
+		if d.isDir {
+			typ = syscall.DT_DIR
+		}
+		entry := encode(fuseDirent{
+			Ino:     direntIno(path.Join(h.path, d.name)),
+			Off:     i + 1,
+			Namelen: uint32(len(d.name)),
+			Type:    typ,
+		}, []byte(d.name))
+		// 每个目录项按8字节对齐
+		if pad := len(entry) % 8; pad != 0 {
+			entry = append(entry, make([]byte, 8-pad)...)
+		}
+		if len(out)+len(entry) > int(in.Size) {
+			break
+		}
+		out = append(out, entry...)
+	}
+	s.reply(req, 0, out)
+}
+
+func (s *Server) opStatfs(req *fuseRequest) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if time.Since(s.statfsTime) > statfsValid {
+		const bsize = 4096
+		st := fuseKstatfs{
+			Blocks:  1 << 40 / bsize,
+			Bfree:   1 << 40 / bsize,
+			Bavail:  1 << 40 / bsize,
+			Files:   1 << 20,
+			Ffree:   1 << 20,
+			Bsize:   bsize,
+			Namelen: 255,
+			Frsize:  bsize,
+		}
+		if s.opts.StatFs != nil {
+			if total, used, err := s.opts.StatFs(); err == nil && total >= used {
+				st.Blocks = total / bsize
+				st.Bfree = (total - used) / bsize
+				st.Bavail = st.Bfree
+			}
+		}
+		s.statfs = st
+		s.statfsTime = time.Now()
+	}
+	s.reply(req, 0, encode(s.statfs))
+}
@@ -0,0 +1,222 @@
+//go:build linux
+// +build linux
+
+package mount
+
+import (
+	"bytes"
+	"context"
+	"io/fs"
+	"os"
+	"syscall"
+	"testing"
+
+	"golang.org/x/net/webdav"
+)
+
+// newTestServer 使用内存文件系统创建挂载服务，响应写入管道，不需要真正挂载
+func newTestServer(t *testing.T) (*Server, *os.File) {
+	memFs := webdav.NewMemFS()
+	ctx := context.Background()
+	if err := memFs.Mkdir(ctx, "/docs", 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := memFs.OpenFile(ctx, "/docs/a.txt", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("hello aliyunpan"))
+	f.Close()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		r.Close()
+		w.Close()
+	})
+	s := &Server{
+		fd:         int(w.Fd()),
+		fs:         memFs,
+		opts:       &Options{},
+		nodes:      map[uint64]*node{fuseRootId: {path: "/", lookup: 1}},
+		paths:      map[string]uint64{"/": fuseRootId},
+		nextIno:    fuseRootId + 1,
+		handles:    map[uint64]*handle{},
+		nextHandle: 1,
+	}
+	return s, r
+}
+
+// call 发送请求并读取响应
+func call(t *testing.T, s *Server, r *os.File, opcode uint32, nodeid uint64, body ...interface{}) (syscall.Errno, []byte) {
+	req := &fuseRequest{
+		header: fuseInHeader{Opcode: opcode, Unique: 1, Nodeid: nodeid},
+		body:   encode(body...),
+	}
+	s.handle(req)
+	buf := make([]byte, fuseBufferSize)
+	n, err := r.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := fuseOutHeader{}
+	data, err := (&fuseRequest{body: buf[:n]}).decode(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int(out.Len) != n {
+		t.Fatalf("reply len %d, read %d", out.Len, n)
+	}
+	return syscall.Errno(-out.Error), data
+}
+
+func lookup(t *testing.T, s *Server, r *os.File, parent uint64, name string) fuseEntryOut {
+	errno, data := call(t, s, r, opLookup, parent, []byte(name+"\x00"))
+	if errno != 0 {
+		t.Fatalf("lookup %s: %s", name, errno)
+	}
+	out := fuseEntryOut{}
+	if _, err := (&fuseRequest{body: data}).decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestServerLookupAndRead(t *testing.T) {
+	s, r := newTestServer(t)
+
+	dir := lookup(t, s, r, fuseRootId, "docs")
+	if dir.Attr.Mode&syscall.S_IFDIR == 0 || dir.Attr.Mode&0222 != 0 {
+		t.Fatalf("dir mode %o", dir.Attr.Mode)
+	}
+	file := lookup(t, s, r, dir.Nodeid, "a.txt")
+	if file.Attr.Mode&syscall.S_IFREG == 0 || file.Attr.Mode&0222 != 0 || file.Attr.Size != 15 {
+		t.Fatalf("file attr %+v", file.Attr)
+	}
+	if errno, _ := call(t, s, r, opLookup, dir.Nodeid, []byte("none\x00")); errno != syscall.ENOENT {
+		t.Fatalf("lookup missing: %s", errno)
+	}
+
+	errno, data := call(t, s, r, opOpen, file.Nodeid, fuseOpenIn{Flags: syscall.O_RDONLY})
+	if errno != 0 {
+		t.Fatalf("open: %s", errno)
+	}
+	open := fuseOpenOut{}
+	if _, err := (&fuseRequest{body: data}).decode(&open); err != nil {
+		t.Fatal(err)
+	}
+	errno, data = call(t, s, r, opRead, file.Nodeid, fuseReadIn{Fh: open.Fh, Offset: 6, Size: 100})
+	if errno != 0 || string(data) != "aliyunpan" {
+		t.Fatalf("read: %s %q", errno, data)
+	}
+	if errno, _ = call(t, s, r, opRelease, file.Nodeid, fuseReleaseIn{Fh: open.Fh}); errno != 0 {
+		t.Fatalf("release: %s", errno)
+	}
+	if errno, _ = call(t, s, r, opRead, file.Nodeid, fuseReadIn{Fh: open.Fh, Size: 100}); errno != syscall.EBADF {
+		t.Fatalf("read after release: %s", errno)
+	}
+}
+
+func TestServerReaddir(t *testing.T) {
+	s, r := newTestServer(t)
+	dir := lookup(t, s, r, fuseRootId, "docs")
+
+	errno, data := call(t, s, r, opOpendir, dir.Nodeid)
+	if errno != 0 {
+		t.Fatalf("opendir: %s", errno)
+	}
+	open := fuseOpenOut{}
+	if _, err := (&fuseRequest{body: data}).decode(&open); err != nil {
+		t.Fatal(err)
+	}
+	errno, data = call(t, s, r, opReaddir, dir.Nodeid, fuseReadIn{Fh: open.Fh, Size: 4096})
+	if errno != 0 {
+		t.Fatalf("readdir: %s", errno)
+	}
+	var names []string
+	req := &fuseRequest{body: data}
+	for len(req.body) > 0 {
+		d := fuseDirent{}
+		rest, err := req.decode(&d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, string(rest[:d.Namelen]))
+		size := (binaryDirentSize + int(d.Namelen) + 7) &^ 7
+		req.body = req.body[size:]
+	}
+	if len(names) != 3 || names[0] != "." || names[1] != ".." || names[2] != "a.txt" {
+		t.Fatalf("names %v", names)
+	}
+}
+
+func TestServerReadOnly(t *testing.T) {
+	s, r := newTestServer(t)
+	dir := lookup(t, s, r, fuseRootId, "docs")
+	file := lookup(t, s, r, dir.Nodeid, "a.txt")
+
+	cases := []struct {
+		name   string
+		opcode uint32
+		nodeid uint64
+		body   []interface{}
+	}{
+		{"mkdir", opMkdir, dir.Nodeid, []interface{}{[]byte("new\x00")}},
+		{"create", opCreate, dir.Nodeid, []interface{}{[]byte("b.txt\x00")}},
+		{"write", opWrite, file.Nodeid, nil},
+		{"setattr", opSetattr, file.Nodeid, nil},
+		{"unlink", opUnlink, dir.Nodeid, []interface{}{[]byte("a.txt\x00")}},
+		{"rmdir", opRmdir, fuseRootId, []interface{}{[]byte("docs\x00")}},
+		{"rename", opRename, dir.Nodeid, []interface{}{uint64(fuseRootId), []byte("a.txt\x00b.txt\x00")}},
+		{"open write", opOpen, file.Nodeid, []interface{}{fuseOpenIn{Flags: syscall.O_WRONLY}}},
+		{"open trunc", opOpen, file.Nodeid, []interface{}{fuseOpenIn{Flags: syscall.O_RDONLY | syscall.O_TRUNC}}},
+		{"access write", opAccess, file.Nodeid, []interface{}{fuseAccessIn{Mask: accessWrite}}},
+	}
+	for _, c := range cases {
+		if errno, _ := call(t, s, r, c.opcode, c.nodeid, c.body...); errno != syscall.EROFS {
+			t.Errorf("%s: %s", c.name, errno)
+		}
+	}
+	if errno, _ := call(t, s, r, opAccess, file.Nodeid, fuseAccessIn{Mask: 4}); errno != 0 {
+		t.Errorf("access read: %s", errno)
+	}
+
+	// 文件没有被修改
+	info, err := s.fs.Stat(context.Background(), "/docs/a.txt")
+	if err != nil || info.Size() != 15 {
+		t.Fatalf("file changed: %v %v", info, err)
+	}
+	if _, err := s.fs.Stat(context.Background(), "/docs/new"); err == nil {
+		t.Fatal("mkdir should not create dir")
+	}
+}
+
+func TestToErrno(t *testing.T) {
+	cases := []struct {
+		err  error
+		want syscall.Errno
+	}{
+		{nil, 0},
+		{syscall.EROFS, syscall.EROFS},
+		{&fs.PathError{Op: "open", Path: "/a", Err: fs.ErrNotExist}, syscall.ENOENT},
+		{os.ErrExist, syscall.EEXIST},
+		{os.ErrPermission, syscall.EACCES},
+		{bytes.ErrTooLarge, syscall.EIO},
+	}
+	for _, c := range cases {
+		if got := toErrno(c.err); got != c.want {
+			t.Errorf("toErrno(%v) = %s, want %s", c.err, got, c.want)
+		}
+	}
+}
+
+func TestSupported(t *testing.T) {
+	if !Supported() {
+		t.Fatal("linux should support mount")
+	}
+}
+
+// binaryDirentSize fuseDirent 编码后的大小
+const binaryDirentSize = 24
@@ -0,0 +1,327 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tickstep/library-go/converter"
+	"github.com/tickstep/library-go/logger"
+)
+
+const (
+	// MaxDigestFailedFiles 每个批次在汇总中保留的失败文件数量
+	MaxDigestFailedFiles = 100
+
+	// digestLockTimeout 等待汇总数据文件锁的最长时间
+	digestLockTimeout = 30 * time.Second
+	// digestLockStale 锁文件超过该时间没有释放，认为是进程异常退出遗留的
+	digestLockStale = 5 * time.Minute
+)
+
+type (
+	// DigestBatch 一个上传、下载或者同步批次的统计结果
+	DigestBatch struct {
+		Type         string   `json:"type"`                 // 任务类型，例如：上传、下载、同步
+		Target       string   `json:"target"`               // 目标路径
+		TotalFiles   int      `json:"totalFiles"`           // 文件数量
+		SucceedFiles int      `json:"succeedFiles"`         // 成功的文件数量
+		FailedFiles  int      `json:"failedFiles"`          // 失败的文件数量
+		TotalSize    int64    `json:"totalSize"`            // 传输的数据量，单位：字节
+		Elapsed      int64    `json:"elapsed"`              // 耗时，单位：秒
+		Canceled     bool     `json:"canceled,omitempty"`   // 是否已取消
+		FinishedAt   int64    `json:"finishedAt"`           // 结束时间，Unix时间戳
+		FailedList   []string `json:"failedList,omitempty"` // 失败的文件以及原因
+	}
+
+	// digestData 汇总数据文件的内容
+	digestData struct {
+		LastSentAt int64          `json:"lastSentAt"` // 上一次发送汇总的时间，Unix时间戳
+		Batches    []*DigestBatch `json:"batches"`    // 还没有发送的批次
+	}
+
+	// Digest 每日汇总，记录每个批次的统计和失败清单，每天在固定时间把上次发送之后的所有批次按天聚合成一封邮件发送。
+	// 批次保存在本地文件中，多次运行命令的批次也会合并到同一封汇总。读写数据文件时使用锁文件互斥，
+	// 多个进程同时记录批次或者发送汇总不会互相覆盖。所有方法都支持nil调用
+	Digest struct {
+		file       string
+		sendMinute int // 每天发送汇总的时间，一天中的分钟数
+		mailer     *Mailer
+		mutex      sync.Mutex
+	}
+)
+
+// ParseDigestTime 解析每日汇总的发送时间，格式 HH:MM。off或者空代表关闭
+func ParseDigestTime(value string) (minute int, enabled bool, err error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" || value == "off" {
+		return 0, false, nil
+	}
+	var hour, min int
+	if _, err = fmt.Sscanf(value, "%d:%d", &hour, &min); err != nil || hour < 0 || hour > 23 || min < 0 || min > 59 {
+		return 0, false, fmt.Errorf("每日汇总发送时间格式错误: %s, 示例: 21:00, off", value)
+	}
+	return hour*60 + min, true, nil
+}
+
+// NewDigest 创建每日汇总，file为批次数据保存的文件。汇总关闭时返回nil
+func NewDigest(file, sendTime string, mailer *Mailer) (*Digest, error) {
+	minute, enabled, err := ParseDigestTime(sendTime)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return nil, nil
+	}
+	if mailer == nil {
+		return nil, fmt.Errorf("没有设置汇总邮件的发送账号")
+	}
+	return &Digest{
+		file:       file,
+		sendMinute: minute,
+		mailer:     mailer,
+	}, nil
+}
+
+// lock 锁住汇总数据文件，返回释放锁的函数
+func (d *Digest) lock() (func(), error) {
+	lockFile := d.file + ".lock"
+	deadline := time.Now().Add(digestLockTimeout)
+	for {
+		f, err := os.OpenFile(lockFile, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			f.Close()
+			return func() {
+				os.Remove(lockFile)
+			}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if info, e := os.Stat(lockFile); e == nil && time.Since(info.ModTime()) > digestLockStale {
+			logger.Verboseln("remove stale notify digest lock file: ", lockFile)
+			os.Remove(lockFile)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("等待汇总数据文件锁超时: %s", lockFile)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func (d *Digest) load() *digestData {
+	data := &digestData{}
+	content, err := ioutil.ReadFile(d.file)
+	if err != nil {
+		return data
+	}
+	if err = json.Unmarshal(content, data); err != nil {
+		logger.Verboseln("parse notify digest file error: ", err)
+	}
+	return data
+}
+
+func (d *Digest) save(data *digestData) error {
+	content, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	tmpFile := d.file + ".tmp"
+	if err = ioutil.WriteFile(tmpFile, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, d.file)
+}
+
+// Add 记录一个批次的结果，失败的文件只保留前 MaxDigestFailedFiles 个
+func (d *Digest) Add(batch *DigestBatch) {
+	if d == nil || batch == nil {
+		return
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if batch.FinishedAt == 0 {
+		batch.FinishedAt = time.Now().Unix()
+	}
+	if len(batch.FailedList) > MaxDigestFailedFiles {
+		batch.FailedList = batch.FailedList[:MaxDigestFailedFiles]
+	}
+	unlock, err := d.lock()
+	if err != nil {
+		logger.Verboseln("lock notify digest file error: ", err)
+		return
+	}
+	defer unlock()
+	data := d.load()
+	if data.LastSentAt == 0 {
+		// 第一次记录，从下一个发送时间开始汇总
+		data.LastSentAt = batch.FinishedAt
+	}
+	data.Batches = append(data.Batches, batch)
+	if err := d.save(data); err != nil {
+		logger.Verboseln("save notify digest file error: ", err)
+	}
+}
+
+// lastSendTime now之前最近一次的汇总发送时间
+func (d *Digest) lastSendTime(now time.Time) time.Time {
+	t := time.Date(now.Year(), now.Month(), now.Day(), d.sendMinute/60, d.sendMinute%60, 0, 0, now.Location())
+	if t.After(now) {
+		t = t.AddDate(0, 0, -1)
+	}
+	return t
+}
+
+// SendIfDue 到达发送时间并且今天还没有发送过时发送汇总，返回是否发送了汇总。没有批次时不发送邮件
+func (d *Digest) SendIfDue(now time.Time) (bool, error) {
+	if d == nil {
+		return false, nil
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	unlock, err := d.lock()
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	data := d.load()
+	sendTime := d.lastSendTime(now)
+	if data.LastSentAt >= sendTime.Unix() {
+		return false, nil
+	}
+	if len(data.Batches) == 0 {
+		data.LastSentAt = now.Unix()
+		return false, d.save(data)
+	}
+	subject, body := RenderDigest(data.Batches, now)
+	if err := d.mailer.Send(subject, body); err != nil {
+		return false, err
+	}
+	data.LastSentAt = now.Unix()
+	data.Batches = nil
+	return true, d.save(data)
+}
+
+// SendNow 立即发送汇总，没有批次时返回false
+func (d *Digest) SendNow() (bool, error) {
+	if d == nil {
+		return false, nil
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	unlock, err := d.lock()
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	data := d.load()
+	if len(data.Batches) == 0 {
+		return false, nil
+	}
+	now := time.Now()
+	subject, body := RenderDigest(data.Batches, now)
+	if err := d.mailer.Send(subject, body); err != nil {
+		return false, err
+	}
+	data.LastSentAt = now.Unix()
+	data.Batches = nil
+	return true, d.save(data)
+}
+
+// Run 每分钟检查一次是否到达发送时间，用于daemon、同步备份等常驻进程，stop关闭后退出
+func (d *Digest) Run(stop <-chan struct{}) {
+	if d == nil {
+		return
+	}
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			if sent, err := d.SendIfDue(now); err != nil {
+				fmt.Printf("发送每日汇总邮件失败: %s\n", err)
+			} else if sent {
+				logger.Verboseln("notify digest mail sent")
+			}
+		}
+	}
+}
+
+// RenderDigest 生成汇总邮件的标题和内容，批次按天分组
+func RenderDigest(batches []*DigestBatch, now time.Time) (subject, body string) {
+	sort.SliceStable(batches, func(i, j int) bool {
+		return batches[i].FinishedAt < batches[j].FinishedAt
+	})
+	var (
+		totalFiles, failedFiles int
+		totalSize               int64
+		days                    []string
+		dayBatches              = map[string][]*DigestBatch{}
+	)
+	for _, b := range batches {
+		day := time.Unix(b.FinishedAt, 0).Format("2006-01-02")
+		if _, ok := dayBatches[day]; !ok {
+			days = append(days, day)
+		}
+		dayBatches[day] = append(dayBatches[day], b)
+		totalFiles += b.TotalFiles
+		failedFiles += b.FailedFiles
+		totalSize += b.TotalSize
+	}
+
+	subject = fmt.Sprintf("%s 每日汇总 %s: %d 个批次, %d 个文件", AppName, now.Format("2006-01-02"), len(batches), totalFiles)
+	if failedFiles > 0 {
+		subject += fmt.Sprintf(", %d 个失败", failedFiles)
+	}
+
+	buf := &strings.Builder{}
+	fmt.Fprintf(buf, "批次: %d, 文件: %d, 失败: %d, 数据总量: %s\n", len(batches), totalFiles, failedFiles, converter.ConvertFileSize(totalSize, 2))
+	for _, day := range days {
+		var dayFiles, dayFailed int
+		var daySize int64
+		for _, b := range dayBatches[day] {
+			dayFiles += b.TotalFiles
+			dayFailed += b.FailedFiles
+			daySize += b.TotalSize
+		}
+		fmt.Fprintf(buf, "\n===== %s =====\n", day)
+		fmt.Fprintf(buf, "批次: %d, 文件: %d, 失败: %d, 数据总量: %s\n", len(dayBatches[day]), dayFiles, dayFailed, converter.ConvertFileSize(daySize, 2))
+		for _, b := range dayBatches[day] {
+			status := ""
+			if b.Canceled {
+				status = ", 已取消"
+			}
+			fmt.Fprintf(buf, "[%s] %s %s: 成功 %d, 失败 %d, 数据量 %s, 耗时 %s%s\n",
+				time.Unix(b.FinishedAt, 0).Format("15:04:05"), b.Type, b.Target, b.SucceedFiles, b.FailedFiles,
+				converter.ConvertFileSize(b.TotalSize, 2), time.Duration(b.Elapsed)*time.Second, status)
+			for _, f := range b.FailedList {
+				fmt.Fprintf(buf, "    失败: %s\n", f)
+			}
+			if b.FailedFiles > len(b.FailedList) && len(b.FailedList) > 0 {
+				fmt.Fprintf(buf, "    ... 还有 %d 个失败的文件\n", b.FailedFiles-len(b.FailedList))
+			}
+		}
+	}
+	return subject, buf.String()
+}
@@ -0,0 +1,49 @@
+package notify
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDigestConcurrentAdd(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "notify_digest.json")
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// 每个Digest模拟一个独立的进程，只能依靠锁文件互斥
+			d := &Digest{file: file}
+			d.Add(&DigestBatch{Type: "上传", TotalFiles: 1})
+		}()
+	}
+	wg.Wait()
+
+	d := &Digest{file: file}
+	if n := len(d.load().Batches); n != 20 {
+		t.Fatalf("expect 20 batches, got %d", n)
+	}
+	if _, err := os.Stat(file + ".lock"); !os.IsNotExist(err) {
+		t.Fatalf("lock file should be removed: %v", err)
+	}
+}
+
+func TestDigestStaleLock(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "notify_digest.json")
+	lockFile := file + ".lock"
+	if err := os.WriteFile(lockFile, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-digestLockStale - time.Minute)
+	if err := os.Chtimes(lockFile, old, old); err != nil {
+		t.Fatal(err)
+	}
+	d := &Digest{file: file}
+	d.Add(&DigestBatch{Type: "下载"})
+	if n := len(d.load().Batches); n != 1 {
+		t.Fatalf("stale lock should be removed, got %d batches", n)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package notify 系统桌面通知，长任务结束时提醒桌面用户，支持macOS、Windows以及Linux
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tickstep/library-go/logger"
+)
+
+const (
+	// AppName 通知显示的应用名称
+	AppName = "aliyunpan"
+)
+
+// ParseThreshold 解析桌面通知配置。off或者空代表关闭，on代表所有任务都通知，时长例如10m代表耗时超过10分钟的任务才通知
+func ParseThreshold(value string) (threshold time.Duration, enabled bool, err error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch value {
+	case "", "off":
+		return 0, false, nil
+	case "on":
+		return 0, true, nil
+	}
+	threshold, err = time.ParseDuration(value)
+	if err != nil || threshold < 0 {
+		return 0, false, fmt.Errorf("桌面通知配置格式错误: %s, 示例: on, off, 10m", value)
+	}
+	return threshold, true, nil
+}
+
+// TaskFinished 任务结束时按配置发送桌面通知，耗时未达到阈值或者通知关闭时不发送。
+// failed 为失败的文件数量，summary 为通知的内容
+func TaskFinished(config, name string, elapsed time.Duration, failed int, summary string) {
+	threshold, enabled, err := ParseThreshold(config)
+	if err != nil || !enabled || elapsed < threshold {
+		return
+	}
+	title := fmt.Sprintf("%s %s完成", AppName, name)
+	if failed > 0 {
+		title = fmt.Sprintf("%s %s结束, %d 个文件失败", AppName, name, failed)
+	}
+	message := fmt.Sprintf("%s, 耗时 %s", summary, elapsed.Round(time.Second))
+	if err = Send(title, message); err != nil {
+		logger.Verboseln("send desktop notification error: ", err)
+	}
+}
+
+// Send 发送桌面通知
+func Send(title, message string) error {
+	return send(title, message)
+}
@@ -0,0 +1,16 @@
+//go:build darwin
+// +build darwin
+
+package notify
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+)
+
+// send 使用osascript发送通知中心通知
+func send(title, message string) error {
+	script := fmt.Sprintf("display notification %s with title %s", strconv.Quote(message), strconv.Quote(title))
+	return exec.Command("osascript", "-e", script).Run()
+}
@@ -0,0 +1,18 @@
+//go:build linux
+// +build linux
+
+package notify
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// send 使用notify-send发送通知，需要安装libnotify并且运行在桌面环境中
+func send(title, message string) error {
+	bin, err := exec.LookPath("notify-send")
+	if err != nil {
+		return fmt.Errorf("没有找到notify-send, 请安装libnotify: %w", err)
+	}
+	return exec.Command(bin, "-a", AppName, title, message).Run()
+}
@@ -0,0 +1,13 @@
+//go:build !darwin && !linux && !windows
+// +build !darwin,!linux,!windows
+
+package notify
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func send(title, message string) error {
+	return fmt.Errorf("当前系统不支持桌面通知: %s", runtime.GOOS)
+}
@@ -0,0 +1,33 @@
+//go:build windows
+// +build windows
+
+package notify
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+const (
+	// powershellAppId 使用PowerShell的AppUserModelID发送通知，未注册的AppId在Windows 10上不会显示通知
+	powershellAppId = `{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}\WindowsPowerShell\v1.0\powershell.exe`
+
+	toastScript = `[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null
+$template = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$texts = $template.GetElementsByTagName('text')
+$texts.Item(0).AppendChild($template.CreateTextNode('%s')) > $null
+$texts.Item(1).AppendChild($template.CreateTextNode('%s')) > $null
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('%s').Show([Windows.UI.Notifications.ToastNotification]::new($template))`
+)
+
+// psQuote 转义PowerShell单引号字符串
+func psQuote(s string) string {
+	return strings.ReplaceAll(s, "'", "''")
+}
+
+// send 使用PowerShell发送Toast通知
+func send(title, message string) error {
+	script := fmt.Sprintf(toastScript, psQuote(title), psQuote(message), psQuote(powershellAppId))
+	return exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", script).Run()
+}
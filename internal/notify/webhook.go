@@ -0,0 +1,291 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/tickstep/library-go/logger"
+)
+
+const (
+	// EventUploadSuccess 上传批次全部成功
+	EventUploadSuccess = "upload.success"
+	// EventUploadFail 上传批次有文件失败或者被取消
+	EventUploadFail = "upload.fail"
+	// EventSyncFinish 同步备份完成一次扫描-执行循环
+	EventSyncFinish = "sync.finish"
+	// EventQuotaWarning 网盘容量或者目标目录配额不足
+	EventQuotaWarning = "quota.warning"
+	// EventTokenRefreshFail 刷新登录Token失败
+	EventTokenRefreshFail = "token.fail"
+
+	// webhookMaxRetry 单次推送失败的最大重试次数
+	webhookMaxRetry = 3
+	// webhookQueueSize 异步推送队列的长度，队列已满时丢弃新的事件
+	webhookQueueSize = 64
+)
+
+// WebhookEvents 支持的全部事件
+var WebhookEvents = []string{EventUploadSuccess, EventUploadFail, EventSyncFinish, EventQuotaWarning, EventTokenRefreshFail}
+
+type (
+	// WebhookEvent 推送的事件，没有设置模板时直接以JSON格式推送
+	WebhookEvent struct {
+		Event     string      `json:"event"`          // 事件类型
+		Title     string      `json:"title"`          // 标题
+		Message   string      `json:"message"`        // 内容
+		Data      interface{} `json:"data,omitempty"` // 事件数据，例如上传批次的统计
+		Timestamp int64       `json:"timestamp"`      // 事件时间，Unix时间戳
+	}
+
+	// Webhook 任务事件通知，使用HTTP POST把事件推送到指定URL，可以通过模板适配Slack、钉钉、Telegram等机器人。
+	// Post 把事件放入有界队列后立即返回，由后台协程推送和重试，不会阻塞上传、同步等任务。所有方法都支持nil调用
+	Webhook struct {
+		url      string
+		headers  map[string]string
+		template *template.Template
+		events   map[string]bool // 推送的事件，nil代表全部
+		client   *http.Client
+
+		queue     chan *WebhookEvent
+		queueOnce sync.Once
+		pending   sync.WaitGroup // 队列中还没有推送完成的事件
+	}
+)
+
+// Text 标题和内容，方便模板中直接使用
+func (e *WebhookEvent) Text() string {
+	if e.Message == "" {
+		return e.Title
+	}
+	return e.Title + "\n" + e.Message
+}
+
+// ParseWebhookHeaders 解析附加的请求头，格式: Name=Value，多个用逗号隔开
+func ParseWebhookHeaders(value string) (map[string]string, error) {
+	headers := map[string]string{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		idx := strings.Index(item, "=")
+		if idx <= 0 {
+			return nil, fmt.Errorf("请求头格式错误: %s, 示例: Authorization=Bearer xxx,X-Token=abc", item)
+		}
+		headers[strings.TrimSpace(item[:idx])] = strings.TrimSpace(item[idx+1:])
+	}
+	return headers, nil
+}
+
+// ParseWebhookTemplate 解析请求内容模板，使用Go text/template语法，以@开头时从文件读取模板。为空返回nil
+func ParseWebhookTemplate(value string) (*template.Template, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(value, "@") {
+		data, err := ioutil.ReadFile(value[1:])
+		if err != nil {
+			return nil, fmt.Errorf("读取模板文件失败: %s", err)
+		}
+		value = string(data)
+	}
+	tmpl, err := template.New("webhook").Funcs(template.FuncMap{
+		// json 转换为JSON值，字符串会加上引号并转义
+		"json": func(v interface{}) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+	}).Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("模板格式错误: %s", err)
+	}
+	return tmpl, nil
+}
+
+// ParseWebhookEvents 解析需要推送的事件，多个用逗号隔开，为空返回nil代表全部
+func ParseWebhookEvents(value string) (map[string]bool, error) {
+	var events map[string]bool
+	for _, event := range strings.Split(value, ",") {
+		event = strings.ToLower(strings.TrimSpace(event))
+		if event == "" {
+			continue
+		}
+		known := false
+		for _, e := range WebhookEvents {
+			if e == event {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("未知的事件: %s, 支持: %s", event, strings.Join(WebhookEvents, ", "))
+		}
+		if events == nil {
+			events = map[string]bool{}
+		}
+		events[event] = true
+	}
+	return events, nil
+}
+
+// NewWebhook 创建任务事件通知，webhookUrl为空返回nil
+func NewWebhook(webhookUrl, headers, tmpl, events string) (*Webhook, error) {
+	webhookUrl = strings.TrimSpace(webhookUrl)
+	if webhookUrl == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(webhookUrl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("Webhook地址格式错误: %s", webhookUrl)
+	}
+	w := &Webhook{
+		url:    webhookUrl,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+	if w.headers, err = ParseWebhookHeaders(headers); err != nil {
+		return nil, err
+	}
+	if w.template, err = ParseWebhookTemplate(tmpl); err != nil {
+		return nil, err
+	}
+	if w.events, err = ParseWebhookEvents(events); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Render 生成推送的请求内容
+func (w *Webhook) Render(event *WebhookEvent) ([]byte, error) {
+	if w.template == nil {
+		return json.Marshal(event)
+	}
+	buf := &bytes.Buffer{}
+	if err := w.template.Execute(buf, event); err != nil {
+		return nil, fmt.Errorf("生成Webhook内容失败: %s", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Send 推送事件，没有订阅的事件直接忽略。失败时重试，仍然失败返回错误
+func (w *Webhook) Send(event *WebhookEvent) (err error) {
+	if w == nil || event == nil {
+		return nil
+	}
+	if w.events != nil && !w.events[event.Event] {
+		return nil
+	}
+	if event.Timestamp == 0 {
+		event.Timestamp = time.Now().Unix()
+	}
+	body, err := w.Render(event)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < webhookMaxRetry; i++ {
+		if i > 0 {
+			time.Sleep(time.Duration(i) * time.Second)
+		}
+		if err = w.post(body); err == nil {
+			return nil
+		}
+		logger.Verboseln("webhook error: ", err)
+	}
+	return err
+}
+
+// Post 异步推送事件，放入队列后立即返回。队列已满时丢弃事件并返回false
+func (w *Webhook) Post(event *WebhookEvent) bool {
+	if w == nil || event == nil {
+		return true
+	}
+	if w.events != nil && !w.events[event.Event] {
+		return true
+	}
+	if event.Timestamp == 0 {
+		event.Timestamp = time.Now().Unix()
+	}
+	w.queueOnce.Do(func() {
+		w.queue = make(chan *WebhookEvent, webhookQueueSize)
+		go w.run()
+	})
+	w.pending.Add(1)
+	select {
+	case w.queue <- event:
+		return true
+	default:
+		w.pending.Done()
+		logger.Verboseln("webhook queue is full, drop event: ", event.Event)
+		return false
+	}
+}
+
+// Wait 等待队列中的事件推送完成，最多等待timeout，全部推送完成返回true。用于命令退出前
+func (w *Webhook) Wait(timeout time.Duration) bool {
+	if w == nil {
+		return true
+	}
+	done := make(chan struct{})
+	go func() {
+		w.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// run 后台推送队列中的事件
+func (w *Webhook) run() {
+	for event := range w.queue {
+		if err := w.Send(event); err != nil {
+			fmt.Printf("推送Webhook通知失败: %s\n", err)
+		}
+		w.pending.Done()
+	}
+}
+
+func (w *Webhook) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	for name, value := range w.headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook response status: %s", resp.Status)
+	}
+	return nil
+}
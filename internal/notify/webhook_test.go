@@ -0,0 +1,96 @@
+package notify
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhookSend(t *testing.T) {
+	var (
+		mutex   sync.Mutex
+		bodies  []string
+		headers []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		mutex.Lock()
+		bodies = append(bodies, string(data))
+		headers = append(headers, r.Header.Get("X-Token"))
+		mutex.Unlock()
+	}))
+	defer server.Close()
+
+	w, err := NewWebhook(server.URL, "X-Token=abc", `{"text": {{json .Text}}}`, "upload.success")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Send(&WebhookEvent{Event: EventUploadSuccess, Title: "上传完成", Message: "成功 1 个"}); err != nil {
+		t.Fatal(err)
+	}
+	// 没有订阅的事件不推送
+	if err = w.Send(&WebhookEvent{Event: EventUploadFail, Title: "上传失败"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(bodies) != 1 || bodies[0] != `{"text": "上传完成\n成功 1 个"}` || headers[0] != "abc" {
+		t.Fatalf("unexpected request: %q %q", bodies, headers)
+	}
+}
+
+func TestWebhookSendRetry(t *testing.T) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&count, 1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	w, _ := NewWebhook(server.URL, "", "", "")
+	if err := w.Send(&WebhookEvent{Event: EventSyncFinish}); err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Fatalf("expect retry once, got %d requests", count)
+	}
+}
+
+func TestWebhookPost(t *testing.T) {
+	release := make(chan struct{})
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		atomic.AddInt32(&count, 1)
+	}))
+	defer server.Close()
+
+	w, _ := NewWebhook(server.URL, "", "", "")
+	start := time.Now()
+	// 第一个事件被后台协程取出后阻塞在服务端，队列还能放下 webhookQueueSize 个事件
+	accepted := 0
+	for i := 0; i < webhookQueueSize+10; i++ {
+		if w.Post(&WebhookEvent{Event: EventUploadSuccess}) {
+			accepted++
+		}
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("post should not block")
+	}
+	if accepted < webhookQueueSize || accepted > webhookQueueSize+1 {
+		t.Fatalf("queue should be bounded, accepted %d", accepted)
+	}
+	if w.Wait(100 * time.Millisecond) {
+		t.Fatal("wait should time out while server is blocked")
+	}
+	close(release)
+	if !w.Wait(5 * time.Second) {
+		t.Fatal("queued events should be sent")
+	}
+	if int(count) != accepted {
+		t.Fatalf("expect %d requests, got %d", accepted, count)
+	}
+}
@@ -47,6 +47,18 @@ func (p *IdlePlugin) SyncFileFinishCallback(context *Context, params *SyncFileFi
 func (p *IdlePlugin) SyncAllFileFinishCallback(context *Context, params *SyncAllFileFinishParams) error {
 	return nil
 }
+
+func (p *IdlePlugin) SyncScanStartCallback(context *Context, params *SyncScanStartParams) error {
+	return nil
+}
+
+func (p *IdlePlugin) SyncScanFinishCallback(context *Context, params *SyncScanFinishParams) error {
+	return nil
+}
+
+func (p *IdlePlugin) TaskBatchFinishCallback(context *Context, params *TaskBatchFinishParams) error {
+	return nil
+}
 func (p *IdlePlugin) UserTokenRefreshFinishCallback(context *Context, params *UserTokenRefreshFinishParams) error {
 	return nil
 }
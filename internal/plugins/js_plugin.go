@@ -6,12 +6,16 @@ import (
 	"github.com/tickstep/aliyunpan/internal/config"
 	"github.com/tickstep/library-go/logger"
 	"strings"
+	"sync"
 )
 
 type (
 	JsPlugin struct {
 		Name string
 		vm   *goja.Runtime
+
+		scope      *PanScope // 当前回调函数可以操作的网盘范围
+		scopeMutex sync.Mutex
 	}
 )
 
@@ -70,6 +74,16 @@ func (js *JsPlugin) Start() error {
 	panFS := js.vm.NewObject()
 	pluginObj.Set("PanFS", panFS)
 	panFS.Set("deleteFile", DeletePanFile) // PluginUtil.PanFS.deleteFile()
+	// 以下函数只能操作触发当前回调的用户和网盘
+	panFS.Set("getFileInfo", func(userId, driveId, panFilePath string) *PanFileInfo { // PluginUtil.PanFS.getFileInfo()
+		return GetPanFileInfo(js.currentScope(), userId, driveId, panFilePath)
+	})
+	panFS.Set("createShare", func(userId, driveId, panFileId, sharePwd string, expiredDays int) string { // PluginUtil.PanFS.createShare()
+		return CreatePanShare(js.currentScope(), userId, driveId, panFileId, sharePwd, expiredDays)
+	})
+	panFS.Set("moveFile", func(userId, driveId, panFileId, targetPanDirPath string) bool { // PluginUtil.PanFS.moveFile()
+		return MovePanFile(js.currentScope(), userId, driveId, panFileId, targetPanDirPath)
+	})
 
 	// PluginUtil.Email
 	emailObj := js.vm.NewObject()
@@ -102,6 +116,38 @@ func (js *JsPlugin) LoadScript(script string) error {
 	return nil
 }
 
+// LoadScriptFile 加载脚本，错误信息中包含脚本文件名和行号
+func (js *JsPlugin) LoadScriptFile(fileName, script string) error {
+	_, err := js.vm.RunScript(fileName, script)
+	if err != nil {
+		logger.Verboseln("JS代码有问题！", err)
+		return err
+	}
+	return nil
+}
+
+// enterScope 进入回调函数，插件只能操作触发回调的用户和网盘，返回退出回调的函数
+func (js *JsPlugin) enterScope(context *Context, driveId string) func() {
+	js.scopeMutex.Lock()
+	defer js.scopeMutex.Unlock()
+	js.scope = &PanScope{DriveId: driveId}
+	if context != nil {
+		js.scope.UserId = context.UserId
+	}
+	return func() {
+		js.scopeMutex.Lock()
+		defer js.scopeMutex.Unlock()
+		js.scope = nil
+	}
+}
+
+// currentScope 当前回调函数可以操作的网盘范围，不在回调函数中时返回nil
+func (js *JsPlugin) currentScope() *PanScope {
+	js.scopeMutex.Lock()
+	defer js.scopeMutex.Unlock()
+	return js.scope
+}
+
 func (js *JsPlugin) isHandlerFuncExisted(fnName string) bool {
 	ret := js.vm.Get(fnName)
 	if ret != nil {
@@ -121,6 +167,7 @@ func (js *JsPlugin) UploadFilePrepareCallback(context *Context, params *UploadFi
 		logger.Verboseln("Js函数映射到 Go 函数失败！")
 		return nil, nil
 	}
+	defer js.enterScope(context, params.DriveId)()
 	r, er := fn(context, params)
 	if er != nil {
 		logger.Verboseln(er)
@@ -140,6 +187,7 @@ func (js *JsPlugin) UploadFileFinishCallback(context *Context, params *UploadFil
 		logger.Verboseln("Js函数映射到 Go 函数失败！")
 		return nil
 	}
+	defer js.enterScope(context, params.DriveId)()
 	er := fn(context, params)
 	if er != nil {
 		logger.Verboseln(er)
@@ -159,6 +207,7 @@ func (js *JsPlugin) DownloadFilePrepareCallback(context *Context, params *Downlo
 		logger.Verboseln("Js函数映射到 Go 函数失败！")
 		return nil, nil
 	}
+	defer js.enterScope(context, params.DriveId)()
 	r, er := fn(context, params)
 	if er != nil {
 		logger.Verboseln(er)
@@ -178,6 +227,7 @@ func (js *JsPlugin) DownloadFileFinishCallback(context *Context, params *Downloa
 		logger.Verboseln("Js函数映射到 Go 函数失败！")
 		return nil
 	}
+	defer js.enterScope(context, params.DriveId)()
 	er := fn(context, params)
 	if er != nil {
 		logger.Verboseln(er)
@@ -197,6 +247,7 @@ func (js *JsPlugin) SyncScanLocalFilePrepareCallback(context *Context, params *S
 		logger.Verboseln("Js函数映射到 Go 函数失败！")
 		return nil, nil
 	}
+	defer js.enterScope(context, params.DriveId)()
 	r, er := fn(context, params)
 	if er != nil {
 		logger.Verboseln(er)
@@ -216,6 +267,7 @@ func (js *JsPlugin) SyncScanPanFilePrepareCallback(context *Context, params *Syn
 		logger.Verboseln("Js函数映射到 Go 函数失败！")
 		return nil, nil
 	}
+	defer js.enterScope(context, params.DriveId)()
 	r, er := fn(context, params)
 	if er != nil {
 		logger.Verboseln(er)
@@ -235,6 +287,7 @@ func (js *JsPlugin) SyncFileFinishCallback(context *Context, params *SyncFileFin
 		logger.Verboseln("Js函数映射到 Go 函数失败！")
 		return nil
 	}
+	defer js.enterScope(context, params.DriveId)()
 	er := fn(context, params)
 	if er != nil {
 		logger.Verboseln(er)
@@ -254,6 +307,67 @@ func (js *JsPlugin) SyncAllFileFinishCallback(context *Context, params *SyncAllF
 		logger.Verboseln("Js函数映射到 Go 函数失败！")
 		return nil
 	}
+	defer js.enterScope(context, params.DriveId)()
+	er := fn(context, params)
+	if er != nil {
+		logger.Verboseln(er)
+		return nil
+	}
+	return nil
+}
+
+// SyncScanStartCallback 同步备份-开始一轮文件扫描时的回调函数
+func (js *JsPlugin) SyncScanStartCallback(context *Context, params *SyncScanStartParams) error {
+	var fn func(*Context, *SyncScanStartParams) error
+	if !js.isHandlerFuncExisted("syncScanStartCallback") {
+		return nil
+	}
+	err := js.vm.ExportTo(js.vm.Get("syncScanStartCallback"), &fn)
+	if err != nil {
+		logger.Verboseln("Js函数映射到 Go 函数失败！")
+		return nil
+	}
+	defer js.enterScope(context, params.DriveId)()
+	er := fn(context, params)
+	if er != nil {
+		logger.Verboseln(er)
+		return nil
+	}
+	return nil
+}
+
+// SyncScanFinishCallback 同步备份-完成一轮文件扫描时的回调函数
+func (js *JsPlugin) SyncScanFinishCallback(context *Context, params *SyncScanFinishParams) error {
+	var fn func(*Context, *SyncScanFinishParams) error
+	if !js.isHandlerFuncExisted("syncScanFinishCallback") {
+		return nil
+	}
+	err := js.vm.ExportTo(js.vm.Get("syncScanFinishCallback"), &fn)
+	if err != nil {
+		logger.Verboseln("Js函数映射到 Go 函数失败！")
+		return nil
+	}
+	defer js.enterScope(context, params.DriveId)()
+	er := fn(context, params)
+	if er != nil {
+		logger.Verboseln(er)
+		return nil
+	}
+	return nil
+}
+
+// TaskBatchFinishCallback 一批上传、下载任务全部结束时的回调函数
+func (js *JsPlugin) TaskBatchFinishCallback(context *Context, params *TaskBatchFinishParams) error {
+	var fn func(*Context, *TaskBatchFinishParams) error
+	if !js.isHandlerFuncExisted("taskBatchFinishCallback") {
+		return nil
+	}
+	err := js.vm.ExportTo(js.vm.Get("taskBatchFinishCallback"), &fn)
+	if err != nil {
+		logger.Verboseln("Js函数映射到 Go 函数失败！")
+		return nil
+	}
+	defer js.enterScope(context, params.DriveId)()
 	er := fn(context, params)
 	if er != nil {
 		logger.Verboseln(er)
@@ -273,6 +387,7 @@ func (js *JsPlugin) UserTokenRefreshFinishCallback(context *Context, params *Use
 		logger.Verboseln("Js函数映射到 Go 函数失败！")
 		return nil
 	}
+	defer js.enterScope(context, "")()
 	er := fn(context, params)
 	if er != nil {
 		logger.Verboseln(er)
@@ -292,6 +407,12 @@ func (js *JsPlugin) RemoveFilePrepareCallback(context *Context, params *RemoveFi
 		logger.Verboseln("Js函数映射到 Go 函数失败！")
 		return nil, nil
 	}
+	// 删除的文件都在同一个网盘中
+	driveId := ""
+	if params != nil && len(params.Items) > 0 {
+		driveId = params.Items[0].DriveId
+	}
+	defer js.enterScope(context, driveId)()
 	r, er := fn(context, params)
 	if er != nil {
 		logger.Verboseln(er)
@@ -300,6 +421,16 @@ func (js *JsPlugin) RemoveFilePrepareCallback(context *Context, params *RemoveFi
 	return r, nil
 }
 
+// Interrupt 中断正在执行的脚本，只能中断JS代码，无法中断阻塞在Go内置函数中的调用
+func (js *JsPlugin) Interrupt(v interface{}) {
+	js.vm.Interrupt(v)
+}
+
+// ClearInterrupt 清除中断标记，脚本执行结束后才能调用
+func (js *JsPlugin) ClearInterrupt() {
+	js.vm.ClearInterrupt()
+}
+
 func (js *JsPlugin) Stop() error {
 	return nil
 }
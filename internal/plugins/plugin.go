@@ -165,6 +165,72 @@ type (
 		Policy string `json:"policy"`
 	}
 
+	// SyncScanStartParams 同步备份-开始一轮文件扫描-回调参数
+	SyncScanStartParams struct {
+		// Name 任务名称
+		Name string `json:"name"`
+		// Id 任务ID
+		Id string `json:"id"`
+		// DriveId 网盘ID
+		DriveId string `json:"driveId"`
+		// LocalFolderPath 本地目录
+		LocalFolderPath string `json:"localFolderPath"`
+		// PanFolderPath 云盘目录
+		PanFolderPath string `json:"panFolderPath"`
+		// Mode 备份模式
+		Mode string `json:"mode"`
+		// ScanTarget 扫描对象，local-本地文件，pan-云盘文件
+		ScanTarget string `json:"scanTarget"`
+		// StartedAt 开始扫描的时间，格式：2025-03-03 10:39:14
+		StartedAt string `json:"startedAt"`
+	}
+
+	// SyncScanFinishParams 同步备份-完成一轮文件扫描-回调参数
+	SyncScanFinishParams struct {
+		// Name 任务名称
+		Name string `json:"name"`
+		// Id 任务ID
+		Id string `json:"id"`
+		// DriveId 网盘ID
+		DriveId string `json:"driveId"`
+		// LocalFolderPath 本地目录
+		LocalFolderPath string `json:"localFolderPath"`
+		// PanFolderPath 云盘目录
+		PanFolderPath string `json:"panFolderPath"`
+		// Mode 备份模式
+		Mode string `json:"mode"`
+		// ScanTarget 扫描对象，local-本地文件，pan-云盘文件
+		ScanTarget string `json:"scanTarget"`
+		// StartedAt 开始扫描的时间，格式：2025-03-03 10:39:14
+		StartedAt string `json:"startedAt"`
+		// FinishedAt 完成扫描的时间，格式：2025-03-03 10:39:14
+		FinishedAt string `json:"finishedAt"`
+	}
+
+	// TaskBatchFinishParams 一批上传、下载任务全部结束-回调参数
+	TaskBatchFinishParams struct {
+		// TaskType 任务类型，upload-上传，download-下载
+		TaskType string `json:"taskType"`
+		// DriveId 网盘ID
+		DriveId string `json:"driveId"`
+		// Target 上传的网盘目标目录，或者下载保存的本地目录
+		Target string `json:"target"`
+		// TotalCount 文件总数
+		TotalCount int `json:"totalCount"`
+		// SucceedCount 成功的文件数
+		SucceedCount int `json:"succeedCount"`
+		// FailedCount 失败的文件数
+		FailedCount int `json:"failedCount"`
+		// TotalSize 传输的数据总量，单位字节
+		TotalSize int64 `json:"totalSize"`
+		// Elapsed 耗时，单位秒
+		Elapsed int64 `json:"elapsed"`
+		// Canceled 是否被取消
+		Canceled bool `json:"canceled"`
+		// FinishedAt 结束的时间，格式：2025-03-03 10:39:14
+		FinishedAt string `json:"finishedAt"`
+	}
+
 	// UserTokenRefreshFinishParams 用户Token刷新完成后回调函数
 	UserTokenRefreshFinishParams struct {
 		Result    string `json:"result"`
@@ -239,6 +305,15 @@ type (
 		// SyncAllFileFinishCallback 同步备份-同步全部文件完成时的回调函数
 		SyncAllFileFinishCallback(context *Context, params *SyncAllFileFinishParams) error
 
+		// SyncScanStartCallback 同步备份-开始一轮文件扫描时的回调函数
+		SyncScanStartCallback(context *Context, params *SyncScanStartParams) error
+
+		// SyncScanFinishCallback 同步备份-完成一轮文件扫描时的回调函数
+		SyncScanFinishCallback(context *Context, params *SyncScanFinishParams) error
+
+		// TaskBatchFinishCallback 一批上传、下载任务全部结束时的回调函数
+		TaskBatchFinishCallback(context *Context, params *TaskBatchFinishParams) error
+
 		// UserTokenRefreshFinishCallback 用户Token刷新完成后回调函数
 		UserTokenRefreshFinishCallback(context *Context, params *UserTokenRefreshFinishParams) error
 
@@ -0,0 +1,188 @@
+package plugins
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/parser"
+)
+
+const (
+	// ScriptIssueError 脚本错误，插件无法正常加载或者回调函数无法调用
+	ScriptIssueError = "error"
+	// ScriptIssueWarning 脚本警告，插件可以加载，但是可能不符合预期
+	ScriptIssueWarning = "warning"
+
+	// hookParamCount 回调函数的参数个数，分别为 context, params
+	hookParamCount = 2
+)
+
+var (
+	// HookFuncNames 插件支持的回调函数
+	HookFuncNames = []string{
+		"uploadFilePrepareCallback",
+		"uploadFileFinishCallback",
+		"downloadFilePrepareCallback",
+		"downloadFileFinishCallback",
+		"syncScanLocalFilePrepareCallback",
+		"syncScanPanFilePrepareCallback",
+		"syncFileFinishCallback",
+		"syncAllFileFinishCallback",
+		"syncScanStartCallback",
+		"syncScanFinishCallback",
+		"taskBatchFinishCallback",
+		"userTokenRefreshFinishCallback",
+		"removeFilePrepareCallback",
+	}
+)
+
+type (
+	// ScriptIssue 插件脚本检查发现的问题，Line 为0代表无法定位到行
+	ScriptIssue struct {
+		File    string `json:"file"`
+		Line    int    `json:"line"`
+		Column  int    `json:"column"`
+		Level   string `json:"level"`
+		Message string `json:"message"`
+	}
+)
+
+func (i *ScriptIssue) String() string {
+	if i.Line > 0 {
+		return fmt.Sprintf("%s:%d:%d: [%s] %s", i.File, i.Line, i.Column, i.Level, i.Message)
+	}
+	return fmt.Sprintf("%s: [%s] %s", i.File, i.Level, i.Message)
+}
+
+func isHookFuncName(name string) bool {
+	for _, n := range HookFuncNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// similarHookFuncName 和函数名相近的回调函数名，用于提示拼写错误，没有相近的返回空字符串
+func similarHookFuncName(name string) string {
+	for _, n := range HookFuncNames {
+		if editDistance(strings.ToLower(name), strings.ToLower(n)) <= 2 {
+			return n
+		}
+	}
+	return ""
+}
+
+// editDistance 两个字符串的编辑距离
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// CheckScript 检查插件脚本的语法以及回调函数的签名，没有问题时返回空列表
+func CheckScript(fileName, script string) []*ScriptIssue {
+	issues := []*ScriptIssue{}
+	program, err := parser.ParseFile(nil, fileName, script, 0)
+	if err != nil {
+		if errList, ok := err.(parser.ErrorList); ok {
+			for _, e := range errList {
+				issues = append(issues, &ScriptIssue{
+					File:    fileName,
+					Line:    e.Position.Line,
+					Column:  e.Position.Column,
+					Level:   ScriptIssueError,
+					Message: "语法错误: " + e.Message,
+				})
+			}
+		} else {
+			issues = append(issues, &ScriptIssue{File: fileName, Level: ScriptIssueError, Message: err.Error()})
+		}
+		return issues
+	}
+
+	// 顶层声明的函数位置，用于定位回调函数
+	funcPos := map[string]*ScriptIssue{}
+	for _, stmt := range program.Body {
+		fd, ok := stmt.(*ast.FunctionDeclaration)
+		if !ok || fd.Function.Name == nil {
+			continue
+		}
+		name := string(fd.Function.Name.Name)
+		pos := program.File.Position(int(fd.Function.Function) - program.File.Base())
+		funcPos[name] = &ScriptIssue{File: fileName, Line: pos.Line, Column: pos.Column}
+		if isHookFuncName(name) {
+			continue
+		}
+		if similar := similarHookFuncName(name); similar != "" {
+			issues = append(issues, &ScriptIssue{
+				File:    fileName,
+				Line:    pos.Line,
+				Column:  pos.Column,
+				Level:   ScriptIssueWarning,
+				Message: fmt.Sprintf("未知的回调函数 %s，不会被调用，是否应为 %s", name, similar),
+			})
+		} else if strings.HasSuffix(name, "Callback") {
+			issues = append(issues, &ScriptIssue{
+				File:    fileName,
+				Line:    pos.Line,
+				Column:  pos.Column,
+				Level:   ScriptIssueWarning,
+				Message: fmt.Sprintf("未知的回调函数 %s，不会被调用，请检查函数名是否拼写错误", name),
+			})
+		}
+	}
+
+	// 执行脚本，检查顶层代码的运行错误以及回调函数签名
+	jsPlugin := NewJsPlugin()
+	if err = jsPlugin.Start(); err != nil {
+		return append(issues, &ScriptIssue{File: fileName, Level: ScriptIssueError, Message: err.Error()})
+	}
+	if err = jsPlugin.LoadScriptFile(fileName, script); err != nil {
+		return append(issues, &ScriptIssue{File: fileName, Level: ScriptIssueError, Message: "运行错误: " + err.Error()})
+	}
+	for _, name := range HookFuncNames {
+		value := jsPlugin.vm.Get(name)
+		if value == nil || goja.IsUndefined(value) {
+			continue
+		}
+		issue := &ScriptIssue{File: fileName}
+		if pos, ok := funcPos[name]; ok {
+			issue.Line, issue.Column = pos.Line, pos.Column
+		}
+		if _, ok := goja.AssertFunction(value); !ok {
+			issue.Level = ScriptIssueError
+			issue.Message = fmt.Sprintf("%s 不是函数", name)
+			issues = append(issues, issue)
+			continue
+		}
+		if count := value.ToObject(jsPlugin.vm).Get("length").ToInteger(); count != hookParamCount {
+			issue.Level = ScriptIssueWarning
+			issue.Message = fmt.Sprintf("回调函数 %s 的参数个数为 %d，应为 %d 个: (context, params)", name, count, hookParamCount)
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
@@ -0,0 +1,72 @@
+package plugins
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestCheckScript(t *testing.T) {
+	issues := CheckScript("bad.js", "function uploadFilePrepareCallback(context, params) {\n  var a = ;\n}\n")
+	if len(issues) == 0 || issues[0].Level != ScriptIssueError || issues[0].Line != 2 {
+		t.Errorf("syntax error should be reported at line 2: %v", issues)
+	}
+
+	script := "var x = 1;\n\nfunction uploadFilePrepareCallback(context) {\n  return null;\n}\nfunction uploadFileFinishCalback(context, params) {\n}\nvar syncFileFinishCallback = 1;\n"
+	issues = CheckScript("hook.js", script)
+	if len(issues) != 3 {
+		t.Fatalf("expected 3 issues, got %v", issues)
+	}
+	for _, issue := range issues {
+		t.Log(issue)
+	}
+	if issues[0].Line != 6 || issues[0].Level != ScriptIssueWarning {
+		t.Errorf("unknown callback should be reported at line 6: %s", issues[0])
+	}
+	if issues[1].Line != 3 || issues[1].Level != ScriptIssueWarning {
+		t.Errorf("param count should be reported at line 3: %s", issues[1])
+	}
+	if issues[2].Level != ScriptIssueError {
+		t.Errorf("non-function hook should be an error: %s", issues[2])
+	}
+
+	if issues = CheckScript("ok.js", "function downloadFileFinishCallback(context, params) {\n}\n"); len(issues) != 0 {
+		t.Errorf("expected no issues, got %v", issues)
+	}
+}
+
+func TestReloadablePlugin(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "aliyunpan-plugin-")
+	defer os.RemoveAll(dir)
+	os.MkdirAll(path.Join(dir, "js"), 0755)
+	script := path.Join(dir, "js", "upload_handler.js")
+	write := func(result string) {
+		ioutil.WriteFile(script, []byte("function uploadFilePrepareCallback(context, params) {\n  return {uploadApproved: \""+result+"\"};\n}\n"), 0644)
+	}
+	approved := func(rp *ReloadablePlugin) string {
+		rp.lastCheck = time.Time{}
+		r, _ := rp.UploadFilePrepareCallback(&Context{}, &UploadFilePrepareParams{})
+		if r == nil {
+			return ""
+		}
+		return r.UploadApproved
+	}
+
+	write("yes")
+	rp := NewReloadablePlugin(NewPluginManager(dir))
+	if r := approved(rp); r != "yes" {
+		t.Fatalf("unexpected result: %s", r)
+	}
+	write("no")
+	os.Chtimes(script, time.Now(), time.Now().Add(time.Second))
+	if r := approved(rp); r != "no" {
+		t.Errorf("plugin should be reloaded, got: %s", r)
+	}
+	// 脚本有语法错误时继续使用原来的插件
+	ioutil.WriteFile(script, []byte("function uploadFilePrepareCallback(context, params) {"), 0644)
+	if r := approved(rp); r != "no" {
+		t.Errorf("broken script should keep old plugin, got: %s", r)
+	}
+}
@@ -0,0 +1,128 @@
+package plugins
+
+type (
+	// PluginGroup 多个插件的组合，按顺序调用每个插件的回调函数。
+	// 准备类回调函数使用第一个返回结果的插件的结果，后面的插件不再调用
+	PluginGroup struct {
+		plugins []Plugin
+	}
+)
+
+// NewPluginGroup 创建插件组合
+func NewPluginGroup(plugins ...Plugin) *PluginGroup {
+	return &PluginGroup{
+		plugins: plugins,
+	}
+}
+
+func (pg *PluginGroup) Start() error {
+	return nil
+}
+
+func (pg *PluginGroup) UploadFilePrepareCallback(context *Context, params *UploadFilePrepareParams) (*UploadFilePrepareResult, error) {
+	for _, p := range pg.plugins {
+		if r, er := p.UploadFilePrepareCallback(context, params); er == nil && r != nil {
+			return r, nil
+		}
+	}
+	return nil, nil
+}
+
+func (pg *PluginGroup) UploadFileFinishCallback(context *Context, params *UploadFileFinishParams) error {
+	for _, p := range pg.plugins {
+		p.UploadFileFinishCallback(context, params)
+	}
+	return nil
+}
+
+func (pg *PluginGroup) DownloadFilePrepareCallback(context *Context, params *DownloadFilePrepareParams) (*DownloadFilePrepareResult, error) {
+	for _, p := range pg.plugins {
+		if r, er := p.DownloadFilePrepareCallback(context, params); er == nil && r != nil {
+			return r, nil
+		}
+	}
+	return nil, nil
+}
+
+func (pg *PluginGroup) DownloadFileFinishCallback(context *Context, params *DownloadFileFinishParams) error {
+	for _, p := range pg.plugins {
+		p.DownloadFileFinishCallback(context, params)
+	}
+	return nil
+}
+
+func (pg *PluginGroup) SyncScanLocalFilePrepareCallback(context *Context, params *SyncScanLocalFilePrepareParams) (*SyncScanLocalFilePrepareResult, error) {
+	for _, p := range pg.plugins {
+		if r, er := p.SyncScanLocalFilePrepareCallback(context, params); er == nil && r != nil {
+			return r, nil
+		}
+	}
+	return nil, nil
+}
+
+func (pg *PluginGroup) SyncScanPanFilePrepareCallback(context *Context, params *SyncScanPanFilePrepareParams) (*SyncScanPanFilePrepareResult, error) {
+	for _, p := range pg.plugins {
+		if r, er := p.SyncScanPanFilePrepareCallback(context, params); er == nil && r != nil {
+			return r, nil
+		}
+	}
+	return nil, nil
+}
+
+func (pg *PluginGroup) SyncFileFinishCallback(context *Context, params *SyncFileFinishParams) error {
+	for _, p := range pg.plugins {
+		p.SyncFileFinishCallback(context, params)
+	}
+	return nil
+}
+
+func (pg *PluginGroup) SyncAllFileFinishCallback(context *Context, params *SyncAllFileFinishParams) error {
+	for _, p := range pg.plugins {
+		p.SyncAllFileFinishCallback(context, params)
+	}
+	return nil
+}
+
+func (pg *PluginGroup) SyncScanStartCallback(context *Context, params *SyncScanStartParams) error {
+	for _, p := range pg.plugins {
+		p.SyncScanStartCallback(context, params)
+	}
+	return nil
+}
+
+func (pg *PluginGroup) SyncScanFinishCallback(context *Context, params *SyncScanFinishParams) error {
+	for _, p := range pg.plugins {
+		p.SyncScanFinishCallback(context, params)
+	}
+	return nil
+}
+
+func (pg *PluginGroup) TaskBatchFinishCallback(context *Context, params *TaskBatchFinishParams) error {
+	for _, p := range pg.plugins {
+		p.TaskBatchFinishCallback(context, params)
+	}
+	return nil
+}
+
+func (pg *PluginGroup) UserTokenRefreshFinishCallback(context *Context, params *UserTokenRefreshFinishParams) error {
+	for _, p := range pg.plugins {
+		p.UserTokenRefreshFinishCallback(context, params)
+	}
+	return nil
+}
+
+func (pg *PluginGroup) RemoveFilePrepareCallback(context *Context, params *RemoveFilePrepareParams) (*RemoveFilePrepareResult, error) {
+	for _, p := range pg.plugins {
+		if r, er := p.RemoveFilePrepareCallback(context, params); er == nil && r != nil {
+			return r, nil
+		}
+	}
+	return nil, nil
+}
+
+func (pg *PluginGroup) Stop() error {
+	for _, p := range pg.plugins {
+		p.Stop()
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package plugins
+
+import (
+	"testing"
+	"time"
+)
+
+// recordPlugin 记录被调用的回调函数
+type recordPlugin struct {
+	IdlePlugin
+	calls []string
+}
+
+func (p *recordPlugin) SyncScanStartCallback(context *Context, params *SyncScanStartParams) error {
+	p.calls = append(p.calls, "syncScanStart:"+params.Name)
+	return nil
+}
+
+func (p *recordPlugin) SyncScanFinishCallback(context *Context, params *SyncScanFinishParams) error {
+	p.calls = append(p.calls, "syncScanFinish:"+params.Name)
+	return nil
+}
+
+func (p *recordPlugin) TaskBatchFinishCallback(context *Context, params *TaskBatchFinishParams) error {
+	p.calls = append(p.calls, "taskBatchFinish:"+params.TaskType)
+	return nil
+}
+
+// dispatchHooks 依次调用同步扫描开始、结束以及批量任务结束的回调
+func dispatchHooks(t *testing.T, plugin Plugin) {
+	ctx := &Context{}
+	if err := plugin.SyncScanStartCallback(ctx, &SyncScanStartParams{Name: "backup", ScanTarget: "local"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := plugin.SyncScanFinishCallback(ctx, &SyncScanFinishParams{Name: "backup", ScanTarget: "local"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := plugin.TaskBatchFinishCallback(ctx, &TaskBatchFinishParams{TaskType: "download", TotalCount: 3, SucceedCount: 2}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkCalls(t *testing.T, name string, calls []string) {
+	want := []string{"syncScanStart:backup", "syncScanFinish:backup", "taskBatchFinish:download"}
+	if len(calls) != len(want) {
+		t.Fatalf("%s: calls %v", name, calls)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Errorf("%s: call %d is %s, want %s", name, i, calls[i], want[i])
+		}
+	}
+}
+
+func TestJsPluginHooks(t *testing.T) {
+	jsPlugin := NewJsPlugin()
+	jsPlugin.Start()
+	script := `
+var calls = [];
+function syncScanStartCallback(context, params) {
+    calls.push("syncScanStart:" + params.name);
+}
+function syncScanFinishCallback(context, params) {
+    calls.push("syncScanFinish:" + params.name);
+}
+function taskBatchFinishCallback(context, params) {
+    calls.push("taskBatchFinish:" + params.taskType);
+    if (params.totalCount !== 3 || params.succeedCount !== 2) {
+        calls.push("bad params");
+    }
+}
+`
+	if err := jsPlugin.LoadScript(script); err != nil {
+		t.Fatal(err)
+	}
+	dispatchHooks(t, jsPlugin)
+	calls := []string{}
+	if err := jsPlugin.vm.ExportTo(jsPlugin.vm.Get("calls"), &calls); err != nil {
+		t.Fatal(err)
+	}
+	checkCalls(t, "js", calls)
+
+	// 脚本没有定义回调函数时直接返回
+	empty := NewJsPlugin()
+	empty.Start()
+	if err := empty.LoadScript("var a = 1;"); err != nil {
+		t.Fatal(err)
+	}
+	dispatchHooks(t, empty)
+}
+
+func TestIdlePluginHooks(t *testing.T) {
+	dispatchHooks(t, NewIdlePlugin())
+}
+
+func TestWrappedPluginHooks(t *testing.T) {
+	sandboxed := &recordPlugin{}
+	dispatchHooks(t, NewSandboxPlugin("record", sandboxed, nil, time.Second))
+	checkCalls(t, "sandbox", sandboxed.calls)
+
+	grouped := &recordPlugin{}
+	dispatchHooks(t, NewPluginGroup(grouped))
+	checkCalls(t, "group", grouped.calls)
+
+	reloaded := &recordPlugin{}
+	manager := NewPluginManager(t.TempDir())
+	rp := &ReloadablePlugin{
+		manager:   manager,
+		plugin:    reloaded,
+		signature: manager.scriptSignature(),
+		lastCheck: time.Now(),
+	}
+	dispatchHooks(t, rp)
+	checkCalls(t, "reloadable", reloaded.calls)
+}
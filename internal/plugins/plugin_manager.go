@@ -55,11 +55,92 @@ func (p *PluginManager) SetPluginPath(pluginPath string) error {
 	return nil
 }
 
+// jsPluginDir JS插件目录
+func (p *PluginManager) jsPluginDir() string {
+	return path.Clean(p.PluginPath + string(os.PathSeparator) + "js")
+}
+
+// JsScriptFiles JS插件目录下的脚本文件
+func (p *PluginManager) JsScriptFiles() []string {
+	return ScriptFilesIn(p.jsPluginDir())
+}
+
+// ManifestFiles JS插件目录下的插件清单文件
+func (p *PluginManager) ManifestFiles() []string {
+	return ManifestFilesIn(p.jsPluginDir())
+}
+
+// ScriptFilesIn 目录下的JS脚本文件，忽略隐藏文件和编辑器的临时文件
+func ScriptFilesIn(dir string) []string {
+	files, e := ioutil.ReadDir(dir)
+	if e != nil {
+		return nil
+	}
+	scripts := []string{}
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		if strings.HasPrefix(strings.ToLower(f.Name()), ".") || strings.HasPrefix(strings.ToLower(f.Name()), "~") {
+			continue
+		}
+		if strings.HasSuffix(strings.ToLower(f.Name()), ".js") {
+			scripts = append(scripts, path.Clean(dir+string(os.PathSeparator)+f.Name()))
+		}
+	}
+	return scripts
+}
+
+// scriptSignature 脚本文件以及插件清单的签名，由文件名、大小、修改时间组成，用于检测脚本是否有变更
+func (p *PluginManager) scriptSignature() string {
+	buf := &strings.Builder{}
+	for _, file := range append(p.JsScriptFiles(), p.ManifestFiles()...) {
+		if fi, err := os.Stat(file); err == nil {
+			fmt.Fprintf(buf, "%s|%d|%d;", file, fi.Size(), fi.ModTime().UnixNano())
+		}
+	}
+	return buf.String()
+}
+
 func (p *PluginManager) GetPlugin() (Plugin, error) {
+	plugin, _ := p.loadPlugin()
+	return plugin, nil
+}
+
+// GetReloadablePlugin 获取支持热重载的插件，脚本文件变更后自动重新加载，适用于同步备份等长时间运行的任务
+func (p *PluginManager) GetReloadablePlugin() (Plugin, error) {
+	return NewReloadablePlugin(p), nil
+}
+
+// loadPlugin 加载插件，返回加载失败的脚本错误。部分脚本加载失败时其他脚本仍然生效。
+// 有插件清单的脚本使用独立的运行环境，其他脚本共享一个运行环境，所有插件的回调函数都隔离执行，超时或者panic不影响任务
+func (p *PluginManager) loadPlugin() (Plugin, error) {
 	// js plugins folder
 	// only support js plugins right now
-	jsPluginPath := path.Clean(p.PluginPath + string(os.PathSeparator) + "js")
-	if fi, err := os.Stat(jsPluginPath); err == nil && fi.IsDir() {
+	var loadErr error
+	pluginList := []Plugin{}
+	if fi, err := os.Stat(p.jsPluginDir()); err == nil && fi.IsDir() {
+		// 有清单的插件
+		managed := map[string]bool{}
+		manifestPlugins := []Plugin{}
+		for _, file := range p.ManifestFiles() {
+			m, me := LoadPluginManifest(file)
+			if me != nil {
+				logger.Verbosef("读取插件清单错误: %s\n", me)
+				loadErr = me
+				continue
+			}
+			managed[m.ScriptPath()] = true
+			plugin, le := loadManifestPlugin(m)
+			if le != nil {
+				logger.Verbosef("加载插件错误: %s, %s\n", m.Name, le)
+				loadErr = le
+				continue
+			}
+			logger.Verbosef("加载插件成功: %s\n", m.Name)
+			manifestPlugins = append(manifestPlugins, plugin)
+		}
+
 		jsPlugin := NewJsPlugin()
 		if jsPlugin.Start() != nil {
 			logger.Verbosef("初始化JS脚本错误\n")
@@ -67,33 +148,53 @@ func (p *PluginManager) GetPlugin() (Plugin, error) {
 		}
 
 		jsPluginValid := false
-		if files, e := ioutil.ReadDir(jsPluginPath); e == nil {
-			for _, f := range files {
-				if !f.IsDir() {
-					if strings.HasPrefix(strings.ToLower(f.Name()), ".") || strings.HasPrefix(strings.ToLower(f.Name()), "~") {
-						continue
-					}
-					if strings.HasSuffix(strings.ToLower(f.Name()), ".js") {
-						// this is a js file
-						bytes, re := ioutil.ReadFile(path.Clean(jsPluginPath + string(os.PathSeparator) + f.Name()))
-						if re != nil {
-							logger.Verbosef("读取JS脚本错误: %s\n", re)
-							continue
-						}
-						var script = string(bytes)
-						if jsPlugin.LoadScript(script) == nil {
-							jsPluginValid = true
-							logger.Verbosef("加载JS脚本成功: %s\n", f.Name())
-						}
-					}
-				}
+		for _, file := range p.JsScriptFiles() {
+			if managed[file] {
+				continue
+			}
+			// this is a js file
+			bytes, re := ioutil.ReadFile(file)
+			if re != nil {
+				logger.Verbosef("读取JS脚本错误: %s\n", re)
+				loadErr = re
+				continue
+			}
+			if le := jsPlugin.LoadScriptFile(path.Base(file), string(bytes)); le == nil {
+				jsPluginValid = true
+				logger.Verbosef("加载JS脚本成功: %s\n", path.Base(file))
+			} else {
+				loadErr = le
 			}
 		}
 		if jsPluginValid {
-			return interface{}(jsPlugin).(Plugin), nil
+			pluginList = append(pluginList, NewSandboxPlugin(jsPlugin.Name, jsPlugin, nil, DefaultPluginTimeout))
 		}
+		pluginList = append(pluginList, manifestPlugins...)
+	}
+
+	switch len(pluginList) {
+	case 0:
+		// default idle plugins
+		return interface{}(NewIdlePlugin()).(Plugin), loadErr
+	case 1:
+		return pluginList[0], loadErr
 	}
+	return interface{}(NewPluginGroup(pluginList...)).(Plugin), loadErr
+}
 
-	// default idle plugins
-	return interface{}(NewIdlePlugin()).(Plugin), nil
+// loadManifestPlugin 按照插件清单加载插件，使用独立的运行环境
+func loadManifestPlugin(m *PluginManifest) (Plugin, error) {
+	bytes, err := ioutil.ReadFile(m.ScriptPath())
+	if err != nil {
+		return nil, err
+	}
+	jsPlugin := NewJsPlugin()
+	if err = jsPlugin.Start(); err != nil {
+		return nil, err
+	}
+	jsPlugin.Name = m.Name
+	if err = jsPlugin.LoadScriptFile(path.Base(m.ScriptPath()), string(bytes)); err != nil {
+		return nil, err
+	}
+	return NewSandboxPlugin(m.Name, jsPlugin, m.Hooks, m.TimeoutDuration()), nil
 }
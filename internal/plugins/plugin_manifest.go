@@ -0,0 +1,161 @@
+package plugins
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+const (
+	// PluginTypeJs JS脚本插件，目前只支持这一种插件类型
+	PluginTypeJs = "js"
+
+	// ManifestFileSuffix 插件清单文件后缀，例如 sync_handler.manifest.json
+	ManifestFileSuffix = ".manifest.json"
+
+	// DefaultPluginTimeout 插件回调函数默认的超时时间
+	DefaultPluginTimeout = 30 * time.Second
+)
+
+type (
+	// PluginManifest 插件清单，声明插件的类型、实现的回调函数以及超时时间。
+	// 有清单的插件使用独立的运行环境，只调用清单中声明的回调函数
+	PluginManifest struct {
+		// Name 插件名称，为空时使用清单文件名
+		Name string `json:"name"`
+		// Type 插件类型，目前只支持js，为空时为js
+		Type string `json:"type"`
+		// Script 插件文件，相对清单文件所在目录，为空时使用和清单同名的 .js 文件
+		Script string `json:"script"`
+		// Hooks 插件实现的回调函数，为空时调用全部回调函数
+		Hooks []string `json:"hooks"`
+		// Timeout 回调函数超时时间，单位秒，0使用默认值
+		Timeout int `json:"timeout"`
+
+		// file 清单文件路径
+		file string
+	}
+)
+
+// ManifestFilesIn 目录下的插件清单文件
+func ManifestFilesIn(dir string) []string {
+	files, e := ioutil.ReadDir(dir)
+	if e != nil {
+		return nil
+	}
+	manifests := []string{}
+	for _, f := range files {
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+		if strings.HasSuffix(strings.ToLower(f.Name()), ManifestFileSuffix) {
+			manifests = append(manifests, path.Clean(dir+string(os.PathSeparator)+f.Name()))
+		}
+	}
+	return manifests
+}
+
+// ParsePluginManifest 解析插件清单，file为清单文件路径，用于定位插件文件
+func ParsePluginManifest(file string, data []byte) (*PluginManifest, error) {
+	m := &PluginManifest{}
+	if err := jsoniter.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("插件清单格式错误: %s", err)
+	}
+	m.file = file
+	baseName := path.Base(file)
+	baseName = baseName[:len(baseName)-len(ManifestFileSuffix)]
+	if m.Name == "" {
+		m.Name = baseName
+	}
+	if m.Type == "" {
+		m.Type = PluginTypeJs
+	}
+	m.Type = strings.ToLower(m.Type)
+	if m.Script == "" {
+		m.Script = baseName + "." + m.Type
+	}
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// LoadPluginManifest 读取插件清单文件
+func LoadPluginManifest(file string) (*PluginManifest, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePluginManifest(file, data)
+}
+
+func (m *PluginManifest) validate() error {
+	switch m.Type {
+	case PluginTypeJs:
+	default:
+		return fmt.Errorf("插件 %s: 未知的插件类型 %s", m.Name, m.Type)
+	}
+	for _, hook := range m.Hooks {
+		if !isHookFuncName(hook) {
+			if similar := similarHookFuncName(hook); similar != "" {
+				return fmt.Errorf("插件 %s: 未知的回调函数 %s，是否应为 %s", m.Name, hook, similar)
+			}
+			return fmt.Errorf("插件 %s: 未知的回调函数 %s", m.Name, hook)
+		}
+	}
+	if m.Timeout < 0 {
+		return fmt.Errorf("插件 %s: 超时时间不能小于0", m.Name)
+	}
+	return nil
+}
+
+// ScriptPath 插件文件路径
+func (m *PluginManifest) ScriptPath() string {
+	if path.IsAbs(m.Script) {
+		return path.Clean(m.Script)
+	}
+	return path.Clean(path.Dir(m.file) + string(os.PathSeparator) + m.Script)
+}
+
+// TimeoutDuration 回调函数超时时间
+func (m *PluginManifest) TimeoutDuration() time.Duration {
+	if m.Timeout <= 0 {
+		return DefaultPluginTimeout
+	}
+	return time.Duration(m.Timeout) * time.Second
+}
+
+// CheckManifest 检查插件清单以及清单声明的回调函数是否在脚本中实现，没有问题时返回空列表
+func CheckManifest(file string, data []byte) []*ScriptIssue {
+	m, err := ParsePluginManifest(file, data)
+	if err != nil {
+		return []*ScriptIssue{{File: file, Level: ScriptIssueError, Message: err.Error()}}
+	}
+	script, err := ioutil.ReadFile(m.ScriptPath())
+	if err != nil {
+		return []*ScriptIssue{{File: file, Level: ScriptIssueError, Message: "读取插件脚本失败: " + err.Error()}}
+	}
+	jsPlugin := NewJsPlugin()
+	if err = jsPlugin.Start(); err != nil {
+		return []*ScriptIssue{{File: file, Level: ScriptIssueError, Message: err.Error()}}
+	}
+	if err = jsPlugin.LoadScriptFile(path.Base(m.ScriptPath()), string(script)); err != nil {
+		return []*ScriptIssue{{File: file, Level: ScriptIssueError, Message: "运行错误: " + err.Error()}}
+	}
+	issues := []*ScriptIssue{}
+	for _, hook := range m.Hooks {
+		if !jsPlugin.isHandlerFuncExisted(hook) {
+			issues = append(issues, &ScriptIssue{
+				File:    file,
+				Level:   ScriptIssueWarning,
+				Message: fmt.Sprintf("清单声明的回调函数 %s 没有在脚本 %s 中实现", hook, m.Script),
+			})
+		}
+	}
+	return issues
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/tickstep/library-go/requester"
 	"net/smtp"
 	"os"
+	"path"
 	"strings"
 	"sync"
 	"time"
@@ -24,6 +25,26 @@ type (
 		Value string `json:"value"`
 		Type  string `json:"type"`
 	}
+
+	// PanFileInfo 提供给插件的云盘文件信息
+	PanFileInfo struct {
+		DriveId      string `json:"driveId"`
+		FileId       string `json:"fileId"`
+		ParentFileId string `json:"parentFileId"`
+		FileName     string `json:"fileName"`
+		FilePath     string `json:"filePath"`
+		FileSize     int64  `json:"fileSize"`
+		// FileType 文件类型，file-文件，folder-文件夹
+		FileType  string `json:"fileType"`
+		Sha1      string `json:"sha1"`
+		UpdatedAt string `json:"updatedAt"`
+	}
+
+	// PanScope 插件回调函数可以操作的网盘范围，只允许操作触发当前回调的用户和网盘，为nil代表不在回调函数中
+	PanScope struct {
+		UserId  string
+		DriveId string
+	}
 )
 
 var (
@@ -90,6 +111,141 @@ func DeletePanFile(userId, driveId, panFileId string) bool {
 	}
 }
 
+// allow 是否允许操作指定用户的网盘
+func (s *PanScope) allow(userId, driveId string) bool {
+	return s != nil && s.UserId != "" && s.DriveId != "" && s.UserId == userId && s.DriveId == driveId
+}
+
+// isPluginPanWriteEnabled 是否允许插件分享、移动网盘文件，需要用户通过 config set -plugin_pan_write 1 开启
+func isPluginPanWriteEnabled() bool {
+	if config.Config.PluginPanWrite != "1" {
+		logger.Verboseln("[Plugin] pan share/move is disabled, enable it with: config set -plugin_pan_write 1")
+		return false
+	}
+	return true
+}
+
+// getPluginPanClient 获取已登录用户的网盘客户端，只能获取触发当前回调的用户和网盘
+func getPluginPanClient(scope *PanScope, userId, driveId string) *config.PanClient {
+	if !scope.allow(userId, driveId) {
+		logger.Verboseln("[Plugin] pan file operation out of callback scope: userId=" + userId + ", driveId=" + driveId)
+		return nil
+	}
+	user := config.Config.UserList.GetUserByUserId(userId)
+	if user == nil {
+		logger.Verboseln("[Plugin] user not existed: ", userId)
+		return nil
+	}
+	return user.PanClient()
+}
+
+// isPluginPanPathValid 插件只允许使用绝对路径操作云盘文件
+func isPluginPanPathValid(panPath string) bool {
+	return strings.HasPrefix(panPath, "/") && !strings.Contains(panPath, "..")
+}
+
+// GetPanFileInfo 查询云盘文件信息，文件不存在或者查询失败返回null
+func GetPanFileInfo(scope *PanScope, userId, driveId, panFilePath string) *PanFileInfo {
+	logger.Verboseln("[Plugin] try to get pan file info: userId=" + userId + ", driveId=" + driveId + ", panFilePath=" + panFilePath)
+	if driveId == "" || !isPluginPanPathValid(panFilePath) {
+		return nil
+	}
+	panClient := getPluginPanClient(scope, userId, driveId)
+	if panClient == nil {
+		return nil
+	}
+	fe, err := panClient.OpenapiPanClient().FileInfoByPath(driveId, path.Clean(panFilePath))
+	if err != nil || fe == nil {
+		logger.Verboseln("[Plugin] get pan file info error: ", err)
+		return nil
+	}
+	return &PanFileInfo{
+		DriveId:      fe.DriveId,
+		FileId:       fe.FileId,
+		ParentFileId: fe.ParentFileId,
+		FileName:     fe.FileName,
+		FilePath:     path.Clean(panFilePath),
+		FileSize:     fe.FileSize,
+		FileType:     fe.FileType,
+		Sha1:         strings.ToLower(fe.ContentHash),
+		UpdatedAt:    fe.UpdatedAt,
+	}
+}
+
+// CreatePanShare 创建云盘文件分享，sharePwd为空代表公开分享，expiredDays为0代表永不过期。成功返回分享链接，失败返回空字符串。
+// 需要开启 plugin_pan_write 配置
+func CreatePanShare(scope *PanScope, userId, driveId, panFileId, sharePwd string, expiredDays int) string {
+	logger.Verboseln("[Plugin] try to create pan share: userId=" + userId + ", driveId=" + driveId + ", panFileId=" + panFileId)
+	if driveId == "" || panFileId == "" || expiredDays < 0 || !isPluginPanWriteEnabled() {
+		return ""
+	}
+	if sharePwd != "" && len(sharePwd) != 4 {
+		logger.Verboseln("[Plugin] share password must be 4 characters")
+		return ""
+	}
+	panClient := getPluginPanClient(scope, userId, driveId)
+	if panClient == nil {
+		return ""
+	}
+	expiredTime := ""
+	if expiredDays > 0 {
+		expiredTime = time.Now().Add(time.Duration(expiredDays) * 24 * time.Hour).Format("2006-01-02 15:04:05")
+	}
+	r, err := panClient.OpenapiPanClient().ShareLinkCreate(aliyunpan.ShareCreateParam{
+		DriveId:    driveId,
+		SharePwd:   sharePwd,
+		Expiration: expiredTime,
+		FileIdList: []string{panFileId},
+	})
+	if err != nil || r == nil {
+		logger.Verboseln("[Plugin] create pan share error: ", err)
+		return ""
+	}
+	logger.Verboseln("[Plugin] create pan share success: ", r.ShareUrl)
+	return strings.ReplaceAll(r.ShareUrl, "https://www.aliyundrive.com", "https://www.alipan.com")
+}
+
+// MovePanFile 移动云盘文件到指定文件夹，目标文件夹不存在会自动创建，只支持同一个网盘内移动。
+// 需要开启 plugin_pan_write 配置
+func MovePanFile(scope *PanScope, userId, driveId, panFileId, targetPanDirPath string) bool {
+	logger.Verboseln("[Plugin] try to move pan file: userId=" + userId + ", driveId=" + driveId + ", panFileId=" + panFileId + ", targetPanDirPath=" + targetPanDirPath)
+	if driveId == "" || panFileId == "" || panFileId == aliyunpan.DefaultRootParentFileId || !isPluginPanPathValid(targetPanDirPath) {
+		return false
+	}
+	if !isPluginPanWriteEnabled() {
+		return false
+	}
+	panClient := getPluginPanClient(scope, userId, driveId)
+	if panClient == nil {
+		return false
+	}
+	targetPanDirPath = path.Clean(targetPanDirPath)
+	targetDirId := aliyunpan.DefaultRootParentFileId
+	if targetPanDirPath != "/" {
+		rs, err := panClient.OpenapiPanClient().MkdirByFullPath(driveId, targetPanDirPath)
+		if err != nil || rs == nil || rs.FileId == "" {
+			logger.Verboseln("[Plugin] create target folder error: ", err)
+			return false
+		}
+		targetDirId = rs.FileId
+	}
+	if targetDirId == panFileId {
+		return false
+	}
+	r, err := panClient.OpenapiPanClient().FileMove(&aliyunpan.FileMoveParam{
+		DriveId:        driveId,
+		FileId:         panFileId,
+		ToDriveId:      driveId,
+		ToParentFileId: targetDirId,
+	})
+	if err != nil || r == nil || !r.Success {
+		logger.Verboseln("[Plugin] move pan file error: ", err)
+		return false
+	}
+	logger.Verboseln("[Plugin] move pan file success: ", panFileId)
+	return true
+}
+
 // SendTextMail 发送文本邮件
 func SendTextMail(mailServer, userName, password, to, subject, body string) bool {
 	if e := sendEmail(mailServer, userName, password, to, subject, body, "text", true); e != nil {
@@ -3,6 +3,8 @@ package plugins
 import (
 	"fmt"
 	"testing"
+
+	"github.com/tickstep/aliyunpan/internal/config"
 )
 
 func TestDeleteLocalFile(t *testing.T) {
@@ -23,3 +25,98 @@ func TestGetString(t *testing.T) {
 	v := GetString("test1")
 	fmt.Println(v)
 }
+
+func TestPanScopeAllow(t *testing.T) {
+	scope := &PanScope{UserId: "u1", DriveId: "d1"}
+	cases := []struct {
+		name    string
+		scope   *PanScope
+		userId  string
+		driveId string
+		want    bool
+	}{
+		{"same user and drive", scope, "u1", "d1", true},
+		{"other user", scope, "u2", "d1", false},
+		{"other drive", scope, "u1", "d2", false},
+		{"not in callback", nil, "u1", "d1", false},
+		{"callback without user", &PanScope{DriveId: "d1"}, "", "d1", false},
+		{"callback without drive", &PanScope{UserId: "u1"}, "u1", "", false},
+	}
+	for _, c := range cases {
+		if got := c.scope.allow(c.userId, c.driveId); got != c.want {
+			t.Errorf("%s: allow = %v, want %v", c.name, got, c.want)
+		}
+		if !c.want && getPluginPanClient(c.scope, c.userId, c.driveId) != nil {
+			t.Errorf("%s: pan client should be nil", c.name)
+		}
+	}
+}
+
+func TestPluginPanWriteDisabled(t *testing.T) {
+	old := config.Config.PluginPanWrite
+	defer func() { config.Config.PluginPanWrite = old }()
+
+	scope := &PanScope{UserId: "u1", DriveId: "d1"}
+	config.Config.PluginPanWrite = "2"
+	if r := CreatePanShare(scope, "u1", "d1", "f1", "", 0); r != "" {
+		t.Errorf("share should be disabled, got %s", r)
+	}
+	if MovePanFile(scope, "u1", "d1", "f1", "/归档") {
+		t.Error("move should be disabled")
+	}
+
+	// 开启后仍然只能操作当前回调的用户和网盘
+	config.Config.PluginPanWrite = "1"
+	if r := CreatePanShare(scope, "u2", "d1", "f1", "", 0); r != "" {
+		t.Errorf("share of other user should be rejected, got %s", r)
+	}
+	if MovePanFile(scope, "u1", "d2", "f1", "/归档") {
+		t.Error("move in other drive should be rejected")
+	}
+}
+
+func TestJsPluginPanScope(t *testing.T) {
+	jsPlugin := NewJsPlugin()
+	jsPlugin.Start()
+	jsPlugin.vm.Set("currentScope", func() string {
+		if s := jsPlugin.currentScope(); s != nil {
+			return s.UserId + "/" + s.DriveId
+		}
+		return ""
+	})
+	script := `
+var seen = [];
+function uploadFileFinishCallback(context, params) {
+	seen.push(currentScope());
+}
+function userTokenRefreshFinishCallback(context, params) {
+	seen.push(currentScope());
+}
+function removeFilePrepareCallback(context, params) {
+	seen.push(currentScope());
+	return null;
+}
+`
+	if err := jsPlugin.LoadScript(script); err != nil {
+		t.Fatal(err)
+	}
+	ctx := &Context{UserId: "u1"}
+	jsPlugin.UploadFileFinishCallback(ctx, &UploadFileFinishParams{DriveId: "d1"})
+	jsPlugin.UserTokenRefreshFinishCallback(ctx, &UserTokenRefreshFinishParams{})
+	jsPlugin.RemoveFilePrepareCallback(ctx, &RemoveFilePrepareParams{Items: []*RemoveFilePrepareItem{{DriveId: "d2"}}})
+
+	var seen []string
+	if err := jsPlugin.vm.ExportTo(jsPlugin.vm.Get("seen"), &seen); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"u1/d1", "u1/", "u1/d2"}
+	if fmt.Sprint(seen) != fmt.Sprint(want) {
+		t.Fatalf("scopes = %v, want %v", seen, want)
+	}
+	if jsPlugin.currentScope() != nil {
+		t.Fatal("scope should be cleared after callback")
+	}
+	if jsPlugin.vm.Get("PluginUtil").ToObject(jsPlugin.vm).Get("PanFS").ToObject(jsPlugin.vm).Get("getFileInfo") == nil {
+		t.Fatal("PanFS.getFileInfo not registered")
+	}
+}
@@ -0,0 +1,123 @@
+package plugins
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tickstep/library-go/logger"
+)
+
+const (
+	// ReloadCheckInterval 检查插件脚本是否变更的最小间隔
+	ReloadCheckInterval = 3 * time.Second
+)
+
+type (
+	// ReloadablePlugin 支持热重载的插件，调用回调函数前检查脚本是否变更，变更后重新加载。
+	// 重新加载失败时继续使用原来的插件，避免脚本编辑到一半导致任务异常
+	ReloadablePlugin struct {
+		manager   *PluginManager
+		plugin    Plugin
+		signature string
+		lastCheck time.Time
+		mutex     sync.Mutex
+	}
+)
+
+// NewReloadablePlugin 创建支持热重载的插件
+func NewReloadablePlugin(manager *PluginManager) *ReloadablePlugin {
+	rp := &ReloadablePlugin{
+		manager:   manager,
+		signature: manager.scriptSignature(),
+		lastCheck: time.Now(),
+	}
+	rp.plugin, _ = manager.loadPlugin()
+	return rp
+}
+
+// current 当前生效的插件，脚本有变更时重新加载
+func (rp *ReloadablePlugin) current() Plugin {
+	rp.mutex.Lock()
+	defer rp.mutex.Unlock()
+	if time.Since(rp.lastCheck) < ReloadCheckInterval {
+		return rp.plugin
+	}
+	rp.lastCheck = time.Now()
+	signature := rp.manager.scriptSignature()
+	if signature == rp.signature {
+		return rp.plugin
+	}
+	rp.signature = signature
+	plugin, err := rp.manager.loadPlugin()
+	if err != nil {
+		fmt.Printf("插件脚本重新加载失败，继续使用原插件: %s\n", err)
+		return rp.plugin
+	}
+	logger.Verboseln("插件脚本有变更，已重新加载")
+	rp.plugin.Stop()
+	rp.plugin = plugin
+	return rp.plugin
+}
+
+func (rp *ReloadablePlugin) Start() error {
+	return nil
+}
+
+func (rp *ReloadablePlugin) UploadFilePrepareCallback(context *Context, params *UploadFilePrepareParams) (*UploadFilePrepareResult, error) {
+	return rp.current().UploadFilePrepareCallback(context, params)
+}
+
+func (rp *ReloadablePlugin) UploadFileFinishCallback(context *Context, params *UploadFileFinishParams) error {
+	return rp.current().UploadFileFinishCallback(context, params)
+}
+
+func (rp *ReloadablePlugin) DownloadFilePrepareCallback(context *Context, params *DownloadFilePrepareParams) (*DownloadFilePrepareResult, error) {
+	return rp.current().DownloadFilePrepareCallback(context, params)
+}
+
+func (rp *ReloadablePlugin) DownloadFileFinishCallback(context *Context, params *DownloadFileFinishParams) error {
+	return rp.current().DownloadFileFinishCallback(context, params)
+}
+
+func (rp *ReloadablePlugin) SyncScanLocalFilePrepareCallback(context *Context, params *SyncScanLocalFilePrepareParams) (*SyncScanLocalFilePrepareResult, error) {
+	return rp.current().SyncScanLocalFilePrepareCallback(context, params)
+}
+
+func (rp *ReloadablePlugin) SyncScanPanFilePrepareCallback(context *Context, params *SyncScanPanFilePrepareParams) (*SyncScanPanFilePrepareResult, error) {
+	return rp.current().SyncScanPanFilePrepareCallback(context, params)
+}
+
+func (rp *ReloadablePlugin) SyncFileFinishCallback(context *Context, params *SyncFileFinishParams) error {
+	return rp.current().SyncFileFinishCallback(context, params)
+}
+
+func (rp *ReloadablePlugin) SyncAllFileFinishCallback(context *Context, params *SyncAllFileFinishParams) error {
+	return rp.current().SyncAllFileFinishCallback(context, params)
+}
+
+func (rp *ReloadablePlugin) SyncScanStartCallback(context *Context, params *SyncScanStartParams) error {
+	return rp.current().SyncScanStartCallback(context, params)
+}
+
+func (rp *ReloadablePlugin) SyncScanFinishCallback(context *Context, params *SyncScanFinishParams) error {
+	return rp.current().SyncScanFinishCallback(context, params)
+}
+
+func (rp *ReloadablePlugin) TaskBatchFinishCallback(context *Context, params *TaskBatchFinishParams) error {
+	return rp.current().TaskBatchFinishCallback(context, params)
+}
+
+func (rp *ReloadablePlugin) UserTokenRefreshFinishCallback(context *Context, params *UserTokenRefreshFinishParams) error {
+	return rp.current().UserTokenRefreshFinishCallback(context, params)
+}
+
+func (rp *ReloadablePlugin) RemoveFilePrepareCallback(context *Context, params *RemoveFilePrepareParams) (*RemoveFilePrepareResult, error) {
+	return rp.current().RemoveFilePrepareCallback(context, params)
+}
+
+func (rp *ReloadablePlugin) Stop() error {
+	rp.mutex.Lock()
+	defer rp.mutex.Unlock()
+	return rp.plugin.Stop()
+}
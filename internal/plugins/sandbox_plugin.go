@@ -0,0 +1,239 @@
+package plugins
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tickstep/library-go/logger"
+)
+
+type (
+	// interruptible 支持中断执行的插件
+	interruptible interface {
+		Interrupt(v interface{})
+		ClearInterrupt()
+	}
+
+	// SandboxPlugin 隔离插件回调函数的执行，回调函数超时或者panic时返回错误，不影响上传、下载等任务。
+	// 同一个插件的回调函数依次执行，超时的调用会被中断，中断无法结束的调用返回之前跳过该插件的所有回调
+	SandboxPlugin struct {
+		Name    string
+		plugin  Plugin
+		hooks   map[string]bool // 插件实现的回调函数，nil代表全部
+		timeout time.Duration
+
+		sem  chan struct{} // 保证同一时间只有一个回调函数在执行
+		hung bool          // 有超时的调用仍未结束
+		mu   sync.Mutex
+	}
+)
+
+// NewSandboxPlugin 创建隔离执行的插件，hooks为插件实现的回调函数，为空代表全部，timeout小于等于0时使用默认超时时间
+func NewSandboxPlugin(name string, plugin Plugin, hooks []string, timeout time.Duration) *SandboxPlugin {
+	if timeout <= 0 {
+		timeout = DefaultPluginTimeout
+	}
+	sp := &SandboxPlugin{
+		Name:    name,
+		plugin:  plugin,
+		timeout: timeout,
+		sem:     make(chan struct{}, 1),
+	}
+	if len(hooks) > 0 {
+		sp.hooks = map[string]bool{}
+		for _, hook := range hooks {
+			sp.hooks[hook] = true
+		}
+	}
+	return sp
+}
+
+func (sp *SandboxPlugin) isHung() bool {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	return sp.hung
+}
+
+// call 执行回调函数，超时或者panic时返回错误
+func (sp *SandboxPlugin) call(hook string, fn func() error) error {
+	if sp.hooks != nil && !sp.hooks[hook] {
+		return nil
+	}
+	if sp.isHung() {
+		return fmt.Errorf("插件 %s 上一次调用超时仍未结束，跳过回调函数 %s", sp.Name, hook)
+	}
+
+	timer := time.NewTimer(sp.timeout)
+	defer timer.Stop()
+	select {
+	case sp.sem <- struct{}{}:
+	case <-timer.C:
+		return fmt.Errorf("插件 %s 等待执行超时，跳过回调函数 %s", sp.Name, hook)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("插件 %s 回调函数 %s 异常: %v", sp.Name, hook, r)
+			}
+			sp.mu.Lock()
+			defer sp.mu.Unlock()
+			if sp.hung {
+				// 超时的调用已经结束，插件可以继续使用
+				if ip, ok := sp.plugin.(interruptible); ok {
+					ip.ClearInterrupt()
+				}
+				sp.hung = false
+				logger.Verbosef("插件 %s 超时的回调函数 %s 已结束\n", sp.Name, hook)
+			}
+			<-sp.sem
+			done <- err
+		}()
+		err = fn()
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			logger.Verboseln(err)
+		}
+		return err
+	case <-timer.C:
+	}
+
+	sp.mu.Lock()
+	select {
+	case err := <-done:
+		// 超时的同时回调函数已经结束
+		sp.mu.Unlock()
+		return err
+	default:
+	}
+	sp.hung = true
+	if ip, ok := sp.plugin.(interruptible); ok {
+		ip.Interrupt(fmt.Sprintf("回调函数 %s 执行超时", hook))
+	}
+	sp.mu.Unlock()
+	err := fmt.Errorf("插件 %s 回调函数 %s 执行超过 %s，已中断", sp.Name, hook, sp.timeout)
+	logger.Verboseln(err)
+	return err
+}
+
+func (sp *SandboxPlugin) Start() error {
+	return nil
+}
+
+func (sp *SandboxPlugin) UploadFilePrepareCallback(context *Context, params *UploadFilePrepareParams) (*UploadFilePrepareResult, error) {
+	var result *UploadFilePrepareResult
+	err := sp.call("uploadFilePrepareCallback", func() (e error) {
+		result, e = sp.plugin.UploadFilePrepareCallback(context, params)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (sp *SandboxPlugin) UploadFileFinishCallback(context *Context, params *UploadFileFinishParams) error {
+	return sp.call("uploadFileFinishCallback", func() error {
+		return sp.plugin.UploadFileFinishCallback(context, params)
+	})
+}
+
+func (sp *SandboxPlugin) DownloadFilePrepareCallback(context *Context, params *DownloadFilePrepareParams) (*DownloadFilePrepareResult, error) {
+	var result *DownloadFilePrepareResult
+	err := sp.call("downloadFilePrepareCallback", func() (e error) {
+		result, e = sp.plugin.DownloadFilePrepareCallback(context, params)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (sp *SandboxPlugin) DownloadFileFinishCallback(context *Context, params *DownloadFileFinishParams) error {
+	return sp.call("downloadFileFinishCallback", func() error {
+		return sp.plugin.DownloadFileFinishCallback(context, params)
+	})
+}
+
+func (sp *SandboxPlugin) SyncScanLocalFilePrepareCallback(context *Context, params *SyncScanLocalFilePrepareParams) (*SyncScanLocalFilePrepareResult, error) {
+	var result *SyncScanLocalFilePrepareResult
+	err := sp.call("syncScanLocalFilePrepareCallback", func() (e error) {
+		result, e = sp.plugin.SyncScanLocalFilePrepareCallback(context, params)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (sp *SandboxPlugin) SyncScanPanFilePrepareCallback(context *Context, params *SyncScanPanFilePrepareParams) (*SyncScanPanFilePrepareResult, error) {
+	var result *SyncScanPanFilePrepareResult
+	err := sp.call("syncScanPanFilePrepareCallback", func() (e error) {
+		result, e = sp.plugin.SyncScanPanFilePrepareCallback(context, params)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (sp *SandboxPlugin) SyncFileFinishCallback(context *Context, params *SyncFileFinishParams) error {
+	return sp.call("syncFileFinishCallback", func() error {
+		return sp.plugin.SyncFileFinishCallback(context, params)
+	})
+}
+
+func (sp *SandboxPlugin) SyncAllFileFinishCallback(context *Context, params *SyncAllFileFinishParams) error {
+	return sp.call("syncAllFileFinishCallback", func() error {
+		return sp.plugin.SyncAllFileFinishCallback(context, params)
+	})
+}
+
+func (sp *SandboxPlugin) SyncScanStartCallback(context *Context, params *SyncScanStartParams) error {
+	return sp.call("syncScanStartCallback", func() error {
+		return sp.plugin.SyncScanStartCallback(context, params)
+	})
+}
+
+func (sp *SandboxPlugin) SyncScanFinishCallback(context *Context, params *SyncScanFinishParams) error {
+	return sp.call("syncScanFinishCallback", func() error {
+		return sp.plugin.SyncScanFinishCallback(context, params)
+	})
+}
+
+func (sp *SandboxPlugin) TaskBatchFinishCallback(context *Context, params *TaskBatchFinishParams) error {
+	return sp.call("taskBatchFinishCallback", func() error {
+		return sp.plugin.TaskBatchFinishCallback(context, params)
+	})
+}
+
+func (sp *SandboxPlugin) UserTokenRefreshFinishCallback(context *Context, params *UserTokenRefreshFinishParams) error {
+	return sp.call("userTokenRefreshFinishCallback", func() error {
+		return sp.plugin.UserTokenRefreshFinishCallback(context, params)
+	})
+}
+
+func (sp *SandboxPlugin) RemoveFilePrepareCallback(context *Context, params *RemoveFilePrepareParams) (*RemoveFilePrepareResult, error) {
+	var result *RemoveFilePrepareResult
+	err := sp.call("removeFilePrepareCallback", func() (e error) {
+		result, e = sp.plugin.RemoveFilePrepareCallback(context, params)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (sp *SandboxPlugin) Stop() error {
+	return sp.plugin.Stop()
+}
@@ -0,0 +1,97 @@
+package plugins
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type panicPlugin struct {
+	IdlePlugin
+}
+
+func (p *panicPlugin) UploadFileFinishCallback(context *Context, params *UploadFileFinishParams) error {
+	panic("bad plugin")
+}
+
+func TestSandboxPluginTimeout(t *testing.T) {
+	jsPlugin := NewJsPlugin()
+	jsPlugin.Start()
+	script := `
+var loop = true;
+function uploadFileFinishCallback(context, params) {
+    while (loop) {}
+}
+function uploadFilePrepareCallback(context, params) {
+    return {"uploadApproved": "no"};
+}
+`
+	if err := jsPlugin.LoadScript(script); err != nil {
+		t.Fatal(err)
+	}
+	sp := NewSandboxPlugin("test", jsPlugin, nil, 200*time.Millisecond)
+	start := time.Now()
+	if err := sp.UploadFileFinishCallback(&Context{}, &UploadFileFinishParams{}); err == nil {
+		t.Fatal("expect timeout error")
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Fatal("timeout not work")
+	}
+
+	// 超时的调用被中断后插件可以继续使用
+	deadline := time.Now().Add(2 * time.Second)
+	for sp.isHung() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	r, err := sp.UploadFilePrepareCallback(&Context{}, &UploadFilePrepareParams{})
+	if err != nil || r == nil || r.UploadApproved != "no" {
+		t.Fatalf("unexpected result after interrupt: %+v, %v", r, err)
+	}
+}
+
+func TestSandboxPluginPanic(t *testing.T) {
+	sp := NewSandboxPlugin("panic", &panicPlugin{}, nil, time.Second)
+	if err := sp.UploadFileFinishCallback(&Context{}, &UploadFileFinishParams{}); err == nil {
+		t.Fatal("expect panic error")
+	}
+	if err := sp.DownloadFileFinishCallback(&Context{}, &DownloadFileFinishParams{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestManifestPluginHooks(t *testing.T) {
+	dir := t.TempDir()
+	jsDir := filepath.Join(dir, "js")
+	files := map[string]string{
+		"a.js": `
+function uploadFilePrepareCallback(context, params) {
+    return {"uploadApproved": "no"};
+}
+function downloadFilePrepareCallback(context, params) {
+    return {"downloadApproved": "no"};
+}`,
+		"a.manifest.json": `{"name": "a", "hooks": ["uploadFilePrepareCallback"], "timeout": 5}`,
+		"b.manifest.json": `{"type": "wasm"}`,
+	}
+	if err := os.MkdirAll(jsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(jsDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plugin, err := NewPluginManager(dir).loadPlugin()
+	if err == nil {
+		t.Fatal("expect unknown plugin type error")
+	}
+	if r, _ := plugin.UploadFilePrepareCallback(&Context{}, &UploadFilePrepareParams{}); r == nil || r.UploadApproved != "no" {
+		t.Fatalf("declared hook should be called: %+v", r)
+	}
+	if r, _ := plugin.DownloadFilePrepareCallback(&Context{}, &DownloadFilePrepareParams{}); r != nil {
+		t.Fatalf("undeclared hook should not be called: %+v", r)
+	}
+}
@@ -8,15 +8,16 @@ import (
 	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
 	"github.com/tickstep/aliyunpan/internal/config"
 	"github.com/tickstep/aliyunpan/internal/file/downloader"
+	"github.com/tickstep/aliyunpan/internal/file/ratelimit"
 	"github.com/tickstep/aliyunpan/internal/file/uploader"
 	"github.com/tickstep/aliyunpan/internal/functions/panupload"
 	"github.com/tickstep/aliyunpan/internal/localfile"
 	"github.com/tickstep/aliyunpan/internal/log"
+	"github.com/tickstep/aliyunpan/internal/metrics"
 	"github.com/tickstep/aliyunpan/internal/utils"
 	"github.com/tickstep/aliyunpan/library/requester/transfer"
 	"github.com/tickstep/library-go/converter"
 	"github.com/tickstep/library-go/logger"
-	"github.com/tickstep/library-go/requester"
 	"github.com/tickstep/library-go/requester/rio"
 	"github.com/tickstep/library-go/requester/rio/speeds"
 	"math/rand"
@@ -38,14 +39,22 @@ type (
 		panClient *config.PanClient
 
 		syncItem        *SyncFileItem
-		maxDownloadRate int64 // 限制最大下载速度
-		maxUploadRate   int64 // 限制最大上传速度
+		maxDownloadRate int64                   // 限制最大下载速度
+		maxUploadRate   int64                   // 限制最大上传速度
+		uploadRateFunc  func(t time.Time) int64 // 按时间段动态限制上传速度，不为nil时忽略maxUploadRate
 
 		localFolderCreateMutex *sync.Mutex
 		panFolderCreateMutex   *sync.Mutex
 
 		// 文件记录器，存储同步文件记录
 		fileRecorder *log.FileRecorder
+
+		// 同步任务的上传、下载速度统计
+		uploadSpeedsStat   *speeds.Speeds
+		downloadSpeedsStat *speeds.Speeds
+
+		// 同步任务的活动记录，传输数据时更新
+		activity *syncActivity
 	}
 )
 
@@ -221,7 +230,7 @@ func (f *FileActionTask) downloadFile(ctx context.Context) error {
 	}
 
 	downloadUrl := durl.Url
-	worker := downloader.NewWorker(0, f.syncItem.PanFile.DriveId, f.syncItem.PanFile.FileId, downloadUrl, writer, nil)
+	worker := downloader.NewWorker(0, f.syncItem.PanFile.DriveId, f.syncItem.PanFile.FileId, downloadUrl, writer, f.downloadSpeedsStat)
 
 	status := &transfer.DownloadStatus{}
 	status.AddDownloaded(f.syncItem.DownloadRange.Begin)
@@ -235,9 +244,12 @@ func (f *FileActionTask) downloadFile(ctx context.Context) error {
 	worker.SetDownloadStatus(status)
 	completed := make(chan struct{}, 0)
 	rand.Seed(time.Now().UnixNano())
+	f.activity.beginTransfer()
+	defer f.activity.endTransfer()
 	go func() {
 		ticker := time.NewTicker(1 * time.Second)
 		defer ticker.Stop()
+		downloaded := status.Downloaded()
 		for {
 			select {
 			case <-completed:
@@ -246,6 +258,10 @@ func (f *FileActionTask) downloadFile(ctx context.Context) error {
 				time.Sleep(time.Duration(rand.Intn(10)*33) * time.Millisecond) // 延迟随机时间
 				builder := &strings.Builder{}
 				status.UpdateSpeeds()
+				if status.Downloaded() != downloaded {
+					downloaded = status.Downloaded()
+					f.activity.touchTransfer()
+				}
 				downloadedPercentage := fmt.Sprintf("%.2f%%", float64(status.Downloaded())/float64(status.TotalSize())*100)
 				fmt.Fprintf(builder, "\r下载到本地:%s ↓ %s/%s(%s) %s/s............",
 					f.syncItem.getLocalFileFullPath(),
@@ -259,8 +275,7 @@ func (f *FileActionTask) downloadFile(ctx context.Context) error {
 		}
 	}()
 
-	client := requester.NewHTTPClient()
-	client.SetKeepAlive(true)
+	client := config.Config.TransferHTTPClient()
 	client.SetTimeout(10 * time.Minute)
 	worker.SetClient(client)
 	worker.SetPanClient(f.panClient)
@@ -322,6 +337,7 @@ func (f *FileActionTask) downloadFile(ctx context.Context) error {
 				f.syncFileDb.Update(f.syncItem)
 			} else if worker.GetStatus().StatusCode() == downloader.StatusCodeDownloadUrlExpired {
 				logger.Verboseln("download url expired: ", f.syncItem.PanFile.Path)
+				metrics.CountRetry("sync_download")
 				// 下载链接过期，获取新的链接
 				newUrl, apierr1 := f.panClient.OpenapiPanClient().GetFileDownloadUrl(&aliyunpan.GetFileDownloadUrlParam{
 					DriveId: f.syncItem.PanFile.DriveId,
@@ -350,6 +366,7 @@ func (f *FileActionTask) downloadFile(ctx context.Context) error {
 			} else if worker.GetStatus().StatusCode() == downloader.StatusCodeDownloadUrlExceedMaxConcurrency {
 				logger.Verboseln("download url exceed max concurrency: ", f.syncItem.PanFile.Path)
 				// 下载遇到限流了，下一次重试
+				metrics.CountRetry("sync_download")
 			}
 		}
 	}
@@ -569,10 +586,15 @@ func (f *FileActionTask) uploadFile(ctx context.Context) error {
 	}
 
 	// 限速配置
-	var rateLimit *speeds.RateLimit
-	if f.maxUploadRate > 0 {
+	var rateLimit ratelimit.Limiter
+	if f.uploadRateFunc != nil {
+		rateLimit = uploader.NewScheduleRateLimit(f.uploadRateFunc)
+	} else if f.maxUploadRate > 0 {
 		rateLimit = speeds.NewRateLimit(f.maxUploadRate)
 	}
+	if rateLimit != nil {
+		defer rateLimit.Stop()
+	}
 	// 速度指示器
 	speedsStat := &speeds.Speeds{}
 	// 进度指示器
@@ -580,6 +602,8 @@ func (f *FileActionTask) uploadFile(ctx context.Context) error {
 	status.SetTotalSize(f.syncItem.LocalFile.FileSize)
 	completed := make(chan struct{}, 0)
 	rand.Seed(time.Now().UnixNano())
+	f.activity.beginTransfer()
+	defer f.activity.endTransfer()
 	go func() {
 		ticker := time.NewTicker(1 * time.Second)
 		defer ticker.Stop()
@@ -591,13 +615,17 @@ func (f *FileActionTask) uploadFile(ctx context.Context) error {
 				status.SetUploaded(f.syncItem.UploadRange.Begin)
 				time.Sleep(time.Duration(rand.Intn(10)*33) * time.Millisecond) // 延迟随机时间
 				builder := &strings.Builder{}
+				speed := speedsStat.GetSpeeds()
+				if speed > 0 {
+					f.activity.touchTransfer()
+				}
 				uploadedPercentage := fmt.Sprintf("%.2f%%", float64(status.Uploaded())/float64(status.TotalSize())*100)
 				fmt.Fprintf(builder, "\r上传到网盘:%s ↑ %s/%s(%s) %s/s............",
 					f.syncItem.getPanFileFullPath(),
 					converter.ConvertFileSize(status.Uploaded(), 2),
 					converter.ConvertFileSize(status.TotalSize(), 2),
 					uploadedPercentage,
-					converter.ConvertFileSize(speedsStat.GetSpeeds(), 2),
+					converter.ConvertFileSize(speed, 2),
 				)
 				PromptPrint(builder.String())
 			}
@@ -605,9 +633,8 @@ func (f *FileActionTask) uploadFile(ctx context.Context) error {
 	}()
 
 	// 上传客户端
-	uploadClient := requester.NewHTTPClient()
+	uploadClient := config.Config.TransferHTTPClient()
 	uploadClient.SetTimeout(0)
-	uploadClient.SetKeepAlive(true)
 
 	// 标记上传状态
 	f.syncItem.Status = SyncFileStatusUploading
@@ -627,7 +654,7 @@ func (f *FileActionTask) uploadFile(ctx context.Context) error {
 			if f.syncItem.UploadRange.End > f.syncItem.LocalFile.FileSize {
 				f.syncItem.UploadRange.End = f.syncItem.LocalFile.FileSize
 			}
-			fileReader := uploader.NewBufioSplitUnit(rio.NewFileReaderAtLen64(localFile.GetFile()), *f.syncItem.UploadRange, speedsStat, rateLimit, nil)
+			fileReader := uploader.NewBufioSplitUnit(rio.NewFileReaderAtLen64(localFile.GetFile()), *f.syncItem.UploadRange, speedsStat, rateLimit, f.uploadSpeedsStat)
 
 			if uploadDone, terr := worker.UploadFile(ctx, f.syncItem.UploadPartSeq, f.syncItem.UploadRange.Begin, f.syncItem.UploadRange.End, fileReader, uploadClient); terr == nil {
 				if uploadDone {
@@ -655,10 +682,12 @@ func (f *FileActionTask) uploadFile(ctx context.Context) error {
 				} else {
 					// TODO: 上传失败，重试策略
 					logger.Verboseln("upload file part error")
+					metrics.CountRetry("sync_upload")
 				}
 			} else {
 				// error
 				logger.Verboseln("error: ", terr)
+				metrics.CountRetry("sync_upload")
 			}
 		}
 	}
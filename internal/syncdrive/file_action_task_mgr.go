@@ -7,11 +7,14 @@ import (
 	"github.com/tickstep/aliyunpan-api/aliyunpan"
 	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
 	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/log"
+	"github.com/tickstep/aliyunpan/internal/metrics"
 	"github.com/tickstep/aliyunpan/internal/plugins"
 	"github.com/tickstep/aliyunpan/internal/utils"
 	"github.com/tickstep/aliyunpan/internal/waitgroup"
 	"github.com/tickstep/aliyunpan/library/collection"
 	"github.com/tickstep/library-go/logger"
+	"github.com/tickstep/library-go/requester/rio/speeds"
 	"os"
 	"path"
 	"strings"
@@ -38,11 +41,21 @@ type (
 		resourceModifyMutex *sync.Mutex
 		executeLoopIsDone   bool // 文件执行进程是否已经完成
 
+		// 文件移动、重命名检测
+		moveDetector *fileMoveDetector
+
 		panUser *config.PanUser
 
 		// 插件
 		plugin      plugins.Plugin
 		pluginMutex *sync.Mutex
+
+		// 每日汇总统计
+		digestStat *syncDigestStat
+
+		// 任务的上传、下载速度统计，用于输出指标
+		uploadSpeedsStat   *speeds.Speeds
+		downloadSpeedsStat *speeds.Speeds
 	}
 
 	localFileSet struct {
@@ -68,7 +81,14 @@ func NewFileActionTaskManager(task *SyncTask) *FileActionTaskManager {
 		resourceModifyMutex: &sync.Mutex{},
 		executeLoopIsDone:   true,
 
+		moveDetector: newFileMoveDetector(),
+
 		panUser: task.panUser,
+
+		digestStat: &syncDigestStat{},
+
+		uploadSpeedsStat:   &speeds.Speeds{},
+		downloadSpeedsStat: &speeds.Speeds{},
 	}
 }
 
@@ -99,11 +119,12 @@ func (f *FileActionTaskManager) InitMgr() error {
 
 	if f.plugin == nil {
 		pluginManger := plugins.NewPluginManager(config.GetPluginDir())
-		f.plugin, _ = pluginManger.GetPlugin()
+		f.plugin, _ = pluginManger.GetReloadablePlugin()
 	}
 	if f.pluginMutex == nil {
 		f.pluginMutex = &sync.Mutex{}
 	}
+	metrics.Default.Register(f.metricsKey(), f.collectMetrics)
 
 	return nil
 }
@@ -112,6 +133,7 @@ func (f *FileActionTaskManager) Stop() error {
 	if f.ctx == nil {
 		return nil
 	}
+	metrics.Default.Unregister(f.metricsKey())
 	// cancel all sub task & process
 	f.cancelFunc()
 
@@ -127,6 +149,7 @@ func (f *FileActionTaskManager) Stop() error {
 func (f *FileActionTaskManager) StartFileActionTaskExecutor() error {
 	logger.Verboseln("start file execute task at ", utils.NowTimeStr())
 	f.setExecuteLoopFlag(false)
+	f.moveDetector.reset()
 	go f.fileActionTaskExecutor(f.ctx)
 	return nil
 }
@@ -191,19 +214,32 @@ func (f *FileActionTaskManager) doFileDiffRoutine(localFiles LocalFileList, panF
 					// 创建本地文件夹，这样就可以同步空文件夹
 					f.createLocalFolder(file)
 				} else {
+					if f.matchLocalMoveCandidate(file) {
+						// 云盘文件是移动/重命名而来，已经移动了本地文件
+						continue
+					}
 					// 文件，进入下载队列
 					fileActionTask := &FileActionTask{
 						syncItem: syncItem,
 					}
 					f.addToSyncDb(fileActionTask)
+					if f.task.RestoreMode {
+						f.task.restoreReport.addMissing(syncItem.getLocalFileFullPath())
+					}
 				}
 			} else if f.task.Mode == Upload {
+				if f.collectPanMoveCandidate(file) {
+					// 可能是本地文件被移动/重命名了，等本轮扫描结束再处理
+					continue
+				}
 				if f.task.Policy == SyncPolicyExclusive {
 					// 需要删除云盘多余的文件
 					if f.deletePanFile(file) == nil {
 						PromptPrintln("成功删除云盘多余文件：" + file.Path)
 					}
 				}
+			} else if f.task.Mode == SyncTwoWay {
+				f.doTwoWayPanOnly(file)
 			}
 		}
 	}
@@ -241,6 +277,10 @@ func (f *FileActionTaskManager) doFileDiffRoutine(localFiles LocalFileList, panF
 					// 创建云盘文件夹，这样就可以同步空文件夹
 					f.createPanFolder(file)
 				} else {
+					if f.matchPanMoveCandidate(file) {
+						// 本地文件是移动/重命名而来，已经移动了云盘文件
+						continue
+					}
 					// 文件，增加到上传队列
 					fileActionTask := &FileActionTask{
 						syncItem: syncItem,
@@ -248,12 +288,23 @@ func (f *FileActionTaskManager) doFileDiffRoutine(localFiles LocalFileList, panF
 					f.addToSyncDb(fileActionTask)
 				}
 			} else if f.task.Mode == Download {
+				if f.collectLocalMoveCandidate(file) {
+					// 可能是云盘文件被移动/重命名了，等本轮扫描结束再处理
+					continue
+				}
 				if f.task.Policy == SyncPolicyExclusive {
 					// 需要删除云盘多余的文件
 					if f.deleteLocalFile(file) == nil {
 						PromptPrintln("成功删除本地多余文件：" + file.Path)
+						if f.task.RestoreMode {
+							f.task.restoreReport.addDeleted(file.Path)
+						}
+					} else if f.task.RestoreMode {
+						f.task.restoreReport.addFailed(file.Path)
 					}
 				}
+			} else if f.task.Mode == SyncTwoWay {
+				f.doTwoWayLocalOnly(file)
 			}
 		}
 	}
@@ -263,6 +314,11 @@ func (f *FileActionTaskManager) doFileDiffRoutine(localFiles LocalFileList, panF
 		localFile := localFilesNeedToCheck[idx]
 		panFile := panFilesNeedToCheck[idx]
 
+		if f.task.Mode == SyncTwoWay {
+			f.doTwoWayBothExisted(localFile, panFile)
+			continue
+		}
+
 		// 跳过文件夹
 		if localFile.IsFolder() {
 			continue
@@ -298,6 +354,10 @@ func (f *FileActionTaskManager) doFileDiffRoutine(localFiles LocalFileList, panF
 				logger.Verboseln("file is the same, no need to upload file: ", localFile.Path)
 				continue
 			}
+			if f.isDryRun() && localFile.Sha1Hash == "" && !isLocalFileChanged(localFile, panFile) {
+				// dry-run模式没有上传时计算的SHA1，需要实际计算本地文件SHA1进行对比
+				continue
+			}
 			uploadLocalFile := &FileActionTask{
 				syncItem: &SyncFileItem{
 					Action:            SyncFileActionUpload,
@@ -314,11 +374,20 @@ func (f *FileActionTaskManager) doFileDiffRoutine(localFiles LocalFileList, panF
 			}
 			f.addToSyncDb(uploadLocalFile)
 		} else if f.task.Mode == Download {
-			// 校验SHA1是否相同
-			if strings.ToLower(panFile.Sha1Hash) == strings.ToLower(localFile.Sha1Hash) {
+			if f.task.RestoreMode {
+				// 还原模式，实际校验本地文件内容，被改坏的文件需要使用云盘文件覆盖
+				if !isLocalFileChanged(localFile, panFile) {
+					logger.Verboseln("file is the same, no need to restore file: ", localFile.Path)
+					continue
+				}
+				f.task.restoreReport.addModified(localFile.Path)
+			} else if strings.ToLower(panFile.Sha1Hash) == strings.ToLower(localFile.Sha1Hash) {
+				// 校验SHA1是否相同
 				// do nothing
 				logger.Verboseln("file is the same, no need to download file: ", localFile.Path)
 				continue
+			} else if f.isDryRun() && localFile.Sha1Hash == "" && !isLocalFileChanged(localFile, panFile) {
+				continue
 			}
 			downloadPanFile := &FileActionTask{
 				syncItem: &SyncFileItem{
@@ -335,9 +404,6 @@ func (f *FileActionTaskManager) doFileDiffRoutine(localFiles LocalFileList, panF
 				},
 			}
 			f.addToSyncDb(downloadPanFile)
-		} else if f.task.Mode == SyncTwoWay {
-			// TODO: no support yet
-			logger.Verboseln("not support sync mode")
 		}
 	}
 }
@@ -350,6 +416,13 @@ func (f *FileActionTaskManager) createLocalFolder(panFileItem *PanFileItem) erro
 	relativePath := strings.TrimPrefix(panPath, panRootPath)
 	localFilePath := path.Join(path.Clean(f.task.LocalFolderPath), relativePath)
 
+	if f.isDryRun() {
+		if b, e := utils.PathExists(localFilePath); e == nil && !b {
+			f.addDryRunItem(SyncFileActionCreateLocalFolder, localFilePath, panFileItem.Path, 0)
+		}
+		return nil
+	}
+
 	// 创建文件夹
 	var er error
 	if b, e := utils.PathExists(localFilePath); e == nil && !b {
@@ -370,6 +443,11 @@ func (f *FileActionTaskManager) createPanFolder(localFileItem *LocalFileItem) er
 	relativePath := strings.TrimPrefix(localPath, localRootPath)
 	panDirPath := path.Join(path.Clean(f.task.PanFolderPath), relativePath)
 
+	if f.isDryRun() {
+		f.addDryRunItem(SyncFileActionCreatePanFolder, localFileItem.Path, panDirPath, 0)
+		return nil
+	}
+
 	// 创建文件夹
 	logger.Verbosef("创建云盘文件夹: %s\n", panDirPath)
 	f.panCreateMutex.Lock()
@@ -386,6 +464,10 @@ func (f *FileActionTaskManager) createPanFolder(localFileItem *LocalFileItem) er
 // deleteLocalFile 删除本地文件
 func (f *FileActionTaskManager) deleteLocalFile(localFileItem *LocalFileItem) error {
 	localFilePath := localFileItem.Path
+	if f.isDryRun() {
+		f.addDryRunItem(SyncFileActionDeleteLocal, localFilePath, f.getPanPathFromLocalPath(localFilePath), localFileItem.FileSize)
+		return nil
+	}
 	logger.Verbosef("正在删除本地文件: %s\n", localFilePath)
 	var e error
 	if localFileItem.IsFolder() {
@@ -402,6 +484,10 @@ func (f *FileActionTaskManager) deleteLocalFile(localFileItem *LocalFileItem) er
 
 // deletePanFile 删除云盘文件
 func (f *FileActionTaskManager) deletePanFile(panFileItem *PanFileItem) error {
+	if f.isDryRun() {
+		f.addDryRunItem(SyncFileActionDeletePan, f.getLocalPathFromPanPath(panFileItem.Path), panFileItem.Path, panFileItem.FileSize)
+		return nil
+	}
 	logger.Verbosef("正在删除云盘文件: %s\n", panFileItem.Path)
 	var fileDeleteResult *aliyunpan.FileBatchActionResult
 	var err *apierror.ApiError = nil
@@ -418,6 +504,24 @@ func (f *FileActionTaskManager) addToSyncDb(fileTask *FileActionTask) {
 	f.mutex.Lock()
 	defer f.mutex.Unlock()
 
+	if f.isDryRun() {
+		// 只记录将要上传、下载的文件，不进入任务队列
+		syncItem := fileTask.syncItem
+		fileSize := int64(0)
+		if syncItem.Action == SyncFileActionUpload {
+			fileSize = syncItem.LocalFile.FileSize
+		} else if syncItem.PanFile != nil {
+			fileSize = syncItem.PanFile.FileSize
+		}
+		f.task.dryRunReport.add(&DryRunItem{
+			Action:    syncItem.Action,
+			LocalPath: syncItem.getLocalFileFullPath(),
+			PanPath:   syncItem.getPanFileFullPath(),
+			FileSize:  fileSize,
+		})
+		return
+	}
+
 	// check sync db
 	if itemInDb, e := f.task.syncFileDb.Get(fileTask.syncItem.Id()); e == nil && itemInDb != nil {
 		if itemInDb.Status == SyncFileStatusCreate || itemInDb.Status == SyncFileStatusDownloading || itemInDb.Status == SyncFileStatusUploading {
@@ -469,9 +573,13 @@ func (f *FileActionTaskManager) getFromSyncDb(act SyncFileAction) *FileActionTas
 						syncItem:               file,
 						maxDownloadRate:        f.syncOption.MaxDownloadRate,
 						maxUploadRate:          f.syncOption.MaxUploadRate,
+						uploadRateFunc:         f.syncOption.UploadRateFunc,
 						localFolderCreateMutex: f.localCreateMutex,
 						panFolderCreateMutex:   f.panCreateMutex,
 						fileRecorder:           f.syncOption.FileRecorder,
+						uploadSpeedsStat:       f.uploadSpeedsStat,
+						downloadSpeedsStat:     f.downloadSpeedsStat,
+						activity:               f.task.activity,
 					}
 				}
 			}
@@ -489,9 +597,13 @@ func (f *FileActionTaskManager) getFromSyncDb(act SyncFileAction) *FileActionTas
 						syncItem:               file,
 						maxDownloadRate:        f.syncOption.MaxDownloadRate,
 						maxUploadRate:          f.syncOption.MaxUploadRate,
+						uploadRateFunc:         f.syncOption.UploadRateFunc,
 						localFolderCreateMutex: f.localCreateMutex,
 						panFolderCreateMutex:   f.panCreateMutex,
 						fileRecorder:           f.syncOption.FileRecorder,
+						uploadSpeedsStat:       f.uploadSpeedsStat,
+						downloadSpeedsStat:     f.downloadSpeedsStat,
+						activity:               f.task.activity,
 					}
 				}
 			}
@@ -511,9 +623,13 @@ func (f *FileActionTaskManager) getFromSyncDb(act SyncFileAction) *FileActionTas
 						syncItem:               file,
 						maxDownloadRate:        f.syncOption.MaxDownloadRate,
 						maxUploadRate:          f.syncOption.MaxUploadRate,
+						uploadRateFunc:         f.syncOption.UploadRateFunc,
 						localFolderCreateMutex: f.localCreateMutex,
 						panFolderCreateMutex:   f.panCreateMutex,
 						fileRecorder:           f.syncOption.FileRecorder,
+						uploadSpeedsStat:       f.uploadSpeedsStat,
+						downloadSpeedsStat:     f.downloadSpeedsStat,
+						activity:               f.task.activity,
 					}
 				}
 			}
@@ -544,6 +660,7 @@ func (f *FileActionTaskManager) fileActionTaskExecutor(ctx context.Context) {
 			uploadWaitGroup.Wait()
 			return
 		default:
+			f.task.activity.touchExecutor()
 			actionIsEmptyOfThisTerm := true
 			// do upload
 			uploadItem := f.getFromSyncDb(SyncFileActionUpload)
@@ -555,12 +672,19 @@ func (f *FileActionTaskManager) fileActionTaskExecutor(ctx context.Context) {
 					go func() {
 						if e := uploadItem.DoAction(ctx); e == nil {
 							// success
+							f.saveSnapshotAfterAction(uploadItem.syncItem)
 							f.fileInProcessQueue.Remove(uploadItem.syncItem)
 							f.doPluginCallback(uploadItem.syncItem, "success")
+							f.recordDigest(uploadItem.syncItem, nil)
+							f.logActionResult(uploadItem.syncItem, nil)
 						} else {
 							// retry?
 							f.fileInProcessQueue.Remove(uploadItem.syncItem)
 							f.doPluginCallback(uploadItem.syncItem, "fail")
+							metrics.CountApiError(e)
+							f.recordDigest(uploadItem.syncItem, e)
+							f.logActionResult(uploadItem.syncItem, e)
+							f.appendFailedRecord(uploadItem.syncItem)
 						}
 						uploadWaitGroup.Done()
 					}()
@@ -577,12 +701,22 @@ func (f *FileActionTaskManager) fileActionTaskExecutor(ctx context.Context) {
 					go func() {
 						if e := downloadItem.DoAction(ctx); e == nil {
 							// success
+							f.saveSnapshotAfterAction(downloadItem.syncItem)
 							f.fileInProcessQueue.Remove(downloadItem.syncItem)
 							f.doPluginCallback(downloadItem.syncItem, "success")
+							f.recordDigest(downloadItem.syncItem, nil)
+							f.logActionResult(downloadItem.syncItem, nil)
 						} else {
 							// retry?
 							f.fileInProcessQueue.Remove(downloadItem.syncItem)
 							f.doPluginCallback(downloadItem.syncItem, "fail")
+							metrics.CountApiError(e)
+							f.recordDigest(downloadItem.syncItem, e)
+							f.logActionResult(downloadItem.syncItem, e)
+							f.appendFailedRecord(downloadItem.syncItem)
+							if f.task.RestoreMode {
+								f.task.restoreReport.addFailed(downloadItem.syncItem.getLocalFileFullPath())
+							}
 						}
 						downloadWaitGroup.Done()
 					}()
@@ -596,6 +730,9 @@ func (f *FileActionTaskManager) fileActionTaskExecutor(ctx context.Context) {
 				// 完成了一次扫描-执行的循环，可以退出了
 				if f.task.IsScanLoopDone() {
 					if uploadWaitGroup.Parallel() == 0 && downloadWaitGroup.Parallel() == 0 { // 如果也没有进行中的异步任务
+						// 没有匹配到移动/重命名的候选文件，按照同步策略处理
+						f.flushMoveCandidates()
+						f.flushDigest()
 						f.setExecuteLoopFlag(true)
 						logger.Verboseln("file execute task is finish, exit normally")
 						prompt := ""
@@ -618,6 +755,40 @@ func (f *FileActionTaskManager) fileActionTaskExecutor(ctx context.Context) {
 	}
 }
 
+// logActionResult 把上传、下载文件的结果写入程序日志
+func (f *FileActionTaskManager) logActionResult(syncFile *SyncFileItem, err error) {
+	source, target, size := syncFile.getLocalFileFullPath(), syncFile.getPanFileFullPath(), int64(0)
+	if syncFile.Action == SyncFileActionUpload {
+		size = syncFile.LocalFile.FileSize
+	} else {
+		source, target = target, source
+		size = syncFile.PanFile.FileSize
+	}
+	if err != nil {
+		log.Error("同步文件失败", "task", f.task.Name, "action", syncFile.Action, "path", source, "target", target, "size", size, "error", err)
+		return
+	}
+	log.Info("同步文件成功", "task", f.task.Name, "action", syncFile.Action, "path", source, "target", target, "size", size)
+}
+
+// appendFailedRecord 记录上传、下载失败的文件，成功的记录由FileActionTask写入
+func (f *FileActionTaskManager) appendFailedRecord(syncFile *SyncFileItem) {
+	if config.Config.FileRecordConfig != "1" || f.syncOption.FileRecorder == nil {
+		return
+	}
+	item := &log.FileRecordItem{
+		Status:  "失败-上传",
+		TimeStr: utils.NowTimeStr(),
+	}
+	if syncFile.Action == SyncFileActionUpload {
+		item.FileSize, item.FilePath = syncFile.LocalFile.FileSize, syncFile.getPanFileFullPath()
+	} else {
+		item.Status = "失败-下载"
+		item.FileSize, item.FilePath = syncFile.PanFile.FileSize, syncFile.PanFile.Path
+	}
+	f.syncOption.FileRecorder.Append(item)
+}
+
 func (f *FileActionTaskManager) doPluginCallback(syncFile *SyncFileItem, actionResult string) bool {
 	// 插件回调
 	var pluginParam *plugins.SyncFileFinishParams
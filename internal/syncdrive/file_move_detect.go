@@ -0,0 +1,359 @@
+package syncdrive
+
+import (
+	"fmt"
+	"github.com/tickstep/aliyunpan/internal/functions/panupload"
+	"github.com/tickstep/aliyunpan/internal/localfile"
+	"github.com/tickstep/aliyunpan/internal/utils"
+	"github.com/tickstep/library-go/logger"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+type (
+	// fileMoveDetector 文件移动、重命名检测。
+	// 同步源端已经不存在的文件在本轮扫描中暂存为候选文件，源端新出现的文件如果和候选文件的大小、SHA1都一致，
+	// 就认为是同一个文件被移动或者重命名了，直接对目标端文件执行移动/重命名，避免删除后重新上传或者下载
+	fileMoveDetector struct {
+		mutex           sync.Mutex
+		panCandidates   map[int64]PanFileList   // 上传模式：本地已经不存在的云盘文件，按文件大小索引
+		localCandidates map[int64]LocalFileList // 下载模式：云盘已经不存在的本地文件，按文件大小索引
+	}
+)
+
+func newFileMoveDetector() *fileMoveDetector {
+	return &fileMoveDetector{
+		panCandidates:   map[int64]PanFileList{},
+		localCandidates: map[int64]LocalFileList{},
+	}
+}
+
+// reset 清空候选文件，返回清空前的候选文件
+func (d *fileMoveDetector) reset() (map[int64]PanFileList, map[int64]LocalFileList) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	panCandidates, localCandidates := d.panCandidates, d.localCandidates
+	d.panCandidates = map[int64]PanFileList{}
+	d.localCandidates = map[int64]LocalFileList{}
+	return panCandidates, localCandidates
+}
+
+func (d *fileMoveDetector) addPanCandidate(file *PanFileItem) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.panCandidates[file.FileSize] = append(d.panCandidates[file.FileSize], file)
+}
+
+func (d *fileMoveDetector) getPanCandidates(fileSize int64) PanFileList {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return append(PanFileList{}, d.panCandidates[fileSize]...)
+}
+
+// removePanCandidate 移除候选文件，文件已经被移除返回false
+func (d *fileMoveDetector) removePanCandidate(file *PanFileItem) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	files := d.panCandidates[file.FileSize]
+	for idx, item := range files {
+		if item == file {
+			d.panCandidates[file.FileSize] = append(files[:idx], files[idx+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (d *fileMoveDetector) addLocalCandidate(file *LocalFileItem) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.localCandidates[file.FileSize] = append(d.localCandidates[file.FileSize], file)
+}
+
+func (d *fileMoveDetector) getLocalCandidates(fileSize int64) LocalFileList {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return append(LocalFileList{}, d.localCandidates[fileSize]...)
+}
+
+// removeLocalCandidate 移除候选文件，文件已经被移除返回false
+func (d *fileMoveDetector) removeLocalCandidate(file *LocalFileItem) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	files := d.localCandidates[file.FileSize]
+	for idx, item := range files {
+		if item == file {
+			d.localCandidates[file.FileSize] = append(files[:idx], files[idx+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// localFileSha1 获取本地文件SHA1。扫描时已经有SHA1的直接使用；本地数据库中有记录并且文件大小、修改时间没变的，
+// 使用数据库中记录的SHA1；否则才实际计算文件SHA1，并把结果保存到数据库，避免重复计算
+func (f *FileActionTaskManager) localFileSha1(localFile *LocalFileItem) string {
+	if localFile.Sha1Hash != "" {
+		return strings.ToLower(localFile.Sha1Hash)
+	}
+	if f.task.localFileDb != nil {
+		if file, e := f.task.localFileDb.Get(localFile.Path); e == nil && file != nil && file.Sha1Hash != "" &&
+			file.FileSize == localFile.FileSize &&
+			localfile.ModTimeEqual(file.UpdateTimeUnix(), localFile.UpdateTimeUnix(), f.syncOption.ModTimeTolerance) {
+			localFile.Sha1Hash = file.Sha1Hash
+			return strings.ToLower(file.Sha1Hash)
+		}
+	}
+	sha1Str := panupload.CalcLocalFileSha1(localFile.Path)
+	if sha1Str != "" {
+		localFile.Sha1Hash = sha1Str
+		f.saveLocalFileSha1(localFile.Path, sha1Str)
+	}
+	return sha1Str
+}
+
+// collectPanMoveCandidate 上传模式下处理本地已经不存在的云盘文件。
+// 和等待上传的本地文件一致则直接移动云盘文件，否则暂存为候选文件，等本轮扫描结束再按照同步策略处理。
+// 返回false代表不需要检测，按原有逻辑处理
+func (f *FileActionTaskManager) collectPanMoveCandidate(panFile *PanFileItem) bool {
+	if f.task.RestoreMode || panFile.IsFolder() || panFile.FileSize == 0 || panFile.Sha1Hash == "" {
+		return false
+	}
+	if f.movePanFileForPendingUpload(panFile) {
+		return true
+	}
+	f.moveDetector.addPanCandidate(panFile)
+	return true
+}
+
+// matchPanMoveCandidate 上传模式下检查新出现的本地文件是否由云盘候选文件移动/重命名而来，是则直接移动云盘文件，无需上传
+func (f *FileActionTaskManager) matchPanMoveCandidate(localFile *LocalFileItem) bool {
+	if f.task.RestoreMode || !localFile.IsFile() || localFile.FileSize == 0 {
+		return false
+	}
+	candidates := f.moveDetector.getPanCandidates(localFile.FileSize)
+	if len(candidates) == 0 {
+		return false
+	}
+	sha1Str := f.localFileSha1(localFile)
+	if sha1Str == "" {
+		return false
+	}
+	for _, panFile := range candidates {
+		if strings.ToLower(panFile.Sha1Hash) != sha1Str {
+			continue
+		}
+		if !f.moveDetector.removePanCandidate(panFile) {
+			continue
+		}
+		if f.isDryRun() {
+			f.addDryRunMovePan(panFile, localFile.Path, f.getPanPathFromLocalPath(localFile.Path))
+			return true
+		}
+		if err := f.movePanFile(panFile, f.getPanPathFromLocalPath(localFile.Path)); err != nil {
+			logger.Verbosef("移动云盘文件失败: %s, %s\n", panFile.Path, err)
+			f.moveDetector.addPanCandidate(panFile)
+			return false
+		}
+		f.saveLocalFileSha1(localFile.Path, sha1Str)
+		return true
+	}
+	return false
+}
+
+// movePanFileForPendingUpload 检查等待上传的本地文件是否和云盘文件一致，一致则移动云盘文件并取消上传
+func (f *FileActionTaskManager) movePanFileForPendingUpload(panFile *PanFileItem) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	files, e := f.task.syncFileDb.GetFileList(SyncFileStatusCreate)
+	if e != nil {
+		return false
+	}
+	for _, item := range files {
+		if item.Action != SyncFileActionUpload || item.LocalFile == nil || item.LocalFile.FileSize != panFile.FileSize {
+			continue
+		}
+		if f.fileInProcessQueue.Contains(item) {
+			continue
+		}
+		sha1Str := f.localFileSha1(item.LocalFile)
+		if sha1Str == "" || sha1Str != strings.ToLower(panFile.Sha1Hash) {
+			continue
+		}
+		if f.isDryRun() {
+			f.addDryRunMovePan(panFile, item.getLocalFileFullPath(), item.getPanFileFullPath())
+			return true
+		}
+		if err := f.movePanFile(panFile, item.getPanFileFullPath()); err != nil {
+			logger.Verbosef("移动云盘文件失败: %s, %s\n", panFile.Path, err)
+			return false
+		}
+		item.Status = SyncFileStatusSuccess
+		item.StatusUpdateTime = utils.NowTimeStr()
+		f.task.syncFileDb.Update(item)
+		f.saveLocalFileSha1(item.LocalFile.Path, sha1Str)
+		return true
+	}
+	return false
+}
+
+// movePanFile 移动/重命名云盘文件到指定路径
+func (f *FileActionTaskManager) movePanFile(panFile *PanFileItem, targetPanPath string) error {
+	err := panupload.MovePanFile(f.task.panClient, f.task.DriveId, panFile.FileId, panFile.Path, targetPanPath, f.panCreateMutex)
+	if err != nil {
+		return err
+	}
+	PromptPrintln("检测到本地文件移动/重命名，云盘文件：" + panFile.Path + " => " + targetPanPath)
+	return nil
+}
+
+// saveLocalFileSha1 保存本地文件SHA1到本地数据库
+func (f *FileActionTaskManager) saveLocalFileSha1(localPath, sha1Str string) {
+	if f.task.localFileDb == nil {
+		return
+	}
+	if file, e := f.task.localFileDb.Get(localPath); e == nil && file != nil {
+		file.Sha1Hash = sha1Str
+		f.task.localFileDb.Update(file)
+	}
+}
+
+// collectLocalMoveCandidate 下载模式下处理云盘已经不存在的本地文件。
+// 和等待下载的云盘文件一致则直接移动本地文件，否则暂存为候选文件，等本轮扫描结束再按照同步策略处理。
+// 返回false代表不需要检测，按原有逻辑处理
+func (f *FileActionTaskManager) collectLocalMoveCandidate(localFile *LocalFileItem) bool {
+	if f.task.RestoreMode || !localFile.IsFile() || localFile.FileSize == 0 {
+		return false
+	}
+	if f.moveLocalFileForPendingDownload(localFile) {
+		return true
+	}
+	f.moveDetector.addLocalCandidate(localFile)
+	return true
+}
+
+// matchLocalMoveCandidate 下载模式下检查新出现的云盘文件是否由本地候选文件移动/重命名而来，是则直接移动本地文件，无需下载
+func (f *FileActionTaskManager) matchLocalMoveCandidate(panFile *PanFileItem) bool {
+	if f.task.RestoreMode || panFile.IsFolder() || panFile.FileSize == 0 || panFile.Sha1Hash == "" {
+		return false
+	}
+	for _, localFile := range f.moveDetector.getLocalCandidates(panFile.FileSize) {
+		// 计算结果缓存在候选文件中，避免同样大小的文件重复计算
+		sha1Str := f.localFileSha1(localFile)
+		if sha1Str == "" || sha1Str != strings.ToLower(panFile.Sha1Hash) {
+			continue
+		}
+		if !f.moveDetector.removeLocalCandidate(localFile) {
+			continue
+		}
+		if f.isDryRun() {
+			f.addDryRunMoveLocal(localFile, f.getLocalPathFromPanPath(panFile.Path), panFile)
+			return true
+		}
+		if err := f.moveLocalFile(localFile, f.getLocalPathFromPanPath(panFile.Path), panFile); err != nil {
+			logger.Verbosef("移动本地文件失败: %s, %s\n", localFile.Path, err)
+			f.moveDetector.addLocalCandidate(localFile)
+			return false
+		}
+		return true
+	}
+	return false
+}
+
+// moveLocalFileForPendingDownload 检查等待下载的云盘文件是否和本地文件一致，一致则移动本地文件并取消下载
+func (f *FileActionTaskManager) moveLocalFileForPendingDownload(localFile *LocalFileItem) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	files, e := f.task.syncFileDb.GetFileList(SyncFileStatusCreate)
+	if e != nil {
+		return false
+	}
+	sha1Str := ""
+	for _, item := range files {
+		if item.Action != SyncFileActionDownload || item.PanFile == nil || item.PanFile.FileSize != localFile.FileSize {
+			continue
+		}
+		if f.fileInProcessQueue.Contains(item) {
+			continue
+		}
+		if sha1Str == "" {
+			if sha1Str = f.localFileSha1(localFile); sha1Str == "" {
+				return false
+			}
+		}
+		if sha1Str != strings.ToLower(item.PanFile.Sha1Hash) {
+			continue
+		}
+		if f.isDryRun() {
+			f.addDryRunMoveLocal(localFile, item.getLocalFileFullPath(), item.PanFile)
+			return true
+		}
+		if err := f.moveLocalFile(localFile, item.getLocalFileFullPath(), item.PanFile); err != nil {
+			logger.Verbosef("移动本地文件失败: %s, %s\n", localFile.Path, err)
+			return false
+		}
+		item.Status = SyncFileStatusSuccess
+		item.StatusUpdateTime = utils.NowTimeStr()
+		f.task.syncFileDb.Update(item)
+		return true
+	}
+	return false
+}
+
+// moveLocalFile 移动/重命名本地文件到指定路径
+func (f *FileActionTaskManager) moveLocalFile(localFile *LocalFileItem, targetLocalPath string, panFile *PanFileItem) error {
+	if b, e := utils.PathExists(targetLocalPath); e == nil && b {
+		return fmt.Errorf("本地文件已存在: %s", targetLocalPath)
+	}
+	localDir := path.Dir(strings.ReplaceAll(targetLocalPath, "\\", "/"))
+	if b, e := utils.PathExists(localDir); e == nil && !b {
+		f.localCreateMutex.Lock()
+		os.MkdirAll(localDir, 0755)
+		f.localCreateMutex.Unlock()
+	}
+	if err := os.Rename(localFile.Path, targetLocalPath); err != nil {
+		return err
+	}
+	// 修改时间和云盘文件保持一致
+	if err := os.Chtimes(targetLocalPath, panFile.UpdateTime(), panFile.UpdateTime()); err != nil {
+		logger.Verbosef(err.Error())
+	}
+
+	// 更新本地数据库
+	f.task.localFileDb.Delete(localFile.Path)
+	if fi, er := os.Stat(targetLocalPath); er == nil {
+		newFile := newLocalFileItem(fi, targetLocalPath)
+		newFile.Sha1Hash = panFile.Sha1Hash
+		f.task.localFileDb.Add(newFile)
+	}
+	PromptPrintln("检测到云盘文件移动/重命名，本地文件：" + localFile.Path + " => " + targetLocalPath)
+	return nil
+}
+
+// flushMoveCandidates 本轮扫描结束，没有匹配的候选文件按照同步策略处理
+func (f *FileActionTaskManager) flushMoveCandidates() {
+	panCandidates, localCandidates := f.moveDetector.reset()
+	if f.task.Policy != SyncPolicyExclusive {
+		return
+	}
+	for _, files := range panCandidates {
+		for _, file := range files {
+			// 需要删除云盘多余的文件
+			if f.deletePanFile(file) == nil {
+				PromptPrintln("成功删除云盘多余文件：" + file.Path)
+			}
+		}
+	}
+	for _, files := range localCandidates {
+		for _, file := range files {
+			// 需要删除本地多余的文件
+			if f.deleteLocalFile(file) == nil {
+				PromptPrintln("成功删除本地多余文件：" + file.Path)
+			}
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package syncdrive
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+const helloSha1 = "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d"
+
+func TestLocalFileSha1(t *testing.T) {
+	dir := t.TempDir()
+	localFileDb := NewLocalSyncDb(path.Join(t.TempDir(), "local.bolt"))
+	if _, e := localFileDb.Open(); e != nil {
+		t.Fatal(e)
+	}
+	defer localFileDb.Close()
+	f := &FileActionTaskManager{task: &SyncTask{LocalFolderPath: dir, localFileDb: localFileDb}}
+
+	filePath := path.Join(dir, "a.txt")
+	if e := os.WriteFile(filePath, []byte("hello"), 0644); e != nil {
+		t.Fatal(e)
+	}
+	fi, _ := os.Stat(filePath)
+	scanned := func() *LocalFileItem {
+		return newLocalFileItem(fi, filePath)
+	}
+
+	// 数据库中记录的SHA1和文件实际内容不同，用于区分是否重新计算了SHA1
+	recorded := scanned()
+	recorded.Sha1Hash = "1111111111111111111111111111111111111111"
+	localFileDb.Add(recorded)
+	changed := scanned()
+	changed.FileSize = 6
+	changed.Sha1Hash = "2222222222222222222222222222222222222222"
+
+	cases := []struct {
+		name   string
+		setup  func()
+		file   *LocalFileItem
+		want   string
+		stored string
+	}{
+		{"扫描时已有SHA1", func() {}, &LocalFileItem{Path: filePath, FileSize: 5, Sha1Hash: "ABCDEF"}, "abcdef", recorded.Sha1Hash},
+		{"数据库记录未修改", func() {}, scanned(), recorded.Sha1Hash, recorded.Sha1Hash},
+		{"数据库记录已修改", func() {
+			localFileDb.Update(changed)
+		}, scanned(), helloSha1, helloSha1},
+		{"数据库没有记录", func() {
+			localFileDb.Delete(filePath)
+		}, scanned(), helloSha1, ""},
+	}
+	for _, c := range cases {
+		c.setup()
+		if got := f.localFileSha1(c.file); got != c.want {
+			t.Errorf("%s: sha1 %s, want %s", c.name, got, c.want)
+		}
+		if c.file.Sha1Hash == "" {
+			t.Errorf("%s: sha1 should be cached in file item", c.name)
+		}
+		stored := ""
+		if file, e := localFileDb.Get(filePath); e == nil && file != nil {
+			stored = file.Sha1Hash
+		}
+		if stored != c.stored {
+			t.Errorf("%s: stored sha1 %s, want %s", c.name, stored, c.stored)
+		}
+	}
+}
+
+func TestMatchMoveCandidateUsesDbSha1(t *testing.T) {
+	dir := t.TempDir()
+	localFileDb := NewLocalSyncDb(path.Join(t.TempDir(), "local.bolt"))
+	if _, e := localFileDb.Open(); e != nil {
+		t.Fatal(e)
+	}
+	defer localFileDb.Close()
+	task := &SyncTask{LocalFolderPath: dir, PanFolderPath: "/pan", localFileDb: localFileDb}
+	task.dryRunReport = NewDryRunReport(task)
+	f := &FileActionTaskManager{task: task, moveDetector: newFileMoveDetector()}
+
+	filePath := path.Join(dir, "a.txt")
+	if e := os.WriteFile(filePath, []byte("hello"), 0644); e != nil {
+		t.Fatal(e)
+	}
+	fi, _ := os.Stat(filePath)
+	recorded := newLocalFileItem(fi, filePath)
+	recorded.Sha1Hash = "1111111111111111111111111111111111111111"
+	localFileDb.Add(recorded)
+
+	cases := []struct {
+		name    string
+		panSha1 string
+		want    bool
+	}{
+		{"和实际内容一致但和数据库记录不一致", helloSha1, false},
+		{"和数据库记录一致", "1111111111111111111111111111111111111111", true},
+	}
+	for _, c := range cases {
+		f.moveDetector.addLocalCandidate(newLocalFileItem(fi, filePath))
+		panFile := &PanFileItem{Path: "/pan/b.txt", FileType: "file", FileSize: 5, Sha1Hash: c.panSha1}
+		if got := f.matchLocalMoveCandidate(panFile); got != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+		f.moveDetector.reset()
+	}
+}
+
+func TestFileMoveDetectorCandidates(t *testing.T) {
+	d := newFileMoveDetector()
+	a := &PanFileItem{Path: "/a", FileSize: 5}
+	b := &PanFileItem{Path: "/b", FileSize: 5}
+	d.addPanCandidate(a)
+	d.addPanCandidate(b)
+	if files := d.getPanCandidates(5); len(files) != 2 {
+		t.Fatalf("pan candidates %v", files)
+	}
+	if !d.removePanCandidate(a) || d.removePanCandidate(a) {
+		t.Fatal("candidate should be removed only once")
+	}
+	local := &LocalFileItem{Path: "/l", FileSize: 7}
+	d.addLocalCandidate(local)
+	panCandidates, localCandidates := d.reset()
+	if len(panCandidates[5]) != 1 || panCandidates[5][0] != b || len(localCandidates[7]) != 1 {
+		t.Fatalf("reset returns %v %v", panCandidates, localCandidates)
+	}
+	if len(d.getPanCandidates(5)) != 0 || d.removeLocalCandidate(local) {
+		t.Fatal("candidates should be cleared")
+	}
+}
@@ -0,0 +1,91 @@
+package syncdrive
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/tickstep/aliyunpan/internal/localfile"
+	"github.com/tickstep/aliyunpan/internal/utils"
+	"github.com/tickstep/library-go/logger"
+)
+
+// symlinkManifestFullPath 软链接清单文件，manifest策略下扫描到的软链接记录在这里
+func (t *SyncTask) symlinkManifestFullPath() string {
+	dir := path.Join(t.syncDbFolderPath, t.Id)
+	if b, _ := utils.PathExists(dir); !b {
+		os.MkdirAll(dir, 0755)
+	}
+	return path.Join(dir, "symlinks.json")
+}
+
+// filterLocalFile 按照任务的隐藏文件、软链接策略过滤扫描到的本地文件，并跳过socket、设备文件等特殊文件。
+// 返回需要同步的文件信息，follow策略下返回软链接指向的文件信息，返回nil代表跳过该文件
+func (t *SyncTask) filterLocalFile(file os.FileInfo, fullPath string) os.FileInfo {
+	if t.ExcludeHidden && localfile.IsHiddenFile(fullPath) {
+		logger.Verboseln("隐藏文件，跳过：" + fullPath)
+		return nil
+	}
+	if IsSymlinkFile(file) {
+		switch t.Symlink {
+		case localfile.SymlinkFollow:
+			fi, err := os.Stat(fullPath)
+			if err != nil {
+				PromptPrintln("软链接指向的文件不可读，跳过：" + fullPath)
+				return nil
+			}
+			if fi.IsDir() && t.isSymlinkLoop(fullPath) {
+				PromptPrintln("软链接指向上级文件夹，跳过：" + fullPath)
+				return nil
+			}
+			file = fi
+		case localfile.SymlinkManifestPolicy:
+			t.recordSymlink(fullPath)
+			return nil
+		default:
+			logger.Verboseln("软链接文件，跳过：" + fullPath)
+			return nil
+		}
+	}
+	if fileType := localfile.SpecialFileType(file.Mode()); fileType != "" {
+		PromptPrintln(fmt.Sprintf("特殊文件(%s)，跳过：%s", fileType, fullPath))
+		return nil
+	}
+	return file
+}
+
+// isSymlinkLoop 指向文件夹的软链接是否指向自身所在的上级文件夹，跟随会导致无限循环扫描
+func (t *SyncTask) isSymlinkLoop(fullPath string) bool {
+	target, err := filepath.EvalSymlinks(fullPath)
+	if err != nil {
+		return true
+	}
+	parent, err := filepath.EvalSymlinks(filepath.Dir(fullPath))
+	if err != nil {
+		return true
+	}
+	return parent == target || strings.HasPrefix(parent, target+string(os.PathSeparator))
+}
+
+// recordSymlink 记录软链接到清单文件，清单有变化时才写入
+func (t *SyncTask) recordSymlink(fullPath string) {
+	if !t.symlinkManifest.Add(fullPath, localfile.ReadSymlink(fullPath)) {
+		return
+	}
+	if err := t.symlinkManifest.Save(t.symlinkManifestFullPath()); err != nil {
+		logger.Verboseln("save symlink manifest error: ", err)
+		return
+	}
+	PromptPrintln("软链接，记录到清单：" + fullPath)
+}
+
+// skipPanFileByLocal 云盘文件对应的本地文件被过滤时，云盘文件也不参与对比，避免被删除或者覆盖本地的软链接
+func (t *SyncTask) skipPanFileByLocal(fileName string, skippedLocalNames map[string]bool) bool {
+	if skippedLocalNames[fileName] {
+		return true
+	}
+	// 云盘文件没有隐藏属性，只能按照文件名判断
+	return t.ExcludeHidden && localfile.IsHiddenFile(fileName)
+}
@@ -0,0 +1,93 @@
+package syncdrive
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+type (
+	// localWatchBackend 本地目录变更监听的平台实现
+	localWatchBackend interface {
+		// add 监听文件夹，只监听文件夹下一级的文件变化，子文件夹需要单独添加
+		add(dir string) error
+		close() error
+	}
+
+	// localWatcher 本地目录变更监听。监听到文件新建、修改、删除后记录发生变化的文件夹，
+	// 扫描进程只需要重新扫描这些文件夹即可，不需要每一轮都全量扫描整个本地目录
+	localWatcher struct {
+		mutex       sync.Mutex
+		changedDirs map[string]struct{}
+		overflow    bool // 有变更事件丢失，需要进行一次全量扫描
+		backend     localWatchBackend
+	}
+)
+
+var (
+	// ErrLocalWatchNotSupported 当前系统不支持监听本地目录变更
+	ErrLocalWatchNotSupported = errors.New("当前系统不支持监听本地目录变更")
+)
+
+// newLocalWatcher 创建本地目录变更监听，当前系统不支持时返回 ErrLocalWatchNotSupported
+func newLocalWatcher() (*localWatcher, error) {
+	w := &localWatcher{
+		changedDirs: map[string]struct{}{},
+	}
+	backend, err := newLocalWatchBackend(w)
+	if err != nil {
+		return nil, err
+	}
+	w.backend = backend
+	return w, nil
+}
+
+// AddDir 监听文件夹。监听失败会丢失该文件夹的变更，只能等待下一次全量扫描
+func (w *localWatcher) AddDir(dir string) error {
+	if err := w.backend.add(dir); err != nil {
+		w.onOverflow()
+		return err
+	}
+	return nil
+}
+
+// onChange 文件夹下有文件发生了变化
+func (w *localWatcher) onChange(dir string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.changedDirs[dir] = struct{}{}
+}
+
+// onOverflow 变更事件丢失
+func (w *localWatcher) onOverflow() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.overflow = true
+}
+
+// HasChanges 是否有待处理的变更
+func (w *localWatcher) HasChanges() bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.overflow || len(w.changedDirs) > 0
+}
+
+// Drain 取出所有发生变化的文件夹并清空记录，overflow为true代表有变更丢失，需要全量扫描
+func (w *localWatcher) Drain() (dirs []string, overflow bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	dirs = make([]string, 0, len(w.changedDirs))
+	for dir := range w.changedDirs {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	overflow = w.overflow
+	w.changedDirs = map[string]struct{}{}
+	w.overflow = false
+	return dirs, overflow
+}
+
+// Close 停止监听
+func (w *localWatcher) Close() error {
+	return w.backend.close()
+}
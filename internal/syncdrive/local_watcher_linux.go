@@ -0,0 +1,91 @@
+//go:build linux
+// +build linux
+
+package syncdrive
+
+import (
+	"github.com/tickstep/library-go/logger"
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// inotifyWatchMask 需要监听的事件：文件新建、修改完成、删除、移入、移出以及属性变化
+	inotifyWatchMask = syscall.IN_CREATE | syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY | syscall.IN_DELETE |
+		syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_ATTRIB
+)
+
+type (
+	// inotifyBackend 使用Linux inotify监听本地目录变更
+	inotifyBackend struct {
+		watcher *localWatcher
+		file    *os.File
+		fd      int
+		mutex   sync.Mutex
+		wdPaths map[int32]string // watch descriptor => 文件夹路径
+	}
+)
+
+func newLocalWatchBackend(w *localWatcher) (localWatchBackend, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	b := &inotifyBackend{
+		watcher: w,
+		// 非阻塞的文件描述符交由Go运行时轮询，关闭文件后读取进程可以正常退出
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		fd:      fd,
+		wdPaths: map[int32]string{},
+	}
+	go b.readLoop()
+	return b, nil
+}
+
+func (b *inotifyBackend) add(dir string) error {
+	wd, err := syscall.InotifyAddWatch(b.fd, dir, inotifyWatchMask)
+	if err != nil {
+		return err
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.wdPaths[int32(wd)] = dir
+	return nil
+}
+
+func (b *inotifyBackend) close() error {
+	return b.file.Close()
+}
+
+func (b *inotifyBackend) readLoop() {
+	buf := make([]byte, syscall.SizeofInotifyEvent*4096)
+	for {
+		n, err := b.file.Read(buf)
+		if err != nil {
+			logger.Verboseln("local watcher read loop exit: ", err)
+			return
+		}
+		offset := 0
+		for offset+syscall.SizeofInotifyEvent <= n {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			offset += syscall.SizeofInotifyEvent + int(event.Len)
+
+			if event.Mask&syscall.IN_Q_OVERFLOW != 0 {
+				b.watcher.onOverflow()
+				continue
+			}
+			b.mutex.Lock()
+			dir, ok := b.wdPaths[event.Wd]
+			if event.Mask&syscall.IN_IGNORED != 0 {
+				// 文件夹已被删除或者移走，监听自动失效
+				delete(b.wdPaths, event.Wd)
+			}
+			b.mutex.Unlock()
+			if ok && event.Mask&inotifyWatchMask != 0 {
+				b.watcher.onChange(dir)
+			}
+		}
+	}
+}
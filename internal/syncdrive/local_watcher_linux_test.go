@@ -0,0 +1,53 @@
+//go:build linux
+// +build linux
+
+package syncdrive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLocalWatcher(t *testing.T) {
+	root := t.TempDir()
+	sub := filepath.Join(root, "sub")
+	os.MkdirAll(sub, 0755)
+
+	w, err := newLocalWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.AddDir(root)
+	w.AddDir(sub)
+
+	os.WriteFile(filepath.Join(sub, "1.txt"), []byte("hello"), 0644)
+	for i := 0; i < 50 && !w.HasChanges(); i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	dirs, overflow := w.Drain()
+	if overflow || len(dirs) != 1 || dirs[0] != sub {
+		t.Fatalf("unexpected changes: %v %v", dirs, overflow)
+	}
+	if w.HasChanges() {
+		t.Fatal("changes should be drained")
+	}
+
+	os.RemoveAll(sub)
+	for i := 0; i < 50 && !w.HasChanges(); i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	dirs, _ = w.Drain()
+	found := false
+	for _, d := range dirs {
+		if d == root {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("root folder change not detected: %v", dirs)
+	}
+}
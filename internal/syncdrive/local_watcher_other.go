@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package syncdrive
+
+// newLocalWatchBackend 其他系统暂不支持监听，只使用定时全量扫描
+func newLocalWatchBackend(w *localWatcher) (localWatchBackend, error) {
+	return nil, ErrLocalWatchNotSupported
+}
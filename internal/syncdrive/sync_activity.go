@@ -0,0 +1,71 @@
+package syncdrive
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// syncActivity 记录同步任务各个进程最后活动的时间，用于看门狗检测任务是否卡死。
+// 扫描进程、文件执行进程每轮循环记录一次；正在传输文件时，只有传输了数据才记录，传输卡住时不会被执行进程的循环掩盖
+type syncActivity struct {
+	scanAt     int64 // 扫描进程最后活动的时间
+	executorAt int64 // 文件执行进程最后活动的时间
+	transferAt int64 // 最后一次传输数据的时间
+	transfers  int32 // 正在传输的文件数量
+}
+
+func (a *syncActivity) touchScan() {
+	if a != nil {
+		atomic.StoreInt64(&a.scanAt, time.Now().UnixNano())
+	}
+}
+
+func (a *syncActivity) touchExecutor() {
+	if a != nil {
+		atomic.StoreInt64(&a.executorAt, time.Now().UnixNano())
+	}
+}
+
+// touchTransfer 记录有数据传输
+func (a *syncActivity) touchTransfer() {
+	if a != nil {
+		atomic.StoreInt64(&a.transferAt, time.Now().UnixNano())
+	}
+}
+
+// beginTransfer 开始传输一个文件，从开始传输的时间计算超时
+func (a *syncActivity) beginTransfer() {
+	if a != nil {
+		a.touchTransfer()
+		atomic.AddInt32(&a.transfers, 1)
+	}
+}
+
+func (a *syncActivity) endTransfer() {
+	if a != nil {
+		atomic.AddInt32(&a.transfers, -1)
+	}
+}
+
+// isActive 各个进程是否都在 timeout 时间内有活动。scanning、executing 表示扫描进程、文件执行进程是否在运行，
+// 已经退出的进程不检测；没有正在传输的文件时不检测数据传输
+func (a *syncActivity) isActive(timeout time.Duration, scanning, executing bool) bool {
+	if a == nil {
+		return true
+	}
+	within := func(at *int64) bool {
+		t := atomic.LoadInt64(at)
+		// 还没有启动
+		return t == 0 || time.Since(time.Unix(0, t)) <= timeout
+	}
+	if scanning && !within(&a.scanAt) {
+		return false
+	}
+	if executing && !within(&a.executorAt) {
+		return false
+	}
+	if atomic.LoadInt32(&a.transfers) > 0 && !within(&a.transferAt) {
+		return false
+	}
+	return true
+}
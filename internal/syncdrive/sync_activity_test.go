@@ -0,0 +1,98 @@
+package syncdrive
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSyncActivityIsActive(t *testing.T) {
+	timeout := time.Minute
+	stale := time.Now().Add(-2 * timeout).UnixNano()
+	fresh := time.Now().UnixNano()
+	cases := []struct {
+		name      string
+		activity  syncActivity
+		scanning  bool
+		executing bool
+		want      bool
+	}{
+		{"还没有启动", syncActivity{}, true, true, true},
+		{"扫描进程活动", syncActivity{scanAt: fresh}, true, false, true},
+		{"扫描进程卡住", syncActivity{scanAt: stale}, true, false, false},
+		{"扫描进程已经退出", syncActivity{scanAt: stale}, false, false, true},
+		{"执行进程卡住", syncActivity{scanAt: fresh, executorAt: stale}, true, true, false},
+		// 执行进程的循环还在运行，但是正在传输的文件没有数据传输
+		{"传输卡住", syncActivity{scanAt: fresh, executorAt: fresh, transferAt: stale, transfers: 1}, true, true, false},
+		{"传输中", syncActivity{scanAt: fresh, executorAt: fresh, transferAt: fresh, transfers: 2}, true, true, true},
+		{"没有正在传输的文件", syncActivity{scanAt: fresh, executorAt: fresh, transferAt: stale}, true, true, true},
+		{"一次运行模式扫描完成后只检测传输", syncActivity{scanAt: stale, executorAt: fresh, transferAt: fresh, transfers: 1}, false, true, true},
+	}
+	for _, c := range cases {
+		if got := c.activity.isActive(timeout, c.scanning, c.executing); got != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+
+	var nilActivity *syncActivity
+	nilActivity.touchTransfer()
+	nilActivity.beginTransfer()
+	nilActivity.endTransfer()
+	if !nilActivity.isActive(timeout, true, true) {
+		t.Error("nil activity should be active")
+	}
+}
+
+func TestSyncActivityTransfer(t *testing.T) {
+	a := &syncActivity{transferAt: time.Now().Add(-time.Hour).UnixNano()}
+	// 开始传输时重新计算超时
+	a.beginTransfer()
+	if !a.isActive(time.Minute, false, false) {
+		t.Fatal("transfer just began")
+	}
+	a.transferAt = time.Now().Add(-time.Hour).UnixNano()
+	if a.isActive(time.Minute, false, false) {
+		t.Fatal("transfer is stalled")
+	}
+	a.touchTransfer()
+	if !a.isActive(time.Minute, false, false) {
+		t.Fatal("transfer made progress")
+	}
+	a.transferAt = time.Now().Add(-time.Hour).UnixNano()
+	a.endTransfer()
+	if !a.isActive(time.Minute, false, false) {
+		t.Fatal("no transfer in progress")
+	}
+}
+
+func TestSyncTaskIsActive(t *testing.T) {
+	task := &SyncTask{CycleModeType: CycleOneTime, resourceMutex: &sync.Mutex{}}
+	if !task.IsActive(time.Minute) {
+		t.Fatal("task not started")
+	}
+	task.activity = &syncActivity{scanAt: time.Now().Add(-time.Hour).UnixNano()}
+	task.fileActionTaskManager = NewFileActionTaskManager(task)
+	if task.IsActive(time.Minute) {
+		t.Fatal("scan loop is stalled")
+	}
+
+	// 一次运行模式扫描完成后扫描进程退出，只要还在传输数据就是活动的
+	task.SetScanLoopFlag(true)
+	task.fileActionTaskManager.setExecuteLoopFlag(false)
+	task.activity.touchExecutor()
+	task.activity.beginTransfer()
+	if !task.IsActive(time.Minute) {
+		t.Fatal("transfer in progress after scan finished")
+	}
+	task.activity.transferAt = time.Now().Add(-time.Hour).UnixNano()
+	if task.IsActive(time.Minute) {
+		t.Fatal("transfer is stalled")
+	}
+
+	// 循环运行模式扫描进程一直运行
+	task.CycleModeType = CycleInfiniteLoop
+	task.activity.endTransfer()
+	if task.IsActive(time.Minute) {
+		t.Fatal("scan loop of infinite cycle is stalled")
+	}
+}
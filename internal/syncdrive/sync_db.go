@@ -176,6 +176,10 @@ const (
 	SyncFileActionDeletePan         SyncFileAction = "delete_pan"
 	SyncFileActionCreateLocalFolder SyncFileAction = "create_local_folder"
 	SyncFileActionCreatePanFolder   SyncFileAction = "create_pan_folder"
+	// SyncFileActionMovePan 移动/重命名云盘文件，只用于dry-run报告
+	SyncFileActionMovePan SyncFileAction = "move_pan"
+	// SyncFileActionMoveLocal 移动/重命名本地文件，只用于dry-run报告
+	SyncFileActionMoveLocal SyncFileAction = "move_local"
 
 	// ScanStatusNormal 正常
 	ScanStatusNormal ScanStatus = "normal"
@@ -0,0 +1,97 @@
+package syncdrive
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tickstep/aliyunpan/internal/notify"
+	"github.com/tickstep/library-go/converter"
+)
+
+type (
+	// syncDigestStat 统计一次扫描-执行循环中上传、下载的文件，循环结束时作为一个批次记录到每日汇总并推送Webhook
+	syncDigestStat struct {
+		mutex        sync.Mutex
+		startAt      time.Time
+		totalFiles   int
+		succeedFiles int
+		failedFiles  int
+		totalSize    int64
+		failedList   []string
+	}
+)
+
+// add 记录一个文件的执行结果
+func (s *syncDigestStat) add(filePath string, fileSize int64, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.totalFiles == 0 {
+		s.startAt = time.Now()
+	}
+	s.totalFiles++
+	if err == nil {
+		s.succeedFiles++
+		s.totalSize += fileSize
+		return
+	}
+	s.failedFiles++
+	if len(s.failedList) < notify.MaxDigestFailedFiles {
+		s.failedList = append(s.failedList, filePath+": "+err.Error())
+	}
+}
+
+// flush 生成批次并清空统计，没有执行任何文件时返回nil
+func (s *syncDigestStat) flush(target string) *notify.DigestBatch {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.totalFiles == 0 {
+		return nil
+	}
+	batch := &notify.DigestBatch{
+		Type:         "同步",
+		Target:       target,
+		TotalFiles:   s.totalFiles,
+		SucceedFiles: s.succeedFiles,
+		FailedFiles:  s.failedFiles,
+		TotalSize:    s.totalSize,
+		Elapsed:      int64(time.Since(s.startAt).Seconds()),
+		FailedList:   s.failedList,
+	}
+	s.totalFiles, s.succeedFiles, s.failedFiles, s.totalSize = 0, 0, 0, 0
+	s.failedList = nil
+	return batch
+}
+
+// recordDigest 记录上传、下载文件的执行结果到每日汇总统计
+func (f *FileActionTaskManager) recordDigest(syncFile *SyncFileItem, err error) {
+	if f.syncOption.NotifyDigest == nil && f.syncOption.Webhook == nil {
+		return
+	}
+	if syncFile.Action == SyncFileActionUpload {
+		f.digestStat.add(syncFile.getLocalFileFullPath(), syncFile.LocalFile.FileSize, err)
+	} else if syncFile.Action == SyncFileActionDownload {
+		f.digestStat.add(syncFile.getPanFileFullPath(), syncFile.PanFile.FileSize, err)
+	}
+}
+
+// flushDigest 一次扫描-执行循环结束，把统计结果作为一个批次记录到每日汇总，并推送sync.finish事件
+func (f *FileActionTaskManager) flushDigest() {
+	if f.syncOption.NotifyDigest == nil && f.syncOption.Webhook == nil {
+		return
+	}
+	target := f.task.Name + " (" + f.task.LocalFolderPath + " <-> " + f.task.PanFolderPath + ")"
+	batch := f.digestStat.flush(target)
+	if batch == nil {
+		return
+	}
+	f.syncOption.NotifyDigest.Add(batch)
+	// 异步推送，不阻塞同步任务
+	f.syncOption.Webhook.Post(&notify.WebhookEvent{
+		Event: notify.EventSyncFinish,
+		Title: "同步完成",
+		Message: fmt.Sprintf("%s, 成功 %d 个, 失败 %d 个, 数据总量: %s", target, batch.SucceedFiles, batch.FailedFiles,
+			converter.ConvertFileSize(batch.TotalSize, 2)),
+		Data: batch,
+	})
+}
@@ -0,0 +1,258 @@
+package syncdrive
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tickstep/aliyunpan/cmder/cmdtable"
+	"github.com/tickstep/library-go/converter"
+	"github.com/tickstep/library-go/logger"
+)
+
+type (
+	// DryRunItem dry-run模式下将要执行的文件操作
+	DryRunItem struct {
+		Action    SyncFileAction `json:"action"`
+		LocalPath string         `json:"localPath"`
+		PanPath   string         `json:"panPath"`
+		FileSize  int64          `json:"fileSize"`
+		// Conflict 本地和云盘文件都有修改，按照冲突处理策略决定的操作
+		Conflict bool `json:"conflict,omitempty"`
+	}
+
+	// DryRunReport dry-run模式的差异报告，只对比文件，不实际上传、下载或删除
+	DryRunReport struct {
+		Name            string        `json:"name"`
+		Mode            SyncMode      `json:"mode"`
+		Policy          SyncPolicy    `json:"policy"`
+		LocalFolderPath string        `json:"localFolderPath"`
+		PanFolderPath   string        `json:"panFolderPath"`
+		Items           []*DryRunItem `json:"items"`
+		mutex           sync.Mutex
+	}
+)
+
+var (
+	// dryRunActionOrder 报告中操作的展示顺序和名称
+	dryRunActionOrder = []SyncFileAction{
+		SyncFileActionCreatePanFolder,
+		SyncFileActionUpload,
+		SyncFileActionMovePan,
+		SyncFileActionDeletePan,
+		SyncFileActionCreateLocalFolder,
+		SyncFileActionDownload,
+		SyncFileActionMoveLocal,
+		SyncFileActionDeleteLocal,
+	}
+	dryRunActionName = map[SyncFileAction]string{
+		SyncFileActionCreatePanFolder:   "创建云盘文件夹",
+		SyncFileActionUpload:            "上传",
+		SyncFileActionDeletePan:         "删除云盘文件",
+		SyncFileActionCreateLocalFolder: "创建本地文件夹",
+		SyncFileActionDownload:          "下载",
+		SyncFileActionDeleteLocal:       "删除本地文件",
+		SyncFileActionMovePan:           "移动云盘文件",
+		SyncFileActionMoveLocal:         "移动本地文件",
+	}
+
+	// dryRunDbFiles dry-run模式复制的数据库文件，同步过程数据库不复制，避免执行上一次未完成的任务
+	dryRunDbFiles = []string{"local.bolt", "pan.bolt", "snapshot.bolt"}
+)
+
+// NewDryRunReport 创建差异报告
+func NewDryRunReport(task *SyncTask) *DryRunReport {
+	return &DryRunReport{
+		Name:            task.Name,
+		Mode:            task.Mode,
+		Policy:          task.Policy,
+		LocalFolderPath: task.LocalFolderPath,
+		PanFolderPath:   task.PanFolderPath,
+		Items:           []*DryRunItem{},
+	}
+}
+
+func (r *DryRunReport) add(item *DryRunItem) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.Items = append(r.Items, item)
+}
+
+// Count 指定操作的文件数量和数据量
+func (r *DryRunReport) Count(action SyncFileAction) (count int, size int64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, item := range r.Items {
+		if item.Action == action {
+			count++
+			size += item.FileSize
+		}
+	}
+	return
+}
+
+// sort 按照操作、本地路径排序，输出稳定的报告
+func (r *DryRunReport) sort() {
+	order := map[SyncFileAction]int{}
+	for k, action := range dryRunActionOrder {
+		order[action] = k
+	}
+	sort.SliceStable(r.Items, func(i, j int) bool {
+		if r.Items[i].Action != r.Items[j].Action {
+			return order[r.Items[i].Action] < order[r.Items[j].Action]
+		}
+		return r.Items[i].LocalPath < r.Items[j].LocalPath
+	})
+}
+
+// Print 输出差异报告
+func (r *DryRunReport) Print(w io.Writer) {
+	r.mutex.Lock()
+	r.sort()
+	r.mutex.Unlock()
+
+	fmt.Fprintf(w, "\n[dry-run] 任务: %s\n本地目录: %s\n云盘目录: %s\n", r.Name, r.LocalFolderPath, r.PanFolderPath)
+	conflicts := 0
+	for _, item := range r.Items {
+		if item.Conflict {
+			conflicts++
+		}
+	}
+	for _, action := range dryRunActionOrder {
+		if count, size := r.Count(action); count > 0 {
+			fmt.Fprintf(w, "%s: %d, 数据量: %s\n", dryRunActionName[action], count, converter.ConvertFileSize(size, 2))
+		}
+	}
+	if conflicts > 0 {
+		fmt.Fprintf(w, "冲突文件: %d\n", conflicts)
+	}
+	if len(r.Items) == 0 {
+		fmt.Fprintf(w, "本地目录和云盘一致，无需同步\n")
+		return
+	}
+	tb := cmdtable.NewTable(w)
+	tb.SetHeader([]string{"操作", "本地路径", "云盘路径", "大小"})
+	for _, item := range r.Items {
+		name := dryRunActionName[item.Action]
+		if item.Conflict {
+			name += "(冲突)"
+		}
+		size := "-"
+		if item.Action == SyncFileActionUpload || item.Action == SyncFileActionDownload {
+			size = converter.ConvertFileSize(item.FileSize, 2)
+		}
+		tb.Append([]string{name, item.LocalPath, item.PanPath, size})
+	}
+	tb.Render()
+}
+
+// DryRunReport 获取差异报告，非dry-run模式返回nil
+func (t *SyncTask) DryRunReport() *DryRunReport {
+	return t.dryRunReport
+}
+
+// isDryRun 是否是dry-run模式
+func (f *FileActionTaskManager) isDryRun() bool {
+	return f.task.dryRunReport != nil
+}
+
+// addDryRunItem dry-run模式下记录将要执行的操作
+func (f *FileActionTaskManager) addDryRunItem(action SyncFileAction, localPath, panPath string, fileSize int64) {
+	f.task.dryRunReport.add(&DryRunItem{
+		Action:    action,
+		LocalPath: localPath,
+		PanPath:   panPath,
+		FileSize:  fileSize,
+	})
+}
+
+// addDryRunMovePan dry-run模式下记录将要执行的云盘文件移动/重命名，不实际移动文件
+func (f *FileActionTaskManager) addDryRunMovePan(panFile *PanFileItem, localPath, targetPanPath string) {
+	f.addDryRunItem(SyncFileActionMovePan, localPath, panFile.Path+" => "+targetPanPath, panFile.FileSize)
+}
+
+// addDryRunMoveLocal dry-run模式下记录将要执行的本地文件移动/重命名，不实际移动文件
+func (f *FileActionTaskManager) addDryRunMoveLocal(localFile *LocalFileItem, targetLocalPath string, panFile *PanFileItem) {
+	f.addDryRunItem(SyncFileActionMoveLocal, localFile.Path+" => "+targetLocalPath, panFile.Path, localFile.FileSize)
+}
+
+// addDryRunConflict dry-run模式下记录冲突文件按照冲突处理策略将要执行的操作
+func (f *FileActionTaskManager) addDryRunConflict(localFile *LocalFileItem, panFile *PanFileItem, policy SyncConflictPolicy) {
+	upload := &DryRunItem{
+		Action:    SyncFileActionUpload,
+		LocalPath: localFile.Path,
+		PanPath:   panFile.Path,
+		FileSize:  localFile.FileSize,
+		Conflict:  true,
+	}
+	download := &DryRunItem{
+		Action:    SyncFileActionDownload,
+		LocalPath: localFile.Path,
+		PanPath:   panFile.Path,
+		FileSize:  panFile.FileSize,
+		Conflict:  true,
+	}
+	switch policy {
+	case SyncConflictLocal:
+		f.task.dryRunReport.add(upload)
+	case SyncConflictCloud:
+		f.task.dryRunReport.add(download)
+	case SyncConflictKeepBoth:
+		// 本地文件重命名后作为新文件上传，云盘文件下载到原路径
+		conflictPath := conflictFilePath(localFile.Path, time.Now())
+		upload.LocalPath = conflictPath
+		upload.PanPath = f.getPanPathFromLocalPath(conflictPath)
+		upload.Conflict = false
+		f.task.dryRunReport.add(upload)
+		f.task.dryRunReport.add(download)
+	default:
+		if localFile.UpdateTimeUnix() >= panFile.UpdateTimeUnix() {
+			f.task.dryRunReport.add(upload)
+		} else {
+			f.task.dryRunReport.add(download)
+		}
+	}
+}
+
+// setupDryRunDb 复制同步数据库到临时目录，dry-run模式使用副本对比文件，不修改真实的同步数据库
+func (t *SyncTask) setupDryRunDb() error {
+	tmpDir, err := ioutil.TempDir("", "aliyunpan-sync-dry-run-")
+	if err != nil {
+		return err
+	}
+	srcDir := path.Join(t.syncDbFolderPath, t.Id)
+	dstDir := path.Join(tmpDir, t.Id)
+	if err = os.MkdirAll(dstDir, 0755); err != nil {
+		os.RemoveAll(tmpDir)
+		return err
+	}
+	for _, name := range dryRunDbFiles {
+		data, e := ioutil.ReadFile(path.Join(srcDir, name))
+		if e != nil {
+			// 数据库不存在，说明任务还没有运行过
+			continue
+		}
+		if e = ioutil.WriteFile(path.Join(dstDir, name), data, 0644); e != nil {
+			os.RemoveAll(tmpDir)
+			return e
+		}
+	}
+	logger.Verboseln("dry-run sync db folder: ", tmpDir)
+	t.syncDbFolderPath = tmpDir
+	t.dryRunDbFolderPath = tmpDir
+	return nil
+}
+
+// cleanDryRunDb 删除dry-run模式使用的数据库副本
+func (t *SyncTask) cleanDryRunDb() {
+	if t.dryRunDbFolderPath == "" {
+		return
+	}
+	os.RemoveAll(t.dryRunDbFolderPath)
+	t.dryRunDbFolderPath = ""
+}
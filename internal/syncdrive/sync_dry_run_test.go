@@ -0,0 +1,90 @@
+package syncdrive
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestSetupDryRunDb(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "sync-dry-run-test")
+	defer os.RemoveAll(dir)
+	os.MkdirAll(path.Join(dir, "task1"), 0755)
+	for _, name := range []string{"local.bolt", "sync.bolt"} {
+		ioutil.WriteFile(path.Join(dir, "task1", name), []byte(name), 0644)
+	}
+
+	task := &SyncTask{Id: "task1", syncDbFolderPath: dir}
+	if e := task.setupDryRunDb(); e != nil {
+		t.Fatal(e)
+	}
+	tmpDir := task.syncDbFolderPath
+	if tmpDir == dir {
+		t.Fatal("dry-run should use a copy of sync db")
+	}
+	if data, e := ioutil.ReadFile(task.localSyncDbFullPath()); e != nil || string(data) != "local.bolt" {
+		t.Fatalf("local db not copied: %s, %v", data, e)
+	}
+	if fi, _ := os.Stat(task.syncFileDbFullPath()); fi != nil {
+		t.Fatal("sync db should not be copied")
+	}
+	task.cleanDryRunDb()
+	if _, e := os.Stat(tmpDir); !os.IsNotExist(e) {
+		t.Fatal("dry-run db copy should be removed")
+	}
+}
+
+func TestDryRunReport(t *testing.T) {
+	r := NewDryRunReport(&SyncTask{Name: "test"})
+	r.add(&DryRunItem{Action: SyncFileActionDeletePan, LocalPath: "/l/c", PanPath: "/p/c", FileSize: 5})
+	r.add(&DryRunItem{Action: SyncFileActionUpload, LocalPath: "/l/b", PanPath: "/p/b", FileSize: 20})
+	r.add(&DryRunItem{Action: SyncFileActionUpload, LocalPath: "/l/a", PanPath: "/p/a", FileSize: 10})
+	if count, size := r.Count(SyncFileActionUpload); count != 2 || size != 30 {
+		t.Fatalf("upload count: %d, size: %d", count, size)
+	}
+	buf := &bytes.Buffer{}
+	r.Print(buf)
+	if r.Items[0].LocalPath != "/l/a" || r.Items[2].Action != SyncFileActionDeletePan {
+		t.Fatalf("unexpected order: %v", r.Items)
+	}
+	if !strings.Contains(buf.String(), "删除云盘文件: 1") {
+		t.Fatal(buf.String())
+	}
+}
+
+func TestDryRunMoveDetect(t *testing.T) {
+	dir := t.TempDir()
+	oldPath := path.Join(dir, "a.txt")
+	ioutil.WriteFile(oldPath, []byte("hello"), 0644)
+
+	task := &SyncTask{LocalFolderPath: dir, PanFolderPath: "/pan"}
+	task.dryRunReport = NewDryRunReport(task)
+	f := &FileActionTaskManager{task: task, moveDetector: newFileMoveDetector()}
+
+	// 下载模式：云盘文件 a.txt 被重命名为 b.txt
+	f.moveDetector.addLocalCandidate(&LocalFileItem{Path: oldPath, FileType: "file", FileSize: 5, Sha1Hash: "abc"})
+	if !f.matchLocalMoveCandidate(&PanFileItem{Path: "/pan/b.txt", FileType: "file", FileSize: 5, Sha1Hash: "ABC"}) {
+		t.Fatal("move should be detected")
+	}
+	if _, e := os.Stat(oldPath); e != nil {
+		t.Fatal("dry-run should not move local file")
+	}
+	if count, _ := task.dryRunReport.Count(SyncFileActionMoveLocal); count != 1 {
+		t.Fatalf("move local count: %d", count)
+	}
+
+	// 上传模式：本地文件 a.txt 被重命名为 c.txt，云盘文件不会被移动
+	panFile := &PanFileItem{FileId: "1", Path: "/pan/a.txt", FileType: "file", FileSize: 5, Sha1Hash: "AAF4C61DDCC5E8A2DABEDE0F3B482CD9AEA9434D"}
+	f.moveDetector.addPanCandidate(panFile)
+	newPath := path.Join(dir, "c.txt")
+	ioutil.WriteFile(newPath, []byte("hello"), 0644)
+	if !f.matchPanMoveCandidate(&LocalFileItem{Path: newPath, FileType: "file", FileSize: 5}) {
+		t.Fatal("pan move should be detected")
+	}
+	if count, _ := task.dryRunReport.Count(SyncFileActionMovePan); count != 1 {
+		t.Fatalf("move pan count: %d", count)
+	}
+}
@@ -0,0 +1,30 @@
+package syncdrive
+
+import (
+	"github.com/tickstep/aliyunpan/internal/metrics"
+)
+
+// metricsKey 同步任务在指标注册表中的key
+func (f *FileActionTaskManager) metricsKey() string {
+	return "sync-" + f.task.Id
+}
+
+// collectMetrics 采集同步任务的速度以及待执行的文件数量，输出到 /metrics
+func (f *FileActionTaskManager) collectMetrics() []*metrics.Point {
+	pending := 0
+	for _, status := range []SyncFileStatus{SyncFileStatusCreate, SyncFileStatusUploading, SyncFileStatusDownloading} {
+		if files, e := f.task.syncFileDb.GetFileList(status); e == nil {
+			pending += len(files)
+		}
+	}
+	return []*metrics.Point{{
+		Measurement: "sync",
+		Tags:        map[string]string{"task": f.task.Name, "id": f.task.Id, "mode": string(f.task.Mode)},
+		Fields: map[string]float64{
+			"upload_speed":   float64(f.uploadSpeedsStat.GetSpeeds()),
+			"download_speed": float64(f.downloadSpeedsStat.GetSpeeds()),
+			"queue":          float64(pending),
+			"in_process":     float64(f.fileInProcessQueue.Length()),
+		},
+	}}
+}
@@ -0,0 +1,106 @@
+package syncdrive
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan/cmder/cmdtable"
+	"github.com/tickstep/aliyunpan/internal/localfile"
+	"github.com/tickstep/library-go/logger"
+)
+
+type (
+	// RestoreReport 还原模式的执行报告
+	RestoreReport struct {
+		missingFiles  []string // 本地缺失，从云盘下载的文件
+		modifiedFiles []string // 本地已修改，使用云盘文件覆盖的文件
+		deletedFiles  []string // 本地多余，已删除的文件
+		failedFiles   []string // 还原失败的文件
+		mutex         sync.Mutex
+	}
+)
+
+// NewRestoreReport 创建还原报告
+func NewRestoreReport() *RestoreReport {
+	return &RestoreReport{}
+}
+
+func (r *RestoreReport) addMissing(filePath string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.missingFiles = append(r.missingFiles, filePath)
+}
+
+func (r *RestoreReport) addModified(filePath string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.modifiedFiles = append(r.modifiedFiles, filePath)
+}
+
+func (r *RestoreReport) addDeleted(filePath string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.deletedFiles = append(r.deletedFiles, filePath)
+}
+
+func (r *RestoreReport) addFailed(filePath string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.failedFiles = append(r.failedFiles, filePath)
+}
+
+// Print 输出还原报告
+func (r *RestoreReport) Print(w io.Writer) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	fmt.Fprintf(w, "\n还原报告:\n")
+	fmt.Fprintf(w, "下载缺失文件: %d, 覆盖已修改文件: %d, 删除多余文件: %d, 失败: %d\n",
+		len(r.missingFiles), len(r.modifiedFiles), len(r.deletedFiles), len(r.failedFiles))
+	if len(r.missingFiles)+len(r.modifiedFiles)+len(r.deletedFiles)+len(r.failedFiles) == 0 {
+		fmt.Fprintf(w, "本地目录和云盘一致，无需还原\n")
+		return
+	}
+	tb := cmdtable.NewTable(w)
+	tb.SetHeader([]string{"操作", "本地文件"})
+	for _, p := range r.missingFiles {
+		tb.Append([]string{"下载缺失", p})
+	}
+	for _, p := range r.modifiedFiles {
+		tb.Append([]string{"覆盖修改", p})
+	}
+	for _, p := range r.deletedFiles {
+		tb.Append([]string{"删除多余", p})
+	}
+	for _, p := range r.failedFiles {
+		tb.Append([]string{"失败", p})
+	}
+	tb.Render()
+}
+
+// RestoreReport 获取还原报告，非还原模式返回nil
+func (t *SyncTask) RestoreReport() *RestoreReport {
+	return t.restoreReport
+}
+
+// isLocalFileChanged 还原模式下检测本地文件是否和云盘文件不一致，需要实际计算本地文件SHA1
+func isLocalFileChanged(localFile *LocalFileItem, panFile *PanFileItem) bool {
+	if localFile.FileSize != panFile.FileSize {
+		return true
+	}
+	sha1Str := aliyunpan.DefaultZeroSizeFileContentHash
+	if localFile.FileSize > 0 {
+		fileSum := localfile.NewLocalFileEntity(localFile.Path)
+		if err := fileSum.OpenPath(); err != nil {
+			logger.Verbosef("文件不可读, 错误信息: %s\n", err)
+			return true
+		}
+		fileSum.Sum(localfile.CHECKSUM_SHA1)
+		sha1Str = fileSum.SHA1
+		fileSum.Close()
+	}
+	return strings.ToLower(sha1Str) != strings.ToLower(panFile.Sha1Hash)
+}
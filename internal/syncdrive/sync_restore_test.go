@@ -0,0 +1,118 @@
+package syncdrive
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+)
+
+func TestIsLocalFileChanged(t *testing.T) {
+	dir := t.TempDir()
+	hello := path.Join(dir, "hello.txt")
+	os.WriteFile(hello, []byte("hello"), 0644)
+	broken := path.Join(dir, "broken.txt")
+	os.WriteFile(broken, []byte("hellx"), 0644)
+	empty := path.Join(dir, "empty.txt")
+	os.WriteFile(empty, nil, 0644)
+
+	panFile := &PanFileItem{FileSize: 5, Sha1Hash: strings.ToLower(helloSha1)}
+	cases := []struct {
+		local   *LocalFileItem
+		panFile *PanFileItem
+		changed bool
+	}{
+		{&LocalFileItem{Path: hello, FileSize: 5}, panFile, false},
+		// 大小相同但内容被改坏
+		{&LocalFileItem{Path: broken, FileSize: 5}, panFile, true},
+		{&LocalFileItem{Path: hello, FileSize: 6}, panFile, true},
+		// 本地文件不可读
+		{&LocalFileItem{Path: path.Join(dir, "none.txt"), FileSize: 5}, panFile, true},
+		{&LocalFileItem{Path: empty, FileSize: 0}, &PanFileItem{FileSize: 0, Sha1Hash: aliyunpan.DefaultZeroSizeFileContentHash}, false},
+	}
+	for i, c := range cases {
+		if got := isLocalFileChanged(c.local, c.panFile); got != c.changed {
+			t.Errorf("case %d: changed %v, want %v", i, got, c.changed)
+		}
+	}
+}
+
+func TestRestoreDiff(t *testing.T) {
+	localDir := t.TempDir()
+	keep := path.Join(localDir, "keep.txt")
+	os.WriteFile(keep, []byte("hello"), 0644)
+	broken := path.Join(localDir, "broken.txt")
+	os.WriteFile(broken, []byte("hellx"), 0644)
+	extra := path.Join(localDir, "extra.txt")
+	os.WriteFile(extra, []byte("extra"), 0644)
+
+	task := &SyncTask{
+		Id:              "restore",
+		LocalFolderPath: localDir,
+		PanFolderPath:   "/pan",
+		DriveId:         "1",
+		Mode:            Download,
+		Policy:          SyncPolicyExclusive,
+		RestoreMode:     true,
+		restoreReport:   NewRestoreReport(),
+		syncFileDb:      NewSyncFileDb(path.Join(t.TempDir(), "sync.bolt")),
+	}
+	task.syncFileDb.Open()
+	defer task.syncFileDb.Close()
+	f := NewFileActionTaskManager(task)
+
+	localFiles := LocalFileList{
+		{Path: keep, FileType: "file", FileSize: 5, Sha1Hash: helloSha1},
+		// 本地数据库中记录的SHA1没有变化，还原模式需要实际计算才能发现内容被改坏
+		{Path: broken, FileType: "file", FileSize: 5, Sha1Hash: helloSha1},
+		{Path: extra, FileType: "file", FileSize: 5},
+	}
+	panFiles := PanFileList{
+		{FileId: "1", DriveId: "1", Path: "/pan/keep.txt", FileName: "keep.txt", FileType: "file", FileSize: 5, Sha1Hash: helloSha1},
+		{FileId: "2", DriveId: "1", Path: "/pan/broken.txt", FileName: "broken.txt", FileType: "file", FileSize: 5, Sha1Hash: helloSha1},
+		{FileId: "3", DriveId: "1", Path: "/pan/missing.txt", FileName: "missing.txt", FileType: "file", FileSize: 5, Sha1Hash: helloSha1},
+	}
+	f.doFileDiffRoutine(localFiles, panFiles)
+
+	// 本地多余的文件被删除，一致的文件保持不变
+	if _, e := os.Stat(extra); !os.IsNotExist(e) {
+		t.Fatal("extra local file should be deleted")
+	}
+	if data, _ := os.ReadFile(keep); string(data) != "hello" {
+		t.Fatal("unchanged file should be kept")
+	}
+
+	r := task.RestoreReport()
+	if len(r.missingFiles) != 1 || r.missingFiles[0] != path.Join(localDir, "missing.txt") {
+		t.Fatalf("missing: %v", r.missingFiles)
+	}
+	if len(r.modifiedFiles) != 1 || r.modifiedFiles[0] != broken {
+		t.Fatalf("modified: %v", r.modifiedFiles)
+	}
+	if len(r.deletedFiles) != 1 || r.deletedFiles[0] != extra {
+		t.Fatalf("deleted: %v", r.deletedFiles)
+	}
+
+	// 缺失和被改坏的文件进入下载队列
+	items, _ := task.syncFileDb.GetFileList(SyncFileStatusCreate)
+	if len(items) != 2 {
+		t.Fatalf("download queue: %d", len(items))
+	}
+
+	buf := &bytes.Buffer{}
+	r.Print(buf)
+	if !strings.Contains(buf.String(), "下载缺失文件: 1, 覆盖已修改文件: 1, 删除多余文件: 1, 失败: 0") {
+		t.Fatal(buf.String())
+	}
+}
+
+func TestRestoreReportEmpty(t *testing.T) {
+	buf := &bytes.Buffer{}
+	NewRestoreReport().Print(buf)
+	if !strings.Contains(buf.String(), "无需还原") {
+		t.Fatal(buf.String())
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/tickstep/aliyunpan-api/aliyunpan"
 	"github.com/tickstep/aliyunpan-api/aliyunpan/apierror"
 	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/localfile"
 	"github.com/tickstep/aliyunpan/internal/plugins"
 	"github.com/tickstep/aliyunpan/internal/utils"
 	"github.com/tickstep/aliyunpan/internal/waitgroup"
@@ -44,6 +45,8 @@ type (
 		Mode SyncMode `json:"mode"`
 		// Policy 备份策略
 		Policy SyncPolicy `json:"policy"`
+		// ConflictPolicy 冲突处理策略，只对双向同步模式有效
+		ConflictPolicy SyncConflictPolicy `json:"conflict"`
 		// CycleMode 循环模式，OneTime-运行一次，InfiniteLoop-无限循环模式
 		CycleModeType CycleMode `json:"-"`
 		// Priority 优先级选项
@@ -52,11 +55,18 @@ type (
 		LastSyncTime string `json:"lastSyncTime"`
 		// ScanTimeInterval 扫描文件时间间隔，单位秒
 		ScanTimeInterval int64 `json:"-"`
+		// RestoreMode 还原模式，以网盘为准把本地目录还原为和网盘一致，只对download模式有效
+		RestoreMode bool `json:"-"`
+		// Symlink 本地软链接处理策略，skip-跳过，follow-跟随，manifest-记录到清单文件，默认skip
+		Symlink localfile.SymlinkPolicy `json:"symlink,omitempty"`
+		// ExcludeHidden 不同步隐藏文件和文件夹
+		ExcludeHidden bool `json:"excludeHidden,omitempty"`
 
 		syncDbFolderPath string
 		localFileDb      LocalSyncDb
 		panFileDb        PanSyncDb
 		syncFileDb       SyncFileDb
+		snapshotDb       *SyncSnapshotDb
 
 		wg         *waitgroup.WaitGroup
 		ctx        context.Context
@@ -69,10 +79,20 @@ type (
 
 		fileActionTaskManager *FileActionTaskManager
 		resourceMutex         *sync.Mutex
-		scanLoopIsDone        bool // 本次扫描对比文件进程是否已经完成
+		scanLoopIsDone        bool          // 本次扫描对比文件进程是否已经完成
+		activity              *syncActivity // 各个进程最后活动的时间，用于健康检测
 
 		plugin      plugins.Plugin
 		pluginMutex *sync.Mutex
+
+		restoreReport *RestoreReport
+
+		// dry-run模式的差异报告以及数据库副本目录
+		dryRunReport       *DryRunReport
+		dryRunDbFolderPath string
+
+		// symlinkManifest manifest策略下扫描到的软链接清单
+		symlinkManifest *localfile.SymlinkManifest
 	}
 )
 
@@ -108,6 +128,9 @@ func (t *SyncTask) String() string {
 	}
 	if t.Mode == Download {
 		mode = "备份云盘文件（下载）"
+		if t.RestoreMode {
+			mode = "还原本地文件（以云盘为准）"
+		}
 	}
 	builder.WriteString("同步模式: " + mode + "\n")
 
@@ -128,15 +151,12 @@ func (t *SyncTask) String() string {
 	}
 
 	if t.Mode == SyncTwoWay {
-		priority := "时间优先"
-		if t.syncOption.SyncPriority == SyncPriorityLocalFirst {
-			priority = "本地文件优先"
-		} else if t.syncOption.SyncPriority == SyncPriorityPanFirst {
-			priority = "网盘文件优先"
-		} else {
-			priority = "时间优先"
+		policy = "增量同步（不删除）"
+		if t.Policy == SyncPolicyExclusive {
+			policy = "排他同步（同步删除）"
 		}
-		builder.WriteString("同步策略: " + priority + "\n")
+		builder.WriteString("同步策略: " + policy + "\n")
+		builder.WriteString("冲突处理: " + t.ConflictPolicy.String() + "\n")
 	} else {
 		builder.WriteString("同步策略: " + policy + "\n")
 	}
@@ -152,6 +172,16 @@ func (t *SyncTask) String() string {
 		driveName = "资源盘"
 	}
 	builder.WriteString("目标网盘: " + driveName + "\n")
+	symlinkStr := "跳过"
+	if t.Symlink == localfile.SymlinkFollow {
+		symlinkStr = "跟随"
+	} else if t.Symlink == localfile.SymlinkManifestPolicy {
+		symlinkStr = "记录到清单"
+	}
+	builder.WriteString("软链接: " + symlinkStr + "\n")
+	if t.ExcludeHidden {
+		builder.WriteString("隐藏文件: 不同步\n")
+	}
 	return builder.String()
 }
 
@@ -159,6 +189,9 @@ func (t *SyncTask) setupDb() error {
 	t.localFileDb = NewLocalSyncDb(t.localSyncDbFullPath())
 	t.panFileDb = NewPanSyncDb(t.panSyncDbFullPath())
 	t.syncFileDb = NewSyncFileDb(t.syncFileDbFullPath())
+	if t.Mode == SyncTwoWay {
+		t.snapshotDb = NewSyncSnapshotDb(t.snapshotDbFullPath())
+	}
 	if _, e := t.localFileDb.Open(); e != nil {
 		return e
 	}
@@ -193,21 +226,32 @@ func (t *SyncTask) Start() error {
 		}
 	}
 
-	// check root dir & init
-	if b, e := utils.PathExists(t.LocalFolderPath); e == nil {
-		if !b {
-			// create local root folder
-			os.MkdirAll(t.LocalFolderPath, 0755)
+	if t.syncOption.DryRun {
+		// dry-run模式不创建目录，使用同步数据库的副本
+		if e := t.setupDryRunDb(); e != nil {
+			return e
 		}
-	}
-	if _, er := t.panClient.OpenapiPanClient().FileInfoByPath(t.DriveId, t.PanFolderPath); er != nil {
-		if er.Code == apierror.ApiCodeFileNotFoundCode {
-			t.panClient.OpenapiPanClient().MkdirByFullPath(t.DriveId, t.PanFolderPath)
+		t.dryRunReport = NewDryRunReport(t)
+	} else {
+		// check root dir & init
+		if b, e := utils.PathExists(t.LocalFolderPath); e == nil {
+			if !b {
+				// create local root folder
+				os.MkdirAll(t.LocalFolderPath, 0755)
+			}
+		}
+		if _, er := t.panClient.OpenapiPanClient().FileInfoByPath(t.DriveId, t.PanFolderPath); er != nil {
+			if er.Code == apierror.ApiCodeFileNotFoundCode {
+				t.panClient.OpenapiPanClient().MkdirByFullPath(t.DriveId, t.PanFolderPath)
+			}
 		}
 	}
 
 	// setup sync db file
 	t.setupDb()
+	if t.activity == nil {
+		t.activity = &syncActivity{}
+	}
 	if t.fileActionTaskManager == nil {
 		t.fileActionTaskManager = NewFileActionTaskManager(t)
 	}
@@ -217,11 +261,14 @@ func (t *SyncTask) Start() error {
 
 	if t.plugin == nil {
 		pluginManger := plugins.NewPluginManager(config.GetPluginDir())
-		t.plugin, _ = pluginManger.GetPlugin()
+		t.plugin, _ = pluginManger.GetReloadablePlugin()
 	}
 	if t.pluginMutex == nil {
 		t.pluginMutex = &sync.Mutex{}
 	}
+	if t.symlinkManifest == nil {
+		t.symlinkManifest = localfile.NewSymlinkManifest()
+	}
 
 	t.wg = waitgroup.NewWaitGroup(0)
 
@@ -239,12 +286,20 @@ func (t *SyncTask) Start() error {
 		t.Policy = SyncPolicyIncrement
 	}
 
+	// 还原报告
+	if t.RestoreMode && t.restoreReport == nil {
+		t.restoreReport = NewRestoreReport()
+	}
+
 	// 启动文件扫描进程
 	t.SetScanLoopFlag(false)
 	if t.Mode == Upload {
 		go t.scanLocalFile(t.ctx)
 	} else if t.Mode == Download {
 		go t.scanPanFile(t.ctx)
+	} else if t.Mode == SyncTwoWay {
+		// 双向同步以本地目录为扫描对象，云盘独有的文件夹会在本地创建后继续扫描
+		go t.scanLocalFile(t.ctx)
 	} else {
 		return fmt.Errorf("异常：暂不支持该模式。")
 	}
@@ -289,6 +344,11 @@ func (t *SyncTask) Stop() error {
 		t.syncFileDb.Close()
 	}
 
+	if t.dryRunReport != nil {
+		t.cleanDryRunDb()
+		return nil
+	}
+
 	// record the sync time
 	t.LastSyncTime = utils.NowTimeStr()
 	return nil
@@ -308,6 +368,24 @@ func (t *SyncTask) SetScanLoopFlag(done bool) {
 	t.scanLoopIsDone = done
 }
 
+// heartbeat 记录扫描进程活动时间
+func (t *SyncTask) heartbeat() {
+	t.activity.touchScan()
+}
+
+// IsActive 任务是否在 timeout 时间内有活动，用于检测任务是否卡死。
+// 扫描进程、文件执行进程需要定期活动，正在传输文件时需要有数据传输
+func (t *SyncTask) IsActive(timeout time.Duration) bool {
+	if t.activity == nil {
+		// 任务还没有启动
+		return true
+	}
+	// 只运行一次的任务扫描完成后扫描进程就退出了
+	scanning := !(t.IsScanLoopDone() && t.CycleModeType == CycleOneTime)
+	executing := t.fileActionTaskManager != nil && !t.fileActionTaskManager.IsExecuteLoopIsDone()
+	return t.activity.isActive(timeout, scanning, executing)
+}
+
 // IsTaskCompletely 任务是否已经完成
 func (t *SyncTask) IsTaskCompletely() bool {
 	// 扫描完成+执行完成+一次运行模式
@@ -341,6 +419,15 @@ func (t *SyncTask) syncFileDbFullPath() string {
 	return path.Join(dir, "sync.bolt")
 }
 
+// snapshotDbFullPath 双向同步快照数据库
+func (t *SyncTask) snapshotDbFullPath() string {
+	dir := path.Join(t.syncDbFolderPath, t.Id)
+	if b, _ := utils.PathExists(dir); !b {
+		os.MkdirAll(dir, 0755)
+	}
+	return path.Join(dir, "snapshot.bolt")
+}
+
 func newLocalFileItem(file os.FileInfo, fullPath string) *LocalFileItem {
 	ft := "file"
 	if file.IsDir() {
@@ -421,7 +508,25 @@ func (t *SyncTask) scanLocalFile(ctx context.Context) {
 	type folderItem struct {
 		fileInfo os.FileInfo
 		path     string
+		// incremental 增量扫描，只扫描文件夹本身，子文件夹只有新增的才需要继续扫描
+		incremental bool
+	}
+
+	// 监听本地文件变更，两次全量扫描之间只扫描发生变化的文件夹
+	var watcher *localWatcher
+	if t.syncOption.LocalWatch && t.CycleModeType == CycleInfiniteLoop {
+		if w, e := newLocalWatcher(); e != nil {
+			PromptPrintln("本地文件变更监听启动失败，使用定时全量扫描: " + e.Error())
+		} else {
+			watcher = w
+			defer watcher.Close()
+		}
 	}
+	fullScanInterval := t.syncOption.LocalFullScanIntervalSec
+	if fullScanInterval <= 0 {
+		fullScanInterval = TimeSecondsOf30Minute
+	}
+	lastFullScanTime := time.Now().Unix()
 
 	// init the root folders info
 	pathParts := strings.Split(strings.ReplaceAll(t.LocalFolderPath, "\\", "/"), "/")
@@ -448,6 +553,8 @@ func (t *SyncTask) scanLocalFile(ctx context.Context) {
 	folderQueue := collection.NewFifoQueue()
 	rootFolder, err := os.Stat(t.LocalFolderPath)
 	if err != nil {
+		// 本地目录不存在，没有文件需要扫描
+		t.SetScanLoopFlag(true)
 		return
 	}
 	folderQueue.Push(&folderItem{
@@ -455,6 +562,7 @@ func (t *SyncTask) scanLocalFile(ctx context.Context) {
 		path:     t.LocalFolderPath,
 	})
 	delayTimeCount := int64(0)
+	scanStartedAt := ""
 
 	for {
 		select {
@@ -463,28 +571,63 @@ func (t *SyncTask) scanLocalFile(ctx context.Context) {
 			logger.Verboseln("local file routine done, exit loop")
 			return
 		default:
+			t.heartbeat()
 			// 采用广度优先遍历(BFS)进行文件遍历
 			if delayTimeCount > 0 {
-				time.Sleep(1 * time.Second)
-				delayTimeCount -= 1
-				continue
-			} else if delayTimeCount == 0 {
+				if watcher == nil || !watcher.HasChanges() {
+					time.Sleep(1 * time.Second)
+					delayTimeCount -= 1
+					continue
+				}
+				// 监听到本地文件变更，立即开始扫描
+				delayTimeCount = 0
+			}
+			if delayTimeCount == 0 {
 				// 确认文件执行进程是否已完成
 				if !t.fileActionTaskManager.IsExecuteLoopIsDone() {
 					time.Sleep(1 * time.Second)
 					continue // 需要等待文件上传进程完成才能开启新一轮扫描
 				}
+				if watcher != nil && folderQueue.Length() == 0 {
+					dirs, overflow := watcher.Drain()
+					if overflow || time.Now().Unix()-lastFullScanTime >= fullScanInterval {
+						// 有变更丢失或者到达全量扫描时间，进行一次全量扫描
+						lastFullScanTime = time.Now().Unix()
+						folderQueue.Push(&folderItem{
+							fileInfo: rootFolder,
+							path:     t.LocalFolderPath,
+						})
+					} else {
+						for _, dir := range dirs {
+							if fi, e := os.Stat(dir); e == nil && fi.IsDir() {
+								folderQueue.Push(&folderItem{
+									fileInfo:    fi,
+									path:        dir,
+									incremental: true,
+								})
+							}
+						}
+					}
+					if folderQueue.Length() == 0 {
+						// 没有文件变更，继续等待
+						delayTimeCount = t.ScanTimeInterval
+						continue
+					}
+				}
 				delayTimeCount -= 1
 				logger.Verboseln("start scan local file process at ", utils.NowTimeStr())
 				t.SetScanLoopFlag(false)
 				t.fileActionTaskManager.StartFileActionTaskExecutor()
 				PromptPrintln("开始进行文件扫描...")
+				scanStartedAt = utils.NowTimeStr()
+				t.doScanStartPluginCallback("local", scanStartedAt)
 			}
 
 			obj := folderQueue.Pop()
 			if obj == nil {
 				// 没有其他文件夹需要扫描了，已完成了一次全量文件夹的扫描了
 				t.SetScanLoopFlag(true)
+				t.doScanFinishPluginCallback("local", scanStartedAt)
 
 				if t.CycleModeType == CycleOneTime {
 					// 只运行一次，全盘扫描一次后退出任务循环
@@ -492,30 +635,46 @@ func (t *SyncTask) scanLocalFile(ctx context.Context) {
 					return
 				}
 
-				// 无限循环模式，继续下一次扫描
-				folderQueue.Push(&folderItem{
-					fileInfo: rootFolder,
-					path:     t.LocalFolderPath,
-				})
+				// 无限循环模式，继续下一次扫描。监听模式下在下一轮开始时根据文件变更决定扫描的文件夹
+				if watcher == nil {
+					folderQueue.Push(&folderItem{
+						fileInfo: rootFolder,
+						path:     t.LocalFolderPath,
+					})
+				}
 				delayTimeCount = t.ScanTimeInterval
 				continue
 			}
 			item := obj.(*folderItem)
+			if watcher != nil {
+				if e := watcher.AddDir(item.path); e != nil {
+					logger.Verboseln("watch local folder error: ", item.path, e)
+				}
+			}
 			files, err1 := ioutil.ReadDir(item.path)
 			if err1 != nil {
 				continue
 			}
-			if len(files) == 0 {
+			if len(files) == 0 && t.Mode != SyncTwoWay {
+				// 双向同步模式下本地空文件夹仍然需要对比云盘，下载云盘的文件
 				continue
 			}
 			localFileScanList := LocalFileList{}
 			localFileAppendList := LocalFileList{}
+			skippedLocalNames := map[string]bool{}
 			for _, file := range files { // 逐个确认目录下面的每个文件的情况
 				if strings.HasSuffix(file.Name(), DownloadingFileSuffix) {
 					// 下载中的文件，跳过
 					continue
 				}
 
+				// 隐藏文件、软链接、特殊文件
+				fileName := file.Name()
+				if file = t.filterLocalFile(file, item.path+"/"+fileName); file == nil {
+					skippedLocalNames[fileName] = true
+					continue
+				}
+
 				// 检查JS插件
 				localFile := newLocalFileItem(file, item.path+"/"+file.Name())
 				if t.skipLocalFile(localFile) {
@@ -523,30 +682,25 @@ func (t *SyncTask) scanLocalFile(ctx context.Context) {
 					continue
 				}
 
-				// 跳过软链接文件
-				if IsSymlinkFile(file) {
-					logger.Verboseln("软链接文件，跳过：" + item.path + "/" + file.Name())
-					continue
-				}
-
 				PromptPrintln("扫描到本地文件：" + item.path + "/" + file.Name())
-				// 文件夹需要增加到扫描队列
-				if file.IsDir() {
+
+				// 查询本地扫描数据库
+				localFileInDb, _ := t.localFileDb.Get(localFile.Path)
+
+				// 文件夹需要增加到扫描队列，增量扫描时只有新增的文件夹需要扫描
+				if file.IsDir() && (!item.incremental || localFileInDb == nil) {
 					folderQueue.Push(&folderItem{
 						fileInfo: file,
 						path:     item.path + "/" + file.Name(),
 					})
 				}
-
-				// 查询本地扫描数据库
-				localFileInDb, _ := t.localFileDb.Get(localFile.Path)
 				if localFileInDb == nil {
 					// 记录不存在，直接增加到本地数据库队列
 					localFileAppendList = append(localFileAppendList, localFile)
 				} else {
 					// 记录存在，查看文件SHA1是否更改
-					if localFile.UpdateTimeUnix() == localFileInDb.UpdateTimeUnix() && localFile.FileSize == localFileInDb.FileSize {
-						// 文件大小没变，文件修改时间没变，假定文件内容也没变
+					if localfile.ModTimeEqual(localFile.UpdateTimeUnix(), localFileInDb.UpdateTimeUnix(), t.syncOption.ModTimeTolerance) && localFile.FileSize == localFileInDb.FileSize {
+						// 文件大小没变，文件修改时间没变(在容差范围内)，假定文件内容也没变
 						localFile.Sha1Hash = localFileInDb.Sha1Hash
 					} else {
 						// 文件已修改，更新文件信息到扫描数据库
@@ -573,28 +727,52 @@ func (t *SyncTask) scanLocalFile(ctx context.Context) {
 			}
 
 			// 获取云盘对应目录下的文件清单
+			var panFileList aliyunpan.FileList
 			panFileInfo, er := t.panClient.OpenapiPanClient().FileInfoByPath(t.DriveId, GetPanFileFullPathFromLocalPath(item.path, t.LocalFolderPath, t.PanFolderPath))
 			if er != nil {
 				logger.Verboseln("query pan file info error: ", er)
-				// do nothing
-				continue
-			}
-			panFileList, er2 := t.panClient.OpenapiPanClient().FileListGetAll(&aliyunpan.FileListParam{
-				DriveId:      t.DriveId,
-				ParentFileId: panFileInfo.FileId,
-			}, 1500) // 延迟时间避免触发风控
-			if er2 != nil {
-				logger.Verboseln("query pan file list error: ", er)
-				continue
+				if t.dryRunReport == nil || er.Code != apierror.ApiCodeFileNotFoundCode {
+					// do nothing
+					continue
+				}
+				// dry-run模式不会创建云盘文件夹，按空文件夹对比
+			} else {
+				var er2 *apierror.ApiError
+				panFileList, er2 = t.panClient.OpenapiPanClient().FileListGetAll(&aliyunpan.FileListParam{
+					DriveId:      t.DriveId,
+					ParentFileId: panFileInfo.FileId,
+				}, 1500) // 延迟时间避免触发风控
+				if er2 != nil {
+					logger.Verboseln("query pan file list error: ", er)
+					continue
+				}
 			}
 			panFileScanList := PanFileList{}
 			for _, pf := range panFileList {
+				if t.skipPanFileByLocal(pf.FileName, skippedLocalNames) {
+					continue
+				}
 				pf.Path = path.Join(GetPanFileFullPathFromLocalPath(item.path, t.LocalFolderPath, t.PanFolderPath), pf.FileName)
 				panFileScanList = append(panFileScanList, NewPanFileItem(pf))
 			}
 
 			// 对比文件
 			t.fileActionTaskManager.doFileDiffRoutine(localFileScanList, panFileScanList)
+
+			if t.Mode == SyncTwoWay {
+				// 云盘独有的文件夹已经在本地创建，加入扫描队列
+				for _, pf := range panFileScanList {
+					if !pf.IsFolder() || localFileScanList.FindFileByPath(item.path+"/"+pf.FileName) != nil {
+						continue
+					}
+					if fi, e := os.Stat(item.path + "/" + pf.FileName); e == nil && fi.IsDir() {
+						folderQueue.Push(&folderItem{
+							fileInfo: fi,
+							path:     item.path + "/" + pf.FileName,
+						})
+					}
+				}
+			}
 		}
 	}
 }
@@ -669,6 +847,8 @@ func (t *SyncTask) scanPanFile(ctx context.Context) {
 	}
 	fi, err := t.panClient.OpenapiPanClient().FileInfoByPath(t.DriveId, fullPath)
 	if err != nil {
+		// 云盘目录不存在，没有文件需要扫描
+		t.SetScanLoopFlag(true)
 		return
 	}
 	pFile := NewPanFileItem(fi)
@@ -680,6 +860,7 @@ func (t *SyncTask) scanPanFile(ctx context.Context) {
 	rootPanFile := fi
 	folderQueue.Push(rootPanFile)
 	delayTimeCount := int64(0)
+	scanStartedAt := ""
 
 	for {
 		select {
@@ -688,6 +869,7 @@ func (t *SyncTask) scanPanFile(ctx context.Context) {
 			logger.Verboseln("pan file routine done")
 			return
 		default:
+			t.heartbeat()
 			// 采用广度优先遍历(BFS)进行文件遍历
 			if delayTimeCount > 0 {
 				time.Sleep(1 * time.Second)
@@ -704,11 +886,14 @@ func (t *SyncTask) scanPanFile(ctx context.Context) {
 				t.SetScanLoopFlag(false)
 				t.fileActionTaskManager.StartFileActionTaskExecutor()
 				PromptPrintln("开始进行文件扫描...")
+				scanStartedAt = utils.NowTimeStr()
+				t.doScanStartPluginCallback("pan", scanStartedAt)
 			}
 			obj := folderQueue.Pop()
 			if obj == nil {
 				// 没有其他文件夹需要扫描了，已完成了一次全量文件夹的扫描了
 				t.SetScanLoopFlag(true)
+				t.doScanFinishPluginCallback("pan", scanStartedAt)
 
 				if t.CycleModeType == CycleOneTime {
 					// 只运行一次，全盘扫描一次后退出任务循环
@@ -734,6 +919,9 @@ func (t *SyncTask) scanPanFile(ctx context.Context) {
 			}
 			panFileScanList := PanFileList{}
 			for _, file := range files {
+				if t.ExcludeHidden && localfile.IsHiddenFile(file.FileName) {
+					continue
+				}
 				file.Path = path.Join(item.Path, file.FileName)
 				panFile := NewPanFileItem(file)
 
@@ -759,17 +947,30 @@ func (t *SyncTask) scanPanFile(ctx context.Context) {
 
 			// 获取本地对应目录下的文件清单
 			localFolderPath := GetLocalFileFullPathFromPanPath(item.Path, t.LocalFolderPath, t.PanFolderPath)
+			if t.Symlink != localfile.SymlinkFollow && localFolderPath != t.LocalFolderPath && localfile.IsSymlink(localFolderPath) {
+				// 本地对应的文件夹是不跟随的软链接，不对比也不下载到链接指向的目录
+				continue
+			}
 			localFiles, err2 := ioutil.ReadDir(localFolderPath)
 			if err2 != nil {
 				logger.Verboseln("query local file list error: ", err2)
-				continue
+				if t.dryRunReport == nil || !os.IsNotExist(err2) {
+					continue
+				}
+				// dry-run模式不会创建本地文件夹，按空文件夹对比
 			}
 			localFileScanList := LocalFileList{}
+			skippedLocalNames := map[string]bool{}
 			for _, file := range localFiles { // 逐个确认目录下面的每个文件的情况
 				if strings.HasSuffix(file.Name(), DownloadingFileSuffix) {
 					// 下载中的文件，跳过
 					continue
 				}
+				fileName := file.Name()
+				if file = t.filterLocalFile(file, localFolderPath+"/"+fileName); file == nil {
+					skippedLocalNames[fileName] = true
+					continue
+				}
 				localFile := newLocalFileItem(file, localFolderPath+"/"+file.Name())
 				logger.Verboseln("扫描到本地文件：" + localFile.Path)
 
@@ -777,8 +978,8 @@ func (t *SyncTask) scanPanFile(ctx context.Context) {
 				localFileInDb, _ := t.localFileDb.Get(localFile.Path)
 				if localFileInDb != nil {
 					// 记录存在，查看文件SHA1是否更改
-					if localFile.UpdateTimeUnix() == localFileInDb.UpdateTimeUnix() && localFile.FileSize == localFileInDb.FileSize {
-						// 文件大小没变，文件修改时间没变，假定文件内容也没变
+					if localfile.ModTimeEqual(localFile.UpdateTimeUnix(), localFileInDb.UpdateTimeUnix(), t.syncOption.ModTimeTolerance) && localFile.FileSize == localFileInDb.FileSize {
+						// 文件大小没变，文件修改时间没变(在容差范围内)，假定文件内容也没变
 						localFile.Sha1Hash = localFileInDb.Sha1Hash
 					} else {
 						// 文件已修改，更新文件信息到扫描数据库
@@ -797,6 +998,15 @@ func (t *SyncTask) scanPanFile(ctx context.Context) {
 				}
 				localFileScanList = append(localFileScanList, localFile)
 			}
+			if len(skippedLocalNames) > 0 {
+				filteredPanFileList := PanFileList{}
+				for _, pf := range panFileScanList {
+					if !skippedLocalNames[pf.FileName] {
+						filteredPanFileList = append(filteredPanFileList, pf)
+					}
+				}
+				panFileScanList = filteredPanFileList
+			}
 
 			// 对比文件
 			t.fileActionTaskManager.doFileDiffRoutine(localFileScanList, panFileScanList)
@@ -824,3 +1034,45 @@ func (t *SyncTask) doAllFileSyncPluginCallback() {
 		logger.Verboseln("成功调用同步任务完成插件回调方法：" + t.Id)
 	}
 }
+
+// doScanStartPluginCallback 开始一轮文件扫描回调方法，scanTarget为local-本地文件，pan-云盘文件
+func (t *SyncTask) doScanStartPluginCallback(scanTarget, startedAt string) {
+	pluginParam := &plugins.SyncScanStartParams{
+		Name:            t.Name,
+		Id:              t.Id,
+		DriveId:         t.DriveId,
+		LocalFolderPath: t.LocalFolderPath,
+		PanFolderPath:   t.PanFolderPath,
+		Mode:            string(t.Mode),
+		ScanTarget:      scanTarget,
+		StartedAt:       startedAt,
+	}
+	t.pluginMutex.Lock()
+	defer t.pluginMutex.Unlock()
+	if er := t.plugin.SyncScanStartCallback(plugins.GetContext(t.panUser), pluginParam); er == nil {
+		logger.Verboseln("成功调用开始扫描插件回调方法：" + t.Id)
+	}
+}
+
+// doScanFinishPluginCallback 完成一轮文件扫描回调方法，没有开始扫描时不回调
+func (t *SyncTask) doScanFinishPluginCallback(scanTarget, startedAt string) {
+	if startedAt == "" {
+		return
+	}
+	pluginParam := &plugins.SyncScanFinishParams{
+		Name:            t.Name,
+		Id:              t.Id,
+		DriveId:         t.DriveId,
+		LocalFolderPath: t.LocalFolderPath,
+		PanFolderPath:   t.PanFolderPath,
+		Mode:            string(t.Mode),
+		ScanTarget:      scanTarget,
+		StartedAt:       startedAt,
+		FinishedAt:      utils.NowTimeStr(),
+	}
+	t.pluginMutex.Lock()
+	defer t.pluginMutex.Unlock()
+	if er := t.plugin.SyncScanFinishCallback(plugins.GetContext(t.panUser), pluginParam); er == nil {
+		logger.Verboseln("成功调用完成扫描插件回调方法：" + t.Id)
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/localfile"
 	"github.com/tickstep/aliyunpan/internal/log"
+	"github.com/tickstep/aliyunpan/internal/notify"
 	"github.com/tickstep/aliyunpan/internal/utils"
 	"github.com/tickstep/library-go/logger"
 	"io/ioutil"
@@ -23,6 +25,8 @@ type (
 
 		MaxDownloadRate int64 // 限制最大下载速度
 		MaxUploadRate   int64 // 限制最大上传速度
+		// UploadRateFunc 按时间段动态限制上传速度，返回指定时间的限速值，0代表不限制。不为nil时忽略MaxUploadRate
+		UploadRateFunc func(t time.Time) int64
 
 		// 优先级选项
 		SyncPriority SyncPriorityOption
@@ -30,8 +34,24 @@ type (
 		// 本地文件修改检测间隔
 		LocalFileModifiedCheckIntervalSec int
 
+		// 实时监听本地文件变更，只扫描发生变化的文件夹。只对upload和双向同步模式有效
+		LocalWatch bool
+		// 监听模式下全量扫描间隔，单位秒，用于兜底保证本地和云盘文件一致
+		LocalFullScanIntervalSec int64
+
 		// 文件记录器
 		FileRecorder *log.FileRecorder
+
+		// DryRun 只对比文件并生成差异报告，不实际上传、下载或删除文件
+		DryRun bool
+
+		// ModTimeTolerance 本地文件修改时间对比的容差，单位秒，相差不超过该值视为没有修改
+		ModTimeTolerance int64
+
+		// NotifyDigest 每日汇总，每次扫描-执行循环的结果作为一个批次记录，为nil代表不记录
+		NotifyDigest *notify.Digest
+		// Webhook 任务事件通知，每次扫描-执行循环有文件传输时推送sync.finish事件，为nil代表不推送
+		Webhook *notify.Webhook
 	}
 
 	// SyncTaskManager 同步任务管理器
@@ -111,6 +131,26 @@ func (m *SyncTaskManager) parseConfigFile() error {
 	return nil
 }
 
+// userSyncDbFolderPath 同步数据库所在目录，位于账号数据目录下：<数据目录>/users/<uid>/sync_drive
+func (m *SyncTaskManager) userSyncDbFolderPath() string {
+	if m.PanUser == nil || m.PanUser.UserId == "" {
+		return m.SyncConfigFolderPath
+	}
+	return path.Join(config.GetUserDataDir(m.PanUser.UserId), "sync_drive")
+}
+
+// migrateSyncTaskDb 旧版本的同步数据库保存在各账号共用的同步目录下，迁移到任务所属账号的数据目录。
+// 账号目录下已经存在该任务的数据库时不迁移
+func migrateSyncTaskDb(legacyFolderPath, dbFolderPath, taskId string) error {
+	if path.Clean(legacyFolderPath) == path.Clean(dbFolderPath) {
+		return nil
+	}
+	if b, _ := utils.PathExists(path.Join(dbFolderPath, taskId)); b {
+		return nil
+	}
+	return config.MoveDirEntries(legacyFolderPath, dbFolderPath, []string{taskId})
+}
+
 func (m *SyncTaskManager) ConfigFilePath() string {
 	return path.Join(m.SyncConfigFolderPath, "sync_drive_config.json")
 }
@@ -176,7 +216,11 @@ func (m *SyncTaskManager) Start(tasks []*SyncTask, cycleMode CycleMode, scanTime
 			continue
 		}
 		task.panUser = m.PanUser
-		task.syncDbFolderPath = m.SyncConfigFolderPath
+		// 同步数据库（云盘目录缓存、双向同步快照等）按账号分目录存放
+		task.syncDbFolderPath = m.userSyncDbFolderPath()
+		if er := migrateSyncTaskDb(m.SyncConfigFolderPath, task.syncDbFolderPath, task.Id); er != nil {
+			logger.Verbosef("迁移同步数据库出错: %s, %s\n", task.NameLabel(), er)
+		}
 		task.panClient = m.PanClient
 		task.syncOption = m.syncOption
 		if task.Priority != "" {
@@ -188,6 +232,23 @@ func (m *SyncTaskManager) Start(tasks []*SyncTask, cycleMode CycleMode, scanTime
 		if task.Policy == "" {
 			task.Policy = SyncPolicyIncrement
 		}
+		if task.Mode == SyncBidirectional {
+			task.Mode = SyncTwoWay
+		}
+		if task.Mode == SyncTwoWay {
+			conflictPolicy, e := ParseSyncConflictPolicy(string(task.ConflictPolicy))
+			if e != nil {
+				fmt.Printf("任务启动失败，%s\n", e)
+				continue
+			}
+			task.ConflictPolicy = conflictPolicy
+		}
+		symlinkPolicy, e := localfile.ParseSymlinkPolicy(string(task.Symlink), localfile.SymlinkSkip)
+		if e != nil {
+			fmt.Printf("任务启动失败，%s\n", e)
+			continue
+		}
+		task.Symlink = symlinkPolicy
 		task.LocalFolderPath = path.Clean(task.LocalFolderPath)
 		task.PanFolderPath = path.Clean(task.PanFolderPath)
 		if e := task.Start(); e != nil {
@@ -200,7 +261,7 @@ func (m *SyncTaskManager) Start(tasks []*SyncTask, cycleMode CycleMode, scanTime
 		time.Sleep(200 * time.Millisecond)
 	}
 	// save config file
-	if m.useConfigFile {
+	if m.useConfigFile && !m.syncOption.DryRun {
 		ioutil.WriteFile(m.ConfigFilePath(), []byte(utils.ObjectToJsonStr(m.syncDriveConfig, true)), 0755)
 	}
 	return true, nil
@@ -221,12 +282,23 @@ func (m *SyncTaskManager) Stop() (bool, error) {
 	}
 
 	// save config file
-	if m.useConfigFile {
+	if m.useConfigFile && !m.syncOption.DryRun {
 		ioutil.WriteFile(m.ConfigFilePath(), []byte(utils.ObjectToJsonStr(m.syncDriveConfig, true)), 0755)
 	}
 	return true, nil
 }
 
+// DryRunReports 获取所有任务的差异报告，只对dry-run模式有效
+func (m *SyncTaskManager) DryRunReports() []*DryRunReport {
+	reports := []*DryRunReport{}
+	for _, task := range m.syncDriveConfig.SyncTaskList {
+		if report := task.DryRunReport(); report != nil {
+			reports = append(reports, report)
+		}
+	}
+	return reports
+}
+
 func (m *SyncTaskManager) IsAllTaskCompletely() bool {
 	for _, task := range m.syncDriveConfig.SyncTaskList {
 		if !task.IsTaskCompletely() {
@@ -236,6 +308,17 @@ func (m *SyncTaskManager) IsAllTaskCompletely() bool {
 	return true
 }
 
+// IsAllTaskActive 所有任务是否都在 timeout 时间内有活动，正在传输文件的任务需要有数据传输
+func (m *SyncTaskManager) IsAllTaskActive(timeout time.Duration) bool {
+	for _, task := range m.syncDriveConfig.SyncTaskList {
+		if !task.IsActive(timeout) {
+			logger.Verboseln("sync task is not active: ", task.NameLabel())
+			return false
+		}
+	}
+	return true
+}
+
 // DoTaskSyncCompletelyPluginCallback 调用任务同步完成的回调函数
 func (m *SyncTaskManager) DoTaskSyncCompletelyPluginCallback() {
 	for _, task := range m.syncDriveConfig.SyncTaskList {
@@ -0,0 +1,39 @@
+package syncdrive
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+func TestMigrateSyncTaskDb(t *testing.T) {
+	legacy := t.TempDir()
+	userDir := path.Join(t.TempDir(), "users", "u1", "sync_drive")
+	os.MkdirAll(path.Join(legacy, "task1"), 0755)
+	os.WriteFile(path.Join(legacy, "task1", "snapshot.bolt"), []byte("snapshot"), 0644)
+	os.MkdirAll(path.Join(legacy, "task2"), 0755)
+
+	if err := migrateSyncTaskDb(legacy, userDir, "task1"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path.Join(userDir, "task1", "snapshot.bolt"))
+	if err != nil || string(data) != "snapshot" {
+		t.Fatalf("snapshot not migrated: %s, %v", data, err)
+	}
+	if _, err := os.Stat(path.Join(legacy, "task1")); !os.IsNotExist(err) {
+		t.Fatal("legacy task db should be moved")
+	}
+	// 其他账号的任务不迁移
+	if _, err := os.Stat(path.Join(legacy, "task2")); err != nil {
+		t.Fatal("other task db should stay")
+	}
+
+	// 账号目录下已经存在数据库时保留旧数据不覆盖
+	os.MkdirAll(path.Join(legacy, "task1"), 0755)
+	if err := migrateSyncTaskDb(legacy, userDir, "task1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path.Join(legacy, "task1")); err != nil {
+		t.Fatal("legacy db should be kept when user db exists")
+	}
+}
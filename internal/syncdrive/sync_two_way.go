@@ -0,0 +1,473 @@
+package syncdrive
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan/internal/localfile"
+	"github.com/tickstep/library-go/logger"
+)
+
+type (
+	// SyncConflictPolicy 双向同步冲突处理策略，本地和云盘文件在上一次同步之后都被修改时使用
+	SyncConflictPolicy string
+
+	// SyncSnapshotItem 文件上一次同步完成时本地和云盘的状态，用于判断文件是在哪一端发生了变化
+	SyncSnapshotItem struct {
+		// RelativePath 文件相对同步目录的路径
+		RelativePath string `json:"relativePath"`
+		// IsFolder 是否是文件夹
+		IsFolder bool `json:"isFolder"`
+		// LocalUpdatedAt 本地文件修改时间
+		LocalUpdatedAt int64 `json:"localUpdatedAt"`
+		// LocalFileSize 本地文件大小
+		LocalFileSize int64 `json:"localFileSize"`
+		// PanSha1Hash 云盘文件SHA1
+		PanSha1Hash string `json:"panSha1Hash"`
+		// SyncTimeAt 同步时间
+		SyncTimeAt string `json:"syncTimeAt"`
+	}
+
+	// SyncSnapshotDb 双向同步快照数据库
+	SyncSnapshotDb struct {
+		Path   string
+		db     *BoltDb
+		locker *sync.Mutex
+	}
+)
+
+const (
+	// SyncBidirectional 双向同步模式的别名，等同于 SyncTwoWay
+	SyncBidirectional SyncMode = "bidirectional"
+
+	// SyncConflictNewest 冲突时修改时间较新的文件优先
+	SyncConflictNewest SyncConflictPolicy = "newest"
+	// SyncConflictLocal 冲突时本地文件优先
+	SyncConflictLocal SyncConflictPolicy = "local"
+	// SyncConflictCloud 冲突时云盘文件优先
+	SyncConflictCloud SyncConflictPolicy = "cloud"
+	// SyncConflictKeepBoth 冲突时两者都保留，本地文件重命名后上传，云盘文件下载到原路径
+	SyncConflictKeepBoth SyncConflictPolicy = "keep-both"
+)
+
+// ParseSyncConflictPolicy 解析冲突处理策略，不支持的策略返回错误
+func ParseSyncConflictPolicy(s string) (SyncConflictPolicy, error) {
+	switch p := SyncConflictPolicy(strings.ToLower(strings.TrimSpace(s))); p {
+	case "":
+		return SyncConflictNewest, nil
+	case SyncConflictNewest, SyncConflictLocal, SyncConflictCloud, SyncConflictKeepBoth:
+		return p, nil
+	}
+	return "", fmt.Errorf("不支持的冲突处理策略: %s", s)
+}
+
+func (p SyncConflictPolicy) String() string {
+	switch p {
+	case SyncConflictLocal:
+		return "本地文件优先"
+	case SyncConflictCloud:
+		return "云盘文件优先"
+	case SyncConflictKeepBoth:
+		return "两者都保留"
+	}
+	return "最新文件优先"
+}
+
+func NewSyncSnapshotDb(dbFilePath string) *SyncSnapshotDb {
+	return &SyncSnapshotDb{
+		Path:   dbFilePath,
+		locker: &sync.Mutex{},
+	}
+}
+
+// Get 获取文件的同步快照，不存在返回nil
+func (s *SyncSnapshotDb) Get(relativePath string) *SyncSnapshotItem {
+	if s == nil {
+		return nil
+	}
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	s.db = NewBoltDb(s.Path)
+	s.db.Open()
+	defer s.db.Close()
+
+	data, err := s.db.Get("/" + relativePath)
+	if err != nil || data == "" {
+		return nil
+	}
+	item := &SyncSnapshotItem{}
+	if e := json.Unmarshal([]byte(data), item); e != nil {
+		logger.Verboseln("parse sync snapshot error: ", e)
+		return nil
+	}
+	return item
+}
+
+// Put 保存文件的同步快照
+func (s *SyncSnapshotDb) Put(item *SyncSnapshotItem) error {
+	if s == nil {
+		return nil
+	}
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	s.db = NewBoltDb(s.Path)
+	s.db.Open()
+	defer s.db.Close()
+
+	item.SyncTimeAt = time.Now().Format("2006-01-02 15:04:05")
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Add(&BoltItem{
+		FilePath: "/" + item.RelativePath,
+		IsFolder: item.IsFolder,
+		Data:     string(data),
+	})
+	return err
+}
+
+// Delete 删除文件的同步快照，文件夹会同时删除文件夹下所有文件的快照
+func (s *SyncSnapshotDb) Delete(relativePath string) {
+	if s == nil {
+		return
+	}
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	s.db = NewBoltDb(s.Path)
+	s.db.Open()
+	defer s.db.Close()
+	s.db.Delete("/" + relativePath)
+}
+
+// localChanged 本地文件在上一次同步之后是否被修改，修改时间相差不超过tolerance秒视为没有修改
+func (item *SyncSnapshotItem) localChanged(localFile *LocalFileItem, tolerance int64) bool {
+	return !localfile.ModTimeEqual(item.LocalUpdatedAt, localFile.UpdateTimeUnix(), tolerance) || item.LocalFileSize != localFile.FileSize
+}
+
+// panChanged 云盘文件在上一次同步之后是否被修改
+func (item *SyncSnapshotItem) panChanged(panFile *PanFileItem) bool {
+	return !strings.EqualFold(item.PanSha1Hash, panFile.Sha1Hash)
+}
+
+// relativePathOfLocal 本地文件相对同步目录的路径
+func (f *FileActionTaskManager) relativePathOfLocal(localPath string) string {
+	return (&localFileSet{localFolderPath: f.task.LocalFolderPath}).getRelativePath(localPath)
+}
+
+// relativePathOfPan 云盘文件相对同步目录的路径
+func (f *FileActionTaskManager) relativePathOfPan(panPath string) string {
+	return (&panFileSet{panFolderPath: f.task.PanFolderPath}).getRelativePath(panPath)
+}
+
+// saveSnapshot 记录文件已经同步完成时的状态
+func (f *FileActionTaskManager) saveSnapshot(localFile *LocalFileItem, panFile *PanFileItem) {
+	item := &SyncSnapshotItem{
+		RelativePath: f.relativePathOfLocal(localFile.Path),
+		IsFolder:     localFile.IsFolder(),
+	}
+	if !item.IsFolder {
+		item.LocalUpdatedAt = localFile.UpdateTimeUnix()
+		item.LocalFileSize = localFile.FileSize
+		item.PanSha1Hash = panFile.Sha1Hash
+	}
+	if e := f.task.snapshotDb.Put(item); e != nil {
+		logger.Verboseln("save sync snapshot error: ", e)
+	}
+}
+
+// saveSnapshotAfterAction 上传、下载完成后记录文件的同步快照
+func (f *FileActionTaskManager) saveSnapshotAfterAction(syncItem *SyncFileItem) {
+	if f.task.Mode != SyncTwoWay {
+		return
+	}
+	localPath := syncItem.getLocalFileFullPath()
+	fi, err := os.Stat(localPath)
+	if err != nil {
+		return
+	}
+	localFile := newLocalFileItem(fi, localPath)
+	panFile := syncItem.PanFile
+	if syncItem.Action == SyncFileActionUpload {
+		fe, apierr := f.task.panClient.OpenapiPanClient().FileInfoByPath(syncItem.DriveId, syncItem.getPanFileFullPath())
+		if apierr != nil {
+			logger.Verboseln("query uploaded pan file error: ", apierr)
+			return
+		}
+		panFile = NewPanFileItem(fe)
+	}
+	if panFile == nil {
+		return
+	}
+	f.saveSnapshot(localFile, panFile)
+}
+
+// newUploadTask 创建上传任务
+func (f *FileActionTaskManager) newUploadTask(localFile *LocalFileItem) *FileActionTask {
+	return &FileActionTask{
+		syncItem: &SyncFileItem{
+			Action:            SyncFileActionUpload,
+			Status:            SyncFileStatusCreate,
+			LocalFile:         localFile,
+			PanFolderPath:     f.task.PanFolderPath,
+			LocalFolderPath:   f.task.LocalFolderPath,
+			DriveId:           f.task.DriveId,
+			DownloadBlockSize: f.syncOption.FileDownloadBlockSize,
+			UploadBlockSize:   f.syncOption.FileUploadBlockSize,
+		},
+	}
+}
+
+// newDownloadTask 创建下载任务
+func (f *FileActionTaskManager) newDownloadTask(panFile *PanFileItem) *FileActionTask {
+	return &FileActionTask{
+		syncItem: &SyncFileItem{
+			Action:            SyncFileActionDownload,
+			Status:            SyncFileStatusCreate,
+			PanFile:           panFile,
+			PanFolderPath:     f.task.PanFolderPath,
+			LocalFolderPath:   f.task.LocalFolderPath,
+			DriveId:           f.task.DriveId,
+			DownloadBlockSize: f.syncOption.FileDownloadBlockSize,
+			UploadBlockSize:   f.syncOption.FileUploadBlockSize,
+		},
+	}
+}
+
+// doTwoWayLocalOnly 只存在于本地的文件：本地新建的文件上传到云盘，云盘已删除的文件按照备份策略删除本地文件
+func (f *FileActionTaskManager) doTwoWayLocalOnly(file *LocalFileItem) {
+	rp := f.relativePathOfLocal(file.Path)
+	if f.task.Policy == SyncPolicyExclusive {
+		snapshot := f.task.snapshotDb.Get(rp)
+		changed := true
+		if snapshot != nil && snapshot.IsFolder == file.IsFolder() {
+			if file.IsFolder() {
+				changed = !f.localFolderSynced(file.Path)
+			} else {
+				changed = snapshot.localChanged(file, f.syncOption.ModTimeTolerance)
+			}
+		}
+		if oneSidedShouldDelete(f.task.Policy, snapshot != nil, changed) {
+			// 上一次同步过并且本地没有修改，说明云盘文件被删除了
+			if f.deleteLocalFile(file) == nil {
+				PromptPrintln("云盘文件已删除，成功删除本地文件：" + file.Path)
+				f.task.snapshotDb.Delete(rp)
+			}
+			return
+		}
+	}
+
+	if file.IsFolder() {
+		// 创建云盘文件夹，这样就可以同步空文件夹
+		if f.createPanFolder(file) == nil {
+			f.saveSnapshot(file, nil)
+		}
+		return
+	}
+	if fi, fe := os.Stat(file.Path); fe == nil && fi.ModTime().Unix() > file.UpdateTimeUnix() {
+		logger.Verboseln("本地文件已被修改，等下一轮扫描最新的再上传: ", file.Path)
+		return
+	}
+	f.addToSyncDb(f.newUploadTask(file))
+}
+
+// doTwoWayPanOnly 只存在于云盘的文件：云盘新建的文件下载到本地，本地已删除的文件按照备份策略删除云盘文件
+func (f *FileActionTaskManager) doTwoWayPanOnly(file *PanFileItem) {
+	rp := f.relativePathOfPan(file.Path)
+	if f.task.Policy == SyncPolicyExclusive {
+		snapshot := f.task.snapshotDb.Get(rp)
+		changed := true
+		if snapshot != nil && snapshot.IsFolder == file.IsFolder() {
+			if file.IsFolder() {
+				changed = !f.panFolderSynced(file)
+			} else {
+				changed = snapshot.panChanged(file)
+			}
+		}
+		if oneSidedShouldDelete(f.task.Policy, snapshot != nil, changed) {
+			// 上一次同步过并且云盘没有修改，说明本地文件被删除了
+			if f.deletePanFile(file) == nil {
+				PromptPrintln("本地文件已删除，成功删除云盘文件：" + file.Path)
+				f.task.snapshotDb.Delete(rp)
+			}
+			return
+		}
+	}
+
+	if file.IsFolder() {
+		// 创建本地文件夹，这样就可以同步空文件夹
+		if f.createLocalFolder(file) == nil {
+			f.task.snapshotDb.Put(&SyncSnapshotItem{RelativePath: rp, IsFolder: true})
+		}
+		return
+	}
+	f.addToSyncDb(f.newDownloadTask(file))
+}
+
+// oneSidedShouldDelete 只存在于一端的文件是否需要删除。只有排他策略下，上一次同步过并且之后没有修改的才删除；
+// 没有同步记录的是新建的文件，需要同步到另一端
+func oneSidedShouldDelete(policy SyncPolicy, synced, changed bool) bool {
+	return policy == SyncPolicyExclusive && synced && !changed
+}
+
+// localFolderSynced 本地文件夹下所有内容是否都已经同步过并且没有修改，存在新建或者修改的文件时文件夹不能删除
+func (f *FileActionTaskManager) localFolderSynced(folderPath string) bool {
+	entries, err := os.ReadDir(folderPath)
+	if err != nil {
+		logger.Verboseln("read local folder error: ", err)
+		return false
+	}
+	for _, entry := range entries {
+		fullPath := path.Join(folderPath, entry.Name())
+		snapshot := f.task.snapshotDb.Get(f.relativePathOfLocal(fullPath))
+		if snapshot == nil || snapshot.IsFolder != entry.IsDir() {
+			return false
+		}
+		if entry.IsDir() {
+			if !f.localFolderSynced(fullPath) {
+				return false
+			}
+			continue
+		}
+		fi, e := entry.Info()
+		if e != nil || snapshot.localChanged(newLocalFileItem(fi, fullPath), f.syncOption.ModTimeTolerance) {
+			return false
+		}
+	}
+	return true
+}
+
+// panFolderSynced 云盘文件夹下所有内容是否都已经同步过并且没有修改，存在新建或者修改的文件时文件夹不能删除
+func (f *FileActionTaskManager) panFolderSynced(folder *PanFileItem) bool {
+	files, apierr := f.task.panClient.OpenapiPanClient().FileListGetAll(&aliyunpan.FileListParam{
+		DriveId:      f.task.DriveId,
+		ParentFileId: folder.FileId,
+	}, 1500) // 延迟时间避免触发风控
+	if apierr != nil {
+		logger.Verboseln("query pan file list error: ", apierr)
+		return false
+	}
+	for _, fe := range files {
+		item := NewPanFileItem(fe)
+		item.Path = path.Join(folder.Path, fe.FileName)
+		snapshot := f.task.snapshotDb.Get(f.relativePathOfPan(item.Path))
+		if snapshot == nil || snapshot.IsFolder != item.IsFolder() {
+			return false
+		}
+		if item.IsFolder() {
+			if !f.panFolderSynced(item) {
+				return false
+			}
+			continue
+		}
+		if snapshot.panChanged(item) {
+			return false
+		}
+	}
+	return true
+}
+
+// doTwoWayBothExisted 本地和云盘都存在的文件，根据上一次同步的快照判断哪一端发生了修改
+func (f *FileActionTaskManager) doTwoWayBothExisted(localFile *LocalFileItem, panFile *PanFileItem) {
+	if localFile.IsFolder() {
+		if f.task.snapshotDb.Get(f.relativePathOfLocal(localFile.Path)) == nil {
+			f.saveSnapshot(localFile, panFile)
+		}
+		return
+	}
+
+	snapshot := f.task.snapshotDb.Get(f.relativePathOfLocal(localFile.Path))
+	if snapshot != nil {
+		localChanged := snapshot.localChanged(localFile, f.syncOption.ModTimeTolerance)
+		panChanged := snapshot.panChanged(panFile)
+		if !localChanged && !panChanged {
+			logger.Verboseln("file is the same, no need to sync file: ", localFile.Path)
+			return
+		}
+		if localChanged && !panChanged {
+			f.addToSyncDb(f.newUploadTask(localFile))
+			return
+		}
+		if !localChanged && panChanged {
+			f.addToSyncDb(f.newDownloadTask(panFile))
+			return
+		}
+	} else {
+		// 没有同步记录，计算本地文件SHA1确认内容是否一致
+		if localFile.Sha1Hash == "" {
+			localFile.Sha1Hash = f.sumLocalFileSha1(localFile)
+		}
+		if localFile.Sha1Hash != "" && strings.EqualFold(localFile.Sha1Hash, panFile.Sha1Hash) {
+			f.saveSnapshot(localFile, panFile)
+			return
+		}
+	}
+
+	// 两端都有修改，按照冲突策略处理
+	f.resolveConflict(localFile, panFile)
+}
+
+// resolveConflict 本地和云盘文件都被修改，按照冲突策略处理
+func (f *FileActionTaskManager) resolveConflict(localFile *LocalFileItem, panFile *PanFileItem) {
+	policy := f.task.ConflictPolicy
+	PromptPrintln(fmt.Sprintf("文件冲突(%s)：%s", policy, localFile.Path))
+	if f.isDryRun() {
+		f.addDryRunConflict(localFile, panFile, policy)
+		return
+	}
+	switch policy {
+	case SyncConflictLocal:
+		f.addToSyncDb(f.newUploadTask(localFile))
+	case SyncConflictCloud:
+		f.addToSyncDb(f.newDownloadTask(panFile))
+	case SyncConflictKeepBoth:
+		// 本地文件重命名，下一轮扫描作为新文件上传；云盘文件下载到原路径
+		conflictPath := conflictFilePath(localFile.Path, time.Now())
+		if err := os.Rename(localFile.Path, conflictPath); err != nil {
+			logger.Verbosef("重命名冲突文件出错: %s, %s\n", localFile.Path, err)
+			return
+		}
+		PromptPrintln("本地冲突文件已重命名为：" + conflictPath)
+		f.addToSyncDb(f.newDownloadTask(panFile))
+	default:
+		if localFile.UpdateTimeUnix() >= panFile.UpdateTimeUnix() {
+			f.addToSyncDb(f.newUploadTask(localFile))
+		} else {
+			f.addToSyncDb(f.newDownloadTask(panFile))
+		}
+	}
+}
+
+// sumLocalFileSha1 计算本地文件SHA1并保存到本地数据库，失败返回空字符串
+func (f *FileActionTaskManager) sumLocalFileSha1(localFile *LocalFileItem) string {
+	fileSum := localfile.NewLocalFileEntity(localFile.Path)
+	if err := fileSum.OpenPath(); err != nil {
+		logger.Verbosef("文件不可读, 错误信息: %s, 跳过...\n", err)
+		return ""
+	}
+	defer fileSum.Close()
+	if err := fileSum.Sum(localfile.CHECKSUM_SHA1); err != nil {
+		return ""
+	}
+	localFile.Sha1Hash = fileSum.SHA1
+	if file, e := f.task.localFileDb.Get(localFile.Path); e == nil && file != nil {
+		file.Sha1Hash = fileSum.SHA1
+		f.task.localFileDb.Update(file)
+	}
+	return fileSum.SHA1
+}
+
+// conflictFilePath 冲突文件的重命名路径，例如：a.txt => a (冲突 20230102-150405).txt
+func conflictFilePath(filePath string, t time.Time) string {
+	ext := path.Ext(filePath)
+	return strings.TrimSuffix(filePath, ext) + " (冲突 " + t.Format("20060102-150405") + ")" + ext
+}
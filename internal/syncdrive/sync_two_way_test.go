@@ -0,0 +1,98 @@
+package syncdrive
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestParseSyncConflictPolicy(t *testing.T) {
+	if p, e := ParseSyncConflictPolicy(""); e != nil || p != SyncConflictNewest {
+		t.Fatalf("default policy: %s, %v", p, e)
+	}
+	if p, e := ParseSyncConflictPolicy("Keep-Both"); e != nil || p != SyncConflictKeepBoth {
+		t.Fatalf("keep-both policy: %s, %v", p, e)
+	}
+	if _, e := ParseSyncConflictPolicy("remote"); e == nil {
+		t.Fatal("unsupported policy should return error")
+	}
+}
+
+func TestConflictFilePath(t *testing.T) {
+	tm := time.Date(2023, 1, 2, 15, 4, 5, 0, time.Local)
+	if p := conflictFilePath("/a/b/1.txt", tm); p != "/a/b/1 (冲突 20230102-150405).txt" {
+		t.Fatal(p)
+	}
+	if p := conflictFilePath("/a/b/README", tm); p != "/a/b/README (冲突 20230102-150405)" {
+		t.Fatal(p)
+	}
+}
+
+func TestOneSidedShouldDelete(t *testing.T) {
+	cases := []struct {
+		name    string
+		policy  SyncPolicy
+		synced  bool
+		changed bool
+		want    bool
+	}{
+		{"新建文件", SyncPolicyExclusive, false, true, false},
+		{"同步过未修改", SyncPolicyExclusive, true, false, true},
+		{"同步过已修改", SyncPolicyExclusive, true, true, false},
+		{"增量策略同步过未修改", SyncPolicyIncrement, true, false, false},
+		{"增量策略新建文件", SyncPolicyIncrement, false, true, false},
+	}
+	for _, c := range cases {
+		if got := oneSidedShouldDelete(c.policy, c.synced, c.changed); got != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestLocalFolderSynced(t *testing.T) {
+	root := t.TempDir()
+	f := &FileActionTaskManager{task: &SyncTask{
+		LocalFolderPath: root,
+		snapshotDb:      NewSyncSnapshotDb(path.Join(t.TempDir(), "snapshot.bolt")),
+	}}
+	dir := path.Join(root, "docs")
+	if e := os.MkdirAll(path.Join(dir, "sub"), 0755); e != nil {
+		t.Fatal(e)
+	}
+	synced := path.Join(dir, "sub", "a.txt")
+	if e := os.WriteFile(synced, []byte("hello"), 0644); e != nil {
+		t.Fatal(e)
+	}
+	for _, p := range []string{dir, path.Join(dir, "sub"), synced} {
+		fi, _ := os.Stat(p)
+		f.saveSnapshot(newLocalFileItem(fi, p), &PanFileItem{Sha1Hash: "AAF4C61DDCC5E8A2DABEDE0F3B482CD9AEA9434D"})
+	}
+
+	cases := []struct {
+		name  string
+		setup func()
+		want  bool
+	}{
+		{"全部同步过", func() {}, true},
+		{"同步过的文件被修改", func() {
+			os.WriteFile(synced, []byte("hello world"), 0644)
+		}, false},
+		{"新建文件", func() {
+			os.WriteFile(synced, []byte("hello"), 0644)
+			fi, _ := os.Stat(synced)
+			f.saveSnapshot(newLocalFileItem(fi, synced), &PanFileItem{})
+			os.WriteFile(path.Join(dir, "sub", "new.txt"), []byte("new"), 0644)
+		}, false},
+		{"新建文件夹", func() {
+			os.Remove(path.Join(dir, "sub", "new.txt"))
+			os.Mkdir(path.Join(dir, "new"), 0755)
+		}, false},
+	}
+	for _, c := range cases {
+		c.setup()
+		if got := f.localFolderSynced(dir); got != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
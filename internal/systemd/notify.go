@@ -0,0 +1,93 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package systemd 实现systemd的sd_notify协议，支持 Type=notify 以及 WatchdogSec 看门狗
+package systemd
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// StateReady 服务启动完成
+	StateReady = "READY=1"
+	// StateStopping 服务正在停止
+	StateStopping = "STOPPING=1"
+	// StateWatchdog 看门狗心跳
+	StateWatchdog = "WATCHDOG=1"
+)
+
+// Notify 发送状态通知给systemd。没有运行在systemd的notify服务中时返回false
+func Notify(state string) (bool, error) {
+	socketAddr := &net.UnixAddr{
+		Name: os.Getenv("NOTIFY_SOCKET"),
+		Net:  "unixgram",
+	}
+	if socketAddr.Name == "" {
+		return false, nil
+	}
+	conn, err := net.DialUnix(socketAddr.Net, nil, socketAddr)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	if _, err = conn.Write([]byte(state)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Status 发送状态描述给systemd，systemctl status 可以看到该描述
+func Status(status string) (bool, error) {
+	return Notify("STATUS=" + status)
+}
+
+// WatchdogInterval 获取systemd配置的看门狗超时时间，没有开启看门狗返回0
+func WatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pidStr := os.Getenv("WATCHDOG_PID"); pidStr != "" {
+		// 看门狗是发给其他进程的
+		if pid, e := strconv.Atoi(pidStr); e != nil || pid != os.Getpid() {
+			return 0
+		}
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// RunWatchdog 按照看门狗超时时间的一半发送心跳，healthy返回false时不发送心跳，systemd超时后会重启服务。
+// 没有开启看门狗直接返回，stop关闭后退出
+func RunWatchdog(healthy func() bool, stop <-chan struct{}) {
+	interval := WatchdogInterval()
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if healthy == nil || healthy() {
+				Notify(StateWatchdog)
+			}
+		}
+	}
+}
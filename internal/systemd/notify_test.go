@@ -0,0 +1,126 @@
+package systemd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// listenNotifySocket 模拟systemd监听 NOTIFY_SOCKET
+func listenNotifySocket(t *testing.T) *net.UnixConn {
+	addr := &net.UnixAddr{Name: filepath.Join(t.TempDir(), "notify.sock"), Net: "unixgram"}
+	conn, err := net.ListenUnixgram("unixgram", addr)
+	if err != nil {
+		t.Skip("unixgram not supported: ", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", addr.Name)
+	return conn
+}
+
+func readState(conn *net.UnixConn, timeout time.Duration) string {
+	buf := make([]byte, 256)
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	n, err := conn.Read(buf)
+	if err != nil {
+		return ""
+	}
+	return string(buf[:n])
+}
+
+func TestNotify(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if ok, err := Notify(StateReady); ok || err != nil {
+		t.Fatalf("without NOTIFY_SOCKET: %v %v", ok, err)
+	}
+
+	conn := listenNotifySocket(t)
+	if ok, err := Notify(StateReady); !ok || err != nil {
+		t.Fatalf("notify: %v %v", ok, err)
+	}
+	if s := readState(conn, time.Second); s != StateReady {
+		t.Fatalf("got %q", s)
+	}
+	Status("scanning")
+	if s := readState(conn, time.Second); s != "STATUS=scanning" {
+		t.Fatalf("got %q", s)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+	cases := []struct {
+		usec string
+		pid  string
+		want time.Duration
+	}{
+		{"", "", 0},
+		{"abc", "", 0},
+		{"0", "", 0},
+		{"30000000", "", 30 * time.Second},
+		{"30000000", pid, 30 * time.Second},
+		{"30000000", "1", 0},
+	}
+	for _, c := range cases {
+		t.Setenv("WATCHDOG_USEC", c.usec)
+		t.Setenv("WATCHDOG_PID", c.pid)
+		if got := WatchdogInterval(); got != c.want {
+			t.Errorf("usec=%q pid=%q: got %s, want %s", c.usec, c.pid, got, c.want)
+		}
+	}
+}
+
+func TestRunWatchdog(t *testing.T) {
+	conn := listenNotifySocket(t)
+	t.Setenv("WATCHDOG_PID", "")
+
+	// 没有开启看门狗直接返回
+	t.Setenv("WATCHDOG_USEC", "")
+	done := make(chan struct{})
+	go func() {
+		RunWatchdog(nil, make(chan struct{}))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("RunWatchdog should return without WATCHDOG_USEC")
+	}
+
+	t.Setenv("WATCHDOG_USEC", "40000")
+	healthy := make(chan bool, 1)
+	healthy <- true
+	stop := make(chan struct{})
+	done = make(chan struct{})
+	go func() {
+		RunWatchdog(func() bool {
+			h := <-healthy
+			healthy <- h
+			return h
+		}, stop)
+		close(done)
+	}()
+	if s := readState(conn, time.Second); s != StateWatchdog {
+		t.Fatalf("healthy: got %q", s)
+	}
+
+	// 任务卡死时不再发送心跳
+	<-healthy
+	healthy <- false
+	// 丢弃切换前已经发出的心跳
+	for i := 0; i < 5 && readState(conn, 30*time.Millisecond) != ""; i++ {
+	}
+	if s := readState(conn, 100*time.Millisecond); s != "" {
+		t.Fatalf("unhealthy: got %q", s)
+	}
+
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("RunWatchdog should return after stop")
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package taskframework
+
+import "sync"
+
+type (
+	// TaskControl 从外部控制一批任务，例如daemon暂停、恢复、取消上传下载任务并查询进度。
+	// 一批任务可能使用多个执行器，绑定的执行器会同步当前的暂停、停止状态。所有方法都支持nil调用
+	TaskControl struct {
+		executors []*TaskExecutor
+		paused    bool
+		stopped   bool
+		progress  func() *TaskProgress
+		changed   chan struct{} // 暂停、恢复、停止时关闭，通知正在传输的任务单元
+		mutex     sync.Mutex
+	}
+
+	// TaskProgress 一批任务的进度
+	TaskProgress struct {
+		TotalFiles   int64   `json:"totalFiles"`   // 文件总数
+		SucceedFiles int64   `json:"succeedFiles"` // 成功的文件数
+		FailedFiles  int64   `json:"failedFiles"`  // 失败的文件数
+		TotalSize    int64   `json:"totalSize"`    // 已传输的数据量，单位：字节
+		Speed        int64   `json:"speed"`        // 当前速度，单位：字节/秒
+		Elapsed      float64 `json:"elapsed"`      // 已用时间，单位：秒
+	}
+)
+
+// NewTaskControl 创建任务控制
+func NewTaskControl() *TaskControl {
+	return &TaskControl{}
+}
+
+// Bind 绑定执行器
+func (tc *TaskControl) Bind(te *TaskExecutor) {
+	if tc == nil || te == nil {
+		return
+	}
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+	tc.executors = append(tc.executors, te)
+	if tc.stopped {
+		te.Stop()
+	} else if tc.paused {
+		te.Pause()
+	}
+}
+
+// Pause 暂停所有绑定的执行器
+func (tc *TaskControl) Pause() {
+	if tc == nil {
+		return
+	}
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+	if tc.stopped {
+		return
+	}
+	tc.paused = true
+	for _, te := range tc.executors {
+		te.Pause()
+	}
+	tc.notifyLocked()
+}
+
+// Resume 恢复所有绑定的执行器
+func (tc *TaskControl) Resume() {
+	if tc == nil {
+		return
+	}
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+	tc.paused = false
+	for _, te := range tc.executors {
+		te.Resume()
+	}
+	tc.notifyLocked()
+}
+
+// Stop 停止所有绑定的执行器，之后绑定的执行器也会直接停止
+func (tc *TaskControl) Stop() {
+	if tc == nil {
+		return
+	}
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+	tc.stopped = true
+	tc.paused = false
+	for _, te := range tc.executors {
+		te.Stop()
+	}
+	tc.notifyLocked()
+}
+
+// notifyLocked 通知状态变化，调用方需持有锁
+func (tc *TaskControl) notifyLocked() {
+	if tc.changed != nil {
+		close(tc.changed)
+	}
+	tc.changed = make(chan struct{})
+}
+
+// Changed 获取状态变化通知，暂停、恢复、停止时关闭，每次状态变化后需要重新获取。
+// tc为nil时返回nil，永远不会收到通知
+func (tc *TaskControl) Changed() <-chan struct{} {
+	if tc == nil {
+		return nil
+	}
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+	if tc.changed == nil {
+		tc.changed = make(chan struct{})
+	}
+	return tc.changed
+}
+
+// WaitResume 暂停时阻塞直到恢复或者停止，返回false代表已停止
+func (tc *TaskControl) WaitResume() bool {
+	for {
+		changed := tc.Changed()
+		if tc.IsStopped() {
+			return false
+		}
+		if !tc.IsPaused() {
+			return true
+		}
+		<-changed
+	}
+}
+
+// IsPaused 是否已暂停
+func (tc *TaskControl) IsPaused() bool {
+	if tc == nil {
+		return false
+	}
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+	return tc.paused
+}
+
+// IsStopped 是否已停止
+func (tc *TaskControl) IsStopped() bool {
+	if tc == nil {
+		return false
+	}
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+	return tc.stopped
+}
+
+// SetProgressFunc 设置进度查询方法，由执行任务的一方提供
+func (tc *TaskControl) SetProgressFunc(f func() *TaskProgress) {
+	if tc == nil {
+		return
+	}
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+	tc.progress = f
+}
+
+// Progress 查询进度，还没有开始执行时返回nil
+func (tc *TaskControl) Progress() *TaskProgress {
+	if tc == nil {
+		return nil
+	}
+	tc.mutex.Lock()
+	f := tc.progress
+	tc.mutex.Unlock()
+	if f == nil {
+		return nil
+	}
+	return f()
+}
@@ -18,9 +18,15 @@ import (
 	"github.com/oleiade/lane"
 	"github.com/tickstep/aliyunpan/internal/waitgroup"
 	"strconv"
+	"sync"
 	"time"
 )
 
+const (
+	// deferredTaskWait 只剩暂时不能执行的任务时，重新排队前的等待时间
+	deferredTaskWait = 200 * time.Millisecond
+)
+
 type (
 	TaskExecutor struct {
 		incr     *incremental.Int // 任务id生成
@@ -30,6 +36,25 @@ type (
 		// 是否统计失败队列
 		IsFailedDeque bool
 		failedDeque   *lane.Deque
+
+		// ResultHook 每次任务执行结束后调用，可以用于统计错误，例如检测账号风控
+		ResultHook func(result *TaskUnitRunResult)
+
+		// 暂停、停止控制
+		mutex   sync.Mutex
+		cond    *sync.Cond
+		paused  bool
+		stopped bool
+		// pauseSeq 每次调用暂停、恢复都会增加，用于判断暂停之后是否有其他调用方暂停或者恢复过
+		pauseSeq uint64
+
+		// deferred 暂时不能执行的任务，其他任务结束后重新加入队列
+		deferred []*TaskInfoItem
+
+		// 执行顺序
+		order      TaskOrder
+		ordered    bool // 是否按照优先级和执行顺序调度
+		orderDirty bool // 队列有变化，需要重新排序
 	}
 )
 
@@ -59,16 +84,22 @@ func (te *TaskExecutor) SetParallel(parallel int) {
 
 //Append 将任务加到任务队列末尾
 func (te *TaskExecutor) Append(unit TaskUnit, maxRetry int) *TaskInfo {
+	return te.append(unit, maxRetry, TaskOrderKey{})
+}
+
+func (te *TaskExecutor) append(unit TaskUnit, maxRetry int, key TaskOrderKey) *TaskInfo {
 	te.lazyInit()
 	taskInfo := &TaskInfo{
 		id:       strconv.Itoa(te.incr.Next()),
 		maxRetry: maxRetry,
+		orderKey: key,
 	}
 	unit.SetTaskInfo(taskInfo)
 	te.deque.Append(&TaskInfoItem{
 		Info: taskInfo,
 		Unit: unit,
 	})
+	te.markOrderDirty()
 	return taskInfo
 }
 
@@ -93,6 +124,11 @@ func (te *TaskExecutor) Execute() {
 	for {
 		wg := waitgroup.NewWaitGroup(te.parallel)
 		for {
+			// 暂停时等待恢复，停止后不再执行队列中的任务
+			if !te.waitResume() {
+				break
+			}
+			te.sortDeque()
 			e := te.deque.Shift()
 			if e == nil { // 任务为空
 				break
@@ -109,6 +145,15 @@ func (te *TaskExecutor) Execute() {
 				defer wg.Done()
 
 				result := task.Unit.Run()
+				if result != nil && result.Deferred {
+					te.deferTask(task)
+					return
+				}
+				// 任务结束后可能释放了名额，让暂时不能执行的任务重新排队
+				defer te.requeueDeferred()
+				if result != nil && te.ResultHook != nil {
+					te.ResultHook(result)
+				}
 
 				// 返回结果为空
 				if result == nil {
@@ -148,6 +193,7 @@ func (te *TaskExecutor) Execute() {
 
 					time.Sleep(task.Unit.RetryWait()) // 等待
 					te.deque.Append(task)             // 重新加入队列末尾
+					te.markOrderDirty()
 					return
 				}
 
@@ -163,28 +209,142 @@ func (te *TaskExecutor) Execute() {
 
 		wg.Wait()
 
+		// 只剩暂时不能执行的任务，名额可能被其他执行器占用，等待一段时间后重新排队
+		if te.deque.Size() == 0 && !te.IsStopped() && te.deferredCount() > 0 {
+			time.Sleep(deferredTaskWait)
+			te.requeueDeferred()
+		}
+
 		// 没有任务了
-		if te.deque.Size() == 0 {
+		if te.deque.Size() == 0 || te.IsStopped() {
 			break
 		}
 	}
 }
 
+// deferTask 暂存暂时不能执行的任务
+func (te *TaskExecutor) deferTask(task *TaskInfoItem) {
+	te.mutex.Lock()
+	te.deferred = append(te.deferred, task)
+	te.mutex.Unlock()
+}
+
+func (te *TaskExecutor) deferredCount() int {
+	te.mutex.Lock()
+	defer te.mutex.Unlock()
+	return len(te.deferred)
+}
+
+// requeueDeferred 把暂存的任务重新加入队列末尾
+func (te *TaskExecutor) requeueDeferred() {
+	te.mutex.Lock()
+	deferred := te.deferred
+	te.deferred = nil
+	te.mutex.Unlock()
+	for _, task := range deferred {
+		te.deque.Append(task)
+	}
+	if len(deferred) > 0 {
+		te.markOrderDirty()
+	}
+}
+
 //FailedDeque 获取失败队列
 func (te *TaskExecutor) FailedDeque() *lane.Deque {
 	return te.failedDeque
 }
 
-//Stop 停止执行
-func (te *TaskExecutor) Stop() {
+// pauseCond 暂停等待的条件变量，调用方需持有锁
+func (te *TaskExecutor) pauseCond() *sync.Cond {
+	if te.cond == nil {
+		te.cond = sync.NewCond(&te.mutex)
+	}
+	return te.cond
+}
 
+// waitResume 暂停时阻塞直到恢复或者停止，返回是否可以继续执行任务
+func (te *TaskExecutor) waitResume() bool {
+	te.mutex.Lock()
+	defer te.mutex.Unlock()
+	for te.paused && !te.stopped {
+		te.pauseCond().Wait()
+	}
+	return !te.stopped
 }
 
-//Pause 暂停执行
-func (te *TaskExecutor) Pause() {
+//Stop 停止执行，队列中还没有开始的任务不再执行，正在执行的任务会继续执行完成
+func (te *TaskExecutor) Stop() {
+	te.mutex.Lock()
+	defer te.mutex.Unlock()
+	if te.stopped {
+		return
+	}
+	te.stopped = true
+	te.paused = false
+	te.pauseCond().Broadcast()
+}
 
+//Pause 暂停执行，不再开始新的任务，正在执行的任务会继续执行完成
+func (te *TaskExecutor) Pause() {
+	te.mutex.Lock()
+	defer te.mutex.Unlock()
+	if te.stopped {
+		return
+	}
+	te.pauseSeq++
+	te.paused = true
 }
 
 //Resume 恢复执行
 func (te *TaskExecutor) Resume() {
+	te.mutex.Lock()
+	defer te.mutex.Unlock()
+	te.pauseSeq++
+	te.resume()
+}
+
+func (te *TaskExecutor) resume() {
+	if !te.paused {
+		return
+	}
+	te.paused = false
+	te.pauseCond().Broadcast()
+}
+
+// TryPause 暂停执行，返回本次暂停的序号。已经暂停或者已停止时不暂停，返回false
+func (te *TaskExecutor) TryPause() (uint64, bool) {
+	te.mutex.Lock()
+	defer te.mutex.Unlock()
+	if te.paused || te.stopped {
+		return 0, false
+	}
+	te.pauseSeq++
+	te.paused = true
+	return te.pauseSeq, true
+}
+
+// ResumePaused 恢复 TryPause 暂停的执行。暂停之后有其他调用方暂停或者恢复过时不恢复，返回false
+func (te *TaskExecutor) ResumePaused(seq uint64) bool {
+	te.mutex.Lock()
+	defer te.mutex.Unlock()
+	if te.pauseSeq != seq || !te.paused {
+		return false
+	}
+	te.pauseSeq++
+	te.resume()
+	return true
+}
+
+// IsPaused 是否已暂停
+func (te *TaskExecutor) IsPaused() bool {
+	te.mutex.Lock()
+	defer te.mutex.Unlock()
+	return te.paused
+}
+
+// IsStopped 是否已停止
+func (te *TaskExecutor) IsStopped() bool {
+	te.mutex.Lock()
+	defer te.mutex.Unlock()
+	return te.stopped
 }
@@ -0,0 +1,120 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package taskframework
+
+import (
+	"fmt"
+	"sort"
+)
+
+type (
+	// TaskOrder 任务的执行顺序
+	TaskOrder string
+
+	// TaskOrderKey 任务调度的排序依据
+	TaskOrderKey struct {
+		Priority int    // 优先级，数值越大越先执行，默认为0
+		Name     string // 文件名或者路径
+		Size     int64  // 文件大小
+		ModTime  int64  // 修改时间，Unix时间戳
+	}
+)
+
+const (
+	// TaskOrderDefault 按照加入队列的顺序执行
+	TaskOrderDefault TaskOrder = ""
+	// TaskOrderSizeAsc 小文件优先
+	TaskOrderSizeAsc TaskOrder = "size-asc"
+	// TaskOrderSizeDesc 大文件优先
+	TaskOrderSizeDesc TaskOrder = "size-desc"
+	// TaskOrderName 按文件名排序
+	TaskOrderName TaskOrder = "name"
+	// TaskOrderMtime 按修改时间排序，先修改的文件优先
+	TaskOrderMtime TaskOrder = "mtime"
+)
+
+// ParseTaskOrder 解析任务执行顺序，为空代表按照加入队列的顺序
+func ParseTaskOrder(s string) (TaskOrder, error) {
+	switch order := TaskOrder(s); order {
+	case TaskOrderDefault, TaskOrderSizeAsc, TaskOrderSizeDesc, TaskOrderName, TaskOrderMtime:
+		return order, nil
+	}
+	return TaskOrderDefault, fmt.Errorf("不支持的执行顺序: %s, 可选值: size-asc, size-desc, name, mtime", s)
+}
+
+// SetOrder 设置任务的执行顺序。设置后调度时优先执行优先级高的任务，相同优先级的任务按照order排序，
+// TaskOrderDefault 保持加入队列的顺序。执行过程中加入的任务、重试的任务也会按照该规则调度
+func (te *TaskExecutor) SetOrder(order TaskOrder) {
+	te.mutex.Lock()
+	defer te.mutex.Unlock()
+	te.order = order
+	te.ordered = true
+	te.orderDirty = true
+}
+
+// AppendWithOrder 将任务加到任务队列，设置了执行顺序时按照key调度
+func (te *TaskExecutor) AppendWithOrder(unit TaskUnit, maxRetry int, key TaskOrderKey) *TaskInfo {
+	return te.append(unit, maxRetry, key)
+}
+
+// markOrderDirty 队列有变化，下次调度前需要重新排序
+func (te *TaskExecutor) markOrderDirty() {
+	te.mutex.Lock()
+	defer te.mutex.Unlock()
+	te.orderDirty = te.ordered
+}
+
+// sortDeque 按照优先级和执行顺序对队列中还没有执行的任务排序
+func (te *TaskExecutor) sortDeque() {
+	te.mutex.Lock()
+	if !te.orderDirty {
+		te.mutex.Unlock()
+		return
+	}
+	te.orderDirty = false
+	order := te.order
+	te.mutex.Unlock()
+
+	items := []*TaskInfoItem{}
+	for e := te.deque.Shift(); e != nil; e = te.deque.Shift() {
+		if item, ok := e.(*TaskInfoItem); ok {
+			items = append(items, item)
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Info.less(items[j].Info, order)
+	})
+	for _, item := range items {
+		te.deque.Append(item)
+	}
+}
+
+// less 任务a是否应该先于任务b执行
+func (t *TaskInfo) less(b *TaskInfo, order TaskOrder) bool {
+	x, y := t.orderKey, b.orderKey
+	if x.Priority != y.Priority {
+		return x.Priority > y.Priority
+	}
+	switch order {
+	case TaskOrderSizeAsc:
+		return x.Size < y.Size
+	case TaskOrderSizeDesc:
+		return x.Size > y.Size
+	case TaskOrderName:
+		return x.Name < y.Name
+	case TaskOrderMtime:
+		return x.ModTime < y.ModTime
+	}
+	return false
+}
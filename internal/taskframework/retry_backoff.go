@@ -0,0 +1,158 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package taskframework
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// BackoffStrategy 重试退避策略
+	BackoffStrategy string
+
+	// RetryBackoff 重试等待时间的计算方式
+	RetryBackoff struct {
+		Strategy BackoffStrategy
+		Base     time.Duration // 基础等待时间
+		Max      time.Duration // 最大等待时间，0代表不限制
+	}
+
+	// RetryBackoffPolicy 错误类型 => 退避策略，default 为没有单独配置的错误类型使用的策略
+	RetryBackoffPolicy map[string]*RetryBackoff
+)
+
+const (
+	// BackoffFixed 固定间隔
+	BackoffFixed BackoffStrategy = "fixed"
+	// BackoffExponential 指数退避，每次重试等待时间翻倍
+	BackoffExponential BackoffStrategy = "exponential"
+	// BackoffJitter 带随机抖动的指数退避，在指数退避时间的一半到全部之间随机等待，避免大量任务同时重试
+	BackoffJitter BackoffStrategy = "jitter"
+
+	// RetryErrorDefault 默认错误类型
+	RetryErrorDefault = "default"
+	// RetryErrorRateLimit 请求被限流
+	RetryErrorRateLimit = "ratelimit"
+	// RetryErrorNetwork 网络错误
+	RetryErrorNetwork = "network"
+)
+
+// ParseRetryBackoff 解析退避策略，格式为 策略:基础间隔秒数:最大间隔秒数，例如：exponential:2:60、fixed:5
+func ParseRetryBackoff(s string) (*RetryBackoff, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	b := &RetryBackoff{
+		Strategy: BackoffStrategy(strings.ToLower(parts[0])),
+		Base:     2 * time.Second,
+	}
+	switch b.Strategy {
+	case BackoffFixed, BackoffExponential, BackoffJitter:
+	default:
+		return nil, fmt.Errorf("不支持的退避策略: %s, 支持: fixed, exponential, jitter", parts[0])
+	}
+	if len(parts) > 3 {
+		return nil, fmt.Errorf("退避策略格式错误: %s", s)
+	}
+	if len(parts) > 1 {
+		sec, err := strconv.Atoi(parts[1])
+		if err != nil || sec < 0 {
+			return nil, fmt.Errorf("退避策略基础间隔错误: %s", s)
+		}
+		b.Base = time.Duration(sec) * time.Second
+	}
+	if len(parts) > 2 {
+		sec, err := strconv.Atoi(parts[2])
+		if err != nil || sec < 0 {
+			return nil, fmt.Errorf("退避策略最大间隔错误: %s", s)
+		}
+		b.Max = time.Duration(sec) * time.Second
+	}
+	return b, nil
+}
+
+// Wait 第retry次重试需要等待的时间，retry从1开始
+func (b *RetryBackoff) Wait(retry int) time.Duration {
+	if retry < 1 {
+		retry = 1
+	}
+	d := b.Base
+	if b.Strategy != BackoffFixed {
+		for i := 1; i < retry; i++ {
+			if (b.Max > 0 && d >= b.Max) || d > math.MaxInt64/2 {
+				break
+			}
+			d *= 2
+		}
+	}
+	if b.Max > 0 && d > b.Max {
+		d = b.Max
+	}
+	if b.Strategy == BackoffJitter && d > 0 {
+		d = d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+	}
+	return d
+}
+
+func (b *RetryBackoff) String() string {
+	return fmt.Sprintf("%s:%d:%d", b.Strategy, int(b.Base/time.Second), int(b.Max/time.Second))
+}
+
+// ParseRetryBackoffPolicy 解析各错误类型的退避策略，多个配置用逗号隔开，格式为 错误类型=策略，
+// 例如：default=exponential:2:60,ratelimit=jitter:10:300。没有指定错误类型的配置作为default
+func ParseRetryBackoffPolicy(s string) (RetryBackoffPolicy, error) {
+	policy := RetryBackoffPolicy{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		errType, value := RetryErrorDefault, item
+		if idx := strings.Index(item, "="); idx >= 0 {
+			errType, value = strings.ToLower(strings.TrimSpace(item[:idx])), item[idx+1:]
+		}
+		switch errType {
+		case RetryErrorDefault, RetryErrorRateLimit, RetryErrorNetwork:
+		default:
+			return nil, fmt.Errorf("不支持的错误类型: %s, 支持: default, ratelimit, network", errType)
+		}
+		b, err := ParseRetryBackoff(value)
+		if err != nil {
+			return nil, err
+		}
+		policy[errType] = b
+	}
+	return policy, nil
+}
+
+// Get 获取错误类型对应的退避策略，没有单独配置的使用default，都没有配置返回nil
+func (p RetryBackoffPolicy) Get(errType string) *RetryBackoff {
+	if b, ok := p[errType]; ok {
+		return b
+	}
+	return p[RetryErrorDefault]
+}
+
+func (p RetryBackoffPolicy) String() string {
+	items := make([]string, 0, len(p))
+	for errType, b := range p {
+		items = append(items, errType+"="+b.String())
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
@@ -40,6 +40,9 @@ type (
 		Succeed   bool // 是否执行成功
 		NeedRetry bool // 是否需要重试
 		Cancel    bool // 是否取消了任务
+		// Deferred 暂时不能执行（例如该类任务的并发名额已满），让出执行位置给队列中的其他任务，
+		// 其他任务结束后重新加入队列，不计入重试次数
+		Deferred bool
 
 		// 以下是额外的信息
 		Err           error       // 错误信息
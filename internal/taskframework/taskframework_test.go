@@ -16,6 +16,8 @@ package taskframework_test
 import (
 	"fmt"
 	"github.com/tickstep/aliyunpan/internal/taskframework"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -74,3 +76,253 @@ func TestTaskExecutor(t *testing.T) {
 	}
 	te.Execute()
 }
+
+type countUnit struct {
+	TestUnit
+	count *int32
+}
+
+func (cu *countUnit) Run() (result *taskframework.TaskUnitRunResult) {
+	atomic.AddInt32(cu.count, 1)
+	time.Sleep(20 * time.Millisecond)
+	return &taskframework.TaskUnitRunResult{Succeed: true}
+}
+
+func (cu *countUnit) OnSuccess(lastRunResult *taskframework.TaskUnitRunResult) {}
+
+func (cu *countUnit) OnComplete(lastRunResult *taskframework.TaskUnitRunResult) {}
+
+func TestTaskControl(t *testing.T) {
+	var count int32
+	te := taskframework.NewTaskExecutor()
+	for i := 0; i < 5; i++ {
+		te.Append(&countUnit{count: &count}, 0)
+	}
+	tc := taskframework.NewTaskControl()
+	tc.Pause()
+	tc.Bind(te)
+	done := make(chan struct{})
+	go func() {
+		te.Execute()
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&count); n != 0 {
+		t.Fatalf("paused executor ran %d tasks", n)
+	}
+	tc.Resume()
+	time.Sleep(25 * time.Millisecond)
+	tc.Stop()
+	<-done
+	if n := atomic.LoadInt32(&count); n == 0 || n == 5 {
+		t.Errorf("stopped executor should drop queued tasks, ran %d", n)
+	}
+	if !te.IsStopped() || tc.Progress() != nil {
+		t.Error("unexpected control state")
+	}
+}
+
+func TestTaskControlWaitResume(t *testing.T) {
+	tc := taskframework.NewTaskControl()
+	if !tc.WaitResume() {
+		t.Fatal("running control should not wait")
+	}
+	changed := tc.Changed()
+	tc.Pause()
+	select {
+	case <-changed:
+	default:
+		t.Fatal("pause should notify")
+	}
+	resumed := make(chan bool)
+	go func() {
+		resumed <- tc.WaitResume()
+	}()
+	time.Sleep(20 * time.Millisecond)
+	tc.Resume()
+	if !<-resumed {
+		t.Error("resume should wake up waiter")
+	}
+	tc.Pause()
+	go func() {
+		resumed <- tc.WaitResume()
+	}()
+	tc.Stop()
+	if <-resumed {
+		t.Error("stopped control should not resume")
+	}
+}
+
+type orderUnit struct {
+	TestUnit
+	name  string
+	order *[]string
+}
+
+func (ou *orderUnit) Run() (result *taskframework.TaskUnitRunResult) {
+	*ou.order = append(*ou.order, ou.name)
+	return &taskframework.TaskUnitRunResult{Succeed: true}
+}
+
+func (ou *orderUnit) OnSuccess(lastRunResult *taskframework.TaskUnitRunResult) {}
+
+func (ou *orderUnit) OnComplete(lastRunResult *taskframework.TaskUnitRunResult) {}
+
+func TestTaskOrder(t *testing.T) {
+	if _, err := taskframework.ParseTaskOrder("random"); err == nil {
+		t.Error("unknown order should be invalid")
+	}
+	var order []string
+	te := taskframework.NewTaskExecutor()
+	te.SetOrder(taskframework.TaskOrderSizeAsc)
+	te.AppendWithOrder(&orderUnit{name: "big", order: &order}, 0, taskframework.TaskOrderKey{Size: 300})
+	te.AppendWithOrder(&orderUnit{name: "small", order: &order}, 0, taskframework.TaskOrderKey{Size: 100})
+	te.AppendWithOrder(&orderUnit{name: "urgent", order: &order}, 0, taskframework.TaskOrderKey{Size: 500, Priority: 1})
+	te.AppendWithOrder(&orderUnit{name: "medium", order: &order}, 0, taskframework.TaskOrderKey{Size: 200})
+	te.Execute()
+	if fmt.Sprint(order) != "[urgent small medium big]" {
+		t.Errorf("unexpected order: %v", order)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	b, err := taskframework.ParseRetryBackoff("exponential:2:30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for retry, want := range map[int]time.Duration{1: 2 * time.Second, 2: 4 * time.Second, 4: 16 * time.Second, 5: 30 * time.Second, 100: 30 * time.Second} {
+		if d := b.Wait(retry); d != want {
+			t.Errorf("exponential retry %d: %s, want %s", retry, d, want)
+		}
+	}
+
+	b, _ = taskframework.ParseRetryBackoff("jitter:10:60")
+	for retry := 1; retry < 10; retry++ {
+		if d := b.Wait(retry); d < 5*time.Second || d > 60*time.Second {
+			t.Errorf("jitter retry %d out of range: %s", retry, d)
+		}
+	}
+
+	if _, err = taskframework.ParseRetryBackoff("linear:1"); err == nil {
+		t.Error("unsupported strategy should return error")
+	}
+
+	policy, err := taskframework.ParseRetryBackoffPolicy("fixed:3, ratelimit=jitter:10:300")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := policy.Get("network").Wait(5); d != 3*time.Second {
+		t.Errorf("default policy: %s", d)
+	}
+	if policy.Get("ratelimit").Strategy != taskframework.BackoffJitter {
+		t.Errorf("ratelimit policy: %s", policy.Get("ratelimit"))
+	}
+}
+
+func TestTaskExecutorResumePaused(t *testing.T) {
+	te := taskframework.NewTaskExecutor()
+	seq, ok := te.TryPause()
+	if !ok || !te.IsPaused() {
+		t.Fatal("executor should be paused")
+	}
+	if _, ok = te.TryPause(); ok {
+		t.Fatal("paused executor should not be paused again")
+	}
+	if !te.ResumePaused(seq) || te.IsPaused() {
+		t.Fatal("executor should be resumed by the same pause")
+	}
+
+	// 暂停期间用户手动暂停过，不自动恢复
+	seq, _ = te.TryPause()
+	te.Pause()
+	if te.ResumePaused(seq) || !te.IsPaused() {
+		t.Fatal("manual pause should not be resumed")
+	}
+
+	// 暂停期间用户恢复后又暂停，不自动恢复
+	te.Resume()
+	seq, _ = te.TryPause()
+	te.Resume()
+	te.Pause()
+	if te.ResumePaused(seq) || !te.IsPaused() {
+		t.Fatal("manual pause after resume should not be resumed")
+	}
+}
+
+// slotUnit 占用共享的并发名额执行，名额已满时返回Deferred
+type slotUnit struct {
+	TestUnit
+	name  string
+	slots chan struct{} // 为nil时不限制
+	hold  time.Duration
+	mutex *sync.Mutex
+	order *[]string
+	runs  *int32
+}
+
+func (su *slotUnit) Run() (result *taskframework.TaskUnitRunResult) {
+	atomic.AddInt32(su.runs, 1)
+	if su.slots != nil {
+		select {
+		case su.slots <- struct{}{}:
+			defer func() { <-su.slots }()
+		default:
+			return &taskframework.TaskUnitRunResult{Deferred: true}
+		}
+	}
+	time.Sleep(su.hold)
+	su.mutex.Lock()
+	*su.order = append(*su.order, su.name)
+	su.mutex.Unlock()
+	return &taskframework.TaskUnitRunResult{Succeed: true}
+}
+
+func (su *slotUnit) OnSuccess(lastRunResult *taskframework.TaskUnitRunResult) {}
+
+func (su *slotUnit) OnComplete(lastRunResult *taskframework.TaskUnitRunResult) {}
+
+func TestTaskExecutorDeferred(t *testing.T) {
+	var order []string
+	var runs int32
+	mutex := &sync.Mutex{}
+	bigSlots := make(chan struct{}, 1)
+	te := taskframework.NewTaskExecutor()
+	te.SetParallel(3)
+	// 大文件同时只能执行一个，排在前面的大文件不能阻塞后面的小文件
+	for i := 0; i < 3; i++ {
+		te.Append(&slotUnit{name: fmt.Sprintf("big%d", i), slots: bigSlots, hold: 100 * time.Millisecond, mutex: mutex, order: &order, runs: &runs}, 0)
+	}
+	for i := 0; i < 2; i++ {
+		te.Append(&slotUnit{name: fmt.Sprintf("small%d", i), mutex: mutex, order: &order, runs: &runs}, 0)
+	}
+	te.Execute()
+
+	if len(order) != 5 {
+		t.Fatalf("finished %v", order)
+	}
+	// 小文件在第一个大文件结束前完成
+	if order[0] != "small0" && order[0] != "small1" || order[1] != "small0" && order[1] != "small1" {
+		t.Errorf("small tasks should not wait for big tasks: %v", order)
+	}
+	if runs <= 5 {
+		t.Errorf("deferred tasks should run again, runs = %d", runs)
+	}
+}
+
+// TestTaskExecutorDeferredExternal 名额被其他执行器占用时，任务等待后重新执行，不会丢失
+func TestTaskExecutorDeferredExternal(t *testing.T) {
+	var order []string
+	var runs int32
+	slots := make(chan struct{}, 1)
+	slots <- struct{}{}
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		<-slots
+	}()
+	te := taskframework.NewTaskExecutor()
+	te.Append(&slotUnit{name: "a", slots: slots, mutex: &sync.Mutex{}, order: &order, runs: &runs}, 0)
+	te.Execute()
+	if len(order) != 1 || runs < 2 {
+		t.Fatalf("order = %v, runs = %d", order, runs)
+	}
+}
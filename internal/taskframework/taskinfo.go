@@ -18,6 +18,7 @@ type (
 		id       string
 		maxRetry int
 		retry    int
+		orderKey TaskOrderKey // 调度顺序，执行器设置了执行顺序时生效
 	}
 
 	TaskInfoItem struct {
@@ -0,0 +1,280 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package utils
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+const (
+	// RegexpPatternPrefix 正则表达式规则前缀，没有该前缀的规则作为glob通配符处理
+	RegexpPatternPrefix = "re:"
+)
+
+type (
+	// PathFilter 文件过滤规则，对文件和文件夹的相对路径进行匹配。所有方法都支持nil调用，nil代表不过滤
+	PathFilter struct {
+		includes []*pathPattern
+		excludes []*pathPattern
+	}
+
+	// PathPriority 按规则设置文件的优先级，排在前面的规则优先级更高。所有方法都支持nil调用，nil代表不设置优先级
+	PathPriority struct {
+		patterns []*pathPattern
+	}
+
+	pathPattern struct {
+		raw       string
+		re        *regexp.Regexp
+		dirOnly   bool // 以/结尾的glob规则只匹配文件夹
+		matchPath bool // 包含/的glob规则匹配完整相对路径，否则只匹配文件名
+		isRegexp  bool
+	}
+)
+
+// NewPathFilter 创建文件过滤规则，规则都为空返回nil。
+// glob规则支持 * ? [] 以及匹配多级目录的 **，例如：*.tmp、node_modules/、src/**/*.go；
+// re: 开头的规则为正则表达式，匹配文件名或者相对路径，例如：re:^\.~.*$
+func NewPathFilter(includes, excludes []string) (*PathFilter, error) {
+	f := &PathFilter{}
+	for _, p := range includes {
+		if pp, err := parsePathPattern(p); err != nil {
+			return nil, err
+		} else if pp != nil {
+			f.includes = append(f.includes, pp)
+		}
+	}
+	for _, p := range excludes {
+		if pp, err := parsePathPattern(p); err != nil {
+			return nil, err
+		} else if pp != nil {
+			f.excludes = append(f.excludes, pp)
+		}
+	}
+	if len(f.includes) == 0 && len(f.excludes) == 0 {
+		return nil, nil
+	}
+	return f, nil
+}
+
+// SplitPatterns 拆分逗号分隔的规则列表，用于配置文件中保存的规则
+func SplitPatterns(patterns string) []string {
+	result := []string{}
+	for _, p := range strings.Split(patterns, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+func parsePathPattern(p string) (*pathPattern, error) {
+	p = strings.TrimSpace(p)
+	if p == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(p, RegexpPatternPrefix) {
+		re, err := regexp.Compile(strings.TrimPrefix(p, RegexpPatternPrefix))
+		if err != nil {
+			return nil, fmt.Errorf("正则表达式规则错误 %s: %s", p, err)
+		}
+		return &pathPattern{raw: p, re: re, isRegexp: true}, nil
+	}
+
+	pp := &pathPattern{raw: p}
+	glob := strings.ReplaceAll(p, "\\", "/")
+	if strings.HasSuffix(glob, "/") {
+		pp.dirOnly = true
+		glob = strings.TrimRight(glob, "/")
+	}
+	if strings.Contains(glob, "/") {
+		pp.matchPath = true
+		glob = strings.TrimPrefix(glob, "/")
+	}
+	re, err := regexp.Compile(globToRegexp(glob))
+	if err != nil {
+		return nil, fmt.Errorf("通配符规则错误 %s: %s", p, err)
+	}
+	pp.re = re
+	return pp, nil
+}
+
+// globToRegexp 把glob通配符转换为正则表达式
+func globToRegexp(glob string) string {
+	var sb strings.Builder
+	sb.WriteString("^")
+	runes := []rune(glob)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch c {
+		case '*':
+			if i+1 < len(runes) && runes[i+1] == '*' {
+				i++
+				if i+1 < len(runes) && runes[i+1] == '/' {
+					// **/ 匹配零级或者多级目录
+					i++
+					sb.WriteString("(.*/)?")
+				} else {
+					sb.WriteString(".*")
+				}
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		case '[':
+			j := i + 1
+			for j < len(runes) && runes[j] != ']' {
+				j++
+			}
+			if j >= len(runes) {
+				sb.WriteString(regexp.QuoteMeta(string(c)))
+				continue
+			}
+			class := string(runes[i+1 : j])
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + class + "]")
+			i = j
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	return sb.String()
+}
+
+func (pp *pathPattern) match(relPath string, isDir bool) bool {
+	if pp.dirOnly && !isDir {
+		return false
+	}
+	name := path.Base(relPath)
+	if pp.isRegexp {
+		return pp.re.MatchString(name) || pp.re.MatchString(relPath)
+	}
+	if pp.matchPath {
+		return pp.re.MatchString(relPath)
+	}
+	return pp.re.MatchString(name)
+}
+
+// normalizeRelPath 统一为 / 分隔且不以 / 开头的相对路径
+func normalizeRelPath(relPath string) string {
+	return strings.Trim(path.Clean("/"+strings.ReplaceAll(relPath, "\\", "/")), "/")
+}
+
+// IsExcluded 文件或者文件夹是否命中排除规则，返回命中的规则
+func (f *PathFilter) IsExcluded(relPath string, isDir bool) (bool, string) {
+	if f == nil {
+		return false, ""
+	}
+	relPath = normalizeRelPath(relPath)
+	for _, pp := range f.excludes {
+		if pp.match(relPath, isDir) {
+			return true, pp.raw
+		}
+	}
+	return false, ""
+}
+
+// IsIncluded 文件是否命中包含规则，没有包含规则时所有文件都命中。
+// 文件所在的任意一级文件夹命中包含规则时，文件夹下的所有文件都命中
+func (f *PathFilter) IsIncluded(relPath string) bool {
+	if f == nil || len(f.includes) == 0 {
+		return true
+	}
+	relPath = normalizeRelPath(relPath)
+	for _, pp := range f.includes {
+		if pp.match(relPath, false) {
+			return true
+		}
+	}
+	for dir := path.Dir(relPath); dir != "." && dir != "/" && dir != ""; dir = path.Dir(dir) {
+		for _, pp := range f.includes {
+			if pp.match(dir, true) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Accept 文件或者文件夹是否需要处理。文件夹只检查排除规则，保证包含规则可以匹配到子文件夹中的文件
+func (f *PathFilter) Accept(relPath string, isDir bool) bool {
+	if excluded, _ := f.IsExcluded(relPath, isDir); excluded {
+		return false
+	}
+	if isDir {
+		return true
+	}
+	return f.IsIncluded(relPath)
+}
+
+// AcceptItem 文件或者文件夹作为整体是否需要处理，用于无法展开文件夹内容的场景，例如转存分享。
+// 和 Accept 不同，文件夹本身需要命中包含规则
+func (f *PathFilter) AcceptItem(relPath string, isDir bool) bool {
+	if excluded, _ := f.IsExcluded(relPath, isDir); excluded {
+		return false
+	}
+	if f == nil || len(f.includes) == 0 {
+		return true
+	}
+	relPath = normalizeRelPath(relPath)
+	for _, pp := range f.includes {
+		if pp.match(relPath, isDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewPathPriority 创建优先级规则，规则格式和 NewPathFilter 相同，规则为空返回nil
+func NewPathPriority(patterns []string) (*PathPriority, error) {
+	p := &PathPriority{}
+	for _, raw := range patterns {
+		if pp, err := parsePathPattern(raw); err != nil {
+			return nil, err
+		} else if pp != nil {
+			p.patterns = append(p.patterns, pp)
+		}
+	}
+	if len(p.patterns) == 0 {
+		return nil, nil
+	}
+	return p, nil
+}
+
+// Priority 文件的优先级，命中第一条规则的优先级最高，没有命中任何规则返回0。
+// 文件所在的任意一级文件夹命中规则时，文件夹下的所有文件都命中
+func (p *PathPriority) Priority(relPath string) int {
+	if p == nil {
+		return 0
+	}
+	relPath = normalizeRelPath(relPath)
+	for k, pp := range p.patterns {
+		if pp.match(relPath, false) {
+			return len(p.patterns) - k
+		}
+		for dir := path.Dir(relPath); dir != "." && dir != "/" && dir != ""; dir = path.Dir(dir) {
+			if pp.match(dir, true) {
+				return len(p.patterns) - k
+			}
+		}
+	}
+	return 0
+}
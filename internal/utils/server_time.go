@@ -0,0 +1,84 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// minClockSkew 服务器Date头只精确到秒，小于该值的偏差忽略
+	minClockSkew = 2 * time.Second
+
+	// WarnClockSkew 超过该值的时钟偏差需要提示用户校准系统时间
+	WarnClockSkew = 30 * time.Second
+)
+
+var (
+	// serverTimeOffset 服务器时间 - 本地时间，单位：纳秒
+	serverTimeOffset int64
+)
+
+// ServerTimeOffset 获取服务器时间和本地时间的偏差，正数代表本地时间比服务器慢
+func ServerTimeOffset() time.Duration {
+	return time.Duration(atomic.LoadInt64(&serverTimeOffset))
+}
+
+// SetServerTimeOffset 设置服务器时间和本地时间的偏差
+func SetServerTimeOffset(offset time.Duration) {
+	atomic.StoreInt64(&serverTimeOffset, int64(offset))
+}
+
+// ServerNow 获取补偿时钟偏差后的当前时间，用于判断链接签名等是否过期
+func ServerNow() time.Time {
+	return time.Now().Add(ServerTimeOffset())
+}
+
+// UpdateServerTimeByHeader 根据响应的Date头校准服务器时间，requestStart为发起请求的本地时间，
+// 耗时较长的请求可以直接传入收到响应的时间。返回是否成功解析服务器时间
+func UpdateServerTimeByHeader(header http.Header, requestStart time.Time) bool {
+	if header == nil {
+		return false
+	}
+	serverTime, err := http.ParseTime(header.Get("Date"))
+	if err != nil {
+		return false
+	}
+	// 以请求往返的中间时刻作为服务器返回Date的本地时间
+	now := time.Now()
+	localTime := requestStart.Add(now.Sub(requestStart) / 2)
+	offset := serverTime.Sub(localTime)
+	if offset > -minClockSkew && offset < minClockSkew {
+		offset = 0
+	}
+	SetServerTimeOffset(offset)
+	return true
+}
+
+// ClockSkewTip 时钟偏差过大时返回诊断提示，否则返回空字符串
+func ClockSkewTip() string {
+	offset := ServerTimeOffset()
+	if offset > -WarnClockSkew && offset < WarnClockSkew {
+		return ""
+	}
+	direction := "慢"
+	if offset < 0 {
+		direction = "快"
+		offset = -offset
+	}
+	return fmt.Sprintf("本地时间比服务器时间%s了%d秒，可能导致上传、下载链接签名校验失败，请校准系统时间（例如开启NTP自动同步）", direction, int64(offset.Seconds()))
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"fmt"
+	"net/http"
 	"testing"
 	"time"
 )
@@ -66,3 +67,111 @@ func TestParseVersionNum3(t *testing.T) {
 func TestParseVersionNum4(t *testing.T) {
 	fmt.Println(ParseVersionNum("v"))
 }
+
+func TestUpdateServerTimeByHeader(t *testing.T) {
+	defer SetServerTimeOffset(0)
+	header := http.Header{}
+	header.Set("Date", time.Now().Add(10*time.Minute).UTC().Format(http.TimeFormat))
+	if !UpdateServerTimeByHeader(header, time.Now()) {
+		t.Fatal("parse date header failed")
+	}
+	offset := ServerTimeOffset()
+	if offset < 9*time.Minute || offset > 11*time.Minute {
+		t.Errorf("unexpected offset: %s", offset)
+	}
+	if ClockSkewTip() == "" {
+		t.Error("expected clock skew tip")
+	}
+}
+
+func TestPathFilter(t *testing.T) {
+	f, err := NewPathFilter(nil, []string{"node_modules/", "*.tmp", ".DS_Store", "re:^~\\$"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		relPath string
+		isDir   bool
+		accept  bool
+	}{
+		{"proj/node_modules", true, false},
+		{"proj/node_modules", false, true},
+		{"proj/a.tmp", false, false},
+		{"proj/.DS_Store", false, false},
+		{"proj/~$doc.docx", false, false},
+		{"proj/src/main.go", false, true},
+	}
+	for _, c := range cases {
+		if f.Accept(c.relPath, c.isDir) != c.accept {
+			t.Errorf("exclude %s(dir=%v) should be %v", c.relPath, c.isDir, c.accept)
+		}
+	}
+
+	f, _ = NewPathFilter([]string{"src/**/*.go", "docs/", "*.md"}, nil)
+	cases = []struct {
+		relPath string
+		isDir   bool
+		accept  bool
+	}{
+		{"src/main.go", false, true},
+		{"src/a/b/c.go", false, true},
+		{"src/a/b/c.js", false, false},
+		{"docs/img/logo.png", false, true},
+		{"README.md", false, true},
+		{"other", true, true},
+	}
+	for _, c := range cases {
+		if f.Accept(c.relPath, c.isDir) != c.accept {
+			t.Errorf("include %s(dir=%v) should be %v", c.relPath, c.isDir, c.accept)
+		}
+	}
+
+	f, _ = NewPathFilter([]string{"*.mkv", "字幕/"}, []string{"*预告*"})
+	cases = []struct {
+		relPath string
+		isDir   bool
+		accept  bool
+	}{
+		{"电影.mkv", false, true},
+		{"电影预告.mkv", false, false},
+		{"字幕", true, true},
+		{"花絮", true, false},
+		{"说明.txt", false, false},
+	}
+	for _, c := range cases {
+		if f.AcceptItem(c.relPath, c.isDir) != c.accept {
+			t.Errorf("item %s(dir=%v) should be %v", c.relPath, c.isDir, c.accept)
+		}
+	}
+
+	if f, _ = NewPathFilter(nil, []string{" "}); f != nil {
+		t.Error("empty patterns should return nil filter")
+	}
+	if _, err = NewPathFilter([]string{"re:("}, nil); err == nil {
+		t.Error("invalid regexp should return error")
+	}
+	if !f.Accept("any/file", false) {
+		t.Error("nil filter should accept all")
+	}
+}
+
+func TestPathPriority(t *testing.T) {
+	p, err := NewPathPriority([]string{"urgent/", "*.doc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]int{
+		"urgent/a/b.txt": 2,
+		"urgent/x.doc":   2,
+		"docs/x.doc":     1,
+		"docs/x.txt":     0,
+	}
+	for relPath, want := range cases {
+		if got := p.Priority(relPath); got != want {
+			t.Errorf("priority of %s: %d, want %d", relPath, got, want)
+		}
+	}
+	if p, _ = NewPathPriority(nil); p != nil || p.Priority("a") != 0 {
+		t.Error("empty patterns should return nil priority")
+	}
+}
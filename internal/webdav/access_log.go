@@ -0,0 +1,166 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package webdav
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+type (
+	// ClientTraffic 单个客户端的流量统计
+	ClientTraffic struct {
+		Client        string    // 客户端IP
+		Requests      int64     // 请求次数
+		BytesSent     int64     // 发送给客户端的数据量，即客户端下载的数据量
+		BytesReceived int64     // 从客户端接收的数据量，即客户端上传的数据量
+		LastAccess    time.Time // 最后访问时间
+	}
+
+	// AccessLogger 记录访问日志，同时按客户端IP统计流量
+	AccessLogger struct {
+		out     io.Writer
+		clients map[string]*ClientTraffic
+		mutex   sync.Mutex
+	}
+
+	// countingResponseWriter 记录响应状态码以及发送的数据量
+	countingResponseWriter struct {
+		http.ResponseWriter
+		status int
+		bytes  int64
+	}
+
+	// countingReadCloser 记录读取的请求数据量
+	countingReadCloser struct {
+		io.ReadCloser
+		bytes int64
+	}
+)
+
+// NewAccessLogger 创建访问日志，out 为nil时只统计流量，不输出日志
+func NewAccessLogger(out io.Writer) *AccessLogger {
+	return &AccessLogger{
+		out:     out,
+		clients: map[string]*ClientTraffic{},
+	}
+}
+
+// Handler 包装 http.Handler，每个请求结束后输出一行访问日志。
+// 格式为 Common Log Format 后面追加接收的数据量以及耗时：
+// 客户端IP - 用户名 [时间] "方法 路径 协议" 状态码 发送字节数 接收字节数 耗时(秒)
+func (al *AccessLogger) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		cw := &countingResponseWriter{ResponseWriter: w}
+		var body *countingReadCloser
+		if r.Body != nil && r.Body != http.NoBody {
+			body = &countingReadCloser{ReadCloser: r.Body}
+			r.Body = body
+		}
+		next.ServeHTTP(cw, r)
+
+		if cw.status == 0 {
+			cw.status = http.StatusOK
+		}
+		var received int64
+		if body != nil {
+			received = body.bytes
+		}
+		client := clientIP(r.RemoteAddr)
+		al.record(client, cw.bytes, received, start)
+
+		if al.out == nil {
+			return
+		}
+		username, _, ok := r.BasicAuth()
+		if !ok || username == "" {
+			username = "-"
+		}
+		line := fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %d %d %.3f\n",
+			client, username, start.Format("02/Jan/2006:15:04:05 -0700"),
+			r.Method, r.URL.RequestURI(), r.Proto, cw.status, cw.bytes, received, time.Since(start).Seconds())
+		al.mutex.Lock()
+		io.WriteString(al.out, line)
+		al.mutex.Unlock()
+	})
+}
+
+func (al *AccessLogger) record(client string, sent, received int64, t time.Time) {
+	al.mutex.Lock()
+	defer al.mutex.Unlock()
+	ct := al.clients[client]
+	if ct == nil {
+		ct = &ClientTraffic{Client: client}
+		al.clients[client] = ct
+	}
+	ct.Requests++
+	ct.BytesSent += sent
+	ct.BytesReceived += received
+	ct.LastAccess = t
+}
+
+// Traffic 返回每个客户端的流量统计，按发送的数据量从大到小排序
+func (al *AccessLogger) Traffic() []*ClientTraffic {
+	al.mutex.Lock()
+	defer al.mutex.Unlock()
+	list := make([]*ClientTraffic, 0, len(al.clients))
+	for _, ct := range al.clients {
+		c := *ct
+		list = append(list, &c)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].BytesSent != list[j].BytesSent {
+			return list[i].BytesSent > list[j].BytesSent
+		}
+		return list[i].Client < list[j].Client
+	})
+	return list
+}
+
+// clientIP 从 RemoteAddr 中取出客户端IP
+func clientIP(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
+
+func (w *countingResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *countingResponseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (r *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.bytes += int64(n)
+	return n, err
+}
@@ -0,0 +1,89 @@
+package webdav
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestAccessLogger(t *testing.T) {
+	out := &bytes.Buffer{}
+	al := NewAccessLogger(out)
+	handler := al.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			io.Copy(io.Discard, r.Body)
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodGet:
+			w.Write([]byte("hello world"))
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+
+	serve := func(method, target, remoteAddr, body string, user string) {
+		var r *http.Request
+		if body != "" {
+			r = httptest.NewRequest(method, target, strings.NewReader(body))
+		} else {
+			r = httptest.NewRequest(method, target, nil)
+		}
+		r.RemoteAddr = remoteAddr
+		if user != "" {
+			r.SetBasicAuth(user, "password")
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	serve(http.MethodGet, "/a.txt?x=1", "192.168.1.2:5000", "", "admin")
+	serve(http.MethodGet, "/a.txt", "192.168.1.2:5001", "", "admin")
+	serve(http.MethodPut, "/b.txt", "192.168.1.3:6000", "12345", "guest")
+	serve("PROPFIND", "/", "192.168.1.4:7000", "", "")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("log lines: %v", lines)
+	}
+	re := regexp.MustCompile(`^192\.168\.1\.2 - admin \[[^\]]+\] "GET /a\.txt\?x=1 HTTP/1\.1" 200 11 0 \d+\.\d{3}$`)
+	if !re.MatchString(lines[0]) {
+		t.Errorf("unexpected log line: %s", lines[0])
+	}
+	if !strings.Contains(lines[2], `"PUT /b.txt HTTP/1.1" 201 0 5 `) {
+		t.Errorf("unexpected log line: %s", lines[2])
+	}
+	// 没有用户名的请求，例如认证失败
+	if !strings.HasPrefix(lines[3], "192.168.1.4 - - [") || !strings.Contains(lines[3], `" 401 0 0 `) {
+		t.Errorf("unexpected log line: %s", lines[3])
+	}
+
+	// 按客户端IP统计，发送数据量多的排在前面
+	traffic := al.Traffic()
+	if len(traffic) != 3 {
+		t.Fatalf("traffic: %d", len(traffic))
+	}
+	if c := traffic[0]; c.Client != "192.168.1.2" || c.Requests != 2 || c.BytesSent != 22 || c.BytesReceived != 0 {
+		t.Errorf("unexpected traffic: %+v", c)
+	}
+	if c := traffic[1]; c.Client != "192.168.1.3" || c.Requests != 1 || c.BytesReceived != 5 {
+		t.Errorf("unexpected traffic: %+v", c)
+	}
+	// 返回的是副本
+	traffic[0].Requests = 100
+	if al.Traffic()[0].Requests != 2 {
+		t.Error("traffic should be copied")
+	}
+}
+
+func TestAccessLoggerWithoutOutput(t *testing.T) {
+	al := NewAccessLogger(nil)
+	handler := al.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "[::1]:8080"
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	if traffic := al.Traffic(); len(traffic) != 1 || traffic[0].Client != "::1" {
+		t.Fatalf("traffic: %+v", traffic)
+	}
+}
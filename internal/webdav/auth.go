@@ -0,0 +1,74 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package webdav
+
+import (
+	"net/http"
+
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/library-go/logger"
+)
+
+// writeMethods WebDAV中会修改网盘数据的请求方法
+var writeMethods = map[string]bool{
+	http.MethodPut:    true,
+	http.MethodDelete: true,
+	"MKCOL":           true,
+	"MOVE":            true,
+	"COPY":            true,
+	"PROPPATCH":       true,
+	"LOCK":            true,
+	"UNLOCK":          true,
+}
+
+// IsWriteMethod 是否是写操作的请求方法
+func IsWriteMethod(method string) bool {
+	return writeMethods[method]
+}
+
+// SecurityHandler 为WebDAV服务增加用户认证以及只读控制
+func SecurityHandler(cfg *config.WebdavConfig, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(cfg.Users) > 0 {
+			username, password, ok := r.BasicAuth()
+			if !ok || !cfg.CheckUser(username, password) {
+				logger.Verbosef("webdav auth failed: %s %s\n", r.RemoteAddr, username)
+				w.Header().Set("WWW-Authenticate", `Basic realm="aliyunpan"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		if cfg.ReadOnly && IsWriteMethod(r.Method) {
+			http.Error(w, "Forbidden: read only mode", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ListenAndServe 按照配置启动服务，配置了证书则使用HTTPS。accessLog 不为nil时记录所有请求，包括认证失败的请求
+func ListenAndServe(cfg *config.WebdavConfig, handler http.Handler, accessLog *AccessLogger) error {
+	handler = SecurityHandler(cfg, handler)
+	if accessLog != nil {
+		handler = accessLog.Handler(handler)
+	}
+	server := &http.Server{
+		Addr:    cfg.ListenAddr(),
+		Handler: handler,
+	}
+	if cfg.IsTlsEnabled() {
+		return server.ListenAndServeTLS(cfg.TlsCertFile, cfg.TlsKeyFile)
+	}
+	return server.ListenAndServe()
+}
@@ -0,0 +1,365 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package webdav
+
+import (
+	"container/list"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/file/downloader"
+	"github.com/tickstep/library-go/converter"
+	"github.com/tickstep/library-go/logger"
+	"github.com/tickstep/library-go/requester"
+)
+
+const (
+	// DefaultBlockSize 默认读取以及预读的分片大小
+	DefaultBlockSize = 4 * converter.MB
+	// DefaultBlockCacheSize 默认分片读缓存目录大小限制
+	DefaultBlockCacheSize = 1 * converter.GB
+
+	// blockFileSuffix 缓存分片文件后缀，下载中的分片使用临时后缀，重启时会被清理
+	blockFileSuffix    = ".blk"
+	blockFileTmpSuffix = ".tmp"
+)
+
+type (
+	// BlockCache 网盘文件的分片读缓存。
+	// 读取文件时按分片大小从网盘下载对应的分片保存到缓存目录，并预读下一个分片；缓存超过大小限制时淘汰最久未使用的分片
+	BlockCache struct {
+		panClient *config.PanClient
+		client    *requester.HTTPClient
+		dir       string
+		blockSize int64
+		maxSize   int64 // 缓存目录大小限制，0代表不限制
+
+		lru        *list.List               // 最近使用的分片在前
+		blocks     map[string]*list.Element // 分片文件名 => lru元素
+		size       int64
+		urls       map[string]string      // 文件 => 下载链接
+		fetchLocks map[string]*sync.Mutex // 同一个分片同时只下载一次
+		prefetch   map[string]bool        // 正在预读的分片
+		mutex      sync.Mutex
+	}
+
+	blockEntry struct {
+		name string
+		size int64
+	}
+)
+
+// NewBlockCache 创建分片读缓存，缓存目录中已有的分片会继续使用
+func NewBlockCache(panClient *config.PanClient, dir string, blockSize, maxSize int64) (*BlockCache, error) {
+	if blockSize <= 0 {
+		return nil, fmt.Errorf("分片大小必须大于0")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	client := requester.NewHTTPClient()
+	client.SetTimeout(5 * time.Minute)
+	c := &BlockCache{
+		panClient:  panClient,
+		client:     client,
+		dir:        dir,
+		blockSize:  blockSize,
+		maxSize:    maxSize,
+		lru:        list.New(),
+		blocks:     map[string]*list.Element{},
+		urls:       map[string]string{},
+		fetchLocks: map[string]*sync.Mutex{},
+		prefetch:   map[string]bool{},
+	}
+	c.load()
+	return c, nil
+}
+
+// load 加载缓存目录中已有的分片，按修改时间恢复使用顺序
+func (c *BlockCache) load() {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return
+	}
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), blockFileTmpSuffix) {
+			os.Remove(filepath.Join(c.dir, e.Name()))
+			continue
+		}
+		if !strings.HasSuffix(e.Name(), blockFileSuffix) {
+			continue
+		}
+		if info, err := e.Info(); err == nil {
+			infos = append(infos, info)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ModTime().After(infos[j].ModTime())
+	})
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, info := range infos {
+		c.blocks[info.Name()] = c.lru.PushBack(&blockEntry{name: info.Name(), size: info.Size()})
+		c.size += info.Size()
+	}
+	c.evict()
+}
+
+// blockName 分片文件名，文件内容变化或者分片大小变化后不会使用旧的分片
+func (c *BlockCache) blockName(file *aliyunpan.FileEntity, index int64) string {
+	return fmt.Sprintf("%s_%s_%s_%d_%d%s", file.DriveId, file.FileId, file.ContentHash, c.blockSize, index, blockFileSuffix)
+}
+
+// ReadAt 读取网盘文件指定位置的数据，没有缓存的分片会先下载
+func (c *BlockCache) ReadAt(file *aliyunpan.FileEntity, p []byte, off int64) (int, error) {
+	if off >= file.FileSize {
+		return 0, io.EOF
+	}
+	if end := file.FileSize - off; int64(len(p)) > end {
+		p = p[:end]
+	}
+	n := 0
+	lastIndex := int64(0)
+	for n < len(p) {
+		pos := off + int64(n)
+		index := pos / c.blockSize
+		lastIndex = index
+		f, err := c.openBlock(file, index)
+		if err != nil {
+			return n, err
+		}
+		m, err := f.ReadAt(p[n:], pos-index*c.blockSize)
+		f.Close()
+		n += m
+		if err != nil && err != io.EOF {
+			return n, err
+		}
+		if m == 0 {
+			return n, io.ErrUnexpectedEOF
+		}
+	}
+	c.readAhead(file, lastIndex+1)
+	return n, nil
+}
+
+// openBlock 打开分片文件，分片刚好被淘汰时重新下载
+func (c *BlockCache) openBlock(file *aliyunpan.FileEntity, index int64) (f *os.File, err error) {
+	for i := 0; i < 2; i++ {
+		var blockPath string
+		if blockPath, err = c.block(file, index); err != nil {
+			return nil, err
+		}
+		if f, err = os.Open(blockPath); err == nil || !os.IsNotExist(err) {
+			return f, err
+		}
+		c.remove(filepath.Base(blockPath))
+	}
+	return nil, err
+}
+
+// block 返回分片的本地文件路径，没有缓存则下载
+func (c *BlockCache) block(file *aliyunpan.FileEntity, index int64) (string, error) {
+	name := c.blockName(file, index)
+	blockPath := filepath.Join(c.dir, name)
+	lock := c.fetchLock(name)
+	lock.Lock()
+	defer lock.Unlock()
+	if c.touch(name) {
+		if _, err := os.Stat(blockPath); err == nil {
+			return blockPath, nil
+		}
+		c.remove(name)
+	}
+	if err := c.fetch(file, index, blockPath); err != nil {
+		return "", err
+	}
+	return blockPath, nil
+}
+
+// readAhead 后台预读下一个分片
+func (c *BlockCache) readAhead(file *aliyunpan.FileEntity, index int64) {
+	if index*c.blockSize >= file.FileSize {
+		return
+	}
+	name := c.blockName(file, index)
+	c.mutex.Lock()
+	if _, ok := c.blocks[name]; ok || c.prefetch[name] {
+		c.mutex.Unlock()
+		return
+	}
+	c.prefetch[name] = true
+	c.mutex.Unlock()
+	go func() {
+		defer func() {
+			c.mutex.Lock()
+			delete(c.prefetch, name)
+			c.mutex.Unlock()
+		}()
+		if _, err := c.block(file, index); err != nil {
+			logger.Verbosef("预读分片失败: %s %d, %s\n", file.Path, index, err)
+		}
+	}()
+}
+
+func (c *BlockCache) fetchLock(name string) *sync.Mutex {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	l, ok := c.fetchLocks[name]
+	if !ok {
+		l = &sync.Mutex{}
+		c.fetchLocks[name] = l
+	}
+	return l
+}
+
+// touch 标记分片最近使用，返回分片是否已经缓存
+func (c *BlockCache) touch(name string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	e, ok := c.blocks[name]
+	if ok {
+		c.lru.MoveToFront(e)
+	}
+	return ok
+}
+
+func (c *BlockCache) remove(name string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if e, ok := c.blocks[name]; ok {
+		c.size -= e.Value.(*blockEntry).size
+		c.lru.Remove(e)
+		delete(c.blocks, name)
+	}
+}
+
+// add 记录新下载的分片，超过缓存大小限制时淘汰最久未使用的分片
+func (c *BlockCache) add(name string, size int64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.blocks[name] = c.lru.PushFront(&blockEntry{name: name, size: size})
+	c.size += size
+	c.evict()
+}
+
+// evict 淘汰分片直到缓存大小不超过限制，至少保留最近使用的一个分片。调用方需持有锁
+func (c *BlockCache) evict() {
+	if c.maxSize <= 0 {
+		return
+	}
+	for c.size > c.maxSize && c.lru.Len() > 1 {
+		e := c.lru.Back()
+		entry := e.Value.(*blockEntry)
+		c.lru.Remove(e)
+		delete(c.blocks, entry.name)
+		c.size -= entry.size
+		os.Remove(filepath.Join(c.dir, entry.name))
+	}
+}
+
+// downloadUrl 获取文件的下载链接，链接过期后重新获取
+func (c *BlockCache) downloadUrl(file *aliyunpan.FileEntity, refresh bool) (string, error) {
+	key := file.DriveId + "_" + file.FileId
+	c.mutex.Lock()
+	u, ok := c.urls[key]
+	c.mutex.Unlock()
+	if ok && !refresh && !downloader.IsUrlExpired(u) {
+		return u, nil
+	}
+	durl, apierr := c.panClient.OpenapiPanClient().GetFileDownloadUrl(&aliyunpan.GetFileDownloadUrlParam{
+		DriveId: file.DriveId,
+		FileId:  file.FileId,
+	})
+	if apierr != nil {
+		return "", apierr
+	}
+	if durl == nil || durl.Url == "" || strings.HasPrefix(durl.Url, aliyunpan.IllegalDownloadUrlPrefix) {
+		return "", downloader.ErrFileDownloadForbidden
+	}
+	c.mutex.Lock()
+	c.urls[key] = durl.Url
+	c.mutex.Unlock()
+	return durl.Url, nil
+}
+
+// fetch 下载分片到缓存目录，下载链接失效时刷新链接重试一次
+func (c *BlockCache) fetch(file *aliyunpan.FileEntity, index int64, blockPath string) error {
+	begin := index * c.blockSize
+	end := begin + c.blockSize
+	if end > file.FileSize {
+		end = file.FileSize
+	}
+	var err error
+	for i := 0; i < 2; i++ {
+		var durl string
+		if durl, err = c.downloadUrl(file, i > 0); err != nil {
+			return err
+		}
+		var data []byte
+		if data, err = c.fetchRange(durl, begin, end); err == nil {
+			tmpPath := blockPath + blockFileTmpSuffix
+			if err = os.WriteFile(tmpPath, data, 0644); err != nil {
+				return err
+			}
+			if err = os.Rename(tmpPath, blockPath); err != nil {
+				os.Remove(tmpPath)
+				return err
+			}
+			c.add(filepath.Base(blockPath), int64(len(data)))
+			return nil
+		}
+		logger.Verbosef("下载分片失败: %s %d, %s\n", file.Path, index, err)
+	}
+	return err
+}
+
+// fetchRange 下载文件 [begin, end) 范围的数据
+func (c *BlockCache) fetchRange(durl string, begin, end int64) ([]byte, error) {
+	var resp *http.Response
+	var err error
+	apierr := c.panClient.OpenapiPanClient().DownloadFileData(durl, aliyunpan.FileDownloadRange{
+		Offset: begin,
+		End:    end - 1,
+	}, func(httpMethod, fullUrl string, headers map[string]string) (*http.Response, error) {
+		resp, err = c.client.Req(httpMethod, fullUrl, nil, headers)
+		return resp, err
+	})
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if apierr != nil {
+		return nil, apierr
+	}
+	if resp.StatusCode != http.StatusPartialContent && !(resp.StatusCode == http.StatusOK && begin == 0) {
+		return nil, fmt.Errorf("下载分片失败, 状态码: %d", resp.StatusCode)
+	}
+	data := make([]byte, end-begin)
+	if _, err = io.ReadFull(resp.Body, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
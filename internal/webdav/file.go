@@ -0,0 +1,287 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package webdav
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/utils"
+	"golang.org/x/net/webdav"
+)
+
+var (
+	errIsDirectory = errors.New("is a directory")
+	errWriteOnly   = errors.New("file is write only")
+)
+
+type (
+	// fileInfo 网盘文件信息
+	fileInfo struct {
+		name string
+		file *aliyunpan.FileEntity // 虚拟目录为nil
+	}
+
+	// dirFile 网盘目录，目录列表在第一次Readdir时获取
+	dirFile struct {
+		fs      *PanFileSystem
+		drive   *config.DriveInfo
+		panPath string
+		info    os.FileInfo
+		entries []os.FileInfo
+		loaded  bool
+	}
+
+	// readFile 只读的网盘文件，通过分片读缓存按需下载读取位置所在的分片，只查询文件信息时不会下载
+	readFile struct {
+		fs     *PanFileSystem
+		file   *aliyunpan.FileEntity
+		info   os.FileInfo
+		offset int64
+	}
+
+	// writeFile 写入的文件先保存到本地临时文件，关闭时上传到网盘
+	writeFile struct {
+		fs      *PanFileSystem
+		driveId string
+		panPath string
+		temp    *os.File
+	}
+)
+
+func newDirInfo(name string) *fileInfo {
+	return &fileInfo{name: name}
+}
+
+func newFileInfo(f *aliyunpan.FileEntity) *fileInfo {
+	return &fileInfo{name: f.FileName, file: f}
+}
+
+func (fi *fileInfo) Name() string {
+	return fi.name
+}
+
+func (fi *fileInfo) Size() int64 {
+	if fi.file == nil {
+		return 0
+	}
+	return fi.file.FileSize
+}
+
+func (fi *fileInfo) Mode() os.FileMode {
+	if fi.IsDir() {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+
+func (fi *fileInfo) ModTime() time.Time {
+	if fi.file == nil {
+		return time.Now()
+	}
+	return utils.ParseTimeStr(fi.file.UpdatedAt)
+}
+
+func (fi *fileInfo) IsDir() bool {
+	return fi.file == nil || fi.file.IsFolder()
+}
+
+// Sys 返回网盘文件详情 *aliyunpan.FileEntity，虚拟目录返回nil
+func (fi *fileInfo) Sys() interface{} {
+	if fi.file == nil {
+		return nil
+	}
+	return fi.file
+}
+
+// ContentType 根据扩展名判断文件类型，避免列目录时为了判断类型下载文件
+func (fi *fileInfo) ContentType(ctx context.Context) (string, error) {
+	if ctype := mime.TypeByExtension(path.Ext(fi.name)); ctype != "" {
+		return ctype, nil
+	}
+	return "application/octet-stream", nil
+}
+
+// ETag 使用文件内容Hash作为ETag
+func (fi *fileInfo) ETag(ctx context.Context) (string, error) {
+	if fi.file == nil || fi.file.ContentHash == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return `"` + fi.file.ContentHash + `"`, nil
+}
+
+func (df *dirFile) Readdir(count int) ([]os.FileInfo, error) {
+	if !df.loaded {
+		entries, err := df.fs.readDir(df.drive, df.panPath)
+		if err != nil {
+			return nil, err
+		}
+		df.entries = entries
+		df.loaded = true
+	}
+	if count <= 0 {
+		entries := df.entries
+		df.entries = nil
+		return entries, nil
+	}
+	if len(df.entries) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(df.entries) {
+		count = len(df.entries)
+	}
+	entries := df.entries[:count]
+	df.entries = df.entries[count:]
+	return entries, nil
+}
+
+func (df *dirFile) Stat() (os.FileInfo, error) {
+	return df.info, nil
+}
+
+func (df *dirFile) Read(p []byte) (int, error) {
+	return 0, errIsDirectory
+}
+
+func (df *dirFile) Seek(offset int64, whence int) (int64, error) {
+	return 0, nil
+}
+
+func (df *dirFile) Write(p []byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+func (df *dirFile) Close() error {
+	return nil
+}
+
+func (rf *readFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, os.ErrInvalid
+}
+
+func (rf *readFile) Stat() (os.FileInfo, error) {
+	return rf.info, nil
+}
+
+func (rf *readFile) Read(p []byte) (int, error) {
+	n, err := rf.ReadAt(p, rf.offset)
+	rf.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// ReadAt 使用Range请求读取指定位置的数据，可以并发调用
+func (rf *readFile) ReadAt(p []byte, off int64) (int, error) {
+	n, err := rf.fs.blocks.ReadAt(rf.file, p, off)
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// Seek 只记录读取位置，HEAD请求以及只获取文件大小时不需要下载文件
+func (rf *readFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += rf.offset
+	case io.SeekEnd:
+		offset += rf.file.FileSize
+	default:
+		return 0, os.ErrInvalid
+	}
+	if offset < 0 {
+		return 0, os.ErrInvalid
+	}
+	rf.offset = offset
+	return offset, nil
+}
+
+func (rf *readFile) Write(p []byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+func (rf *readFile) Close() error {
+	return nil
+}
+
+func newWriteFile(fs *PanFileSystem, driveId, panPath string) (*writeFile, error) {
+	temp, err := fs.transfer.TempFile()
+	if err != nil {
+		return nil, err
+	}
+	return &writeFile{
+		fs:      fs,
+		driveId: driveId,
+		panPath: panPath,
+		temp:    temp,
+	}, nil
+}
+
+func (wf *writeFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, os.ErrInvalid
+}
+
+func (wf *writeFile) Stat() (os.FileInfo, error) {
+	fi, err := wf.temp.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return newFileInfo(&aliyunpan.FileEntity{
+		DriveId:   wf.driveId,
+		FileName:  path.Base(wf.panPath),
+		FileSize:  fi.Size(),
+		FileType:  "file",
+		UpdatedAt: fi.ModTime().Format("2006-01-02 15:04:05"),
+		Path:      wf.panPath,
+	}), nil
+}
+
+func (wf *writeFile) Read(p []byte) (int, error) {
+	return 0, errWriteOnly
+}
+
+func (wf *writeFile) Seek(offset int64, whence int) (int64, error) {
+	return wf.temp.Seek(offset, whence)
+}
+
+func (wf *writeFile) Write(p []byte) (int, error) {
+	return wf.temp.Write(p)
+}
+
+// Truncate 修改写入文件的大小
+func (wf *writeFile) Truncate(size int64) error {
+	return wf.temp.Truncate(size)
+}
+
+// Close 上传写入的文件，同名文件会被覆盖
+func (wf *writeFile) Close() error {
+	tempPath := wf.temp.Name()
+	defer os.Remove(tempPath)
+	if err := wf.temp.Close(); err != nil {
+		return err
+	}
+	err := wf.fs.transfer.Upload(wf.driveId, tempPath, wf.panPath)
+	wf.fs.invalidate(wf.driveId, path.Dir(wf.panPath))
+	return err
+}
@@ -0,0 +1,49 @@
+package webdav
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+)
+
+// TestReadFileFromBlockCache 分片已经缓存时直接从缓存读取，不需要访问网盘
+func TestReadFileFromBlockCache(t *testing.T) {
+	dir := t.TempDir()
+	file := &aliyunpan.FileEntity{DriveId: "d1", FileId: "f1", ContentHash: "h1", FileName: "a.txt", FileSize: 10, FileType: "file"}
+	blocks, err := NewBlockCache(nil, dir, 4, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, data := range []string{"0123", "4567", "89"} {
+		if err := os.WriteFile(filepath.Join(dir, blocks.blockName(file, int64(i))), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	blocks, err = NewBlockCache(nil, dir, 4, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rf := &readFile{fs: &PanFileSystem{blocks: blocks}, file: file, info: newFileInfo(file)}
+
+	p := make([]byte, 5)
+	if n, err := rf.ReadAt(p, 2); n != 5 || err != nil || string(p) != "23456" {
+		t.Fatalf("ReadAt = %d %v %q", n, err, p)
+	}
+	if n, err := rf.ReadAt(p, 7); n != 3 || err != io.EOF || string(p[:n]) != "789" {
+		t.Fatalf("ReadAt tail = %d %v %q", n, err, p[:n])
+	}
+	if n, err := rf.ReadAt(p, 10); n != 0 || err != io.EOF {
+		t.Fatalf("ReadAt end = %d %v", n, err)
+	}
+
+	if _, err := rf.Seek(-4, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(rf)
+	if err != nil || string(data) != "6789" {
+		t.Fatalf("Read = %q %v", data, err)
+	}
+}
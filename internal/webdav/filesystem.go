@@ -0,0 +1,319 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package webdav
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/library-go/logger"
+	"golang.org/x/net/webdav"
+)
+
+type (
+	// PanFileSystem 把网盘映射为WebDAV文件系统，根目录下每个网盘（备份盘、资源库、相册）对应一个文件夹。
+	// 目录列表以及路径到文件ID的映射使用 MetaCache 缓存，写操作后清除对应目录的缓存；读取文件使用 BlockCache 分片缓存
+	PanFileSystem struct {
+		panClient *config.PanClient
+		drives    config.DriveInfoList
+		cache     *MetaCache
+		blocks    *BlockCache
+		transfer  *TaskTransfer
+	}
+)
+
+// NewPanFileSystem 创建网盘文件系统，目录元数据缓存保存在dataDir中，读取文件使用blocks分片缓存
+func NewPanFileSystem(panClient *config.PanClient, drives config.DriveInfoList, dataDir string, ttl time.Duration, blocks *BlockCache, transfer *TaskTransfer) (*PanFileSystem, error) {
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return nil, err
+	}
+	fs := &PanFileSystem{
+		panClient: panClient,
+		drives:    drives,
+		blocks:    blocks,
+		transfer:  transfer,
+	}
+	cache, err := OpenMetaCache(dataDir, ttl, fs.listDir)
+	if err != nil {
+		return nil, err
+	}
+	fs.cache = cache
+	return fs, nil
+}
+
+// NewHandler 创建WebDAV请求处理器
+func NewHandler(fs *PanFileSystem) http.Handler {
+	return &webdav.Handler{
+		FileSystem: fs,
+		LockSystem: webdav.NewMemLS(),
+		Logger: func(r *http.Request, err error) {
+			if err != nil {
+				logger.Verbosef("webdav %s %s error: %s\n", r.Method, r.URL.Path, err)
+			}
+		},
+	}
+}
+
+// Close 关闭元数据缓存
+func (fs *PanFileSystem) Close() error {
+	return fs.cache.Close()
+}
+
+// driveDirName 网盘在根目录下对应的文件夹名称
+func driveDirName(d *config.DriveInfo) string {
+	if d.DriveName != "" {
+		return d.DriveName
+	}
+	return d.DriveTag
+}
+
+// resolve 解析WebDAV路径，返回对应的网盘以及网盘内的路径。根目录返回的网盘为nil
+func (fs *PanFileSystem) resolve(name string) (*config.DriveInfo, string, error) {
+	name = path.Clean("/" + name)
+	if name == "/" {
+		return nil, "", nil
+	}
+	parts := strings.SplitN(strings.TrimPrefix(name, "/"), "/", 2)
+	for _, d := range fs.drives {
+		if driveDirName(d) == parts[0] {
+			if len(parts) == 1 {
+				return d, "/", nil
+			}
+			return d, "/" + parts[1], nil
+		}
+	}
+	return nil, "", os.ErrNotExist
+}
+
+// lookup 通过上级目录的文件列表获取文件详情
+func (fs *PanFileSystem) lookup(driveId, panPath string) (*aliyunpan.FileEntity, error) {
+	if panPath == "/" {
+		root := aliyunpan.NewFileEntityForRootDir()
+		root.DriveId = driveId
+		return root, nil
+	}
+	files, _, err := fs.cache.ListDir(driveId, path.Dir(panPath))
+	if err != nil {
+		return nil, err
+	}
+	name := path.Base(panPath)
+	for _, f := range files {
+		if f.FileName == name {
+			return f, nil
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+// listDir 从网盘获取目录下的文件列表，供 MetaCache 使用
+func (fs *PanFileSystem) listDir(driveId, dirPath string) (aliyunpan.FileList, error) {
+	dir, err := fs.lookup(driveId, dirPath)
+	if err != nil {
+		return nil, err
+	}
+	if !dir.IsFolder() {
+		return nil, os.ErrInvalid
+	}
+	files, apierr := fs.panClient.OpenapiPanClient().FileListGetAll(&aliyunpan.FileListParam{
+		DriveId:      driveId,
+		ParentFileId: dir.FileId,
+	}, 200)
+	if apierr != nil {
+		return nil, apierr
+	}
+	for _, f := range files {
+		f.Path = path.Join(dirPath, f.FileName)
+	}
+	return files, nil
+}
+
+// invalidate 写操作后清除目录缓存，同时清除API客户端的路径缓存
+func (fs *PanFileSystem) invalidate(driveId string, dirs ...string) {
+	for _, dir := range dirs {
+		if err := fs.cache.Invalidate(driveId, dir); err != nil {
+			logger.Verboseln("invalidate webdav meta cache error: ", err)
+		}
+	}
+	fs.panClient.OpenapiPanClient().ClearCache()
+}
+
+// readDir 获取目录下的文件信息，根目录返回网盘列表
+func (fs *PanFileSystem) readDir(drive *config.DriveInfo, panPath string) ([]os.FileInfo, error) {
+	if drive == nil {
+		infos := make([]os.FileInfo, 0, len(fs.drives))
+		for _, d := range fs.drives {
+			infos = append(infos, newDirInfo(driveDirName(d)))
+		}
+		return infos, nil
+	}
+	files, _, err := fs.cache.ListDir(drive.DriveId, panPath)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]os.FileInfo, 0, len(files))
+	for _, f := range files {
+		infos = append(infos, newFileInfo(f))
+	}
+	return infos, nil
+}
+
+func (fs *PanFileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	drive, panPath, err := fs.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	if drive == nil {
+		return newDirInfo("/"), nil
+	}
+	if panPath == "/" {
+		return newDirInfo(driveDirName(drive)), nil
+	}
+	f, err := fs.lookup(drive.DriveId, panPath)
+	if err != nil {
+		return nil, err
+	}
+	return newFileInfo(f), nil
+}
+
+func (fs *PanFileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	drive, panPath, err := fs.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		// 写入的文件先保存到本地临时文件，关闭时上传。没有上传器时(只读挂载)不支持写入
+		if drive == nil || panPath == "/" || fs.transfer == nil {
+			return nil, os.ErrPermission
+		}
+		if f, e := fs.lookup(drive.DriveId, panPath); e == nil && f.IsFolder() {
+			return nil, os.ErrInvalid
+		}
+		if parent, e := fs.lookup(drive.DriveId, path.Dir(panPath)); e != nil || !parent.IsFolder() {
+			return nil, os.ErrNotExist
+		}
+		return newWriteFile(fs, drive.DriveId, panPath)
+	}
+
+	info, err := fs.Stat(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &dirFile{fs: fs, drive: drive, panPath: panPath, info: info}, nil
+	}
+	return &readFile{fs: fs, file: info.(*fileInfo).file, info: info}, nil
+}
+
+func (fs *PanFileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	drive, panPath, err := fs.resolve(name)
+	if err != nil {
+		return err
+	}
+	if drive == nil || panPath == "/" {
+		return os.ErrExist
+	}
+	if _, e := fs.lookup(drive.DriveId, panPath); e == nil {
+		return os.ErrExist
+	}
+	if parent, e := fs.lookup(drive.DriveId, path.Dir(panPath)); e != nil || !parent.IsFolder() {
+		return os.ErrNotExist
+	}
+	if _, apierr := fs.panClient.OpenapiPanClient().MkdirByFullPath(drive.DriveId, panPath); apierr != nil {
+		return apierr
+	}
+	fs.invalidate(drive.DriveId, path.Dir(panPath))
+	return nil
+}
+
+func (fs *PanFileSystem) RemoveAll(ctx context.Context, name string) error {
+	drive, panPath, err := fs.resolve(name)
+	if err != nil {
+		return err
+	}
+	if drive == nil || panPath == "/" {
+		return os.ErrPermission
+	}
+	f, err := fs.lookup(drive.DriveId, panPath)
+	if err != nil {
+		return err
+	}
+	// 删除的文件移动到回收站
+	r, apierr := fs.panClient.OpenapiPanClient().FileDelete(&aliyunpan.FileBatchActionParam{
+		DriveId: drive.DriveId,
+		FileId:  f.FileId,
+	})
+	if apierr != nil {
+		return apierr
+	}
+	if !r.Success {
+		return os.ErrPermission
+	}
+	fs.invalidate(drive.DriveId, path.Dir(panPath), panPath)
+	return nil
+}
+
+func (fs *PanFileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	oldDrive, oldPath, err := fs.resolve(oldName)
+	if err != nil {
+		return err
+	}
+	newDrive, newPath, err := fs.resolve(newName)
+	if err != nil {
+		return err
+	}
+	if oldDrive == nil || newDrive == nil || oldPath == "/" || newPath == "/" || oldDrive.DriveId != newDrive.DriveId {
+		// 不支持跨网盘移动
+		return os.ErrPermission
+	}
+	driveId := oldDrive.DriveId
+	f, err := fs.lookup(driveId, oldPath)
+	if err != nil {
+		return err
+	}
+	if path.Dir(oldPath) != path.Dir(newPath) {
+		parent, e := fs.lookup(driveId, path.Dir(newPath))
+		if e != nil || !parent.IsFolder() {
+			return os.ErrNotExist
+		}
+		r, apierr := fs.panClient.OpenapiPanClient().FileMove(&aliyunpan.FileMoveParam{
+			DriveId:        driveId,
+			FileId:         f.FileId,
+			ToDriveId:      driveId,
+			ToParentFileId: parent.FileId,
+		})
+		if apierr != nil {
+			return apierr
+		}
+		if !r.Success {
+			return os.ErrPermission
+		}
+	}
+	if path.Base(oldPath) != path.Base(newPath) {
+		ok, apierr := fs.panClient.OpenapiPanClient().FileRename(driveId, f.FileId, path.Base(newPath))
+		if apierr != nil {
+			return apierr
+		}
+		if !ok {
+			return os.ErrPermission
+		}
+	}
+	fs.invalidate(driveId, path.Dir(oldPath), path.Dir(newPath), oldPath)
+	return nil
+}
@@ -0,0 +1,226 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package webdav
+
+import (
+	"encoding/json"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/bolt"
+	"github.com/tickstep/library-go/logger"
+)
+
+const (
+	// MetaCacheFileName 目录元数据缓存数据库文件名
+	MetaCacheFileName = "webdav_meta_cache.db"
+	// MetaCacheMaxDirs 最多缓存的目录数量，超过后删除最久没有更新的目录
+	MetaCacheMaxDirs = 10000
+
+	metaCacheBucket = "dir_meta"
+)
+
+type (
+	// DirMeta 缓存的目录元数据
+	DirMeta struct {
+		UpdatedAt int64              `json:"updatedAt"` // 缓存更新时间，Unix时间戳
+		Files     aliyunpan.FileList `json:"files"`
+	}
+
+	// ListDirFunc 从网盘获取目录下的文件列表
+	ListDirFunc func(driveId, dirPath string) (aliyunpan.FileList, error)
+
+	// MetaCache 目录元数据持久缓存。
+	// 缓存保存在本地数据库中，重启后可以立即浏览；超过有效期的缓存仍然返回（标记为可能过期），同时在后台刷新该目录。
+	// 缓存的目录超过 maxDirs 时删除最久没有更新的目录
+	MetaCache struct {
+		db         *bolt.DB
+		ttl        time.Duration
+		maxDirs    int
+		list       ListDirFunc
+		refreshing map[string]bool
+		mutex      sync.Mutex
+		wg         sync.WaitGroup
+	}
+)
+
+// OpenMetaCache 打开数据目录下的元数据缓存数据库
+func OpenMetaCache(dataDir string, ttl time.Duration, list ListDirFunc) (*MetaCache, error) {
+	db, err := bolt.Open(filepath.Join(dataDir, MetaCacheFileName), 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, e := tx.CreateBucketIfNotExists([]byte(metaCacheBucket))
+		return e
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &MetaCache{
+		db:         db,
+		ttl:        ttl,
+		maxDirs:    MetaCacheMaxDirs,
+		list:       list,
+		refreshing: map[string]bool{},
+	}, nil
+}
+
+func metaCacheKey(driveId, dirPath string) []byte {
+	return []byte(driveId + ":" + path.Clean("/"+dirPath))
+}
+
+// Get 获取缓存的目录元数据，stale为true代表缓存已经超过有效期
+func (mc *MetaCache) Get(driveId, dirPath string) (meta *DirMeta, stale bool) {
+	mc.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket([]byte(metaCacheBucket)).Get(metaCacheKey(driveId, dirPath))
+		if data == nil {
+			return nil
+		}
+		m := &DirMeta{}
+		if err := json.Unmarshal(data, m); err != nil {
+			logger.Verboseln("parse webdav meta cache error: ", err)
+			return nil
+		}
+		meta = m
+		return nil
+	})
+	if meta == nil {
+		return nil, false
+	}
+	return meta, time.Since(time.Unix(meta.UpdatedAt, 0)) > mc.ttl
+}
+
+// Put 保存目录元数据
+func (mc *MetaCache) Put(driveId, dirPath string, files aliyunpan.FileList) error {
+	data, err := json.Marshal(&DirMeta{
+		UpdatedAt: time.Now().Unix(),
+		Files:     files,
+	})
+	if err != nil {
+		return err
+	}
+	return mc.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(metaCacheBucket))
+		if err := bucket.Put(metaCacheKey(driveId, dirPath), data); err != nil {
+			return err
+		}
+		return mc.prune(bucket)
+	})
+}
+
+// prune 缓存的目录超过限制时，删除最久没有更新的目录，一次删除到限制的90%，避免每次保存都要清理
+func (mc *MetaCache) prune(bucket *bolt.Bucket) error {
+	if mc.maxDirs <= 0 {
+		return nil
+	}
+	count := 0
+	bucket.ForEach(func(k, v []byte) error {
+		count++
+		return nil
+	})
+	if count <= mc.maxDirs {
+		return nil
+	}
+	type entry struct {
+		key       []byte
+		updatedAt int64
+	}
+	entries := make([]entry, 0, mc.maxDirs+1)
+	bucket.ForEach(func(k, v []byte) error {
+		m := struct {
+			UpdatedAt int64 `json:"updatedAt"`
+		}{}
+		json.Unmarshal(v, &m)
+		entries = append(entries, entry{key: append([]byte{}, k...), updatedAt: m.UpdatedAt})
+		return nil
+	})
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].updatedAt < entries[j].updatedAt
+	})
+	for _, e := range entries[:len(entries)-mc.maxDirs*9/10] {
+		if err := bucket.Delete(e.key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Invalidate 目录内容发生变更（上传、删除、移动等写操作）后删除该目录的缓存
+func (mc *MetaCache) Invalidate(driveId, dirPath string) error {
+	return mc.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(metaCacheBucket)).Delete(metaCacheKey(driveId, dirPath))
+	})
+}
+
+// ListDir 获取目录下的文件列表，优先使用缓存。
+// 缓存过期时直接返回旧的缓存并在后台刷新，没有缓存时同步从网盘获取
+func (mc *MetaCache) ListDir(driveId, dirPath string) (files aliyunpan.FileList, stale bool, err error) {
+	meta, stale := mc.Get(driveId, dirPath)
+	if meta != nil {
+		if stale {
+			mc.refreshAsync(driveId, dirPath)
+		}
+		return meta.Files, stale, nil
+	}
+	files, err = mc.refresh(driveId, dirPath)
+	return files, false, err
+}
+
+func (mc *MetaCache) refresh(driveId, dirPath string) (aliyunpan.FileList, error) {
+	files, err := mc.list(driveId, dirPath)
+	if err != nil {
+		return nil, err
+	}
+	if e := mc.Put(driveId, dirPath, files); e != nil {
+		logger.Verboseln("save webdav meta cache error: ", e)
+	}
+	return files, nil
+}
+
+// refreshAsync 后台刷新目录缓存，同一个目录同时只会有一个刷新任务
+func (mc *MetaCache) refreshAsync(driveId, dirPath string) {
+	key := string(metaCacheKey(driveId, dirPath))
+	mc.mutex.Lock()
+	if mc.refreshing[key] {
+		mc.mutex.Unlock()
+		return
+	}
+	mc.refreshing[key] = true
+	mc.mutex.Unlock()
+
+	mc.wg.Add(1)
+	go func() {
+		defer mc.wg.Done()
+		defer func() {
+			mc.mutex.Lock()
+			delete(mc.refreshing, key)
+			mc.mutex.Unlock()
+		}()
+		if _, err := mc.refresh(driveId, dirPath); err != nil {
+			logger.Verbosef("refresh webdav meta cache error: %s, %s\n", dirPath, err)
+		}
+	}()
+}
+
+// Close 等待后台刷新完成并关闭数据库
+func (mc *MetaCache) Close() error {
+	mc.wg.Wait()
+	return mc.db.Close()
+}
@@ -0,0 +1,191 @@
+package webdav
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tickstep/aliyunpan-api/aliyunpan"
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/bolt"
+)
+
+func TestMetaCachePrune(t *testing.T) {
+	dir := t.TempDir()
+	mc, err := OpenMetaCache(dir, 0, func(driveId, dirPath string) (aliyunpan.FileList, error) {
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mc.Close()
+	mc.maxDirs = 10
+
+	files := aliyunpan.FileList{{FileName: "a.txt"}}
+	// dir0 最旧，dir9 最新
+	err = mc.db.Update(func(tx *bolt.Tx) error {
+		for i := 0; i < 10; i++ {
+			data, _ := json.Marshal(&DirMeta{UpdatedAt: int64(1000 + i), Files: files})
+			if err := tx.Bucket([]byte(metaCacheBucket)).Put(metaCacheKey("d1", fmt.Sprintf("/dir%d", i)), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mc.Put("d1", "/dir10", files); err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	mc.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(metaCacheBucket)).ForEach(func(k, v []byte) error {
+			count++
+			return nil
+		})
+	})
+	if count != 9 {
+		t.Fatalf("count = %d, want 9", count)
+	}
+	for _, c := range []struct {
+		dir  string
+		kept bool
+	}{{"/dir0", false}, {"/dir1", false}, {"/dir2", true}, {"/dir9", true}, {"/dir10", true}} {
+		if meta, _ := mc.Get("d1", c.dir); (meta != nil) != c.kept {
+			t.Errorf("%s kept = %v, want %v", c.dir, meta != nil, c.kept)
+		}
+	}
+	if fi, err := os.Stat(dir + "/" + MetaCacheFileName); err != nil || fi.Mode().Perm() != 0600 {
+		t.Fatalf("db file mode: %v %v", fi, err)
+	}
+}
+
+// fakeLister 记录从网盘获取目录列表的次数
+type fakeLister struct {
+	files aliyunpan.FileList
+	calls int
+	mutex sync.Mutex
+}
+
+func (fl *fakeLister) list(driveId, dirPath string) (aliyunpan.FileList, error) {
+	fl.mutex.Lock()
+	defer fl.mutex.Unlock()
+	fl.calls++
+	return fl.files, nil
+}
+
+func (fl *fakeLister) count() int {
+	fl.mutex.Lock()
+	defer fl.mutex.Unlock()
+	return fl.calls
+}
+
+func TestMetaCacheListDir(t *testing.T) {
+	dir := t.TempDir()
+	fl := &fakeLister{files: aliyunpan.FileList{{FileName: "a.txt", FileType: "file", FileSize: 5}}}
+	mc, err := OpenMetaCache(dir, time.Hour, fl.list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name  string
+		setup func()
+		stale bool
+		calls int
+	}{
+		{"没有缓存时从网盘获取", func() {}, false, 1},
+		{"使用缓存", func() {}, false, 1},
+		{"缓存过期时返回旧缓存并在后台刷新", func() {
+			mc.ttl = -time.Second
+		}, true, 2},
+		{"写操作后重新获取", func() {
+			mc.ttl = time.Hour
+			mc.Invalidate("d1", "/docs/")
+		}, false, 3},
+	}
+	for _, c := range cases {
+		c.setup()
+		files, stale, err := mc.ListDir("d1", "/docs")
+		mc.wg.Wait()
+		if err != nil || len(files) != 1 || stale != c.stale || fl.count() != c.calls {
+			t.Errorf("%s: files %v, stale %v, calls %d, error %v", c.name, files, stale, fl.count(), err)
+		}
+	}
+	mc.Close()
+}
+
+func TestPanFileSystemReadsMetaCache(t *testing.T) {
+	dir := t.TempDir()
+	drives := config.DriveInfoList{{DriveId: "d1", DriveName: "backup", DriveTag: "File"}}
+	fl := &fakeLister{files: aliyunpan.FileList{
+		{FileName: "docs", FileType: "folder", FileId: "f1"},
+		{FileName: "a.txt", FileType: "file", FileId: "f2", FileSize: 5},
+	}}
+	mc, err := OpenMetaCache(dir, time.Hour, fl.list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = mc.ListDir("d1", "/"); err != nil {
+		t.Fatal(err)
+	}
+	mc.Close()
+
+	// 重新启动后直接使用持久化的缓存浏览，不需要访问网盘
+	mc, err = OpenMetaCache(dir, time.Hour, fl.list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mc.Close()
+	fs := &PanFileSystem{drives: drives, cache: mc}
+	cases := []struct {
+		name  string
+		isDir bool
+		size  int64
+		err   bool
+	}{
+		{"/backup/docs", true, 0, false},
+		{"/backup/a.txt", false, 5, false},
+		{"/backup/b.txt", false, 0, true},
+	}
+	for _, c := range cases {
+		fi, err := fs.Stat(context.Background(), c.name)
+		if (err != nil) != c.err {
+			t.Errorf("%s: error %v", c.name, err)
+			continue
+		}
+		if err == nil && (fi.IsDir() != c.isDir || fi.Size() != c.size) {
+			t.Errorf("%s: dir %v, size %d", c.name, fi.IsDir(), fi.Size())
+		}
+	}
+	infos, err := fs.readDir(drives[0], "/")
+	if err != nil || len(infos) != 2 {
+		t.Fatalf("read dir %v, error %v", infos, err)
+	}
+	if fl.count() != 1 {
+		t.Fatalf("cached dir should not be listed again, calls %d", fl.count())
+	}
+}
+
+func TestPanFileSystemWithoutTransferIsReadOnly(t *testing.T) {
+	drives := config.DriveInfoList{{DriveId: "d1", DriveName: "backup", DriveTag: "File"}}
+	fl := &fakeLister{files: aliyunpan.FileList{
+		{FileName: "a.txt", FileType: "file", FileId: "f2", FileSize: 5},
+	}}
+	mc, err := OpenMetaCache(t.TempDir(), time.Hour, fl.list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mc.Close()
+	// 只读挂载时没有上传器，打开写入返回没有权限，而不是空指针
+	fs := &PanFileSystem{drives: drives, cache: mc}
+	for _, flag := range []int{os.O_WRONLY, os.O_RDWR, os.O_CREATE | os.O_WRONLY, os.O_TRUNC} {
+		if _, err = fs.OpenFile(context.Background(), "/backup/b.txt", flag, 0644); !os.IsPermission(err) {
+			t.Errorf("flag %d: error %v", flag, err)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2020 tickstep.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package webdav
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/tickstep/aliyunpan/internal/config"
+	"github.com/tickstep/aliyunpan/internal/functions/panupload"
+	"github.com/tickstep/aliyunpan/internal/localfile"
+	"github.com/tickstep/aliyunpan/internal/log"
+	"github.com/tickstep/aliyunpan/internal/plugins"
+	"github.com/tickstep/aliyunpan/internal/taskframework"
+	"github.com/tickstep/library-go/converter"
+	"github.com/tickstep/library-go/requester/rio/speeds"
+)
+
+const (
+	// 上传分片大小，上传时会根据文件大小自动调整
+	uploadBlockSize = 10 * converter.MB
+	// 上传失败最大重试次数
+	transferMaxRetry = 3
+)
+
+type (
+	// TaskTransfer 使用上传任务单元把本地缓存目录中的文件上传到网盘。
+	// 写入的文件先保存到缓存目录，关闭时再上传；读取网盘文件使用 BlockCache
+	TaskTransfer struct {
+		panClient         *config.PanClient
+		cacheDir          string
+		uploadDatabase    *panupload.UploadingDatabase
+		folderCreateMutex *sync.Mutex
+		apiPacer          *panupload.ApiPacer
+		fileRecorder      *log.FileRecorder
+		globalSpeedsStat  *speeds.Speeds
+		plugin            plugins.Plugin
+	}
+)
+
+// NewTaskTransfer 创建文件传输器，cacheDir为本地缓存目录，dataDir为账号的数据目录，保存断点续传数据库
+func NewTaskTransfer(panClient *config.PanClient, cacheDir, dataDir string) (*TaskTransfer, error) {
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return nil, err
+	}
+	uploadDatabase, err := panupload.NewUserUploadingDatabase(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	fileRecorder := log.NewFileRecorder(config.GetLogDir() + "/webdav_file_records.csv")
+	fileRecorder.SetTargets("webdav", config.Config.OpenLogTargets())
+	fileRecorder.SetHistory(log.NewTransferHistory(config.GetTransferHistoryFilePath()))
+	// 所有上传任务共用插件，插件文件修改后自动重新加载
+	plugin, _ := plugins.NewPluginManager(config.GetPluginDir()).GetReloadablePlugin()
+	return &TaskTransfer{
+		panClient:         panClient,
+		cacheDir:          cacheDir,
+		uploadDatabase:    uploadDatabase,
+		folderCreateMutex: &sync.Mutex{},
+		apiPacer:          panupload.NewApiPacer(config.Config.UploadApiQps),
+		fileRecorder:      fileRecorder,
+		globalSpeedsStat:  &speeds.Speeds{},
+		plugin:            plugin,
+	}, nil
+}
+
+// TempFile 在缓存目录创建写入用的临时文件
+func (t *TaskTransfer) TempFile() (*os.File, error) {
+	return os.CreateTemp(t.cacheDir, "upload-*")
+}
+
+// runTask 执行单个任务，等待任务结束
+func runTask(unit taskframework.TaskUnit, executor *taskframework.TaskExecutor) {
+	executor.SetParallel(1)
+	executor.Append(unit, transferMaxRetry)
+	executor.Execute()
+}
+
+// Upload 上传本地文件到网盘，网盘已存在同名文件时覆盖
+func (t *TaskTransfer) Upload(driveId, localPath, panPath string) error {
+	statistic := &panupload.UploadStatistic{}
+	unit := &panupload.UploadTaskUnit{
+		LocalFileChecksum: localfile.NewLocalSymlinkFileEntity(localfile.NewSymlinkFile(localPath)),
+		SavePath:          panPath,
+		DriveId:           driveId,
+		FolderCreateMutex: t.folderCreateMutex,
+		ApiPacer:          t.apiPacer,
+		PanClient:         t.panClient,
+		UploadingDatabase: t.uploadDatabase,
+		Parallel:          1,
+		BlockSize:         uploadBlockSize,
+		UploadStatistic:   statistic,
+		IsOverwrite:       true,
+		GlobalSpeedsStat:  t.globalSpeedsStat,
+		FileRecorder:      t.fileRecorder,
+		Plugin:            t.plugin,
+	}
+	runTask(unit, &taskframework.TaskExecutor{})
+	if statistic.SucceedCount() == 0 {
+		return fmt.Errorf("上传文件失败: %s", panPath)
+	}
+	return nil
+}
+
+// Close 关闭上传数据库并清理缓存目录
+func (t *TaskTransfer) Close() error {
+	t.fileRecorder.Close()
+	t.uploadDatabase.Close()
+	return os.RemoveAll(t.cacheDir)
+}
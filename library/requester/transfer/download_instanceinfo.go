@@ -31,6 +31,8 @@ type (
 		GenBegin             int64        `json:"genBegin,omitempty"`
 		BlockSize            int64        `json:"blockSize,omitempty"`
 		Ranges               []*Range     `json:"ranges,omitempty"`
+		FileId               string       `json:"fileId,omitempty"`      // 网盘文件ID
+		ContentHash          string       `json:"contentHash,omitempty"` // 网盘文件SHA1
 	}
 )
 
@@ -14,6 +14,7 @@
 package transfer
 
 import (
+	"github.com/tickstep/aliyunpan/internal/file/ratelimit"
 	"github.com/tickstep/library-go/requester/rio/speeds"
 	"sync"
 	"sync/atomic"
@@ -41,7 +42,7 @@ type (
 
 		startTime time.Time // 开始下载的时间
 
-		rateLimit *speeds.RateLimit // 限速控制
+		rateLimit ratelimit.Limiter // 限速控制
 
 		gen *RangeListGen // Range生成状态
 		mu  sync.Mutex
@@ -56,7 +57,7 @@ func NewDownloadStatus() *DownloadStatus {
 }
 
 // SetRateLimit 设置限速
-func (ds *DownloadStatus) SetRateLimit(rl *speeds.RateLimit) {
+func (ds *DownloadStatus) SetRateLimit(rl ratelimit.Limiter) {
 	ds.rateLimit = rl
 }
 
@@ -84,7 +84,7 @@ func init() {
 
 func checkLoginExpiredAndRelogin() {
 	command.ReloadConfigFunc(nil)
-	activeUser := config.Config.ActiveUser()
+	activeUser := command.GetActiveUser()
 	if activeUser == nil || activeUser.UserId == "" {
 		// maybe expired, try to login
 		command.TryLogin()
@@ -108,12 +108,8 @@ func main() {
 			// Token刷新进程，不管是CLI命令行模式，还是直接命令模式，本刷新任务都会执行
 			time.Sleep(time.Duration(1) * time.Minute)
 			//time.Sleep(time.Duration(5) * time.Second)
-			for _, u := range config.Config.UserList {
-				if u.UserId == config.Config.ActiveUID {
-					if u.PanClient() != nil {
-						checkLoginExpiredAndRelogin()
-					}
-				}
+			if u := command.GetActiveUser(); u != nil && u.PanClient() != nil {
+				checkLoginExpiredAndRelogin()
 			}
 		}
 	}()
@@ -154,6 +150,18 @@ func main() {
 			EnvVar:      config.EnvVerbose,
 			Destination: &logger.IsVerbose,
 		},
+		cli.BoolFlag{
+			Name:        "json",
+			Usage:       "以JSON格式输出命令结果，便于脚本调用",
+			EnvVar:      config.EnvJsonOutput,
+			Destination: &global.IsJsonOutput,
+		},
+		cli.StringFlag{
+			Name:        "user",
+			Usage:       "本次运行使用的账号，可以是uid、别名、用户名或者昵称，不改变当前登录账号",
+			EnvVar:      config.EnvUser,
+			Destination: &global.CommandUser,
+		},
 	}
 
 	// 进入交互CLI命令行界面
@@ -216,6 +224,11 @@ func main() {
 					s = append(s, name+" ")
 				}
 			}
+			for _, name := range command.CommandAliasNames() {
+				if strings.HasPrefix(name, line) {
+					s = append(s, name+" ")
+				}
+			}
 
 			switch numArgs {
 			case 0:
@@ -252,6 +265,7 @@ func main() {
 		fmt.Printf("提示: 方向键上下可切换历史命令.\n")
 		fmt.Printf("提示: Ctrl + A / E 跳转命令 首 / 尾.\n")
 		fmt.Printf("提示: 输入 help 获取帮助.\n")
+		fmt.Printf("提示: 支持管道 | 过滤命令输出(grep、head、tail、sort、wc), 使用 cmdalias 设置命令别名.\n")
 
 		// check update
 		command.ReloadConfigFunc(c)
@@ -282,7 +296,7 @@ func main() {
 		for {
 			var (
 				prompt     string
-				activeUser = config.Config.ActiveUser()
+				activeUser = command.GetActiveUser()
 			)
 
 			if activeUser == nil {
@@ -322,10 +336,17 @@ func main() {
 
 			line.State.AppendHistory(commandLine)
 
-			cmdArgs := args.Parse(commandLine)
+			// 展开命令别名，按照管道拆分命令，第一段为要执行的命令，后面的为过滤输出的内部命令
+			segments := args.SplitPipe(command.ExpandCommandAlias(commandLine))
+			cmdArgs := args.Parse(segments[0])
 			if len(cmdArgs) == 0 {
 				continue
 			}
+			filters, err := command.ParseShellFilters(segments[1:])
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
 
 			s := []string{os.Args[0]}
 			s = append(s, cmdArgs...)
@@ -333,7 +354,9 @@ func main() {
 			// 恢复原始终端状态
 			// 防止运行命令时程序被结束, 终端出现异常
 			line.Pause()
-			c.App.Run(s)
+			command.RunWithShellFilters(filters, func() {
+				c.App.Run(s)
+			})
 			line.Resume()
 		}
 	}
@@ -355,6 +378,12 @@ func main() {
 		// 切换阿里账号 su
 		command.CmdSu(),
 
+		// 设置帐号别名 alias
+		command.CmdAlias(),
+
+		// 交互命令行的命令别名 cmdalias
+		command.CmdCommandAlias(),
+
 		// 获取当前帐号 who
 		command.CmdWho(),
 
@@ -378,6 +407,9 @@ func main() {
 
 		// 删除文件/目录 rm
 		command.CmdRm(),
+		command.CmdPruneEmpty(),
+		command.CmdPruneBackup(),
+		command.CmdDedup(),
 
 		// 复制文件/目录 cp
 		command.CmdCp(),
@@ -397,18 +429,37 @@ func main() {
 		// 下载文件/目录 download
 		command.CmdDownload(),
 
+		// 校验本地目录和云盘目录 verify
+		command.CmdVerify(),
+
 		// 显示和修改程序配置项 config
 		command.CmdConfig(),
 
 		// 工具箱 tool
 		command.CmdTool(),
 
+		// 审计日志 audit
+		command.CmdAudit(),
+
+		// JS插件管理 plugin
+		command.CmdPlugin(),
+
 		// 分享文件/目录 share
 		command.CmdShare(),
 
+		// 文件标签 tag
+		command.CmdTag(),
+
 		// 相簿
 		command.CmdAlbum(),
 
+		// WebDAV服务 webdav
+		command.CmdWebdav(),
+
+		// 挂载网盘 mount
+		command.CmdMount(),
+		command.CmdDaemon(),
+
 		// 显示命令历史
 		{
 			Name:      "history",
@@ -426,6 +477,9 @@ func main() {
 
 		3. 显示全部命令历史
 		aliyunpan history -n 0
+
+		4. 查询上传、下载、同步的传输记录
+		aliyunpan history list
 `,
 			Category: "其他",
 			Action: func(c *cli.Context) error {
@@ -479,6 +533,10 @@ func main() {
 					Value: 20,
 				},
 			},
+			Subcommands: []cli.Command{
+				// 查询传输记录 history list
+				command.CmdTransferHistoryList(),
+			},
 		},
 
 		// 清空控制台 clear
@@ -661,9 +719,13 @@ func main() {
 		}
 		app.Commands = append(app.Commands, hiddenCommands...)
 	}
+	app.Before = command.InitAppLog
 	sort.Sort(cli.FlagsByName(app.Flags))
 	sort.Sort(cli.CommandsByName(app.Commands))
+	command.WrapJsonOutput(app.Commands)
+	command.WrapAuditLog(app.Commands)
 	app.Run(os.Args)
+	command.WaitWebhookEvents()
 }
 
 // panFilePathCompleter 云盘文件路径Tab补全处理器
@@ -801,7 +863,7 @@ type getFileListByTargetPath func(targetPath string) (string, string, []*fileEnt
 // getPanFileListByTargetPath 通过路径获取云盘文件列表
 func getPanFileListByTargetPath(targetPath string) (string, string, []*fileEntity) {
 	var (
-		activeUser     = config.Config.ActiveUser()
+		activeUser     = command.GetActiveUser()
 		targetDir      string
 		targetFullPath string
 		isAbs          = path.IsAbs(targetPath)